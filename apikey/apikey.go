@@ -0,0 +1,158 @@
+package apikey
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/randx"
+)
+
+// TokenPrefix is prepended to every API key so that it can be told apart from session tokens.
+const TokenPrefix = "ak_"
+
+const secretLength = 32
+
+var (
+	// ErrInvalidKey is returned when an API key is malformed, unknown, revoked, or expired.
+	ErrInvalidKey = herodot.ErrUnauthorized.WithError("api key is invalid").WithReason("The provided API key is invalid, revoked, or expired.")
+)
+
+type (
+	// API Key
+	//
+	// An API key (also called personal access token) allows machine identities to authenticate without
+	// a login flow. The plaintext token is only returned once, when the key is created.
+	//
+	// swagger:model apiKey
+	Key struct {
+		// ID is the unique identifier of this API key.
+		//
+		// required: true
+		ID uuid.UUID `json:"id"`
+
+		// Name is a human readable description of the key.
+		Name string `json:"name"`
+
+		// Scopes limit what the key may be used for. They are forwarded to upstream services when the key is
+		// checked using `/sessions/whoami`.
+		Scopes []string `json:"scopes"`
+
+		// ExpiresAt is the time after which the key is no longer valid. If empty, the key never expires.
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+		// RevokedAt is set once the key was revoked.
+		RevokedAt *time.Time `json:"revoked_at,omitempty"`
+
+		// CreatedAt is the time the key was created.
+		//
+		// required: true
+		CreatedAt time.Time `json:"created_at"`
+
+		// Token is the plaintext API key. It is only set in the response to the request which created the key.
+		Token string `json:"token,omitempty"`
+	}
+
+	// CredentialsConfig is the struct that is being used as part of the identity credentials.
+	CredentialsConfig struct {
+		// Keys are the identity's API keys.
+		Keys []StoredKey `json:"keys"`
+	}
+
+	// StoredKey is an API key as stored in the identity's credentials.
+	StoredKey struct {
+		Key
+
+		// SecretHMAC is the HMAC-SHA256 of the key's secret.
+		SecretHMAC string `json:"secret_hmac"`
+	}
+)
+
+// IsActive returns true if the key was neither revoked nor is expired.
+func (k *Key) IsActive() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || k.ExpiresAt.After(time.Now()))
+}
+
+// HasScope returns true if the key was granted the given scope.
+func (k *Key) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the stored key with the given ID.
+func (c *CredentialsConfig) find(id uuid.UUID) (*StoredKey, bool) {
+	for k := range c.Keys {
+		if c.Keys[k].ID == id {
+			return &c.Keys[k], true
+		}
+	}
+	return nil, false
+}
+
+// keys returns the keys without their secret HMACs.
+func (c *CredentialsConfig) keys() []Key {
+	keys := make([]Key, len(c.Keys))
+	for k := range c.Keys {
+		keys[k] = c.Keys[k].Key
+	}
+	return keys
+}
+
+// newSecret generates the secret part of an API key.
+func newSecret() string {
+	return string(randx.MustString(secretLength, randx.AlphaNum))
+}
+
+// formatToken returns the plaintext API key for the key ID and secret.
+func formatToken(id uuid.UUID, secret string) string {
+	return TokenPrefix + strings.Replace(id.String(), "-", "", -1) + "_" + secret
+}
+
+// parseToken splits a plaintext API key into its key ID and secret.
+func parseToken(token string) (uuid.UUID, string, error) {
+	if !IsToken(token) {
+		return uuid.Nil, "", errors.WithStack(ErrInvalidKey)
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(token, TokenPrefix), "_", 2)
+	if len(parts) != 2 || len(parts[1]) == 0 {
+		return uuid.Nil, "", errors.WithStack(ErrInvalidKey)
+	}
+
+	id, err := uuid.FromString(parts[0])
+	if err != nil {
+		return uuid.Nil, "", errors.WithStack(ErrInvalidKey.WithDebug(err.Error()))
+	}
+
+	return id, parts[1], nil
+}
+
+// IsToken returns true if the value looks like an API key.
+func IsToken(token string) bool {
+	return strings.HasPrefix(token, TokenPrefix)
+}
+
+// normalizeScopes trims and deduplicates scopes and rejects scopes containing whitespace.
+func normalizeScopes(scopes []string) ([]string, error) {
+	normalized := make([]string, 0, len(scopes))
+	seen := map[string]bool{}
+	for _, s := range scopes {
+		s = strings.TrimSpace(s)
+		if len(s) == 0 || seen[s] {
+			continue
+		}
+		if strings.ContainsAny(s, " \t\r\n") {
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Scope %q must not contain whitespace.", s))
+		}
+		seen[s] = true
+		normalized = append(normalized, s)
+	}
+	return normalized, nil
+}
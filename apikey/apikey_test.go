@@ -0,0 +1,54 @@
+package apikey
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zzpu/ums/x"
+)
+
+func TestToken(t *testing.T) {
+	id := x.NewUUID()
+	secret := newSecret()
+	token := formatToken(id, secret)
+	assert.True(t, IsToken(token))
+
+	actualID, actualSecret, err := parseToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, id, actualID)
+	assert.Equal(t, secret, actualSecret)
+
+	for _, token := range []string{
+		"",
+		secret,
+		TokenPrefix,
+		TokenPrefix + "not-a-uuid_" + secret,
+		TokenPrefix + id.String(),
+		formatToken(id, ""),
+	} {
+		_, _, err := parseToken(token)
+		assert.Error(t, err, token)
+	}
+}
+
+func TestNormalizeScopes(t *testing.T) {
+	actual, err := normalizeScopes([]string{" read", "write ", "read", ""})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"read", "write"}, actual)
+
+	_, err = normalizeScopes([]string{"read write"})
+	require.Error(t, err)
+}
+
+func TestKeyIsActive(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Minute)
+
+	assert.True(t, (&Key{}).IsActive())
+	assert.True(t, (&Key{ExpiresAt: &future}).IsActive())
+	assert.False(t, (&Key{ExpiresAt: &past}).IsActive())
+	assert.False(t, (&Key{RevokedAt: &past}).IsActive())
+}
@@ -0,0 +1,306 @@
+package apikey
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/jsonx"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteCollection = identity.RouteBase + "/:id/api-keys"
+	RouteItem       = RouteCollection + "/:key_id"
+)
+
+type (
+	handlerDependencies interface {
+		ManagementProvider
+		x.WriterProvider
+	}
+	HandlerProvider interface {
+		APIKeyHandler() *Handler
+	}
+	Handler struct {
+		c configuration.Provider
+		r handlerDependencies
+	}
+)
+
+func NewHandler(
+	c configuration.Provider,
+	r handlerDependencies,
+) *Handler {
+	return &Handler{
+		c: c,
+		r: r,
+	}
+}
+
+func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	admin.GET(RouteCollection, h.list)
+	admin.POST(RouteCollection, h.create)
+	admin.GET(RouteItem, h.get)
+	admin.PUT(RouteItem, h.update)
+	admin.DELETE(RouteItem, h.revoke)
+}
+
+// A single API key.
+//
+// swagger:response apiKeyResponse
+// nolint:deadcode,unused
+type apiKeyResponse struct {
+	// required: true
+	// in: body
+	Body *Key
+}
+
+// A list of API keys.
+//
+// swagger:response apiKeyList
+// nolint:deadcode,unused
+type apiKeyListResponse struct {
+	// in: body
+	// required: true
+	// type: array
+	Body []Key
+}
+
+// swagger:parameters listIdentityAPIKeys
+// nolint:deadcode,unused
+type listAPIKeysParameters struct {
+	// ID is the identity's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// swagger:route GET /identities/{id}/api-keys admin listIdentityAPIKeys
+//
+// List an Identity's API Keys
+//
+// Lists all API keys of an identity, including revoked and expired keys. The plaintext tokens are never returned
+// by this endpoint.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: apiKeyList
+//       404: genericError
+//       500: genericError
+func (h *Handler) list(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	keys, err := h.r.APIKeyManager().List(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, keys)
+}
+
+// swagger:parameters getIdentityAPIKey revokeIdentityAPIKey
+// nolint:deadcode,unused
+type apiKeyParameters struct {
+	// ID is the identity's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// KeyID is the API key's ID.
+	//
+	// required: true
+	// in: path
+	KeyID string `json:"key_id"`
+}
+
+// swagger:route GET /identities/{id}/api-keys/{key_id} admin getIdentityAPIKey
+//
+// Get an Identity's API Key
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: apiKeyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	key, err := h.r.APIKeyManager().Get(r.Context(), x.ParseUUID(ps.ByName("id")), x.ParseUUID(ps.ByName("key_id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, key)
+}
+
+// swagger:parameters createIdentityAPIKey
+// nolint:deadcode,unused
+type createAPIKeyParameters struct {
+	// ID is the identity's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// in: body
+	Body CreateAPIKey
+}
+
+type CreateAPIKey struct {
+	// Name is a human readable description of the key.
+	Name string `json:"name"`
+
+	// Scopes limit what the key may be used for.
+	Scopes []string `json:"scopes"`
+
+	// ExpiresAt is the time after which the key is no longer valid. If empty, the key never expires.
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// swagger:route POST /identities/{id}/api-keys admin createIdentityAPIKey
+//
+// Create an API Key for an Identity
+//
+// This endpoint mints a new API key (personal access token) for an identity. The key can be used as a bearer
+// token when calling `/sessions/whoami`. The plaintext token is only included in this response and can not be
+// retrieved again.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       201: apiKeyResponse
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) create(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var p CreateAPIKey
+	if err := jsonx.NewStrictDecoder(r.Body).Decode(&p); err != nil {
+		h.r.Writer().WriteErrorCode(w, r, http.StatusBadRequest, errors.WithStack(err))
+		return
+	}
+
+	id := x.ParseUUID(ps.ByName("id"))
+	key, err := h.r.APIKeyManager().Create(r.Context(), id, p.Name, p.Scopes, p.ExpiresAt)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().WriteCreated(w, r,
+		urlx.AppendPaths(
+			h.c.SelfAdminURL(),
+			"identities",
+			id.String(),
+			"api-keys",
+			key.ID.String(),
+		).String(),
+		key,
+	)
+}
+
+// swagger:parameters updateIdentityAPIKey
+// nolint:deadcode,unused
+type updateAPIKeyParameters struct {
+	// ID is the identity's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// KeyID is the API key's ID.
+	//
+	// required: true
+	// in: path
+	KeyID string `json:"key_id"`
+
+	// in: body
+	Body UpdateAPIKey
+}
+
+type UpdateAPIKey struct {
+	// Scopes replace the key's current scopes.
+	Scopes []string `json:"scopes"`
+
+	// ExpiresAt replaces the key's current expiry time. If empty, the key never expires.
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// swagger:route PUT /identities/{id}/api-keys/{key_id} admin updateIdentityAPIKey
+//
+// Update an Identity's API Key
+//
+// This endpoint replaces the scopes and the expiry time of an API key. Revoked keys can not be updated.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: apiKeyResponse
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) update(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var p UpdateAPIKey
+	if err := jsonx.NewStrictDecoder(r.Body).Decode(&p); err != nil {
+		h.r.Writer().WriteErrorCode(w, r, http.StatusBadRequest, errors.WithStack(err))
+		return
+	}
+
+	key, err := h.r.APIKeyManager().Update(r.Context(), x.ParseUUID(ps.ByName("id")), x.ParseUUID(ps.ByName("key_id")), p.Scopes, p.ExpiresAt)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Writer().Write(w, r, key)
+}
+
+// swagger:route DELETE /identities/{id}/api-keys/{key_id} admin revokeIdentityAPIKey
+//
+// Revoke an Identity's API Key
+//
+// Revoked keys are rejected immediately but remain listed so that their usage can still be audited.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) revoke(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := h.r.APIKeyManager().Revoke(r.Context(), x.ParseUUID(ps.ByName("id")), x.ParseUUID(ps.ByName("key_id"))); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,120 @@
+package apikey_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/x"
+)
+
+func TestHandler(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+	router := x.NewRouterAdmin()
+	reg.APIKeyHandler().RegisterAdminRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	viper.Set(configuration.ViperKeyAdminBaseURL, ts.URL)
+	testhelpers.SetDefaultIdentitySchema("file://./stub/identity.schema.json")
+
+	i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+	require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+	base := "/identities/" + i.ID.String() + "/api-keys"
+
+	var send = func(t *testing.T, method, href string, expectCode int, send interface{}) gjson.Result {
+		var b bytes.Buffer
+		if send != nil {
+			require.NoError(t, json.NewEncoder(&b).Encode(send))
+		}
+		req, err := http.NewRequest(method, ts.URL+href, &b)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+
+		require.EqualValues(t, expectCode, res.StatusCode, "%s", body)
+		return gjson.ParseBytes(body)
+	}
+
+	t.Run("case=should fail for unknown identities", func(t *testing.T) {
+		send(t, "GET", "/identities/"+x.NewUUID().String()+"/api-keys", http.StatusNotFound, nil)
+		send(t, "POST", "/identities/"+x.NewUUID().String()+"/api-keys", http.StatusNotFound, json.RawMessage(`{}`))
+	})
+
+	t.Run("case=should fail for invalid payloads", func(t *testing.T) {
+		send(t, "POST", base, http.StatusBadRequest, json.RawMessage(`{"foo":"bar"}`))
+		send(t, "POST", base, http.StatusBadRequest, json.RawMessage(`{"scopes":["read write"]}`))
+		send(t, "POST", base, http.StatusBadRequest, map[string]interface{}{"expires_at": time.Now().Add(-time.Hour)})
+	})
+
+	var keyID string
+	t.Run("case=should create a key", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour).UTC().Round(time.Second)
+		res := send(t, "POST", base, http.StatusCreated, map[string]interface{}{
+			"name":       "deploy bot",
+			"scopes":     []string{"read", "write"},
+			"expires_at": expiresAt,
+		})
+		keyID = res.Get("id").String()
+		assert.Equal(t, "deploy bot", res.Get("name").String(), "%s", res.Raw)
+		assert.Equal(t, `["read","write"]`, res.Get("scopes").Raw, "%s", res.Raw)
+		assert.Equal(t, expiresAt.Format(time.RFC3339), res.Get("expires_at").String(), "%s", res.Raw)
+		assert.NotEmpty(t, res.Get("token").String(), "%s", res.Raw)
+
+		_, _, err := reg.APIKeyManager().Authenticate(context.Background(), res.Get("token").String())
+		require.NoError(t, err)
+	})
+
+	t.Run("case=should list and get keys without tokens", func(t *testing.T) {
+		res := send(t, "GET", base, http.StatusOK, nil)
+		require.Len(t, res.Array(), 1, "%s", res.Raw)
+		assert.Equal(t, keyID, res.Get("0.id").String(), "%s", res.Raw)
+		assert.False(t, res.Get("0.token").Exists(), "%s", res.Raw)
+		assert.False(t, res.Get("0.secret_hmac").Exists(), "%s", res.Raw)
+
+		res = send(t, "GET", base+"/"+keyID, http.StatusOK, nil)
+		assert.Equal(t, keyID, res.Get("id").String(), "%s", res.Raw)
+		assert.False(t, res.Get("token").Exists(), "%s", res.Raw)
+
+		send(t, "GET", base+"/"+x.NewUUID().String(), http.StatusNotFound, nil)
+	})
+
+	t.Run("case=should update scopes and expiry", func(t *testing.T) {
+		res := send(t, "PUT", base+"/"+keyID, http.StatusOK, map[string]interface{}{"scopes": []string{"read"}})
+		assert.Equal(t, `["read"]`, res.Get("scopes").Raw, "%s", res.Raw)
+		assert.False(t, res.Get("expires_at").Exists(), "%s", res.Raw)
+
+		res = send(t, "GET", base+"/"+keyID, http.StatusOK, nil)
+		assert.Equal(t, `["read"]`, res.Get("scopes").Raw, "%s", res.Raw)
+	})
+
+	t.Run("case=should revoke a key", func(t *testing.T) {
+		send(t, "DELETE", base+"/"+keyID, http.StatusNoContent, nil)
+		send(t, "DELETE", base+"/"+keyID, http.StatusNoContent, nil)
+		send(t, "DELETE", base+"/"+x.NewUUID().String(), http.StatusNotFound, nil)
+
+		res := send(t, "GET", base+"/"+keyID, http.StatusOK, nil)
+		assert.NotEmpty(t, res.Get("revoked_at").String(), "%s", res.Raw)
+
+		send(t, "PUT", base+"/"+keyID, http.StatusBadRequest, map[string]interface{}{"scopes": []string{"read"}})
+	})
+}
@@ -0,0 +1,274 @@
+package apikey
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/x"
+)
+
+type (
+	ManagementProvider interface {
+		APIKeyManager() *Manager
+	}
+	managerDependencies interface {
+		identity.PrivilegedPoolProvider
+	}
+	Manager struct {
+		d managerDependencies
+		c configuration.Provider
+	}
+)
+
+// maxSaveAttempts is the number of times a change to the API keys is retried if the keys were changed concurrently.
+const maxSaveAttempts = 3
+
+func NewManager(d managerDependencies, c configuration.Provider) *Manager {
+	return &Manager{d: d, c: c}
+}
+
+// hashSecret returns the HMAC-SHA256 of the key's secret. API key secrets are long random strings, which is why a
+// keyed hash is sufficient and a slow password hash is not needed.
+func hashSecret(secret string, key []byte) string {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(secret))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// compareSecret returns true if the secret matches the hash for any of the configured secrets.
+func (m *Manager) compareSecret(secret, hashed string) bool {
+	for _, key := range m.c.SecretsDefault() {
+		if subtle.ConstantTimeCompare([]byte(hashSecret(secret, key)), []byte(hashed)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// credentials returns the identity's API key configuration or an empty one if the identity has no keys yet.
+func (m *Manager) credentials(i *identity.Identity) (*CredentialsConfig, error) {
+	var o CredentialsConfig
+	if _, ok := i.GetCredentials(identity.CredentialsTypeAPIKey); !ok {
+		return &o, nil
+	}
+
+	if _, err := i.ParseCredentials(identity.CredentialsTypeAPIKey, &o); err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode API key credentials: %s", err))
+	}
+
+	return &o, nil
+}
+
+// update applies the change to the identity's API keys and saves them, but only if they were not changed in the
+// meantime. Otherwise the keys are loaded again and the change is repeated.
+func (m *Manager) update(ctx context.Context, identityID uuid.UUID, change func(o *CredentialsConfig) error) error {
+	for attempt := 1; ; attempt++ {
+		i, o, err := m.load(ctx, identityID)
+		if err != nil {
+			return err
+		}
+
+		if err := change(o); err != nil {
+			return err
+		}
+
+		config, err := json.Marshal(o)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		identifiers := make([]string, len(o.Keys))
+		for k := range o.Keys {
+			identifiers[k] = o.Keys[k].ID.String()
+		}
+
+		expected, _ := i.GetCredentials(identity.CredentialsTypeAPIKey)
+		err = m.d.PrivilegedIdentityPool().UpdateIdentityCredentials(ctx, i.ID, expected, &identity.Credentials{
+			Type:        identity.CredentialsTypeAPIKey,
+			Identifiers: identifiers,
+			Config:      config,
+		})
+		if errors.Is(err, sqlcon.ErrNoRows) {
+			if attempt < maxSaveAttempts {
+				continue
+			}
+			return errors.WithStack(herodot.ErrConflict.WithReason("The API keys were changed concurrently, please try again."))
+		}
+		return err
+	}
+}
+
+func (m *Manager) load(ctx context.Context, identityID uuid.UUID) (*identity.Identity, *CredentialsConfig, error) {
+	i, err := m.d.PrivilegedIdentityPool().GetIdentityConfidential(ctx, identityID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	o, err := m.credentials(i)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return i, o, nil
+}
+
+func validateExpiresAt(expiresAt *time.Time) error {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return errors.WithStack(herodot.ErrBadRequest.WithReason("The expiry time of an API key must be in the future."))
+	}
+	return nil
+}
+
+// Create mints a new API key for the identity. The returned key is the only one which contains the plaintext token.
+func (m *Manager) Create(ctx context.Context, identityID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*Key, error) {
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateExpiresAt(expiresAt); err != nil {
+		return nil, err
+	}
+
+	secret := newSecret()
+	key := Key{
+		ID:        x.NewUUID(),
+		Name:      name,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	stored := StoredKey{Key: key, SecretHMAC: hashSecret(secret, m.c.SecretsDefault()[0])}
+	if err := m.update(ctx, identityID, func(o *CredentialsConfig) error {
+		o.Keys = append(o.Keys, stored)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	key.Token = formatToken(key.ID, secret)
+	return &key, nil
+}
+
+// List returns all API keys of the identity, including revoked and expired ones.
+func (m *Manager) List(ctx context.Context, identityID uuid.UUID) ([]Key, error) {
+	_, o, err := m.load(ctx, identityID)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.keys(), nil
+}
+
+// Get returns a single API key of the identity.
+func (m *Manager) Get(ctx context.Context, identityID, keyID uuid.UUID) (*Key, error) {
+	_, o, err := m.load(ctx, identityID)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, ok := o.find(keyID)
+	if !ok {
+		return nil, errors.WithStack(sqlcon.ErrNoRows)
+	}
+
+	return &stored.Key, nil
+}
+
+// Update replaces the scopes and expiry time of an API key. Revoked keys can not be updated.
+func (m *Manager) Update(ctx context.Context, identityID, keyID uuid.UUID, scopes []string, expiresAt *time.Time) (*Key, error) {
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateExpiresAt(expiresAt); err != nil {
+		return nil, err
+	}
+
+	var key Key
+	if err := m.update(ctx, identityID, func(o *CredentialsConfig) error {
+		stored, ok := o.find(keyID)
+		if !ok {
+			return errors.WithStack(sqlcon.ErrNoRows)
+		}
+
+		if stored.RevokedAt != nil {
+			return errors.WithStack(herodot.ErrBadRequest.WithReason("The API key was revoked and can no longer be updated."))
+		}
+
+		stored.Scopes = scopes
+		stored.ExpiresAt = expiresAt
+		key = stored.Key
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// Revoke marks an API key as revoked. Revoking an already revoked key does nothing.
+func (m *Manager) Revoke(ctx context.Context, identityID, keyID uuid.UUID) error {
+	return m.update(ctx, identityID, func(o *CredentialsConfig) error {
+		stored, ok := o.find(keyID)
+		if !ok {
+			return errors.WithStack(sqlcon.ErrNoRows)
+		}
+
+		if stored.RevokedAt == nil {
+			now := time.Now().UTC()
+			stored.RevokedAt = &now
+		}
+		return nil
+	})
+}
+
+// Authenticate resolves a plaintext API key to its identity. It returns ErrInvalidKey if the key is unknown,
+// revoked, or expired.
+func (m *Manager) Authenticate(ctx context.Context, token string) (*identity.Identity, *Key, error) {
+	id, secret, err := parseToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	i, c, err := m.d.PrivilegedIdentityPool().FindByCredentialsIdentifier(ctx, identity.CredentialsTypeAPIKey, id.String())
+	if err != nil {
+		return nil, nil, errors.WithStack(ErrInvalidKey.WithDebugf("%+v", err))
+	}
+
+	var o CredentialsConfig
+	if err := json.Unmarshal(c.Config, &o); err != nil {
+		return nil, nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode API key credentials: %s", err))
+	}
+
+	stored, ok := o.find(id)
+	if !ok {
+		return nil, nil, errors.WithStack(ErrInvalidKey.WithDebug("api key is not part of the identity's credentials"))
+	}
+
+	if !stored.IsActive() {
+		return nil, nil, errors.WithStack(ErrInvalidKey.WithDebug("api key was revoked or is expired"))
+	}
+
+	if !m.compareSecret(secret, stored.SecretHMAC) {
+		return nil, nil, errors.WithStack(ErrInvalidKey.WithDebug("api key secret does not match"))
+	}
+
+	key := stored.Key
+	return i, &key, nil
+}
@@ -0,0 +1,145 @@
+package apikey_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/zzpu/ums/apikey"
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/x"
+)
+
+func TestManager(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+	testhelpers.SetDefaultIdentitySchema("file://./stub/identity.schema.json")
+
+	newIdentity := func(t *testing.T) *identity.Identity {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+		return i
+	}
+
+	ctx := context.Background()
+
+	t.Run("case=should authenticate a key", func(t *testing.T) {
+		i := newIdentity(t)
+		key, err := reg.APIKeyManager().Create(ctx, i.ID, "ci", []string{"read"}, nil)
+		require.NoError(t, err)
+		require.NotEmpty(t, key.Token)
+
+		actual, actualKey, err := reg.APIKeyManager().Authenticate(ctx, key.Token)
+		require.NoError(t, err)
+		assert.Equal(t, i.ID, actual.ID)
+		assert.Equal(t, key.ID, actualKey.ID)
+		assert.Equal(t, []string{"read"}, actualKey.Scopes)
+		assert.Empty(t, actualKey.Token)
+
+		stored, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(ctx, i.ID)
+		require.NoError(t, err)
+		c, ok := stored.GetCredentials(identity.CredentialsTypeAPIKey)
+		require.True(t, ok)
+		assert.NotContains(t, string(c.Config), key.Token[len(key.Token)-10:], "the secret must only be stored hashed")
+		assert.Len(t, gjson.GetBytes(c.Config, "keys.0.secret_hmac").String(), 64, "%s", c.Config)
+		assert.Equal(t, []string{key.ID.String()}, c.Identifiers)
+	})
+
+	t.Run("case=should reject a key with a wrong secret", func(t *testing.T) {
+		i := newIdentity(t)
+		key, err := reg.APIKeyManager().Create(ctx, i.ID, "ci", nil, nil)
+		require.NoError(t, err)
+
+		_, _, err = reg.APIKeyManager().Authenticate(ctx, key.Token+"a")
+		require.Error(t, err)
+	})
+
+	t.Run("case=should reject unknown keys", func(t *testing.T) {
+		_, _, err := reg.APIKeyManager().Authenticate(ctx, apikey.TokenPrefix+x.NewUUID().String()+"_secret")
+		require.Error(t, err)
+	})
+
+	t.Run("case=should reject revoked keys", func(t *testing.T) {
+		i := newIdentity(t)
+		key, err := reg.APIKeyManager().Create(ctx, i.ID, "ci", nil, nil)
+		require.NoError(t, err)
+
+		require.NoError(t, reg.APIKeyManager().Revoke(ctx, i.ID, key.ID))
+		_, _, err = reg.APIKeyManager().Authenticate(ctx, key.Token)
+		require.Error(t, err)
+
+		_, err = reg.APIKeyManager().Update(ctx, i.ID, key.ID, []string{"read"}, nil)
+		require.Error(t, err)
+	})
+
+	t.Run("case=should reject expired keys", func(t *testing.T) {
+		i := newIdentity(t)
+		expiresAt := time.Now().Add(time.Second)
+		key, err := reg.APIKeyManager().Create(ctx, i.ID, "ci", nil, &expiresAt)
+		require.NoError(t, err)
+
+		_, _, err = reg.APIKeyManager().Authenticate(ctx, key.Token)
+		require.NoError(t, err)
+
+		time.Sleep(time.Until(expiresAt) + time.Millisecond*100)
+		_, _, err = reg.APIKeyManager().Authenticate(ctx, key.Token)
+		require.Error(t, err)
+	})
+
+	t.Run("case=should support multiple keys per identity", func(t *testing.T) {
+		i := newIdentity(t)
+		first, err := reg.APIKeyManager().Create(ctx, i.ID, "first", nil, nil)
+		require.NoError(t, err)
+		second, err := reg.APIKeyManager().Create(ctx, i.ID, "second", nil, nil)
+		require.NoError(t, err)
+
+		keys, err := reg.APIKeyManager().List(ctx, i.ID)
+		require.NoError(t, err)
+		require.Len(t, keys, 2)
+
+		for _, token := range []string{first.Token, second.Token} {
+			_, _, err = reg.APIKeyManager().Authenticate(ctx, token)
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("case=should not lose keys which are created concurrently", func(t *testing.T) {
+		i := newIdentity(t)
+
+		var wg sync.WaitGroup
+		tokens := make([]string, 5)
+		for k := range tokens {
+			wg.Add(1)
+			go func(k int) {
+				defer wg.Done()
+				for {
+					key, err := reg.APIKeyManager().Create(ctx, i.ID, fmt.Sprintf("key-%d", k), nil, nil)
+					if err != nil {
+						// The keys were changed too often or the database refused the concurrent transaction.
+						continue
+					}
+					tokens[k] = key.Token
+					return
+				}
+			}(k)
+		}
+		wg.Wait()
+
+		keys, err := reg.APIKeyManager().List(ctx, i.ID)
+		require.NoError(t, err)
+		require.Len(t, keys, len(tokens))
+
+		for _, token := range tokens {
+			_, _, err = reg.APIKeyManager().Authenticate(ctx, token)
+			require.NoError(t, err)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package cipher
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// AES implements AES-256-GCM. The keys are derived from the default secrets: the first secret is used for
+// encryption and all secrets are tried for decryption, which allows rotating the secrets.
+type AES struct {
+	c AESConfiguration
+}
+
+type AESConfiguration interface {
+	SecretsDefault() [][]byte
+}
+
+func NewCryptAES(c AESConfiguration) *AES {
+	return &AES{c: c}
+}
+
+func (a *AES) aead(secret []byte) (cipher.AEAD, error) {
+	key := sha256.Sum256(secret)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return aead, nil
+}
+
+func (a *AES) Encrypt(message []byte) (string, error) {
+	if len(message) == 0 {
+		return "", nil
+	}
+
+	aead, err := a.aead(a.c.SecretsDefault()[0])
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return hex.EncodeToString(aead.Seal(nonce, nonce, message, nil)), nil
+}
+
+func (a *AES) Decrypt(ciphertext string) ([]byte, error) {
+	if len(ciphertext) == 0 {
+		return nil, nil
+	}
+
+	raw, err := hex.DecodeString(ciphertext)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode the encrypted value: %s", err))
+	}
+
+	for _, secret := range a.c.SecretsDefault() {
+		aead, err := a.aead(secret)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(raw) < aead.NonceSize() {
+			break
+		}
+
+		if message, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], nil); err == nil {
+			return message, nil
+		}
+	}
+
+	return nil, errors.WithStack(herodot.ErrInternalServerError.WithReason("Unable to decrypt the value with any of the configured secrets."))
+}
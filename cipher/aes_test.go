@@ -0,0 +1,76 @@
+package cipher_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zzpu/ums/cipher"
+)
+
+type secrets [][]byte
+
+func (s *secrets) SecretsDefault() [][]byte {
+	return *s
+}
+
+func TestAES(t *testing.T) {
+	s := &secrets{[]byte("secret-a")}
+	c := cipher.NewCryptAES(s)
+
+	t.Run("case=encrypts and decrypts", func(t *testing.T) {
+		ciphertext, err := c.Encrypt([]byte("token"))
+		require.NoError(t, err)
+		assert.NotContains(t, ciphertext, "token")
+
+		other, err := c.Encrypt([]byte("token"))
+		require.NoError(t, err)
+		assert.NotEqual(t, ciphertext, other, "every encryption must use a new nonce")
+
+		message, err := c.Decrypt(ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, "token", string(message))
+	})
+
+	t.Run("case=keeps empty values empty", func(t *testing.T) {
+		ciphertext, err := c.Encrypt(nil)
+		require.NoError(t, err)
+		assert.Empty(t, ciphertext)
+
+		message, err := c.Decrypt("")
+		require.NoError(t, err)
+		assert.Empty(t, message)
+	})
+
+	t.Run("case=decrypts with rotated secrets", func(t *testing.T) {
+		*s = secrets{[]byte("secret-a")}
+		ciphertext, err := c.Encrypt([]byte("token"))
+		require.NoError(t, err)
+
+		*s = secrets{[]byte("secret-b"), []byte("secret-a")}
+		message, err := c.Decrypt(ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, "token", string(message))
+
+		*s = secrets{[]byte("secret-b")}
+		_, err = c.Decrypt(ciphertext)
+		require.Error(t, err)
+	})
+
+	t.Run("case=rejects invalid ciphertexts", func(t *testing.T) {
+		*s = secrets{[]byte("secret-a")}
+		ciphertext, err := c.Encrypt([]byte("token"))
+		require.NoError(t, err)
+
+		tampered := ciphertext[:len(ciphertext)-2] + "00"
+		if tampered == ciphertext {
+			tampered = ciphertext[:len(ciphertext)-2] + "ff"
+		}
+
+		for _, invalid := range []string{"not-hex", "00", tampered} {
+			_, err := c.Decrypt(invalid)
+			require.Error(t, err, invalid)
+		}
+	})
+}
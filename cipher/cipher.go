@@ -0,0 +1,15 @@
+package cipher
+
+// Cipher provides methods for encrypting and decrypting values which are stored at rest, such as the tokens of
+// upstream OpenID Connect providers.
+type Cipher interface {
+	// Encrypt encrypts the message and returns the hex encoded ciphertext. Empty messages result in an empty string.
+	Encrypt(message []byte) (string, error)
+
+	// Decrypt decrypts the hex encoded ciphertext returned by Encrypt. Empty ciphertexts result in an empty message.
+	Decrypt(ciphertext string) ([]byte, error)
+}
+
+type Provider interface {
+	Cipher() Cipher
+}
@@ -180,6 +180,16 @@ func sqa(cmd *cobra.Command, d driver.Driver) *metricsx.Service {
 func bgTasks(d driver.Driver, wg *sync.WaitGroup, cmd *cobra.Command, args []string) {
 	defer wg.Done()
 
+	if s := d.Registry().LDAPSynchronizer(); s.Enabled() {
+		go func() {
+			d.Logger().Println("LDAP synchronization worker started.")
+			if err := graceful.Graceful(s.Work, s.Shutdown); err != nil {
+				d.Logger().WithError(err).Fatalf("Failed to run LDAP synchronization worker.")
+			}
+			d.Logger().Println("LDAP synchronization worker was shutdown gracefully.")
+		}()
+	}
+
 	d.Logger().Println("Courier worker started.")
 	if err := graceful.Graceful(d.Registry().Courier().Work, d.Registry().Courier().Shutdown); err != nil {
 		d.Logger().WithError(err).Fatalf("Failed to run courier worker.")
@@ -0,0 +1,51 @@
+package hibp
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ory/x/cmdx"
+
+	"github.com/zzpu/ums/selfservice/strategy/password"
+)
+
+// indexCmd represents the index command
+var indexCmd = &cobra.Command{
+	Use:   "index <path/to/dataset> <path/to/index>",
+	Short: "Build a compact index of a haveibeenpwned dataset",
+	Long: `Builds a compact, binary-searchable index of the haveibeenpwned SHA-1 dataset. The dataset is either a
+directory containing one <PREFIX>.txt file per range, or a single file with one <HASH>:<COUNT> row per
+line ordered by hash. Both can be downloaded with the PwnedPasswordsDownloader
+(https://github.com/HaveIBeenPwned/PwnedPasswordsDownloader).
+
+The index takes 24 bytes per hash. To check passwords offline, point the password method to it:
+
+	selfservice:
+	  strategies:
+	    password:
+	      config:
+	        haveibeenpwned_dataset: /path/to/index
+
+Example:
+	$ kratos hibp index ./pwnedpasswords ./hibp.idx
+`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		f, err := os.Create(args[1])
+		cmdx.Must(err, `Unable to create index file "%s": %s`, args[1], err)
+
+		count, err := password.BuildHaveIBeenPwnedIndex(f, args[0])
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(args[1])
+			cmdx.Must(err, `Unable to index dataset "%s": %s`, args[0], err)
+		}
+
+		err = f.Close()
+		cmdx.Must(err, `Unable to write index file "%s": %s`, args[1], err)
+
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Indexed %d password hashes into %s.\n", count, args[1])
+	},
+}
@@ -0,0 +1,17 @@
+package hibp
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// hibpCmd represents the hibp command
+var hibpCmd = &cobra.Command{
+	Use:   "hibp",
+	Short: "Helpers for checking passwords against a local haveibeenpwned dataset",
+}
+
+func RegisterCommandRecursive(parent *cobra.Command) {
+	parent.AddCommand(hibpCmd)
+
+	hibpCmd.AddCommand(indexCmd)
+}
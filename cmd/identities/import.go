@@ -26,7 +26,16 @@ var importCmd = &cobra.Command{
 
 Files can contain only a single or an array of identities. The validity of files can be tested beforehand using "... identities validate".
 
-WARNING: Importing credentials is not yet supported.`,
+Credentials can be imported alongside the identity. Passwords can either be set in cleartext, in which case they are hashed on import, or as a hash (argon2id, bcrypt, pbkdf2, scrypt or salted SHA). Identities can also be linked to OpenID Connect providers:
+
+	{
+	  "schema_id": "default",
+	  "traits": {"email": "foo@bar.com"},
+	  "credentials": {
+	    "password": {"hashed_password": "$2a$10$..."},
+	    "oidc": {"providers": [{"provider": "github", "subject": "12345"}]}
+	  }
+	}`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		c := cliclient.NewClient(cmd)
 
@@ -15,6 +15,7 @@ import (
 
 	"github.com/ory/x/pointerx"
 	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
 	"github.com/zzpu/ums/internal/clihelpers"
 	"github.com/zzpu/ums/internal/httpclient/models"
 )
@@ -120,6 +121,45 @@ func TestImportCmd(t *testing.T) {
 		assert.NoError(t, err)
 	})
 
+	t.Run("case=imports an identity with credentials", func(t *testing.T) {
+		i := models.CreateIdentity{
+			SchemaID: pointerx.String(configuration.DefaultIdentityTraitsSchemaID),
+			Traits:   map[string]interface{}{},
+			Credentials: &models.ImportCredentials{
+				Oidc: &models.ImportCredentialsOIDC{
+					Providers: []*models.ImportCredentialsOIDCProvider{{Provider: pointerx.String("github"), Subject: pointerx.String("import-cmd")}},
+				},
+			},
+		}
+		ij, err := json.Marshal(i)
+		require.NoError(t, err)
+
+		stdOut, stdErr, err := exec(importCmd, bytes.NewBuffer(ij))
+		require.NoError(t, err, stdOut, stdErr)
+
+		id, err := uuid.FromString(gjson.Get(stdOut, "id").String())
+		require.NoError(t, err)
+		actual, _, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeOIDC, "github:import-cmd")
+		require.NoError(t, err)
+		assert.Equal(t, id, actual.ID)
+	})
+
+	t.Run("case=fails to import a password without identifiers", func(t *testing.T) {
+		i := models.CreateIdentity{
+			SchemaID: pointerx.String(configuration.DefaultIdentityTraitsSchemaID),
+			Traits:   map[string]interface{}{},
+			Credentials: &models.ImportCredentials{
+				Password: &models.ImportCredentialsPassword{Password: "123456"},
+			},
+		}
+		ij, err := json.Marshal(i)
+		require.NoError(t, err)
+
+		stdOut, stdErr, err := exec(importCmd, bytes.NewBuffer(ij))
+		assert.True(t, errors.Is(err, clihelpers.NoPrintButFailError))
+		assert.Contains(t, stdErr, "STD_IN[0]: [POST /identities][400] createIdentityBadRequest", stdOut)
+	})
+
 	t.Run("case=fails to import invalid identity", func(t *testing.T) {
 		// validation is further tested with the validate command
 		stdOut, stdErr, err := exec(importCmd, bytes.NewBufferString("{}"))
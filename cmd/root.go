@@ -8,6 +8,7 @@ import (
 	"github.com/zzpu/ums/cmd/remote"
 
 	"github.com/ory/x/cmdx"
+	"github.com/zzpu/ums/cmd/hibp"
 	"github.com/zzpu/ums/cmd/identities"
 	"github.com/zzpu/ums/cmd/jsonnet"
 	"github.com/zzpu/ums/cmd/migrate"
@@ -39,6 +40,7 @@ func init() {
 	viperx.RegisterConfigFlag(rootCmd, "kratos")
 
 	identities.RegisterCommandRecursive(rootCmd)
+	hibp.RegisterCommandRecursive(rootCmd)
 	jsonnet.RegisterCommandRecursive(rootCmd)
 	serve.RegisterCommandRecursive(rootCmd)
 	migrate.RegisterCommandRecursive(rootCmd)
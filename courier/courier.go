@@ -25,9 +25,10 @@ type (
 		x.LoggingProvider
 	}
 	Courier struct {
-		Dialer *gomail.Dialer
-		d      smtpDependencies
-		c      configuration.Provider
+		Dialer    *gomail.Dialer
+		SMSSender SMSSender
+		d         smtpDependencies
+		c         configuration.Provider
 		// graceful shutdown handling
 		ctx      context.Context
 		shutdown context.CancelFunc
@@ -53,10 +54,11 @@ func NewSMTP(d smtpDependencies, c configuration.Provider) *Courier {
 	}
 
 	return &Courier{
-		d:        d,
-		c:        c,
-		ctx:      ctx,
-		shutdown: cancel,
+		d:         d,
+		c:         c,
+		ctx:       ctx,
+		shutdown:  cancel,
+		SMSSender: NewHTTPSMSSender(c),
 		Dialer: &gomail.Dialer{
 			/* #nosec we need to support SMTP servers without TLS */
 			TLSConfig:    tlsConfig,
@@ -100,6 +102,29 @@ func (m *Courier) QueueEmail(ctx context.Context, t EmailTemplate) (uuid.UUID, e
 	return message.ID, nil
 }
 
+func (m *Courier) QueueSMS(ctx context.Context, t SMSTemplate) (uuid.UUID, error) {
+	body, err := t.SMSBody()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	recipient, err := t.SMSRecipient()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	message := &Message{
+		Status:    MessageStatusQueued,
+		Type:      MessageTypeSMS,
+		Body:      body,
+		Recipient: recipient,
+	}
+	if err := m.d.CourierPersister().AddMessage(ctx, message); err != nil {
+		return uuid.Nil, err
+	}
+	return message.ID, nil
+}
+
 func (m *Courier) Work() error {
 	errChan := make(chan error)
 	defer close(errChan)
@@ -125,10 +150,6 @@ func (m *Courier) Shutdown(ctx context.Context) error {
 func (m *Courier) watchMessages(ctx context.Context, errChan chan error) {
 	for {
 		if err := backoff.Retry(func() error {
-			if len(m.Dialer.Host) == 0 {
-				return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Courier tried to deliver an email but courier.smtp_url is not set!"))
-			}
-
 			messages, err := m.d.CourierPersister().NextMessages(ctx, 10)
 			if err != nil {
 				if errors.Is(err, ErrQueueEmpty) {
@@ -141,6 +162,10 @@ func (m *Courier) watchMessages(ctx context.Context, errChan chan error) {
 
 				switch msg.Type {
 				case MessageTypeEmail:
+					if len(m.Dialer.Host) == 0 {
+						return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Courier tried to deliver an email but courier.smtp_url is not set!"))
+					}
+
 					from := m.c.CourierSMTPFrom()
 					gm := gomail.NewMessage()
 					gm.SetHeader("From", from)
@@ -173,6 +198,27 @@ func (m *Courier) watchMessages(ctx context.Context, errChan chan error) {
 						WithField("message_type", msg.Type).
 						WithField("message_subject", msg.Subject).
 						Debug("Courier sent out message.")
+				case MessageTypeSMS:
+					if err := m.SMSSender.SendSMS(ctx, &msg); err != nil {
+						m.d.Logger().
+							WithError(err).
+							WithField("message_id", msg.ID).
+							Error("Unable to send text message using the SMS gateway.")
+						continue
+					}
+
+					if err := m.d.CourierPersister().SetMessageStatus(ctx, msg.ID, MessageStatusSent); err != nil {
+						m.d.Logger().
+							WithError(err).
+							WithField("message_id", msg.ID).
+							Error(`Unable to set the message status to "sent".`)
+						return err
+					}
+
+					m.d.Logger().
+						WithField("message_id", msg.ID).
+						WithField("message_type", msg.Type).
+						Debug("Courier sent out message.")
 				default:
 					return errors.Errorf("received unexpected message type: %d", msg.Type)
 				}
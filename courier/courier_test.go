@@ -2,10 +2,13 @@ package courier_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -166,3 +169,67 @@ func TestSMTP(t *testing.T) {
 		}
 	})
 }
+
+func TestSMS(t *testing.T) {
+	type payload struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+		Body string `json:"body"`
+	}
+
+	received := make(chan payload, 10)
+	var failures int32 = 1
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer gateway-token", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		// Reject the first request to make sure the courier retries delivery.
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var p payload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		received <- p
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(gateway.Close)
+
+	conf, reg := internal.NewFastRegistryWithMocks(t)
+	viper.Set(configuration.ViperKeyCourierSMSRequestURL, gateway.URL+"/sms")
+	viper.Set(configuration.ViperKeyCourierSMSFrom, "+8610000000000")
+	viper.Set(configuration.ViperKeyCourierSMSHeaders, map[string]string{"Authorization": "Bearer gateway-token"})
+	c := reg.Courier()
+
+	go func() {
+		require.NoError(t, c.Work())
+	}()
+
+	for k := 1; k <= 2; k++ {
+		id, err := c.QueueSMS(context.Background(), templates.NewTestStub(conf, &templates.TestStubModel{
+			To:   fmt.Sprintf("+861380013800%d", k),
+			Body: fmt.Sprintf("test-body-%d", k),
+		}))
+		require.NoError(t, err)
+		require.NotEqual(t, uuid.Nil, id)
+	}
+
+	var actual []payload
+	for len(actual) < 2 {
+		select {
+		case p := <-received:
+			actual = append(actual, p)
+		case <-time.After(time.Second * 15):
+			t.Fatalf("expected the gateway to receive 2 text messages but got: %+v", actual)
+		}
+	}
+
+	for k := 1; k <= 2; k++ {
+		assert.Contains(t, actual, payload{
+			From: "+8610000000000",
+			To:   fmt.Sprintf("+861380013800%d", k),
+			Body: fmt.Sprintf("stub sms body test-body-%d", k),
+		})
+	}
+}
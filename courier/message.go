@@ -17,6 +17,7 @@ type MessageType int
 
 const (
 	MessageTypeEmail MessageType = iota + 1
+	MessageTypeSMS
 )
 
 type Message struct {
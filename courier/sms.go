@@ -0,0 +1,80 @@
+package courier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/zzpu/ums/driver/configuration"
+)
+
+type (
+	// SMSSender delivers text messages queued by the courier.
+	SMSSender interface {
+		SendSMS(ctx context.Context, msg *Message) error
+	}
+
+	// HTTPSMSSender delivers text messages by sending them as JSON to an HTTP SMS gateway.
+	HTTPSMSSender struct {
+		c      configuration.Provider
+		client *http.Client
+	}
+
+	httpSMSPayload struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+		Body string `json:"body"`
+	}
+)
+
+func NewHTTPSMSSender(c configuration.Provider) *HTTPSMSSender {
+	return &HTTPSMSSender{c: c, client: &http.Client{Timeout: time.Second * 10}}
+}
+
+func (s *HTTPSMSSender) SendSMS(ctx context.Context, msg *Message) error {
+	u := s.c.CourierSMSRequestURL()
+	if u == nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Courier tried to deliver a text message but courier.sms.request_url is not set!"))
+	}
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(&httpSMSPayload{
+		From: s.c.CourierSMSFrom(),
+		To:   msg.Recipient,
+		Body: msg.Body,
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	req, err := http.NewRequest("POST", u.String(), &b)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+
+	for k, v := range s.c.CourierSMSHeaders() {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.Errorf("SMS gateway responded with unexpected status code %d", res.StatusCode)
+	}
+
+	return nil
+}
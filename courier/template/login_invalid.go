@@ -0,0 +1,33 @@
+package template
+
+import (
+	"path/filepath"
+
+	"github.com/zzpu/ums/driver/configuration"
+)
+
+type (
+	LoginInvalid struct {
+		c configuration.Provider
+		m *LoginInvalidModel
+	}
+	LoginInvalidModel struct {
+		To string
+	}
+)
+
+func NewLoginInvalid(c configuration.Provider, m *LoginInvalidModel) *LoginInvalid {
+	return &LoginInvalid{c: c, m: m}
+}
+
+func (t *LoginInvalid) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *LoginInvalid) EmailSubject() (string, error) {
+	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "login/invalid/email.subject.gotmpl"), t.m)
+}
+
+func (t *LoginInvalid) EmailBody() (string, error) {
+	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "login/invalid/email.body.gotmpl"), t.m)
+}
@@ -0,0 +1,34 @@
+package template
+
+import (
+	"path/filepath"
+
+	"github.com/zzpu/ums/driver/configuration"
+)
+
+type (
+	LoginValid struct {
+		c configuration.Provider
+		m *LoginValidModel
+	}
+	LoginValidModel struct {
+		To       string
+		LoginURL string
+	}
+)
+
+func NewLoginValid(c configuration.Provider, m *LoginValidModel) *LoginValid {
+	return &LoginValid{c: c, m: m}
+}
+
+func (t *LoginValid) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *LoginValid) EmailSubject() (string, error) {
+	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "login/valid/email.subject.gotmpl"), t.m)
+}
+
+func (t *LoginValid) EmailBody() (string, error) {
+	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "login/valid/email.body.gotmpl"), t.m)
+}
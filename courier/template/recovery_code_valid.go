@@ -0,0 +1,42 @@
+package template
+
+import (
+	"path/filepath"
+
+	"github.com/zzpu/ums/driver/configuration"
+)
+
+type (
+	RecoveryCodeValid struct {
+		c configuration.Provider
+		m *RecoveryCodeValidModel
+	}
+	RecoveryCodeValidModel struct {
+		To           string
+		RecoveryCode string
+	}
+)
+
+func NewRecoveryCodeValid(c configuration.Provider, m *RecoveryCodeValidModel) *RecoveryCodeValid {
+	return &RecoveryCodeValid{c: c, m: m}
+}
+
+func (t *RecoveryCodeValid) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *RecoveryCodeValid) EmailSubject() (string, error) {
+	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "recovery_code/valid/email.subject.gotmpl"), t.m)
+}
+
+func (t *RecoveryCodeValid) EmailBody() (string, error) {
+	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "recovery_code/valid/email.body.gotmpl"), t.m)
+}
+
+func (t *RecoveryCodeValid) SMSRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *RecoveryCodeValid) SMSBody() (string, error) {
+	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "recovery_code/valid/sms.body.gotmpl"), t.m)
+}
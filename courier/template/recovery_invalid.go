@@ -31,3 +31,11 @@ func (t *RecoveryInvalid) EmailSubject() (string, error) {
 func (t *RecoveryInvalid) EmailBody() (string, error) {
 	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "recovery/invalid/email.body.gotmpl"), t.m)
 }
+
+func (t *RecoveryInvalid) SMSRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *RecoveryInvalid) SMSBody() (string, error) {
+	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "recovery/invalid/sms.body.gotmpl"), t.m)
+}
@@ -32,3 +32,11 @@ func (t *TestStub) EmailSubject() (string, error) {
 func (t *TestStub) EmailBody() (string, error) {
 	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "test_stub/email.body.gotmpl"), t.m)
 }
+
+func (t *TestStub) SMSRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *TestStub) SMSBody() (string, error) {
+	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "test_stub/sms.body.gotmpl"), t.m)
+}
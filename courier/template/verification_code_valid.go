@@ -0,0 +1,42 @@
+package template
+
+import (
+	"path/filepath"
+
+	"github.com/zzpu/ums/driver/configuration"
+)
+
+type (
+	VerificationCodeValid struct {
+		c configuration.Provider
+		m *VerificationCodeValidModel
+	}
+	VerificationCodeValidModel struct {
+		To               string
+		VerificationCode string
+	}
+)
+
+func NewVerificationCodeValid(c configuration.Provider, m *VerificationCodeValidModel) *VerificationCodeValid {
+	return &VerificationCodeValid{c: c, m: m}
+}
+
+func (t *VerificationCodeValid) EmailRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *VerificationCodeValid) EmailSubject() (string, error) {
+	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "verification_code/valid/email.subject.gotmpl"), t.m)
+}
+
+func (t *VerificationCodeValid) EmailBody() (string, error) {
+	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "verification_code/valid/email.body.gotmpl"), t.m)
+}
+
+func (t *VerificationCodeValid) SMSRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *VerificationCodeValid) SMSBody() (string, error) {
+	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "verification_code/valid/sms.body.gotmpl"), t.m)
+}
@@ -31,3 +31,11 @@ func (t *VerificationInvalid) EmailSubject() (string, error) {
 func (t *VerificationInvalid) EmailBody() (string, error) {
 	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "verification/invalid/email.body.gotmpl"), t.m)
 }
+
+func (t *VerificationInvalid) SMSRecipient() (string, error) {
+	return t.m.To, nil
+}
+
+func (t *VerificationInvalid) SMSBody() (string, error) {
+	return loadTextTemplate(filepath.Join(t.c.CourierTemplatesRoot(), "verification/invalid/sms.body.gotmpl"), t.m)
+}
@@ -5,3 +5,8 @@ type EmailTemplate interface {
 	EmailBody() (string, error)
 	EmailRecipient() (string, error)
 }
+
+type SMSTemplate interface {
+	SMSBody() (string, error)
+	SMSRecipient() (string, error)
+}
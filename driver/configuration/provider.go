@@ -19,6 +19,17 @@ type HasherArgon2Config struct {
 	KeyLength   uint32
 }
 
+type HasherBcryptConfig struct {
+	Cost uint32
+}
+
+// PepperSecret is a secret which is mixed into passwords before they are hashed. The ID is stored alongside
+// the hash so that the secret which was used can be identified once peppers are rotated.
+type PepperSecret struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
 type SelfServiceHook struct {
 	Name   string          `json:"hook"`
 	Config json.RawMessage `json:"config"`
@@ -64,6 +75,7 @@ type Provider interface {
 
 	SecretsDefault() [][]byte
 	SecretsSession() [][]byte
+	SecretsPepper() []PepperSecret
 	SessionLifespan() time.Duration
 	SessionPersistentCookie() bool
 	SessionSameSiteMode() http.SameSite
@@ -106,11 +118,16 @@ type Provider interface {
 	CourierSMTPFrom() string
 	CourierSMTPURL() *url.URL
 	CourierTemplatesRoot() string
+	CourierSMSRequestURL() *url.URL
+	CourierSMSFrom() string
+	CourierSMSHeaders() map[string]string
 
 	DefaultIdentityTraitsSchemaURL() *url.URL
 	IdentityTraitsSchemas() SchemaConfigs
 
+	HasherAlgorithm() string
 	HasherArgon2() *HasherArgon2Config
+	HasherBcrypt() *HasherBcryptConfig
 
 	TracingServiceName() string
 	TracingProvider() string
@@ -44,9 +44,13 @@ const (
 	ViperKeyCourierSMTPURL       = "courier.smtp.connection_uri"
 	ViperKeyCourierTemplatesPath = "courier.template_override_path"
 	ViperKeyCourierSMTPFrom      = "courier.smtp.from_address"
+	ViperKeyCourierSMSRequestURL = "courier.sms.request_url"
+	ViperKeyCourierSMSFrom       = "courier.sms.from"
+	ViperKeyCourierSMSHeaders    = "courier.sms.headers"
 
 	ViperKeySecretsDefault = "secrets.default"
 	ViperKeySecretsCookie  = "secrets.cookie"
+	ViperKeySecretsPepper  = "secrets.pepper"
 
 	ViperKeyPublicBaseURL = "serve.public.base_url"
 	ViperKeyPublicPort    = "serve.public.port"
@@ -98,11 +102,13 @@ const (
 	ViperKeyDefaultIdentitySchemaURL = "identity.default_schema_url"
 	ViperKeyIdentitySchemas          = "identity.schemas"
 
+	ViperKeyHasherAlgorithm               = "hashers.algorithm"
 	ViperKeyHasherArgon2ConfigMemory      = "hashers.argon2.memory"
 	ViperKeyHasherArgon2ConfigIterations  = "hashers.argon2.iterations"
 	ViperKeyHasherArgon2ConfigParallelism = "hashers.argon2.parallelism"
 	ViperKeyHasherArgon2ConfigSaltLength  = "hashers.argon2.salt_length"
 	ViperKeyHasherArgon2ConfigKeyLength   = "hashers.argon2.key_length"
+	ViperKeyHasherBcryptConfigCost        = "hashers.bcrypt.cost"
 
 	ViperKeyVersion = "version"
 )
@@ -123,6 +129,10 @@ func (p *ViperProvider) SessionPath() string {
 	return viperx.GetString(p.l, ViperKeySessionPath, "")
 }
 
+func (p *ViperProvider) HasherAlgorithm() string {
+	return viperx.GetString(p.l, ViperKeyHasherAlgorithm, "argon2")
+}
+
 func (p *ViperProvider) HasherArgon2() *HasherArgon2Config {
 	return &HasherArgon2Config{
 		Memory:      uint32(viperx.GetInt(p.l, ViperKeyHasherArgon2ConfigMemory, 4*1024*1024)),
@@ -133,6 +143,12 @@ func (p *ViperProvider) HasherArgon2() *HasherArgon2Config {
 	}
 }
 
+func (p *ViperProvider) HasherBcrypt() *HasherBcryptConfig {
+	return &HasherBcryptConfig{
+		Cost: uint32(viperx.GetInt(p.l, ViperKeyHasherBcryptConfigCost, 12)),
+	}
+}
+
 func (p *ViperProvider) listenOn(key string) string {
 	fb := 4433
 	if key == "admin" {
@@ -293,6 +309,25 @@ func (p *ViperProvider) SecretsDefault() [][]byte {
 	return result
 }
 
+func (p *ViperProvider) SecretsPepper() []PepperSecret {
+	raw := viper.Get(ViperKeySecretsPepper)
+	if raw == nil {
+		return nil
+	}
+
+	var b bytes.Buffer
+	var peppers []PepperSecret
+	if err := json.NewEncoder(&b).Encode(raw); err != nil {
+		p.l.WithError(err).Fatalf("Unable to encode values from %s.", ViperKeySecretsPepper)
+	}
+
+	if err := jsonx.NewStrictDecoder(&b).Decode(&peppers); err != nil {
+		p.l.WithError(err).Fatalf("Unable to decode values from %s.", ViperKeySecretsPepper)
+	}
+
+	return peppers
+}
+
 func (p *ViperProvider) SecretsSession() [][]byte {
 	secrets := viperx.GetStringSlice(p.l, ViperKeySecretsCookie, nil)
 	if len(secrets) == 0 {
@@ -433,6 +468,23 @@ func (p *ViperProvider) CourierTemplatesRoot() string {
 	return viperx.GetString(p.l, ViperKeyCourierTemplatesPath, "/courier/template/templates")
 }
 
+// CourierSMSRequestURL returns nil when no SMS gateway is configured.
+func (p *ViperProvider) CourierSMSRequestURL() *url.URL {
+	u, err := url.ParseRequestURI(viper.GetString(ViperKeyCourierSMSRequestURL))
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+func (p *ViperProvider) CourierSMSFrom() string {
+	return viperx.GetString(p.l, ViperKeyCourierSMSFrom, "")
+}
+
+func (p *ViperProvider) CourierSMSHeaders() map[string]string {
+	return viper.GetStringMapString(ViperKeyCourierSMSHeaders)
+}
+
 func mustParseURLFromViper(l *logrusx.Logger, key string) *url.URL {
 	u, err := url.ParseRequestURI(viper.GetString(key))
 	if err != nil {
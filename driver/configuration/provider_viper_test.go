@@ -245,6 +245,12 @@ func TestViperProvider(t *testing.T) {
 		t.Run("group=hashers", func(t *testing.T) {
 			assert.Equal(t, &configuration.HasherArgon2Config{Memory: 1048576, Iterations: 2, Parallelism: 4,
 				SaltLength: 16, KeyLength: 32}, p.HasherArgon2())
+			assert.Equal(t, "argon2", p.HasherAlgorithm())
+			assert.Equal(t, &configuration.HasherBcryptConfig{Cost: 12}, p.HasherBcrypt())
+			assert.Equal(t, []configuration.PepperSecret{
+				{ID: "pepper-2", Secret: "pepper-secret-7f8a9b77-2-must-be-long"},
+				{ID: "pepper-1", Secret: "pepper-secret-7f8a9b77-1-must-be-long"},
+			}, p.SecretsPepper())
 		})
 	})
 }
@@ -9,6 +9,8 @@ import (
 
 	"github.com/ory/x/logrusx"
 
+	"github.com/zzpu/ums/apikey"
+	"github.com/zzpu/ums/cipher"
 	"github.com/zzpu/ums/continuity"
 	"github.com/zzpu/ums/courier"
 	"github.com/zzpu/ums/hash"
@@ -16,7 +18,11 @@ import (
 	"github.com/zzpu/ums/selfservice/flow/recovery"
 	"github.com/zzpu/ums/selfservice/flow/settings"
 	"github.com/zzpu/ums/selfservice/flow/verification"
+	"github.com/zzpu/ums/selfservice/mfa/questions"
+	"github.com/zzpu/ums/selfservice/strategy/code"
+	"github.com/zzpu/ums/selfservice/strategy/ldap"
 	"github.com/zzpu/ums/selfservice/strategy/link"
+	"github.com/zzpu/ums/selfservice/strategy/oidc"
 
 	"github.com/ory/x/healthx"
 
@@ -79,6 +85,11 @@ type Registry interface {
 
 	hash.HashProvider
 
+	cipher.Provider
+
+	apikey.HandlerProvider
+	apikey.ManagementProvider
+
 	identity.HandlerProvider
 	identity.ValidationProvider
 	identity.PoolProvider
@@ -89,6 +100,7 @@ type Registry interface {
 	schema.HandlerProvider
 
 	password2.ValidationProvider
+	password2.LoginFailurePersistenceProvider
 
 	session.HandlerProvider
 	session.ManagementProvider
@@ -123,12 +135,24 @@ type Registry interface {
 	link.SenderProvider
 	link.VerificationTokenPersistenceProvider
 	link.RecoveryTokenPersistenceProvider
+	link.LoginTokenPersistenceProvider
+
+	code.SenderProvider
+	code.RecoveryCodePersistenceProvider
+	code.VerificationCodePersistenceProvider
 
 	recovery.FlowPersistenceProvider
 	recovery.ErrorHandlerProvider
 	recovery.HandlerProvider
 	recovery.StrategyProvider
 
+	questions.ManagementProvider
+	questions.AttemptPersistenceProvider
+
+	ldap.SynchronizerProvider
+
+	oidc.ProviderPersistenceProvider
+
 	x.CSRFTokenGeneratorProvider
 }
 
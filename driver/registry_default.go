@@ -10,6 +10,8 @@ import (
 
 	"github.com/gobuffalo/pop/v5"
 
+	"github.com/zzpu/ums/apikey"
+	"github.com/zzpu/ums/cipher"
 	"github.com/zzpu/ums/continuity"
 	"github.com/zzpu/ums/hash"
 	"github.com/zzpu/ums/schema"
@@ -17,8 +19,14 @@ import (
 	"github.com/zzpu/ums/selfservice/flow/settings"
 	"github.com/zzpu/ums/selfservice/flow/verification"
 	"github.com/zzpu/ums/selfservice/hook"
+	"github.com/zzpu/ums/selfservice/mfa/questions"
+	"github.com/zzpu/ums/selfservice/strategy/backupcodes"
+	"github.com/zzpu/ums/selfservice/strategy/code"
+	"github.com/zzpu/ums/selfservice/strategy/ldap"
 	"github.com/zzpu/ums/selfservice/strategy/link"
 	"github.com/zzpu/ums/selfservice/strategy/profile"
+	"github.com/zzpu/ums/selfservice/strategy/totp"
+	"github.com/zzpu/ums/selfservice/strategy/webauthn"
 	"github.com/zzpu/ums/x"
 
 	"github.com/cenkalti/backoff"
@@ -40,6 +48,7 @@ import (
 	"github.com/zzpu/ums/selfservice/flow/logout"
 	"github.com/zzpu/ums/selfservice/flow/registration"
 	"github.com/zzpu/ums/selfservice/strategy/oidc"
+	"github.com/zzpu/ums/selfservice/strategy/saml"
 
 	"github.com/ory/herodot"
 
@@ -79,6 +88,9 @@ type RegistryDefault struct {
 	hookSessionIssuer    *hook.SessionIssuer
 	hookSessionDestroyer *hook.SessionDestroyer
 
+	apiKeyHandler *apikey.Handler
+	apiKeyManager *apikey.Manager
+
 	identityHandler   *identity.Handler
 	identityValidator *identity.Validator
 	identityManager   *identity.Manager
@@ -95,6 +107,8 @@ type RegistryDefault struct {
 	passwordHasher    hash.Hasher
 	passwordValidator password2.Validator
 
+	crypter cipher.Cipher
+
 	errorHandler *errorx.Handler
 	errorManager *errorx.Manager
 
@@ -116,12 +130,17 @@ type RegistryDefault struct {
 	selfserviceVerifyHandler      *verification.Handler
 
 	selfserviceLinkSender *link.Sender
+	selfserviceCodeSender *code.Sender
 
 	selfserviceRecoveryErrorHandler *recovery.ErrorHandler
 	selfserviceRecoveryHandler      *recovery.Handler
 
 	selfserviceLogoutHandler *logout.Handler
 
+	securityQuestionsManager *questions.Manager
+
+	ldapSynchronizer *ldap.Synchronizer
+
 	selfserviceStrategies              []interface{}
 	loginStrategies                    []login.Strategy
 	activeCredentialsCounterStrategies []identity.ActiveCredentialsCounter
@@ -176,9 +195,19 @@ func (m *RegistryDefault) RegisterAdminRoutes(router *x.RouterAdmin) {
 	m.SchemaHandler().RegisterAdminRoutes(router)
 	m.SettingsHandler().RegisterAdminRoutes(router)
 	m.IdentityHandler().RegisterAdminRoutes(router)
+	m.APIKeyHandler().RegisterAdminRoutes(router)
 	m.SessionHandler().RegisterAdminRoutes(router)
 	m.SelfServiceErrorHandler().RegisterAdminRoutes(router)
 
+	for _, s := range m.selfServiceStrategies() {
+		switch strategy := s.(type) {
+		case *oidc.Strategy:
+			strategy.RegisterAdminRoutes(router)
+		case *password2.Strategy:
+			strategy.RegisterAdminRoutes(router)
+		}
+	}
+
 	if m.c.SelfServiceFlowRecoveryEnabled() {
 		m.RecoveryHandler().RegisterAdminRoutes(router)
 		m.RecoveryStrategies().RegisterAdminRoutes(router)
@@ -268,6 +297,13 @@ func (m *RegistryDefault) selfServiceStrategies() []interface{} {
 			oidc.NewStrategy(m, m.c),
 			profile.NewStrategy(m, m.c),
 			link.NewStrategy(m, m.c),
+			code.NewStrategy(m, m.c),
+			totp.NewStrategy(m, m.c),
+			webauthn.NewStrategy(m, m.c),
+			backupcodes.NewStrategy(m, m.c),
+			questions.NewStrategy(m, m.c),
+			ldap.NewStrategy(m, m.c),
+			saml.NewStrategy(m, m.c),
 		}
 	}
 
@@ -362,6 +398,20 @@ func (m *RegistryDefault) IdentityHandler() *identity.Handler {
 	return m.identityHandler
 }
 
+func (m *RegistryDefault) APIKeyHandler() *apikey.Handler {
+	if m.apiKeyHandler == nil {
+		m.apiKeyHandler = apikey.NewHandler(m.c, m)
+	}
+	return m.apiKeyHandler
+}
+
+func (m *RegistryDefault) APIKeyManager() *apikey.Manager {
+	if m.apiKeyManager == nil {
+		m.apiKeyManager = apikey.NewManager(m, m.c)
+	}
+	return m.apiKeyManager
+}
+
 func (m *RegistryDefault) SchemaHandler() *schema.Handler {
 	if m.schemaHandler == nil {
 		m.schemaHandler = schema.NewHandler(m)
@@ -371,21 +421,36 @@ func (m *RegistryDefault) SchemaHandler() *schema.Handler {
 
 func (m *RegistryDefault) SessionHandler() *session.Handler {
 	if m.sessionHandler == nil {
-		m.sessionHandler = session.NewHandler(m)
+		m.sessionHandler = session.NewHandler(m, m.c)
 	}
 	return m.sessionHandler
 }
 
 func (m *RegistryDefault) Hasher() hash.Hasher {
 	if m.passwordHasher == nil {
-		m.passwordHasher = hash.NewHasherArgon2(m.c)
+		m.passwordHasher = hash.NewHasherPeppered(hash.NewHasherComposite(m.c), m.c)
 	}
 	return m.passwordHasher
 }
 
+func (m *RegistryDefault) Cipher() cipher.Cipher {
+	if m.crypter == nil {
+		m.crypter = cipher.NewCryptAES(m.c)
+	}
+	return m.crypter
+}
+
 func (m *RegistryDefault) PasswordValidator() password2.Validator {
 	if m.passwordValidator == nil {
-		m.passwordValidator = password2.NewDefaultPasswordValidatorStrategy()
+		c, err := password2.NewValidatorConfiguration(m.c.SelfServiceStrategy(string(identity.CredentialsTypePassword)).Config)
+		if err != nil {
+			m.Logger().WithError(err).Fatalf("Unable to initialize the password validator.")
+		}
+
+		m.passwordValidator, err = password2.NewDefaultPasswordValidatorStrategyFromConfig(c)
+		if err != nil {
+			m.Logger().WithError(err).Fatalf("Unable to initialize the password validator.")
+		}
 	}
 	return m.passwordValidator
 }
@@ -580,6 +645,30 @@ func (m *RegistryDefault) VerificationTokenPersister() link.VerificationTokenPer
 	return m.Persister()
 }
 
+func (m *RegistryDefault) LoginTokenPersister() link.LoginTokenPersister {
+	return m.Persister()
+}
+
+func (m *RegistryDefault) RecoveryCodePersister() code.RecoveryCodePersister {
+	return m.Persister()
+}
+
+func (m *RegistryDefault) VerificationCodePersister() code.VerificationCodePersister {
+	return m.Persister()
+}
+
+func (m *RegistryDefault) RecoverySecurityAttemptPersister() questions.AttemptPersister {
+	return m.Persister()
+}
+
+func (m *RegistryDefault) OIDCProviderPersister() oidc.ProviderPersister {
+	return m.Persister()
+}
+
+func (m *RegistryDefault) LoginFailurePersister() password2.LoginFailurePersister {
+	return m.Persister()
+}
+
 func (m *RegistryDefault) Persister() persistence.Persister {
 	return m.persister
 }
@@ -606,6 +695,24 @@ func (m *RegistryDefault) IdentityManager() *identity.Manager {
 	return m.identityManager
 }
 
+func (m *RegistryDefault) SecurityQuestionsManager() *questions.Manager {
+	if m.securityQuestionsManager == nil {
+		m.securityQuestionsManager = questions.NewManager(m, m.c)
+	}
+	return m.securityQuestionsManager
+}
+
+func (m *RegistryDefault) LDAPSynchronizer() *ldap.Synchronizer {
+	if m.ldapSynchronizer == nil {
+		for _, s := range m.selfServiceStrategies() {
+			if strategy, ok := s.(*ldap.Strategy); ok {
+				m.ldapSynchronizer = ldap.NewSynchronizer(strategy)
+			}
+		}
+	}
+	return m.ldapSynchronizer
+}
+
 func (m *RegistryDefault) PrometheusManager() *prometheus.MetricsManager {
 	if m.pmm == nil {
 		m.pmm = prometheus.NewMetricsManager(m.buildVersion, m.buildHash, m.buildDate)
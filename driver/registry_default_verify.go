@@ -3,6 +3,7 @@ package driver
 import (
 	"github.com/zzpu/ums/identity"
 	"github.com/zzpu/ums/selfservice/flow/verification"
+	"github.com/zzpu/ums/selfservice/strategy/code"
 	"github.com/zzpu/ums/selfservice/strategy/link"
 )
 
@@ -41,3 +42,11 @@ func (m *RegistryDefault) LinkSender() *link.Sender {
 
 	return m.selfserviceLinkSender
 }
+
+func (m *RegistryDefault) CodeSender() *code.Sender {
+	if m.selfserviceCodeSender == nil {
+		m.selfserviceCodeSender = code.NewSender(m, m.c)
+	}
+
+	return m.selfserviceCodeSender
+}
@@ -7,6 +7,10 @@ type Hasher interface {
 
 	// Generate returns a hash derived from the password or an error if the hash method failed.
 	Generate(password []byte) ([]byte, error)
+
+	// NeedsRehash returns true if the hash was not generated by this hasher using its current parameters
+	// and should therefore be replaced by a freshly generated one.
+	NeedsRehash(hash []byte) bool
 }
 
 type HashProvider interface {
@@ -18,6 +18,7 @@ var (
 	ErrInvalidHash               = errors.New("the encoded hash is not in the correct format")
 	ErrIncompatibleVersion       = errors.New("incompatible version of argon2")
 	ErrMismatchedHashAndPassword = errors.New("passwords do not match")
+	ErrUnknownHashAlgorithm      = errors.New("the hash algorithm is not supported")
 )
 
 type Argon2 struct {
@@ -79,6 +80,25 @@ func (h *Argon2) Compare(password []byte, hash []byte) error {
 	return ErrMismatchedHashAndPassword
 }
 
+func (h *Argon2) NeedsRehash(hash []byte) bool {
+	if !isArgon2Hash(hash) {
+		return true
+	}
+
+	p, _, _, err := decodeHash(string(hash))
+	if err != nil {
+		return true
+	}
+
+	c := h.c.HasherArgon2()
+	return p.Memory != c.Memory || p.Iterations != c.Iterations || p.Parallelism != c.Parallelism ||
+		p.SaltLength != c.SaltLength || p.KeyLength != c.KeyLength
+}
+
+func isArgon2Hash(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$argon2id$"))
+}
+
 func decodeHash(encodedHash string) (p *configuration.HasherArgon2Config, salt, hash []byte, err error) {
 	parts := strings.Split(encodedHash, "$")
 	if len(parts) != 6 {
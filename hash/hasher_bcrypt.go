@@ -0,0 +1,73 @@
+package hash
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/zzpu/ums/driver/configuration"
+)
+
+// ErrBcryptPasswordLengthReached is returned when generating a hash of a password that is longer than
+// the 72 bytes bcrypt is able to process.
+var ErrBcryptPasswordLengthReached = errors.New("passwords are limited to a maximum length of 72 bytes")
+
+type Bcrypt struct {
+	c BcryptConfiguration
+}
+
+type BcryptConfiguration interface {
+	HasherBcrypt() *configuration.HasherBcryptConfig
+}
+
+func NewHasherBcrypt(c BcryptConfiguration) *Bcrypt {
+	return &Bcrypt{c: c}
+}
+
+func (h *Bcrypt) Generate(password []byte) ([]byte, error) {
+	// bcrypt silently ignores everything after the first 72 bytes of the password.
+	if len(password) > 72 {
+		return nil, errors.WithStack(ErrBcryptPasswordLengthReached)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword(password, int(h.c.HasherBcrypt().Cost))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return hash, nil
+}
+
+func (h *Bcrypt) Compare(password []byte, hash []byte) error {
+	if !isBcryptHash(hash) {
+		return ErrInvalidHash
+	}
+
+	if err := bcrypt.CompareHashAndPassword(hash, password); errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrMismatchedHashAndPassword
+	} else if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (h *Bcrypt) NeedsRehash(hash []byte) bool {
+	if !isBcryptHash(hash) {
+		return true
+	}
+
+	cost, err := bcrypt.Cost(hash)
+	if err != nil {
+		return true
+	}
+	return uint32(cost) != h.c.HasherBcrypt().Cost
+}
+
+func isBcryptHash(hash []byte) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if bytes.HasPrefix(hash, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
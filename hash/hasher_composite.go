@@ -0,0 +1,119 @@
+package hash
+
+import (
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Composite generates hashes using the preferred algorithm and compares passwords against hashes of every
+// supported algorithm. The algorithm of a hash is detected from its prefix.
+type Composite struct {
+	c CompositeConfiguration
+
+	argon2    *Argon2
+	bcrypt    *Bcrypt
+	pbkdf2    *PBKDF2
+	scrypt    *Scrypt
+	saltedSHA *SaltedSHA
+}
+
+type CompositeConfiguration interface {
+	HasherAlgorithm() string
+	Argon2Configuration
+	BcryptConfiguration
+}
+
+func NewHasherComposite(c CompositeConfiguration) *Composite {
+	return &Composite{
+		c:         c,
+		argon2:    NewHasherArgon2(c),
+		bcrypt:    NewHasherBcrypt(c),
+		pbkdf2:    NewHasherPBKDF2(),
+		scrypt:    NewHasherScrypt(),
+		saltedSHA: NewHasherSaltedSHA(),
+	}
+}
+
+func (h *Composite) Generate(password []byte) ([]byte, error) {
+	return h.preferred().Generate(password)
+}
+
+func (h *Composite) Compare(password []byte, hash []byte) error {
+	hasher, err := h.detect(hash)
+	if err != nil {
+		return err
+	}
+	return hasher.Compare(password, hash)
+}
+
+// NeedsRehash returns true if the hash was generated by an algorithm other than the preferred one or
+// if the parameters of the preferred algorithm have changed since.
+func (h *Composite) NeedsRehash(hash []byte) bool {
+	return h.preferred().NeedsRehash(hash)
+}
+
+func (h *Composite) preferred() Hasher {
+	if h.c.HasherAlgorithm() == "bcrypt" {
+		return h.bcrypt
+	}
+	return h.argon2
+}
+
+func (h *Composite) detect(hash []byte) (Hasher, error) {
+	switch {
+	case isArgon2Hash(hash):
+		return h.argon2, nil
+	case isBcryptHash(hash):
+		return h.bcrypt, nil
+	case isPBKDF2Hash(hash):
+		return h.pbkdf2, nil
+	case isScryptHash(hash):
+		return h.scrypt, nil
+	case isSaltedSHAHash(hash):
+		return h.saltedSHA, nil
+	}
+	return nil, errors.WithStack(ErrUnknownHashAlgorithm)
+}
+
+// IsSupported returns true if the hash is well-formed and uses one of the algorithms supported by the Composite
+// hasher. This allows checking imported hashes without the cost of comparing a password.
+func IsSupported(hash []byte) bool {
+	if _, inner, ok := decodePepperedHash(hash); ok {
+		hash = inner
+	}
+
+	switch {
+	case isArgon2Hash(hash):
+		_, _, _, err := decodeHash(string(hash))
+		return err == nil
+	case isBcryptHash(hash):
+		_, err := bcrypt.Cost(hash)
+		return err == nil
+	case isPBKDF2Hash(hash):
+		p, _, _, err := decodePBKDF2Hash(string(hash))
+		if err != nil {
+			return false
+		}
+		_, err = pbkdf2HashFunc(p.Algorithm)
+		return err == nil
+	case isScryptHash(hash):
+		_, _, _, err := decodeScryptHash(string(hash))
+		return err == nil
+	case isSaltedSHAHash(hash):
+		prefix, f, _ := saltedSHAFunc(hash)
+		decoded, err := base64.StdEncoding.DecodeString(string(hash[len(prefix):]))
+		return err == nil && len(decoded) > f().Size()
+	}
+	return false
+}
+
+// HasKnownAlgorithm returns true if the prefix of the hash names one of the algorithms supported by the Composite
+// hasher. Unlike IsSupported, it does not check whether the rest of the hash is well-formed.
+func HasKnownAlgorithm(hash []byte) bool {
+	if _, inner, ok := decodePepperedHash(hash); ok {
+		hash = inner
+	}
+	return isArgon2Hash(hash) || isBcryptHash(hash) || isPBKDF2Hash(hash) || isScryptHash(hash) || isSaltedSHAHash(hash)
+}
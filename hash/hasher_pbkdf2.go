@@ -0,0 +1,126 @@
+package hash
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// PBKDF2 compares and generates hashes in the format
+// `$pbkdf2-<sha256|sha512>$i=<iterations>,l=<key length>$<salt>$<hash>` where salt
+// and hash are base64 encoded without padding.
+type PBKDF2 struct {
+	Algorithm  string
+	Iterations uint32
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+func NewHasherPBKDF2() *PBKDF2 {
+	return &PBKDF2{Algorithm: "sha256", Iterations: 100000, SaltLength: 16, KeyLength: 32}
+}
+
+func (h *PBKDF2) Generate(password []byte) ([]byte, error) {
+	f, err := pbkdf2HashFunc(h.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	key := pbkdf2.Key(password, salt, int(h.Iterations), int(h.KeyLength), f)
+
+	var b bytes.Buffer
+	if _, err := fmt.Fprintf(
+		&b,
+		"$pbkdf2-%s$i=%d,l=%d$%s$%s",
+		h.Algorithm, h.Iterations, h.KeyLength,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return b.Bytes(), nil
+}
+
+func (h *PBKDF2) Compare(password []byte, hash []byte) error {
+	p, salt, key, err := decodePBKDF2Hash(string(hash))
+	if err != nil {
+		return err
+	}
+
+	f, err := pbkdf2HashFunc(p.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	otherKey := pbkdf2.Key(password, salt, int(p.Iterations), int(p.KeyLength), f)
+	if subtle.ConstantTimeCompare(key, otherKey) == 1 {
+		return nil
+	}
+	return ErrMismatchedHashAndPassword
+}
+
+func (h *PBKDF2) NeedsRehash(hash []byte) bool {
+	p, _, _, err := decodePBKDF2Hash(string(hash))
+	if err != nil {
+		return true
+	}
+
+	return *p != *h
+}
+
+func isPBKDF2Hash(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$pbkdf2-"))
+}
+
+func pbkdf2HashFunc(algorithm string) (func() hash.Hash, error) {
+	switch algorithm {
+	case "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	}
+	return nil, errors.WithStack(ErrUnknownHashAlgorithm)
+}
+
+func decodePBKDF2Hash(encodedHash string) (p *PBKDF2, salt, key []byte, err error) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 5 || !strings.HasPrefix(parts[1], "pbkdf2-") {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	p = &PBKDF2{Algorithm: strings.TrimPrefix(parts[1], "pbkdf2-")}
+	if _, err := fmt.Sscanf(parts[2], "i=%d,l=%d", &p.Iterations, &p.KeyLength); err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	p.SaltLength = uint32(len(salt))
+
+	key, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	if uint32(len(key)) != p.KeyLength {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	return p, salt, key, nil
+}
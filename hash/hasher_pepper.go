@@ -0,0 +1,102 @@
+package hash
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zzpu/ums/driver/configuration"
+)
+
+const pepperPrefix = "$pepper$"
+
+var ErrUnknownPepper = errors.New("the pepper used to hash the password is no longer configured")
+
+// Peppered mixes a server-side secret (the pepper) into every password before passing it to the
+// wrapped hasher. The ID of the pepper is stored in front of the hash, for example
+// `$pepper$<pepper id>$argon2id$v=19$...`, so that older peppers can still be used to compare
+// passwords once peppers are rotated.
+//
+// Hashes without a pepper are passed to the wrapped hasher as-is.
+type Peppered struct {
+	h Hasher
+	c PepperConfiguration
+}
+
+type PepperConfiguration interface {
+	SecretsPepper() []configuration.PepperSecret
+}
+
+func NewHasherPeppered(h Hasher, c PepperConfiguration) *Peppered {
+	return &Peppered{h: h, c: c}
+}
+
+func (h *Peppered) Generate(password []byte) ([]byte, error) {
+	peppers := h.c.SecretsPepper()
+	if len(peppers) == 0 {
+		return h.h.Generate(password)
+	}
+
+	hash, err := h.h.Generate(pepper(peppers[0], password))
+	if err != nil {
+		return nil, err
+	}
+
+	// The hash itself starts with `$` which separates it from the pepper ID.
+	if !bytes.HasPrefix(hash, []byte("$")) {
+		return nil, errors.WithStack(ErrInvalidHash)
+	}
+
+	return append([]byte(pepperPrefix+peppers[0].ID), hash...), nil
+}
+
+func (h *Peppered) Compare(password []byte, hash []byte) error {
+	id, inner, ok := decodePepperedHash(hash)
+	if !ok {
+		return h.h.Compare(password, hash)
+	}
+
+	for _, p := range h.c.SecretsPepper() {
+		if p.ID == id {
+			return h.h.Compare(pepper(p, password), inner)
+		}
+	}
+	return errors.WithStack(ErrUnknownPepper)
+}
+
+// NeedsRehash returns true if the hash was generated without a pepper or with a pepper other than the current one,
+// or if the wrapped hasher needs to rehash it.
+func (h *Peppered) NeedsRehash(hash []byte) bool {
+	peppers := h.c.SecretsPepper()
+	id, inner, ok := decodePepperedHash(hash)
+	if len(peppers) == 0 {
+		return ok || h.h.NeedsRehash(hash)
+	}
+
+	return !ok || id != peppers[0].ID || h.h.NeedsRehash(inner)
+}
+
+func pepper(p configuration.PepperSecret, password []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(p.Secret))
+	_, _ = mac.Write(password)
+
+	// The MAC is encoded because some algorithms, such as bcrypt, do not handle arbitrary bytes well.
+	return []byte(base64.RawStdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+func decodePepperedHash(hash []byte) (id string, inner []byte, ok bool) {
+	if !bytes.HasPrefix(hash, []byte(pepperPrefix)) {
+		return "", nil, false
+	}
+
+	parts := strings.SplitN(string(hash[len(pepperPrefix):]), "$", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 {
+		return "", nil, false
+	}
+
+	return parts[0], []byte("$" + parts[1]), true
+}
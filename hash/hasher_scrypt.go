@@ -0,0 +1,109 @@
+package hash
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Scrypt compares and generates hashes in the format
+// `$scrypt$ln=<cost>,r=<block size>,p=<parallelization>$<salt>$<hash>` where salt
+// and hash are base64 encoded without padding.
+type Scrypt struct {
+	Cost            uint32
+	Block           uint32
+	Parallelization uint32
+	SaltLength      uint32
+	KeyLength       uint32
+}
+
+func NewHasherScrypt() *Scrypt {
+	return &Scrypt{Cost: 32768, Block: 8, Parallelization: 1, SaltLength: 16, KeyLength: 32}
+}
+
+func (h *Scrypt) Generate(password []byte) ([]byte, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	key, err := scrypt.Key(password, salt, int(h.Cost), int(h.Block), int(h.Parallelization), int(h.KeyLength))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var b bytes.Buffer
+	if _, err := fmt.Fprintf(
+		&b,
+		"$scrypt$ln=%d,r=%d,p=%d$%s$%s",
+		h.Cost, h.Block, h.Parallelization,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return b.Bytes(), nil
+}
+
+func (h *Scrypt) Compare(password []byte, hash []byte) error {
+	p, salt, key, err := decodeScryptHash(string(hash))
+	if err != nil {
+		return err
+	}
+
+	otherKey, err := scrypt.Key(password, salt, int(p.Cost), int(p.Block), int(p.Parallelization), int(p.KeyLength))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if subtle.ConstantTimeCompare(key, otherKey) == 1 {
+		return nil
+	}
+	return ErrMismatchedHashAndPassword
+}
+
+func (h *Scrypt) NeedsRehash(hash []byte) bool {
+	p, _, _, err := decodeScryptHash(string(hash))
+	if err != nil {
+		return true
+	}
+
+	return *p != *h
+}
+
+func isScryptHash(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$scrypt$"))
+}
+
+func decodeScryptHash(encodedHash string) (p *Scrypt, salt, key []byte, err error) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 5 || parts[1] != "scrypt" {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	p = new(Scrypt)
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &p.Cost, &p.Block, &p.Parallelization); err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	p.SaltLength = uint32(len(salt))
+
+	key, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
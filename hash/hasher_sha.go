@@ -0,0 +1,96 @@
+package hash
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1" // #nosec G505 only used to verify legacy hashes
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"hash"
+
+	"github.com/pkg/errors"
+)
+
+var saltedSHAPrefixes = map[string]func() hash.Hash{
+	"{SSHA}":    sha1.New,
+	"{SSHA256}": sha256.New,
+	"{SSHA512}": sha512.New,
+}
+
+// SaltedSHA compares and generates LDAP style salted SHA hashes in the format `{SSHA<256|512>}<hash>`
+// where hash is the base64 encoded digest of the password and the salt, followed by the salt.
+//
+// These hashes are only supported to import users from legacy systems and should not be generated
+// for new passwords.
+type SaltedSHA struct {
+	Prefix     string
+	SaltLength uint32
+}
+
+func NewHasherSaltedSHA() *SaltedSHA {
+	return &SaltedSHA{Prefix: "{SSHA512}", SaltLength: 16}
+}
+
+func (h *SaltedSHA) Generate(password []byte) ([]byte, error) {
+	f, ok := saltedSHAPrefixes[h.Prefix]
+	if !ok {
+		return nil, errors.WithStack(ErrUnknownHashAlgorithm)
+	}
+
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return []byte(h.Prefix + base64.StdEncoding.EncodeToString(append(saltedSHADigest(f, password, salt), salt...))), nil
+}
+
+func (h *SaltedSHA) Compare(password []byte, hash []byte) error {
+	prefix, f, ok := saltedSHAFunc(hash)
+	if !ok {
+		return ErrInvalidHash
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(string(hash[len(prefix):]))
+	if err != nil {
+		return ErrInvalidHash
+	}
+
+	size := f().Size()
+	if len(decoded) <= size {
+		return ErrInvalidHash
+	}
+
+	if subtle.ConstantTimeCompare(decoded[:size], saltedSHADigest(f, password, decoded[size:])) == 1 {
+		return nil
+	}
+	return ErrMismatchedHashAndPassword
+}
+
+func (h *SaltedSHA) NeedsRehash(hash []byte) bool {
+	prefix, _, ok := saltedSHAFunc(hash)
+	return !ok || prefix != h.Prefix
+}
+
+func isSaltedSHAHash(hash []byte) bool {
+	_, _, ok := saltedSHAFunc(hash)
+	return ok
+}
+
+func saltedSHAFunc(hash []byte) (string, func() hash.Hash, bool) {
+	for prefix, f := range saltedSHAPrefixes {
+		if bytes.HasPrefix(hash, []byte(prefix)) {
+			return prefix, f, true
+		}
+	}
+	return "", nil, false
+}
+
+func saltedSHADigest(f func() hash.Hash, password, salt []byte) []byte {
+	h := f()
+	_, _ = h.Write(password)
+	_, _ = h.Write(salt)
+	return h.Sum(nil)
+}
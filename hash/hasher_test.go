@@ -3,11 +3,16 @@ package hash_test
 import (
 	"crypto/rand"
 	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/ory/viper"
+
+	"github.com/zzpu/ums/driver/configuration"
 	"github.com/zzpu/ums/hash"
 	"github.com/zzpu/ums/internal"
 )
@@ -31,8 +36,22 @@ func TestHasher(t *testing.T) {
 			conf := internal.NewConfigurationWithDefaults()
 			for kk, h := range []hash.Hasher{
 				hash.NewHasherArgon2(conf),
+				hash.NewHasherBcrypt(conf),
+				&hash.PBKDF2{Algorithm: "sha256", Iterations: 10, SaltLength: 16, KeyLength: 32},
+				&hash.PBKDF2{Algorithm: "sha512", Iterations: 10, SaltLength: 16, KeyLength: 64},
+				&hash.Scrypt{Cost: 1024, Block: 8, Parallelization: 1, SaltLength: 16, KeyLength: 32},
+				&hash.SaltedSHA{Prefix: "{SSHA}", SaltLength: 8},
+				&hash.SaltedSHA{Prefix: "{SSHA256}", SaltLength: 8},
+				&hash.SaltedSHA{Prefix: "{SSHA512}", SaltLength: 8},
+				hash.NewHasherComposite(conf),
 			} {
 				t.Run(fmt.Sprintf("hasher=%T/password=%d", h, kk), func(t *testing.T) {
+					if _, ok := h.(*hash.Bcrypt); ok && len(pw) > 72 {
+						_, err := h.Generate(pw)
+						require.True(t, errors.Is(err, hash.ErrBcryptPasswordLengthReached), "%+v", err)
+						return
+					}
+
 					hs, err := h.Generate(pw)
 					require.NoError(t, err)
 					assert.NotEqual(t, pw, hs)
@@ -44,8 +63,135 @@ func TestHasher(t *testing.T) {
 					copy(mod, pw)
 					mod[len(pw)-1] = ^pw[len(pw)-1]
 					require.Error(t, h.Compare(mod, hs))
+
+					assert.False(t, h.NeedsRehash(hs))
 				})
 			}
 		})
 	}
 }
+
+func TestCompositeHasher(t *testing.T) {
+	conf := internal.NewConfigurationWithDefaults()
+	h := hash.NewHasherComposite(conf)
+
+	t.Run("case=compares hashes generated by other systems", func(t *testing.T) {
+		for k, tc := range []struct {
+			password string
+			hash     string
+		}{
+			{password: "allmine", hash: "$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga"},
+			{password: "password", hash: "$pbkdf2-sha256$i=1000,l=32$c2FsdHNhbHRzYWx0c2FsdA$8nX7hwFEzIB8aPajJTYK8weHQc5Ngz0pFVAKvSu4jQA"},
+			{password: "password", hash: "$pbkdf2-sha512$i=1000,l=64$c2FsdHNhbHRzYWx0c2FsdA$715rqIr5dXOVPpBhqqsugl037zT5bWJTWYmZtIcK8hBnisKpwfY7kokvwjDrNHqHhF50Pb7MD6HvkJwiDQw4ww"},
+			{password: "password", hash: "$scrypt$ln=1024,r=8,p=1$c2FsdHNhbHRzYWx0c2FsdA$BVMRKqdiVYikKAaPR1wucsKUKvw4TuPLkdEYtoSHas4"},
+			{password: "password", hash: "{SSHA}rXVtWiPAY6/w8MuTLKIjpBjj2mtzYWx0MTIzNA=="},
+			{password: "password", hash: "{SSHA256}ZqbcWj6+KqD5BBm617QPtrpLWEgXUSAWm8MErrSqRq5zYWx0MTIzNA=="},
+			{password: "password", hash: "{SSHA512}nOkBUt6l7zlKAfjtk1EfB0TmckXfDiA4FPLcpywOLORZ1PWQK4+PZVEiT4+9rFjqR3xnaruZBiRjDGcDpxxTinNhbHQxMjM0"},
+		} {
+			t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+				require.NoError(t, h.Compare([]byte(tc.password), []byte(tc.hash)))
+				assert.True(t, errors.Is(h.Compare([]byte(tc.password+"!"), []byte(tc.hash)), hash.ErrMismatchedHashAndPassword))
+				assert.True(t, h.NeedsRehash([]byte(tc.hash)))
+				assert.True(t, hash.IsSupported([]byte(tc.hash)))
+			})
+		}
+	})
+
+	t.Run("case=rejects unknown hashes", func(t *testing.T) {
+		assert.True(t, errors.Is(h.Compare([]byte("password"), []byte("$md5$foo")), hash.ErrUnknownHashAlgorithm))
+		assert.True(t, errors.Is(h.Compare([]byte("password"), []byte("$pbkdf2-md5$i=1,l=1$c2FsdA$AA")), hash.ErrUnknownHashAlgorithm))
+		assert.True(t, errors.Is(h.Compare([]byte("password"), []byte("{SSHA}!!")), hash.ErrInvalidHash))
+
+		for _, hs := range []string{"$md5$foo", "$pbkdf2-md5$i=1,l=1$c2FsdA$AA", "{SSHA}!!", "$2a$10$foo", "$argon2id$v=19$foo", "$scrypt$ln=1$foo$bar", "password"} {
+			assert.False(t, hash.IsSupported([]byte(hs)), hs)
+		}
+
+		for _, hs := range []string{"$md5$foo", "password", ""} {
+			assert.False(t, hash.HasKnownAlgorithm([]byte(hs)), hs)
+		}
+		for _, hs := range []string{"$2a$10$foo", "$argon2id$v=19$foo", "$scrypt$ln=1$foo$bar", "$pepper$first$argon2id$..."} {
+			assert.True(t, hash.HasKnownAlgorithm([]byte(hs)), hs)
+		}
+	})
+
+	t.Run("case=rehashes argon2 hashes with outdated parameters", func(t *testing.T) {
+		hs, err := h.Generate([]byte("password"))
+		require.NoError(t, err)
+		assert.False(t, h.NeedsRehash(hs))
+		assert.True(t, hash.IsSupported(hs))
+
+		viper.Set(configuration.ViperKeyHasherArgon2ConfigIterations, 2)
+		defer viper.Set(configuration.ViperKeyHasherArgon2ConfigIterations, 1)
+		assert.True(t, h.NeedsRehash(hs))
+	})
+
+	t.Run("case=generates hashes using the preferred algorithm", func(t *testing.T) {
+		viper.Set(configuration.ViperKeyHasherAlgorithm, "bcrypt")
+		defer viper.Set(configuration.ViperKeyHasherAlgorithm, "argon2")
+
+		hs, err := h.Generate([]byte("password"))
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(hs), "$2a$"), "%s", hs)
+		assert.False(t, h.NeedsRehash(hs))
+		require.NoError(t, h.Compare([]byte("password"), hs))
+
+		viper.Set(configuration.ViperKeyHasherBcryptConfigCost, 5)
+		defer viper.Set(configuration.ViperKeyHasherBcryptConfigCost, 4)
+		assert.True(t, h.NeedsRehash(hs))
+	})
+}
+
+func TestPepperedHasher(t *testing.T) {
+	conf := internal.NewConfigurationWithDefaults()
+	inner := hash.NewHasherComposite(conf)
+	h := hash.NewHasherPeppered(inner, conf)
+
+	first := configuration.PepperSecret{ID: "first", Secret: "a-very-secret-pepper-that-is-long-enough"}
+	second := configuration.PepperSecret{ID: "second", Secret: "another-very-secret-pepper-that-is-long-enough"}
+	defer viper.Set(configuration.ViperKeySecretsPepper, nil)
+
+	unpeppered, err := h.Generate([]byte("password"))
+	require.NoError(t, err)
+
+	t.Run("case=does not pepper without configured peppers", func(t *testing.T) {
+		assert.True(t, strings.HasPrefix(string(unpeppered), "$argon2id$"), "%s", unpeppered)
+		require.NoError(t, h.Compare([]byte("password"), unpeppered))
+		assert.False(t, h.NeedsRehash(unpeppered))
+	})
+
+	viper.Set(configuration.ViperKeySecretsPepper, []configuration.PepperSecret{first})
+	peppered, err := h.Generate([]byte("password"))
+	require.NoError(t, err)
+
+	t.Run("case=peppers the password", func(t *testing.T) {
+		assert.True(t, strings.HasPrefix(string(peppered), "$pepper$first$argon2id$"), "%s", peppered)
+		assert.True(t, hash.IsSupported(peppered))
+		require.NoError(t, h.Compare([]byte("password"), peppered))
+		assert.True(t, errors.Is(h.Compare([]byte("password!"), peppered), hash.ErrMismatchedHashAndPassword))
+		assert.False(t, h.NeedsRehash(peppered))
+
+		// Without the pepper, the stored hash can not be cracked using the password alone.
+		assert.True(t, errors.Is(inner.Compare([]byte("password"), peppered[len("$pepper$first"):]), hash.ErrMismatchedHashAndPassword))
+	})
+
+	t.Run("case=compares and rehashes unpeppered hashes", func(t *testing.T) {
+		require.NoError(t, h.Compare([]byte("password"), unpeppered))
+		assert.True(t, h.NeedsRehash(unpeppered))
+	})
+
+	t.Run("case=rotates peppers", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySecretsPepper, []configuration.PepperSecret{second, first})
+
+		require.NoError(t, h.Compare([]byte("password"), peppered))
+		assert.True(t, h.NeedsRehash(peppered))
+
+		rotated, err := h.Generate([]byte("password"))
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(rotated), "$pepper$second$argon2id$"), "%s", rotated)
+		assert.False(t, h.NeedsRehash(rotated))
+
+		viper.Set(configuration.ViperKeySecretsPepper, []configuration.PepperSecret{second})
+		assert.True(t, errors.Is(h.Compare([]byte("password"), peppered), hash.ErrUnknownPepper))
+		require.NoError(t, h.Compare([]byte("password"), rotated))
+	})
+}
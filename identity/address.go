@@ -1,3 +1,34 @@
 package identity
 
-const AddressTypeEmail = "email"
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	AddressTypeEmail = "email"
+	AddressTypePhone = "phone"
+)
+
+var (
+	phoneNumberSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+	phoneNumberE164       = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+)
+
+// NormalizePhoneNumber returns the phone number in E.164 format (e.g. +8613812345678). The number
+// must contain the country calling code, prefixed either with "+" or with the international call
+// prefix "00". Spaces, dashes, dots, and parentheses are removed.
+func NormalizePhoneNumber(value string) (string, error) {
+	normalized := phoneNumberSeparators.Replace(strings.TrimSpace(value))
+	if strings.HasPrefix(normalized, "00") {
+		normalized = "+" + strings.TrimPrefix(normalized, "00")
+	}
+
+	if !phoneNumberE164.MatchString(normalized) {
+		return "", errors.Errorf("%q is not a valid phone number in E.164 format", value)
+	}
+
+	return normalized, nil
+}
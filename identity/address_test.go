@@ -0,0 +1,37 @@
+package identity
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizePhoneNumber(t *testing.T) {
+	for k, tc := range []struct {
+		in, expected string
+	}{
+		{in: "+8613812345678", expected: "+8613812345678"},
+		{in: "+86 138 1234 5678", expected: "+8613812345678"},
+		{in: "008613812345678", expected: "+8613812345678"},
+		{in: "+1 (415) 555-2671", expected: "+14155552671"},
+		{in: " +49.30.1234567 ", expected: "+49301234567"},
+		{in: "13812345678"},
+		{in: "+0123456789"},
+		{in: "+86 138 1234 5678 9999"},
+		{in: "+12345"},
+		{in: "+86abc12345678"},
+		{in: ""},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			actual, err := NormalizePhoneNumber(tc.in)
+			if tc.expected == "" {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
@@ -18,8 +18,15 @@ func (c CredentialsType) String() string {
 }
 
 const (
-	CredentialsTypePassword CredentialsType = "password"
-	CredentialsTypeOIDC     CredentialsType = "oidc"
+	CredentialsTypePassword    CredentialsType = "password"
+	CredentialsTypeOIDC        CredentialsType = "oidc"
+	CredentialsTypeTOTP        CredentialsType = "totp"
+	CredentialsTypeWebAuthn    CredentialsType = "webauthn"
+	CredentialsTypeBackupCodes CredentialsType = "backup_codes"
+	CredentialsTypeMagicLink   CredentialsType = "magic_link"
+	CredentialsTypeAPIKey      CredentialsType = "api_key"
+	CredentialsTypeLDAP        CredentialsType = "ldap"
+	CredentialsTypeSAML        CredentialsType = "saml"
 )
 
 type (
@@ -23,31 +23,39 @@ func (r *SchemaExtensionRecovery) Run(ctx jsonschema.ValidationContext, s schema
 	r.l.Lock()
 	defer r.l.Unlock()
 
+	var address *RecoveryAddress
 	switch s.Recovery.Via {
-	case "email":
+	case AddressTypeEmail:
 		if !jsonschema.Formats["email"](value) {
 			return ctx.Error("format", "%q is not valid %q", value, "email")
 		}
 
-		address := NewRecoveryEmailAddress(fmt.Sprintf("%s", value), r.i.ID)
-
-		if has := r.has(r.i.RecoveryAddresses, address); has != nil {
-			if r.has(r.v, address) == nil {
-				r.v = append(r.v, *has)
-			}
-			return nil
-		}
-
-		if has := r.has(r.v, address); has == nil {
-			r.v = append(r.v, *address)
+		address = NewRecoveryEmailAddress(fmt.Sprintf("%s", value), r.i.ID)
+	case AddressTypePhone:
+		phone, err := NormalizePhoneNumber(fmt.Sprintf("%s", value))
+		if err != nil {
+			return ctx.Error("format", "%q is not valid %q", value, "phone")
 		}
 
-		return nil
+		address = NewRecoveryPhoneAddress(phone, r.i.ID)
 	case "":
 		return nil
+	default:
+		return ctx.Error("", "recovery.via has unknown value %q", s.Recovery.Via)
 	}
 
-	return ctx.Error("", "recovery.via has unknown value %q", s.Recovery.Via)
+	if has := r.has(r.i.RecoveryAddresses, address); has != nil {
+		if r.has(r.v, address) == nil {
+			r.v = append(r.v, *has)
+		}
+		return nil
+	}
+
+	if has := r.has(r.v, address); has == nil {
+		r.v = append(r.v, *address)
+	}
+
+	return nil
 }
 
 func (r *SchemaExtensionRecovery) has(haystack []RecoveryAddress, needle *RecoveryAddress) *RecoveryAddress {
@@ -137,6 +137,22 @@ func TestSchemaExtensionRecovery(t *testing.T) {
 				},
 			},
 		},
+		{
+			doc:    `{"phone":"+49 (170) 123-4567"}`,
+			schema: "file://./stub/extension/recovery/schema.json",
+			expect: []RecoveryAddress{
+				{
+					Value:      "+491701234567",
+					Via:        RecoveryAddressTypePhone,
+					IdentityID: iid,
+				},
+			},
+		},
+		{
+			doc:       `{"phone":"0170 1234567"}`,
+			schema:    "file://./stub/extension/recovery/schema.json",
+			expectErr: errors.New("I[#/phone] S[#/properties/phone/format] \"0170 1234567\" is not valid \"phone\""),
+		},
 	} {
 		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
 			id := &Identity{ID: iid, RecoveryAddresses: tc.existing}
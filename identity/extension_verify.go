@@ -25,31 +25,39 @@ func (r *SchemaExtensionVerification) Run(ctx jsonschema.ValidationContext, s sc
 	r.l.Lock()
 	defer r.l.Unlock()
 
+	var address *VerifiableAddress
 	switch s.Verification.Via {
-	case "email":
+	case AddressTypeEmail:
 		if !jsonschema.Formats["email"](value) {
 			return ctx.Error("format", "%q is not valid %q", value, "email")
 		}
 
-		address := NewVerifiableEmailAddress(fmt.Sprintf("%s", value), r.i.ID)
-
-		if has := r.has(r.i.VerifiableAddresses, address); has != nil {
-			if r.has(r.v, address) == nil {
-				r.v = append(r.v, *has)
-			}
-			return nil
-		}
-
-		if has := r.has(r.v, address); has == nil {
-			r.v = append(r.v, *address)
+		address = NewVerifiableEmailAddress(fmt.Sprintf("%s", value), r.i.ID)
+	case AddressTypePhone:
+		phone, err := NormalizePhoneNumber(fmt.Sprintf("%s", value))
+		if err != nil {
+			return ctx.Error("format", "%q is not valid %q", value, "phone")
 		}
 
-		return nil
+		address = NewVerifiablePhoneAddress(phone, r.i.ID)
 	case "":
 		return nil
+	default:
+		return ctx.Error("", "verification.via has unknown value %q", s.Verification.Via)
 	}
 
-	return ctx.Error("", "verification.via has unknown value %q", s.Verification.Via)
+	if has := r.has(r.i.VerifiableAddresses, address); has != nil {
+		if r.has(r.v, address) == nil {
+			r.v = append(r.v, *has)
+		}
+		return nil
+	}
+
+	if has := r.has(r.v, address); has == nil {
+		r.v = append(r.v, *address)
+	}
+
+	return nil
 }
 
 func (r *SchemaExtensionVerification) has(haystack []VerifiableAddress, needle *VerifiableAddress) *VerifiableAddress {
@@ -166,6 +166,24 @@ func TestSchemaExtensionVerification(t *testing.T) {
 				},
 			},
 		},
+		{
+			doc:    `{"phone":"+49 (170) 123-4567"}`,
+			schema: "file://./stub/extension/verify/schema.json",
+			expect: []VerifiableAddress{
+				{
+					Value:      "+491701234567",
+					Verified:   false,
+					Status:     VerifiableAddressStatusPending,
+					Via:        VerifiableAddressTypePhone,
+					IdentityID: iid,
+				},
+			},
+		},
+		{
+			doc:       `{"phone":"0170 1234567"}`,
+			schema:    "file://./stub/extension/verify/schema.json",
+			expectErr: errors.New("I[#/phone] S[#/properties/phone/format] \"0170 1234567\" is not valid \"phone\""),
+		},
 	} {
 		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
 			id := &Identity{ID: iid, VerifiableAddresses: tc.existing}
@@ -10,6 +10,7 @@ import (
 	"github.com/ory/x/jsonx"
 	"github.com/ory/x/urlx"
 
+	"github.com/zzpu/ums/hash"
 	"github.com/zzpu/ums/x"
 )
 
@@ -21,6 +22,7 @@ type (
 		PrivilegedPoolProvider
 		ManagementProvider
 		x.WriterProvider
+		hash.HashProvider
 	}
 	HandlerProvider interface {
 		IdentityHandler() *Handler
@@ -186,14 +188,20 @@ type CreateIdentity struct {
 	// required: true
 	// in: body
 	Traits json.RawMessage `json:"traits"`
+
+	// Credentials are imported alongside the identity. Use them to migrate users from other systems.
+	//
+	// in: body
+	Credentials *ImportCredentials `json:"credentials,omitempty"`
 }
 
 // swagger:route POST /identities admin createIdentity
 //
 // Create an Identity
 //
-// This endpoint creates an identity. It is NOT possible to set an identity's credentials (password, ...)
-// using this method! A way to achieve that will be introduced in the future.
+// This endpoint creates an identity. Credentials may be imported alongside the identity, either with a
+// cleartext password which is hashed on import, a password hash in one of the supported formats,
+// or links to OpenID Connect providers.
 //
 // Learn how identities work in [ORY Kratos' User And Identity Model Documentation](https://www.ory.sh/docs/next/kratos/concepts/identity-user-model).
 //
@@ -218,7 +226,16 @@ func (h *Handler) create(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 	}
 
 	i := &Identity{SchemaID: cr.SchemaID, Traits: []byte(cr.Traits)}
-	if err := h.r.IdentityManager().Create(r.Context(), i); err != nil {
+	var opts []ManagerOption
+	if cr.Credentials != nil {
+		if err := h.importCredentials(i, cr.Credentials); err != nil {
+			h.r.Writer().WriteError(w, r, err)
+			return
+		}
+		opts = append(opts, ManagerRequireCredentialsIdentifiers)
+	}
+
+	if err := h.r.IdentityManager().Create(r.Context(), i, opts...); err != nil {
 		h.r.Writer().WriteError(w, r, err)
 		return
 	}
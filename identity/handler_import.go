@@ -0,0 +1,150 @@
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/go-convenience/stringslice"
+	"github.com/ory/herodot"
+
+	"github.com/zzpu/ums/hash"
+)
+
+type (
+	// ImportCredentials are the credentials which are imported alongside an identity.
+	//
+	// swagger:model importCredentials
+	ImportCredentials struct {
+		// Password imports a password, either in cleartext or already hashed.
+		Password *ImportCredentialsPassword `json:"password,omitempty"`
+
+		// OIDC links the identity to one or more OpenID Connect providers.
+		OIDC *ImportCredentialsOIDC `json:"oidc,omitempty"`
+	}
+
+	// swagger:model importCredentialsPassword
+	ImportCredentialsPassword struct {
+		// Password is a cleartext password which is hashed on import. It is not checked against
+		// the password policy.
+		Password string `json:"password,omitempty"`
+
+		// HashedPassword is a password hash in one of the supported formats: argon2id, bcrypt,
+		// pbkdf2 (`$pbkdf2-sha256$...`, `$pbkdf2-sha512$...`), scrypt (`$scrypt$...`) and salted SHA
+		// (`{SSHA}`, `{SSHA256}`, `{SSHA512}`). Hashes which do not use the preferred algorithm are
+		// upgraded on the next successful login.
+		HashedPassword string `json:"hashed_password,omitempty"`
+	}
+
+	// swagger:model importCredentialsOIDC
+	ImportCredentialsOIDC struct {
+		// Providers are the OpenID Connect providers the identity is linked to.
+		Providers []ImportCredentialsOIDCProvider `json:"providers"`
+	}
+
+	// swagger:model importCredentialsOIDCProvider
+	ImportCredentialsOIDCProvider struct {
+		// Provider is the ID of the OpenID Connect provider as configured in Kratos.
+		//
+		// required: true
+		Provider string `json:"provider"`
+
+		// Subject is the subject (`sub` claim) of the user at the OpenID Connect provider.
+		//
+		// required: true
+		Subject string `json:"subject"`
+	}
+)
+
+func (h *Handler) importCredentials(i *Identity, c *ImportCredentials) error {
+	if c.Password != nil {
+		if err := h.importPasswordCredentials(i, c.Password); err != nil {
+			return err
+		}
+	}
+
+	if c.OIDC != nil {
+		if err := h.importOIDCCredentials(i, c.OIDC); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *Handler) importPasswordCredentials(i *Identity, c *ImportCredentialsPassword) error {
+	hpw := []byte(c.HashedPassword)
+	switch {
+	case len(c.Password) > 0 && len(c.HashedPassword) > 0:
+		return errors.WithStack(herodot.ErrBadRequest.WithReason("Only one of password and hashed_password may be set when importing password credentials."))
+	case len(c.Password) > 0:
+		var err error
+		hpw, err = h.r.Hasher().Generate([]byte(c.Password))
+		if err != nil {
+			return err
+		}
+	case len(c.HashedPassword) > 0:
+		if !hash.IsSupported(hpw) {
+			return errors.WithStack(herodot.ErrBadRequest.WithReason("The hashed password is malformed or uses an unsupported hash algorithm."))
+		}
+	default:
+		return errors.WithStack(herodot.ErrBadRequest.WithReason("Either password or hashed_password must be set when importing password credentials."))
+	}
+
+	config, err := json.Marshal(&struct {
+		HashedPassword string `json:"hashed_password"`
+	}{HashedPassword: string(hpw)})
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode password options to JSON: %s", err))
+	}
+
+	// The identifiers are set by the identity schema once the identity is validated.
+	i.SetCredentials(CredentialsTypePassword, Credentials{
+		Type:        CredentialsTypePassword,
+		Identifiers: []string{},
+		Config:      config,
+	})
+	return nil
+}
+
+func (h *Handler) importOIDCCredentials(i *Identity, c *ImportCredentialsOIDC) error {
+	type providerCredentials struct {
+		Subject  string `json:"subject"`
+		Provider string `json:"provider"`
+	}
+
+	if len(c.Providers) == 0 {
+		return errors.WithStack(herodot.ErrBadRequest.WithReason("At least one provider must be set when importing OpenID Connect credentials."))
+	}
+
+	var identifiers []string
+	var providers []providerCredentials
+	for _, p := range c.Providers {
+		if len(p.Provider) == 0 || len(p.Subject) == 0 {
+			return errors.WithStack(herodot.ErrBadRequest.WithReason("Both provider and subject must be set when importing OpenID Connect credentials."))
+		}
+
+		identifier := fmt.Sprintf("%s:%s", p.Provider, p.Subject)
+		if stringslice.Has(identifiers, identifier) {
+			continue
+		}
+
+		identifiers = append(identifiers, identifier)
+		providers = append(providers, providerCredentials{Subject: p.Subject, Provider: p.Provider})
+	}
+
+	config, err := json.Marshal(&struct {
+		Providers []providerCredentials `json:"providers"`
+	}{Providers: providers})
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode OpenID Connect options to JSON: %s", err))
+	}
+
+	i.SetCredentials(CredentialsTypeOIDC, Credentials{
+		Type:        CredentialsTypeOIDC,
+		Identifiers: identifiers,
+		Config:      config,
+	})
+	return nil
+}
@@ -2,12 +2,16 @@ package identity_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/gofrs/uuid"
+
 	"github.com/ory/x/urlx"
 
 	"github.com/zzpu/ums/internal/testhelpers"
@@ -40,6 +44,7 @@ func TestHandler(t *testing.T) {
 	testhelpers.SetIdentitySchemas(map[string]string{
 		"customer": "file://./stub/handler/customer.schema.json",
 		"employee": "file://./stub/handler/employee.schema.json",
+		"guest":    "file://./stub/handler/guest.schema.json",
 	})
 	viper.Set(configuration.ViperKeyPublicBaseURL, mockServerURL.String())
 
@@ -268,4 +273,92 @@ func TestHandler(t *testing.T) {
 	t.Run("case=should return 404 for non-existing identities", func(t *testing.T) {
 		remove(t, "/identities/"+x.NewUUID().String(), http.StatusNotFound)
 	})
+
+	t.Run("suite=import credentials", func(t *testing.T) {
+		var credentials = func(t *testing.T, res gjson.Result, ct identity.CredentialsType) *identity.Credentials {
+			i, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), uuid.FromStringOrNil(res.Get("id").String()))
+			require.NoError(t, err)
+			c, ok := i.GetCredentials(ct)
+			require.True(t, ok, "%+v", i.Credentials)
+			return c
+		}
+
+		t.Run("case=should import a cleartext password", func(t *testing.T) {
+			res := send(t, "POST", "/identities", http.StatusCreated, json.RawMessage(`{"traits":{"email":"import-cleartext@ory.sh"},"credentials":{"password":{"password":"123456"}}}`))
+			assert.Empty(t, res.Get("credentials").String(), "%s", res.Raw)
+
+			c := credentials(t, res, identity.CredentialsTypePassword)
+			assert.Equal(t, []string{"import-cleartext@ory.sh"}, c.Identifiers)
+			hashed := gjson.GetBytes(c.Config, "hashed_password").String()
+			assert.NotEqual(t, "123456", hashed)
+			require.NoError(t, reg.Hasher().Compare([]byte("123456"), []byte(hashed)))
+		})
+
+		t.Run("case=should import a hashed password", func(t *testing.T) {
+			res := send(t, "POST", "/identities", http.StatusCreated, json.RawMessage(`{"traits":{"email":"import-hashed@ory.sh"},"credentials":{"password":{"hashed_password":"$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga"}}}`))
+
+			c := credentials(t, res, identity.CredentialsTypePassword)
+			assert.Equal(t, []string{"import-hashed@ory.sh"}, c.Identifiers)
+			assert.Equal(t, "$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga", gjson.GetBytes(c.Config, "hashed_password").String())
+			require.NoError(t, reg.Hasher().Compare([]byte("allmine"), []byte(gjson.GetBytes(c.Config, "hashed_password").String())))
+		})
+
+		t.Run("case=should import OpenID Connect links", func(t *testing.T) {
+			res := send(t, "POST", "/identities", http.StatusCreated, json.RawMessage(`{"schema_id":"guest","traits":{"nickname":"import-oidc"},"credentials":{"oidc":{"providers":[{"provider":"github","subject":"import-oidc"},{"provider":"google","subject":"import-oidc"}]}}}`))
+
+			c := credentials(t, res, identity.CredentialsTypeOIDC)
+			assert.Equal(t, []string{"github:import-oidc", "google:import-oidc"}, c.Identifiers)
+			assert.Equal(t, "github", gjson.GetBytes(c.Config, "providers.0.provider").String(), "%s", c.Config)
+			assert.Equal(t, "import-oidc", gjson.GetBytes(c.Config, "providers.1.subject").String(), "%s", c.Config)
+
+			_, _, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeOIDC, "google:import-oidc")
+			require.NoError(t, err)
+		})
+
+		t.Run("case=should reject invalid credentials", func(t *testing.T) {
+			for k, tc := range []struct {
+				payload string
+				code    int
+				reason  string
+			}{
+				{
+					payload: `{"traits":{"email":"import-invalid@ory.sh"},"credentials":{"password":{"password":"123456","hashed_password":"{SSHA}rXVtWiPAY6/w8MuTLKIjpBjj2mtzYWx0MTIzNA=="}}}`,
+					code:    http.StatusBadRequest, reason: "Only one of password and hashed_password",
+				},
+				{
+					payload: `{"traits":{"email":"import-invalid@ory.sh"},"credentials":{"password":{}}}`,
+					code:    http.StatusBadRequest, reason: "Either password or hashed_password",
+				},
+				{
+					payload: `{"traits":{"email":"import-invalid@ory.sh"},"credentials":{"password":{"hashed_password":"$md5$foo"}}}`,
+					code:    http.StatusBadRequest, reason: "unsupported hash algorithm",
+				},
+				{
+					payload: `{"traits":{"email":"import-invalid@ory.sh"},"credentials":{"oidc":{"providers":[{"provider":"github"}]}}}`,
+					code:    http.StatusBadRequest, reason: "Both provider and subject",
+				},
+				{
+					payload: `{"traits":{"email":"import-invalid@ory.sh"},"credentials":{"oidc":{"providers":[]}}}`,
+					code:    http.StatusBadRequest, reason: "At least one provider",
+				},
+				{
+					payload: `{"schema_id":"guest","traits":{"nickname":"import-invalid"},"credentials":{"password":{"password":"123456"}}}`,
+					code:    http.StatusBadRequest, reason: `does not define any identifiers for credentials of type "password"`,
+				},
+				{
+					payload: `{"traits":{"email":"import-cleartext@ory.sh"},"credentials":{"password":{"password":"123456"}}}`,
+					code:    http.StatusConflict,
+				},
+				{
+					payload: `{"schema_id":"guest","traits":{},"credentials":{"oidc":{"providers":[{"provider":"github","subject":"import-oidc"}]}}}`,
+					code:    http.StatusConflict,
+				},
+			} {
+				t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+					res := send(t, "POST", "/identities", tc.code, json.RawMessage(tc.payload))
+					assert.Contains(t, res.Get("error.reason").String(), tc.reason, "%s", res.Raw)
+				})
+			}
+		})
+	})
 }
@@ -72,6 +72,10 @@ type (
 		// ---
 		RecoveryAddresses []RecoveryAddress `json:"recovery_addresses,omitempty" faker:"-" has_many:"identity_recovery_addresses" fk_id:"identity_id"`
 
+		// RecoverySecurityAnswers contains the hashed answers to the security questions which can be used
+		// to recover an identity. They are never exposed through the API.
+		RecoverySecurityAnswers []RecoverySecurityAnswer `json:"-" faker:"-" has_many:"identity_recovery_security_answers" fk_id:"identity_id"`
+
 		// CredentialsCollection is a helper struct field for gobuffalo.pop.
 		CredentialsCollection CredentialsCollection `json:"-" faker:"-" has_many:"identity_credentials" fk_id:"identity_id"`
 
@@ -124,10 +128,13 @@ func (i *Identity) lock() *sync.RWMutex {
 	return i.l
 }
 
-func (i *Identity) SetSecurityAnswers(answers map[string]string) {
+func (i *Identity) SetSecurityAnswers(answers []RecoverySecurityAnswer) {
 	i.lock().Lock()
 	defer i.lock().Unlock()
-
+	for k := range answers {
+		answers[k].IdentityID = i.ID
+	}
+	i.RecoverySecurityAnswers = answers
 }
 
 func (i *Identity) SetCredentials(t CredentialsType, c Credentials) {
@@ -169,6 +176,7 @@ func (i *Identity) ParseCredentials(t CredentialsType, config interface{}) (*Cre
 func (i *Identity) CopyWithoutCredentials() *Identity {
 	var ii = *i
 	ii.Credentials = nil
+	ii.RecoverySecurityAnswers = nil
 	return &ii
 }
 
@@ -8,6 +8,7 @@ import (
 
 const (
 	RecoveryAddressTypeEmail RecoveryAddressType = AddressTypeEmail
+	RecoveryAddressTypePhone RecoveryAddressType = AddressTypePhone
 )
 
 type (
@@ -41,6 +42,8 @@ func (v RecoveryAddressType) HTMLFormInputType() string {
 	switch v {
 	case RecoveryAddressTypeEmail:
 		return "email"
+	case RecoveryAddressTypePhone:
+		return "tel"
 	}
 	return ""
 }
@@ -59,3 +62,15 @@ func NewRecoveryEmailAddress(
 		IdentityID: identity,
 	}
 }
+
+// NewRecoveryPhoneAddress expects the phone number to be normalized using NormalizePhoneNumber.
+func NewRecoveryPhoneAddress(
+	value string,
+	identity uuid.UUID,
+) *RecoveryAddress {
+	return &RecoveryAddress{
+		Value:      value,
+		Via:        RecoveryAddressTypePhone,
+		IdentityID: identity,
+	}
+}
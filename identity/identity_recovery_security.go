@@ -0,0 +1,34 @@
+package identity
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+type (
+	// RecoverySecurityAnswer is the hashed answer of an identity to one of the configured security questions.
+	RecoverySecurityAnswer struct {
+		// required: true
+		ID uuid.UUID `json:"id" db:"id" faker:"-"`
+
+		// QuestionID is the ID of the security question this answer belongs to.
+		//
+		// required: true
+		QuestionID string `json:"question_id" db:"question_id"`
+
+		// Answer is the hash of the normalized answer.
+		Answer string `json:"-" db:"answer"`
+
+		// IdentityID is a helper struct field for gobuffalo.pop.
+		IdentityID uuid.UUID `json:"-" faker:"-" db:"identity_id"`
+		// CreatedAt is a helper struct field for gobuffalo.pop.
+		CreatedAt time.Time `json:"-" faker:"-" db:"created_at"`
+		// UpdatedAt is a helper struct field for gobuffalo.pop.
+		UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+	}
+)
+
+func (a RecoverySecurityAnswer) TableName() string {
+	return "identity_recovery_security_answers"
+}
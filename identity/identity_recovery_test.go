@@ -14,5 +14,5 @@ func TestNewRecoveryEmailAddress(t *testing.T) {
 
 	assert.Equal(t, a.Value, "foo@ory.sh")
 	assert.Equal(t, a.Via, RecoveryAddressTypeEmail)
-	assert.NotEmpty(t, a.ID)
+	assert.Equal(t, iid, a.IdentityID)
 }
@@ -10,6 +10,7 @@ import (
 
 const (
 	VerifiableAddressTypeEmail VerifiableAddressType = AddressTypeEmail
+	VerifiableAddressTypePhone VerifiableAddressType = AddressTypePhone
 
 	VerifiableAddressStatusPending   VerifiableAddressStatus = "pending"
 	VerifiableAddressStatusCompleted VerifiableAddressStatus = "completed"
@@ -54,6 +55,8 @@ func (v VerifiableAddressType) HTMLFormInputType() string {
 	switch v {
 	case VerifiableAddressTypeEmail:
 		return "email"
+	case VerifiableAddressTypePhone:
+		return "tel"
 	}
 	return ""
 }
@@ -74,3 +77,17 @@ func NewVerifiableEmailAddress(
 		IdentityID: identity,
 	}
 }
+
+// NewVerifiablePhoneAddress expects the phone number to be normalized using NormalizePhoneNumber.
+func NewVerifiablePhoneAddress(
+	value string,
+	identity uuid.UUID,
+) *VerifiableAddress {
+	return &VerifiableAddress{
+		Value:      value,
+		Verified:   false,
+		Status:     VerifiableAddressStatusPending,
+		Via:        VerifiableAddressTypePhone,
+		IdentityID: identity,
+	}
+}
@@ -18,5 +18,5 @@ func TestNewVerifiableEmailAddress(t *testing.T) {
 	assert.Equal(t, a.Status, VerifiableAddressStatusPending)
 	assert.Equal(t, a.Verified, false)
 	assert.EqualValues(t, time.Time{}, a.VerifiedAt)
-	assert.NotEmpty(t, a.ID)
+	assert.Equal(t, iid, a.IdentityID)
 }
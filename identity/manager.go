@@ -35,8 +35,9 @@ type (
 	}
 
 	managerOptions struct {
-		ExposeValidationErrors    bool
-		AllowWriteProtectedTraits bool
+		ExposeValidationErrors        bool
+		AllowWriteProtectedTraits     bool
+		RequireCredentialsIdentifiers bool
 	}
 
 	ManagerOption func(*managerOptions)
@@ -54,6 +55,12 @@ func ManagerAllowWriteProtectedTraits(options *managerOptions) {
 	options.AllowWriteProtectedTraits = true
 }
 
+// ManagerRequireCredentialsIdentifiers fails the validation if any of the identity's credentials do not have
+// an identifier after the identity schema was applied. Without one, the credentials could never be used to sign in.
+func ManagerRequireCredentialsIdentifiers(options *managerOptions) {
+	options.RequireCredentialsIdentifiers = true
+}
+
 func newManagerOptions(opts []ManagerOption) *managerOptions {
 	var o managerOptions
 	for _, f := range opts {
@@ -156,5 +163,13 @@ func (m *Manager) validate(i *Identity, o *managerOptions) error {
 		return err
 	}
 
+	if o.RequireCredentialsIdentifiers {
+		for _, c := range i.Credentials {
+			if len(c.Identifiers) == 0 {
+				return errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The identity schema "%s" does not define any identifiers for credentials of type "%s".`, i.SchemaID, c.Type))
+			}
+		}
+	}
+
 	return nil
 }
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -78,6 +80,17 @@ type (
 		// GetIdentityConfidential returns the identity including it's raw credentials. This should only be used internally.
 		GetIdentityConfidential(context.Context, uuid.UUID) (*Identity, error)
 
+		// UpdateIdentityCredentialsConfig replaces the config of the credentials with the given config, but only if
+		// the stored config still equals the config of the credentials. It returns sqlcon.ErrNoRows if the credentials
+		// were changed or removed in the meantime.
+		UpdateIdentityCredentialsConfig(ctx context.Context, c *Credentials, config sqlxx.JSONRawMessage) error
+
+		// UpdateIdentityCredentials replaces the config and the identifiers of the identity's credentials of c's type
+		// with the ones of c, but only if the stored credentials still equal expected. If expected is nil, the
+		// credentials are only created if the identity has no credentials of the type yet. It returns
+		// sqlcon.ErrNoRows if the credentials were changed in the meantime.
+		UpdateIdentityCredentials(ctx context.Context, identityID uuid.UUID, expected *Credentials, c *Credentials) error
+
 		// ListVerifiableAddresses lists all tracked verifiable addresses, regardless of whether they are already verified
 		// or not.
 		ListVerifiableAddresses(ctx context.Context, page, itemsPerPage int) ([]VerifiableAddress, error)
@@ -394,6 +407,151 @@ func TestPool(p PrivilegedPool) func(t *testing.T) {
 			assertEqual(t, expected, actual)
 		})
 
+		t.Run("case=get credentials without identifiers", func(t *testing.T) {
+			expected := passwordIdentity("", x.NewUUID().String())
+			expected.SetCredentials(CredentialsTypeBackupCodes, Credentials{
+				Type: CredentialsTypeBackupCodes, Identifiers: []string{},
+				Config: sqlxx.JSONRawMessage(`{"codes":[]}`),
+			})
+			require.NoError(t, p.CreateIdentity(context.Background(), expected))
+			createdIDs = append(createdIDs, expected.ID)
+
+			actual, err := p.GetIdentityConfidential(context.Background(), expected.ID)
+			require.NoError(t, err)
+
+			creds, ok := actual.GetCredentials(CredentialsTypeBackupCodes)
+			require.True(t, ok, "%+v", actual.Credentials)
+			assert.Empty(t, creds.Identifiers)
+			assert.JSONEq(t, `{"codes":[]}`, string(creds.Config))
+		})
+
+		t.Run("case=update credentials config only if unchanged", func(t *testing.T) {
+			expected := passwordIdentity("", x.NewUUID().String())
+			expected.SetCredentials(CredentialsTypeBackupCodes, Credentials{
+				Type: CredentialsTypeBackupCodes, Identifiers: []string{},
+				Config: sqlxx.JSONRawMessage(`{"codes":[{"hashed_code":"a"}]}`),
+			})
+			require.NoError(t, p.CreateIdentity(context.Background(), expected))
+			createdIDs = append(createdIDs, expected.ID)
+
+			actual, err := p.GetIdentityConfidential(context.Background(), expected.ID)
+			require.NoError(t, err)
+			first, ok := actual.GetCredentials(CredentialsTypeBackupCodes)
+			require.True(t, ok)
+			second := *first
+
+			require.NoError(t, p.UpdateIdentityCredentialsConfig(context.Background(), first, sqlxx.JSONRawMessage(`{"codes":[{"hashed_code":"b"}]}`)))
+			assert.JSONEq(t, `{"codes":[{"hashed_code":"b"}]}`, string(first.Config))
+
+			err = p.UpdateIdentityCredentialsConfig(context.Background(), &second, sqlxx.JSONRawMessage(`{"codes":[{"hashed_code":"c"}]}`))
+			assert.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+
+			actual, err = p.GetIdentityConfidential(context.Background(), expected.ID)
+			require.NoError(t, err)
+			creds, ok := actual.GetCredentials(CredentialsTypeBackupCodes)
+			require.True(t, ok)
+			assert.JSONEq(t, `{"codes":[{"hashed_code":"b"}]}`, string(creds.Config))
+		})
+
+		t.Run("case=update credentials config only once if updated concurrently", func(t *testing.T) {
+			expected := passwordIdentity("", x.NewUUID().String())
+			expected.SetCredentials(CredentialsTypeBackupCodes, Credentials{
+				Type: CredentialsTypeBackupCodes, Identifiers: []string{},
+				Config: sqlxx.JSONRawMessage(`{"codes":[{"hashed_code":"a"}]}`),
+			})
+			require.NoError(t, p.CreateIdentity(context.Background(), expected))
+			createdIDs = append(createdIDs, expected.ID)
+
+			actual, err := p.GetIdentityConfidential(context.Background(), expected.ID)
+			require.NoError(t, err)
+			loaded, ok := actual.GetCredentials(CredentialsTypeBackupCodes)
+			require.True(t, ok)
+
+			var updated int32
+			var wg sync.WaitGroup
+			for k := 0; k < 10; k++ {
+				wg.Add(1)
+				go func(k int) {
+					defer wg.Done()
+					for {
+						c := *loaded
+						err := p.UpdateIdentityCredentialsConfig(context.Background(), &c, sqlxx.JSONRawMessage(fmt.Sprintf(`{"codes":[{"hashed_code":"%d"}]}`, k)))
+						if err == nil {
+							atomic.AddInt32(&updated, 1)
+						} else if !errors.Is(err, sqlcon.ErrNoRows) {
+							// The database refused the concurrent transaction, so the update is repeated.
+							continue
+						}
+						return
+					}
+				}(k)
+			}
+			wg.Wait()
+
+			assert.EqualValues(t, 1, updated)
+		})
+
+		t.Run("case=update credentials and identifiers only if unchanged", func(t *testing.T) {
+			expected := passwordIdentity("", x.NewUUID().String())
+			require.NoError(t, p.CreateIdentity(context.Background(), expected))
+			createdIDs = append(createdIDs, expected.ID)
+
+			first, second := x.NewUUID().String(), x.NewUUID().String()
+			created := &Credentials{Type: CredentialsTypeAPIKey, Identifiers: []string{first}, Config: sqlxx.JSONRawMessage(`{"keys":["a"]}`)}
+			require.NoError(t, p.UpdateIdentityCredentials(context.Background(), expected.ID, nil, created))
+
+			err := p.UpdateIdentityCredentials(context.Background(), expected.ID, nil,
+				&Credentials{Type: CredentialsTypeAPIKey, Identifiers: []string{second}, Config: sqlxx.JSONRawMessage(`{"keys":["b"]}`)})
+			assert.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+
+			actual, err := p.GetIdentityConfidential(context.Background(), expected.ID)
+			require.NoError(t, err)
+			loaded, ok := actual.GetCredentials(CredentialsTypeAPIKey)
+			require.True(t, ok)
+			assert.Equal(t, []string{first}, loaded.Identifiers)
+			stale := *loaded
+
+			require.NoError(t, p.UpdateIdentityCredentials(context.Background(), expected.ID, loaded,
+				&Credentials{Type: CredentialsTypeAPIKey, Identifiers: []string{first, second}, Config: sqlxx.JSONRawMessage(`{"keys":["a","b"]}`)}))
+
+			err = p.UpdateIdentityCredentials(context.Background(), expected.ID, &stale,
+				&Credentials{Type: CredentialsTypeAPIKey, Identifiers: []string{first}, Config: sqlxx.JSONRawMessage(`{"keys":["a","c"]}`)})
+			assert.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+
+			found, creds, err := p.FindByCredentialsIdentifier(context.Background(), CredentialsTypeAPIKey, second)
+			require.NoError(t, err)
+			assert.Equal(t, expected.ID, found.ID)
+			assert.JSONEq(t, `{"keys":["a","b"]}`, string(creds.Config))
+			assert.ElementsMatch(t, []string{first, second}, creds.Identifiers)
+		})
+
+		t.Run("case=create and update security answers", func(t *testing.T) {
+			expected := passwordIdentity("", x.NewUUID().String())
+			expected.SetSecurityAnswers([]RecoverySecurityAnswer{
+				{ID: x.NewUUID(), QuestionID: "first_pet", Answer: "hashed-pet"},
+				{ID: x.NewUUID(), QuestionID: "birth_city", Answer: "hashed-city"},
+			})
+			require.NoError(t, p.CreateIdentity(context.Background(), expected))
+			createdIDs = append(createdIDs, expected.ID)
+
+			actual, err := p.GetIdentityConfidential(context.Background(), expected.ID)
+			require.NoError(t, err)
+			require.Len(t, actual.RecoverySecurityAnswers, 2)
+			for _, answer := range actual.RecoverySecurityAnswers {
+				assert.Equal(t, expected.ID, answer.IdentityID)
+				assert.NotEmpty(t, answer.Answer)
+			}
+
+			actual.SetSecurityAnswers([]RecoverySecurityAnswer{{ID: x.NewUUID(), QuestionID: "first_pet", Answer: "hashed-other-pet"}})
+			require.NoError(t, p.UpdateIdentity(context.Background(), actual))
+
+			actual, err = p.GetIdentityConfidential(context.Background(), expected.ID)
+			require.NoError(t, err)
+			require.Len(t, actual.RecoverySecurityAnswers, 1)
+			assert.Equal(t, "first_pet", actual.RecoverySecurityAnswers[0].QuestionID)
+			assert.Equal(t, "hashed-other-pet", actual.RecoverySecurityAnswers[0].Answer)
+		})
+
 		t.Run("suite=verifiable-address", func(t *testing.T) {
 			createIdentityWithAddresses := func(t *testing.T, email string) VerifiableAddress {
 				var i Identity
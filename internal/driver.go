@@ -27,6 +27,7 @@ func resetConfig() {
 	viper.Set(configuration.ViperKeyHasherArgon2ConfigParallelism, 1)
 	viper.Set(configuration.ViperKeyHasherArgon2ConfigSaltLength, 2)
 	viper.Set(configuration.ViperKeyHasherArgon2ConfigKeyLength, 2)
+	viper.Set(configuration.ViperKeyHasherBcryptConfigCost, 4)
 }
 
 func NewConfigurationWithDefaults() *configuration.ViperProvider {
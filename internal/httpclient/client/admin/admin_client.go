@@ -47,8 +47,9 @@ type ClientService interface {
 /*
   CreateIdentity creates an identity
 
-  This endpoint creates an identity. It is NOT possible to set an identity's credentials (password, ...)
-using this method! A way to achieve that will be introduced in the future.
+  This endpoint creates an identity. Credentials may be imported alongside the identity, either with a
+cleartext password which is hashed on import, a password hash in one of the supported formats,
+or links to OpenID Connect providers.
 
 Learn how identities work in [ORY Kratos' User And Identity Model Documentation](https://www.ory.sh/docs/next/kratos/concepts/identity-user-model).
 */
@@ -17,6 +17,9 @@ import (
 // swagger:model CreateIdentity
 type CreateIdentity struct {
 
+	// credentials
+	Credentials *ImportCredentials `json:"credentials,omitempty"`
+
 	// SchemaID is the ID of the JSON Schema to be used for validating the identity's traits.
 	// Required: true
 	SchemaID *string `json:"schema_id"`
@@ -32,6 +35,10 @@ type CreateIdentity struct {
 func (m *CreateIdentity) Validate(formats strfmt.Registry) error {
 	var res []error
 
+	if err := m.validateCredentials(formats); err != nil {
+		res = append(res, err)
+	}
+
 	if err := m.validateSchemaID(formats); err != nil {
 		res = append(res, err)
 	}
@@ -46,6 +53,24 @@ func (m *CreateIdentity) Validate(formats strfmt.Registry) error {
 	return nil
 }
 
+func (m *CreateIdentity) validateCredentials(formats strfmt.Registry) error {
+
+	if swag.IsZero(m.Credentials) { // not required
+		return nil
+	}
+
+	if m.Credentials != nil {
+		if err := m.Credentials.Validate(formats); err != nil {
+			if ve, ok := err.(*errors.Validation); ok {
+				return ve.ValidateName("credentials")
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (m *CreateIdentity) validateSchemaID(formats strfmt.Registry) error {
 
 	if err := validate.Required("schema_id", "body", m.SchemaID); err != nil {
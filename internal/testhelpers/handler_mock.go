@@ -100,6 +100,7 @@ func MockSessionCreateHandlerWithIdentity(t *testing.T, reg mockDeps, i *identit
 	sess.IssuedAt = time.Now().UTC()
 	sess.ExpiresAt = time.Now().UTC().Add(time.Hour * 24)
 	sess.Active = true
+	sess.AAL = session.AuthenticatorAssuranceLevel1
 
 	if viper.GetString(configuration.ViperKeyDefaultIdentitySchemaURL) == "" {
 		viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/fake-session.schema.json")
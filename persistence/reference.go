@@ -15,7 +15,11 @@ import (
 	"github.com/zzpu/ums/selfservice/flow/registration"
 	"github.com/zzpu/ums/selfservice/flow/settings"
 	"github.com/zzpu/ums/selfservice/flow/verification"
+	"github.com/zzpu/ums/selfservice/mfa/questions"
+	"github.com/zzpu/ums/selfservice/strategy/code"
 	"github.com/zzpu/ums/selfservice/strategy/link"
+	"github.com/zzpu/ums/selfservice/strategy/oidc"
+	"github.com/zzpu/ums/selfservice/strategy/password"
 	"github.com/zzpu/ums/session"
 )
 
@@ -36,6 +40,12 @@ type Persister interface {
 	recovery.FlowPersister
 	link.RecoveryTokenPersister
 	link.VerificationTokenPersister
+	link.LoginTokenPersister
+	code.RecoveryCodePersister
+	code.VerificationCodePersister
+	questions.AttemptPersister
+	oidc.ProviderPersister
+	password.LoginFailurePersister
 
 	Close(context.Context) error
 	Ping(context.Context) error
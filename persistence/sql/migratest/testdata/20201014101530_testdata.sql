@@ -0,0 +1,4 @@
+INSERT INTO selfservice_login_flows (id, request_url, issued_at, expires_at, active_method, csrf_token, created_at, updated_at, forced, messages, type, identity_id)
+VALUES ('d6aa1f23-88c9-4b9b-a850-392f48c7f9e8', 'http://kratos:4433/self-service/login/browser', '2013-10-07 08:23:19', '2013-10-07 08:23:19', 'password', 'fpeVSZ9ZH7YvUkhXsOVEIssxbfauh5lcoQSYxTcN0XkMneg1L42h+HtvisjlNjBF4ElcD2jApCHoJYq2u9sVWg==', '2013-10-07 08:23:19', '2013-10-07 08:23:19', false, '[]', 'browser', 'a251ebc2-880c-4f76-a8f3-38e6940eab0e');
+INSERT INTO selfservice_login_flow_methods (id, method, selfservice_login_flow_id, config, created_at, updated_at)
+VALUES ('9c7a8f0c-4a0b-4ab6-a0a8-9d2a3e5e2bd5', 'totp', 'd6aa1f23-88c9-4b9b-a850-392f48c7f9e8', '{"action":"http://kratos:4433/self-service/login/methods/totp?flow=d6aa1f23-88c9-4b9b-a850-392f48c7f9e8","method":"POST","fields":[{"name":"totp_code","type":"text","required":true},{"name":"csrf_token","type":"hidden","required":true,"value":"fpeVSZ9ZH7YvUkhXsOVEIssxbfauh5lcoQSYxTcN0XkMneg1L42h+HtvisjlNjBF4ElcD2jApCHoJYq2u9sVWg=="}]}', '2013-10-07 08:23:19', '2013-10-07 08:23:19');
\ No newline at end of file
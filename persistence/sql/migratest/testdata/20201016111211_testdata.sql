@@ -0,0 +1,4 @@
+INSERT INTO identity_recovery_security_answers (id, question_id, answer, identity_id, created_at, updated_at)
+VALUES ('6e1d3a4b-2a8c-4c0e-9b4e-9c7d3b0f4a11', 'first_pet', '$argon2id$v=19$m=16,t=2,p=1$bmF1Z2h0eXNhbHQ$2o9XFn6DLrVnzVwTnkj0rA', 'a251ebc2-880c-4f76-a8f3-38e6940eab0e', '2013-10-07 08:23:19', '2013-10-07 08:23:19');
+INSERT INTO identity_recovery_security_attempts (id, identity_id, created_at, updated_at)
+VALUES ('0c1f5e9d-7b3a-4f2e-8d6c-5a4b3c2d1e0f', 'a251ebc2-880c-4f76-a8f3-38e6940eab0e', '2013-10-07 08:23:19', '2013-10-07 08:23:19');
@@ -0,0 +1,2 @@
+INSERT INTO identity_login_tokens (id, token, used, used_at, identity_verifiable_address_id, selfservice_login_flow_id, created_at, updated_at, expires_at, issued_at)
+VALUES ('a7c1e2d4-5b6f-4e8a-9c0d-1f2e3a4b5c6d', '1001ba7ddd644cb68478e8947e4jfhe', false, null, '45e867e9-2745-4f16-8dd4-84334a252b61', 'd6aa1f23-88c9-4b9b-a850-392f48c7f9e8', '2013-10-07 08:23:19', '2013-10-07 08:23:19', '2013-10-07 08:23:19', '2013-10-07 08:23:19');
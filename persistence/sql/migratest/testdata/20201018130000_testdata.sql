@@ -0,0 +1,5 @@
+INSERT INTO identity_recovery_codes (id, code, attempts, used, used_at, identity_recovery_address_id, selfservice_recovery_flow_id, created_at, updated_at, expires_at, issued_at)
+VALUES ('3f8a4c1e-7d2b-4e6f-9a0c-5b1d2e3f4a5b', '9f6d1c2e8a7b4c3d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c2d3e4f5a6b7c8d', 1, false, null, 'b8293f1c-010f-45d9-b809-f3fc5365ba80', '0d14427f-e16d-43a5-8695-8278bf85d4eb', '2013-10-07 08:23:19', '2013-10-07 08:23:19', '2013-10-07 08:23:19', '2013-10-07 08:23:19');
+
+INSERT INTO identity_verification_codes (id, code, attempts, used, used_at, identity_verifiable_address_id, selfservice_verification_flow_id, created_at, updated_at, expires_at, issued_at)
+VALUES ('6c2e9b4d-1a3f-4b8e-8d7c-2f4a6b8c0d1e', '2a4c6e8f0b1d3f5a7c9e1b3d5f7a9c1e3b5d7f9a1c3e5b7d9f1a3c5e7b9d1f3a', 0, false, null, '45e867e9-2745-4f16-8dd4-84334a252b61', '5385c962-0295-4575-9b1b-d7eef13c0eda', '2013-10-07 08:23:19', '2013-10-07 08:23:19', '2013-10-07 08:23:19', '2013-10-07 08:23:19');
@@ -0,0 +1,2 @@
+INSERT INTO sessions (id, issued_at, expires_at, authenticated_at, created_at, updated_at, token, identity_id, active, aal)
+VALUES ('7458af86-c1d8-401c-978a-8da89133f78b', '2013-10-07 08:23:19', '2013-10-07 08:23:19', '2013-10-07 08:23:19', '2013-10-07 08:23:19', '2013-10-07 08:23:19', 'b2a3ff2e9c4d4c7d9b1e3f6a8c0d2e4f', '5ff66179-c240-4703-b0d8-494592cefff5', true, 'aal2');
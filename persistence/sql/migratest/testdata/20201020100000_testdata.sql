@@ -0,0 +1,2 @@
+INSERT INTO selfservice_oidc_providers (id, provider_id, config, created_at, updated_at)
+VALUES ('9c1f3b6e-2d4a-4f8b-a7c5-3e1d9b2f6a40', 'customer-idp', '{"id":"customer-idp","provider":"generic","client_id":"client","client_secret":"","issuer_url":"https://idp.example.org","mapper_url":"file://stub/oidc.jsonnet"}', '2013-10-07 08:23:19', '2013-10-07 08:23:19');
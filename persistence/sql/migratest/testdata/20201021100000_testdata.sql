@@ -0,0 +1,2 @@
+INSERT INTO selfservice_login_failures (id, identifier, ip_address, created_at, updated_at)
+VALUES ('3b8e2f1c-6d4a-4e9b-8c7f-1a2b3c4d5e6f', 'c6a7d2e5b1f84e0c9a3d7b6f5e4c3b2a1d0e9f8a7b6c5d4e3f2a1b0c9d8e7f6a', '192.0.2.1', '2013-10-07 08:23:19', '2013-10-07 08:23:19');
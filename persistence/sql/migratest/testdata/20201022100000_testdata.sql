@@ -0,0 +1,2 @@
+INSERT INTO sessions (id, issued_at, expires_at, authenticated_at, created_at, updated_at, token, identity_id, active, aal, credentials_expired)
+VALUES ('3c0e5d4f-7a8b-4c9d-8e1f-2a3b4c5d6e7f', '2013-10-07 08:23:19', '2013-10-07 08:23:19', '2013-10-07 08:23:19', '2013-10-07 08:23:19', '2013-10-07 08:23:19', 'e4f5a6b7c8d94e0f8a1b2c3d4e5f6a7b', '5ff66179-c240-4703-b0d8-494592cefff5', true, 'aal1', true);
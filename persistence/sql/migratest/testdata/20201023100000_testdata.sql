@@ -0,0 +1,4 @@
+INSERT INTO selfservice_recovery_flows (id, request_url, issued_at, expires_at, messages, active_method, csrf_token, state, recovered_identity_id, created_at, updated_at, type, code_sends)
+VALUES ('7e2c9a4b-1f3d-4b8e-9c6a-5d4e3f2a1b0c', 'http://kratos:4433/self-service/browser/flows/recovery', '2013-10-07 08:23:19', '2013-10-07 08:23:19', '[]', 'code', 'vYYuhWXBfXKzBC+BlnbDmXfBKsUWY6SU/v04gHF9GYzPjFP51RXDPOc57R7Dpbf+XLkbPNAkmem33Crz/avdrw==', 'sent_email', NULL, '2013-10-07 08:23:19', '2013-10-07 08:23:19', 'api', 2);
+INSERT INTO selfservice_verification_flows (id, request_url, issued_at, expires_at, messages, active_method, csrf_token, state, created_at, updated_at, type, code_sends)
+VALUES ('8f3d0b5c-2a4e-4c9f-8d7b-6e5f4a3b2c1d', 'http://kratos:4433/self-service/browser/flows/verification', '2013-10-07 08:23:19', '2013-10-07 08:23:19', '[]', 'code', 'vYYuhWXBfXKzBC+BlnbDmXfBKsUWY6SU/v04gHF9GYzPjFP51RXDPOc57R7Dpbf+XLkbPNAkmem33Crz/avdrw==', 'sent_email', '2013-10-07 08:23:19', '2013-10-07 08:23:19', 'api', 2);
@@ -0,0 +1,2 @@
+ALTER TABLE "selfservice_login_flows" DROP CONSTRAINT "selfservice_login_flows_identity_id_fk";COMMIT TRANSACTION;BEGIN TRANSACTION;
+ALTER TABLE "selfservice_login_flows" DROP COLUMN "identity_id";COMMIT TRANSACTION;BEGIN TRANSACTION;
\ No newline at end of file
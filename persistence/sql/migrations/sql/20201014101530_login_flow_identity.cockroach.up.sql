@@ -0,0 +1,2 @@
+ALTER TABLE "selfservice_login_flows" ADD COLUMN "identity_id" UUID;COMMIT TRANSACTION;BEGIN TRANSACTION;
+ALTER TABLE "selfservice_login_flows" ADD CONSTRAINT "selfservice_login_flows_identity_id_fk" FOREIGN KEY ("identity_id") REFERENCES "identities" ("id") ON UPDATE NO ACTION ON DELETE CASCADE;COMMIT TRANSACTION;BEGIN TRANSACTION;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE `selfservice_login_flows` ADD COLUMN `identity_id` char(36);
+ALTER TABLE `selfservice_login_flows` ADD CONSTRAINT `selfservice_login_flows_identity_id_fk` FOREIGN KEY (`identity_id`) REFERENCES `identities` (`id`) ON DELETE CASCADE;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE "selfservice_login_flows" DROP CONSTRAINT "selfservice_login_flows_identity_id_fk";
+ALTER TABLE "selfservice_login_flows" DROP COLUMN "identity_id";
\ No newline at end of file
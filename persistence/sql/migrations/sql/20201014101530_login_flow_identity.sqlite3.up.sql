@@ -0,0 +1 @@
+ALTER TABLE "selfservice_login_flows" ADD COLUMN "identity_id" char(36) REFERENCES identities (id) ON UPDATE NO ACTION ON DELETE CASCADE;
\ No newline at end of file
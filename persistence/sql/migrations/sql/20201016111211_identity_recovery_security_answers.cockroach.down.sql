@@ -0,0 +1,2 @@
+DROP TABLE "identity_recovery_security_attempts";COMMIT TRANSACTION;BEGIN TRANSACTION;
+DROP TABLE "identity_recovery_security_answers";COMMIT TRANSACTION;BEGIN TRANSACTION;
\ No newline at end of file
@@ -0,0 +1,20 @@
+CREATE TABLE "identity_recovery_security_answers" (
+"id" UUID NOT NULL,
+PRIMARY KEY("id"),
+"question_id" VARCHAR (64) NOT NULL,
+"answer" VARCHAR (255) NOT NULL,
+"identity_id" UUID NOT NULL,
+"created_at" timestamp NOT NULL,
+"updated_at" timestamp NOT NULL,
+CONSTRAINT "identity_recovery_security_answers_identities_id_fk" FOREIGN KEY ("identity_id") REFERENCES "identities" ("id") ON DELETE cascade
+);COMMIT TRANSACTION;BEGIN TRANSACTION;
+CREATE UNIQUE INDEX "identity_recovery_security_answers_identity_question_uq_idx" ON "identity_recovery_security_answers" (identity_id, question_id);COMMIT TRANSACTION;BEGIN TRANSACTION;
+CREATE TABLE "identity_recovery_security_attempts" (
+"id" UUID NOT NULL,
+PRIMARY KEY("id"),
+"identity_id" UUID NOT NULL,
+"created_at" timestamp NOT NULL,
+"updated_at" timestamp NOT NULL,
+CONSTRAINT "identity_recovery_security_attempts_identities_id_fk" FOREIGN KEY ("identity_id") REFERENCES "identities" ("id") ON DELETE cascade
+);COMMIT TRANSACTION;BEGIN TRANSACTION;
+CREATE INDEX "identity_recovery_security_attempts_identity_id_idx" ON "identity_recovery_security_attempts" (identity_id);COMMIT TRANSACTION;BEGIN TRANSACTION;
@@ -0,0 +1,20 @@
+CREATE TABLE `identity_recovery_security_answers` (
+`id` char(36) NOT NULL,
+PRIMARY KEY(`id`),
+`question_id` VARCHAR (64) NOT NULL,
+`answer` VARCHAR (255) NOT NULL,
+`identity_id` char(36) NOT NULL,
+`created_at` DATETIME NOT NULL,
+`updated_at` DATETIME NOT NULL,
+FOREIGN KEY (`identity_id`) REFERENCES `identities` (`id`) ON DELETE cascade
+) ENGINE=InnoDB;
+CREATE UNIQUE INDEX `identity_recovery_security_answers_identity_question_uq_idx` ON `identity_recovery_security_answers` (`identity_id`, `question_id`);
+CREATE TABLE `identity_recovery_security_attempts` (
+`id` char(36) NOT NULL,
+PRIMARY KEY(`id`),
+`identity_id` char(36) NOT NULL,
+`created_at` DATETIME NOT NULL,
+`updated_at` DATETIME NOT NULL,
+FOREIGN KEY (`identity_id`) REFERENCES `identities` (`id`) ON DELETE cascade
+) ENGINE=InnoDB;
+CREATE INDEX `identity_recovery_security_attempts_identity_id_idx` ON `identity_recovery_security_attempts` (`identity_id`);
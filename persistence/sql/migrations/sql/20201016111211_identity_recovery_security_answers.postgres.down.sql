@@ -0,0 +1,2 @@
+DROP TABLE "identity_recovery_security_attempts";
+DROP TABLE "identity_recovery_security_answers";
\ No newline at end of file
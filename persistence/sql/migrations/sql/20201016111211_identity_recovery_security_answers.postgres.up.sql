@@ -0,0 +1,20 @@
+CREATE TABLE "identity_recovery_security_answers" (
+"id" UUID NOT NULL,
+PRIMARY KEY("id"),
+"question_id" VARCHAR (64) NOT NULL,
+"answer" VARCHAR (255) NOT NULL,
+"identity_id" UUID NOT NULL,
+"created_at" timestamp NOT NULL,
+"updated_at" timestamp NOT NULL,
+FOREIGN KEY ("identity_id") REFERENCES "identities" ("id") ON DELETE cascade
+);
+CREATE UNIQUE INDEX "identity_recovery_security_answers_identity_question_uq_idx" ON "identity_recovery_security_answers" (identity_id, question_id);
+CREATE TABLE "identity_recovery_security_attempts" (
+"id" UUID NOT NULL,
+PRIMARY KEY("id"),
+"identity_id" UUID NOT NULL,
+"created_at" timestamp NOT NULL,
+"updated_at" timestamp NOT NULL,
+FOREIGN KEY ("identity_id") REFERENCES "identities" ("id") ON DELETE cascade
+);
+CREATE INDEX "identity_recovery_security_attempts_identity_id_idx" ON "identity_recovery_security_attempts" (identity_id);
@@ -0,0 +1,18 @@
+CREATE TABLE "identity_recovery_security_answers" (
+"id" TEXT PRIMARY KEY,
+"question_id" TEXT NOT NULL,
+"answer" TEXT NOT NULL,
+"identity_id" char(36) NOT NULL,
+"created_at" DATETIME NOT NULL,
+"updated_at" DATETIME NOT NULL,
+FOREIGN KEY (identity_id) REFERENCES identities (id) ON DELETE cascade
+);
+CREATE UNIQUE INDEX "identity_recovery_security_answers_identity_question_uq_idx" ON "identity_recovery_security_answers" (identity_id, question_id);
+CREATE TABLE "identity_recovery_security_attempts" (
+"id" TEXT PRIMARY KEY,
+"identity_id" char(36) NOT NULL,
+"created_at" DATETIME NOT NULL,
+"updated_at" DATETIME NOT NULL,
+FOREIGN KEY (identity_id) REFERENCES identities (id) ON DELETE cascade
+);
+CREATE INDEX "identity_recovery_security_attempts_identity_id_idx" ON "identity_recovery_security_attempts" (identity_id);
@@ -0,0 +1 @@
+DROP TABLE "identity_login_tokens";COMMIT TRANSACTION;BEGIN TRANSACTION;
\ No newline at end of file
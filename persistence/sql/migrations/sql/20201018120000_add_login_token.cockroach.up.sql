@@ -0,0 +1,19 @@
+CREATE TABLE "identity_login_tokens" (
+"id" UUID NOT NULL,
+PRIMARY KEY("id"),
+"token" VARCHAR (64) NOT NULL,
+"used" bool NOT NULL DEFAULT 'false',
+"used_at" timestamp,
+"expires_at" timestamp NOT NULL,
+"issued_at" timestamp NOT NULL,
+"identity_verifiable_address_id" UUID NOT NULL,
+"selfservice_login_flow_id" UUID NOT NULL,
+"created_at" timestamp NOT NULL,
+"updated_at" timestamp NOT NULL,
+CONSTRAINT "identity_login_tokens_identity_verifiable_addresses_id_fk" FOREIGN KEY ("identity_verifiable_address_id") REFERENCES "identity_verifiable_addresses" ("id") ON DELETE cascade,
+CONSTRAINT "identity_login_tokens_selfservice_login_flows_id_fk" FOREIGN KEY ("selfservice_login_flow_id") REFERENCES "selfservice_login_flows" ("id") ON DELETE cascade
+);COMMIT TRANSACTION;BEGIN TRANSACTION;
+CREATE UNIQUE INDEX "identity_login_tokens_token_uq_idx" ON "identity_login_tokens" (token);COMMIT TRANSACTION;BEGIN TRANSACTION;
+CREATE INDEX "identity_login_tokens_token_idx" ON "identity_login_tokens" (token);COMMIT TRANSACTION;BEGIN TRANSACTION;
+CREATE INDEX "identity_login_tokens_verifiable_address_id_idx" ON "identity_login_tokens" (identity_verifiable_address_id);COMMIT TRANSACTION;BEGIN TRANSACTION;
+CREATE INDEX "identity_login_tokens_login_flow_id_idx" ON "identity_login_tokens" (selfservice_login_flow_id);COMMIT TRANSACTION;BEGIN TRANSACTION;
\ No newline at end of file
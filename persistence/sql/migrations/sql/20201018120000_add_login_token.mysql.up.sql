@@ -0,0 +1,19 @@
+CREATE TABLE `identity_login_tokens` (
+`id` char(36) NOT NULL,
+PRIMARY KEY(`id`),
+`token` VARCHAR (64) NOT NULL,
+`used` bool NOT NULL DEFAULT false,
+`used_at` DATETIME,
+`expires_at` DATETIME NOT NULL,
+`issued_at` DATETIME NOT NULL,
+`identity_verifiable_address_id` char(36) NOT NULL,
+`selfservice_login_flow_id` char(36) NOT NULL,
+`created_at` DATETIME NOT NULL,
+`updated_at` DATETIME NOT NULL,
+FOREIGN KEY (`identity_verifiable_address_id`) REFERENCES `identity_verifiable_addresses` (`id`) ON DELETE cascade,
+FOREIGN KEY (`selfservice_login_flow_id`) REFERENCES `selfservice_login_flows` (`id`) ON DELETE cascade
+) ENGINE=InnoDB;
+CREATE UNIQUE INDEX `identity_login_tokens_token_uq_idx` ON `identity_login_tokens` (`token`);
+CREATE INDEX `identity_login_tokens_token_idx` ON `identity_login_tokens` (`token`);
+CREATE INDEX `identity_login_tokens_verifiable_address_id_idx` ON `identity_login_tokens` (`identity_verifiable_address_id`);
+CREATE INDEX `identity_login_tokens_login_flow_id_idx` ON `identity_login_tokens` (`selfservice_login_flow_id`);
\ No newline at end of file
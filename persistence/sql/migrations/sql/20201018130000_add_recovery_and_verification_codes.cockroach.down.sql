@@ -0,0 +1,2 @@
+DROP TABLE "identity_recovery_codes";COMMIT TRANSACTION;BEGIN TRANSACTION;
+DROP TABLE "identity_verification_codes";COMMIT TRANSACTION;BEGIN TRANSACTION;
\ No newline at end of file
@@ -0,0 +1,36 @@
+CREATE TABLE `identity_recovery_codes` (
+`id` char(36) NOT NULL,
+PRIMARY KEY(`id`),
+`code` VARCHAR (64) NOT NULL,
+`attempts` int NOT NULL DEFAULT 0,
+`used` bool NOT NULL DEFAULT false,
+`used_at` DATETIME,
+`expires_at` DATETIME NOT NULL,
+`issued_at` DATETIME NOT NULL,
+`identity_recovery_address_id` char(36) NOT NULL,
+`selfservice_recovery_flow_id` char(36) NOT NULL,
+`created_at` DATETIME NOT NULL,
+`updated_at` DATETIME NOT NULL,
+FOREIGN KEY (`identity_recovery_address_id`) REFERENCES `identity_recovery_addresses` (`id`) ON DELETE cascade,
+FOREIGN KEY (`selfservice_recovery_flow_id`) REFERENCES `selfservice_recovery_flows` (`id`) ON DELETE cascade
+) ENGINE=InnoDB;
+CREATE INDEX `identity_recovery_codes_recovery_address_id_idx` ON `identity_recovery_codes` (`identity_recovery_address_id`);
+CREATE INDEX `identity_recovery_codes_recovery_flow_id_idx` ON `identity_recovery_codes` (`selfservice_recovery_flow_id`);
+CREATE TABLE `identity_verification_codes` (
+`id` char(36) NOT NULL,
+PRIMARY KEY(`id`),
+`code` VARCHAR (64) NOT NULL,
+`attempts` int NOT NULL DEFAULT 0,
+`used` bool NOT NULL DEFAULT false,
+`used_at` DATETIME,
+`expires_at` DATETIME NOT NULL,
+`issued_at` DATETIME NOT NULL,
+`identity_verifiable_address_id` char(36) NOT NULL,
+`selfservice_verification_flow_id` char(36) NOT NULL,
+`created_at` DATETIME NOT NULL,
+`updated_at` DATETIME NOT NULL,
+FOREIGN KEY (`identity_verifiable_address_id`) REFERENCES `identity_verifiable_addresses` (`id`) ON DELETE cascade,
+FOREIGN KEY (`selfservice_verification_flow_id`) REFERENCES `selfservice_verification_flows` (`id`) ON DELETE cascade
+) ENGINE=InnoDB;
+CREATE INDEX `identity_verification_codes_verifiable_address_id_idx` ON `identity_verification_codes` (`identity_verifiable_address_id`);
+CREATE INDEX `identity_verification_codes_verification_flow_id_idx` ON `identity_verification_codes` (`selfservice_verification_flow_id`);
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE "identity_recovery_codes";
+DROP TABLE "identity_verification_codes";
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE "selfservice_login_flows" DROP COLUMN "requested_aal";COMMIT TRANSACTION;BEGIN TRANSACTION;
+ALTER TABLE "sessions" DROP COLUMN "aal";COMMIT TRANSACTION;BEGIN TRANSACTION;
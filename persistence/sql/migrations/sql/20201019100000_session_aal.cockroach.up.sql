@@ -0,0 +1,2 @@
+ALTER TABLE "sessions" ADD COLUMN "aal" VARCHAR (4) NOT NULL DEFAULT 'aal1';COMMIT TRANSACTION;BEGIN TRANSACTION;
+ALTER TABLE "selfservice_login_flows" ADD COLUMN "requested_aal" VARCHAR (4) NOT NULL DEFAULT 'aal1';COMMIT TRANSACTION;BEGIN TRANSACTION;
@@ -0,0 +1,9 @@
+CREATE TABLE "selfservice_oidc_providers" (
+"id" UUID NOT NULL,
+PRIMARY KEY("id"),
+"provider_id" VARCHAR (255) NOT NULL,
+"config" json NOT NULL,
+"created_at" timestamp NOT NULL,
+"updated_at" timestamp NOT NULL
+);COMMIT TRANSACTION;BEGIN TRANSACTION;
+CREATE UNIQUE INDEX "selfservice_oidc_providers_provider_id_idx" ON "selfservice_oidc_providers" (provider_id);COMMIT TRANSACTION;BEGIN TRANSACTION;
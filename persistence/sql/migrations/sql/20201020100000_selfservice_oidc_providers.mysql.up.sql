@@ -0,0 +1,9 @@
+CREATE TABLE `selfservice_oidc_providers` (
+`id` char(36) NOT NULL,
+PRIMARY KEY(`id`),
+`provider_id` VARCHAR (255) NOT NULL,
+`config` JSON NOT NULL,
+`created_at` DATETIME NOT NULL,
+`updated_at` DATETIME NOT NULL
+) ENGINE=InnoDB;
+CREATE UNIQUE INDEX `selfservice_oidc_providers_provider_id_idx` ON `selfservice_oidc_providers` (`provider_id`);
@@ -0,0 +1,8 @@
+CREATE TABLE "selfservice_oidc_providers" (
+"id" TEXT PRIMARY KEY,
+"provider_id" TEXT NOT NULL,
+"config" TEXT NOT NULL,
+"created_at" DATETIME NOT NULL,
+"updated_at" DATETIME NOT NULL
+);
+CREATE UNIQUE INDEX "selfservice_oidc_providers_provider_id_idx" ON "selfservice_oidc_providers" (provider_id);
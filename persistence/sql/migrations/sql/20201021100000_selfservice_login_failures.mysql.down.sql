@@ -0,0 +1 @@
+DROP TABLE `selfservice_login_failures`;
@@ -0,0 +1,10 @@
+CREATE TABLE `selfservice_login_failures` (
+`id` char(36) NOT NULL,
+PRIMARY KEY(`id`),
+`identifier` VARCHAR (64) NOT NULL,
+`ip_address` VARCHAR (64) NOT NULL,
+`created_at` DATETIME NOT NULL,
+`updated_at` DATETIME NOT NULL
+) ENGINE=InnoDB;
+CREATE INDEX `selfservice_login_failures_identifier_idx` ON `selfservice_login_failures` (`identifier`, `created_at`);
+CREATE INDEX `selfservice_login_failures_ip_address_idx` ON `selfservice_login_failures` (`ip_address`, `created_at`);
@@ -0,0 +1,9 @@
+CREATE TABLE "selfservice_login_failures" (
+"id" TEXT PRIMARY KEY,
+"identifier" TEXT NOT NULL,
+"ip_address" TEXT NOT NULL,
+"created_at" DATETIME NOT NULL,
+"updated_at" DATETIME NOT NULL
+);
+CREATE INDEX "selfservice_login_failures_identifier_idx" ON "selfservice_login_failures" (identifier, created_at);
+CREATE INDEX "selfservice_login_failures_ip_address_idx" ON "selfservice_login_failures" (ip_address, created_at);
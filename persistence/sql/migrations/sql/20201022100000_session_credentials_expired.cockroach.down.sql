@@ -0,0 +1 @@
+ALTER TABLE "sessions" DROP COLUMN "credentials_expired";COMMIT TRANSACTION;BEGIN TRANSACTION;
@@ -0,0 +1 @@
+ALTER TABLE "sessions" ADD COLUMN "credentials_expired" bool NOT NULL DEFAULT false;COMMIT TRANSACTION;BEGIN TRANSACTION;
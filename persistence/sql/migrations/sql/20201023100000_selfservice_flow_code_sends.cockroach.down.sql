@@ -0,0 +1,2 @@
+ALTER TABLE "selfservice_recovery_flows" DROP COLUMN "code_sends";COMMIT TRANSACTION;BEGIN TRANSACTION;
+ALTER TABLE "selfservice_verification_flows" DROP COLUMN "code_sends";COMMIT TRANSACTION;BEGIN TRANSACTION;
@@ -0,0 +1,2 @@
+ALTER TABLE "selfservice_recovery_flows" ADD COLUMN "code_sends" int NOT NULL DEFAULT 0;COMMIT TRANSACTION;BEGIN TRANSACTION;
+ALTER TABLE "selfservice_verification_flows" ADD COLUMN "code_sends" int NOT NULL DEFAULT 0;COMMIT TRANSACTION;BEGIN TRANSACTION;
@@ -0,0 +1,2 @@
+ALTER TABLE "selfservice_recovery_flows" DROP COLUMN "code_sends";
+ALTER TABLE "selfservice_verification_flows" DROP COLUMN "code_sends";
@@ -3,7 +3,9 @@ package sql
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
 	"time"
 
@@ -98,41 +100,48 @@ func findOrCreateIdentityCredentialsType(_ context.Context, tx *pop.Connection,
 func createIdentityCredentials(ctx context.Context, tx *pop.Connection, i *identity.Identity) error {
 	for k := range i.Credentials {
 		cred := i.Credentials[k]
-		cred.IdentityID = i.ID
-		if len(cred.Config) == 0 {
-			cred.Config = sqlxx.JSONRawMessage("{}")
-		}
-
-		ct, err := findOrCreateIdentityCredentialsType(ctx, tx, cred.Type)
-		if err != nil {
+		if err := createCredentials(ctx, tx, i.ID, &cred); err != nil {
 			return err
 		}
+		i.Credentials[k] = cred
+	}
 
-		cred.CredentialTypeID = ct.ID
-		if err := tx.Create(&cred); err != nil {
-			return sqlcon.HandleError(err)
-		}
+	return nil
+}
 
-		for _, ids := range cred.Identifiers {
-			// Force case-insensitivity for email addresses
-			if strings.Contains(ids, "@") && cred.Type == identity.CredentialsTypePassword {
-				ids = strings.ToLower(ids)
-			}
+func createCredentials(ctx context.Context, tx *pop.Connection, identityID uuid.UUID, cred *identity.Credentials) error {
+	cred.IdentityID = identityID
+	if len(cred.Config) == 0 {
+		cred.Config = sqlxx.JSONRawMessage("{}")
+	}
 
-			if len(ids) == 0 {
-				return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to create identity credentials with missing or empty identifier."))
-			}
+	ct, err := findOrCreateIdentityCredentialsType(ctx, tx, cred.Type)
+	if err != nil {
+		return err
+	}
 
-			ci := &identity.CredentialIdentifier{
-				Identifier:            ids,
-				IdentityCredentialsID: cred.ID,
-			}
-			if err := tx.Create(ci); err != nil {
-				return sqlcon.HandleError(err)
-			}
+	cred.CredentialTypeID = ct.ID
+	if err := tx.Create(cred); err != nil {
+		return sqlcon.HandleError(err)
+	}
+
+	for _, ids := range cred.Identifiers {
+		// Force case-insensitivity for email addresses
+		if strings.Contains(ids, "@") && cred.Type == identity.CredentialsTypePassword {
+			ids = strings.ToLower(ids)
 		}
 
-		i.Credentials[k] = cred
+		if len(ids) == 0 {
+			return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to create identity credentials with missing or empty identifier."))
+		}
+
+		ci := &identity.CredentialIdentifier{
+			Identifier:            ids,
+			IdentityCredentialsID: cred.ID,
+		}
+		if err := tx.Create(ci); err != nil {
+			return sqlcon.HandleError(err)
+		}
 	}
 
 	return nil
@@ -158,6 +167,16 @@ func createRecoveryAddresses(ctx context.Context, tx *pop.Connection, i *identit
 	return nil
 }
 
+func createRecoverySecurityAnswers(ctx context.Context, tx *pop.Connection, i *identity.Identity) error {
+	for k := range i.RecoverySecurityAnswers {
+		i.RecoverySecurityAnswers[k].IdentityID = i.ID
+		if err := tx.Create(&i.RecoverySecurityAnswers[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (p *Persister) CountIdentities(ctx context.Context) (int64, error) {
 	count, err := p.c.WithContext(ctx).Count(new(identity.Identity))
 	if err != nil {
@@ -196,6 +215,10 @@ func (p *Persister) CreateIdentity(ctx context.Context, i *identity.Identity) er
 			return sqlcon.HandleError(err)
 		}
 
+		if err := createRecoverySecurityAnswers(ctx, tx, i); err != nil {
+			return sqlcon.HandleError(err)
+		}
+
 		return createIdentityCredentials(ctx, tx, i)
 	})
 }
@@ -235,6 +258,7 @@ func (p *Persister) UpdateIdentity(ctx context.Context, i *identity.Identity) er
 			new(identity.Credentials).TableName(),
 			new(identity.VerifiableAddress).TableName(),
 			new(identity.RecoveryAddress).TableName(),
+			new(identity.RecoverySecurityAnswer).TableName(),
 		} {
 			/* #nosec G201 TableName is static */
 			if err := tx.RawQuery(fmt.Sprintf(
@@ -255,10 +279,123 @@ func (p *Persister) UpdateIdentity(ctx context.Context, i *identity.Identity) er
 			return err
 		}
 
+		if err := createRecoverySecurityAnswers(ctx, tx, i); err != nil {
+			return err
+		}
+
 		return createIdentityCredentials(ctx, tx, i)
 	}))
 }
 
+func (p *Persister) UpdateIdentityCredentialsConfig(ctx context.Context, c *identity.Credentials, config sqlxx.JSONRawMessage) error {
+	return sqlcon.HandleError(p.Transaction(ctx, func(ctx context.Context, tx *pop.Connection) error {
+		var current identity.Credentials
+
+		// The row is locked so that concurrent updates wait for this transaction. SQLite does not support row locks,
+		// but a write locks the whole database.
+		lock := " FOR UPDATE"
+		if p.isSQLite {
+			lock = ""
+			/* #nosec G201 TableName is static */
+			if err := tx.RawQuery(fmt.Sprintf("UPDATE %s SET updated_at = updated_at WHERE id = ?", current.TableName()), c.ID).Exec(); err != nil {
+				return err
+			}
+		}
+
+		/* #nosec G201 TableName is static */
+		if err := tx.RawQuery(fmt.Sprintf("SELECT * FROM %s WHERE id = ?%s", current.TableName(), lock), c.ID).First(&current); err != nil {
+			return err
+		}
+
+		if equal, err := jsonEqual(current.Config, c.Config); err != nil {
+			return err
+		} else if !equal {
+			return sqlcon.ErrNoRows
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		/* #nosec G201 TableName is static */
+		count, err := tx.RawQuery(fmt.Sprintf("UPDATE %s SET config = ?, updated_at = ? WHERE id = ? AND updated_at = ?", current.TableName()),
+			config, now, current.ID, current.UpdatedAt).ExecWithCount()
+		if err != nil {
+			return err
+		} else if count == 0 {
+			return sqlcon.ErrNoRows
+		}
+
+		c.Config = config
+		c.UpdatedAt = now
+		return nil
+	}))
+}
+
+func (p *Persister) UpdateIdentityCredentials(ctx context.Context, identityID uuid.UUID, expected *identity.Credentials, c *identity.Credentials) error {
+	return sqlcon.HandleError(p.Transaction(ctx, func(ctx context.Context, tx *pop.Connection) error {
+		// The identity is locked so that concurrent updates wait for this transaction, even if the credentials do not
+		// exist yet. SQLite does not support row locks, but a write locks the whole database.
+		lock := " FOR UPDATE"
+		if p.isSQLite {
+			lock = ""
+			/* #nosec G201 TableName is static */
+			if err := tx.RawQuery(fmt.Sprintf("UPDATE %s SET updated_at = updated_at WHERE id = ?", new(identity.Identity).TableName()), identityID).Exec(); err != nil {
+				return err
+			}
+		}
+
+		var i identity.Identity
+		/* #nosec G201 TableName is static */
+		if err := tx.RawQuery(fmt.Sprintf("SELECT * FROM %s WHERE id = ?%s", i.TableName(), lock), identityID).First(&i); err != nil {
+			return err
+		}
+
+		ct, err := findOrCreateIdentityCredentialsType(ctx, tx, c.Type)
+		if err != nil {
+			return err
+		}
+
+		var current []identity.Credentials
+		if err := tx.Where("identity_id = ? AND identity_credential_type_id = ?", identityID, ct.ID).All(&current); err != nil {
+			return err
+		}
+
+		if expected == nil {
+			if len(current) > 0 {
+				return sqlcon.ErrNoRows
+			}
+		} else {
+			if len(current) != 1 || current[0].ID != expected.ID {
+				return sqlcon.ErrNoRows
+			}
+
+			if equal, err := jsonEqual(current[0].Config, expected.Config); err != nil {
+				return err
+			} else if !equal {
+				return sqlcon.ErrNoRows
+			}
+
+			// The identifiers are removed together with the credentials.
+			/* #nosec G201 TableName is static */
+			if err := tx.RawQuery(fmt.Sprintf("DELETE FROM %s WHERE id = ?", current[0].TableName()), current[0].ID).Exec(); err != nil {
+				return err
+			}
+		}
+
+		c.ID = uuid.Nil
+		return createCredentials(ctx, tx, identityID, c)
+	}))
+}
+
+func jsonEqual(a, b []byte) (bool, error) {
+	var av, bv interface{}
+	if err := json.Unmarshal(a, &av); err != nil {
+		return false, errors.WithStack(err)
+	}
+	if err := json.Unmarshal(b, &bv); err != nil {
+		return false, errors.WithStack(err)
+	}
+	return reflect.DeepEqual(av, bv), nil
+}
+
 func (p *Persister) DeleteIdentity(ctx context.Context, id uuid.UUID) error {
 	/* #nosec G201 TableName is static */
 	count, err := p.GetConnection(ctx).RawQuery(fmt.Sprintf("DELETE FROM %s WHERE id = ?", new(identity.Identity).TableName()), id).ExecWithCount()
@@ -302,14 +439,16 @@ func (p *Persister) GetIdentityConfidential(ctx context.Context, id uuid.UUID) (
 			return nil, sqlcon.HandleError(err)
 		}
 
+		// The type must be resolved independently of the identifiers as some credentials do not have any.
+		for _, ct := range cts {
+			if ct.ID == creds.CredentialTypeID {
+				creds.Type = ct.Name
+			}
+		}
+
 		creds.CredentialIdentifierCollection = nil
 		creds.Identifiers = make([]string, len(cs))
 		for k := range cs {
-			for _, ct := range cts {
-				if ct.ID == creds.CredentialTypeID {
-					creds.Type = ct.Name
-				}
-			}
 			creds.Identifiers[k] = cs[k].Identifier
 		}
 		i.Credentials[creds.Type] = creds
@@ -2,6 +2,10 @@ package sql
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/gobuffalo/pop/v5"
 
@@ -11,6 +15,7 @@ import (
 
 	"github.com/zzpu/ums/identity"
 	"github.com/zzpu/ums/selfservice/flow/login"
+	"github.com/zzpu/ums/selfservice/strategy/link"
 )
 
 var _ login.FlowPersister = new(Persister)
@@ -97,3 +102,95 @@ func (p *Persister) UpdateLoginFlowMethod(ctx context.Context, id uuid.UUID, ct
 		return tx.Save(rr)
 	})
 }
+
+func (p *Persister) UpdateLoginFlowMethodConfig(ctx context.Context, method *login.FlowMethod, config *login.FlowMethodConfig) error {
+	expected, err := json.Marshal(method.Config)
+	if err != nil {
+		return err
+	}
+
+	return sqlcon.HandleError(p.Transaction(ctx, func(ctx context.Context, tx *pop.Connection) error {
+		var current login.FlowMethod
+
+		// The row is locked so that concurrent updates wait for this transaction. SQLite does not support row locks,
+		// but a write locks the whole database.
+		lock := " FOR UPDATE"
+		if p.isSQLite {
+			lock = ""
+			/* #nosec G201 TableName is static */
+			if err := tx.RawQuery(fmt.Sprintf("UPDATE %s SET updated_at = updated_at WHERE id = ?", current.TableName()), method.ID).Exec(); err != nil {
+				return err
+			}
+		}
+
+		/* #nosec G201 TableName is static */
+		if err := tx.RawQuery(fmt.Sprintf("SELECT * FROM %s WHERE id = ?%s", current.TableName(), lock), method.ID).First(&current); err != nil {
+			return err
+		}
+
+		actual, err := json.Marshal(current.Config)
+		if err != nil {
+			return err
+		}
+
+		if equal, err := jsonEqual(actual, expected); err != nil {
+			return err
+		} else if !equal {
+			return sqlcon.ErrNoRows
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		/* #nosec G201 TableName is static */
+		if err := tx.RawQuery(fmt.Sprintf("UPDATE %s SET config = ?, updated_at = ? WHERE id = ?", current.TableName()),
+			config, now, current.ID).Exec(); err != nil {
+			return err
+		}
+
+		method.Config = config
+		method.UpdatedAt = now
+		return nil
+	}))
+}
+
+func (p *Persister) CreateLoginToken(ctx context.Context, token *link.LoginToken) error {
+	t := token.Token
+	token.Token = p.hmacValue(t)
+
+	// This should not create the request eagerly because otherwise we might accidentally create an address that isn't
+	// supposed to be in the database.
+	if err := p.GetConnection(ctx).Create(token); err != nil {
+		return err
+	}
+	token.Token = t
+	return nil
+}
+
+func (p *Persister) UseLoginToken(ctx context.Context, token string) (*link.LoginToken, error) {
+	var err error
+	rt := new(link.LoginToken)
+	if err = sqlcon.HandleError(p.Transaction(ctx, func(ctx context.Context, tx *pop.Connection) (err error) {
+		for _, secret := range p.cf.SecretsSession() {
+			if err = tx.Eager().Where("token = ? AND NOT used", p.hmacValueWithSecret(token, secret)).First(rt); err != nil {
+				if !errors.Is(sqlcon.HandleError(err), sqlcon.ErrNoRows) {
+					return err
+				}
+			} else {
+				break
+			}
+		}
+		if err != nil {
+			return err
+		}
+		/* #nosec G201 TableName is static */
+		return tx.RawQuery(fmt.Sprintf("UPDATE %s SET used=true, used_at=? WHERE id=?", rt.TableName()), time.Now().UTC(), rt.ID).Exec()
+	})); err != nil {
+		return nil, err
+	}
+
+	return rt, nil
+}
+
+func (p *Persister) DeleteLoginToken(ctx context.Context, token string) error {
+	/* #nosec G201 TableName is static */
+	return p.GetConnection(ctx).RawQuery(fmt.Sprintf("DELETE FROM %s WHERE token=?", new(link.LoginToken).TableName()), token).Exec()
+}
@@ -0,0 +1,61 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gobuffalo/pop/v5"
+
+	"github.com/ory/x/sqlcon"
+
+	"github.com/zzpu/ums/selfservice/strategy/oidc"
+	"github.com/zzpu/ums/x"
+)
+
+var _ oidc.ProviderPersister = new(Persister)
+
+func (p *Persister) CreateOIDCProvider(ctx context.Context, provider *oidc.StoredProvider) error {
+	provider.ID = x.NewUUID()
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(provider))
+}
+
+func (p *Persister) GetOIDCProvider(ctx context.Context, id string) (*oidc.StoredProvider, error) {
+	var provider oidc.StoredProvider
+	if err := p.GetConnection(ctx).Where("provider_id = ?", id).First(&provider); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return &provider, nil
+}
+
+func (p *Persister) ListOIDCProviders(ctx context.Context) ([]oidc.StoredProvider, error) {
+	var providers []oidc.StoredProvider
+	if err := p.GetConnection(ctx).Order("provider_id ASC").All(&providers); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return providers, nil
+}
+
+func (p *Persister) UpdateOIDCProvider(ctx context.Context, provider *oidc.StoredProvider) error {
+	return p.Transaction(ctx, func(ctx context.Context, tx *pop.Connection) error {
+		existing, err := p.GetOIDCProvider(ctx, provider.ProviderID)
+		if err != nil {
+			return err
+		}
+
+		provider.ID = existing.ID
+		provider.CreatedAt = existing.CreatedAt
+		return sqlcon.HandleError(tx.Update(provider))
+	})
+}
+
+func (p *Persister) DeleteOIDCProvider(ctx context.Context, id string) error {
+	/* #nosec G201 TableName is static */
+	count, err := p.GetConnection(ctx).RawQuery(fmt.Sprintf("DELETE FROM %s WHERE provider_id = ?", new(oidc.StoredProvider).TableName()), id).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	}
+	if count == 0 {
+		return sqlcon.ErrNoRows
+	}
+	return nil
+}
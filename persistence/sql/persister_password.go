@@ -0,0 +1,78 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/ory/x/sqlcon"
+
+	"github.com/zzpu/ums/selfservice/strategy/password"
+	"github.com/zzpu/ums/x"
+)
+
+var _ password.LoginFailurePersister = new(Persister)
+
+func (p *Persister) CreateLoginFailure(ctx context.Context, failure *password.LoginFailure) error {
+	if failure.ID == uuid.Nil {
+		failure.ID = x.NewUUID()
+	}
+
+	identifier := failure.Identifier
+	failure.Identifier = p.hmacValue(normalizeLoginIdentifier(identifier))
+	if err := p.GetConnection(ctx).Create(failure); err != nil {
+		return sqlcon.HandleError(err)
+	}
+	failure.Identifier = identifier
+	return nil
+}
+
+// normalizeLoginIdentifier makes sure that failures are counted for the identifier no matter how its letters
+// are cased or whether it is surrounded by whitespace.
+func normalizeLoginIdentifier(identifier string) string {
+	return strings.ToLower(strings.TrimSpace(identifier))
+}
+
+// hmacIdentifiers returns the keyed hashes of the identifier for every secret, so that failures which were
+// recorded before the secrets were rotated are found too.
+func (p *Persister) hmacIdentifiers(identifier string) []interface{} {
+	identifier = normalizeLoginIdentifier(identifier)
+	var hashes []interface{}
+	for _, secret := range p.cf.SecretsSession() {
+		hashes = append(hashes, p.hmacValueWithSecret(identifier, secret))
+	}
+	return hashes
+}
+
+func (p *Persister) ListLoginFailuresByIdentifier(ctx context.Context, identifier string, since time.Time) ([]password.LoginFailure, error) {
+	var failures []password.LoginFailure
+	if err := p.GetConnection(ctx).
+		Where("created_at > ?", since).
+		Where("identifier IN (?)", p.hmacIdentifiers(identifier)...).
+		Order("created_at ASC").
+		All(&failures); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return failures, nil
+}
+
+func (p *Persister) ListLoginFailuresByIPAddress(ctx context.Context, ipAddress string, since time.Time) ([]password.LoginFailure, error) {
+	var failures []password.LoginFailure
+	if err := p.GetConnection(ctx).
+		Where("ip_address = ? AND created_at > ?", ipAddress, since).
+		Order("created_at ASC").
+		All(&failures); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return failures, nil
+}
+
+func (p *Persister) DeleteLoginFailuresByIdentifier(ctx context.Context, identifier string) error {
+	hashes := p.hmacIdentifiers(identifier)
+	/* #nosec G201 TableName is static */
+	return sqlcon.HandleError(p.GetConnection(ctx).RawQuery(fmt.Sprintf("DELETE FROM %s WHERE identifier IN (?%s)",
+		new(password.LoginFailure).TableName(), strings.Repeat(", ?", len(hashes)-1)), hashes...).Exec())
+}
@@ -0,0 +1,39 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/ory/x/sqlcon"
+
+	"github.com/zzpu/ums/selfservice/mfa/questions"
+	"github.com/zzpu/ums/x"
+)
+
+var _ questions.AttemptPersister = new(Persister)
+
+func (p *Persister) CreateRecoverySecurityAttempt(ctx context.Context, attempt *questions.RecoverySecurityAttempt) error {
+	if attempt.ID == uuid.Nil {
+		attempt.ID = x.NewUUID()
+	}
+	return sqlcon.HandleError(p.GetConnection(ctx).Create(attempt))
+}
+
+func (p *Persister) ListRecoverySecurityAttempts(ctx context.Context, identityID uuid.UUID, since time.Time) ([]questions.RecoverySecurityAttempt, error) {
+	var attempts []questions.RecoverySecurityAttempt
+	if err := p.GetConnection(ctx).
+		Where("identity_id = ? AND created_at > ?", identityID, since).
+		Order("created_at ASC").
+		All(&attempts); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+	return attempts, nil
+}
+
+func (p *Persister) DeleteRecoverySecurityAttempts(ctx context.Context, identityID uuid.UUID) error {
+	/* #nosec G201 TableName is static */
+	return sqlcon.HandleError(p.GetConnection(ctx).RawQuery(fmt.Sprintf("DELETE FROM %s WHERE identity_id=?", new(questions.RecoverySecurityAttempt).TableName()), identityID).Exec())
+}
@@ -12,11 +12,13 @@ import (
 	"github.com/ory/x/sqlcon"
 
 	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/selfservice/strategy/code"
 	"github.com/zzpu/ums/selfservice/strategy/link"
 )
 
 var _ recovery.FlowPersister = new(Persister)
 var _ link.RecoveryTokenPersister = new(Persister)
+var _ code.RecoveryCodePersister = new(Persister)
 
 func (p Persister) CreateRecoveryFlow(ctx context.Context, r *recovery.Flow) error {
 	return p.GetConnection(ctx).Eager("MethodsRaw").Create(r)
@@ -104,3 +106,77 @@ func (p *Persister) DeleteRecoveryToken(ctx context.Context, token string) error
 	/* #nosec G201 TableName is static */
 	return p.GetConnection(ctx).RawQuery(fmt.Sprintf("DELETE FROM %s WHERE token=?", new(link.RecoveryToken).TableName()), token).Exec()
 }
+
+func (p *Persister) CreateRecoveryCode(ctx context.Context, rc *code.RecoveryCode) error {
+	c := rc.Code
+	rc.Code = p.hmacValue(c)
+
+	if err := p.Transaction(ctx, func(ctx context.Context, tx *pop.Connection) error {
+		// Codes which were sent earlier must not become usable again once the latest code is used up.
+		/* #nosec G201 TableName is static */
+		if err := tx.RawQuery(fmt.Sprintf("UPDATE %s SET used=true, used_at=? WHERE selfservice_recovery_flow_id=? AND NOT used", rc.TableName()), time.Now().UTC(), rc.FlowID).Exec(); err != nil {
+			return err
+		}
+
+		// This should not create the request eagerly because otherwise we might accidentally create an address that isn't
+		// supposed to be in the database.
+		return tx.Create(rc)
+	}); err != nil {
+		return err
+	}
+	rc.Code = c
+	return nil
+}
+
+func (p *Persister) CountRecoveryCodeSend(ctx context.Context, flowID uuid.UUID, maxSends int) error {
+	// The counter is only updated here and not mapped to the flow, which is why updating the flow can not reset it.
+	/* #nosec G201 TableName is static */
+	count, err := p.GetConnection(ctx).RawQuery(fmt.Sprintf("UPDATE %s SET code_sends=code_sends+1 WHERE id=? AND code_sends<?", new(recovery.Flow).TableName()), flowID, maxSends).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	} else if count == 0 {
+		return code.ErrCodeSendsExceeded
+	}
+	return nil
+}
+
+func (p *Persister) UseRecoveryCode(ctx context.Context, flowID uuid.UUID, value string, maxAttempts int) (*code.RecoveryCode, error) {
+	var valid, exceeded bool
+	rc := new(code.RecoveryCode)
+	if err := sqlcon.HandleError(p.Transaction(ctx, func(ctx context.Context, tx *pop.Connection) error {
+		if err := tx.Eager().Where("selfservice_recovery_flow_id = ? AND NOT used", flowID).Order("created_at DESC").First(rc); err != nil {
+			return err
+		}
+
+		// The attempt is counted by incrementing the column in the database, which also locks the row until the
+		// transaction ends. Concurrent requests therefore can not use the same attempt or the same code twice.
+		/* #nosec G201 TableName is static */
+		if count, err := tx.RawQuery(fmt.Sprintf("UPDATE %s SET attempts=attempts+1 WHERE id=? AND NOT used AND attempts<?", rc.TableName()), rc.ID, maxAttempts).ExecWithCount(); err != nil {
+			return err
+		} else if count == 0 {
+			return sqlcon.ErrNoRows
+		}
+
+		// The attempt is recorded even if the code is wrong, which is why this transaction must not fail afterwards.
+		valid = p.hmacConstantCompare(value, rc.Code)
+		if valid {
+			/* #nosec G201 TableName is static */
+			return tx.RawQuery(fmt.Sprintf("UPDATE %s SET used=true, used_at=? WHERE id=?", rc.TableName()), time.Now().UTC(), rc.ID).Exec()
+		}
+
+		/* #nosec G201 TableName is static */
+		count, err := tx.RawQuery(fmt.Sprintf("UPDATE %s SET used=true, used_at=? WHERE id=? AND attempts>=?", rc.TableName()), time.Now().UTC(), rc.ID, maxAttempts).ExecWithCount()
+		exceeded = count > 0
+		return err
+	})); err != nil {
+		return nil, err
+	}
+
+	if valid {
+		return rc, nil
+	} else if exceeded {
+		return nil, code.ErrCodeAttemptsExceeded
+	}
+
+	return nil, sqlcon.ErrNoRows
+}
@@ -32,6 +32,10 @@ func (p *Persister) CreateSession(ctx context.Context, s *session.Session) error
 	return p.GetConnection(ctx).Create(s) // This must not be eager or identities will be created / updated
 }
 
+func (p *Persister) UpdateSession(ctx context.Context, s *session.Session) error {
+	return sqlcon.HandleError(p.GetConnection(ctx).Update(s)) // This must not be eager or identities will be created / updated
+}
+
 func (p *Persister) DeleteSession(ctx context.Context, sid uuid.UUID) error {
 	return p.GetConnection(ctx).Destroy(&session.Session{ID: sid}) // This must not be eager or identities will be created / updated
 }
@@ -72,3 +76,58 @@ func (p *Persister) RevokeSessionByToken(ctx context.Context, token string) erro
 	}
 	return nil
 }
+
+func (p *Persister) ListSessionsByIdentity(ctx context.Context, identityID uuid.UUID, page, perPage int) ([]session.Session, error) {
+	var s []session.Session
+	if err := p.GetConnection(ctx).
+		Where("identity_id = ?", identityID).
+		Paginate(page, perPage).
+		Order("created_at DESC").
+		All(&s); err != nil {
+		return nil, sqlcon.HandleError(err)
+	}
+
+	if len(s) == 0 {
+		return s, nil
+	}
+
+	// This is needed because of how identities are fetched from the store (if we use eager not all fields are
+	// available!).
+	i, err := p.GetIdentity(ctx, identityID)
+	if err != nil {
+		return nil, err
+	}
+	for k := range s {
+		s[k].Identity = i
+	}
+	return s, nil
+}
+
+func (p *Persister) CountSessionsByIdentity(ctx context.Context, identityID uuid.UUID) (int64, error) {
+	count, err := p.GetConnection(ctx).Where("identity_id = ?", identityID).Count(new(session.Session))
+	if err != nil {
+		return 0, sqlcon.HandleError(err)
+	}
+	return int64(count), nil
+}
+
+func (p *Persister) RevokeSession(ctx context.Context, sid uuid.UUID) error {
+	if err := p.GetConnection(ctx).RawQuery("UPDATE sessions SET active = false WHERE id = ?", sid).Exec(); err != nil {
+		return sqlcon.HandleError(err)
+	}
+	return nil
+}
+
+func (p *Persister) RevokeSessionsByIdentity(ctx context.Context, identityID uuid.UUID) error {
+	if err := p.GetConnection(ctx).RawQuery("UPDATE sessions SET active = false WHERE identity_id = ?", identityID).Exec(); err != nil {
+		return sqlcon.HandleError(err)
+	}
+	return nil
+}
+
+func (p *Persister) ClearCredentialsExpiredByIdentity(ctx context.Context, identityID uuid.UUID) error {
+	if err := p.GetConnection(ctx).RawQuery("UPDATE sessions SET credentials_expired = false WHERE identity_id = ?", identityID).Exec(); err != nil {
+		return sqlcon.HandleError(err)
+	}
+	return nil
+}
@@ -18,7 +18,11 @@ import (
 	"github.com/zzpu/ums/persistence/sql"
 	"github.com/zzpu/ums/selfservice/errorx"
 	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/selfservice/mfa/questions"
+	"github.com/zzpu/ums/selfservice/strategy/code"
 	"github.com/zzpu/ums/selfservice/strategy/link"
+	"github.com/zzpu/ums/selfservice/strategy/oidc"
+	"github.com/zzpu/ums/selfservice/strategy/password"
 	"github.com/zzpu/ums/x"
 
 	"github.com/gobuffalo/pop/v5"
@@ -174,10 +178,26 @@ func TestPersister(t *testing.T) {
 				pop.SetLogger(pl(t))
 				link.TestPersister(p)(t)
 			})
+			t.Run("contract=code.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				code.TestPersister(p)(t)
+			})
 			t.Run("contract=continuity.TestPersister", func(t *testing.T) {
 				pop.SetLogger(pl(t))
 				continuity.TestPersister(p)(t)
 			})
+			t.Run("contract=questions.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				questions.TestPersister(p)(t)
+			})
+			t.Run("contract=oidc.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				oidc.TestPersister(p)(t)
+			})
+			t.Run("contract=password.TestPersister", func(t *testing.T) {
+				pop.SetLogger(pl(t))
+				password.TestPersister(p)(t)
+			})
 		})
 
 		t.Logf("DSN: %s", dsn)
@@ -12,10 +12,12 @@ import (
 	"github.com/ory/x/sqlcon"
 
 	"github.com/zzpu/ums/selfservice/flow/verification"
+	"github.com/zzpu/ums/selfservice/strategy/code"
 	"github.com/zzpu/ums/selfservice/strategy/link"
 )
 
 var _ verification.FlowPersister = new(Persister)
+var _ code.VerificationCodePersister = new(Persister)
 
 func (p Persister) CreateVerificationFlow(ctx context.Context, r *verification.Flow) error {
 	// This should not create the request eagerly because otherwise we might accidentally create an address
@@ -104,3 +106,77 @@ func (p *Persister) DeleteVerificationToken(ctx context.Context, token string) e
 	/* #nosec G201 TableName is static */
 	return p.GetConnection(ctx).RawQuery(fmt.Sprintf("DELETE FROM %s WHERE token=?", new(link.VerificationToken).TableName()), token).Exec()
 }
+
+func (p *Persister) CreateVerificationCode(ctx context.Context, vc *code.VerificationCode) error {
+	c := vc.Code
+	vc.Code = p.hmacValue(c)
+
+	if err := p.Transaction(ctx, func(ctx context.Context, tx *pop.Connection) error {
+		// Codes which were sent earlier must not become usable again once the latest code is used up.
+		/* #nosec G201 TableName is static */
+		if err := tx.RawQuery(fmt.Sprintf("UPDATE %s SET used=true, used_at=? WHERE selfservice_verification_flow_id=? AND NOT used", vc.TableName()), time.Now().UTC(), vc.FlowID).Exec(); err != nil {
+			return err
+		}
+
+		// This should not create the request eagerly because otherwise we might accidentally create an address that isn't
+		// supposed to be in the database.
+		return tx.Create(vc)
+	}); err != nil {
+		return err
+	}
+	vc.Code = c
+	return nil
+}
+
+func (p *Persister) CountVerificationCodeSend(ctx context.Context, flowID uuid.UUID, maxSends int) error {
+	// The counter is only updated here and not mapped to the flow, which is why updating the flow can not reset it.
+	/* #nosec G201 TableName is static */
+	count, err := p.GetConnection(ctx).RawQuery(fmt.Sprintf("UPDATE %s SET code_sends=code_sends+1 WHERE id=? AND code_sends<?", new(verification.Flow).TableName()), flowID, maxSends).ExecWithCount()
+	if err != nil {
+		return sqlcon.HandleError(err)
+	} else if count == 0 {
+		return code.ErrCodeSendsExceeded
+	}
+	return nil
+}
+
+func (p *Persister) UseVerificationCode(ctx context.Context, flowID uuid.UUID, value string, maxAttempts int) (*code.VerificationCode, error) {
+	var valid, exceeded bool
+	vc := new(code.VerificationCode)
+	if err := sqlcon.HandleError(p.Transaction(ctx, func(ctx context.Context, tx *pop.Connection) error {
+		if err := tx.Eager().Where("selfservice_verification_flow_id = ? AND NOT used", flowID).Order("created_at DESC").First(vc); err != nil {
+			return err
+		}
+
+		// The attempt is counted by incrementing the column in the database, which also locks the row until the
+		// transaction ends. Concurrent requests therefore can not use the same attempt or the same code twice.
+		/* #nosec G201 TableName is static */
+		if count, err := tx.RawQuery(fmt.Sprintf("UPDATE %s SET attempts=attempts+1 WHERE id=? AND NOT used AND attempts<?", vc.TableName()), vc.ID, maxAttempts).ExecWithCount(); err != nil {
+			return err
+		} else if count == 0 {
+			return sqlcon.ErrNoRows
+		}
+
+		// The attempt is recorded even if the code is wrong, which is why this transaction must not fail afterwards.
+		valid = p.hmacConstantCompare(value, vc.Code)
+		if valid {
+			/* #nosec G201 TableName is static */
+			return tx.RawQuery(fmt.Sprintf("UPDATE %s SET used=true, used_at=? WHERE id=?", vc.TableName()), time.Now().UTC(), vc.ID).Exec()
+		}
+
+		/* #nosec G201 TableName is static */
+		count, err := tx.RawQuery(fmt.Sprintf("UPDATE %s SET used=true, used_at=? WHERE id=? AND attempts>=?", vc.TableName()), time.Now().UTC(), vc.ID, maxAttempts).ExecWithCount()
+		exceeded = count > 0
+		return err
+	})); err != nil {
+		return nil, err
+	}
+
+	if valid {
+		return vc, nil
+	} else if exceeded {
+		return nil, code.ErrCodeAttemptsExceeded
+	}
+
+	return nil, sqlcon.ErrNoRows
+}
@@ -2,6 +2,7 @@ package schema
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -102,3 +103,179 @@ func NewDuplicateCredentialsError() error {
 		Messages: new(text.Messages).Add(text.NewErrorValidationDuplicateCredentials()),
 	})
 }
+
+type ValidationErrorContextTOTPVerifierWrong struct{}
+
+func (r *ValidationErrorContextTOTPVerifierWrong) AddContext(_, _ string) {}
+
+func (r *ValidationErrorContextTOTPVerifierWrong) FinishInstanceContext() {}
+
+func NewTOTPVerifierWrongError(instancePtr string) error {
+	return errors.WithStack(&ValidationError{
+		ValidationError: &jsonschema.ValidationError{
+			Message:     "the provided authentication code is invalid, please try again",
+			InstancePtr: instancePtr,
+			Context:     &ValidationErrorContextTOTPVerifierWrong{},
+		},
+		Messages: new(text.Messages).Add(text.NewErrorValidationTOTPVerifierWrong()),
+	})
+}
+
+type ValidationErrorContextWebAuthnVerifierWrong struct{}
+
+func (r *ValidationErrorContextWebAuthnVerifierWrong) AddContext(_, _ string) {}
+
+func (r *ValidationErrorContextWebAuthnVerifierWrong) FinishInstanceContext() {}
+
+func NewWebAuthnVerifierWrongError(instancePtr string) error {
+	return errors.WithStack(&ValidationError{
+		ValidationError: &jsonschema.ValidationError{
+			Message:     "the security key could not be verified, please try again",
+			InstancePtr: instancePtr,
+			Context:     &ValidationErrorContextWebAuthnVerifierWrong{},
+		},
+		Messages: new(text.Messages).Add(text.NewErrorValidationWebAuthnVerifierWrong()),
+	})
+}
+
+type ValidationErrorContextBackupCodeInvalid struct{}
+
+func (r *ValidationErrorContextBackupCodeInvalid) AddContext(_, _ string) {}
+
+func (r *ValidationErrorContextBackupCodeInvalid) FinishInstanceContext() {}
+
+func NewBackupCodeInvalidError(instancePtr string) error {
+	return errors.WithStack(&ValidationError{
+		ValidationError: &jsonschema.ValidationError{
+			Message:     "the backup code is invalid or has already been used",
+			InstancePtr: instancePtr,
+			Context:     &ValidationErrorContextBackupCodeInvalid{},
+		},
+		Messages: new(text.Messages).Add(text.NewErrorValidationRecoveryBackupCodeInvalidOrAlreadyUsed()),
+	})
+}
+
+type ValidationErrorContextSecurityAnswersInvalid struct{}
+
+func (r *ValidationErrorContextSecurityAnswersInvalid) AddContext(_, _ string) {}
+
+func (r *ValidationErrorContextSecurityAnswersInvalid) FinishInstanceContext() {}
+
+func NewSecurityAnswersInvalidError(instancePtr string) error {
+	return errors.WithStack(&ValidationError{
+		ValidationError: &jsonschema.ValidationError{
+			Message:     "the answers to the security questions are incorrect",
+			InstancePtr: instancePtr,
+			Context:     &ValidationErrorContextSecurityAnswersInvalid{},
+		},
+		Messages: new(text.Messages).Add(text.NewErrorValidationRecoverySecurityAnswersInvalid()),
+	})
+}
+
+type ValidationErrorContextSecurityQuestionsLocked struct {
+	LockedUntil time.Time
+}
+
+func (r *ValidationErrorContextSecurityQuestionsLocked) AddContext(_, _ string) {}
+
+func (r *ValidationErrorContextSecurityQuestionsLocked) FinishInstanceContext() {}
+
+func NewSecurityQuestionsLockedError(instancePtr string, lockedUntil time.Time) error {
+	return errors.WithStack(&ValidationError{
+		ValidationError: &jsonschema.ValidationError{
+			Message:     fmt.Sprintf("too many incorrect answers, recovery with security questions is locked until %s", lockedUntil),
+			InstancePtr: instancePtr,
+			Context:     &ValidationErrorContextSecurityQuestionsLocked{LockedUntil: lockedUntil},
+		},
+		Messages: new(text.Messages).Add(text.NewErrorValidationRecoverySecurityQuestionsLocked(lockedUntil)),
+	})
+}
+
+type ValidationErrorContextCodeInvalid struct{}
+
+func (r *ValidationErrorContextCodeInvalid) AddContext(_, _ string) {}
+
+func (r *ValidationErrorContextCodeInvalid) FinishInstanceContext() {}
+
+func NewCodeInvalidError(instancePtr string) error {
+	return errors.WithStack(&ValidationError{
+		ValidationError: &jsonschema.ValidationError{
+			Message:     "the code is invalid or has already been used",
+			InstancePtr: instancePtr,
+			Context:     &ValidationErrorContextCodeInvalid{},
+		},
+		Messages: new(text.Messages).Add(text.NewErrorValidationCodeInvalidOrAlreadyUsed()),
+	})
+}
+
+type ValidationErrorContextCodeAttemptsExceeded struct{}
+
+func (r *ValidationErrorContextCodeAttemptsExceeded) AddContext(_, _ string) {}
+
+func (r *ValidationErrorContextCodeAttemptsExceeded) FinishInstanceContext() {}
+
+func NewCodeAttemptsExceededError(instancePtr string) error {
+	return errors.WithStack(&ValidationError{
+		ValidationError: &jsonschema.ValidationError{
+			Message:     "the code was entered incorrectly too many times",
+			InstancePtr: instancePtr,
+			Context:     &ValidationErrorContextCodeAttemptsExceeded{},
+		},
+		Messages: new(text.Messages).Add(text.NewErrorValidationCodeAttemptsExceeded()),
+	})
+}
+
+type ValidationErrorContextCodeSendsExceeded struct{}
+
+func (r *ValidationErrorContextCodeSendsExceeded) AddContext(_, _ string) {}
+
+func (r *ValidationErrorContextCodeSendsExceeded) FinishInstanceContext() {}
+
+func NewCodeSendsExceededError(instancePtr string) error {
+	return errors.WithStack(&ValidationError{
+		ValidationError: &jsonschema.ValidationError{
+			Message:     "too many codes were requested",
+			InstancePtr: instancePtr,
+			Context:     &ValidationErrorContextCodeSendsExceeded{},
+		},
+		Messages: new(text.Messages).Add(text.NewErrorValidationCodeSendsExceeded()),
+	})
+}
+
+type ValidationErrorContextLoginDelayed struct {
+	RetryAt time.Time
+}
+
+func (r *ValidationErrorContextLoginDelayed) AddContext(_, _ string) {}
+
+func (r *ValidationErrorContextLoginDelayed) FinishInstanceContext() {}
+
+func NewLoginDelayedError(retryAt time.Time) error {
+	return errors.WithStack(&ValidationError{
+		ValidationError: &jsonschema.ValidationError{
+			Message:     fmt.Sprintf("too many failed login attempts, the next attempt is possible at %s", retryAt),
+			InstancePtr: "#/",
+			Context:     &ValidationErrorContextLoginDelayed{RetryAt: retryAt},
+		},
+		Messages: new(text.Messages).Add(text.NewErrorValidationLoginDelayed(retryAt)),
+	})
+}
+
+type ValidationErrorContextLoginLocked struct {
+	LockedUntil time.Time
+}
+
+func (r *ValidationErrorContextLoginLocked) AddContext(_, _ string) {}
+
+func (r *ValidationErrorContextLoginLocked) FinishInstanceContext() {}
+
+func NewLoginLockedError(lockedUntil time.Time) error {
+	return errors.WithStack(&ValidationError{
+		ValidationError: &jsonschema.ValidationError{
+			Message:     fmt.Sprintf("too many failed login attempts, login is locked until %s", lockedUntil),
+			InstancePtr: "#/",
+			Context:     &ValidationErrorContextLoginLocked{LockedUntil: lockedUntil},
+		},
+		Messages: new(text.Messages).Add(text.NewErrorValidationLoginLocked(lockedUntil)),
+	})
+}
@@ -23,6 +23,10 @@ import (
 var (
 	ErrHookAbortFlow   = errors.New("aborted login hook execution")
 	ErrAlreadyLoggedIn = herodot.ErrBadRequest.WithReason("A valid session was detected and thus login is not possible. Did you forget to set `?refresh=true`?")
+
+	ErrSecondFactorRequired = herodot.ErrBadRequest.WithReason("This login flow can only be completed using a second authentication factor of the identity which completed the first factor.")
+	ErrFirstFactorRequired  = herodot.ErrBadRequest.WithReason("A second authentication factor can only be used once the first factor was completed.")
+	ErrNoSecondFactor       = herodot.ErrBadRequest.WithReason("The session can not be upgraded because the identity has not set up a second authentication factor.")
 )
 
 type (
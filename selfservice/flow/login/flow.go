@@ -13,6 +13,7 @@ import (
 
 	"github.com/zzpu/ums/identity"
 	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/session"
 	"github.com/zzpu/ums/text"
 	"github.com/zzpu/ums/x"
 )
@@ -85,19 +86,28 @@ type Flow struct {
 
 	// Forced stores whether this login flow should enforce re-authentication.
 	Forced bool `json:"forced" db:"forced"`
+
+	// IdentityID is set once an identity completed the first authentication factor
+	// and the flow is waiting for a second factor.
+	IdentityID uuid.NullUUID `json:"-" faker:"-" db:"identity_id"`
+
+	// RequestedAAL is the authenticator assurance level the session will have once this flow
+	// is completed. It is `aal2` if the flow upgrades an existing session using a second factor.
+	RequestedAAL session.AuthenticatorAssuranceLevel `json:"requested_aal" faker:"-" db:"requested_aal"`
 }
 
 func NewFlow(exp time.Duration, csrf string, r *http.Request, flowType flow.Type) *Flow {
 	now := time.Now().UTC()
 	return &Flow{
-		ID:         x.NewUUID(),
-		ExpiresAt:  now.Add(exp),
-		IssuedAt:   now,
-		RequestURL: x.RequestURL(r).String(),
-		Methods:    map[identity.CredentialsType]*FlowMethod{},
-		CSRFToken:  csrf,
-		Type:       flowType,
-		Forced:     r.URL.Query().Get("refresh") == "true",
+		ID:           x.NewUUID(),
+		ExpiresAt:    now.Add(exp),
+		IssuedAt:     now,
+		RequestURL:   x.RequestURL(r).String(),
+		Methods:      map[identity.CredentialsType]*FlowMethod{},
+		CSRFToken:    csrf,
+		Type:         flowType,
+		Forced:       r.URL.Query().Get("refresh") == "true",
+		RequestedAAL: session.AuthenticatorAssuranceLevel1,
 	}
 }
 
@@ -148,6 +158,18 @@ func (f *Flow) IsForced() bool {
 	return f.Forced
 }
 
+// RequiresSecondFactor returns true if the first authentication factor was completed
+// and the flow can only be completed using a second factor.
+func (f *Flow) RequiresSecondFactor() bool {
+	return f.IdentityID.Valid
+}
+
+// IsStepUp returns true if the flow upgrades the authenticator assurance level of an existing session
+// instead of issuing a new one.
+func (f *Flow) IsStepUp() bool {
+	return f.RequestedAAL == session.AuthenticatorAssuranceLevel2
+}
+
 func (f *Flow) AppendTo(src *url.URL) *url.URL {
 	return urlx.CopyWithQuery(src, url.Values{"flow": {f.ID.String()}})
 }
@@ -57,6 +57,31 @@ func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
 	admin.GET(RouteGetFlow, h.fetchFlow)
 }
 
+// stepUp turns the flow into a flow which upgrades the given session to aal2 using one of its identity's second
+// factors. It returns false if the session does not need to be upgraded.
+func (h *Handler) stepUp(r *http.Request, a *Flow, s *session.Session) (bool, error) {
+	aal := r.URL.Query().Get("aal")
+	if len(aal) == 0 {
+		return false, nil
+	}
+
+	required, err := session.ParseAuthenticatorAssuranceLevel(aal)
+	if err != nil {
+		return false, err
+	} else if s.AAL.Satisfies(required) {
+		return false, nil
+	}
+
+	a.RequestedAAL = required
+	if prepared, err := h.d.LoginHookExecutor().PrepareSecondFactor(r, a, s.Identity); err != nil {
+		return false, err
+	} else if !prepared {
+		return false, errors.WithStack(ErrNoSecondFactor)
+	}
+
+	return true, nil
+}
+
 func (h *Handler) NewLoginFlow(w http.ResponseWriter, r *http.Request, flow flow.Type) (*Flow, error) {
 	a := NewFlow(h.c.SelfServiceFlowLoginRequestLifespan(), h.d.GenerateCSRFToken(r), r, flow)
 	for _, s := range h.d.LoginStrategies() {
@@ -86,6 +111,14 @@ type initializeSelfServiceBrowserLoginFlow struct {
 	//
 	// in: query
 	Refresh bool `json:"refresh"`
+
+	// Request a Higher Authenticator Assurance Level
+	//
+	// If set to `aal2` and a valid session exists, the flow only asks for one of the identity's second factors
+	// and upgrades the existing session to `aal2` instead of issuing a new one.
+	//
+	// in: query
+	AAL string `json:"aal"`
 }
 
 // swagger:route GET /self-service/login/api public initializeSelfServiceLoginViaAPIFlow
@@ -95,7 +128,9 @@ type initializeSelfServiceBrowserLoginFlow struct {
 // This endpoint initiates a login flow for API clients such as mobile devices, smart TVs, and so on.
 //
 // If a valid provided session cookie or session token is provided, a 400 Bad Request error
-// will be returned unless the URL query parameter `?refresh=true` is set.
+// will be returned unless the URL query parameter `?refresh=true` is set. If the URL query parameter
+// `?aal=aal2` is set and the session was authenticated using a single factor, the flow asks for a
+// second factor and upgrades the existing session once it is completed.
 //
 // To fetch an existing login flow call `/self-service/login/flows?flow=<flow_id>`.
 //
@@ -125,7 +160,8 @@ func (h *Handler) initAPIFlow(w http.ResponseWriter, r *http.Request, _ httprout
 	}
 
 	// we assume an error means the user has no session
-	if _, err := h.d.SessionManager().FetchFromRequest(r.Context(), r); err != nil {
+	sess, err := h.d.SessionManager().FetchFromRequest(r.Context(), r)
+	if err != nil {
 		h.d.Writer().Write(w, r, a)
 		return
 	}
@@ -139,6 +175,14 @@ func (h *Handler) initAPIFlow(w http.ResponseWriter, r *http.Request, _ httprout
 		return
 	}
 
+	if upgrade, err := h.stepUp(r, a, sess); err != nil {
+		h.d.Writer().WriteError(w, r, err)
+		return
+	} else if upgrade {
+		h.d.Writer().Write(w, r, a)
+		return
+	}
+
 	h.d.Writer().WriteError(w, r, errors.WithStack(ErrAlreadyLoggedIn))
 }
 
@@ -149,7 +193,8 @@ func (h *Handler) initAPIFlow(w http.ResponseWriter, r *http.Request, _ httprout
 // This endpoint initializes a browser-based user login flow. Once initialized, the browser will be redirected to
 // `selfservice.flows.login.ui_url` with the flow ID set as the query parameter `?flow=`. If a valid user session
 // exists already, the browser will be redirected to `urls.default_redirect_url` unless the query parameter
-// `?refresh=true` was set.
+// `?refresh=true` was set. If the query parameter `?aal=aal2` is set and the session was authenticated using
+// a single factor, the flow asks for a second factor and upgrades the existing session once it is completed.
 //
 // This endpoint is NOT INTENDED for API clients and only works with browsers (Chrome, Firefox, ...).
 //
@@ -169,7 +214,8 @@ func (h *Handler) initBrowserFlow(w http.ResponseWriter, r *http.Request, ps htt
 	}
 
 	// we assume an error means the user has no session
-	if _, err := h.d.SessionManager().FetchFromRequest(r.Context(), r); err != nil {
+	sess, err := h.d.SessionManager().FetchFromRequest(r.Context(), r)
+	if err != nil {
 		http.Redirect(w, r, a.AppendTo(h.c.SelfServiceFlowLoginUI()).String(), http.StatusFound)
 		return
 	}
@@ -183,6 +229,14 @@ func (h *Handler) initBrowserFlow(w http.ResponseWriter, r *http.Request, ps htt
 		return
 	}
 
+	if upgrade, err := h.stepUp(r, a, sess); err != nil {
+		h.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	} else if upgrade {
+		http.Redirect(w, r, a.AppendTo(h.c.SelfServiceFlowLoginUI()).String(), http.StatusFound)
+		return
+	}
+
 	returnTo, err := x.SecureRedirectTo(r, h.c.SelfServiceBrowserDefaultReturnTo(),
 		x.SecureRedirectAllowSelfServiceURLs(h.c.SelfPublicURL()),
 		x.SecureRedirectAllowURLs(h.c.SelfServiceBrowserWhitelistedReturnToDomains()),
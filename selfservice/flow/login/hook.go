@@ -5,12 +5,16 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
 
+	"github.com/ory/x/urlx"
+
 	"github.com/zzpu/ums/driver/configuration"
 	"github.com/zzpu/ums/identity"
 	"github.com/zzpu/ums/selfservice/flow"
 	"github.com/zzpu/ums/session"
+	"github.com/zzpu/ums/text"
 	"github.com/zzpu/ums/x"
 )
 
@@ -32,6 +36,9 @@ type (
 type (
 	executorDependencies interface {
 		HooksProvider
+		StrategyProvider
+		FlowPersistenceProvider
+		identity.PrivilegedPoolProvider
 		session.ManagementProvider
 		session.PersistenceProvider
 		x.WriterProvider
@@ -61,8 +68,182 @@ func NewHookExecutor(d executorDependencies, c configuration.Provider) *HookExec
 	}
 }
 
+func (e *HookExecutor) isSecondFactor(ct identity.CredentialsType) bool {
+	for _, s := range e.d.LoginStrategies() {
+		if _, ok := s.(SecondFactorStrategy); ok && s.ID() == ct {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *HookExecutor) isPasswordless(ct identity.CredentialsType) bool {
+	for _, s := range e.d.LoginStrategies() {
+		if ps, ok := s.(PasswordlessStrategy); ok && s.ID() == ct {
+			return ps.IsPasswordless()
+		}
+	}
+	return false
+}
+
+// settingsBrowserFlowRoute initializes a settings flow for browsers. It is the same as settings.RouteInitBrowserFlow,
+// which can not be used because the settings package depends on this package.
+const settingsBrowserFlowRoute = "/self-service/settings/browser"
+
+// credentialsExpired returns true if the identity has credentials which have expired and need to be changed.
+func (e *HookExecutor) credentialsExpired(r *http.Request, i *identity.Identity) (bool, error) {
+	for _, s := range e.d.LoginStrategies() {
+		if es, ok := s.(ExpiringCredentialsStrategy); ok {
+			if expired, err := es.CredentialsExpired(r, i); err != nil || expired {
+				return expired, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// PrepareSecondFactor checks if the identity has set up any second factors. If that is the case, the flow is
+// updated to only offer those factors and true is returned.
+func (e *HookExecutor) PrepareSecondFactor(r *http.Request, a *Flow, i *identity.Identity) (bool, error) {
+	var candidates []SecondFactorStrategy
+	for _, s := range e.d.LoginStrategies() {
+		if sf, ok := s.(SecondFactorStrategy); ok {
+			candidates = append(candidates, sf)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return false, nil
+	}
+
+	// The identity passed by the first factor does not necessarily include its credentials.
+	confidential, err := e.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), i.ID)
+	if err != nil {
+		return false, err
+	}
+
+	var factors []SecondFactorStrategy
+	for _, sf := range candidates {
+		has, err := sf.HasSecondFactor(confidential)
+		if err != nil {
+			return false, err
+		} else if has {
+			factors = append(factors, sf)
+		}
+	}
+
+	if len(factors) == 0 {
+		return false, nil
+	}
+
+	a.IdentityID = uuid.NullUUID{UUID: i.ID, Valid: true}
+	a.Methods = map[identity.CredentialsType]*FlowMethod{}
+	for _, sf := range factors {
+		if err := sf.PopulateLoginMethod(r, a); err != nil {
+			return false, err
+		}
+	}
+
+	a.Messages.Clear()
+	a.Messages.Add(text.NewInfoSelfServiceMFASecondFactorRequired())
+	if err := e.d.LoginFlowPersister().UpdateLoginFlow(r.Context(), a); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// requireSecondFactor prepares the flow for the second factor and sends the client back to the login UI
+// if the identity has set up any second factors.
+func (e *HookExecutor) requireSecondFactor(w http.ResponseWriter, r *http.Request, a *Flow, i *identity.Identity) (bool, error) {
+	if required, err := e.PrepareSecondFactor(r, a, i); err != nil || !required {
+		return false, err
+	}
+
+	e.d.Audit().
+		WithRequest(r).
+		WithField("identity_id", i.ID).
+		Info("Identity completed the first authentication factor and needs to complete a second factor.")
+
+	if a.Type == flow.TypeAPI {
+		updatedFlow, err := e.d.LoginFlowPersister().GetLoginFlow(r.Context(), a.ID)
+		if err != nil {
+			return false, err
+		}
+
+		e.d.Writer().Write(w, r, updatedFlow)
+		return true, nil
+	}
+
+	http.Redirect(w, r, a.AppendTo(e.c.SelfServiceFlowLoginUI()).String(), http.StatusFound)
+	return true, nil
+}
+
+// upgradeSession raises the authenticator assurance level of the session which started the step-up flow
+// instead of issuing a new session.
+func (e *HookExecutor) upgradeSession(w http.ResponseWriter, r *http.Request, ct identity.CredentialsType, a *Flow, i *identity.Identity) error {
+	s, err := e.d.SessionManager().FetchFromRequest(r.Context(), r)
+	if err != nil {
+		return err
+	}
+
+	if s.IdentityID != i.ID {
+		return errors.WithStack(ErrSecondFactorRequired)
+	}
+
+	s.AAL = session.AuthenticatorAssuranceLevel2
+	if err := e.d.SessionPersister().UpdateSession(r.Context(), s); err != nil {
+		return err
+	}
+
+	e.d.Audit().
+		WithRequest(r).
+		WithField("session_id", s.ID).
+		WithField("identity_id", i.ID).
+		WithField("flow_method", ct).
+		Info("Identity completed a second factor and the session was upgraded to authenticator assurance level aal2.")
+
+	if a.Type == flow.TypeAPI {
+		e.d.Writer().Write(w, r, &APIFlowResponse{Session: s.Declassify(), Token: s.Token})
+		return nil
+	}
+
+	return x.SecureContentNegotiationRedirection(w, r, s.Declassify(), a.RequestURL,
+		e.d.Writer(), e.c, x.SecureRedirectOverrideDefaultReturnTo(e.c.SelfServiceFlowLoginReturnTo(ct.String())))
+}
+
 func (e *HookExecutor) PostLoginHook(w http.ResponseWriter, r *http.Request, ct identity.CredentialsType, a *Flow, i *identity.Identity) error {
+	aal := session.AuthenticatorAssuranceLevel1
+	if a.RequiresSecondFactor() {
+		if !e.isSecondFactor(ct) || a.IdentityID.UUID != i.ID {
+			return errors.WithStack(ErrSecondFactorRequired)
+		}
+
+		if a.IsStepUp() {
+			return e.upgradeSession(w, r, ct, a, i)
+		}
+		aal = session.AuthenticatorAssuranceLevel2
+	} else if !e.isPasswordless(ct) {
+		// Passwordless strategies are strong enough to not require another factor.
+		if e.isSecondFactor(ct) {
+			return errors.WithStack(ErrFirstFactorRequired)
+		} else if required, err := e.requireSecondFactor(w, r, a, i); err != nil {
+			return err
+		} else if required {
+			return nil
+		}
+	}
+
 	s := session.NewActiveSession(i, e.c, time.Now().UTC()).Declassify()
+	s.AAL = aal
+
+	// Sessions with expired credentials are issued so that the credentials can be changed in the settings flow,
+	// but they are rejected everywhere else until that happened.
+	expired, err := e.credentialsExpired(r, i)
+	if err != nil {
+		return err
+	}
+	s.CredentialsExpired = expired
 
 	e.d.Logger().
 		WithRequest(r).
@@ -118,6 +299,20 @@ func (e *HookExecutor) PostLoginHook(w http.ResponseWriter, r *http.Request, ct
 		WithField("identity_id", i.ID).
 		WithField("session_id", s.ID).
 		Info("Identity authenticated successfully and was issued an ORY Kratos Session Cookie.")
+
+	if s.CredentialsExpired {
+		e.d.Audit().
+			WithRequest(r).
+			WithField("identity_id", i.ID).
+			WithField("session_id", s.ID).
+			Info("Identity authenticated with expired credentials and is sent to the settings flow.")
+
+		// The settings flow URL has no return_to parameter, so the client is always redirected to the settings flow.
+		settingsURL := urlx.AppendPaths(e.c.SelfPublicURL(), settingsBrowserFlowRoute)
+		return x.SecureContentNegotiationRedirection(w, r, s.Declassify(), settingsURL.String(),
+			e.d.Writer(), e.c, x.SecureRedirectOverrideDefaultReturnTo(settingsURL))
+	}
+
 	return x.SecureContentNegotiationRedirection(w, r, s.Declassify(), a.RequestURL,
 		e.d.Writer(), e.c, x.SecureRedirectOverrideDefaultReturnTo(e.c.SelfServiceFlowLoginReturnTo(ct.String())))
 }
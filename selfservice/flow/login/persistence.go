@@ -2,6 +2,7 @@ package login
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/bxcodec/faker/v3"
@@ -9,6 +10,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/ory/x/sqlcon"
+
 	"github.com/zzpu/ums/identity"
 	"github.com/zzpu/ums/selfservice/flow"
 	"github.com/zzpu/ums/selfservice/form"
@@ -22,6 +25,10 @@ type (
 		GetLoginFlow(context.Context, uuid.UUID) (*Flow, error)
 		UpdateLoginFlowMethod(context.Context, uuid.UUID, identity.CredentialsType, *FlowMethod) error
 		ForceLoginFlow(ctx context.Context, id uuid.UUID) error
+
+		// UpdateLoginFlowMethodConfig replaces the config of the method, for example to consume a challenge stored
+		// in it. It returns sqlcon.ErrNoRows if the config was changed since the method was loaded.
+		UpdateLoginFlowMethodConfig(ctx context.Context, method *FlowMethod, config *FlowMethodConfig) error
 	}
 	FlowPersistenceProvider interface {
 		LoginFlowPersister() FlowPersister
@@ -170,6 +177,32 @@ func TestFlowPersister(p FlowPersister) func(t *testing.T) {
 			assert.Equal(t, string(identity.CredentialsTypeOIDC), actual.Methods[identity.CredentialsTypeOIDC].Config.FlowMethodConfigurator.(*form.HTMLForm).Action)
 		})
 
+		t.Run("case=should update the config of a login flow method only if unchanged", func(t *testing.T) {
+			expected := newFlow(t)
+			require.NoError(t, p.CreateLoginFlow(context.Background(), expected))
+
+			actual, err := p.GetLoginFlow(context.Background(), expected.ID)
+			require.NoError(t, err)
+			require.Len(t, actual.Methods, 2)
+
+			method := actual.Methods[identity.CredentialsTypePassword]
+			stale := *method
+			require.NoError(t, p.UpdateLoginFlowMethodConfig(context.Background(), method,
+				&FlowMethodConfig{FlowMethodConfigurator: form.NewHTMLForm("first")}))
+			assert.Equal(t, "first", method.Config.FlowMethodConfigurator.(*form.HTMLForm).Action)
+			require.True(t, errors.Is(p.UpdateLoginFlowMethodConfig(context.Background(), &stale,
+				&FlowMethodConfig{FlowMethodConfigurator: form.NewHTMLForm("second")}), sqlcon.ErrNoRows))
+
+			actual, err = p.GetLoginFlow(context.Background(), expected.ID)
+			require.NoError(t, err)
+			require.Len(t, actual.Methods, 2)
+			assert.Equal(t, "first", actual.Methods[identity.CredentialsTypePassword].Config.FlowMethodConfigurator.(*form.HTMLForm).Action)
+			assert.Equal(t,
+				expected.Methods[identity.CredentialsTypeOIDC].Config.FlowMethodConfigurator.(*form.HTMLForm).Action,
+				actual.Methods[identity.CredentialsTypeOIDC].Config.FlowMethodConfigurator.(*form.HTMLForm).Action,
+			)
+		})
+
 		t.Run("case=should not cause data loss when updating a request without changes", func(t *testing.T) {
 			expected := newFlow(t)
 			err := p.CreateLoginFlow(context.Background(), expected)
@@ -15,6 +15,33 @@ type Strategy interface {
 	PopulateLoginMethod(r *http.Request, sr *Flow) error
 }
 
+// SecondFactorStrategy is implemented by strategies which are used as an additional
+// authentication factor once another strategy has authenticated the identity.
+type SecondFactorStrategy interface {
+	Strategy
+
+	// HasSecondFactor returns true if the given identity has set up this factor.
+	HasSecondFactor(i *identity.Identity) (bool, error)
+}
+
+// PasswordlessStrategy is implemented by second factor strategies which can also complete
+// a login flow on their own, without requiring the identity to complete another factor.
+type PasswordlessStrategy interface {
+	SecondFactorStrategy
+
+	// IsPasswordless returns true if the strategy may be used as the only factor.
+	IsPasswordless() bool
+}
+
+// ExpiringCredentialsStrategy is implemented by strategies whose credentials expire. Identities whose
+// credentials have expired are sent to the settings flow after logging in.
+type ExpiringCredentialsStrategy interface {
+	Strategy
+
+	// CredentialsExpired returns true if the credentials of the given identity have expired.
+	CredentialsExpired(r *http.Request, i *identity.Identity) (bool, error)
+}
+
 type Strategies []Strategy
 
 func (s Strategies) Strategy(id identity.CredentialsType) (Strategy, error) {
@@ -0,0 +1,29 @@
+package recovery
+
+import "github.com/zzpu/ums/session"
+
+// The Response for Recovery Flows via API
+//
+// swagger:model recoveryViaApiResponse
+type APIFlowResponse struct {
+	// The Session Token
+	//
+	// A session token is equivalent to a session cookie, but it can be sent in the HTTP Authorization
+	// Header:
+	//
+	// 		Authorization: bearer ${session-token}
+	//
+	// The session token is only issued for API flows, not for Browser flows! Use it to update
+	// the password or other credentials in an API settings flow.
+	//
+	// required: true
+	Token string `json:"session_token"`
+
+	// The Session
+	//
+	// The session contains information about the user, the session device, and so on.
+	// This is only available for API flows, not for Browser flows!
+	//
+	// required: true
+	Session *session.Session `json:"session"`
+}
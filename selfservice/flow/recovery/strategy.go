@@ -9,7 +9,10 @@ import (
 )
 
 const (
-	StrategyRecoveryLinkName = "link"
+	StrategyRecoveryLinkName              = "link"
+	StrategyRecoveryBackupCodesName       = "backup_codes"
+	StrategyRecoverySecurityQuestionsName = "security_questions"
+	StrategyRecoveryCodeName              = "code"
 )
 
 type (
@@ -47,6 +47,12 @@ func (e *Verifier) do(r *http.Request, i *identity.Identity) error {
 			continue
 		}
 
+		// Verification links can only be sent via email. Phone numbers are verified using the code method's
+		// verification flow instead.
+		if address.Via != identity.VerifiableAddressTypeEmail {
+			continue
+		}
+
 		token := link.NewVerificationToken(address, e.c.SelfServiceFlowVerificationRequestLifespan())
 		if err := e.r.VerificationTokenPersister().CreateVerificationToken(r.Context(), token); err != nil {
 			return err
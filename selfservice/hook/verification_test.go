@@ -40,7 +40,7 @@ func TestVerifier(t *testing.T) {
 			viper.Set(configuration.ViperKeyCourierSMTPURL, "smtp://foo@bar@dev.null/")
 
 			i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
-			i.Traits = identity.Traits(`{"emails":["foo@ory.sh","bar@ory.sh","baz@ory.sh"]}`)
+			i.Traits = identity.Traits(`{"emails":["foo@ory.sh","bar@ory.sh","baz@ory.sh"],"phone":"+8613800138000"}`)
 			require.NoError(t, reg.IdentityManager().Create(context.Background(), i))
 
 			actual, err := reg.IdentityPool().FindVerifiableAddressByValue(context.Background(), identity.VerifiableAddressTypeEmail, "foo@ory.sh")
@@ -71,7 +71,8 @@ func TestVerifier(t *testing.T) {
 
 			assert.EqualValues(t, "foo@ory.sh", messages[0].Recipient)
 			assert.EqualValues(t, "bar@ory.sh", messages[1].Recipient)
-			// Email to baz@ory.sh is skipped because it is verified already.
+			// Email to baz@ory.sh is skipped because it is verified already and the phone number is skipped because
+			// it can not receive verification links.
 		})
 	}
 }
@@ -1,6 +1,54 @@
 package questions
 
+import (
+	"time"
+)
+
 type RecoverySecurityQuestion struct {
 	ID    string `json:"id"`
 	Label string `json:"label"`
 }
+
+// Configuration is the configuration of the security questions method.
+type Configuration struct {
+	// Questions is the catalogue of questions users can answer.
+	Questions []RecoverySecurityQuestion `json:"questions"`
+
+	// MinAnswers is the number of questions a user has to answer. Zero requires all questions to be answered.
+	MinAnswers int `json:"min_answers"`
+
+	// MinLength is the minimum length of a normalized answer.
+	MinLength int `json:"min_length"`
+
+	// MaxAttempts is the number of failed attempts within LockoutDuration after which the method is locked.
+	MaxAttempts int `json:"max_attempts"`
+
+	// LockoutDuration is the time window in which failed attempts are counted.
+	LockoutDuration string `json:"lockout_duration"`
+}
+
+// RequiredAnswers returns the number of questions a user has to answer.
+func (c *Configuration) RequiredAnswers() int {
+	if c.MinAnswers == 0 || c.MinAnswers > len(c.Questions) {
+		return len(c.Questions)
+	}
+	return c.MinAnswers
+}
+
+// Question returns the question with the given ID.
+func (c *Configuration) Question(id string) (*RecoverySecurityQuestion, bool) {
+	for k := range c.Questions {
+		if c.Questions[k].ID == id {
+			return &c.Questions[k], true
+		}
+	}
+	return nil, false
+}
+
+func (c *Configuration) lockout() time.Duration {
+	d, err := time.ParseDuration(c.LockoutDuration)
+	if err != nil {
+		return time.Hour
+	}
+	return d
+}
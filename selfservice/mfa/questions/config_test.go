@@ -2,15 +2,52 @@ package questions
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestConfig(t *testing.T) {
-	t.Run("method=recovery", func(t *testing.T) {
-		t.SkipNow()
-		assert.EqualValues(t, []RecoverySecurityQuestion{{ID: "foo", Label: "bar"}},
-			nil)
-		// p.SelfServiceRecoverySecurityQuestions())
+	c := Configuration{Questions: []RecoverySecurityQuestion{{ID: "foo", Label: "Foo?"}, {ID: "bar", Label: "Bar?"}}}
+
+	t.Run("method=RequiredAnswers", func(t *testing.T) {
+		for k, tc := range []struct {
+			min, expected int
+		}{
+			{min: 0, expected: 2},
+			{min: 1, expected: 1},
+			{min: 2, expected: 2},
+			{min: 3, expected: 2},
+		} {
+			c.MinAnswers = tc.min
+			assert.Equal(t, tc.expected, c.RequiredAnswers(), "%d", k)
+		}
 	})
+
+	t.Run("method=Question", func(t *testing.T) {
+		q, ok := c.Question("bar")
+		assert.True(t, ok)
+		assert.Equal(t, "Bar?", q.Label)
+
+		_, ok = c.Question("baz")
+		assert.False(t, ok)
+	})
+
+	t.Run("method=lockout", func(t *testing.T) {
+		c.LockoutDuration = "15m"
+		assert.Equal(t, 15*time.Minute, c.lockout())
+
+		c.LockoutDuration = "not-a-duration"
+		assert.Equal(t, time.Hour, c.lockout())
+	})
+}
+
+func TestNormalizeAnswer(t *testing.T) {
+	for in, expected := range map[string]string{
+		"Hamburg, Germany":    "hamburg germany",
+		"  hamburg   germany": "hamburg germany",
+		"Straße 12!":          "straße 12",
+	} {
+		assert.Equal(t, expected, normalizeAnswer(in), "%s", in)
+	}
 }
@@ -1,23 +1,37 @@
-// nolint
 package questions
 
 import (
+	"bytes"
 	"context"
 	"regexp"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/sjson"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/jsonx"
 
 	"github.com/zzpu/ums/driver/configuration"
 	"github.com/zzpu/ums/hash"
 	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/schema"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
 	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
 )
 
 type (
 	ManagementProvider interface {
-		RecoveryManager() *Manager
+		SecurityQuestionsManager() *Manager
 	}
 	managerDependencies interface {
+		x.LoggingProvider
 		hash.HashProvider
+		AttemptPersistenceProvider
 	}
 	Manager struct {
 		c configuration.Provider
@@ -25,73 +39,153 @@ type (
 	}
 )
 
-var collapseNonAlphanumeric = regexp.MustCompile(`[^a-zA-Z\d\s:]+`)
+var collapseNonAlphanumeric = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+func normalizeAnswer(in string) string {
+	return strings.TrimSpace(collapseNonAlphanumeric.ReplaceAllString(strings.ToLower(in), " "))
+}
+
+func NewManager(d managerDependencies, c configuration.Provider) *Manager {
+	return &Manager{c: c, d: d}
+}
 
-func normalizeAnswer(in string) []byte {
-	return []byte(collapseNonAlphanumeric.ReplaceAllString(strings.ToLower(strings.TrimSpace(in)), " "))
+// Enabled returns true if the security questions method is enabled.
+func (m *Manager) Enabled() bool {
+	return m.c.SelfServiceStrategy(recovery.StrategyRecoverySecurityQuestionsName).Enabled
 }
 
-func (m *Manager) SetSecurityFormFields(ctx context.Context, i *identity.Identity, prefix string, htmlf *form.HTMLForm) error {
-	if len(prefix) > 0 {
-		prefix = prefix + "."
+func (m *Manager) Config() (*Configuration, error) {
+	c := Configuration{MinLength: 6, MaxAttempts: 3, LockoutDuration: "1h"}
+
+	config := m.c.SelfServiceStrategy(recovery.StrategyRecoverySecurityQuestionsName).Config
+	if err := jsonx.
+		NewStrictDecoder(bytes.NewBuffer(config)).
+		Decode(&c); err != nil {
+		m.d.Logger().WithError(err).WithField("config", config)
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode security questions configuration: %s", err))
 	}
 
-	// for _, question := range i.RecoverySecurityAnswers {
-	// 	htmlf.SetField(form.Field{Name: prefix + question.Key, Type: "text", Required: true})
-	// }
-	return nil
+	return &c, nil
 }
 
-// func (m *Manager) CompareSecurityQuestions(ctx context.Context, question identity.RecoverySecurityAnswer, answer string) error {
-// 	return m.d.Hasher().Compare([]byte(answer), normalizeAnswer(question.Answer))
-// }
-
-func (m *Manager) HashSecurityQuestions(i *identity.Identity, answers map[string]string) error {
-	// var result identity.RecoverySecurityAnswers
-	//
-	// for key, answer := range answers {
-	// 	hashed, err := m.d.Hasher().Generate(normalizeAnswer(answer))
-	// 	if err != nil {
-	// 		return err
-	// 	}
-	//
-	// 	result = append(result,
-	// 		identity.RecoverySecurityAnswer{ID: x.NewUUID(), Key: key, Answer: string(hashed), IdentityID: i.ID})
-	// }
-	//
-	// i.RecoverySecurityAnswers = result
+// SetSecurityFormFields adds a field for every question of the catalogue to the form. The question
+// itself is added as a message to the field.
+func (m *Manager) SetSecurityFormFields(prefix string, htmlf form.FieldSetter) error {
+	c, err := m.Config()
+	if err != nil {
+		return err
+	}
+
+	required := c.RequiredAnswers() == len(c.Questions)
+	for _, question := range c.Questions {
+		htmlf.SetField(form.Field{
+			Name:     prefix + "." + question.ID,
+			Type:     "text",
+			Required: required,
+			Messages: text.Messages{*text.NewRecoverySecurityQuestion(question.ID, question.Label)},
+		})
+	}
 	return nil
 }
 
+// AddAnswersToSchema adds a string property for every question of the catalogue and the given question
+// IDs to the object at path in the JSON Schema. Form payloads are only decoded for properties known to the schema.
+func (m *Manager) AddAnswersToSchema(raw []byte, path string, ids ...string) ([]byte, error) {
+	c, err := m.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, question := range c.Questions {
+		ids = append(ids, question.ID)
+	}
+
+	raw, err = sjson.SetBytes(raw, path+".type", "object")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, id := range ids {
+		raw, err = sjson.SetBytes(raw, path+".properties."+id+".type", "string")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return raw, nil
+}
+
+// SetSecurityAnswers validates the answers against the question catalogue, hashes them and sets them
+// on the identity. Existing answers are replaced.
 func (m *Manager) SetSecurityAnswers(ctx context.Context, i *identity.Identity, answers map[string]string, validationPrefix string) error {
-	// // Validation
-	// for _, question := range m.c.SelfServiceRecoverySecurityQuestions() {
-	// 	var found bool
-	// 	for id, answer := range answers {
-	// 		if id == question.ID {
-	// 			expected := 6
-	// 			answer = normalizeAnswer(answer)
-	//
-	// 			if actual := utf8.RuneCountInString(answer); actual < expected {
-	// 				return errors.WithStack(&jsonschema.ValidationError{
-	// 					Message:     fmt.Sprintf("length must be >= %d, but got %s (%d) after normalization", expected, answer, actual),
-	// 					InstancePtr: validationPrefix + id,
-	// 				})
-	// 			}
-	//
-	// 			found = true
-	// 			i.RecoverySecurityAnswers = append(i.RecoverySecurityAnswers, identity.RecoverySecurityAnswer{
-	// 				Key: id, Answer: answer,
-	// 				IdentityID: i.ID,
-	// 			})
-	// 			break
-	// 		}
-	// 	}
-	//
-	// 	if !found {
-	// 		return schema.NewRequiredError(validationPrefix, question.ID)
-	// 	}
-	// }
+	c, err := m.Config()
+	if err != nil {
+		return err
+	}
+
+	var result []identity.RecoverySecurityAnswer
+	for _, question := range c.Questions {
+		answer := normalizeAnswer(answers[question.ID])
+		if len(answer) == 0 {
+			continue
+		}
+
+		if actual := utf8.RuneCountInString(answer); actual < c.MinLength {
+			return schema.NewMinLengthError(validationPrefix+"/"+question.ID, c.MinLength, actual)
+		}
+
+		hashed, err := m.d.Hasher().Generate([]byte(answer))
+		if err != nil {
+			return err
+		}
+
+		result = append(result, identity.RecoverySecurityAnswer{
+			ID: x.NewUUID(), QuestionID: question.ID, Answer: string(hashed)})
+	}
+
+	if len(result) < c.RequiredAnswers() {
+		for _, question := range c.Questions {
+			if len(normalizeAnswer(answers[question.ID])) == 0 {
+				return schema.NewRequiredError(validationPrefix+"/"+question.ID, question.ID)
+			}
+		}
+	}
 
+	i.SetSecurityAnswers(result)
 	return nil
 }
+
+// VerifySecurityAnswers compares the answers with the ones stored for the identity. Failed attempts
+// are recorded and lock the method once the configured maximum was reached.
+func (m *Manager) VerifySecurityAnswers(ctx context.Context, i *identity.Identity, answers map[string]string, validationPrefix string) error {
+	c, err := m.Config()
+	if err != nil {
+		return err
+	}
+
+	attempts, err := m.d.RecoverySecurityAttemptPersister().ListRecoverySecurityAttempts(ctx, i.ID, time.Now().UTC().Add(-c.lockout()))
+	if err != nil {
+		return err
+	}
+
+	if len(attempts) >= c.MaxAttempts {
+		return schema.NewSecurityQuestionsLockedError(validationPrefix, attempts[len(attempts)-c.MaxAttempts].CreatedAt.Add(c.lockout()))
+	}
+
+	valid := len(i.RecoverySecurityAnswers) > 0
+	for _, expected := range i.RecoverySecurityAnswers {
+		// All answers are compared to not leak which answer was wrong through timing.
+		if err := m.d.Hasher().Compare([]byte(normalizeAnswer(answers[expected.QuestionID])), []byte(expected.Answer)); err != nil {
+			valid = false
+		}
+	}
+
+	if !valid {
+		if err := m.d.RecoverySecurityAttemptPersister().CreateRecoverySecurityAttempt(ctx, &RecoverySecurityAttempt{IdentityID: i.ID}); err != nil {
+			return err
+		}
+		return schema.NewSecurityAnswersInvalidError(validationPrefix)
+	}
+
+	return m.d.RecoverySecurityAttemptPersister().DeleteRecoverySecurityAttempts(ctx, i.ID)
+}
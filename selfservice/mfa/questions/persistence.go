@@ -0,0 +1,36 @@
+package questions
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+type (
+	// RecoverySecurityAttempt is a failed attempt to answer the security questions of an identity.
+	RecoverySecurityAttempt struct {
+		ID uuid.UUID `json:"id" db:"id" faker:"-"`
+
+		// IdentityID is a helper struct field for gobuffalo.pop.
+		IdentityID uuid.UUID `json:"-" faker:"-" db:"identity_id"`
+		// CreatedAt is a helper struct field for gobuffalo.pop.
+		CreatedAt time.Time `json:"-" faker:"-" db:"created_at"`
+		// UpdatedAt is a helper struct field for gobuffalo.pop.
+		UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+	}
+
+	AttemptPersister interface {
+		CreateRecoverySecurityAttempt(ctx context.Context, attempt *RecoverySecurityAttempt) error
+		ListRecoverySecurityAttempts(ctx context.Context, identityID uuid.UUID, since time.Time) ([]RecoverySecurityAttempt, error)
+		DeleteRecoverySecurityAttempts(ctx context.Context, identityID uuid.UUID) error
+	}
+
+	AttemptPersistenceProvider interface {
+		RecoverySecurityAttemptPersister() AttemptPersister
+	}
+)
+
+func (a RecoverySecurityAttempt) TableName() string {
+	return "identity_recovery_security_attempts"
+}
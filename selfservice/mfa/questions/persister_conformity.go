@@ -0,0 +1,67 @@
+package questions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/faker/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+)
+
+func TestPersister(p interface {
+	AttemptPersister
+	identity.PrivilegedPool
+}) func(t *testing.T) {
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/identity.schema.json")
+	return func(t *testing.T) {
+		newIdentity := func(t *testing.T) *identity.Identity {
+			var i identity.Identity
+			require.NoError(t, faker.FakeData(&i))
+			require.NoError(t, p.CreateIdentity(context.Background(), &i))
+			return &i
+		}
+
+		t.Run("case=should list no attempts for unknown identity", func(t *testing.T) {
+			actual, err := p.ListRecoverySecurityAttempts(context.Background(), newIdentity(t).ID, time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Len(t, actual, 0)
+		})
+
+		t.Run("case=should create, list, and delete attempts", func(t *testing.T) {
+			i := newIdentity(t)
+			other := newIdentity(t)
+
+			for k := 0; k < 3; k++ {
+				require.NoError(t, p.CreateRecoverySecurityAttempt(context.Background(), &RecoverySecurityAttempt{IdentityID: i.ID}))
+			}
+			require.NoError(t, p.CreateRecoverySecurityAttempt(context.Background(), &RecoverySecurityAttempt{IdentityID: other.ID}))
+
+			actual, err := p.ListRecoverySecurityAttempts(context.Background(), i.ID, time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			require.Len(t, actual, 3)
+			for k := 1; k < len(actual); k++ {
+				assert.False(t, actual[k].CreatedAt.Before(actual[k-1].CreatedAt))
+			}
+
+			actual, err = p.ListRecoverySecurityAttempts(context.Background(), i.ID, time.Now().Add(time.Hour))
+			require.NoError(t, err)
+			assert.Len(t, actual, 0)
+
+			require.NoError(t, p.DeleteRecoverySecurityAttempts(context.Background(), i.ID))
+			actual, err = p.ListRecoverySecurityAttempts(context.Background(), i.ID, time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Len(t, actual, 0)
+
+			actual, err = p.ListRecoverySecurityAttempts(context.Background(), other.ID, time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Len(t, actual, 1)
+		})
+	}
+}
@@ -1,13 +1,419 @@
 package questions
 
-// func (s *StrategyLink) answerSecurityQuestions(w http.ResponseWriter, r *http.Request, req *Request) {
-// 	for _, question := range req.RecoveredIdentity.RecoverySecurityAnswers {
-// 		answer := r.PostForm.Get(securityQuestionPrefix + "." + question.Key)
-// 		if len(answer) == 0 {
-// 			s.handleError(w, r, req, schema.NewRequiredError("#/"+securityQuestionPrefix, question.Key))
-// 			return
-// 		}
-//
-// 		s.d.RecoveryManager().CompareSecurityQuestions(r.Context(),question,answer)
-// 	}
-// }
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/markbates/pkger"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/sqlxx"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/schema"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/session"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteRecovery = "/self-service/recovery/methods/security_questions"
+
+	answersPrefix = "security_answers"
+)
+
+func (s *Strategy) RecoveryStrategyID() string {
+	return recovery.StrategyRecoverySecurityQuestionsName
+}
+
+func (s *Strategy) RegisterPublicRecoveryRoutes(public *x.RouterPublic) {
+	redirect := session.RedirectOnAuthenticated(s.c)
+	public.POST(RouteRecovery, s.d.SessionHandler().IsNotAuthenticated(s.handleRecovery, redirect))
+}
+
+func (s *Strategy) PopulateRecoveryMethod(r *http.Request, req *recovery.Flow) error {
+	// Answering the security questions issues a session cookie which API clients can not use.
+	if req.Type != flow.TypeBrowser {
+		return nil
+	}
+
+	f := form.NewHTMLForm(req.AppendTo(urlx.AppendPaths(s.c.SelfPublicURL(), RouteRecovery)).String())
+
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+	f.SetField(form.Field{Name: "email", Type: "email", Required: true})
+
+	req.Methods[s.RecoveryStrategyID()] = &recovery.FlowMethod{
+		Method: s.RecoveryStrategyID(),
+		Config: &recovery.FlowMethodConfig{FlowMethodConfigurator: &FlowMethod{HTMLForm: f}},
+	}
+	return nil
+}
+
+// swagger:parameters completeSelfServiceRecoveryFlowWithSecurityQuestionsMethod
+type completeSelfServiceRecoveryFlowWithSecurityQuestionsMethodParameters struct {
+	// in: body
+	Body completeSelfServiceRecoveryFlowWithSecurityQuestionsMethod
+
+	// The Flow ID
+	//
+	// format: uuid
+	// in: query
+	Flow string `json:"flow"`
+}
+
+func (m *completeSelfServiceRecoveryFlowWithSecurityQuestionsMethodParameters) GetFlow() uuid.UUID {
+	return x.ParseUUID(m.Flow)
+}
+
+type completeSelfServiceRecoveryFlowWithSecurityQuestionsMethod struct {
+	// Email to Recover
+	//
+	// The recovery email address of the account to recover. Only required in the first step.
+	//
+	// format: email
+	// in: body
+	Email string `json:"email"`
+
+	// Security Answers
+	//
+	// The answers to the asked questions keyed by the question ID. Only required in the second step.
+	//
+	// in: body
+	SecurityAnswers map[string]string `json:"security_answers"`
+
+	// Sending the anti-csrf token is only required for browser login flows.
+	CSRFToken string `form:"csrf_token" json:"csrf_token"`
+}
+
+// swagger:route POST /self-service/recovery/methods/security_questions public completeSelfServiceRecoveryFlowWithSecurityQuestionsMethod
+//
+// Complete Recovery Flow with Security Questions Method
+//
+// Use this endpoint to recover an account by answering its security questions. This method is only available
+// for browser-initiated flows and consists of two steps:
+//
+// 1. Sending the `email` of the account to recover. The recovery flow is updated with the questions to answer.
+// 2. Sending the answers as `security_answers.<question_id>`.
+//
+// The server responds with a HTTP 302 Found redirect either to the Settings UI URL (if the answers were correct)
+// and instructs the user to update their password, or a redirect to the Recover UI URL with the Recovery Flow ID
+// which contains the questions or an error message. Too many wrong answers lock the method for the account.
+//
+//     Consumes:
+//     - application/x-www-form-urlencoded
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       302: emptyResponse
+//       400: recoveryFlow
+//       500: genericError
+func (s *Strategy) handleRecovery(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	body := &completeSelfServiceRecoveryFlowWithSecurityQuestionsMethodParameters{Flow: r.URL.Query().Get("flow")}
+
+	req, err := s.d.RecoveryFlowPersister().GetRecoveryFlow(r.Context(), body.GetFlow())
+	if err != nil {
+		s.handleRecoveryError(w, r, nil, body, err)
+		return
+	}
+
+	if err := req.Valid(); err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	if req.Type != flow.TypeBrowser {
+		s.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason("Security questions can only be answered in browser-initiated recovery flows.")))
+		return
+	}
+
+	if req.State != recovery.StateChooseMethod {
+		s.handleRecoveryError(w, r, req, body, schema.NewSecurityAnswersInvalidError("#/"))
+		return
+	}
+
+	if err := s.decodeRecovery(r, req, &body.Body); err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	if err := flow.VerifyRequest(r, req.Type, s.d.GenerateCSRFToken, body.Body.CSRFToken); err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	// The email address is taken from the flow and not from the payload once the questions were asked
+	// so the answers can not be checked against another account.
+	email := s.askedEmail(req)
+	if len(email) == 0 || len(body.Body.SecurityAnswers) == 0 {
+		s.recoveryAskQuestions(w, r, req, body)
+		return
+	}
+
+	i, err := s.verifyAnswers(r, email, body.Body.SecurityAnswers)
+	if err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	s.recoveryIssueSession(w, r, req, i)
+}
+
+// recoveryAskQuestions updates the flow with the questions of the account. Unknown addresses and accounts without
+// answers are asked decoy questions to prevent account enumeration.
+func (s *Strategy) recoveryAskQuestions(w http.ResponseWriter, r *http.Request, req *recovery.Flow, body *completeSelfServiceRecoveryFlowWithSecurityQuestionsMethodParameters) {
+	if len(body.Body.Email) == 0 {
+		s.handleRecoveryError(w, r, req, body, schema.NewRequiredError("#/email", "email"))
+		return
+	}
+
+	config, err := s.d.SecurityQuestionsManager().Config()
+	if err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	ids := s.decoyQuestions(config, body.Body.Email)
+	address, err := s.d.IdentityPool().FindRecoveryAddressByValue(r.Context(), identity.RecoveryAddressTypeEmail, body.Body.Email)
+	if err != nil && !errors.Is(err, sqlcon.ErrNoRows) {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	} else if err == nil {
+		i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), address.IdentityID)
+		if err != nil {
+			s.handleRecoveryError(w, r, req, body, err)
+			return
+		}
+
+		if len(i.RecoverySecurityAnswers) > 0 {
+			ids = make([]string, len(i.RecoverySecurityAnswers))
+			for k, answer := range i.RecoverySecurityAnswers {
+				ids[k] = answer.QuestionID
+			}
+		}
+	}
+
+	f, err := s.challengeForm(r, req, body.Body.Email, ids)
+	if err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	req.Methods[s.RecoveryStrategyID()].Config.FlowMethodConfigurator = &FlowMethod{HTMLForm: f}
+	req.Active = sqlxx.NullString(s.RecoveryStrategyID())
+	req.Messages.Set(text.NewRecoveryAskSecurityQuestions())
+	if err := s.d.RecoveryFlowPersister().UpdateRecoveryFlow(r.Context(), req); err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	http.Redirect(w, r, req.AppendTo(s.c.SelfServiceFlowRecoveryUI()).String(), http.StatusFound)
+}
+
+// decoyQuestions returns as many questions of the catalogue as an account has to answer. The questions are derived
+// from the email address so that repeated requests for an unknown address ask the same questions, and they are
+// returned in the order of the catalogue, just like the questions of an account.
+func (s *Strategy) decoyQuestions(config *Configuration, email string) []string {
+	normalized := strings.ToLower(strings.TrimSpace(email))
+	rank := func(id string) []byte {
+		mac := hmac.New(sha256.New, s.c.SecretsDefault()[0])
+		_, _ = mac.Write([]byte(normalized + "\x00" + id))
+		return mac.Sum(nil)
+	}
+
+	ranked := make([]int, len(config.Questions))
+	for k := range ranked {
+		ranked[k] = k
+	}
+	sort.SliceStable(ranked, func(a, b int) bool {
+		return bytes.Compare(rank(config.Questions[ranked[a]].ID), rank(config.Questions[ranked[b]].ID)) < 0
+	})
+
+	chosen := ranked[:config.RequiredAnswers()]
+	sort.Ints(chosen)
+
+	ids := make([]string, len(chosen))
+	for k, index := range chosen {
+		ids[k] = config.Questions[index].ID
+	}
+	return ids
+}
+
+// challengeForm returns the form which asks the questions with the given IDs.
+func (s *Strategy) challengeForm(r *http.Request, req *recovery.Flow, email string, ids []string) (*form.HTMLForm, error) {
+	config, err := s.d.SecurityQuestionsManager().Config()
+	if err != nil {
+		return nil, err
+	}
+
+	f := form.NewHTMLForm(req.AppendTo(urlx.AppendPaths(s.c.SelfPublicURL(), RouteRecovery)).String())
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+	f.SetField(form.Field{Name: "email", Type: "email", Value: email, Disabled: true})
+	for _, id := range ids {
+		// Questions removed from the catalogue are still asked if the identity answered them.
+		label := id
+		if question, ok := config.Question(id); ok {
+			label = question.Label
+		}
+
+		f.SetField(form.Field{
+			Name:     answersPrefix + "." + id,
+			Type:     "text",
+			Required: true,
+			Messages: text.Messages{*text.NewRecoverySecurityQuestion(id, label)},
+		})
+	}
+	return f, nil
+}
+
+// askedEmail returns the email address the questions were asked for or an empty string.
+func (s *Strategy) askedEmail(req *recovery.Flow) string {
+	if req.Active.String() != s.RecoveryStrategyID() {
+		return ""
+	}
+
+	method, ok := req.Methods[s.RecoveryStrategyID()]
+	if !ok {
+		return ""
+	}
+
+	return fieldValue(methodForm(method.Config.FlowMethodConfigurator), "email")
+}
+
+// verifyAnswers returns the identity if the answers are correct. Unknown addresses and wrong answers
+// return the same error to prevent account enumeration.
+func (s *Strategy) verifyAnswers(r *http.Request, email string, answers map[string]string) (*identity.Identity, error) {
+	address, err := s.d.IdentityPool().FindRecoveryAddressByValue(r.Context(), identity.RecoveryAddressTypeEmail, email)
+	if errors.Is(err, sqlcon.ErrNoRows) {
+		return nil, schema.NewSecurityAnswersInvalidError("#/")
+	} else if err != nil {
+		return nil, err
+	}
+
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), address.IdentityID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.d.SecurityQuestionsManager().VerifySecurityAnswers(r.Context(), i, answers, "#/"); err != nil {
+		return nil, err
+	}
+
+	s.d.Audit().
+		WithRequest(r).
+		WithField("identity_id", i.ID).
+		WithSensitiveField("email_address", address.Value).
+		Info("Security questions have been answered to recover an account.")
+
+	return i, nil
+}
+
+func (s *Strategy) recoveryIssueSession(w http.ResponseWriter, r *http.Request, f *recovery.Flow, recovered *identity.Identity) {
+	f.Messages.Clear()
+	f.State = recovery.StatePassedChallenge
+	f.RecoveredIdentityID = uuid.NullUUID{
+		UUID:  recovered.ID,
+		Valid: true,
+	}
+	if err := s.d.RecoveryFlowPersister().UpdateRecoveryFlow(r.Context(), f); err != nil {
+		s.handleRecoveryError(w, r, f, nil, err)
+		return
+	}
+
+	sess := session.NewActiveSession(recovered, s.c, time.Now().UTC())
+	if err := s.d.SessionManager().CreateAndIssueCookie(r.Context(), w, r, sess); err != nil {
+		s.handleRecoveryError(w, r, f, nil, err)
+		return
+	}
+
+	sf, err := s.d.SettingsHandler().NewFlow(w, r, sess.Identity, flow.TypeBrowser)
+	if err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	sf.Messages.Set(text.NewRecoverySuccessful(time.Now().Add(s.c.SelfServiceFlowSettingsPrivilegedSessionMaxAge())))
+	if err := s.d.SettingsFlowPersister().UpdateSettingsFlow(r.Context(), sf); err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, sf.AppendTo(s.c.SelfServiceFlowSettingsUI()).String(), http.StatusFound)
+}
+
+func (s *Strategy) handleRecoveryError(w http.ResponseWriter, r *http.Request, req *recovery.Flow, body *completeSelfServiceRecoveryFlowWithSecurityQuestionsMethodParameters, err error) {
+	if req != nil {
+		method, ok := req.Methods[s.RecoveryStrategyID()]
+		if !ok {
+			s.d.RecoveryFlowErrorHandler().WriteFlowError(w, r, s.RecoveryStrategyID(), req, errors.WithStack(x.PseudoPanic.WithReasonf("Expected method %s to exist.", s.RecoveryStrategyID())))
+			return
+		}
+
+		// Once the questions were asked, the form is rebuilt so that the questions are kept.
+		if email := s.askedEmail(req); len(email) > 0 {
+			f, err := s.challengeForm(r, req, email, answerFields(methodForm(method.Config.FlowMethodConfigurator), answersPrefix))
+			if err != nil {
+				s.d.RecoveryFlowErrorHandler().WriteFlowError(w, r, s.RecoveryStrategyID(), req, err)
+				return
+			}
+			method.Config.FlowMethodConfigurator = &FlowMethod{HTMLForm: f}
+		} else {
+			var email string
+			if body != nil {
+				email = body.Body.Email
+			}
+
+			config, err := req.MethodToForm(s.RecoveryStrategyID())
+			if err != nil {
+				s.d.RecoveryFlowErrorHandler().WriteFlowError(w, r, s.RecoveryStrategyID(), req, err)
+				return
+			}
+
+			config.Reset()
+			config.SetCSRF(s.d.GenerateCSRFToken(r))
+			config.SetField(form.Field{Name: "email", Type: "email", Required: true, Value: email})
+		}
+	}
+
+	s.d.RecoveryFlowErrorHandler().WriteFlowError(w, r, s.RecoveryStrategyID(), req, err)
+}
+
+func (s *Strategy) decodeRecovery(r *http.Request, req *recovery.Flow, dest *completeSelfServiceRecoveryFlowWithSecurityQuestionsMethod) error {
+	var asked []string
+	if method, ok := req.Methods[s.RecoveryStrategyID()]; ok {
+		asked = answerFields(methodForm(method.Config.FlowMethodConfigurator), answersPrefix)
+	}
+
+	raw, err := s.d.SecurityQuestionsManager().AddAnswersToSchema(x.MustPkgerRead(pkger.Open("/selfservice/mfa/questions/.schema/recovery.schema.json")),
+		"properties."+answersPrefix, asked...)
+	if err != nil {
+		return err
+	}
+
+	compiler, err := decoderx.HTTPRawJSONSchemaCompiler(raw)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return s.hd.Decode(r, dest, compiler,
+		decoderx.HTTPDecoderSetValidatePayloads(false),
+		decoderx.HTTPDecoderJSONFollowsFormFormat(),
+	)
+}
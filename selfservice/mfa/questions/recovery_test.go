@@ -0,0 +1,187 @@
+package questions_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/pointerx"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	sdkp "github.com/zzpu/ums/internal/httpclient/client/public"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+func TestRecovery(t *testing.T) {
+	conf, reg := internal.NewFastRegistryWithMocks(t)
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/default.schema.json")
+	viper.Set(configuration.ViperKeySelfServiceBrowserDefaultReturnTo, "https://www.ory.sh")
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+recovery.StrategyRecoverySecurityQuestionsName+".enabled", true)
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+recovery.StrategyRecoverySecurityQuestionsName+".config",
+		map[string]interface{}{"questions": catalogue, "min_answers": 1, "max_attempts": 2})
+	viper.Set(configuration.ViperKeySelfServiceRecoveryEnabled, true)
+
+	_ = testhelpers.NewRecoveryUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewSettingsUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewLoginUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewErrorTestServer(t, reg)
+
+	publicTS, _ := testhelpers.NewKratosServer(t, reg)
+	sdk := testhelpers.NewSDKClient(publicTS)
+
+	newIdentity := func(t *testing.T, email string) *identity.Identity {
+		id := &identity.Identity{Traits: identity.Traits(`{"email":"` + email + `"}`)}
+		require.NoError(t, reg.SecurityQuestionsManager().SetSecurityAnswers(context.Background(), id,
+			map[string]string{"birth_city": "Hamburg, Germany"}, "#/security_answers"))
+		require.NoError(t, reg.IdentityManager().Create(context.Background(), id, identity.ManagerAllowWriteProtectedTraits))
+		return id
+	}
+
+	getFlow := func(t *testing.T, res *http.Response) []byte {
+		require.Contains(t, res.Request.URL.String(), conf.SelfServiceFlowRecoveryUI().String())
+		rs, err := sdk.Public.GetSelfServiceRecoveryFlow(sdkp.NewGetSelfServiceRecoveryFlowParams().
+			WithID(res.Request.URL.Query().Get("flow")))
+		require.NoError(t, err)
+
+		body, err := json.Marshal(rs.Payload)
+		require.NoError(t, err)
+		return body
+	}
+
+	post := func(t *testing.T, hc *http.Client, action string, values url.Values) *http.Response {
+		values.Set("csrf_token", x.FakeCSRFToken)
+		res, err := hc.PostForm(action, values)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		return res
+	}
+
+	// askQuestions submits the email address and returns the flow which contains the questions.
+	askQuestions := func(t *testing.T, hc *http.Client, email string) []byte {
+		f := testhelpers.InitializeRecoveryFlowViaBrowser(t, hc, publicTS).Payload
+		c := testhelpers.GetRecoveryFlowMethodConfig(t, f, recovery.StrategyRecoverySecurityQuestionsName)
+
+		body := getFlow(t, post(t, hc, pointerx.StringR(c.Action), url.Values{"email": {email}}))
+		assert.EqualValues(t, text.InfoSelfServiceRecoveryAskSecurityQuestions, gjson.GetBytes(body, "messages.0.id").Int(), "%s", body)
+		assert.EqualValues(t, email, gjson.GetBytes(body, "methods.security_questions.config.fields.#(name==email).value").String(), "%s", body)
+		return body
+	}
+
+	answer := func(t *testing.T, hc *http.Client, flow []byte, values url.Values) *http.Response {
+		return post(t, hc, gjson.GetBytes(flow, "methods.security_questions.config.action").String(), values)
+	}
+
+	expectError := func(t *testing.T, res *http.Response, expected text.ID) {
+		body := getFlow(t, res)
+		assert.EqualValues(t, expected, gjson.GetBytes(body, "methods.security_questions.config.messages.0.id").Int(), "%s", body)
+		// The questions are kept when the form is shown again.
+		assert.EqualValues(t, text.InfoSelfServiceRecoverySecurityQuestion,
+			gjson.GetBytes(body, "methods.security_questions.config.fields.#(type==text).messages.0.id").Int(), "%s", body)
+	}
+
+	t.Run("description=should not offer security questions to API flows", func(t *testing.T) {
+		f := testhelpers.InitializeRecoveryFlowViaAPI(t, new(http.Client), publicTS).Payload
+		assert.Empty(t, f.Methods[recovery.StrategyRecoverySecurityQuestionsName])
+	})
+
+	t.Run("description=should require the email address", func(t *testing.T) {
+		hc := testhelpers.NewClientWithCookies(t)
+		f := testhelpers.InitializeRecoveryFlowViaBrowser(t, hc, publicTS).Payload
+		c := testhelpers.GetRecoveryFlowMethodConfig(t, f, recovery.StrategyRecoverySecurityQuestionsName)
+
+		body := getFlow(t, post(t, hc, pointerx.StringR(c.Action), url.Values{}))
+		assert.EqualValues(t, text.ErrorValidationRequired, gjson.GetBytes(body, "methods.security_questions.config.fields.#(name==email).messages.0.id").Int(), "%s", body)
+	})
+
+	// asked returns the fields of the questions in the flow without their values.
+	asked := func(t *testing.T, body []byte) (fields []string) {
+		for _, field := range gjson.GetBytes(body, "methods.security_questions.config.fields.#(type==text)#").Array() {
+			fields = append(fields, gjson.Get(field.Raw, "@pretty:{\"sortKeys\":true}").String())
+		}
+		return fields
+	}
+
+	t.Run("description=should ask the catalogue questions for unknown email addresses", func(t *testing.T) {
+		hc := testhelpers.NewClientWithCookies(t)
+		body := askQuestions(t, hc, "unknown-security-questions@ory.sh")
+		fields := gjson.GetBytes(body, "methods.security_questions.config.fields.#(type==text)#.name").Array()
+		require.Len(t, fields, 1, "%s", body)
+
+		expectError(t, answer(t, hc, body, url.Values{fields[0].String(): {"Rex the dog"}}), text.ErrorValidationRecoverySecurityAnswersInvalid)
+	})
+
+	t.Run("description=should ask known and unknown email addresses the same way", func(t *testing.T) {
+		known := "known-security-questions@ory.sh"
+		newIdentity(t, known)
+		expected := asked(t, askQuestions(t, testhelpers.NewClientWithCookies(t), known))
+		require.Len(t, expected, 1)
+
+		distinct := map[string]bool{}
+		for k := 0; k < 20; k++ {
+			email := fmt.Sprintf("unknown-%d-security-questions@ory.sh", k)
+			actual := asked(t, askQuestions(t, testhelpers.NewClientWithCookies(t), email))
+			require.Len(t, actual, len(expected))
+			for _, field := range actual {
+				assert.Equal(t, "security_answers."+gjson.Get(field, "messages.0.context.question_id").String(), gjson.Get(field, "name").String())
+			}
+
+			// Repeated requests ask the same questions, just like for an existing account.
+			assert.Equal(t, actual, asked(t, askQuestions(t, testhelpers.NewClientWithCookies(t), " "+strings.ToUpper(email))))
+			distinct[strings.Join(actual, "")] = true
+		}
+
+		// The questions are spread over the catalogue instead of always being the first ones.
+		assert.Len(t, distinct, len(catalogue))
+		assert.True(t, distinct[strings.Join(expected, "")])
+	})
+
+	t.Run("description=should lock the method after too many wrong answers", func(t *testing.T) {
+		email := "lock-security-questions@ory.sh"
+		newIdentity(t, email)
+
+		hc := testhelpers.NewClientWithCookies(t)
+		body := askQuestions(t, hc, email)
+		assert.False(t, gjson.GetBytes(body, "methods.security_questions.config.fields.#(name==\"security_answers.first_pet\")").Exists(), "%s", body)
+
+		for k := 0; k < 2; k++ {
+			expectError(t, answer(t, hc, body, url.Values{"security_answers.birth_city": {"Berlin"}}), text.ErrorValidationRecoverySecurityAnswersInvalid)
+		}
+
+		expectError(t, answer(t, hc, body, url.Values{"security_answers.birth_city": {"Hamburg, Germany"}}), text.ErrorValidationRecoverySecurityQuestionsLocked)
+	})
+
+	t.Run("description=should recover the account", func(t *testing.T) {
+		email := "recover-security-questions@ory.sh"
+		id := newIdentity(t, email)
+
+		hc := testhelpers.NewClientWithCookies(t)
+		body := askQuestions(t, hc, email)
+
+		expectError(t, answer(t, hc, body, url.Values{"security_answers.birth_city": {"Berlin"}}), text.ErrorValidationRecoverySecurityAnswersInvalid)
+
+		res := answer(t, hc, body, url.Values{
+			"security_answers.birth_city": {"hamburg germany "},
+			"email":                       {"another-account@ory.sh"},
+		})
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		require.Contains(t, res.Request.URL.String(), conf.SelfServiceFlowSettingsUI().String())
+
+		attempts, err := reg.RecoverySecurityAttemptPersister().ListRecoverySecurityAttempts(context.Background(), id.ID, id.CreatedAt.Add(-1))
+		require.NoError(t, err)
+		assert.Empty(t, attempts)
+	})
+}
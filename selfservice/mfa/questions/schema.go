@@ -0,0 +1,7 @@
+package questions
+
+import (
+	"github.com/markbates/pkger"
+)
+
+var _ = pkger.Dir("/selfservice/mfa/questions/.schema")
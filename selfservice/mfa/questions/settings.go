@@ -0,0 +1,220 @@
+package questions
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/markbates/pkger"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/selfservice/flow/settings"
+	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteSettings = "/self-service/settings/methods/security_questions"
+)
+
+func (s *Strategy) RegisterSettingsRoutes(router *x.RouterPublic) {
+	s.d.CSRFHandler().ExemptPath(RouteSettings)
+	router.POST(RouteSettings, s.submitSettingsFlow)
+	router.GET(RouteSettings, s.submitSettingsFlow)
+}
+
+func (s *Strategy) SettingsStrategyID() string {
+	return recovery.StrategyRecoverySecurityQuestionsName
+}
+
+// nolint:deadcode,unused
+// swagger:parameters completeSelfServiceSettingsFlowWithSecurityQuestionsMethod
+type completeSelfServiceSettingsFlowWithSecurityQuestionsMethod struct {
+	// in: body
+	Body CompleteSelfServiceSettingsFlowWithSecurityQuestionsMethod
+
+	// Flow is flow ID.
+	//
+	// in: query
+	Flow string `json:"flow"`
+}
+
+type CompleteSelfServiceSettingsFlowWithSecurityQuestionsMethod struct {
+	// SecurityAnswers are the answers keyed by the question ID. All previously set answers are replaced.
+	SecurityAnswers map[string]string `json:"security_answers"`
+
+	// CSRFToken is the anti-CSRF token
+	//
+	// type: string
+	CSRFToken string `json:"csrf_token"`
+
+	// Flow is flow ID.
+	//
+	// swagger:ignore
+	Flow string `json:"flow"`
+}
+
+func (p *CompleteSelfServiceSettingsFlowWithSecurityQuestionsMethod) GetFlowID() uuid.UUID {
+	return x.ParseUUID(p.Flow)
+}
+
+func (p *CompleteSelfServiceSettingsFlowWithSecurityQuestionsMethod) SetFlowID(rid uuid.UUID) {
+	p.Flow = rid.String()
+}
+
+// swagger:route POST /self-service/settings/methods/security_questions public completeSelfServiceSettingsFlowWithSecurityQuestionsMethod
+//
+// Complete Settings Flow with the Security Questions Method
+//
+// Use this endpoint to set the answers to the security questions by sending `security_answers.<question_id>`.
+// All previously set answers are replaced. This endpoint behaves differently for API and browser flows.
+//
+// API-initiated flows expect `application/json` to be sent in the body and respond with
+//   - HTTP 200 and an application/json body with the session token on success;
+//   - HTTP 302 redirect to a fresh settings flow if the original flow expired with the appropriate error messages set;
+//   - HTTP 400 on form validation errors.
+//   - HTTP 401 when the endpoint is called without a valid session token.
+//   - HTTP 403 when `selfservice.flows.settings.privileged_session_max_age` was reached.
+//     Implies that the user needs to re-authenticate.
+//
+// Browser flows expect `application/x-www-form-urlencoded` to be sent in the body and responds with
+//   - a HTTP 302 redirect to the post/after settings URL or the `return_to` value if it was set and if the flow succeeded;
+//   - a HTTP 302 redirect to the Settings UI URL with the flow ID containing the validation errors otherwise.
+//   - a HTTP 302 redirect to the login endpoint when `selfservice.flows.settings.privileged_session_max_age` was reached.
+//
+//     Consumes:
+//     - application/json
+//     - application/x-www-form-urlencoded
+//
+//     Produces:
+//     - application/json
+//
+//     Security:
+//       sessionToken:
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: settingsViaApiResponse
+//       302: emptyResponse
+//       400: settingsFlow
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (s *Strategy) submitSettingsFlow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var p CompleteSelfServiceSettingsFlowWithSecurityQuestionsMethod
+	ctxUpdate, err := settings.PrepareUpdate(s.d, w, r, settings.ContinuityKey(s.SettingsStrategyID()), &p)
+	if errors.Is(err, settings.ErrContinuePreviousAction) {
+		s.continueSettingsFlow(w, r, ctxUpdate, &p)
+		return
+	} else if err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, &p, err)
+		return
+	}
+
+	if err := s.decodeSettingsFlow(r, &p); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, &p, err)
+		return
+	}
+
+	// This does not come from the payload!
+	p.Flow = ctxUpdate.Flow.ID.String()
+	s.continueSettingsFlow(w, r, ctxUpdate, &p)
+}
+
+func (s *Strategy) decodeSettingsFlow(r *http.Request, dest interface{}) error {
+	raw, err := s.d.SecurityQuestionsManager().AddAnswersToSchema(x.MustPkgerRead(pkger.Open("/selfservice/mfa/questions/.schema/settings.schema.json")),
+		"properties."+answersPrefix)
+	if err != nil {
+		return err
+	}
+
+	compiler, err := decoderx.HTTPRawJSONSchemaCompiler(raw)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return s.hd.Decode(r, dest, compiler,
+		decoderx.HTTPDecoderSetValidatePayloads(false),
+		decoderx.HTTPDecoderJSONFollowsFormFormat(),
+	)
+}
+
+func (s *Strategy) continueSettingsFlow(
+	w http.ResponseWriter, r *http.Request,
+	ctxUpdate *settings.UpdateContext, p *CompleteSelfServiceSettingsFlowWithSecurityQuestionsMethod,
+) {
+	if err := flow.VerifyRequest(r, ctxUpdate.Flow.Type, s.d.GenerateCSRFToken, p.CSRFToken); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	if ctxUpdate.Session.AuthenticatedAt.Add(s.c.SelfServiceFlowSettingsPrivilegedSessionMaxAge()).Before(time.Now()) {
+		s.handleSettingsError(w, r, ctxUpdate, p, errors.WithStack(settings.NewFlowNeedsReAuth()))
+		return
+	}
+
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), ctxUpdate.Session.Identity.ID)
+	if err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	if err := s.d.SecurityQuestionsManager().SetSecurityAnswers(r.Context(), i, p.SecurityAnswers, "#/"+answersPrefix); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	if err := s.d.SettingsHookExecutor().PostSettingsHook(w, r, s.SettingsStrategyID(), ctxUpdate, i, settings.WithCallback(func(ctxUpdate *settings.UpdateContext) error {
+		return s.PopulateSettingsMethod(r, ctxUpdate.Session.Identity, ctxUpdate.Flow)
+	})); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+}
+
+func (s *Strategy) PopulateSettingsMethod(r *http.Request, id *identity.Identity, f *settings.Flow) error {
+	hf := &form.HTMLForm{Action: urlx.CopyWithQuery(urlx.AppendPaths(s.c.SelfPublicURL(), RouteSettings),
+		url.Values{"flow": {f.ID.String()}}).String(), Method: "POST"}
+	if err := s.d.SecurityQuestionsManager().SetSecurityFormFields(answersPrefix, hf); err != nil {
+		return err
+	}
+	hf.SetCSRF(s.d.GenerateCSRFToken(r))
+
+	f.Methods[s.SettingsStrategyID()] = &settings.FlowMethod{
+		Method: s.SettingsStrategyID(),
+		Config: &settings.FlowMethodConfig{FlowMethodConfigurator: &FlowMethod{HTMLForm: hf}},
+	}
+	return nil
+}
+
+func (s *Strategy) handleSettingsError(w http.ResponseWriter, r *http.Request, ctxUpdate *settings.UpdateContext, p *CompleteSelfServiceSettingsFlowWithSecurityQuestionsMethod, err error) {
+	// Do not pause flow if the flow type is an API flow as we can't save cookies in those flows.
+	if e := new(settings.FlowNeedsReAuth); errors.As(err, &e) && ctxUpdate.Flow != nil && ctxUpdate.Flow.Type == flow.TypeBrowser {
+		if err := s.d.ContinuityManager().Pause(r.Context(), w, r,
+			settings.ContinuityKey(s.SettingsStrategyID()), settings.ContinuityOptions(p, ctxUpdate.Session.Identity)...); err != nil {
+			s.d.SettingsFlowErrorHandler().WriteFlowError(w, r, s.SettingsStrategyID(), ctxUpdate.Flow, ctxUpdate.Session.Identity, err)
+			return
+		}
+	}
+
+	var id *identity.Identity
+	if ctxUpdate.Flow != nil {
+		// The answers are never sent back, only the questions are kept.
+		if err := s.PopulateSettingsMethod(r, ctxUpdate.Session.Identity, ctxUpdate.Flow); err != nil {
+			s.d.SettingsFlowErrorHandler().WriteFlowError(w, r, s.SettingsStrategyID(), ctxUpdate.Flow, ctxUpdate.Session.Identity, err)
+			return
+		}
+		id = ctxUpdate.Session.Identity
+	}
+
+	s.d.SettingsFlowErrorHandler().WriteFlowError(w, r, s.SettingsStrategyID(), ctxUpdate.Flow, id, err)
+}
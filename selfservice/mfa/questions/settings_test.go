@@ -0,0 +1,132 @@
+package questions_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/selfservice/flow/settings"
+	"github.com/zzpu/ums/selfservice/mfa/questions"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+var catalogue = []map[string]interface{}{
+	{"id": "first_pet", "label": "What was the name of your first pet?"},
+	{"id": "birth_city", "label": "In which city were you born?"},
+}
+
+func TestSettings(t *testing.T) {
+	conf, reg := internal.NewFastRegistryWithMocks(t)
+	viper.Set(configuration.ViperKeySelfServiceBrowserDefaultReturnTo, "https://www.ory.sh/")
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/default.schema.json")
+	testhelpers.StrategyEnable(recovery.StrategyRecoverySecurityQuestionsName, true)
+	testhelpers.StrategyEnable(settings.StrategyProfile, true)
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+recovery.StrategyRecoverySecurityQuestionsName+".config",
+		map[string]interface{}{"questions": catalogue, "min_length": 4})
+
+	_ = testhelpers.NewSettingsUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewErrorTestServer(t, reg)
+	_ = testhelpers.NewLoginUIWith401Response(t)
+	viper.Set(configuration.ViperKeySelfServiceSettingsPrivilegedAuthenticationAfter, "5m")
+
+	publicTS, _ := testhelpers.NewKratosServer(t, reg)
+
+	submit := func(t *testing.T, isAPI bool, hc *http.Client, values func(url.Values), expectedStatusCode int) string {
+		return testhelpers.SubmitSettingsForm(t, isAPI, hc, publicTS, values,
+			recovery.StrategyRecoverySecurityQuestionsName, expectedStatusCode,
+			testhelpers.ExpectURL(isAPI, publicTS.URL+questions.RouteSettings, conf.SelfServiceFlowSettingsUI().String()))
+	}
+
+	answers := func(t *testing.T, id *identity.Identity) []identity.RecoverySecurityAnswer {
+		i, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), id.ID)
+		require.NoError(t, err)
+		return i.RecoverySecurityAnswers
+	}
+
+	for _, tc := range []struct {
+		d     string
+		isAPI bool
+	}{
+		{d: "type=api", isAPI: true},
+		{d: "type=browser", isAPI: false},
+	} {
+		t.Run(tc.d, func(t *testing.T) {
+			id := &identity.Identity{
+				ID:       x.NewUUID(),
+				Traits:   identity.Traits(`{}`),
+				SchemaID: configuration.DefaultIdentityTraitsSchemaID,
+			}
+
+			var hc *http.Client
+			if tc.isAPI {
+				hc = testhelpers.NewHTTPClientWithIdentitySessionToken(t, reg, id)
+			} else {
+				hc = testhelpers.NewHTTPClientWithIdentitySessionCookie(t, reg, id)
+			}
+
+			path := func(p string) string {
+				return testhelpers.ExpectURL(tc.isAPI, "flow."+p, p)
+			}
+
+			t.Run("description=should show the questions", func(t *testing.T) {
+				_ = submit(t, tc.isAPI, hc, func(v url.Values) {
+					assert.Contains(t, v, "security_answers.first_pet")
+					assert.Contains(t, v, "security_answers.birth_city")
+					v.Set("security_answers.first_pet", "x")
+				}, testhelpers.ExpectStatusCode(tc.isAPI, http.StatusBadRequest, http.StatusOK))
+			})
+
+			t.Run("description=should reject short answers", func(t *testing.T) {
+				actual := submit(t, tc.isAPI, hc, func(v url.Values) {
+					v.Set("security_answers.first_pet", "a b")
+					v.Set("security_answers.birth_city", "Berlin")
+				}, testhelpers.ExpectStatusCode(tc.isAPI, http.StatusBadRequest, http.StatusOK))
+
+				assert.EqualValues(t, text.ErrorValidationMinLength,
+					gjson.Get(actual, "methods.security_questions.config.fields.#(name==\"security_answers.first_pet\").messages.1.id").Int(), "%s", actual)
+				assert.Empty(t, answers(t, id))
+			})
+
+			t.Run("description=should require all questions to be answered", func(t *testing.T) {
+				actual := submit(t, tc.isAPI, hc, func(v url.Values) {
+					v.Set("security_answers.first_pet", "Rex the dog")
+					v.Del("security_answers.birth_city")
+				}, testhelpers.ExpectStatusCode(tc.isAPI, http.StatusBadRequest, http.StatusOK))
+
+				assert.EqualValues(t, text.ErrorValidationRequired,
+					gjson.Get(actual, "methods.security_questions.config.fields.#(name==\"security_answers.birth_city\").messages.1.id").Int(), "%s", actual)
+				assert.Empty(t, answers(t, id))
+			})
+
+			t.Run("description=should set the answers", func(t *testing.T) {
+				actual := submit(t, tc.isAPI, hc, func(v url.Values) {
+					v.Set("security_answers.first_pet", "Rex the dog")
+					v.Set("security_answers.birth_city", "Berlin")
+				}, http.StatusOK)
+
+				assert.EqualValues(t, settings.StateSuccess, gjson.Get(actual, path("state")).String(), "%s", actual)
+				assert.Empty(t, gjson.Get(actual, path("methods.security_questions.config.fields.#(name==\"security_answers.first_pet\").value")).String(), "%s", actual)
+
+				stored := answers(t, id)
+				require.Len(t, stored, 2)
+				for _, answer := range stored {
+					assert.NotContains(t, answer.Answer, "rex")
+					assert.NotContains(t, answer.Answer, "berlin")
+				}
+			})
+		})
+	}
+}
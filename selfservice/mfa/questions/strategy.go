@@ -0,0 +1,60 @@
+package questions
+
+import (
+	"github.com/ory/x/decoderx"
+
+	"github.com/zzpu/ums/continuity"
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/errorx"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/selfservice/flow/settings"
+	"github.com/zzpu/ums/session"
+	"github.com/zzpu/ums/x"
+)
+
+var _ recovery.Strategy = new(Strategy)
+var _ recovery.PublicHandler = new(Strategy)
+var _ settings.Strategy = new(Strategy)
+
+type strategyDependencies interface {
+	x.LoggingProvider
+	x.WriterProvider
+	x.CSRFTokenGeneratorProvider
+	x.CSRFProvider
+
+	continuity.ManagementProvider
+
+	errorx.ManagementProvider
+
+	recovery.ErrorHandlerProvider
+	recovery.FlowPersistenceProvider
+	recovery.StrategyProvider
+
+	settings.HandlerProvider
+	settings.FlowPersistenceProvider
+	settings.HookExecutorProvider
+	settings.ErrorHandlerProvider
+
+	identity.PoolProvider
+	identity.PrivilegedPoolProvider
+
+	session.HandlerProvider
+	session.ManagementProvider
+
+	ManagementProvider
+}
+
+type Strategy struct {
+	c  configuration.Provider
+	d  strategyDependencies
+	hd *decoderx.HTTP
+}
+
+func NewStrategy(d strategyDependencies, c configuration.Provider) *Strategy {
+	return &Strategy{
+		c:  c,
+		d:  d,
+		hd: decoderx.NewHTTP(),
+	}
+}
@@ -1,10 +0,0 @@
-package questions
-
-// func NewRecoveryAskSecurityQuestions() *Message {
-// 	return &Message{
-// 		ID:   InfoSelfServiceRecoveryAskSecurityQuestions,
-// 		Type: Info,
-// 		Text: "Please answer the following questions to verify it is really you. These are your questions set up during registration or when you updated your profile.",
-// 	}
-// }
-//
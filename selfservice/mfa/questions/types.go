@@ -0,0 +1,52 @@
+package questions
+
+import (
+	"strings"
+
+	"github.com/zzpu/ums/selfservice/form"
+)
+
+// FlowMethod contains the configuration for this selfservice strategy.
+type FlowMethod struct {
+	*form.HTMLForm
+}
+
+// methodForm returns the form of the method as it was stored in the flow.
+func methodForm(c interface{}) *form.HTMLForm {
+	switch f := c.(type) {
+	case *form.HTMLForm:
+		return f
+	case *FlowMethod:
+		return f.HTMLForm
+	}
+	return nil
+}
+
+// fieldValue returns the string value of the field with the given name.
+func fieldValue(f *form.HTMLForm, name string) string {
+	if f == nil {
+		return ""
+	}
+
+	for _, field := range f.Fields {
+		if field.Name == name {
+			value, _ := field.Value.(string)
+			return value
+		}
+	}
+	return ""
+}
+
+// answerFields returns the IDs of the questions which were asked in the form.
+func answerFields(f *form.HTMLForm, prefix string) (ids []string) {
+	if f == nil {
+		return nil
+	}
+
+	for _, field := range f.Fields {
+		if strings.HasPrefix(field.Name, prefix+".") {
+			ids = append(ids, strings.TrimPrefix(field.Name, prefix+"."))
+		}
+	}
+	return ids
+}
@@ -0,0 +1,383 @@
+package backupcodes
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/markbates/pkger"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/sqlxx"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/schema"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/selfservice/strategy/password"
+	"github.com/zzpu/ums/session"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteRecovery = "/self-service/recovery/methods/backup_codes"
+)
+
+func (s *Strategy) RecoveryStrategyID() string {
+	return recovery.StrategyRecoveryBackupCodesName
+}
+
+func (s *Strategy) RegisterPublicRecoveryRoutes(public *x.RouterPublic) {
+	redirect := session.RedirectOnAuthenticated(s.c)
+	public.POST(RouteRecovery, s.d.SessionHandler().IsNotAuthenticated(s.handleRecovery, redirect))
+}
+
+func (s *Strategy) PopulateRecoveryMethod(r *http.Request, req *recovery.Flow) error {
+	// Recovering with a backup code issues a session cookie which API clients can not use.
+	if req.Type != flow.TypeBrowser {
+		return nil
+	}
+
+	f := form.NewHTMLForm(req.AppendTo(urlx.AppendPaths(s.c.SelfPublicURL(), RouteRecovery)).String())
+
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+	f.SetField(form.Field{Name: "email", Type: "email", Required: true})
+	f.SetField(form.Field{Name: "backup_code", Type: "text", Required: true})
+
+	req.Methods[s.RecoveryStrategyID()] = &recovery.FlowMethod{
+		Method: s.RecoveryStrategyID(),
+		Config: &recovery.FlowMethodConfig{FlowMethodConfigurator: &FlowMethod{HTMLForm: f}},
+	}
+	return nil
+}
+
+// swagger:parameters completeSelfServiceRecoveryFlowWithBackupCodesMethod
+type completeSelfServiceRecoveryFlowWithBackupCodesMethodParameters struct {
+	// in: body
+	Body completeSelfServiceRecoveryFlowWithBackupCodesMethod
+
+	// The Flow ID
+	//
+	// format: uuid
+	// in: query
+	Flow string `json:"flow"`
+}
+
+func (m *completeSelfServiceRecoveryFlowWithBackupCodesMethodParameters) GetFlow() uuid.UUID {
+	return x.ParseUUID(m.Flow)
+}
+
+type completeSelfServiceRecoveryFlowWithBackupCodesMethod struct {
+	// Email to Recover
+	//
+	// The recovery email address of the account to recover.
+	//
+	// format: email
+	// in: body
+	Email string `json:"email"`
+
+	// Backup Code
+	//
+	// One of the unused backup codes of the account.
+	//
+	// in: body
+	BackupCode string `json:"backup_code"`
+
+	// Sending the anti-csrf token is only required for browser login flows.
+	CSRFToken string `form:"csrf_token" json:"csrf_token"`
+}
+
+// swagger:route POST /self-service/recovery/methods/backup_codes public completeSelfServiceRecoveryFlowWithBackupCodesMethod
+//
+// Complete Recovery Flow with Backup Codes Method
+//
+// Use this endpoint to recover an account with one of its backup codes. The code can only be used once.
+// This method is only available for browser-initiated flows.
+//
+// The server responds with a HTTP 302 Found redirect either to the Settings UI URL (if the code was valid)
+// and instructs the user to update their password, or a redirect to the Recover UI URL with the Recovery Flow ID
+// which contains an error message that the backup code was invalid.
+//
+//     Consumes:
+//     - application/x-www-form-urlencoded
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       302: emptyResponse
+//       400: recoveryFlow
+//       500: genericError
+func (s *Strategy) handleRecovery(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	body := &completeSelfServiceRecoveryFlowWithBackupCodesMethodParameters{Flow: r.URL.Query().Get("flow")}
+
+	req, err := s.d.RecoveryFlowPersister().GetRecoveryFlow(r.Context(), body.GetFlow())
+	if err != nil {
+		s.handleRecoveryError(w, r, nil, body, err)
+		return
+	}
+
+	if err := req.Valid(); err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	if req.Type != flow.TypeBrowser {
+		s.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason("Backup codes can only be used in browser-initiated recovery flows.")))
+		return
+	}
+
+	if req.State != recovery.StateChooseMethod {
+		s.handleRecoveryError(w, r, req, body, schema.NewBackupCodeInvalidError("#/backup_code"))
+		return
+	}
+
+	if err := s.decodeRecovery(r, &body.Body); err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	if len(body.Body.Email) == 0 {
+		s.handleRecoveryError(w, r, req, body, schema.NewRequiredError("#/email", "email"))
+		return
+	} else if len(body.Body.BackupCode) == 0 {
+		s.handleRecoveryError(w, r, req, body, schema.NewRequiredError("#/backup_code", "backup_code"))
+		return
+	}
+
+	if err := flow.VerifyRequest(r, req.Type, s.d.GenerateCSRFToken, body.Body.CSRFToken); err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	i, remaining, err := s.useCode(r, body.Body.Email, body.Body.BackupCode)
+	if err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	s.recoveryIssueSession(w, r, req, i, remaining)
+}
+
+// useCode marks the backup code as used and returns the identity it belongs to and the number of
+// remaining codes. Unknown addresses and wrong codes return the same error to prevent account enumeration.
+func (s *Strategy) useCode(r *http.Request, email, code string) (*identity.Identity, int, error) {
+	config, err := s.Config()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The attempt is counted before the code is checked so that concurrent requests can not exceed the limit.
+	if err := s.countAttempt(r, config, email); err != nil {
+		return nil, 0, err
+	}
+
+	address, err := s.d.IdentityPool().FindRecoveryAddressByValue(r.Context(), identity.RecoveryAddressTypeEmail, email)
+	if errors.Is(err, sqlcon.ErrNoRows) {
+		return nil, 0, s.compareDecoyCodes(config, code)
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), address.IdentityID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	creds, ok := i.GetCredentials(s.ID())
+	if !ok {
+		return nil, 0, s.compareDecoyCodes(config, code)
+	}
+
+	o, err := s.credentials(i)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The code is hashed once per secret and compared to all codes to not leak through timing how many codes
+	// were used or which one matched.
+	hashes := make([]string, len(s.c.SecretsDefault()))
+	for k, secret := range s.c.SecretsDefault() {
+		hashes[k] = HashCode(secret, code)
+	}
+
+	found := -1
+	for k := range o.Codes {
+		for _, hashed := range hashes {
+			if subtle.ConstantTimeCompare([]byte(hashed), []byte(o.Codes[k].HMAC)) == 1 && o.Codes[k].UsedAt == nil {
+				found = k
+			}
+		}
+	}
+
+	if found < 0 {
+		return nil, 0, schema.NewBackupCodeInvalidError("#/backup_code")
+	}
+
+	now := time.Now().UTC().Round(time.Second)
+	o.Codes[found].UsedAt = &now
+	co, err := json.Marshal(o)
+	if err != nil {
+		return nil, 0, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode backup codes to JSON: %s", err))
+	}
+
+	// The update fails if the codes were changed since they were loaded, for example because the same code was
+	// used by a concurrent request.
+	if err := s.d.PrivilegedIdentityPool().UpdateIdentityCredentialsConfig(r.Context(), creds, co); errors.Is(err, sqlcon.ErrNoRows) {
+		return nil, 0, schema.NewBackupCodeInvalidError("#/backup_code")
+	} else if err != nil {
+		return nil, 0, err
+	}
+	i.SetCredentials(s.ID(), *creds)
+
+	if config.MaxAttempts > 0 {
+		if err := s.d.LoginFailurePersister().DeleteLoginFailuresByIdentifier(r.Context(), attemptsIdentifier(email)); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	s.d.Audit().
+		WithRequest(r).
+		WithField("identity_id", i.ID).
+		WithSensitiveField("email_address", address.Value).
+		Info("A backup code has been used to recover an account.")
+
+	return i, o.Remaining(), nil
+}
+
+// attemptsIdentifier returns the identifier under which attempts to recover the address are counted. It can
+// not collide with password identifiers because those never start with the prefix.
+func attemptsIdentifier(email string) string {
+	return "backup_codes:" + email
+}
+
+// countAttempt stores an attempt to recover the address and returns an error if too many attempts were made.
+// Addresses which do not exist are counted as well to prevent account enumeration.
+func (s *Strategy) countAttempt(r *http.Request, c *Configuration, email string) error {
+	if c.MaxAttempts <= 0 {
+		return nil
+	}
+
+	if err := s.d.LoginFailurePersister().CreateLoginFailure(r.Context(), &password.LoginFailure{
+		Identifier: attemptsIdentifier(email),
+	}); err != nil {
+		return err
+	}
+
+	failures, err := s.d.LoginFailurePersister().ListLoginFailuresByIdentifier(r.Context(), attemptsIdentifier(email), time.Now().UTC().Add(-c.lockoutDuration()))
+	if err != nil {
+		return err
+	}
+
+	if len(failures) > c.MaxAttempts {
+		s.d.Audit().
+			WithRequest(r).
+			WithSensitiveField("email_address", email).
+			Info("Rejected a backup code because too many attempts were made.")
+		return schema.NewLoginLockedError(failures[len(failures)-c.MaxAttempts].CreatedAt.Add(c.lockoutDuration()))
+	}
+
+	return nil
+}
+
+// compareDecoyCodes does the same work as checking the codes of an identity so that unknown addresses take as
+// long as known ones. It always returns the invalid backup code error.
+func (s *Strategy) compareDecoyCodes(c *Configuration, code string) error {
+	decoy := []byte(HashCode(s.c.SecretsDefault()[0], newCode()))
+	for _, secret := range s.c.SecretsDefault() {
+		hashed := []byte(HashCode(secret, code))
+		for k := 0; k < c.Count; k++ {
+			_ = subtle.ConstantTimeCompare(hashed, decoy)
+		}
+	}
+
+	return schema.NewBackupCodeInvalidError("#/backup_code")
+}
+
+func (s *Strategy) recoveryIssueSession(w http.ResponseWriter, r *http.Request, f *recovery.Flow, recovered *identity.Identity, remaining int) {
+	f.Messages.Clear()
+	f.Active = sqlxx.NullString(s.RecoveryStrategyID())
+	f.State = recovery.StatePassedChallenge
+	f.RecoveredIdentityID = uuid.NullUUID{
+		UUID:  recovered.ID,
+		Valid: true,
+	}
+	if err := s.d.RecoveryFlowPersister().UpdateRecoveryFlow(r.Context(), f); err != nil {
+		s.handleRecoveryError(w, r, f, nil, err)
+		return
+	}
+
+	sess := session.NewActiveSession(recovered, s.c, time.Now().UTC())
+	if err := s.d.SessionManager().CreateAndIssueCookie(r.Context(), w, r, sess); err != nil {
+		s.handleRecoveryError(w, r, f, nil, err)
+		return
+	}
+
+	sf, err := s.d.SettingsHandler().NewFlow(w, r, sess.Identity, flow.TypeBrowser)
+	if err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	config, err := s.Config()
+	if err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	sf.Messages.Set(text.NewRecoverySuccessful(time.Now().Add(s.c.SelfServiceFlowSettingsPrivilegedSessionMaxAge())))
+	if remaining <= config.LowThreshold {
+		sf.Messages.Add(text.NewInfoSelfServiceSettingsBackupCodesLow(remaining))
+	}
+	if err := s.d.SettingsFlowPersister().UpdateSettingsFlow(r.Context(), sf); err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, sf.AppendTo(s.c.SelfServiceFlowSettingsUI()).String(), http.StatusFound)
+}
+
+func (s *Strategy) handleRecoveryError(w http.ResponseWriter, r *http.Request, req *recovery.Flow, body *completeSelfServiceRecoveryFlowWithBackupCodesMethodParameters, err error) {
+	if req != nil {
+		config, err := req.MethodToForm(s.RecoveryStrategyID())
+		if err != nil {
+			s.d.RecoveryFlowErrorHandler().WriteFlowError(w, r, s.RecoveryStrategyID(), req, err)
+			return
+		}
+
+		var email string
+		if body != nil {
+			email = body.Body.Email
+		}
+
+		config.Reset()
+		config.SetCSRF(s.d.GenerateCSRFToken(r))
+		config.SetField(form.Field{Name: "email", Type: "email", Required: true, Value: email})
+		config.SetField(form.Field{Name: "backup_code", Type: "text", Required: true})
+	}
+
+	s.d.RecoveryFlowErrorHandler().WriteFlowError(w, r, s.RecoveryStrategyID(), req, err)
+}
+
+func (s *Strategy) decodeRecovery(r *http.Request, dest *completeSelfServiceRecoveryFlowWithBackupCodesMethod) error {
+	compiler, err := decoderx.HTTPRawJSONSchemaCompiler(x.MustPkgerRead(pkger.Open("/selfservice/strategy/backupcodes/.schema/recovery.schema.json")))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return s.hd.Decode(r, dest, compiler,
+		decoderx.HTTPDecoderSetValidatePayloads(false),
+		decoderx.HTTPDecoderJSONFollowsFormFormat(),
+	)
+}
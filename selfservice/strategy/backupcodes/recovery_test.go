@@ -0,0 +1,173 @@
+package backupcodes_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/pointerx"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	sdkp "github.com/zzpu/ums/internal/httpclient/client/public"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/selfservice/strategy/backupcodes"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+func TestRecovery(t *testing.T) {
+	conf, reg := internal.NewFastRegistryWithMocks(t)
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/default.schema.json")
+	viper.Set(configuration.ViperKeySelfServiceBrowserDefaultReturnTo, "https://www.ory.sh")
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+recovery.StrategyRecoveryBackupCodesName+".enabled", true)
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+recovery.StrategyRecoveryBackupCodesName+".config", map[string]interface{}{"low_threshold": 1})
+	viper.Set(configuration.ViperKeySelfServiceRecoveryEnabled, true)
+
+	_ = testhelpers.NewRecoveryUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewSettingsUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewLoginUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewErrorTestServer(t, reg)
+
+	publicTS, adminTS := testhelpers.NewKratosServer(t, reg)
+	sdk := testhelpers.NewSDKClient(publicTS)
+	adminSDK := testhelpers.NewSDKClient(adminTS)
+
+	email := "recover-backup-codes@ory.sh"
+	id := &identity.Identity{Traits: identity.Traits(`{"email":"` + email + `"}`)}
+	require.NoError(t, reg.IdentityManager().Create(context.Background(), id, identity.ManagerAllowWriteProtectedTraits))
+
+	codes := []string{"abcde-fghjk", "mnpqr-stuvw"}
+	setCodes := func(t *testing.T, id *identity.Identity) {
+		var o backupcodes.CredentialsConfig
+		for _, code := range codes {
+			o.Codes = append(o.Codes, backupcodes.Code{HMAC: backupcodes.HashCode(conf.SecretsDefault()[0], code)})
+		}
+		config, err := json.Marshal(o)
+		require.NoError(t, err)
+		id.SetCredentials(identity.CredentialsTypeBackupCodes, identity.Credentials{
+			Type: identity.CredentialsTypeBackupCodes, Identifiers: []string{}, Config: config})
+		require.NoError(t, reg.PrivilegedIdentityPool().UpdateIdentity(context.Background(), id))
+	}
+	setCodes(t, id)
+
+	submit := func(t *testing.T, values url.Values) *http.Response {
+		hc := testhelpers.NewClientWithCookies(t)
+		f := testhelpers.InitializeRecoveryFlowViaBrowser(t, hc, publicTS).Payload
+		c := testhelpers.GetRecoveryFlowMethodConfig(t, f, recovery.StrategyRecoveryBackupCodesName)
+
+		values.Set("csrf_token", x.FakeCSRFToken)
+		res, err := hc.PostForm(pointerx.StringR(c.Action), values)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		return res
+	}
+
+	expectInvalidCode := func(t *testing.T, res *http.Response) {
+		assert.Contains(t, res.Request.URL.String(), conf.SelfServiceFlowRecoveryUI().String())
+		rs, err := sdk.Public.GetSelfServiceRecoveryFlow(sdkp.NewGetSelfServiceRecoveryFlowParams().
+			WithID(res.Request.URL.Query().Get("flow")))
+		require.NoError(t, err)
+
+		body, err := json.Marshal(rs.Payload)
+		require.NoError(t, err)
+		assert.EqualValues(t, text.ErrorValidationRecoveryBackupCodeInvalidOrAlreadyUsed,
+			gjson.GetBytes(body, "methods.backup_codes.config.fields.#(name==backup_code).messages.0.id").Int(), "%s", body)
+		assert.EqualValues(t, email, gjson.GetBytes(body, "methods.backup_codes.config.fields.#(name==email).value").String(), "%s", body)
+	}
+
+	t.Run("description=should not offer backup codes to API flows", func(t *testing.T) {
+		f := testhelpers.InitializeRecoveryFlowViaAPI(t, new(http.Client), publicTS).Payload
+		assert.Empty(t, f.Methods[recovery.StrategyRecoveryBackupCodesName])
+	})
+
+	t.Run("description=should fail with an unknown code", func(t *testing.T) {
+		expectInvalidCode(t, submit(t, url.Values{"email": {email}, "backup_code": {"zzzzz-zzzzz"}}))
+	})
+
+	t.Run("description=should fail with an unknown email address", func(t *testing.T) {
+		res := submit(t, url.Values{"email": {"not-" + email}, "backup_code": {codes[0]}})
+		assert.Contains(t, res.Request.URL.String(), conf.SelfServiceFlowRecoveryUI().String())
+	})
+
+	t.Run("description=should recover the account with a backup code", func(t *testing.T) {
+		res := submit(t, url.Values{"email": {email}, "backup_code": {codes[0]}})
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		require.Contains(t, res.Request.URL.String(), conf.SelfServiceFlowSettingsUI().String())
+
+		sr, err := adminSDK.Public.GetSelfServiceSettingsFlow(sdkp.NewGetSelfServiceSettingsFlowParams().
+			WithID(res.Request.URL.Query().Get("flow")), nil)
+		require.NoError(t, err)
+
+		require.Len(t, sr.Payload.Messages, 2)
+		assert.EqualValues(t, text.InfoSelfServiceSettingsBackupCodesLow, sr.Payload.Messages[1].ID)
+
+		i, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), id.ID)
+		require.NoError(t, err)
+		var o backupcodes.CredentialsConfig
+		_, err = i.ParseCredentials(identity.CredentialsTypeBackupCodes, &o)
+		require.NoError(t, err)
+		assert.Equal(t, 1, o.Remaining())
+	})
+
+	t.Run("description=should not accept a used code", func(t *testing.T) {
+		expectInvalidCode(t, submit(t, url.Values{"email": {email}, "backup_code": {codes[0]}}))
+	})
+
+	t.Run("description=should accept codes regardless of formatting", func(t *testing.T) {
+		res := submit(t, url.Values{"email": {email}, "backup_code": {"MNPQR STUVW"}})
+		assert.Contains(t, res.Request.URL.String(), conf.SelfServiceFlowSettingsUI().String())
+	})
+
+	t.Run("description=should lock recovery after too many attempts", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+recovery.StrategyRecoveryBackupCodesName+".config", map[string]interface{}{"low_threshold": 1, "max_attempts": 2})
+		t.Cleanup(func() {
+			viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+recovery.StrategyRecoveryBackupCodesName+".config", map[string]interface{}{"low_threshold": 1})
+		})
+
+		email := "locked-backup-codes@ory.sh"
+		id := &identity.Identity{Traits: identity.Traits(`{"email":"` + email + `"}`)}
+		require.NoError(t, reg.IdentityManager().Create(context.Background(), id, identity.ManagerAllowWriteProtectedTraits))
+		setCodes(t, id)
+
+		for k := 0; k < 2; k++ {
+			res := submit(t, url.Values{"email": {email}, "backup_code": {"zzzzz-zzzzz"}})
+			assert.Contains(t, res.Request.URL.String(), conf.SelfServiceFlowRecoveryUI().String())
+		}
+
+		res := submit(t, url.Values{"email": {email}, "backup_code": {codes[0]}})
+		require.Contains(t, res.Request.URL.String(), conf.SelfServiceFlowRecoveryUI().String())
+		rs, err := sdk.Public.GetSelfServiceRecoveryFlow(sdkp.NewGetSelfServiceRecoveryFlowParams().
+			WithID(res.Request.URL.Query().Get("flow")))
+		require.NoError(t, err)
+
+		body, err := json.Marshal(rs.Payload)
+		require.NoError(t, err)
+		assert.EqualValues(t, text.ErrorValidationLoginLocked, gjson.GetBytes(body, "methods.backup_codes.config.messages.0.id").Int(), "%s", body)
+
+		t.Run("case=unknown addresses are locked as well", func(t *testing.T) {
+			for k := 0; k < 2; k++ {
+				submit(t, url.Values{"email": {"not-" + email}, "backup_code": {codes[0]}})
+			}
+
+			res := submit(t, url.Values{"email": {"not-" + email}, "backup_code": {codes[0]}})
+			rs, err := sdk.Public.GetSelfServiceRecoveryFlow(sdkp.NewGetSelfServiceRecoveryFlowParams().
+				WithID(res.Request.URL.Query().Get("flow")))
+			require.NoError(t, err)
+
+			body, err := json.Marshal(rs.Payload)
+			require.NoError(t, err)
+			assert.EqualValues(t, text.ErrorValidationLoginLocked, gjson.GetBytes(body, "methods.backup_codes.config.messages.0.id").Int(), "%s", body)
+		})
+	})
+
+}
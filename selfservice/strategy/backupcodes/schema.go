@@ -0,0 +1,7 @@
+package backupcodes
+
+import (
+	"github.com/markbates/pkger"
+)
+
+var _ = pkger.Dir("/selfservice/strategy/backupcodes/.schema")
@@ -0,0 +1,273 @@
+package backupcodes
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/markbates/pkger"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/schema"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/settings"
+	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteSettings = "/self-service/settings/methods/backup_codes"
+)
+
+func (s *Strategy) RegisterSettingsRoutes(router *x.RouterPublic) {
+	s.d.CSRFHandler().ExemptPath(RouteSettings)
+	router.POST(RouteSettings, s.submitSettingsFlow)
+	router.GET(RouteSettings, s.submitSettingsFlow)
+}
+
+func (s *Strategy) SettingsStrategyID() string {
+	return s.ID().String()
+}
+
+// nolint:deadcode,unused
+// swagger:parameters completeSelfServiceSettingsFlowWithBackupCodesMethod
+type completeSelfServiceSettingsFlowWithBackupCodesMethod struct {
+	// in: body
+	Body CompleteSelfServiceSettingsFlowWithBackupCodesMethod
+
+	// Flow is flow ID.
+	//
+	// in: query
+	Flow string `json:"flow"`
+}
+
+type CompleteSelfServiceSettingsFlowWithBackupCodesMethod struct {
+	// Regenerate must be set to true to generate a new set of backup codes. All previously
+	// generated codes are invalidated.
+	//
+	// type: boolean
+	Regenerate bool `json:"backup_codes_regenerate"`
+
+	// CSRFToken is the anti-CSRF token
+	//
+	// type: string
+	CSRFToken string `json:"csrf_token"`
+
+	// Flow is flow ID.
+	//
+	// swagger:ignore
+	Flow string `json:"flow"`
+}
+
+func (p *CompleteSelfServiceSettingsFlowWithBackupCodesMethod) GetFlowID() uuid.UUID {
+	return x.ParseUUID(p.Flow)
+}
+
+func (p *CompleteSelfServiceSettingsFlowWithBackupCodesMethod) SetFlowID(rid uuid.UUID) {
+	p.Flow = rid.String()
+}
+
+// swagger:route POST /self-service/settings/methods/backup_codes public completeSelfServiceSettingsFlowWithBackupCodesMethod
+//
+// Complete Settings Flow with the Backup Codes Method
+//
+// Use this endpoint to generate a new set of backup codes by sending `backup_codes_regenerate=true`. The new codes
+// are shown once in the `backup_codes` field of the settings flow and invalidate all previously generated codes.
+// This endpoint behaves differently for API and browser flows.
+//
+// API-initiated flows expect `application/json` to be sent in the body and respond with
+//   - HTTP 200 and an application/json body with the session token on success;
+//   - HTTP 302 redirect to a fresh settings flow if the original flow expired with the appropriate error messages set;
+//   - HTTP 400 on form validation errors.
+//   - HTTP 401 when the endpoint is called without a valid session token.
+//   - HTTP 403 when `selfservice.flows.settings.privileged_session_max_age` was reached.
+//     Implies that the user needs to re-authenticate.
+//
+// Browser flows expect `application/x-www-form-urlencoded` to be sent in the body and responds with
+//   - a HTTP 302 redirect to the post/after settings URL or the `return_to` value if it was set and if the flow succeeded;
+//   - a HTTP 302 redirect to the Settings UI URL with the flow ID containing the validation errors otherwise.
+//   - a HTTP 302 redirect to the login endpoint when `selfservice.flows.settings.privileged_session_max_age` was reached.
+//
+//     Consumes:
+//     - application/json
+//     - application/x-www-form-urlencoded
+//
+//     Produces:
+//     - application/json
+//
+//     Security:
+//       sessionToken:
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: settingsViaApiResponse
+//       302: emptyResponse
+//       400: settingsFlow
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (s *Strategy) submitSettingsFlow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var p CompleteSelfServiceSettingsFlowWithBackupCodesMethod
+	ctxUpdate, err := settings.PrepareUpdate(s.d, w, r, settings.ContinuityKey(s.SettingsStrategyID()), &p)
+	if errors.Is(err, settings.ErrContinuePreviousAction) {
+		s.continueSettingsFlow(w, r, ctxUpdate, &p)
+		return
+	} else if err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, &p, err)
+		return
+	}
+
+	if err := s.decodeSettingsFlow(r, &p); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, &p, err)
+		return
+	}
+
+	// This does not come from the payload!
+	p.Flow = ctxUpdate.Flow.ID.String()
+	s.continueSettingsFlow(w, r, ctxUpdate, &p)
+}
+
+func (s *Strategy) decodeSettingsFlow(r *http.Request, dest interface{}) error {
+	compiler, err := decoderx.HTTPRawJSONSchemaCompiler(x.MustPkgerRead(pkger.Open("/selfservice/strategy/backupcodes/.schema/settings.schema.json")))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return s.hd.Decode(r, dest, compiler,
+		decoderx.HTTPDecoderSetValidatePayloads(false),
+		decoderx.HTTPDecoderJSONFollowsFormFormat(),
+	)
+}
+
+func (s *Strategy) continueSettingsFlow(
+	w http.ResponseWriter, r *http.Request,
+	ctxUpdate *settings.UpdateContext, p *CompleteSelfServiceSettingsFlowWithBackupCodesMethod,
+) {
+	if err := flow.VerifyRequest(r, ctxUpdate.Flow.Type, s.d.GenerateCSRFToken, p.CSRFToken); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	if !p.Regenerate {
+		s.handleSettingsError(w, r, ctxUpdate, p, schema.NewRequiredError("#/backup_codes_regenerate", "backup_codes_regenerate"))
+		return
+	}
+
+	if ctxUpdate.Session.AuthenticatedAt.Add(s.c.SelfServiceFlowSettingsPrivilegedSessionMaxAge()).Before(time.Now()) {
+		s.handleSettingsError(w, r, ctxUpdate, p, errors.WithStack(settings.NewFlowNeedsReAuth()))
+		return
+	}
+
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), ctxUpdate.Session.Identity.ID)
+	if err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	codes, o, err := s.generateCodes()
+	if err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	if err := s.setCredentials(i, o); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	if err := s.d.SettingsHookExecutor().PostSettingsHook(w, r, s.SettingsStrategyID(), ctxUpdate, i, settings.WithCallback(func(ctxUpdate *settings.UpdateContext) error {
+		if err := s.PopulateSettingsMethod(r, ctxUpdate.Session.Identity, ctxUpdate.Flow); err != nil {
+			return err
+		}
+
+		// The plaintext codes are shown exactly once. The next settings flow only contains the number of remaining codes.
+		method := ctxUpdate.Flow.Methods[s.SettingsStrategyID()]
+		method.Config.SetField(form.Field{Name: "backup_codes", Type: "text", Value: strings.Join(codes, ","), Disabled: true})
+		ctxUpdate.Flow.Messages.Set(text.NewInfoSelfServiceSettingsBackupCodesGenerated())
+		return nil
+	})); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+}
+
+// generateCodes returns a new set of plaintext backup codes together with their hashes.
+func (s *Strategy) generateCodes() ([]string, *CredentialsConfig, error) {
+	config, err := s.Config()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	codes := make([]string, config.Count)
+	o := &CredentialsConfig{Codes: make([]Code, config.Count)}
+	for k := range codes {
+		codes[k] = newCode()
+		o.Codes[k] = Code{HMAC: HashCode(s.c.SecretsDefault()[0], codes[k])}
+	}
+
+	return codes, o, nil
+}
+
+func (s *Strategy) PopulateSettingsMethod(r *http.Request, id *identity.Identity, f *settings.Flow) error {
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), id.ID)
+	if err != nil {
+		return err
+	}
+
+	o, err := s.credentials(i)
+	if err != nil {
+		return err
+	}
+
+	config, err := s.Config()
+	if err != nil {
+		return err
+	}
+
+	hf := &form.HTMLForm{Action: urlx.CopyWithQuery(urlx.AppendPaths(s.c.SelfPublicURL(), RouteSettings),
+		url.Values{"flow": {f.ID.String()}}).String(), Method: "POST"}
+	if len(o.Codes) > 0 {
+		remaining := o.Remaining()
+		hf.Fields = append(hf.Fields, form.Field{Name: "backup_codes_remaining", Type: "number", Value: remaining, Disabled: true})
+		if remaining <= config.LowThreshold {
+			hf.AddMessage(text.NewInfoSelfServiceSettingsBackupCodesLow(remaining))
+		}
+	}
+	hf.Fields = append(hf.Fields, form.Field{Name: "backup_codes_regenerate", Type: "submit", Value: "true"})
+	hf.SetCSRF(s.d.GenerateCSRFToken(r))
+
+	f.Methods[s.SettingsStrategyID()] = &settings.FlowMethod{
+		Method: s.SettingsStrategyID(),
+		Config: &settings.FlowMethodConfig{FlowMethodConfigurator: &FlowMethod{HTMLForm: hf}},
+	}
+	return nil
+}
+
+func (s *Strategy) handleSettingsError(w http.ResponseWriter, r *http.Request, ctxUpdate *settings.UpdateContext, p *CompleteSelfServiceSettingsFlowWithBackupCodesMethod, err error) {
+	// Do not pause flow if the flow type is an API flow as we can't save cookies in those flows.
+	if e := new(settings.FlowNeedsReAuth); errors.As(err, &e) && ctxUpdate.Flow != nil && ctxUpdate.Flow.Type == flow.TypeBrowser {
+		if err := s.d.ContinuityManager().Pause(r.Context(), w, r,
+			settings.ContinuityKey(s.SettingsStrategyID()), settings.ContinuityOptions(p, ctxUpdate.Session.Identity)...); err != nil {
+			s.d.SettingsFlowErrorHandler().WriteFlowError(w, r, s.SettingsStrategyID(), ctxUpdate.Flow, ctxUpdate.Session.Identity, err)
+			return
+		}
+	}
+
+	var id *identity.Identity
+	if ctxUpdate.Flow != nil {
+		ctxUpdate.Flow.Methods[s.SettingsStrategyID()].Config.Reset("backup_codes_remaining", "backup_codes_regenerate")
+		ctxUpdate.Flow.Methods[s.SettingsStrategyID()].Config.SetCSRF(s.d.GenerateCSRFToken(r))
+		id = ctxUpdate.Session.Identity
+	}
+
+	s.d.SettingsFlowErrorHandler().WriteFlowError(w, r, s.SettingsStrategyID(), ctxUpdate.Flow, id, err)
+}
@@ -0,0 +1,123 @@
+package backupcodes_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/flow/settings"
+	"github.com/zzpu/ums/selfservice/strategy/backupcodes"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+func TestSettings(t *testing.T) {
+	conf, reg := internal.NewFastRegistryWithMocks(t)
+	viper.Set(configuration.ViperKeySelfServiceBrowserDefaultReturnTo, "https://www.ory.sh/")
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/default.schema.json")
+	testhelpers.StrategyEnable(identity.CredentialsTypeBackupCodes.String(), true)
+	testhelpers.StrategyEnable(settings.StrategyProfile, true)
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".backup_codes.config", map[string]interface{}{"count": 4, "low_threshold": 3})
+
+	_ = testhelpers.NewSettingsUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewErrorTestServer(t, reg)
+	_ = testhelpers.NewLoginUIWith401Response(t)
+	viper.Set(configuration.ViperKeySelfServiceSettingsPrivilegedAuthenticationAfter, "5m")
+
+	publicTS, _ := testhelpers.NewKratosServer(t, reg)
+
+	submit := func(t *testing.T, isAPI bool, hc *http.Client, values func(url.Values), expectedStatusCode int) string {
+		return testhelpers.SubmitSettingsForm(t, isAPI, hc, publicTS, values,
+			identity.CredentialsTypeBackupCodes.String(), expectedStatusCode,
+			testhelpers.ExpectURL(isAPI, publicTS.URL+backupcodes.RouteSettings, conf.SelfServiceFlowSettingsUI().String()))
+	}
+
+	credentials := func(t *testing.T, id *identity.Identity) *backupcodes.CredentialsConfig {
+		i, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), id.ID)
+		require.NoError(t, err)
+
+		var o backupcodes.CredentialsConfig
+		if _, err := i.ParseCredentials(identity.CredentialsTypeBackupCodes, &o); err != nil {
+			return &o
+		}
+		return &o
+	}
+
+	for _, tc := range []struct {
+		d     string
+		isAPI bool
+	}{
+		{d: "type=api", isAPI: true},
+		{d: "type=browser", isAPI: false},
+	} {
+		t.Run(tc.d, func(t *testing.T) {
+			id := &identity.Identity{
+				ID:       x.NewUUID(),
+				Traits:   identity.Traits(`{}`),
+				SchemaID: configuration.DefaultIdentityTraitsSchemaID,
+			}
+
+			var hc *http.Client
+			if tc.isAPI {
+				hc = testhelpers.NewHTTPClientWithIdentitySessionToken(t, reg, id)
+			} else {
+				hc = testhelpers.NewHTTPClientWithIdentitySessionCookie(t, reg, id)
+			}
+
+			path := func(p string) string {
+				return testhelpers.ExpectURL(tc.isAPI, "flow."+p, p)
+			}
+
+			t.Run("description=should require the regenerate flag", func(t *testing.T) {
+				actual := submit(t, tc.isAPI, hc, func(v url.Values) {
+					delete(v, "backup_codes_regenerate")
+				}, testhelpers.ExpectStatusCode(tc.isAPI, http.StatusBadRequest, http.StatusOK))
+
+				assert.EqualValues(t, text.ErrorValidationRequired, gjson.Get(actual, "methods.backup_codes.config.fields.#(name==backup_codes_regenerate).messages.0.id").Int(), "%s", actual)
+				assert.Empty(t, credentials(t, id).Codes)
+			})
+
+			var first string
+			t.Run("description=should generate backup codes", func(t *testing.T) {
+				actual := submit(t, tc.isAPI, hc, func(url.Values) {}, http.StatusOK)
+
+				assert.EqualValues(t, settings.StateSuccess, gjson.Get(actual, path("state")).String(), "%s", actual)
+				assert.EqualValues(t, text.InfoSelfServiceSettingsBackupCodesGenerated, gjson.Get(actual, path("messages.0.id")).Int(), "%s", actual)
+
+				first = gjson.Get(actual, path("methods.backup_codes.config.fields.#(name==backup_codes).value")).String()
+				assert.Len(t, strings.Split(first, ","), 4, "%s", actual)
+
+				o := credentials(t, id)
+				require.Len(t, o.Codes, 4)
+				assert.Equal(t, 4, o.Remaining())
+				for _, code := range o.Codes {
+					assert.Len(t, code.HMAC, 64)
+					assert.NotContains(t, first, code.HMAC)
+				}
+			})
+
+			t.Run("description=should show the remaining codes and replace them on regeneration", func(t *testing.T) {
+				actual := submit(t, tc.isAPI, hc, func(v url.Values) {
+					assert.EqualValues(t, []string{"4"}, v["backup_codes_remaining"])
+				}, http.StatusOK)
+
+				second := gjson.Get(actual, path("methods.backup_codes.config.fields.#(name==backup_codes).value")).String()
+				assert.NotEmpty(t, second, "%s", actual)
+				assert.NotEqual(t, first, second)
+				assert.Len(t, credentials(t, id).Codes, 4)
+			})
+		})
+	}
+}
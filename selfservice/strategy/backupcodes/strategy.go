@@ -0,0 +1,136 @@
+package backupcodes
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/jsonx"
+
+	"github.com/zzpu/ums/continuity"
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/errorx"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/selfservice/flow/settings"
+	"github.com/zzpu/ums/selfservice/strategy/password"
+	"github.com/zzpu/ums/session"
+	"github.com/zzpu/ums/x"
+)
+
+var _ recovery.Strategy = new(Strategy)
+var _ recovery.PublicHandler = new(Strategy)
+var _ settings.Strategy = new(Strategy)
+
+type strategyDependencies interface {
+	x.LoggingProvider
+	x.WriterProvider
+	x.CSRFTokenGeneratorProvider
+	x.CSRFProvider
+
+	continuity.ManagementProvider
+
+	errorx.ManagementProvider
+
+	password.LoginFailurePersistenceProvider
+
+	recovery.ErrorHandlerProvider
+	recovery.FlowPersistenceProvider
+	recovery.StrategyProvider
+
+	settings.HandlerProvider
+	settings.FlowPersistenceProvider
+	settings.HookExecutorProvider
+	settings.ErrorHandlerProvider
+
+	identity.PoolProvider
+	identity.PrivilegedPoolProvider
+
+	session.HandlerProvider
+	session.ManagementProvider
+}
+
+type Strategy struct {
+	c  configuration.Provider
+	d  strategyDependencies
+	hd *decoderx.HTTP
+}
+
+// Configuration is the configuration of the backup codes method.
+type Configuration struct {
+	// Count is the number of backup codes generated at once.
+	Count int `json:"count"`
+
+	// LowThreshold is the number of unused codes at which users are asked to generate new codes.
+	LowThreshold int `json:"low_threshold"`
+
+	// MaxAttempts is the number of attempts within LockoutDuration after which recovering the account of an
+	// email address with backup codes is locked. Zero disables the lockout.
+	MaxAttempts int `json:"max_attempts"`
+
+	// LockoutDuration is the time window in which attempts are counted.
+	LockoutDuration string `json:"lockout_duration"`
+}
+
+func NewStrategy(d strategyDependencies, c configuration.Provider) *Strategy {
+	return &Strategy{
+		c:  c,
+		d:  d,
+		hd: decoderx.NewHTTP(),
+	}
+}
+
+func (s *Strategy) ID() identity.CredentialsType {
+	return identity.CredentialsTypeBackupCodes
+}
+
+func (s *Strategy) Config() (*Configuration, error) {
+	c := Configuration{Count: 10, LowThreshold: 3, MaxAttempts: 5, LockoutDuration: "15m"}
+
+	config := s.c.SelfServiceStrategy(string(s.ID())).Config
+	if err := jsonx.
+		NewStrictDecoder(bytes.NewBuffer(config)).
+		Decode(&c); err != nil {
+		s.d.Logger().WithError(err).WithField("config", config)
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode backup codes configuration: %s", err))
+	}
+
+	return &c, nil
+}
+
+func (c *Configuration) lockoutDuration() time.Duration {
+	d, err := time.ParseDuration(c.LockoutDuration)
+	if err != nil {
+		return 15 * time.Minute
+	}
+	return d
+}
+
+// credentials returns the backup codes of the identity or an empty set if none were generated.
+func (s *Strategy) credentials(i *identity.Identity) (*CredentialsConfig, error) {
+	var o CredentialsConfig
+	if _, err := i.ParseCredentials(s.ID(), &o); err != nil && !errors.Is(err, herodot.ErrNotFound) {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (s *Strategy) setCredentials(i *identity.Identity, o *CredentialsConfig) error {
+	co, err := json.Marshal(o)
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode backup codes to JSON: %s", err))
+	}
+
+	// Backup codes are looked up through the identity's recovery addresses and
+	// therefore do not have any identifiers.
+	i.SetCredentials(s.ID(), identity.Credentials{
+		Type:        s.ID(),
+		Identifiers: []string{},
+		Config:      co,
+	})
+	return nil
+}
@@ -0,0 +1,68 @@
+package backupcodes
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ory/x/randx"
+
+	"github.com/zzpu/ums/selfservice/form"
+)
+
+var codeAlphabet = []rune("abcdefghjkmnpqrstuvwxyz23456789")
+
+const codeLength = 10
+
+type (
+	// CredentialsConfig is the struct that is being used as part of the identity credentials.
+	CredentialsConfig struct {
+		// Codes are the hashed backup codes.
+		Codes []Code `json:"codes"`
+	}
+
+	// Code is a single hashed backup code.
+	Code struct {
+		// HMAC is the HMAC-SHA256 of the normalized backup code.
+		HMAC string `json:"hmac"`
+
+		// UsedAt is set once the code was used.
+		UsedAt *time.Time `json:"used_at,omitempty"`
+	}
+)
+
+// FlowMethod contains the configuration for this selfservice strategy.
+type FlowMethod struct {
+	*form.HTMLForm
+}
+
+// Remaining returns the number of unused backup codes.
+func (c *CredentialsConfig) Remaining() (n int) {
+	for _, code := range c.Codes {
+		if code.UsedAt == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// newCode generates a backup code which is formatted as two groups of characters for printing.
+func newCode() string {
+	code := string(randx.MustString(codeLength, codeAlphabet))
+	return code[:codeLength/2] + "-" + code[codeLength/2:]
+}
+
+// normalizeCode removes formatting from a backup code entered by the user.
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// HashCode returns the HMAC-SHA256 of the normalized backup code. Backup codes are random and recovering with them
+// is rate limited, which is why a keyed hash is sufficient and a slow password hash is not needed.
+func HashCode(key []byte, code string) string {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(normalizeCode(code)))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
@@ -0,0 +1,70 @@
+package code
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/x"
+)
+
+type RecoveryCode struct {
+	// ID represents the code's unique ID.
+	//
+	// required: true
+	// type: string
+	// format: uuid
+	ID uuid.UUID `json:"id" db:"id" faker:"-"`
+
+	// Code represents the recovery code. It is only known in plain text until it is stored.
+	Code string `json:"-" db:"code"`
+
+	// RecoveryAddress links this code to a recovery address.
+	// required: true
+	RecoveryAddress *identity.RecoveryAddress `json:"recovery_address" belongs_to:"identity_recovery_addresses" fk_id:"RecoveryAddressID"`
+
+	// Attempts is the number of times a wrong code was submitted for this code.
+	Attempts int `json:"-" faker:"-" db:"attempts"`
+
+	// ExpiresAt is the time (UTC) when the code expires.
+	// required: true
+	ExpiresAt time.Time `json:"expires_at" faker:"time_type" db:"expires_at"`
+
+	// IssuedAt is the time (UTC) when the code was issued.
+	// required: true
+	IssuedAt time.Time `json:"issued_at" faker:"time_type" db:"issued_at"`
+
+	// CreatedAt is a helper struct field for gobuffalo.pop.
+	CreatedAt time.Time `json:"-" faker:"-" db:"created_at"`
+	// UpdatedAt is a helper struct field for gobuffalo.pop.
+	UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+	// RecoveryAddressID is a helper struct field for gobuffalo.pop.
+	RecoveryAddressID uuid.UUID `json:"-" faker:"-" db:"identity_recovery_address_id"`
+	// FlowID is a helper struct field for gobuffalo.pop.
+	FlowID uuid.UUID `json:"-" faker:"-" db:"selfservice_recovery_flow_id"`
+}
+
+func (RecoveryCode) TableName() string {
+	return "identity_recovery_codes"
+}
+
+func NewSelfServiceRecoveryCode(address *identity.RecoveryAddress, f *recovery.Flow, length int) *RecoveryCode {
+	return &RecoveryCode{
+		ID:              x.NewUUID(),
+		Code:            newCode(length),
+		RecoveryAddress: address,
+		ExpiresAt:       f.ExpiresAt,
+		IssuedAt:        time.Now().UTC(),
+		FlowID:          f.ID,
+	}
+}
+
+func (f *RecoveryCode) Valid() error {
+	if f.ExpiresAt.Before(time.Now()) {
+		return errors.WithStack(recovery.NewFlowExpiredError(f.ExpiresAt))
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package code
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/flow/verification"
+	"github.com/zzpu/ums/x"
+)
+
+type VerificationCode struct {
+	// ID represents the code's unique ID.
+	//
+	// required: true
+	// type: string
+	// format: uuid
+	ID uuid.UUID `json:"id" db:"id" faker:"-"`
+
+	// Code represents the verification code. It is only known in plain text until it is stored.
+	Code string `json:"-" db:"code"`
+
+	// VerifiableAddress links this code to a verification address.
+	// required: true
+	VerifiableAddress *identity.VerifiableAddress `json:"verification_address" belongs_to:"identity_verifiable_addresses" fk_id:"VerifiableAddressID"`
+
+	// Attempts is the number of times a wrong code was submitted for this code.
+	Attempts int `json:"-" faker:"-" db:"attempts"`
+
+	// ExpiresAt is the time (UTC) when the code expires.
+	// required: true
+	ExpiresAt time.Time `json:"expires_at" faker:"time_type" db:"expires_at"`
+
+	// IssuedAt is the time (UTC) when the code was issued.
+	// required: true
+	IssuedAt time.Time `json:"issued_at" faker:"time_type" db:"issued_at"`
+
+	// CreatedAt is a helper struct field for gobuffalo.pop.
+	CreatedAt time.Time `json:"-" faker:"-" db:"created_at"`
+	// UpdatedAt is a helper struct field for gobuffalo.pop.
+	UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+	// VerifiableAddressID is a helper struct field for gobuffalo.pop.
+	VerifiableAddressID uuid.UUID `json:"-" faker:"-" db:"identity_verifiable_address_id"`
+	// FlowID is a helper struct field for gobuffalo.pop.
+	FlowID uuid.UUID `json:"-" faker:"-" db:"selfservice_verification_flow_id"`
+}
+
+func (VerificationCode) TableName() string {
+	return "identity_verification_codes"
+}
+
+func NewSelfServiceVerificationCode(address *identity.VerifiableAddress, f *verification.Flow, length int) *VerificationCode {
+	return &VerificationCode{
+		ID:                x.NewUUID(),
+		Code:              newCode(length),
+		VerifiableAddress: address,
+		ExpiresAt:         f.ExpiresAt,
+		IssuedAt:          time.Now().UTC(),
+		FlowID:            f.ID,
+	}
+}
+
+func (f *VerificationCode) Valid() error {
+	if f.ExpiresAt.Before(time.Now()) {
+		return errors.WithStack(verification.NewFlowExpiredError(f.ExpiresAt))
+	}
+	return nil
+}
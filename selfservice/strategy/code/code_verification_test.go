@@ -0,0 +1,50 @@
+package code
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/verification"
+)
+
+func TestVerificationCode(t *testing.T) {
+	req := &http.Request{URL: urlx.ParseOrPanic("https://www.ory.sh/")}
+	t.Run("func=NewSelfServiceVerificationCode", func(t *testing.T) {
+		t.Run("case=creates numeric codes of the given length", func(t *testing.T) {
+			f, err := verification.NewFlow(time.Hour, "", req, nil, flow.TypeAPI)
+			require.NoError(t, err)
+
+			for _, length := range []int{4, 6, 8} {
+				code := NewSelfServiceVerificationCode(nil, f, length)
+				assert.Regexp(t, "^[0-9]+$", code.Code)
+				assert.Len(t, code.Code, length)
+				assert.Equal(t, f.ID, code.FlowID)
+				assert.Equal(t, f.ExpiresAt, code.ExpiresAt)
+			}
+		})
+	})
+	t.Run("method=Valid", func(t *testing.T) {
+		t.Run("case=is invalid when the flow is expired", func(t *testing.T) {
+			f, err := verification.NewFlow(-time.Hour, "", req, nil, flow.TypeBrowser)
+			require.NoError(t, err)
+
+			code := NewSelfServiceVerificationCode(nil, f, 6)
+			require.Error(t, code.Valid())
+			assert.EqualError(t, code.Valid(), f.Valid().Error())
+		})
+
+		t.Run("case=is valid when the flow is not expired", func(t *testing.T) {
+			f, err := verification.NewFlow(time.Hour, "", req, nil, flow.TypeBrowser)
+			require.NoError(t, err)
+
+			require.NoError(t, NewSelfServiceVerificationCode(nil, f, 6).Valid())
+		})
+	})
+}
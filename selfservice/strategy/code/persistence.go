@@ -0,0 +1,52 @@
+package code
+
+import (
+	"context"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+)
+
+// ErrCodeAttemptsExceeded is returned when a wrong code was submitted too often. The code
+// is invalidated and a new one has to be requested.
+var ErrCodeAttemptsExceeded = errors.New("the code was submitted too often")
+
+// ErrCodeSendsExceeded is returned when too many codes were requested for a flow. A new
+// flow has to be initialized.
+var ErrCodeSendsExceeded = errors.New("too many codes were requested for the flow")
+
+type (
+	RecoveryCodePersister interface {
+		// CreateRecoveryCode persists the code and invalidates all codes previously issued for the flow, so
+		// that only the latest code can be used.
+		CreateRecoveryCode(ctx context.Context, code *RecoveryCode) error
+
+		// CountRecoveryCodeSend counts a code sent for the flow, including the messages sent to unknown
+		// addresses, and returns ErrCodeSendsExceeded once maxSends codes were sent.
+		CountRecoveryCodeSend(ctx context.Context, flowID uuid.UUID, maxSends int) error
+
+		// UseRecoveryCode compares the code with the latest unused code issued for the flow and marks it as
+		// used if it matches. Every mismatch counts as an attempt and returns sqlcon.ErrNoRows. Once
+		// maxAttempts is reached, the code is invalidated and ErrCodeAttemptsExceeded is returned.
+		UseRecoveryCode(ctx context.Context, flowID uuid.UUID, code string, maxAttempts int) (*RecoveryCode, error)
+	}
+
+	RecoveryCodePersistenceProvider interface {
+		RecoveryCodePersister() RecoveryCodePersister
+	}
+
+	VerificationCodePersister interface {
+		// CreateVerificationCode behaves like RecoveryCodePersister.CreateRecoveryCode.
+		CreateVerificationCode(ctx context.Context, code *VerificationCode) error
+
+		// CountVerificationCodeSend behaves like RecoveryCodePersister.CountRecoveryCodeSend.
+		CountVerificationCodeSend(ctx context.Context, flowID uuid.UUID, maxSends int) error
+
+		// UseVerificationCode behaves like RecoveryCodePersister.UseRecoveryCode.
+		UseVerificationCode(ctx context.Context, flowID uuid.UUID, code string, maxAttempts int) (*VerificationCode, error)
+	}
+
+	VerificationCodePersistenceProvider interface {
+		VerificationCodePersister() VerificationCodePersister
+	}
+)
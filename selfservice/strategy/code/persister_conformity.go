@@ -0,0 +1,276 @@
+package code
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/faker/v3"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/assertx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/selfservice/flow/verification"
+)
+
+func TestPersister(p interface {
+	RecoveryCodePersister
+	VerificationCodePersister
+	recovery.FlowPersister
+	verification.FlowPersister
+	identity.PrivilegedPool
+}) func(t *testing.T) {
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/identity.schema.json")
+	viper.Set(configuration.ViperKeySecretsDefault, []string{"secret-a", "secret-b"})
+	return func(t *testing.T) {
+		t.Run("code=recovery", func(t *testing.T) {
+			newRecoveryCode := func(t *testing.T, email string) (*RecoveryCode, *recovery.Flow) {
+				var f recovery.Flow
+				require.NoError(t, faker.FakeData(&f))
+				f.ExpiresAt = time.Now().Add(time.Hour)
+				require.NoError(t, p.CreateRecoveryFlow(context.Background(), &f))
+
+				var i identity.Identity
+				require.NoError(t, faker.FakeData(&i))
+
+				address := &identity.RecoveryAddress{Value: email, Via: identity.RecoveryAddressTypeEmail}
+				i.RecoveryAddresses = append(i.RecoveryAddresses, *address)
+
+				require.NoError(t, p.CreateIdentity(context.Background(), &i))
+
+				return NewSelfServiceRecoveryCode(&i.RecoveryAddresses[0], &f, 6), &f
+			}
+
+			t.Run("case=should error when no code was issued for the flow", func(t *testing.T) {
+				_, f := newRecoveryCode(t, "code-no-code@ory.sh")
+				_, err := p.UseRecoveryCode(context.Background(), f.ID, "123456", 5)
+				require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+			})
+
+			t.Run("case=should create a recovery code and use it", func(t *testing.T) {
+				expected, f := newRecoveryCode(t, "code-recovery-user@ory.sh")
+				require.NoError(t, p.CreateRecoveryCode(context.Background(), expected))
+
+				actual, err := p.UseRecoveryCode(context.Background(), f.ID, expected.Code, 5)
+				require.NoError(t, err)
+				assertx.EqualAsJSON(t, expected.RecoveryAddress, actual.RecoveryAddress)
+				assert.Equal(t, expected.RecoveryAddress.IdentityID, actual.RecoveryAddress.IdentityID)
+				assert.NotEqual(t, expected.Code, actual.Code)
+				assert.EqualValues(t, f.ID, actual.FlowID)
+
+				_, err = p.UseRecoveryCode(context.Background(), f.ID, expected.Code, 5)
+				require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+			})
+
+			t.Run("case=should use the code only once if it is submitted concurrently", func(t *testing.T) {
+				expected, f := newRecoveryCode(t, "code-recovery-concurrent@ory.sh")
+				require.NoError(t, p.CreateRecoveryCode(context.Background(), expected))
+
+				var used int32
+				var wg sync.WaitGroup
+				for k := 0; k < 10; k++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if _, err := p.UseRecoveryCode(context.Background(), f.ID, expected.Code, 5); err == nil {
+							atomic.AddInt32(&used, 1)
+						}
+					}()
+				}
+				wg.Wait()
+
+				assert.EqualValues(t, 1, used)
+			})
+
+			t.Run("case=should count concurrent attempts", func(t *testing.T) {
+				expected, f := newRecoveryCode(t, "code-recovery-concurrent-attempts@ory.sh")
+				expected.Code = "123456"
+				require.NoError(t, p.CreateRecoveryCode(context.Background(), expected))
+
+				var exceeded int32
+				var wg sync.WaitGroup
+				for k := 0; k < 10; k++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for {
+							_, err := p.UseRecoveryCode(context.Background(), f.ID, "000000", 3)
+							if errors.Is(err, ErrCodeAttemptsExceeded) {
+								atomic.AddInt32(&exceeded, 1)
+							} else if err != nil && !errors.Is(err, sqlcon.ErrNoRows) {
+								// The database refused the concurrent transaction, so the attempt is repeated.
+								continue
+							}
+							return
+						}
+					}()
+				}
+				wg.Wait()
+
+				assert.EqualValues(t, 1, exceeded)
+				_, err := p.UseRecoveryCode(context.Background(), f.ID, "123456", 3)
+				require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+			})
+
+			t.Run("case=should invalidate the code after too many attempts", func(t *testing.T) {
+				expected, f := newRecoveryCode(t, "code-recovery-attempts@ory.sh")
+				expected.Code = "123456"
+				require.NoError(t, p.CreateRecoveryCode(context.Background(), expected))
+
+				_, err := p.UseRecoveryCode(context.Background(), f.ID, "000000", 3)
+				require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+				_, err = p.UseRecoveryCode(context.Background(), f.ID, "000000", 3)
+				require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+				_, err = p.UseRecoveryCode(context.Background(), f.ID, "000000", 3)
+				require.True(t, errors.Is(err, ErrCodeAttemptsExceeded), "%+v", err)
+
+				_, err = p.UseRecoveryCode(context.Background(), f.ID, "123456", 3)
+				require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+			})
+
+			t.Run("case=should invalidate earlier codes when a new code is created", func(t *testing.T) {
+				first, f := newRecoveryCode(t, "code-recovery-resend@ory.sh")
+				first.Code = "111111"
+				require.NoError(t, p.CreateRecoveryCode(context.Background(), first))
+
+				second := NewSelfServiceRecoveryCode(first.RecoveryAddress, f, 6)
+				second.Code = "222222"
+				require.NoError(t, p.CreateRecoveryCode(context.Background(), second))
+
+				_, err := p.UseRecoveryCode(context.Background(), f.ID, "000000", 2)
+				require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+				_, err = p.UseRecoveryCode(context.Background(), f.ID, "000000", 2)
+				require.True(t, errors.Is(err, ErrCodeAttemptsExceeded), "%+v", err)
+
+				_, err = p.UseRecoveryCode(context.Background(), f.ID, "111111", 2)
+				require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+			})
+
+			t.Run("case=should limit the number of codes sent for a flow", func(t *testing.T) {
+				_, f := newRecoveryCode(t, "code-recovery-sends@ory.sh")
+				require.NoError(t, p.CountRecoveryCodeSend(context.Background(), f.ID, 2))
+				require.NoError(t, p.CountRecoveryCodeSend(context.Background(), f.ID, 2))
+
+				// Updating the flow must not reset the counter.
+				require.NoError(t, p.UpdateRecoveryFlow(context.Background(), f))
+				err := p.CountRecoveryCodeSend(context.Background(), f.ID, 2)
+				require.True(t, errors.Is(err, ErrCodeSendsExceeded), "%+v", err)
+			})
+		})
+
+		t.Run("code=verification", func(t *testing.T) {
+			newVerificationCode := func(t *testing.T, email string) (*VerificationCode, *verification.Flow) {
+				var f verification.Flow
+				require.NoError(t, faker.FakeData(&f))
+				f.ExpiresAt = time.Now().Add(time.Hour)
+				require.NoError(t, p.CreateVerificationFlow(context.Background(), &f))
+
+				var i identity.Identity
+				require.NoError(t, faker.FakeData(&i))
+
+				address := &identity.VerifiableAddress{Value: email, Via: identity.VerifiableAddressTypeEmail}
+				i.VerifiableAddresses = append(i.VerifiableAddresses, *address)
+
+				require.NoError(t, p.CreateIdentity(context.Background(), &i))
+
+				return NewSelfServiceVerificationCode(&i.VerifiableAddresses[0], &f, 6), &f
+			}
+
+			t.Run("case=should error when no code was issued for the flow", func(t *testing.T) {
+				_, f := newVerificationCode(t, "code-no-verification-code@ory.sh")
+				_, err := p.UseVerificationCode(context.Background(), f.ID, "123456", 5)
+				require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+			})
+
+			t.Run("case=should create a verification code and use it", func(t *testing.T) {
+				expected, f := newVerificationCode(t, "code-verification-user@ory.sh")
+				require.NoError(t, p.CreateVerificationCode(context.Background(), expected))
+
+				actual, err := p.UseVerificationCode(context.Background(), f.ID, expected.Code, 5)
+				require.NoError(t, err)
+				assertx.EqualAsJSON(t, expected.VerifiableAddress, actual.VerifiableAddress)
+				assert.NotEqual(t, expected.Code, actual.Code)
+				assert.EqualValues(t, f.ID, actual.FlowID)
+
+				_, err = p.UseVerificationCode(context.Background(), f.ID, expected.Code, 5)
+				require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+			})
+
+			t.Run("case=should use the code only once if it is submitted concurrently", func(t *testing.T) {
+				expected, f := newVerificationCode(t, "code-verification-concurrent@ory.sh")
+				require.NoError(t, p.CreateVerificationCode(context.Background(), expected))
+
+				var used int32
+				var wg sync.WaitGroup
+				for k := 0; k < 10; k++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if _, err := p.UseVerificationCode(context.Background(), f.ID, expected.Code, 5); err == nil {
+							atomic.AddInt32(&used, 1)
+						}
+					}()
+				}
+				wg.Wait()
+
+				assert.EqualValues(t, 1, used)
+			})
+
+			t.Run("case=should only accept the latest code", func(t *testing.T) {
+				first, f := newVerificationCode(t, "code-verification-latest@ory.sh")
+				first.Code = "111111"
+				require.NoError(t, p.CreateVerificationCode(context.Background(), first))
+
+				time.Sleep(time.Millisecond * 1100)
+				second := NewSelfServiceVerificationCode(first.VerifiableAddress, f, 6)
+				second.Code = "222222"
+				require.NoError(t, p.CreateVerificationCode(context.Background(), second))
+
+				_, err := p.UseVerificationCode(context.Background(), f.ID, "111111", 5)
+				require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+
+				actual, err := p.UseVerificationCode(context.Background(), f.ID, "222222", 5)
+				require.NoError(t, err)
+				assert.Equal(t, second.ID, actual.ID)
+			})
+
+			t.Run("case=should invalidate earlier codes when a new code is created", func(t *testing.T) {
+				first, f := newVerificationCode(t, "code-verification-resend@ory.sh")
+				first.Code = "111111"
+				require.NoError(t, p.CreateVerificationCode(context.Background(), first))
+
+				second := NewSelfServiceVerificationCode(first.VerifiableAddress, f, 6)
+				second.Code = "222222"
+				require.NoError(t, p.CreateVerificationCode(context.Background(), second))
+
+				_, err := p.UseVerificationCode(context.Background(), f.ID, "000000", 2)
+				require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+				_, err = p.UseVerificationCode(context.Background(), f.ID, "000000", 2)
+				require.True(t, errors.Is(err, ErrCodeAttemptsExceeded), "%+v", err)
+
+				_, err = p.UseVerificationCode(context.Background(), f.ID, "111111", 2)
+				require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+			})
+
+			t.Run("case=should limit the number of codes sent for a flow", func(t *testing.T) {
+				_, f := newVerificationCode(t, "code-verification-sends@ory.sh")
+				require.NoError(t, p.CountVerificationCodeSend(context.Background(), f.ID, 2))
+				require.NoError(t, p.CountVerificationCodeSend(context.Background(), f.ID, 2))
+
+				// Updating the flow must not reset the counter.
+				require.NoError(t, p.UpdateVerificationFlow(context.Background(), f))
+				err := p.CountVerificationCodeSend(context.Background(), f.ID, 2)
+				require.True(t, errors.Is(err, ErrCodeSendsExceeded), "%+v", err)
+			})
+		})
+	}
+}
@@ -0,0 +1,7 @@
+package code
+
+import (
+	"github.com/markbates/pkger"
+)
+
+var _ = pkger.Dir("/selfservice/strategy/code/.schema")
@@ -0,0 +1,176 @@
+package code
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/errorsx"
+	"github.com/ory/x/sqlcon"
+
+	"github.com/zzpu/ums/courier"
+	templates "github.com/zzpu/ums/courier/template"
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/selfservice/flow/verification"
+	"github.com/zzpu/ums/x"
+)
+
+type (
+	senderDependencies interface {
+		courier.Provider
+		identity.PoolProvider
+		x.LoggingProvider
+
+		RecoveryCodePersistenceProvider
+		VerificationCodePersistenceProvider
+	}
+
+	SenderProvider interface {
+		CodeSender() *Sender
+	}
+
+	Sender struct {
+		r senderDependencies
+		c configuration.Provider
+	}
+
+	// codeTemplate is a message which can be delivered via email as well as via SMS.
+	codeTemplate interface {
+		courier.EmailTemplate
+		courier.SMSTemplate
+	}
+)
+
+var ErrUnknownAddress = errors.New("code requested for unknown address")
+
+func NewSender(r senderDependencies, c configuration.Provider) *Sender {
+	return &Sender{r: r, c: c}
+}
+
+// SendRecoveryCode sends a recovery code to the specified address. If the address does not exist in the store, an email is
+// still being sent to prevent account enumeration attacks. In that case, this function returns the ErrUnknownAddress
+// error. Text messages are never sent to unknown phone numbers because anyone could otherwise have us pay for messages
+// to arbitrary numbers.
+func (s *Sender) SendRecoveryCode(ctx context.Context, f *recovery.Flow, via identity.VerifiableAddressType, to string) error {
+	s.r.Logger().
+		WithField("via", via).
+		WithSensitiveField("address", to).
+		Debug("Preparing recovery code.")
+
+	to, err := normalizeAddress(via, to)
+	if err != nil {
+		return err
+	}
+
+	address, err := s.r.IdentityPool().FindRecoveryAddressByValue(ctx, identity.RecoveryAddressType(via), to)
+	if err != nil {
+		if via != identity.VerifiableAddressTypePhone {
+			if err := s.send(ctx, string(via), templates.NewRecoveryInvalid(s.c, &templates.RecoveryInvalidModel{To: to})); err != nil {
+				return err
+			}
+		}
+		return errors.Cause(ErrUnknownAddress)
+	}
+
+	conf, err := newConfiguration(s.c)
+	if err != nil {
+		return err
+	}
+
+	code := NewSelfServiceRecoveryCode(address, f, conf.Length)
+	// The code is replaced by its HMAC when it is persisted.
+	rawCode := code.Code
+	if err := s.r.RecoveryCodePersister().CreateRecoveryCode(ctx, code); err != nil {
+		return err
+	}
+
+	s.r.Audit().
+		WithField("via", address.Via).
+		WithField("identity_id", address.IdentityID).
+		WithField("recovery_code_id", code.ID).
+		WithSensitiveField("email_address", address.Value).
+		WithSensitiveField("recovery_code", rawCode).
+		Info("Sending out recovery email with recovery code.")
+
+	return s.send(ctx, string(address.Via), templates.NewRecoveryCodeValid(s.c,
+		&templates.RecoveryCodeValidModel{To: address.Value, RecoveryCode: rawCode}))
+}
+
+// SendVerificationCode sends a verification code to the specified address. If the address does not exist in the store,
+// an email is still being sent to prevent account enumeration attacks. In that case, this function returns the
+// ErrUnknownAddress error. Like SendRecoveryCode, it never sends text messages to unknown phone numbers.
+func (s *Sender) SendVerificationCode(ctx context.Context, f *verification.Flow, via identity.VerifiableAddressType, to string) error {
+	s.r.Logger().
+		WithField("via", via).
+		WithSensitiveField("address", to).
+		Debug("Preparing verification code.")
+
+	to, err := normalizeAddress(via, to)
+	if err != nil {
+		return err
+	}
+
+	address, err := s.r.IdentityPool().FindVerifiableAddressByValue(ctx, via, to)
+	if err != nil {
+		if errorsx.Cause(err) == sqlcon.ErrNoRows {
+			if via == identity.VerifiableAddressTypePhone {
+				return errors.Cause(ErrUnknownAddress)
+			}
+
+			s.r.Audit().
+				WithField("via", via).
+				WithSensitiveField("email_address", to).
+				Info("Sending out invalid verification email because address is unknown.")
+			if err := s.send(ctx, string(via), templates.NewVerificationInvalid(s.c, &templates.VerificationInvalidModel{To: to})); err != nil {
+				return err
+			}
+			return errors.Cause(ErrUnknownAddress)
+		}
+		return err
+	}
+
+	conf, err := newConfiguration(s.c)
+	if err != nil {
+		return err
+	}
+
+	code := NewSelfServiceVerificationCode(address, f, conf.Length)
+	// The code is replaced by its HMAC when it is persisted.
+	rawCode := code.Code
+	if err := s.r.VerificationCodePersister().CreateVerificationCode(ctx, code); err != nil {
+		return err
+	}
+
+	s.r.Audit().
+		WithField("via", address.Via).
+		WithField("identity_id", address.IdentityID).
+		WithField("verification_code_id", code.ID).
+		WithSensitiveField("email_address", address.Value).
+		WithSensitiveField("verification_code", rawCode).
+		Info("Sending out verification email with verification code.")
+
+	return s.send(ctx, string(address.Via), templates.NewVerificationCodeValid(s.c,
+		&templates.VerificationCodeValidModel{To: address.Value, VerificationCode: rawCode}))
+}
+
+func (s *Sender) send(ctx context.Context, via string, t codeTemplate) error {
+	switch via {
+	case identity.AddressTypeEmail:
+		_, err := s.r.Courier().QueueEmail(ctx, t)
+		return err
+	case identity.AddressTypePhone:
+		_, err := s.r.Courier().QueueSMS(ctx, t)
+		return err
+	default:
+		return errors.Errorf("received unexpected via type: %s", via)
+	}
+}
+
+func normalizeAddress(via identity.VerifiableAddressType, value string) (string, error) {
+	if via == identity.VerifiableAddressTypePhone {
+		return identity.NormalizePhoneNumber(value)
+	}
+	return value, nil
+}
@@ -0,0 +1,113 @@
+package code_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/courier"
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/selfservice/flow/verification"
+	"github.com/zzpu/ums/selfservice/strategy/code"
+)
+
+func TestSender(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/default.schema.json")
+	viper.Set(configuration.ViperKeyPublicBaseURL, "https://www.ory.sh/")
+	viper.Set(configuration.ViperKeyCourierSMTPURL, "smtp://foo@bar@dev.null/")
+
+	u := &http.Request{URL: urlx.ParseOrPanic("https://www.ory.sh/")}
+
+	i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+	i.Traits = identity.Traits(`{"email": "tracked@ory.sh", "phone": "+86 138 0013 8000"}`)
+	require.NoError(t, reg.IdentityManager().Create(context.Background(), i))
+
+	t.Run("method=SendRecoveryCode", func(t *testing.T) {
+		f, err := recovery.NewFlow(time.Hour, "", u, reg.RecoveryStrategies(), flow.TypeAPI)
+		require.NoError(t, err)
+
+		require.NoError(t, reg.RecoveryFlowPersister().CreateRecoveryFlow(context.Background(), f))
+
+		require.NoError(t, reg.CodeSender().SendRecoveryCode(context.Background(), f, "email", "tracked@ory.sh"))
+		require.EqualError(t, reg.CodeSender().SendRecoveryCode(context.Background(), f, "email", "not-tracked@ory.sh"), code.ErrUnknownAddress.Error())
+
+		messages, err := reg.CourierPersister().NextMessages(context.Background(), 12)
+		require.NoError(t, err)
+		require.Len(t, messages, 2)
+
+		assert.EqualValues(t, "tracked@ory.sh", messages[0].Recipient)
+		assert.Contains(t, messages[0].Subject, "Recover access to your account")
+		assert.Regexp(t, `entering the following code:\s+[0-9]{6}\s*$`, messages[0].Body)
+
+		assert.EqualValues(t, "not-tracked@ory.sh", messages[1].Recipient)
+		assert.Contains(t, messages[1].Subject, "Account access attempted")
+		assert.NotRegexp(t, `[0-9]{6}`, messages[1].Body)
+	})
+
+	t.Run("method=SendVerificationCode", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".code.config.length", 8)
+		t.Cleanup(func() {
+			viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".code.config", map[string]interface{}{})
+		})
+
+		f, err := verification.NewFlow(time.Hour, "", u, reg.VerificationStrategies(), flow.TypeAPI)
+		require.NoError(t, err)
+
+		require.NoError(t, reg.VerificationFlowPersister().CreateVerificationFlow(context.Background(), f))
+
+		require.NoError(t, reg.CodeSender().SendVerificationCode(context.Background(), f, "email", "tracked@ory.sh"))
+		require.EqualError(t, reg.CodeSender().SendVerificationCode(context.Background(), f, "email", "not-tracked@ory.sh"), code.ErrUnknownAddress.Error())
+
+		messages, err := reg.CourierPersister().NextMessages(context.Background(), 12)
+		require.NoError(t, err)
+		require.Len(t, messages, 4)
+
+		assert.EqualValues(t, "tracked@ory.sh", messages[2].Recipient)
+		assert.Contains(t, messages[2].Subject, "Please verify")
+		assert.Regexp(t, `entering the following code:\s+[0-9]{8}\s*$`, messages[2].Body)
+
+		assert.EqualValues(t, "not-tracked@ory.sh", messages[3].Recipient)
+		assert.Contains(t, messages[3].Subject, "tried to verify")
+	})
+
+	t.Run("case=sends text messages to phone numbers", func(t *testing.T) {
+		rf, err := recovery.NewFlow(time.Hour, "", u, reg.RecoveryStrategies(), flow.TypeAPI)
+		require.NoError(t, err)
+		require.NoError(t, reg.RecoveryFlowPersister().CreateRecoveryFlow(context.Background(), rf))
+
+		vf, err := verification.NewFlow(time.Hour, "", u, reg.VerificationStrategies(), flow.TypeAPI)
+		require.NoError(t, err)
+		require.NoError(t, reg.VerificationFlowPersister().CreateVerificationFlow(context.Background(), vf))
+
+		require.NoError(t, reg.CodeSender().SendRecoveryCode(context.Background(), rf, "phone", "+86 138-0013-8000"))
+		require.EqualError(t, reg.CodeSender().SendRecoveryCode(context.Background(), rf, "phone", "+8613900139000"), code.ErrUnknownAddress.Error())
+		require.NoError(t, reg.CodeSender().SendVerificationCode(context.Background(), vf, "phone", "0086 13800138000"))
+		require.EqualError(t, reg.CodeSender().SendVerificationCode(context.Background(), vf, "phone", "+8613900139000"), code.ErrUnknownAddress.Error())
+		require.Error(t, reg.CodeSender().SendVerificationCode(context.Background(), vf, "phone", "not-a-number"))
+
+		messages, err := reg.CourierPersister().NextMessages(context.Background(), 12)
+		require.NoError(t, err)
+		require.Len(t, messages, 6, "no text messages must be sent to unknown phone numbers")
+
+		for _, m := range messages[4:] {
+			assert.Equal(t, courier.MessageTypeSMS, m.Type)
+			assert.Empty(t, m.Subject)
+			assert.EqualValues(t, "+8613800138000", m.Recipient)
+		}
+
+		assert.Regexp(t, `recovery code is: [0-9]{6}\s*$`, messages[4].Body)
+		assert.Regexp(t, `verification code is: [0-9]{6}\s*$`, messages[5].Body)
+	})
+}
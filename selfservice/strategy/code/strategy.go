@@ -0,0 +1,119 @@
+package code
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/jsonx"
+
+	"github.com/zzpu/ums/courier"
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/schema"
+	"github.com/zzpu/ums/selfservice/errorx"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/selfservice/flow/settings"
+	"github.com/zzpu/ums/selfservice/flow/verification"
+	"github.com/zzpu/ums/session"
+	"github.com/zzpu/ums/x"
+)
+
+var _ recovery.Strategy = new(Strategy)
+var _ recovery.PublicHandler = new(Strategy)
+
+var _ verification.Strategy = new(Strategy)
+var _ verification.PublicHandler = new(Strategy)
+
+type (
+	strategyDependencies interface {
+		x.CSRFProvider
+		x.CSRFTokenGeneratorProvider
+		x.WriterProvider
+		x.LoggingProvider
+
+		session.HandlerProvider
+		session.ManagementProvider
+		session.PersistenceProvider
+		settings.HandlerProvider
+		settings.FlowPersistenceProvider
+
+		identity.PoolProvider
+		identity.PrivilegedPoolProvider
+
+		courier.Provider
+
+		errorx.ManagementProvider
+
+		recovery.ErrorHandlerProvider
+		recovery.FlowPersistenceProvider
+		recovery.StrategyProvider
+
+		verification.ErrorHandlerProvider
+		verification.FlowPersistenceProvider
+		verification.StrategyProvider
+
+		RecoveryCodePersistenceProvider
+		VerificationCodePersistenceProvider
+		SenderProvider
+	}
+
+	Strategy struct {
+		c  configuration.Provider
+		d  strategyDependencies
+		dx *decoderx.HTTP
+	}
+
+	// Configuration is the configuration of the code method.
+	Configuration struct {
+		// Length is the number of digits of a code.
+		Length int `json:"length"`
+
+		// MaxAttempts is the number of wrong codes which may be submitted before the code is invalidated.
+		MaxAttempts int `json:"max_attempts"`
+
+		// MaxSends is the number of codes which may be requested in one flow.
+		MaxSends int `json:"max_sends"`
+	}
+)
+
+func NewStrategy(d strategyDependencies, c configuration.Provider) *Strategy {
+	return &Strategy{c: c, d: d, dx: decoderx.NewHTTP()}
+}
+
+func (s *Strategy) Config() (*Configuration, error) {
+	return newConfiguration(s.c)
+}
+
+func newConfiguration(c configuration.Provider) (*Configuration, error) {
+	conf := Configuration{Length: 6, MaxAttempts: 5, MaxSends: 5}
+
+	raw := c.SelfServiceStrategy(recovery.StrategyRecoveryCodeName).Config
+	if err := jsonx.
+		NewStrictDecoder(bytes.NewBuffer(raw)).
+		Decode(&conf); err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode code configuration: %s", err))
+	}
+
+	return &conf, nil
+}
+
+// addressFromBody returns the type and the normalized value of the address which was submitted, preferring the
+// email address if both an email address and a phone number were sent.
+func addressFromBody(email, phone string) (identity.VerifiableAddressType, string, error) {
+	if len(email) > 0 {
+		return identity.VerifiableAddressTypeEmail, email, nil
+	}
+
+	if len(phone) > 0 {
+		normalized, err := identity.NormalizePhoneNumber(phone)
+		if err != nil {
+			return "", "", schema.NewInvalidFormatError("#/phone", "phone", phone)
+		}
+		return identity.VerifiableAddressTypePhone, normalized, nil
+	}
+
+	return "", "", schema.NewRequiredError("#/email", "email")
+}
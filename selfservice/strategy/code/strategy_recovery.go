@@ -0,0 +1,397 @@
+package code
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/markbates/pkger"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/sqlxx"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/schema"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/session"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteRecovery = "/self-service/recovery/methods/code"
+)
+
+func (s *Strategy) RecoveryStrategyID() string {
+	return recovery.StrategyRecoveryCodeName
+}
+
+func (s *Strategy) RegisterPublicRecoveryRoutes(public *x.RouterPublic) {
+	redirect := session.RedirectOnAuthenticated(s.c)
+	public.POST(RouteRecovery, s.d.SessionHandler().IsNotAuthenticated(s.handleRecovery, redirect))
+}
+
+func (s *Strategy) PopulateRecoveryMethod(r *http.Request, req *recovery.Flow) error {
+	f := form.NewHTMLForm(req.AppendTo(urlx.AppendPaths(s.c.SelfPublicURL(), RouteRecovery)).String())
+
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+	f.SetField(form.Field{Name: "email", Type: "email"})
+	f.SetField(form.Field{Name: "phone", Type: "tel"})
+
+	req.Methods[s.RecoveryStrategyID()] = &recovery.FlowMethod{
+		Method: s.RecoveryStrategyID(),
+		Config: &recovery.FlowMethodConfig{FlowMethodConfigurator: &FlowMethod{HTMLForm: f}},
+	}
+	return nil
+}
+
+// swagger:parameters completeSelfServiceRecoveryFlowWithCodeMethod
+type completeSelfServiceRecoveryFlowWithCodeMethodParameters struct {
+	// in: body
+	Body completeSelfServiceRecoveryFlowWithCodeMethod
+
+	// The Flow ID
+	//
+	// format: uuid
+	// in: query
+	Flow string `json:"flow"`
+}
+
+func (m *completeSelfServiceRecoveryFlowWithCodeMethodParameters) GetFlow() uuid.UUID {
+	return x.ParseUUID(m.Flow)
+}
+
+type completeSelfServiceRecoveryFlowWithCodeMethod struct {
+	// Email to Recover
+	//
+	// Needs to be set when initiating the flow. If the email is a registered
+	// recovery email, a recovery code will be sent. If the email is not known,
+	// a email with details on what happened will be sent instead.
+	//
+	// format: email
+	// in: body
+	Email string `json:"email"`
+
+	// Phone Number to Recover
+	//
+	// Can be set instead of the email when initiating the flow. If the phone number is a
+	// registered recovery phone number, a recovery code will be sent via SMS. If the phone number
+	// is not known, no message is sent.
+	//
+	// in: body
+	Phone string `json:"phone"`
+
+	// Recovery Code
+	//
+	// The code which was sent to the email address. Needs to be set to
+	// complete the flow once the code was sent.
+	//
+	// in: body
+	Code string `json:"code"`
+
+	// Sending the anti-csrf token is only required for browser login flows.
+	CSRFToken string `form:"csrf_token" json:"csrf_token"`
+}
+
+// swagger:route POST /self-service/recovery/methods/code public completeSelfServiceRecoveryFlowWithCodeMethod
+//
+// Complete Recovery Flow with Code Method
+//
+// Use this endpoint to complete a recovery flow using the code method. This endpoint works
+// with API and browser flows and has several states:
+//
+// - `choose_method` expects `flow` (in the URL query) and `email` (in the body) to be sent. A numeric
+//   one-time code is sent to the email address.
+//	 - For API clients it either returns a HTTP 200 OK when the form is valid and HTTP 400 OK when the form is invalid
+//     and a HTTP 302 Found redirect with a fresh recovery flow if the flow was otherwise invalid (e.g. expired).
+//	 - For Browser clients it returns a HTTP 302 Found redirect to the Recovery UI URL with the Recovery Flow ID appended.
+// - `sent_email` expects `code` (in the body) to be sent. Sending `email` without a `code` requests another code.
+//	 - For API clients it returns a HTTP 200 OK with a session token if the code was valid.
+//	 - For Browser clients it returns a HTTP 302 Found redirect to the Settings UI URL and instructs
+//     the user to update their password.
+//   If the code is invalid, the flow is returned with an error message. A code is invalidated once it
+//   was entered incorrectly too many times.
+//
+// More information can be found at [ORY Kratos Account Recovery Documentation](../self-service/flows/account-recovery.mdx).
+//
+//     Consumes:
+//     - application/json
+//     - application/x-www-form-urlencoded
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: recoveryViaApiResponse
+//       400: recoveryFlow
+//       302: emptyResponse
+//       500: genericError
+func (s *Strategy) handleRecovery(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	body, err := s.decodeRecovery(r)
+	if err != nil {
+		s.handleRecoveryError(w, r, nil, new(completeSelfServiceRecoveryFlowWithCodeMethodParameters), err)
+		return
+	}
+
+	req, err := s.d.RecoveryFlowPersister().GetRecoveryFlow(r.Context(), body.GetFlow())
+	if err != nil {
+		s.handleRecoveryError(w, r, nil, body, err)
+		return
+	}
+
+	if err := req.Valid(); err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	if err := flow.VerifyRequest(r, req.Type, s.d.GenerateCSRFToken, body.Body.CSRFToken); err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	switch req.State {
+	case recovery.StateChooseMethod:
+		s.recoverySendCode(w, r, req, body)
+		return
+	case recovery.StateEmailSent:
+		if len(body.Body.Code) == 0 {
+			s.recoverySendCode(w, r, req, body)
+			return
+		}
+		s.recoveryUseCode(w, r, req, body)
+		return
+	case recovery.StatePassedChallenge:
+		// was already handled, do not allow retry
+		s.retryRecoveryFlowWithMessage(w, r, req.Type, text.NewErrorValidationRecoveryRetrySuccess())
+		return
+	default:
+		s.retryRecoveryFlowWithMessage(w, r, req.Type, text.NewErrorValidationRecoveryStateFailure())
+		return
+	}
+}
+
+func (s *Strategy) recoverySendCode(w http.ResponseWriter, r *http.Request, req *recovery.Flow, body *completeSelfServiceRecoveryFlowWithCodeMethodParameters) {
+	via, to, err := addressFromBody(body.Body.Email, body.Body.Phone)
+	if err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	conf, err := s.Config()
+	if err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	if err := s.d.RecoveryCodePersister().CountRecoveryCodeSend(r.Context(), req.ID, conf.MaxSends); err != nil {
+		if errors.Is(err, ErrCodeSendsExceeded) {
+			s.handleRecoveryError(w, r, req, body, schema.NewCodeSendsExceededError("#/"+string(via)))
+			return
+		}
+
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	if err := s.d.CodeSender().SendRecoveryCode(r.Context(), req, via, to); err != nil {
+		if !errors.Is(err, ErrUnknownAddress) {
+			s.handleRecoveryError(w, r, req, body, err)
+			return
+		}
+		// Continue execution
+	}
+
+	req.Active = sqlxx.NullString(s.RecoveryStrategyID())
+	req.State = recovery.StateEmailSent
+	if err := s.populateRecoveryForm(r, req, body); err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	if via == identity.VerifiableAddressTypePhone {
+		req.Messages.Set(text.NewRecoveryPhoneWithCodeSent())
+	} else {
+		req.Messages.Set(text.NewRecoveryEmailWithCodeSent())
+	}
+	if err := s.d.RecoveryFlowPersister().UpdateRecoveryFlow(r.Context(), req); err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	if req.Type == flow.TypeBrowser {
+		http.Redirect(w, r, req.AppendTo(s.c.SelfServiceFlowRecoveryUI()).String(), http.StatusFound)
+		return
+	}
+
+	updatedFlow, err := s.d.RecoveryFlowPersister().GetRecoveryFlow(r.Context(), req.ID)
+	if err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	s.d.Writer().Write(w, r, updatedFlow)
+}
+
+func (s *Strategy) recoveryUseCode(w http.ResponseWriter, r *http.Request, req *recovery.Flow, body *completeSelfServiceRecoveryFlowWithCodeMethodParameters) {
+	conf, err := s.Config()
+	if err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	code, err := s.d.RecoveryCodePersister().UseRecoveryCode(r.Context(), req.ID, body.Body.Code, conf.MaxAttempts)
+	if err != nil {
+		if errors.Is(err, sqlcon.ErrNoRows) {
+			s.handleRecoveryError(w, r, req, body, schema.NewCodeInvalidError("#/code"))
+			return
+		} else if errors.Is(err, ErrCodeAttemptsExceeded) {
+			s.handleRecoveryError(w, r, req, body, schema.NewCodeAttemptsExceededError("#/code"))
+			return
+		}
+
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	if err := code.Valid(); err != nil {
+		s.handleRecoveryError(w, r, req, body, err)
+		return
+	}
+
+	s.recoveryIssueSession(w, r, req, body, code.RecoveryAddress.IdentityID)
+}
+
+func (s *Strategy) recoveryIssueSession(w http.ResponseWriter, r *http.Request, f *recovery.Flow, body *completeSelfServiceRecoveryFlowWithCodeMethodParameters, recoveredID uuid.UUID) {
+	recovered, err := s.d.IdentityPool().GetIdentity(r.Context(), recoveredID)
+	if err != nil {
+		s.handleRecoveryError(w, r, f, body, err)
+		return
+	}
+
+	f.Messages.Clear()
+	f.State = recovery.StatePassedChallenge
+	f.RecoveredIdentityID = uuid.NullUUID{
+		UUID:  recoveredID,
+		Valid: true,
+	}
+	if err := s.d.RecoveryFlowPersister().UpdateRecoveryFlow(r.Context(), f); err != nil {
+		s.handleRecoveryError(w, r, f, body, err)
+		return
+	}
+
+	sess := session.NewActiveSession(recovered, s.c, time.Now().UTC())
+	if f.Type == flow.TypeAPI {
+		if err := s.d.SessionPersister().CreateSession(r.Context(), sess); err != nil {
+			s.handleRecoveryError(w, r, f, body, err)
+			return
+		}
+
+		s.d.Audit().
+			WithRequest(r).
+			WithField("identity_id", recovered.ID).
+			WithField("session_id", sess.ID).
+			Info("Identity recovered its account using a recovery code and received a session token.")
+
+		s.d.Writer().Write(w, r, &recovery.APIFlowResponse{Session: sess, Token: sess.Token})
+		return
+	}
+
+	if err := s.d.SessionManager().CreateAndIssueCookie(r.Context(), w, r, sess); err != nil {
+		s.handleRecoveryError(w, r, f, body, err)
+		return
+	}
+
+	sf, err := s.d.SettingsHandler().NewFlow(w, r, sess.Identity, flow.TypeBrowser)
+	if err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	sf.Messages.Set(text.NewRecoverySuccessful(time.Now().Add(s.c.SelfServiceFlowSettingsPrivilegedSessionMaxAge())))
+	if err := s.d.SettingsFlowPersister().UpdateSettingsFlow(r.Context(), sf); err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, sf.AppendTo(s.c.SelfServiceFlowSettingsUI()).String(), http.StatusFound)
+}
+
+func (s *Strategy) retryRecoveryFlowWithMessage(w http.ResponseWriter, r *http.Request, ft flow.Type, message *text.Message) {
+	s.d.Logger().WithRequest(r).WithField("message", message).Debug("A recovery flow is being retried because a validation error occurred.")
+
+	req, err := recovery.NewFlow(s.c.SelfServiceFlowRecoveryRequestLifespan(), s.d.GenerateCSRFToken(r), r, s.d.RecoveryStrategies(), ft)
+	if err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	req.Messages.Add(message)
+	if err := s.d.RecoveryFlowPersister().CreateRecoveryFlow(r.Context(), req); err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	if ft == flow.TypeBrowser {
+		http.Redirect(w, r, req.AppendTo(s.c.SelfServiceFlowRecoveryUI()).String(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, urlx.CopyWithQuery(urlx.AppendPaths(s.c.SelfPublicURL(),
+		recovery.RouteGetFlow), url.Values{"id": {req.ID.String()}}).String(), http.StatusFound)
+}
+
+// populateRecoveryForm resets the form of this method. Once the code was sent, the form
+// also asks for the code.
+func (s *Strategy) populateRecoveryForm(r *http.Request, req *recovery.Flow, body *completeSelfServiceRecoveryFlowWithCodeMethodParameters) error {
+	config, err := req.MethodToForm(s.RecoveryStrategyID())
+	if err != nil {
+		return err
+	}
+
+	config.Reset()
+	config.SetCSRF(s.d.GenerateCSRFToken(r))
+	config.SetField(form.Field{Name: "email", Type: "email", Value: body.Body.Email})
+	config.SetField(form.Field{Name: "phone", Type: "tel", Value: body.Body.Phone})
+	if req.State == recovery.StateEmailSent {
+		config.SetField(form.Field{Name: "code", Type: "text", Required: true})
+	}
+	return nil
+}
+
+func (s *Strategy) handleRecoveryError(w http.ResponseWriter, r *http.Request, req *recovery.Flow, body *completeSelfServiceRecoveryFlowWithCodeMethodParameters, err error) {
+	if req != nil {
+		if err := s.populateRecoveryForm(r, req, body); err != nil {
+			s.d.RecoveryFlowErrorHandler().WriteFlowError(w, r, s.RecoveryStrategyID(), req, err)
+			return
+		}
+	}
+
+	s.d.RecoveryFlowErrorHandler().WriteFlowError(w, r, s.RecoveryStrategyID(), req, err)
+}
+
+func (s *Strategy) decodeRecovery(r *http.Request) (*completeSelfServiceRecoveryFlowWithCodeMethodParameters, error) {
+	var body completeSelfServiceRecoveryFlowWithCodeMethod
+
+	if err := s.dx.Decode(r, &body,
+		decoderx.MustHTTPRawJSONSchemaCompiler(
+			x.MustPkgerRead(pkger.Open("/selfservice/strategy/code/.schema/code.schema.json")),
+		),
+		decoderx.HTTPDecoderSetValidatePayloads(false),
+		decoderx.HTTPDecoderJSONFollowsFormFormat()); err != nil {
+		return nil, err
+	}
+
+	return &completeSelfServiceRecoveryFlowWithCodeMethodParameters{
+		Flow: r.URL.Query().Get("flow"),
+		Body: body,
+	}, nil
+}
@@ -0,0 +1,309 @@
+package code_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/assertx"
+	"github.com/ory/x/pointerx"
+	"github.com/ory/x/sqlxx"
+
+	"github.com/zzpu/ums/courier"
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/httpclient/models"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
+	"github.com/zzpu/ums/selfservice/strategy/code"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+func init() {
+	internal.RegisterFakes()
+}
+
+func TestRecovery(t *testing.T) {
+	var identityToRecover = &identity.Identity{
+		Credentials: map[identity.CredentialsType]identity.Credentials{
+			"password": {Type: "password", Identifiers: []string{"recover-with-code@ory.sh"}, Config: sqlxx.JSONRawMessage(`{"hashed_password":"foo"}`)}},
+		Traits:   identity.Traits(`{"email":"recover-with-code@ory.sh"}`),
+		SchemaID: configuration.DefaultIdentityTraitsSchemaID,
+	}
+	var recoveryEmail = gjson.GetBytes(identityToRecover.Traits, "email").String()
+
+	conf, reg := internal.NewFastRegistryWithMocks(t)
+	initViper()
+
+	_ = testhelpers.NewRecoveryUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewLoginUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewSettingsUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewErrorTestServer(t, reg)
+
+	public, _ := testhelpers.NewKratosServer(t, reg)
+
+	require.NoError(t, reg.IdentityManager().Create(context.Background(), identityToRecover,
+		identity.ManagerAllowWriteProtectedTraits))
+
+	var csrfField = &models.FormField{Name: pointerx.String("csrf_token"), Required: true,
+		Type: pointerx.String("hidden"), Value: x.FakeCSRFToken}
+
+	// initFlow returns a client and the code method's form for a new recovery flow.
+	var initFlow = func(t *testing.T, isAPI bool) (*http.Client, *models.RecoveryFlowMethodConfig) {
+		if isAPI {
+			hc := testhelpers.NewDebugClient(t)
+			f := testhelpers.InitializeRecoveryFlowViaAPI(t, hc, public).Payload
+			return hc, testhelpers.GetRecoveryFlowMethodConfig(t, f, recovery.StrategyRecoveryCodeName)
+		}
+
+		hc := testhelpers.NewClientWithCookies(t)
+		f := testhelpers.InitializeRecoveryFlowViaBrowser(t, hc, public).Payload
+		return hc, testhelpers.GetRecoveryFlowMethodConfig(t, f, recovery.StrategyRecoveryCodeName)
+	}
+
+	var submit = func(t *testing.T, isAPI bool, hc *http.Client, config *models.RecoveryFlowMethodConfig, values url.Values, expectedStatusCode int) (string, *http.Response) {
+		values.Set("csrf_token", x.FakeCSRFToken)
+		body, res := testhelpers.RecoveryMakeRequest(t, isAPI, config, hc, testhelpers.EncodeFormAsJSON(t, isAPI, values))
+		assert.EqualValues(t, expectedStatusCode, res.StatusCode, "%s", body)
+		return body, res
+	}
+
+	// sendCode requests a recovery code for the given email address and returns the code
+	// which was sent to the address.
+	var sendCode = func(t *testing.T, isAPI bool, hc *http.Client, config *models.RecoveryFlowMethodConfig, email string) string {
+		actual, res := submit(t, isAPI, hc, config, url.Values{"email": {email}}, http.StatusOK)
+		assert.Contains(t, res.Request.URL.String(), testhelpers.ExpectURL(isAPI, public.URL+code.RouteRecovery, conf.SelfServiceFlowRecoveryUI().String()))
+
+		assert.EqualValues(t, recovery.StrategyRecoveryCodeName, gjson.Get(actual, "active").String(), "%s", actual)
+		assert.EqualValues(t, recovery.StateEmailSent, gjson.Get(actual, "state").String(), "%s", actual)
+		assert.EqualValues(t, email, gjson.Get(actual, "methods.code.config.fields.#(name==email).value").String(), "%s", actual)
+		assert.True(t, gjson.Get(actual, "methods.code.config.fields.#(name==code)").Exists(), "%s", actual)
+		assertx.EqualAsJSON(t, text.NewRecoveryEmailWithCodeSent(), json.RawMessage(gjson.Get(actual, "messages.0").Raw))
+
+		return actual
+	}
+
+	t.Run("description=should set all the correct recovery payloads", func(t *testing.T) {
+		c := testhelpers.NewClientWithCookies(t)
+		rs := testhelpers.GetRecoveryFlow(t, c, public)
+		assert.Contains(t, rs.Payload.Methods, recovery.StrategyRecoveryCodeName)
+		method := rs.Payload.Methods[recovery.StrategyRecoveryCodeName]
+
+		assert.EqualValues(t, models.FormFields{csrfField,
+			{Name: pointerx.String("email"), Type: pointerx.String("email")},
+			{Name: pointerx.String("phone"), Type: pointerx.String("tel")},
+		}, method.Config.Fields)
+		assert.EqualValues(t, public.URL+code.RouteRecovery+"?flow="+string(rs.Payload.ID), *method.Config.Action)
+		assert.Empty(t, method.Config.Messages)
+		assert.Empty(t, rs.Payload.Messages)
+	})
+
+	t.Run("description=should require an email to be sent", func(t *testing.T) {
+		for _, isAPI := range []bool{false, true} {
+			hc, config := initFlow(t, isAPI)
+			actual, _ := submit(t, isAPI, hc, config, url.Values{}, testhelpers.ExpectStatusCode(isAPI, http.StatusBadRequest, http.StatusOK))
+			assert.EqualValues(t, "Property email is missing.",
+				gjson.Get(actual, "methods.code.config.fields.#(name==email).messages.0.text").String(), "%s", actual)
+		}
+	})
+
+	t.Run("description=should try to recover an email that does not exist", func(t *testing.T) {
+		for _, isAPI := range []bool{false, true} {
+			email := x.NewUUID().String() + "@ory.sh"
+			hc, config := initFlow(t, isAPI)
+			sendCode(t, isAPI, hc, config, email)
+
+			message := testhelpers.CourierExpectMessage(t, reg, email, "Account access attempted")
+			assert.Contains(t, message.Body, "If this was you, check if you signed up using a different address.")
+
+			_, err := reg.IdentityPool().FindRecoveryAddressByValue(context.Background(), identity.RecoveryAddressTypeEmail, email)
+			require.Error(t, err)
+
+			actual, _ := submit(t, isAPI, hc, config, url.Values{"email": {email}, "code": {"123456"}},
+				testhelpers.ExpectStatusCode(isAPI, http.StatusBadRequest, http.StatusOK))
+			assert.EqualValues(t, text.NewErrorValidationCodeInvalidOrAlreadyUsed().Text,
+				gjson.Get(actual, "methods.code.config.fields.#(name==code).messages.0.text").String(), "%s", actual)
+		}
+	})
+
+	t.Run("description=should recover an account", func(t *testing.T) {
+		t.Run("type=browser", func(t *testing.T) {
+			hc, config := initFlow(t, false)
+			sendCode(t, false, hc, config, recoveryEmail)
+
+			message := testhelpers.CourierExpectMessage(t, reg, recoveryEmail, "Recover access to your account")
+			recoveryCode := expectCodeInMessage(t, message)
+
+			actual, _ := submit(t, false, hc, config, url.Values{"email": {recoveryEmail}, "code": {"not-the-code"}}, http.StatusOK)
+			assert.EqualValues(t, text.NewErrorValidationCodeInvalidOrAlreadyUsed().Text,
+				gjson.Get(actual, "methods.code.config.fields.#(name==code).messages.0.text").String(), "%s", actual)
+
+			actual, res := submit(t, false, hc, config, url.Values{"email": {recoveryEmail}, "code": {recoveryCode}}, http.StatusOK)
+			assert.Contains(t, res.Request.URL.String(), conf.SelfServiceFlowSettingsUI().String())
+			assert.Equal(t, text.NewRecoverySuccessful(time.Now().Add(time.Hour)).Text,
+				gjson.Get(actual, "messages.0.text").String(), "%s", actual)
+			assert.EqualValues(t, identityToRecover.ID.String(), gjson.Get(actual, "identity.id").String(), "%s", actual)
+		})
+
+		t.Run("type=api", func(t *testing.T) {
+			hc, config := initFlow(t, true)
+			sendCode(t, true, hc, config, recoveryEmail)
+
+			message := testhelpers.CourierExpectMessage(t, reg, recoveryEmail, "Recover access to your account")
+			recoveryCode := expectCodeInMessage(t, message)
+
+			actual, _ := submit(t, true, hc, config, url.Values{"email": {recoveryEmail}, "code": {recoveryCode}}, http.StatusOK)
+			assert.NotEmpty(t, gjson.Get(actual, "session_token").String(), "%s", actual)
+			assert.EqualValues(t, identityToRecover.ID.String(), gjson.Get(actual, "session.identity.id").String(), "%s", actual)
+
+			t.Run("case=should not be able to use the code twice", func(t *testing.T) {
+				actual, res := submit(t, true, hc, config, url.Values{"email": {recoveryEmail}, "code": {recoveryCode}}, http.StatusOK)
+				assert.Contains(t, res.Request.URL.String(), recovery.RouteGetFlow, "%s", actual)
+				assert.EqualValues(t, text.NewErrorValidationRecoveryRetrySuccess().Text,
+					gjson.Get(actual, "messages.0.text").String(), "%s", actual)
+			})
+		})
+	})
+
+	t.Run("description=should recover an account with a phone number", func(t *testing.T) {
+		i := &identity.Identity{
+			Traits:   identity.Traits(`{"email":"recover-phone-with-code@ory.sh","phone":"+8613700137001"}`),
+			SchemaID: configuration.DefaultIdentityTraitsSchemaID,
+		}
+		require.NoError(t, reg.IdentityManager().Create(context.Background(), i, identity.ManagerAllowWriteProtectedTraits))
+
+		hc, config := initFlow(t, true)
+		actual, _ := submit(t, true, hc, config, url.Values{"phone": {"+86 137-0013-7001"}}, http.StatusOK)
+		assert.EqualValues(t, recovery.StateEmailSent, gjson.Get(actual, "state").String(), "%s", actual)
+		assertx.EqualAsJSON(t, text.NewRecoveryPhoneWithCodeSent(), json.RawMessage(gjson.Get(actual, "messages.0").Raw))
+
+		message := testhelpers.CourierExpectMessage(t, reg, "+8613700137001", "")
+		assert.Equal(t, courier.MessageTypeSMS, message.Type)
+
+		actual, _ = submit(t, true, hc, config, url.Values{"phone": {"+8613700137001"}, "code": {expectCodeInMessage(t, message)}}, http.StatusOK)
+		assert.EqualValues(t, i.ID.String(), gjson.Get(actual, "session.identity.id").String(), "%s", actual)
+
+		t.Run("case=should not send text messages to unknown phone numbers", func(t *testing.T) {
+			hc, config := initFlow(t, true)
+			actual, _ := submit(t, true, hc, config, url.Values{"phone": {"+8613700137002"}}, http.StatusOK)
+			assertx.EqualAsJSON(t, text.NewRecoveryPhoneWithCodeSent(), json.RawMessage(gjson.Get(actual, "messages.0").Raw))
+
+			latest, err := reg.CourierPersister().LatestQueuedMessage(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, message.ID, latest.ID)
+		})
+
+		t.Run("case=should reject invalid phone numbers", func(t *testing.T) {
+			hc, config := initFlow(t, true)
+			actual, _ := submit(t, true, hc, config, url.Values{"phone": {"not-a-number"}}, http.StatusBadRequest)
+			assert.NotEmpty(t, gjson.Get(actual, "methods.code.config.fields.#(name==phone).messages.0.text").String(), "%s", actual)
+		})
+	})
+
+	t.Run("description=should invalidate the code after too many attempts", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".code.config.max_attempts", 2)
+		t.Cleanup(func() {
+			viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".code.config", map[string]interface{}{})
+		})
+
+		hc, config := initFlow(t, true)
+		sendCode(t, true, hc, config, recoveryEmail)
+
+		message := testhelpers.CourierExpectMessage(t, reg, recoveryEmail, "Recover access to your account")
+		recoveryCode := expectCodeInMessage(t, message)
+
+		actual, _ := submit(t, true, hc, config, url.Values{"email": {recoveryEmail}, "code": {"not-the-code"}}, http.StatusBadRequest)
+		assert.EqualValues(t, text.NewErrorValidationCodeInvalidOrAlreadyUsed().Text,
+			gjson.Get(actual, "methods.code.config.fields.#(name==code).messages.0.text").String(), "%s", actual)
+
+		actual, _ = submit(t, true, hc, config, url.Values{"email": {recoveryEmail}, "code": {"not-the-code"}}, http.StatusBadRequest)
+		assert.EqualValues(t, text.NewErrorValidationCodeAttemptsExceeded().Text,
+			gjson.Get(actual, "methods.code.config.fields.#(name==code).messages.0.text").String(), "%s", actual)
+
+		actual, _ = submit(t, true, hc, config, url.Values{"email": {recoveryEmail}, "code": {recoveryCode}}, http.StatusBadRequest)
+		assert.EqualValues(t, text.NewErrorValidationCodeInvalidOrAlreadyUsed().Text,
+			gjson.Get(actual, "methods.code.config.fields.#(name==code).messages.0.text").String(), "%s", actual)
+
+		t.Run("case=should accept a newly requested code", func(t *testing.T) {
+			sendCode(t, true, hc, config, recoveryEmail)
+
+			message := testhelpers.CourierExpectMessage(t, reg, recoveryEmail, "Recover access to your account")
+			actual, _ := submit(t, true, hc, config, url.Values{"email": {recoveryEmail}, "code": {expectCodeInMessage(t, message)}}, http.StatusOK)
+			assert.NotEmpty(t, gjson.Get(actual, "session_token").String(), "%s", actual)
+		})
+	})
+
+	t.Run("description=should reject earlier codes once a new code was requested", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".code.config.max_attempts", 2)
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".code.config.max_sends", 2)
+		t.Cleanup(func() {
+			viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".code.config", map[string]interface{}{})
+		})
+
+		hc, config := initFlow(t, true)
+		sendCode(t, true, hc, config, recoveryEmail)
+		firstCode := expectCodeInMessage(t, testhelpers.CourierExpectMessage(t, reg, recoveryEmail, "Recover access to your account"))
+
+		sendCode(t, true, hc, config, recoveryEmail)
+		_ = expectCodeInMessage(t, testhelpers.CourierExpectMessage(t, reg, recoveryEmail, "Recover access to your account"))
+
+		actual, _ := submit(t, true, hc, config, url.Values{"email": {recoveryEmail}, "code": {"not-the-code"}}, http.StatusBadRequest)
+		assert.EqualValues(t, text.NewErrorValidationCodeInvalidOrAlreadyUsed().Text,
+			gjson.Get(actual, "methods.code.config.fields.#(name==code).messages.0.text").String(), "%s", actual)
+
+		actual, _ = submit(t, true, hc, config, url.Values{"email": {recoveryEmail}, "code": {"not-the-code"}}, http.StatusBadRequest)
+		assert.EqualValues(t, text.NewErrorValidationCodeAttemptsExceeded().Text,
+			gjson.Get(actual, "methods.code.config.fields.#(name==code).messages.0.text").String(), "%s", actual)
+
+		actual, _ = submit(t, true, hc, config, url.Values{"email": {recoveryEmail}, "code": {firstCode}}, http.StatusBadRequest)
+		assert.EqualValues(t, text.NewErrorValidationCodeInvalidOrAlreadyUsed().Text,
+			gjson.Get(actual, "methods.code.config.fields.#(name==code).messages.0.text").String(), "%s", actual)
+
+		t.Run("case=should not send more codes than allowed", func(t *testing.T) {
+			actual, _ := submit(t, true, hc, config, url.Values{"email": {recoveryEmail}}, http.StatusBadRequest)
+			assert.EqualValues(t, text.NewErrorValidationCodeSendsExceeded().Text,
+				gjson.Get(actual, "methods.code.config.fields.#(name==email).messages.0.text").String(), "%s", actual)
+		})
+
+		t.Run("case=should count codes sent to unknown addresses", func(t *testing.T) {
+			email := x.NewUUID().String() + "@ory.sh"
+			hc, config := initFlow(t, true)
+			sendCode(t, true, hc, config, email)
+			sendCode(t, true, hc, config, email)
+
+			actual, _ := submit(t, true, hc, config, url.Values{"email": {email}}, http.StatusBadRequest)
+			assert.EqualValues(t, text.NewErrorValidationCodeSendsExceeded().Text,
+				gjson.Get(actual, "methods.code.config.fields.#(name==email).messages.0.text").String(), "%s", actual)
+		})
+	})
+
+	t.Run("description=should not be able to use an outdated code", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceRecoveryRequestLifespan, time.Millisecond*500)
+		t.Cleanup(func() {
+			viper.Set(configuration.ViperKeySelfServiceRecoveryRequestLifespan, time.Minute)
+		})
+
+		hc, config := initFlow(t, false)
+		body := sendCode(t, false, hc, config, recoveryEmail)
+
+		message := testhelpers.CourierExpectMessage(t, reg, recoveryEmail, "Recover access to your account")
+		recoveryCode := expectCodeInMessage(t, message)
+
+		time.Sleep(time.Millisecond * 501)
+
+		actual, res := submit(t, false, hc, config, url.Values{"email": {recoveryEmail}, "code": {recoveryCode}}, http.StatusOK)
+		assert.Contains(t, res.Request.URL.String(), conf.SelfServiceFlowRecoveryUI().String())
+		assert.NotContains(t, res.Request.URL.String(), gjson.Get(body, "id").String())
+		assert.Contains(t, gjson.Get(actual, "messages.0.text").String(), "The recovery flow expired", "%s", actual)
+	})
+}
@@ -0,0 +1,32 @@
+package code_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/viper"
+
+	"github.com/zzpu/ums/courier"
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/flow/recovery"
+)
+
+func initViper() {
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/default.schema.json")
+	viper.Set(configuration.ViperKeySelfServiceBrowserDefaultReturnTo, "https://www.ory.sh")
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+identity.CredentialsTypePassword.String()+".enabled", true)
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+recovery.StrategyRecoveryCodeName+".enabled", true)
+	viper.Set(configuration.ViperKeySelfServiceRecoveryEnabled, true)
+	viper.Set(configuration.ViperKeySelfServiceVerificationEnabled, true)
+}
+
+var codeInMessage = regexp.MustCompile(`\b[0-9]{6}\b`)
+
+func expectCodeInMessage(t *testing.T, message *courier.Message) string {
+	code := codeInMessage.FindString(message.Body)
+	require.NotEmpty(t, code, "%s", message.Body)
+	return code
+}
@@ -0,0 +1,368 @@
+package code
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/markbates/pkger"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/sqlxx"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/schema"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/verification"
+	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteVerification = "/self-service/verification/methods/code"
+)
+
+func (s *Strategy) VerificationStrategyID() string {
+	return verification.StrategyVerificationCodeName
+}
+
+func (s *Strategy) RegisterPublicVerificationRoutes(public *x.RouterPublic) {
+	public.POST(RouteVerification, s.handleVerification)
+}
+
+func (s *Strategy) RegisterAdminVerificationRoutes(admin *x.RouterAdmin) {
+}
+
+func (s *Strategy) PopulateVerificationMethod(r *http.Request, req *verification.Flow) error {
+	f := form.NewHTMLForm(req.AppendTo(urlx.AppendPaths(s.c.SelfPublicURL(), RouteVerification)).String())
+
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+	f.SetField(form.Field{Name: "email", Type: "email"})
+	f.SetField(form.Field{Name: "phone", Type: "tel"})
+
+	req.Methods[s.VerificationStrategyID()] = &verification.FlowMethod{
+		Method: s.VerificationStrategyID(),
+		Config: &verification.FlowMethodConfig{FlowMethodConfigurator: &FlowMethod{HTMLForm: f}},
+	}
+	return nil
+}
+
+func (s *Strategy) decodeVerification(r *http.Request) (*completeSelfServiceVerificationFlowWithCodeMethodParameters, error) {
+	var body completeSelfServiceVerificationFlowWithCodeMethod
+
+	if err := s.dx.Decode(r, &body,
+		decoderx.MustHTTPRawJSONSchemaCompiler(
+			x.MustPkgerRead(pkger.Open("/selfservice/strategy/code/.schema/code.schema.json")),
+		),
+		decoderx.HTTPDecoderSetValidatePayloads(false),
+		decoderx.HTTPDecoderJSONFollowsFormFormat()); err != nil {
+		return nil, err
+	}
+
+	return &completeSelfServiceVerificationFlowWithCodeMethodParameters{
+		Flow: r.URL.Query().Get("flow"),
+		Body: body,
+	}, nil
+}
+
+// populateVerificationForm resets the form of this method. Once the code was sent, the form
+// also asks for the code.
+func (s *Strategy) populateVerificationForm(r *http.Request, f *verification.Flow, body *completeSelfServiceVerificationFlowWithCodeMethodParameters) error {
+	config, err := f.MethodToForm(s.VerificationStrategyID())
+	if err != nil {
+		return err
+	}
+
+	config.Reset()
+	config.SetCSRF(s.d.GenerateCSRFToken(r))
+	config.SetField(form.Field{Name: "email", Type: "email", Value: body.Body.Email})
+	config.SetField(form.Field{Name: "phone", Type: "tel", Value: body.Body.Phone})
+	if f.State == verification.StateEmailSent {
+		config.SetField(form.Field{Name: "code", Type: "text", Required: true})
+	}
+	return nil
+}
+
+// handleVerificationError is a convenience function for handling all types of errors that may occur (e.g. validation error).
+func (s *Strategy) handleVerificationError(w http.ResponseWriter, r *http.Request, f *verification.Flow, body *completeSelfServiceVerificationFlowWithCodeMethodParameters, err error) {
+	if f != nil {
+		if err := s.populateVerificationForm(r, f, body); err != nil {
+			s.d.VerificationFlowErrorHandler().WriteFlowError(w, r, s.VerificationStrategyID(), f, err)
+			return
+		}
+	}
+
+	s.d.VerificationFlowErrorHandler().WriteFlowError(w, r, s.VerificationStrategyID(), f, err)
+}
+
+// swagger:parameters completeSelfServiceVerificationFlowWithCodeMethod
+type completeSelfServiceVerificationFlowWithCodeMethodParameters struct {
+	// in: body
+	Body completeSelfServiceVerificationFlowWithCodeMethod
+
+	// The Flow ID
+	//
+	// format: uuid
+	// in: query
+	Flow string `json:"flow"`
+}
+
+func (m *completeSelfServiceVerificationFlowWithCodeMethodParameters) GetFlow() uuid.UUID {
+	return x.ParseUUID(m.Flow)
+}
+
+type completeSelfServiceVerificationFlowWithCodeMethod struct {
+	// Email to Verify
+	//
+	// Needs to be set when initiating the flow. If the email is a registered
+	// verification email, a verification code will be sent. If the email is not known,
+	// a email with details on what happened will be sent instead.
+	//
+	// format: email
+	// in: body
+	Email string `json:"email"`
+
+	// Phone Number to Verify
+	//
+	// Can be set instead of the email when initiating the flow. If the phone number is a
+	// registered verification phone number, a verification code will be sent via SMS. If the phone number
+	// is not known, no message is sent.
+	//
+	// in: body
+	Phone string `json:"phone"`
+
+	// Verification Code
+	//
+	// The code which was sent to the email address. Needs to be set to
+	// complete the flow once the code was sent.
+	//
+	// in: body
+	Code string `json:"code"`
+
+	// Sending the anti-csrf token is only required for browser login flows.
+	CSRFToken string `form:"csrf_token" json:"csrf_token"`
+}
+
+// swagger:route POST /self-service/verification/methods/code public completeSelfServiceVerificationFlowWithCodeMethod
+//
+// Complete Verification Flow with Code Method
+//
+// Use this endpoint to complete a verification flow using the code method. This endpoint works
+// with API and browser flows and has several states:
+//
+// - `choose_method` expects `flow` (in the URL query) and `email` (in the body) to be sent. A numeric
+//   one-time code is sent to the email address.
+//	 - For API clients it either returns a HTTP 200 OK when the form is valid and HTTP 400 OK when the form is invalid
+//     and a HTTP 302 Found redirect with a fresh verification flow if the flow was otherwise invalid (e.g. expired).
+//	 - For Browser clients it returns a HTTP 302 Found redirect to the Verification UI URL with the Verification Flow ID appended.
+// - `sent_email` expects `code` (in the body) to be sent. Sending `email` without a `code` requests another code.
+//	 - For API clients it returns a HTTP 200 OK with the flow in state `passed_challenge` if the code was valid.
+//	 - For Browser clients it returns a HTTP 302 Found redirect to the verification return URL.
+//   If the code is invalid, the flow is returned with an error message. A code is invalidated once it
+//   was entered incorrectly too many times.
+//
+// More information can be found at [ORY Kratos Email and Phone Verification Documentation](https://www.ory.sh/docs/kratos/selfservice/flows/verify-email-account-activation).
+//
+//     Consumes:
+//     - application/json
+//     - application/x-www-form-urlencoded
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: verificationFlow
+//       400: verificationFlow
+//       302: emptyResponse
+//       500: genericError
+func (s *Strategy) handleVerification(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	body, err := s.decodeVerification(r)
+	if err != nil {
+		s.handleVerificationError(w, r, nil, new(completeSelfServiceVerificationFlowWithCodeMethodParameters), err)
+		return
+	}
+
+	f, err := s.d.VerificationFlowPersister().GetVerificationFlow(r.Context(), body.GetFlow())
+	if err != nil {
+		s.handleVerificationError(w, r, nil, body, err)
+		return
+	}
+
+	if err := f.Valid(); err != nil {
+		s.handleVerificationError(w, r, f, body, err)
+		return
+	}
+
+	if err := flow.VerifyRequest(r, f.Type, s.d.GenerateCSRFToken, body.Body.CSRFToken); err != nil {
+		s.handleVerificationError(w, r, f, body, err)
+		return
+	}
+
+	switch f.State {
+	case verification.StateChooseMethod:
+		s.verificationSendCode(w, r, f, body)
+		return
+	case verification.StateEmailSent:
+		if len(body.Body.Code) == 0 {
+			s.verificationSendCode(w, r, f, body)
+			return
+		}
+		s.verificationUseCode(w, r, f, body)
+		return
+	case verification.StatePassedChallenge:
+		s.retryVerificationFlowWithMessage(w, r, f.Type, text.NewErrorValidationVerificationRetrySuccess())
+		return
+	default:
+		s.retryVerificationFlowWithMessage(w, r, f.Type, text.NewErrorValidationVerificationStateFailure())
+		return
+	}
+}
+
+func (s *Strategy) verificationSendCode(w http.ResponseWriter, r *http.Request, f *verification.Flow, body *completeSelfServiceVerificationFlowWithCodeMethodParameters) {
+	via, to, err := addressFromBody(body.Body.Email, body.Body.Phone)
+	if err != nil {
+		s.handleVerificationError(w, r, f, body, err)
+		return
+	}
+
+	conf, err := s.Config()
+	if err != nil {
+		s.handleVerificationError(w, r, f, body, err)
+		return
+	}
+
+	if err := s.d.VerificationCodePersister().CountVerificationCodeSend(r.Context(), f.ID, conf.MaxSends); err != nil {
+		if errors.Is(err, ErrCodeSendsExceeded) {
+			s.handleVerificationError(w, r, f, body, schema.NewCodeSendsExceededError("#/"+string(via)))
+			return
+		}
+
+		s.handleVerificationError(w, r, f, body, err)
+		return
+	}
+
+	if err := s.d.CodeSender().SendVerificationCode(r.Context(), f, via, to); err != nil {
+		if !errors.Is(err, ErrUnknownAddress) {
+			s.handleVerificationError(w, r, f, body, err)
+			return
+		}
+		// Continue execution
+	}
+
+	f.Active = sqlxx.NullString(s.VerificationStrategyID())
+	f.State = verification.StateEmailSent
+	if err := s.populateVerificationForm(r, f, body); err != nil {
+		s.handleVerificationError(w, r, f, body, err)
+		return
+	}
+
+	if via == identity.VerifiableAddressTypePhone {
+		f.Messages.Set(text.NewVerificationPhoneWithCodeSent())
+	} else {
+		f.Messages.Set(text.NewVerificationEmailWithCodeSent())
+	}
+	if err := s.d.VerificationFlowPersister().UpdateVerificationFlow(r.Context(), f); err != nil {
+		s.handleVerificationError(w, r, f, body, err)
+		return
+	}
+
+	s.verificationWriteFlow(w, r, f, body)
+}
+
+func (s *Strategy) verificationUseCode(w http.ResponseWriter, r *http.Request, f *verification.Flow, body *completeSelfServiceVerificationFlowWithCodeMethodParameters) {
+	conf, err := s.Config()
+	if err != nil {
+		s.handleVerificationError(w, r, f, body, err)
+		return
+	}
+
+	code, err := s.d.VerificationCodePersister().UseVerificationCode(r.Context(), f.ID, body.Body.Code, conf.MaxAttempts)
+	if err != nil {
+		if errors.Is(err, sqlcon.ErrNoRows) {
+			s.handleVerificationError(w, r, f, body, schema.NewCodeInvalidError("#/code"))
+			return
+		} else if errors.Is(err, ErrCodeAttemptsExceeded) {
+			s.handleVerificationError(w, r, f, body, schema.NewCodeAttemptsExceededError("#/code"))
+			return
+		}
+
+		s.handleVerificationError(w, r, f, body, err)
+		return
+	}
+
+	if err := code.Valid(); err != nil {
+		s.handleVerificationError(w, r, f, body, err)
+		return
+	}
+
+	address := code.VerifiableAddress
+	address.Verified = true
+	address.VerifiedAt = sqlxx.NullTime(time.Now().UTC())
+	address.Status = identity.VerifiableAddressStatusCompleted
+	if err := s.d.PrivilegedIdentityPool().UpdateVerifiableAddress(r.Context(), address); err != nil {
+		s.handleVerificationError(w, r, f, body, err)
+		return
+	}
+
+	f.Messages.Clear()
+	f.State = verification.StatePassedChallenge
+	if err := s.d.VerificationFlowPersister().UpdateVerificationFlow(r.Context(), f); err != nil {
+		s.handleVerificationError(w, r, f, body, err)
+		return
+	}
+
+	if f.Type == flow.TypeBrowser {
+		http.Redirect(w, r, s.c.SelfServiceFlowVerificationReturnTo(f.
+			AppendTo(s.c.SelfServiceFlowVerificationUI())).String(), http.StatusFound)
+		return
+	}
+
+	s.verificationWriteFlow(w, r, f, body)
+}
+
+func (s *Strategy) verificationWriteFlow(w http.ResponseWriter, r *http.Request, f *verification.Flow, body *completeSelfServiceVerificationFlowWithCodeMethodParameters) {
+	if f.Type == flow.TypeBrowser {
+		http.Redirect(w, r, f.AppendTo(s.c.SelfServiceFlowVerificationUI()).String(), http.StatusFound)
+		return
+	}
+
+	updatedFlow, err := s.d.VerificationFlowPersister().GetVerificationFlow(r.Context(), f.ID)
+	if err != nil {
+		s.handleVerificationError(w, r, f, body, err)
+		return
+	}
+
+	s.d.Writer().Write(w, r, updatedFlow)
+}
+
+func (s *Strategy) retryVerificationFlowWithMessage(w http.ResponseWriter, r *http.Request, ft flow.Type, message *text.Message) {
+	s.d.Logger().WithRequest(r).WithField("message", message).Debug("A verification flow is being retried because a validation error occurred.")
+
+	req, err := verification.NewFlow(s.c.SelfServiceFlowVerificationRequestLifespan(), s.d.GenerateCSRFToken(r), r, s.d.VerificationStrategies(), ft)
+	if err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	req.Messages.Add(message)
+	if err := s.d.VerificationFlowPersister().CreateVerificationFlow(r.Context(), req); err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	if ft == flow.TypeBrowser {
+		http.Redirect(w, r, req.AppendTo(s.c.SelfServiceFlowVerificationUI()).String(), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, urlx.CopyWithQuery(urlx.AppendPaths(s.c.SelfPublicURL(),
+		verification.RouteGetFlow), url.Values{"id": {req.ID.String()}}).String(), http.StatusFound)
+}
@@ -0,0 +1,310 @@
+package code_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/assertx"
+	"github.com/ory/x/pointerx"
+	"github.com/ory/x/sqlxx"
+
+	"github.com/zzpu/ums/courier"
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/httpclient/models"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/flow/verification"
+	"github.com/zzpu/ums/selfservice/strategy/code"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+func TestVerification(t *testing.T) {
+	conf, reg := internal.NewFastRegistryWithMocks(t)
+	initViper()
+
+	var identityToVerify = &identity.Identity{
+		ID:       x.NewUUID(),
+		Traits:   identity.Traits(`{"email":"verify-with-code@ory.sh"}`),
+		SchemaID: configuration.DefaultIdentityTraitsSchemaID,
+		Credentials: map[identity.CredentialsType]identity.Credentials{
+			"password": {Type: "password", Identifiers: []string{"verify-with-code@ory.sh"}, Config: sqlxx.JSONRawMessage(`{"hashed_password":"foo"}`)}},
+	}
+
+	var verificationEmail = gjson.GetBytes(identityToVerify.Traits, "email").String()
+
+	_ = testhelpers.NewVerificationUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewLoginUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewSettingsUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewErrorTestServer(t, reg)
+
+	public, _ := testhelpers.NewKratosServer(t, reg)
+
+	require.NoError(t, reg.IdentityManager().Create(context.Background(), identityToVerify,
+		identity.ManagerAllowWriteProtectedTraits))
+
+	var csrfField = &models.FormField{Name: pointerx.String("csrf_token"), Required: true,
+		Type: pointerx.String("hidden"), Value: x.FakeCSRFToken}
+
+	// initFlow returns a client and the code method's form for a new verification flow.
+	var initFlow = func(t *testing.T, isAPI bool) (*http.Client, *models.VerificationFlowMethodConfig) {
+		if isAPI {
+			hc := testhelpers.NewDebugClient(t)
+			f := testhelpers.InitializeVerificationFlowViaAPI(t, hc, public).Payload
+			return hc, testhelpers.GetVerificationFlowMethodConfig(t, f, verification.StrategyVerificationCodeName)
+		}
+
+		hc := testhelpers.NewClientWithCookies(t)
+		f := testhelpers.InitializeVerificationFlowViaBrowser(t, hc, public).Payload
+		return hc, testhelpers.GetVerificationFlowMethodConfig(t, f, verification.StrategyVerificationCodeName)
+	}
+
+	var submit = func(t *testing.T, isAPI bool, hc *http.Client, config *models.VerificationFlowMethodConfig, values url.Values, expectedStatusCode int) (string, *http.Response) {
+		values.Set("csrf_token", x.FakeCSRFToken)
+		body, res := testhelpers.VerificationMakeRequest(t, isAPI, config, hc, testhelpers.EncodeFormAsJSON(t, isAPI, values))
+		assert.EqualValues(t, expectedStatusCode, res.StatusCode, "%s", body)
+		return body, res
+	}
+
+	// sendCode requests a verification code for the given email address and returns the
+	// flow as JSON.
+	var sendCode = func(t *testing.T, isAPI bool, hc *http.Client, config *models.VerificationFlowMethodConfig, email string) string {
+		actual, res := submit(t, isAPI, hc, config, url.Values{"email": {email}}, http.StatusOK)
+		assert.Contains(t, res.Request.URL.String(), testhelpers.ExpectURL(isAPI, public.URL+code.RouteVerification, conf.SelfServiceFlowVerificationUI().String()))
+
+		assert.EqualValues(t, verification.StrategyVerificationCodeName, gjson.Get(actual, "active").String(), "%s", actual)
+		assert.EqualValues(t, verification.StateEmailSent, gjson.Get(actual, "state").String(), "%s", actual)
+		assert.EqualValues(t, email, gjson.Get(actual, "methods.code.config.fields.#(name==email).value").String(), "%s", actual)
+		assert.True(t, gjson.Get(actual, "methods.code.config.fields.#(name==code)").Exists(), "%s", actual)
+		assertx.EqualAsJSON(t, text.NewVerificationEmailWithCodeSent(), json.RawMessage(gjson.Get(actual, "messages.0").Raw))
+
+		return actual
+	}
+
+	var resetAddress = func(t *testing.T) {
+		id, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), identityToVerify.ID)
+		require.NoError(t, err)
+		require.Len(t, id.VerifiableAddresses, 1)
+
+		address := id.VerifiableAddresses[0]
+		address.Verified = false
+		address.VerifiedAt = sqlxx.NullTime{}
+		address.Status = identity.VerifiableAddressStatusPending
+		require.NoError(t, reg.PrivilegedIdentityPool().UpdateVerifiableAddress(context.Background(), &address))
+	}
+
+	var expectVerified = func(t *testing.T) {
+		id, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), identityToVerify.ID)
+		require.NoError(t, err)
+		require.Len(t, id.VerifiableAddresses, 1)
+
+		address := id.VerifiableAddresses[0]
+		assert.EqualValues(t, verificationEmail, address.Value)
+		assert.True(t, address.Verified)
+		assert.EqualValues(t, identity.VerifiableAddressStatusCompleted, address.Status)
+		assert.True(t, time.Time(address.VerifiedAt).Add(time.Second*5).After(time.Now()))
+	}
+
+	t.Run("description=should set all the correct verification payloads", func(t *testing.T) {
+		c := testhelpers.NewClientWithCookies(t)
+		rs := testhelpers.GetVerificationFlow(t, c, public)
+		assert.Contains(t, rs.Payload.Methods, verification.StrategyVerificationCodeName)
+		method := rs.Payload.Methods[verification.StrategyVerificationCodeName]
+
+		assert.EqualValues(t, models.FormFields{csrfField,
+			{Name: pointerx.String("email"), Type: pointerx.String("email")},
+			{Name: pointerx.String("phone"), Type: pointerx.String("tel")},
+		}, method.Config.Fields)
+		assert.EqualValues(t, public.URL+code.RouteVerification+"?flow="+string(rs.Payload.ID), *method.Config.Action)
+		assert.Empty(t, method.Config.Messages)
+		assert.Empty(t, rs.Payload.Messages)
+	})
+
+	t.Run("description=should require an email to be sent", func(t *testing.T) {
+		for _, isAPI := range []bool{false, true} {
+			hc, config := initFlow(t, isAPI)
+			actual, _ := submit(t, isAPI, hc, config, url.Values{}, testhelpers.ExpectStatusCode(isAPI, http.StatusBadRequest, http.StatusOK))
+			assert.EqualValues(t, "Property email is missing.",
+				gjson.Get(actual, "methods.code.config.fields.#(name==email).messages.0.text").String(), "%s", actual)
+		}
+	})
+
+	t.Run("description=should try to verify an email that does not exist", func(t *testing.T) {
+		for _, isAPI := range []bool{false, true} {
+			email := x.NewUUID().String() + "@ory.sh"
+			hc, config := initFlow(t, isAPI)
+			sendCode(t, isAPI, hc, config, email)
+
+			message := testhelpers.CourierExpectMessage(t, reg, email, "Someone tried to verify this email address")
+			assert.Contains(t, message.Body, "If this was you, check if you signed up using a different address.")
+		}
+	})
+
+	t.Run("description=should verify an email address", func(t *testing.T) {
+		t.Run("type=browser", func(t *testing.T) {
+			resetAddress(t)
+			hc, config := initFlow(t, false)
+			sendCode(t, false, hc, config, verificationEmail)
+
+			message := testhelpers.CourierExpectMessage(t, reg, verificationEmail, "Please verify your email address")
+			verificationCode := expectCodeInMessage(t, message)
+
+			actual, _ := submit(t, false, hc, config, url.Values{"email": {verificationEmail}, "code": {"not-the-code"}}, http.StatusOK)
+			assert.EqualValues(t, text.NewErrorValidationCodeInvalidOrAlreadyUsed().Text,
+				gjson.Get(actual, "methods.code.config.fields.#(name==code).messages.0.text").String(), "%s", actual)
+
+			actual, res := submit(t, false, hc, config, url.Values{"email": {verificationEmail}, "code": {verificationCode}}, http.StatusOK)
+			assert.Contains(t, res.Request.URL.String(), conf.SelfServiceFlowVerificationUI().String())
+			assert.EqualValues(t, verification.StatePassedChallenge, gjson.Get(actual, "state").String(), "%s", actual)
+			expectVerified(t)
+		})
+
+		t.Run("type=api", func(t *testing.T) {
+			resetAddress(t)
+			hc, config := initFlow(t, true)
+			sendCode(t, true, hc, config, verificationEmail)
+
+			message := testhelpers.CourierExpectMessage(t, reg, verificationEmail, "Please verify your email address")
+			verificationCode := expectCodeInMessage(t, message)
+
+			actual, _ := submit(t, true, hc, config, url.Values{"email": {verificationEmail}, "code": {verificationCode}}, http.StatusOK)
+			assert.EqualValues(t, verification.StatePassedChallenge, gjson.Get(actual, "state").String(), "%s", actual)
+			expectVerified(t)
+
+			t.Run("case=should not be able to use the code twice", func(t *testing.T) {
+				actual, res := submit(t, true, hc, config, url.Values{"email": {verificationEmail}, "code": {verificationCode}}, http.StatusOK)
+				assert.Contains(t, res.Request.URL.String(), verification.RouteGetFlow, "%s", actual)
+				assert.EqualValues(t, text.NewErrorValidationVerificationRetrySuccess().Text,
+					gjson.Get(actual, "messages.0.text").String(), "%s", actual)
+			})
+		})
+	})
+
+	t.Run("description=should verify a phone number", func(t *testing.T) {
+		i := &identity.Identity{
+			Traits:   identity.Traits(`{"email":"verify-phone-with-code@ory.sh","phone":"+8613700137003"}`),
+			SchemaID: configuration.DefaultIdentityTraitsSchemaID,
+		}
+		require.NoError(t, reg.IdentityManager().Create(context.Background(), i, identity.ManagerAllowWriteProtectedTraits))
+
+		hc, config := initFlow(t, true)
+		actual, _ := submit(t, true, hc, config, url.Values{"phone": {"0086 137 0013 7003"}}, http.StatusOK)
+		assert.EqualValues(t, verification.StateEmailSent, gjson.Get(actual, "state").String(), "%s", actual)
+		assertx.EqualAsJSON(t, text.NewVerificationPhoneWithCodeSent(), json.RawMessage(gjson.Get(actual, "messages.0").Raw))
+
+		message := testhelpers.CourierExpectMessage(t, reg, "+8613700137003", "")
+		assert.Equal(t, courier.MessageTypeSMS, message.Type)
+
+		actual, _ = submit(t, true, hc, config, url.Values{"phone": {"+8613700137003"}, "code": {expectCodeInMessage(t, message)}}, http.StatusOK)
+		assert.EqualValues(t, verification.StatePassedChallenge, gjson.Get(actual, "state").String(), "%s", actual)
+
+		address, err := reg.IdentityPool().FindVerifiableAddressByValue(context.Background(), identity.VerifiableAddressTypePhone, "+8613700137003")
+		require.NoError(t, err)
+		assert.True(t, address.Verified)
+
+		t.Run("case=should not send text messages to unknown phone numbers", func(t *testing.T) {
+			hc, config := initFlow(t, true)
+			actual, _ := submit(t, true, hc, config, url.Values{"phone": {"+8613700137004"}}, http.StatusOK)
+			assertx.EqualAsJSON(t, text.NewVerificationPhoneWithCodeSent(), json.RawMessage(gjson.Get(actual, "messages.0").Raw))
+
+			latest, err := reg.CourierPersister().LatestQueuedMessage(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, message.ID, latest.ID)
+		})
+	})
+
+	t.Run("description=should invalidate the code after too many attempts", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".code.config.max_attempts", 1)
+		t.Cleanup(func() {
+			viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".code.config", map[string]interface{}{})
+		})
+
+		hc, config := initFlow(t, true)
+		sendCode(t, true, hc, config, verificationEmail)
+
+		message := testhelpers.CourierExpectMessage(t, reg, verificationEmail, "Please verify your email address")
+		verificationCode := expectCodeInMessage(t, message)
+
+		actual, _ := submit(t, true, hc, config, url.Values{"email": {verificationEmail}, "code": {"not-the-code"}}, http.StatusBadRequest)
+		assert.EqualValues(t, text.NewErrorValidationCodeAttemptsExceeded().Text,
+			gjson.Get(actual, "methods.code.config.fields.#(name==code).messages.0.text").String(), "%s", actual)
+
+		actual, _ = submit(t, true, hc, config, url.Values{"email": {verificationEmail}, "code": {verificationCode}}, http.StatusBadRequest)
+		assert.EqualValues(t, text.NewErrorValidationCodeInvalidOrAlreadyUsed().Text,
+			gjson.Get(actual, "methods.code.config.fields.#(name==code).messages.0.text").String(), "%s", actual)
+	})
+
+	t.Run("description=should reject earlier codes once a new code was requested", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".code.config.max_attempts", 2)
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".code.config.max_sends", 2)
+		t.Cleanup(func() {
+			viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".code.config", map[string]interface{}{})
+		})
+
+		hc, config := initFlow(t, true)
+		sendCode(t, true, hc, config, verificationEmail)
+		firstCode := expectCodeInMessage(t, testhelpers.CourierExpectMessage(t, reg, verificationEmail, "Please verify your email address"))
+
+		sendCode(t, true, hc, config, verificationEmail)
+		_ = expectCodeInMessage(t, testhelpers.CourierExpectMessage(t, reg, verificationEmail, "Please verify your email address"))
+
+		actual, _ := submit(t, true, hc, config, url.Values{"email": {verificationEmail}, "code": {"not-the-code"}}, http.StatusBadRequest)
+		assert.EqualValues(t, text.NewErrorValidationCodeInvalidOrAlreadyUsed().Text,
+			gjson.Get(actual, "methods.code.config.fields.#(name==code).messages.0.text").String(), "%s", actual)
+
+		actual, _ = submit(t, true, hc, config, url.Values{"email": {verificationEmail}, "code": {"not-the-code"}}, http.StatusBadRequest)
+		assert.EqualValues(t, text.NewErrorValidationCodeAttemptsExceeded().Text,
+			gjson.Get(actual, "methods.code.config.fields.#(name==code).messages.0.text").String(), "%s", actual)
+
+		actual, _ = submit(t, true, hc, config, url.Values{"email": {verificationEmail}, "code": {firstCode}}, http.StatusBadRequest)
+		assert.EqualValues(t, text.NewErrorValidationCodeInvalidOrAlreadyUsed().Text,
+			gjson.Get(actual, "methods.code.config.fields.#(name==code).messages.0.text").String(), "%s", actual)
+
+		t.Run("case=should not send more codes than allowed", func(t *testing.T) {
+			actual, _ := submit(t, true, hc, config, url.Values{"email": {verificationEmail}}, http.StatusBadRequest)
+			assert.EqualValues(t, text.NewErrorValidationCodeSendsExceeded().Text,
+				gjson.Get(actual, "methods.code.config.fields.#(name==email).messages.0.text").String(), "%s", actual)
+		})
+
+		t.Run("case=should count codes sent to unknown addresses", func(t *testing.T) {
+			email := x.NewUUID().String() + "@ory.sh"
+			hc, config := initFlow(t, true)
+			sendCode(t, true, hc, config, email)
+			sendCode(t, true, hc, config, email)
+
+			actual, _ := submit(t, true, hc, config, url.Values{"email": {email}}, http.StatusBadRequest)
+			assert.EqualValues(t, text.NewErrorValidationCodeSendsExceeded().Text,
+				gjson.Get(actual, "methods.code.config.fields.#(name==email).messages.0.text").String(), "%s", actual)
+		})
+	})
+
+	t.Run("description=should not be able to use an outdated code", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceVerificationRequestLifespan, time.Millisecond*500)
+		t.Cleanup(func() {
+			viper.Set(configuration.ViperKeySelfServiceVerificationRequestLifespan, time.Minute)
+		})
+
+		hc, config := initFlow(t, false)
+		body := sendCode(t, false, hc, config, verificationEmail)
+
+		message := testhelpers.CourierExpectMessage(t, reg, verificationEmail, "Please verify your email address")
+		verificationCode := expectCodeInMessage(t, message)
+
+		time.Sleep(time.Millisecond * 501)
+
+		actual, res := submit(t, false, hc, config, url.Values{"email": {verificationEmail}, "code": {verificationCode}}, http.StatusOK)
+		assert.Contains(t, res.Request.URL.String(), conf.SelfServiceFlowVerificationUI().String())
+		assert.NotContains(t, res.Request.URL.String(), gjson.Get(body, "id").String())
+		assert.Contains(t, gjson.Get(actual, "messages.0.text").String(), "The verification flow expired", "%s", actual)
+	})
+}
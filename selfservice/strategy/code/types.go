@@ -0,0 +1,16 @@
+package code
+
+import (
+	"github.com/ory/x/randx"
+
+	"github.com/zzpu/ums/selfservice/form"
+)
+
+// FlowMethod contains the configuration for this selfservice strategy.
+type FlowMethod struct {
+	*form.HTMLForm
+}
+
+func newCode(length int) string {
+	return randx.MustString(length, randx.Numeric)
+}
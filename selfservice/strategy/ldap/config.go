@@ -0,0 +1,82 @@
+package ldap
+
+import (
+	"fmt"
+	"time"
+)
+
+// Configuration is the configuration of the LDAP method.
+type Configuration struct {
+	// URL is the URL of the LDAP server, e.g. ldap://ldap.example.org:389 or ldaps://ad.example.org:636.
+	URL string `json:"url"`
+
+	// StartTLS upgrades an ldap:// connection to TLS before any credentials are sent.
+	StartTLS bool `json:"start_tls"`
+
+	// BindDN is the DN of the service account used to search for users. If empty, users are searched anonymously.
+	BindDN string `json:"bind_dn"`
+
+	// BindPassword is the password of the service account.
+	BindPassword string `json:"bind_password"`
+
+	// BaseDN is the DN below which users are searched.
+	BaseDN string `json:"base_dn"`
+
+	// UserFilter is the filter used to find a user. %s is replaced by the escaped identifier.
+	UserFilter string `json:"user_filter"`
+
+	// Attributes are the attributes fetched for a user. If empty, all attributes are fetched.
+	Attributes []string `json:"attributes"`
+
+	// IDAttribute is the attribute which identifies a user, such as entryUUID or objectGUID for Active Directory.
+	// Its value must never change or be reused. Defaults to entryUUID.
+	IDAttribute string `json:"id_attribute"`
+
+	// Mapper specifies the JSONNet code snippet which uses the LDAP entry to hydrate the identity's traits.
+	//
+	// It can be either a URL (file://, http(s)://, base64://) or an inline JSONNet code snippet.
+	Mapper string `json:"mapper_url"`
+
+	// Sync configures the periodic directory synchronization.
+	Sync SyncConfiguration `json:"sync"`
+}
+
+// SyncConfiguration is the configuration of the periodic directory synchronization.
+type SyncConfiguration struct {
+	// Enabled enables the synchronization.
+	Enabled bool `json:"enabled"`
+
+	// Interval is the time between two synchronization runs.
+	Interval string `json:"interval"`
+
+	// Filter is the filter used to find all users. Defaults to the user filter with a wildcard identifier.
+	Filter string `json:"filter"`
+}
+
+func (c *Configuration) userFilter(escapedIdentifier string) string {
+	return fmt.Sprintf(c.UserFilter, escapedIdentifier)
+}
+
+// searchAttributes returns the attributes fetched for a user. The identifier attribute is always requested because
+// operational attributes such as entryUUID are not returned otherwise.
+func (c *Configuration) searchAttributes() []string {
+	if len(c.Attributes) == 0 {
+		return []string{"*", c.IDAttribute}
+	}
+	return append(append([]string{}, c.Attributes...), c.IDAttribute)
+}
+
+func (c *Configuration) syncFilter() string {
+	if len(c.Sync.Filter) > 0 {
+		return c.Sync.Filter
+	}
+	return c.userFilter("*")
+}
+
+func (c *Configuration) syncInterval() time.Duration {
+	d, err := time.ParseDuration(c.Sync.Interval)
+	if err != nil {
+		return time.Hour
+	}
+	return d
+}
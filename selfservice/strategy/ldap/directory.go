@@ -0,0 +1,173 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/zzpu/ums/schema"
+)
+
+const (
+	requestTimeout = time.Second * 10
+	syncPageSize   = 500
+)
+
+// binaryIDAttributes are identifier attributes with binary values, which are hex encoded.
+var binaryIDAttributes = map[string]bool{"objectguid": true, "objectsid": true}
+
+// Entry is a user entry of the directory. It is passed to the Jsonnet mapper as `std.extVar('entry')`.
+type Entry struct {
+	// ID is the value of the configured identifier attribute, e.g. entryUUID or objectGUID. Unlike the DN, it
+	// does not change when the entry is renamed or moved and it is not reused for other entries.
+	ID string `json:"id"`
+
+	// DN is the distinguished name of the entry.
+	DN string `json:"dn"`
+
+	// Attributes are the entry's attributes. Attribute names are lower-cased.
+	Attributes map[string][]string `json:"attributes"`
+}
+
+func newEntry(c *Configuration, e *goldap.Entry) (*Entry, error) {
+	raw := e.GetEqualFoldRawAttributeValue(c.IDAttribute)
+	if len(raw) == 0 {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.
+			WithReasonf(`The LDAP entry does not have the identifier attribute "%s".`, c.IDAttribute).
+			WithDebugf("dn: %s", e.DN))
+	}
+
+	id := string(raw)
+	if binaryIDAttributes[strings.ToLower(c.IDAttribute)] {
+		id = hex.EncodeToString(raw)
+	}
+
+	attributes := make(map[string][]string, len(e.Attributes))
+	for _, a := range e.Attributes {
+		attributes[strings.ToLower(a.Name)] = a.Values
+	}
+	return &Entry{ID: id, DN: e.DN, Attributes: attributes}, nil
+}
+
+// identifier returns the credentials identifier of the entry.
+func (e *Entry) identifier() string {
+	return strings.ToLower(e.ID)
+}
+
+func errUnavailable(err error) error {
+	return errors.WithStack(herodot.ErrInternalServerError.
+		WithReason("Unable to communicate with the LDAP server. Please try again later.").
+		WithDebug(err.Error()))
+}
+
+// dial connects to the LDAP server and binds the service account if one is configured.
+func dial(c *Configuration) (*goldap.Conn, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The LDAP server URL is invalid: %s", err))
+	}
+
+	conn, err := goldap.DialURL(c.URL, goldap.DialWithTLSConfig(&tls.Config{ServerName: u.Hostname()}))
+	if err != nil {
+		return nil, errUnavailable(err)
+	}
+	conn.SetTimeout(requestTimeout)
+
+	if c.StartTLS {
+		if err := conn.StartTLS(&tls.Config{ServerName: u.Hostname()}); err != nil {
+			conn.Close()
+			return nil, errUnavailable(err)
+		}
+	}
+
+	if err := bindServiceAccount(conn, c); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func bindServiceAccount(conn *goldap.Conn, c *Configuration) error {
+	if len(c.BindDN) == 0 {
+		return nil
+	}
+
+	if err := conn.Bind(c.BindDN, c.BindPassword); err != nil {
+		return errUnavailable(errors.Wrap(err, "unable to bind the service account"))
+	}
+
+	return nil
+}
+
+func search(conn *goldap.Conn, c *Configuration, filter string, sizeLimit int) ([]*goldap.Entry, error) {
+	req := goldap.NewSearchRequest(c.BaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases,
+		sizeLimit, int(requestTimeout/time.Second), false, filter, c.searchAttributes(), nil)
+
+	if sizeLimit > 0 {
+		res, err := conn.Search(req)
+		if err != nil {
+			if goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) && res != nil {
+				return res.Entries, nil
+			}
+			return nil, errUnavailable(err)
+		}
+		return res.Entries, nil
+	}
+
+	res, err := conn.SearchWithPaging(req, syncPageSize)
+	if err != nil {
+		return nil, errUnavailable(err)
+	}
+	return res.Entries, nil
+}
+
+// authenticate finds the user matching the identifier and verifies the password by binding as that user.
+func authenticate(c *Configuration, identifier, password string) (*Entry, error) {
+	if len(identifier) == 0 || len(password) == 0 {
+		return nil, errors.WithStack(schema.NewInvalidCredentialsError())
+	}
+
+	conn, err := dial(c)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entries, err := search(conn, c, c.userFilter(goldap.EscapeFilter(identifier)), 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ambiguous identifiers are rejected so that a user can never sign in to another user's identity.
+	if len(entries) != 1 {
+		return nil, errors.WithStack(schema.NewInvalidCredentialsError())
+	}
+
+	if err := conn.Bind(entries[0].DN, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, errors.WithStack(schema.NewInvalidCredentialsError())
+		}
+		return nil, errUnavailable(err)
+	}
+
+	return newEntry(c, entries[0])
+}
+
+// searchAll returns all users matching the synchronization filter.
+func searchAll(c *Configuration) ([]*goldap.Entry, error) {
+	conn, err := dial(c)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return search(conn, c, c.syncFilter(), 0)
+}
@@ -0,0 +1,217 @@
+package ldap_test
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/require"
+)
+
+type testEntry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// testDirectory is an in-process LDAP server which supports simple binds and searches with
+// and, or, not, equality, and presence filters.
+type testDirectory struct {
+	l       net.Listener
+	mu      sync.Mutex
+	entries []testEntry
+}
+
+func newTestDirectory(t *testing.T, entries ...testEntry) *testDirectory {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	d := &testDirectory{l: l, entries: entries}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+
+	t.Cleanup(func() {
+		_ = l.Close()
+	})
+	return d
+}
+
+func (d *testDirectory) URL() string {
+	return "ldap://" + d.l.Addr().String()
+}
+
+func (d *testDirectory) add(e testEntry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries = append(d.entries, e)
+}
+
+func (d *testDirectory) find(dn string) (testEntry, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, e := range d.entries {
+		if strings.EqualFold(e.DN, dn) {
+			return e, true
+		}
+	}
+	return testEntry{}, false
+}
+
+func (d *testDirectory) rename(dn, newDN string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for k := range d.entries {
+		if strings.EqualFold(d.entries[k].DN, dn) {
+			d.entries[k].DN = newDN
+		}
+	}
+}
+
+func (d *testDirectory) remove(dn string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for k := range d.entries {
+		if strings.EqualFold(d.entries[k].DN, dn) {
+			d.entries = append(d.entries[:k], d.entries[k+1:]...)
+			return
+		}
+	}
+}
+
+// id returns the credentials identifier of the entry.
+func (d *testDirectory) id(dn string) string {
+	e, _ := d.find(dn)
+	return strings.ToLower(attribute(e, "entryUUID")[0])
+}
+
+func (d *testDirectory) search(baseDN string, filter *ber.Packet) []testEntry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var result []testEntry
+	for _, e := range d.entries {
+		if strings.HasSuffix(strings.ToLower(e.DN), strings.ToLower(baseDN)) && matches(e, filter) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func matches(e testEntry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case goldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matches(e, child) {
+				return false
+			}
+		}
+		return true
+	case goldap.FilterOr:
+		for _, child := range filter.Children {
+			if matches(e, child) {
+				return true
+			}
+		}
+		return false
+	case goldap.FilterNot:
+		return !matches(e, filter.Children[0])
+	case goldap.FilterEqualityMatch:
+		for _, v := range attribute(e, filter.Children[0].Value.(string)) {
+			if strings.EqualFold(v, filter.Children[1].Value.(string)) {
+				return true
+			}
+		}
+		return false
+	case goldap.FilterPresent:
+		return len(attribute(e, filter.Data.String())) > 0
+	}
+	return false
+}
+
+func attribute(e testEntry, name string) []string {
+	for k, v := range e.Attributes {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+func (d *testDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		p, err := ber.ReadPacket(conn)
+		if err != nil || len(p.Children) < 2 {
+			return
+		}
+
+		id := p.Children[0].Value.(int64)
+		op := p.Children[1]
+		switch op.Tag {
+		case goldap.ApplicationBindRequest:
+			code := uint16(goldap.LDAPResultInvalidCredentials)
+			if e, ok := d.find(op.Children[1].Value.(string)); ok && e.Password == op.Children[2].Data.String() {
+				code = goldap.LDAPResultSuccess
+			}
+			_, _ = conn.Write(result(id, goldap.ApplicationBindResponse, code).Bytes())
+		case goldap.ApplicationSearchRequest:
+			sizeLimit := int(op.Children[3].Value.(int64))
+			code := uint16(goldap.LDAPResultSuccess)
+			found := d.search(op.Children[0].Value.(string), op.Children[6])
+			if sizeLimit > 0 && len(found) > sizeLimit {
+				found = found[:sizeLimit]
+				code = goldap.LDAPResultSizeLimitExceeded
+			}
+			for _, e := range found {
+				_, _ = conn.Write(searchEntry(id, e).Bytes())
+			}
+			_, _ = conn.Write(result(id, goldap.ApplicationSearchResultDone, code).Bytes())
+		case goldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func envelope(id int64, op *ber.Packet) *ber.Packet {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	p.AppendChild(op)
+	return p
+}
+
+func result(id int64, tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return envelope(id, op)
+}
+
+func searchEntry(id int64, e testEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "DN"))
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range e.Attributes {
+		a := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		a.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		a.AppendChild(vals)
+		attributes.AppendChild(a)
+	}
+	op.AppendChild(attributes)
+	return envelope(id, op)
+}
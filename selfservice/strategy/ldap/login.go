@@ -0,0 +1,172 @@
+package ldap
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/markbates/pkger"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/login"
+	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteLogin = "/self-service/login/methods/ldap"
+)
+
+func (s *Strategy) RegisterLoginRoutes(r *x.RouterPublic) {
+	s.d.CSRFHandler().ExemptPath(RouteLogin)
+	r.POST(RouteLogin, s.handleLogin)
+}
+
+func (s *Strategy) handleLoginError(w http.ResponseWriter, r *http.Request, rr *login.Flow, payload *CompleteSelfServiceLoginFlowWithLDAPMethod, err error) {
+	if rr != nil {
+		if method, ok := rr.Methods[s.ID()]; ok {
+			method.Config.Reset()
+			method.Config.SetValue("identifier", payload.Identifier)
+			if rr.Type == flow.TypeBrowser {
+				method.Config.SetCSRF(s.d.GenerateCSRFToken(r))
+			}
+
+			rr.Methods[s.ID()] = method
+		}
+	}
+
+	s.d.LoginFlowErrorHandler().WriteFlowError(w, r, s.ID(), rr, err)
+}
+
+// nolint:deadcode,unused
+// swagger:parameters completeSelfServiceLoginFlowWithLDAPMethod
+type completeSelfServiceLoginFlowWithLDAPMethodParameters struct {
+	// The Flow ID
+	//
+	// required: true
+	// in: query
+	Flow string `json:"flow"`
+
+	// in: body
+	CompleteSelfServiceLoginFlowWithLDAPMethod
+}
+
+// swagger:route POST /self-service/login/methods/ldap public completeSelfServiceLoginFlowWithLDAPMethod
+//
+// Complete Login Flow with the LDAP Method
+//
+// Use this endpoint to complete a login flow by sending the directory username and password. The credentials are
+// verified by binding to the configured LDAP server. On the first login the identity is created using the configured
+// Jsonnet mapper; on every further login its traits are updated from the directory.
+//
+// API flows expect `application/json` to be sent in the body and responds with
+//   - HTTP 200 and a application/json body with the session token on success;
+//   - HTTP 302 redirect to a fresh login flow if the original flow expired with the appropriate error messages set;
+//   - HTTP 400 on form validation errors.
+//
+// Browser flows expect `application/x-www-form-urlencoded` to be sent in the body and responds with
+//   - a HTTP 302 redirect to the post/after login URL or the `return_to` value if it was set and if the login succeeded;
+//   - a HTTP 302 redirect to the login UI URL with the flow ID containing the validation errors otherwise.
+//
+//     Schemes: http, https
+//
+//     Consumes:
+//     - application/json
+//     - application/x-www-form-urlencoded
+//
+//     Produces:
+//     - application/json
+//
+//     Responses:
+//       200: loginViaApiResponse
+//       302: emptyResponse
+//       400: loginFlow
+//       500: genericError
+func (s *Strategy) handleLogin(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rid := x.ParseUUID(r.URL.Query().Get("flow"))
+	if x.IsZeroUUID(rid) {
+		s.handleLoginError(w, r, nil, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The flow query parameter is missing or invalid.")))
+		return
+	}
+
+	ar, err := s.d.LoginFlowPersister().GetLoginFlow(r.Context(), rid)
+	if err != nil {
+		s.handleLoginError(w, r, nil, nil, err)
+		return
+	}
+
+	var p CompleteSelfServiceLoginFlowWithLDAPMethod
+	if err := s.hd.Decode(r, &p, decoderx.MustHTTPRawJSONSchemaCompiler(x.MustPkgerRead(
+		pkger.Open("/selfservice/strategy/ldap/.schema/login.schema.json")))); err != nil {
+		s.handleLoginError(w, r, ar, &p, err)
+		return
+	}
+
+	if err := flow.VerifyRequest(r, ar.Type, s.d.GenerateCSRFToken, p.CSRFToken); err != nil {
+		s.handleLoginError(w, r, ar, &p, x.ErrInvalidCSRFToken)
+		return
+	}
+
+	if _, err := s.d.SessionManager().FetchFromRequest(r.Context(), r); err == nil && !ar.Forced {
+		if ar.Type == flow.TypeBrowser {
+			http.Redirect(w, r, s.c.SelfServiceBrowserDefaultReturnTo().String(), http.StatusFound)
+			return
+		}
+
+		s.d.Writer().WriteError(w, r, errors.WithStack(login.ErrAlreadyLoggedIn))
+		return
+	}
+
+	if err := ar.Valid(); err != nil {
+		s.handleLoginError(w, r, ar, &p, err)
+		return
+	}
+
+	c, err := s.Config()
+	if err != nil {
+		s.handleLoginError(w, r, ar, &p, err)
+		return
+	}
+
+	entry, err := authenticate(c, p.Identifier, p.Password)
+	if err != nil {
+		s.handleLoginError(w, r, ar, &p, err)
+		return
+	}
+
+	i, err := s.upsertIdentity(r.Context(), c, entry)
+	if err != nil {
+		s.handleLoginError(w, r, ar, &p, err)
+		return
+	}
+
+	if err := s.d.LoginHookExecutor().PostLoginHook(w, r, s.ID(), ar, i); err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+}
+
+func (s *Strategy) PopulateLoginMethod(r *http.Request, sr *login.Flow) error {
+	f := &form.HTMLForm{
+		Action: sr.AppendTo(urlx.AppendPaths(s.c.SelfPublicURL(), RouteLogin)).String(),
+		Method: "POST",
+		Fields: form.Fields{{
+			Name:     "identifier",
+			Type:     "text",
+			Required: true,
+		}, {
+			Name:     "password",
+			Type:     "password",
+			Required: true,
+		}}}
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+
+	sr.Methods[s.ID()] = &login.FlowMethod{
+		Method: s.ID(),
+		Config: &login.FlowMethodConfig{FlowMethodConfigurator: &FlowMethod{HTMLForm: f}}}
+	return nil
+}
@@ -0,0 +1,168 @@
+package ldap_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/strategy/ldap"
+	"github.com/zzpu/ums/text"
+)
+
+const baseDN = "ou=people,dc=example,dc=org"
+
+func newPerson(uid, password, mail string) testEntry {
+	return testEntry{
+		DN:       "uid=" + uid + "," + baseDN,
+		Password: password,
+		Attributes: map[string][]string{
+			"objectClass": {"person"},
+			"entryUUID":   {uuid.Must(uuid.NewV4()).String()},
+			"uid":         {uid},
+			"cn":          {uid},
+			"mail":        {mail},
+		},
+	}
+}
+
+func setLDAPConfig(d *testDirectory, config map[string]interface{}) {
+	c := map[string]interface{}{
+		"url":        d.URL(),
+		"base_dn":    baseDN,
+		"mapper_url": "file://./stub/ldap.jsonnet",
+	}
+	for k, v := range config {
+		c[k] = v
+	}
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypeLDAP), map[string]interface{}{
+		"enabled": true,
+		"config":  c,
+	})
+}
+
+func TestCompleteLogin(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+
+	d := newTestDirectory(t,
+		testEntry{DN: "cn=kratos,dc=example,dc=org", Password: "service-secret", Attributes: map[string][]string{"cn": {"kratos"}}},
+		newPerson("alice", "alice-secret", "alice@example.org"),
+		newPerson("bob", "bob-secret", "bob@example.org"),
+		testEntry{DN: "uid=carol," + baseDN, Password: "carol-secret", Attributes: map[string][]string{"uid": {"carol"}, "cn": {"Carol"}, "mail": {"carol@example.org"}}},
+		testEntry{DN: "uid=carol,ou=contractors," + baseDN, Password: "carol-secret", Attributes: map[string][]string{"uid": {"carol"}, "cn": {"Carol"}, "mail": {"carol@contractor.example.org"}}},
+	)
+	setLDAPConfig(d, map[string]interface{}{
+		"bind_dn":       "cn=kratos,dc=example,dc=org",
+		"bind_password": "service-secret",
+		"user_filter":   "(&(objectClass=person)(uid=%s))",
+	})
+
+	publicTS, _ := testhelpers.NewKratosServer(t, reg)
+	_ = testhelpers.NewErrorTestServer(t, reg)
+	uiTS := testhelpers.NewLoginUIFlowEchoServer(t, reg)
+	redirTS := testhelpers.NewRedirSessionEchoTS(t, reg)
+
+	viper.Set(configuration.ViperKeySelfServiceBrowserDefaultReturnTo, redirTS.URL+"/return-ts")
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/login.schema.json")
+	viper.Set(configuration.ViperKeySecretsDefault, []string{"not-a-secure-session-key"})
+
+	login := func(t *testing.T, isAPI bool, identifier, password string, expectedStatusCode int, expectedURL string) string {
+		return testhelpers.SubmitLoginForm(t, isAPI, nil, publicTS, func(v url.Values) {
+			v.Set("identifier", identifier)
+			v.Set("password", password)
+		}, identity.CredentialsTypeLDAP, false, expectedStatusCode, expectedURL)
+	}
+
+	for _, tc := range []struct {
+		d     string
+		isAPI bool
+	}{
+		{d: "type=api", isAPI: true},
+		{d: "type=browser", isAPI: false},
+	} {
+		t.Run(tc.d, func(t *testing.T) {
+			errorStatusCode, errorURL := http.StatusOK, uiTS.URL
+			if tc.isAPI {
+				errorStatusCode, errorURL = http.StatusBadRequest, publicTS.URL+ldap.RouteLogin
+			}
+
+			for _, c := range []struct {
+				d                    string
+				identifier, password string
+			}{
+				{d: "wrong password", identifier: "alice", password: "bob-secret"},
+				{d: "unknown user", identifier: "mallory", password: "alice-secret"},
+				{d: "filter injection", identifier: "*", password: "alice-secret"},
+				{d: "ambiguous identifier", identifier: "carol", password: "carol-secret"},
+				{d: "service account", identifier: "kratos", password: "service-secret"},
+			} {
+				t.Run("case=should fail because of "+c.d, func(t *testing.T) {
+					body := login(t, tc.isAPI, c.identifier, c.password, errorStatusCode, errorURL)
+					assert.EqualValues(t, text.ErrorValidationInvalidCredentials, gjson.Get(body, "methods.ldap.config.messages.0.id").Int(), "%s", body)
+					assert.Equal(t, c.identifier, gjson.Get(body, "methods.ldap.config.fields.#(name==identifier).value").String(), "%s", body)
+				})
+			}
+		})
+	}
+
+	t.Run("case=should create the identity on first login and update it afterwards", func(t *testing.T) {
+		body := login(t, true, "alice", "alice-secret", http.StatusOK, publicTS.URL+ldap.RouteLogin)
+		assert.NotEmpty(t, gjson.Get(body, "session_token").String(), "%s", body)
+		assert.Equal(t, "alice@example.org", gjson.Get(body, "session.identity.traits.email").String(), "%s", body)
+		assert.Equal(t, "alice", gjson.Get(body, "session.identity.traits.name").String(), "%s", body)
+		id := gjson.Get(body, "session.identity.id").String()
+
+		i, c, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeLDAP, d.id("uid=alice,"+baseDN))
+		require.NoError(t, err)
+		assert.Equal(t, id, i.ID.String())
+		assert.JSONEq(t, `{"dn":"uid=alice,`+baseDN+`"}`, string(c.Config))
+
+		alice, _ := d.find("uid=alice," + baseDN)
+		alice.Attributes["mail"] = []string{"alice@new.example.org"}
+
+		body = login(t, false, "ALICE", "alice-secret", http.StatusOK, redirTS.URL)
+		assert.Equal(t, id, gjson.Get(body, "identity.id").String(), "%s", body)
+		assert.Equal(t, "alice@new.example.org", gjson.Get(body, "identity.traits.email").String(), "%s", body)
+	})
+
+	t.Run("case=should keep the identity when the entry is moved", func(t *testing.T) {
+		body := login(t, true, "bob", "bob-secret", http.StatusOK, publicTS.URL+ldap.RouteLogin)
+		id := gjson.Get(body, "session.identity.id").String()
+
+		d.rename("uid=bob,"+baseDN, "uid=bob,ou=staff,"+baseDN)
+		body = login(t, true, "bob", "bob-secret", http.StatusOK, publicTS.URL+ldap.RouteLogin)
+		assert.Equal(t, id, gjson.Get(body, "session.identity.id").String(), "%s", body)
+
+		_, c, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeLDAP, d.id("uid=bob,ou=staff,"+baseDN))
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"dn":"uid=bob,ou=staff,`+baseDN+`"}`, string(c.Config))
+	})
+
+	t.Run("case=should not sign in to the identity of a deleted entry with the same DN", func(t *testing.T) {
+		d.add(newPerson("dan", "dan-secret", "dan@example.org"))
+		body := login(t, true, "dan", "dan-secret", http.StatusOK, publicTS.URL+ldap.RouteLogin)
+		id := gjson.Get(body, "session.identity.id").String()
+
+		d.remove("uid=dan," + baseDN)
+		d.add(newPerson("dan", "new-dan-secret", "dan@example.org"))
+		body = login(t, true, "dan", "new-dan-secret", http.StatusOK, publicTS.URL+ldap.RouteLogin)
+		assert.NotEqual(t, id, gjson.Get(body, "session.identity.id").String(), "%s", body)
+	})
+
+	t.Run("case=should show the login method", func(t *testing.T) {
+		f := testhelpers.InitializeLoginFlowViaAPI(t, testhelpers.NewDebugClient(t), publicTS, false).Payload
+		c := testhelpers.GetLoginFlowMethodConfig(t, f, identity.CredentialsTypeLDAP.String())
+		assert.Contains(t, *c.Action, ldap.RouteLogin)
+	})
+}
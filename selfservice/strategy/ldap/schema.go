@@ -0,0 +1,7 @@
+package ldap
+
+import (
+	"github.com/markbates/pkger"
+)
+
+var _ = pkger.Dir("/selfservice/strategy/ldap/.schema")
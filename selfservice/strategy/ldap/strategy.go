@@ -0,0 +1,214 @@
+package ldap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"github.com/google/go-jsonnet"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/fetcher"
+	"github.com/ory/x/jsonx"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/errorx"
+	"github.com/zzpu/ums/selfservice/flow/login"
+	"github.com/zzpu/ums/session"
+	"github.com/zzpu/ums/x"
+)
+
+var _ login.Strategy = new(Strategy)
+var _ identity.ActiveCredentialsCounter = new(Strategy)
+
+type strategyDependencies interface {
+	x.LoggingProvider
+	x.WriterProvider
+	x.CSRFTokenGeneratorProvider
+	x.CSRFProvider
+
+	errorx.ManagementProvider
+
+	login.HookExecutorProvider
+	login.FlowPersistenceProvider
+	login.ErrorHandlerProvider
+
+	identity.PrivilegedPoolProvider
+	identity.ManagementProvider
+
+	session.ManagementProvider
+}
+
+// Strategy implements login.Strategy. It authenticates users against an LDAP directory, such as
+// Active Directory, and creates or updates their identities using a Jsonnet mapper.
+type Strategy struct {
+	c  configuration.Provider
+	d  strategyDependencies
+	f  *fetcher.Fetcher
+	hd *decoderx.HTTP
+}
+
+func NewStrategy(
+	d strategyDependencies,
+	c configuration.Provider,
+) *Strategy {
+	return &Strategy{
+		c:  c,
+		d:  d,
+		f:  fetcher.NewFetcher(),
+		hd: decoderx.NewHTTP(),
+	}
+}
+
+func (s *Strategy) ID() identity.CredentialsType {
+	return identity.CredentialsTypeLDAP
+}
+
+func (s *Strategy) CountActiveCredentials(cc map[identity.CredentialsType]identity.Credentials) (count int, err error) {
+	for _, c := range cc {
+		if c.Type == s.ID() && len(c.Config) > 0 {
+			var conf CredentialsConfig
+			if err = json.Unmarshal(c.Config, &conf); err != nil {
+				return 0, errors.WithStack(err)
+			}
+
+			if len(c.Identifiers) > 0 && len(conf.DN) > 0 {
+				count++
+			}
+		}
+	}
+	return
+}
+
+func (s *Strategy) Config() (*Configuration, error) {
+	c := Configuration{UserFilter: "(uid=%s)", IDAttribute: "entryUUID", Sync: SyncConfiguration{Interval: "1h"}}
+
+	config := s.c.SelfServiceStrategy(string(s.ID())).Config
+	if err := jsonx.
+		NewStrictDecoder(bytes.NewBuffer(config)).
+		Decode(&c); err != nil {
+		s.d.Logger().WithError(err).WithField("config", config)
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode LDAP configuration: %s", err))
+	}
+
+	return &c, nil
+}
+
+// mapTraits runs the Jsonnet mapper for the directory entry and returns the resulting traits.
+func (s *Strategy) mapTraits(c *Configuration, entry *Entry) (identity.Traits, error) {
+	jn, err := s.f.Fetch(c.Mapper)
+	if err != nil {
+		return nil, err
+	}
+
+	var jsonEntry bytes.Buffer
+	if err := json.NewEncoder(&jsonEntry).Encode(entry); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	vm := jsonnet.MakeVM()
+	vm.ExtCode("entry", jsonEntry.String())
+	evaluated, err := vm.EvaluateSnippet(c.Mapper, jn.String())
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to evaluate the LDAP Jsonnet mapper: %s", err))
+	}
+
+	traits := gjson.Get(evaluated, "identity.traits")
+	if !traits.IsObject() {
+		s.d.Logger().
+			WithField("ldap_dn", entry.DN).
+			WithField("mapper_jsonnet_output", evaluated).
+			WithField("mapper_jsonnet_url", c.Mapper).
+			Error("LDAP Jsonnet mapper did not return an object for key identity.traits. Please check your Jsonnet code!")
+		return identity.Traits(`{}`), nil
+	}
+
+	s.d.Logger().
+		WithField("ldap_dn", entry.DN).
+		WithField("mapper_jsonnet_output", evaluated).
+		WithField("mapper_jsonnet_url", c.Mapper).
+		Debug("LDAP Jsonnet mapper completed.")
+
+	return identity.Traits(traits.Raw), nil
+}
+
+// upsertIdentity creates the identity belonging to the directory entry or updates its traits if it exists already.
+func (s *Strategy) upsertIdentity(ctx context.Context, c *Configuration, entry *Entry) (*identity.Identity, error) {
+	traits, err := s.mapTraits(c, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := json.Marshal(&CredentialsConfig{DN: entry.DN})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	found, _, err := s.d.PrivilegedIdentityPool().FindByCredentialsIdentifier(ctx, s.ID(), entry.identifier())
+	if errors.Is(err, herodot.ErrNotFound) {
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		i.Traits = traits
+		i.SetCredentials(s.ID(), identity.Credentials{
+			Type:        s.ID(),
+			Identifiers: []string{entry.identifier()},
+			Config:      config,
+		})
+
+		if err := s.d.IdentityManager().Create(ctx, i); err != nil {
+			return nil, err
+		}
+		return i, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// FindByCredentialsIdentifier strips the credentials which must be kept when updating the identity.
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(ctx, found.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The DN changes when the entry is renamed or moved.
+	var moved bool
+	if creds, ok := i.GetCredentials(s.ID()); ok {
+		var conf CredentialsConfig
+		if err := json.Unmarshal(creds.Config, &conf); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if conf.DN != entry.DN {
+			creds.Config = config
+			i.SetCredentials(s.ID(), *creds)
+			moved = true
+		}
+	}
+
+	if equal, err := jsonEqual(i.Traits, traits); err != nil {
+		return nil, err
+	} else if equal && !moved {
+		return i, nil
+	}
+
+	i.Traits = traits
+	if err := s.d.IdentityManager().Update(ctx, i, identity.ManagerAllowWriteProtectedTraits); err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+func jsonEqual(a, b []byte) (bool, error) {
+	var av, bv interface{}
+	if err := json.Unmarshal(a, &av); err != nil {
+		return false, errors.WithStack(err)
+	}
+	if err := json.Unmarshal(b, &bv); err != nil {
+		return false, errors.WithStack(err)
+	}
+	return reflect.DeepEqual(av, bv), nil
+}
@@ -0,0 +1,104 @@
+package ldap
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	SynchronizerProvider interface {
+		LDAPSynchronizer() *Synchronizer
+	}
+	// Synchronizer periodically imports all users of the directory into the identity pool.
+	Synchronizer struct {
+		s        *Strategy
+		ctx      context.Context
+		shutdown context.CancelFunc
+	}
+)
+
+func NewSynchronizer(s *Strategy) *Synchronizer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Synchronizer{s: s, ctx: ctx, shutdown: cancel}
+}
+
+// Enabled returns true if the LDAP method and the directory synchronization are enabled.
+func (m *Synchronizer) Enabled() bool {
+	if !m.s.c.SelfServiceStrategy(string(m.s.ID())).Enabled {
+		return false
+	}
+
+	c, err := m.s.Config()
+	if err != nil {
+		return false
+	}
+
+	return c.Sync.Enabled
+}
+
+// Sync runs a single synchronization and returns the number of synchronized identities. Entries which can not be
+// mapped to a valid identity are logged and skipped.
+func (m *Synchronizer) Sync(ctx context.Context) (int, error) {
+	c, err := m.s.Config()
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := searchAll(c)
+	if err != nil {
+		return 0, err
+	}
+
+	var synced int
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return synced, errors.WithStack(err)
+		}
+
+		e, err := newEntry(c, entry)
+		if err != nil {
+			m.s.d.Logger().WithError(err).WithField("ldap_dn", entry.DN).Warn("Unable to synchronize LDAP entry.")
+			continue
+		}
+
+		if _, err := m.s.upsertIdentity(ctx, c, e); err != nil {
+			m.s.d.Logger().WithError(err).WithField("ldap_dn", entry.DN).Warn("Unable to synchronize LDAP entry.")
+			continue
+		}
+		synced++
+	}
+
+	return synced, nil
+}
+
+// Work runs the synchronization periodically until Shutdown is called.
+func (m *Synchronizer) Work() error {
+	for {
+		interval := time.Hour
+		if c, err := m.s.Config(); err == nil {
+			interval = c.syncInterval()
+		}
+
+		if synced, err := m.Sync(m.ctx); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			m.s.d.Logger().WithError(err).Error("Unable to synchronize the LDAP directory.")
+		} else {
+			m.s.d.Logger().WithField("identities", synced).Info("Synchronized the LDAP directory.")
+		}
+
+		select {
+		case <-m.ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (m *Synchronizer) Shutdown(ctx context.Context) error {
+	m.shutdown()
+	return nil
+}
@@ -0,0 +1,90 @@
+package ldap_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+)
+
+func TestSynchronizer(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/login.schema.json")
+
+	d := newTestDirectory(t,
+		newPerson("dave", "dave-secret", "dave@example.org"),
+		newPerson("erin", "erin-secret", "erin@example.org"),
+		testEntry{DN: "uid=nomail," + baseDN, Attributes: map[string][]string{"entryUUID": {"b5a1c3e0-1f0e-4c1e-9f3a-6d2b7c8e9f10"}, "uid": {"nomail"}, "cn": {"No Mail"}}},
+		testEntry{DN: "uid=noid," + baseDN, Attributes: map[string][]string{"uid": {"noid"}, "cn": {"No ID"}, "mail": {"noid@example.org"}}},
+	)
+
+	traits := func(t *testing.T, dn string) string {
+		i, _, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeLDAP, d.id(dn))
+		require.NoError(t, err)
+		return string(i.Traits)
+	}
+
+	t.Run("case=should be disabled by default", func(t *testing.T) {
+		setLDAPConfig(d, nil)
+		assert.False(t, reg.LDAPSynchronizer().Enabled())
+
+		setLDAPConfig(d, map[string]interface{}{"sync": map[string]interface{}{"enabled": true}})
+		assert.True(t, reg.LDAPSynchronizer().Enabled())
+	})
+
+	t.Run("case=should import all users and skip invalid entries", func(t *testing.T) {
+		setLDAPConfig(d, map[string]interface{}{"sync": map[string]interface{}{"enabled": true}})
+
+		synced, err := reg.LDAPSynchronizer().Sync(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 2, synced)
+
+		assert.Equal(t, "dave@example.org", gjson.Get(traits(t, "uid=dave,"+baseDN), "email").String())
+		assert.Equal(t, "erin@example.org", gjson.Get(traits(t, "uid=erin,"+baseDN), "email").String())
+
+		_, _, err = reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeLDAP, d.id("uid=nomail,"+baseDN))
+		require.Error(t, err)
+	})
+
+	t.Run("case=should update existing users", func(t *testing.T) {
+		d.add(newPerson("frank", "frank-secret", "frank@example.org"))
+		dave, _ := d.find("uid=dave," + baseDN)
+		dave.Attributes["mail"] = []string{"dave@new.example.org"}
+
+		before, err := reg.PrivilegedIdentityPool().CountIdentities(context.Background())
+		require.NoError(t, err)
+
+		synced, err := reg.LDAPSynchronizer().Sync(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 3, synced)
+
+		after, err := reg.PrivilegedIdentityPool().CountIdentities(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, before+1, after)
+
+		assert.Equal(t, "dave@new.example.org", gjson.Get(traits(t, "uid=dave,"+baseDN), "email").String())
+	})
+
+	t.Run("case=should use the configured filter", func(t *testing.T) {
+		setLDAPConfig(d, map[string]interface{}{"sync": map[string]interface{}{"enabled": true, "filter": "(uid=erin)"}})
+
+		synced, err := reg.LDAPSynchronizer().Sync(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, synced)
+	})
+
+	t.Run("case=should fail if the directory is unavailable", func(t *testing.T) {
+		setLDAPConfig(d, map[string]interface{}{"url": "ldap://127.0.0.1:1", "sync": map[string]interface{}{"enabled": true}})
+
+		_, err := reg.LDAPSynchronizer().Sync(context.Background())
+		require.Error(t, err)
+	})
+}
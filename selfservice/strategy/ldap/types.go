@@ -0,0 +1,28 @@
+package ldap
+
+import "github.com/zzpu/ums/selfservice/form"
+
+type (
+	// CredentialsConfig is the struct that is being used as part of the identity credentials.
+	CredentialsConfig struct {
+		// DN is the distinguished name of the directory entry the identity belongs to.
+		DN string `json:"dn"`
+	}
+
+	// CompleteSelfServiceLoginFlowWithLDAPMethod is used to decode the login form payload.
+	CompleteSelfServiceLoginFlowWithLDAPMethod struct {
+		// The user's directory password.
+		Password string `form:"password" json:"password,omitempty"`
+
+		// Identifier is the directory username of the user trying to log in.
+		Identifier string `form:"identifier" json:"identifier,omitempty"`
+
+		// Sending the anti-csrf token is only required for browser login flows.
+		CSRFToken string `form:"csrf_token" json:"csrf_token"`
+	}
+)
+
+// FlowMethod contains the configuration for this selfservice strategy.
+type FlowMethod struct {
+	*form.HTMLForm
+}
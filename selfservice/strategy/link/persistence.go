@@ -24,4 +24,14 @@ type (
 	VerificationTokenPersistenceProvider interface {
 		VerificationTokenPersister() VerificationTokenPersister
 	}
+
+	LoginTokenPersister interface {
+		CreateLoginToken(ctx context.Context, token *LoginToken) error
+		UseLoginToken(ctx context.Context, token string) (*LoginToken, error)
+		DeleteLoginToken(ctx context.Context, token string) error
+	}
+
+	LoginTokenPersistenceProvider interface {
+		LoginTokenPersister() LoginTokenPersister
+	}
 )
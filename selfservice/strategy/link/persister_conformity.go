@@ -15,6 +15,7 @@ import (
 
 	"github.com/zzpu/ums/driver/configuration"
 	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/flow/login"
 	"github.com/zzpu/ums/selfservice/flow/recovery"
 	"github.com/zzpu/ums/selfservice/flow/verification"
 	"github.com/zzpu/ums/x"
@@ -23,8 +24,10 @@ import (
 func TestPersister(p interface {
 	RecoveryTokenPersister
 	VerificationTokenPersister
+	LoginTokenPersister
 	recovery.FlowPersister
 	verification.FlowPersister
+	login.FlowPersister
 	identity.PrivilegedPool
 }) func(t *testing.T) {
 	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/identity.schema.json")
@@ -137,5 +140,53 @@ func TestPersister(p interface {
 				require.Error(t, err)
 			})
 		})
+		t.Run("token=login", func(t *testing.T) {
+
+			t.Run("case=should error when the login token does not exist", func(t *testing.T) {
+				_, err := p.UseLoginToken(context.Background(), "i-do-not-exist")
+				require.Error(t, err)
+			})
+
+			newLoginToken := func(t *testing.T, email string) *LoginToken {
+				var req login.Flow
+				require.NoError(t, faker.FakeData(&req))
+				require.NoError(t, p.CreateLoginFlow(context.Background(), &req))
+
+				var i identity.Identity
+				require.NoError(t, faker.FakeData(&i))
+
+				address := &identity.VerifiableAddress{Value: email, Via: identity.VerifiableAddressTypeEmail}
+				i.VerifiableAddresses = append(i.VerifiableAddresses, *address)
+
+				require.NoError(t, p.CreateIdentity(context.Background(), &i))
+
+				return &LoginToken{
+					Token:             x.NewUUID().String(),
+					FlowID:            req.ID,
+					VerifiableAddress: &i.VerifiableAddresses[0],
+					ExpiresAt:         time.Now(),
+					IssuedAt:          time.Now(),
+				}
+			}
+
+			t.Run("case=should create a new login token", func(t *testing.T) {
+				token := newLoginToken(t, "foo-login-user@ory.sh")
+				require.NoError(t, p.CreateLoginToken(context.Background(), token))
+			})
+
+			t.Run("case=should create a login token and use it", func(t *testing.T) {
+				expected := newLoginToken(t, "other-login-user@ory.sh")
+				require.NoError(t, p.CreateLoginToken(context.Background(), expected))
+				actual, err := p.UseLoginToken(context.Background(), expected.Token)
+				require.NoError(t, err)
+				assertx.EqualAsJSON(t, expected.VerifiableAddress, actual.VerifiableAddress)
+				assert.Equal(t, expected.VerifiableAddress.IdentityID, actual.VerifiableAddress.IdentityID)
+				assert.NotEqual(t, expected.Token, actual.Token)
+				assert.EqualValues(t, expected.FlowID, actual.FlowID)
+
+				_, err = p.UseLoginToken(context.Background(), expected.Token)
+				require.Error(t, err)
+			})
+		})
 	}
 }
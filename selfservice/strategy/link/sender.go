@@ -14,6 +14,7 @@ import (
 	templates "github.com/zzpu/ums/courier/template"
 	"github.com/zzpu/ums/driver/configuration"
 	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/flow/login"
 	"github.com/zzpu/ums/selfservice/flow/recovery"
 	"github.com/zzpu/ums/selfservice/flow/verification"
 	"github.com/zzpu/ums/x"
@@ -28,6 +29,7 @@ type (
 
 		VerificationTokenPersistenceProvider
 		RecoveryTokenPersistenceProvider
+		LoginTokenPersistenceProvider
 	}
 
 	SenderProvider interface {
@@ -110,6 +112,38 @@ func (s *Sender) SendVerificationLink(ctx context.Context, f *verification.Flow,
 	return nil
 }
 
+// SendLoginLink sends a login link to the specified address. If the address does not exist in the store, an email is
+// still being sent to prevent account enumeration attacks. In that case, this function returns the ErrUnknownAddress
+// error.
+func (s *Sender) SendLoginLink(ctx context.Context, f *login.Flow, via identity.VerifiableAddressType, to string) error {
+	s.r.Logger().
+		WithField("via", via).
+		WithSensitiveField("address", to).
+		Debug("Preparing login link.")
+
+	address, err := s.r.IdentityPool().FindVerifiableAddressByValue(ctx, via, to)
+	if err != nil {
+		if errorsx.Cause(err) == sqlcon.ErrNoRows {
+			s.r.Audit().
+				WithField("via", via).
+				WithSensitiveField("email_address", to).
+				Info("Sending out invalid login email because address is unknown.")
+			if err := s.send(ctx, string(via), templates.NewLoginInvalid(s.c, &templates.LoginInvalidModel{To: to})); err != nil {
+				return err
+			}
+			return errors.Cause(ErrUnknownAddress)
+		}
+		return err
+	}
+
+	token := NewSelfServiceLoginToken(address, f)
+	if err := s.r.LoginTokenPersister().CreateLoginToken(ctx, token); err != nil {
+		return err
+	}
+
+	return s.SendLoginTokenTo(ctx, address, token)
+}
+
 func (s *Sender) SendRecoveryTokenTo(ctx context.Context, address *identity.RecoveryAddress, token *RecoveryToken) error {
 	s.r.Audit().
 		WithField("via", address.Via).
@@ -139,6 +173,21 @@ func (s *Sender) SendVerificationTokenTo(ctx context.Context, address *identity.
 			url.Values{"token": {token.Token}}).String()}))
 }
 
+func (s *Sender) SendLoginTokenTo(ctx context.Context, address *identity.VerifiableAddress, token *LoginToken) error {
+	s.r.Audit().
+		WithField("via", address.Via).
+		WithField("identity_id", address.IdentityID).
+		WithField("login_link_id", token.ID).
+		WithSensitiveField("email_address", address.Value).
+		WithSensitiveField("login_link_token", token.Token).
+		Info("Sending out login email with login link.")
+
+	return s.send(ctx, string(address.Via), templates.NewLoginValid(s.c,
+		&templates.LoginValidModel{To: address.Value, LoginURL: urlx.CopyWithQuery(
+			urlx.AppendPaths(s.c.SelfPublicURL(), RouteLogin),
+			url.Values{"token": {token.Token}}).String()}))
+}
+
 func (s *Sender) send(ctx context.Context, via string, t courier.EmailTemplate) error {
 	switch via {
 	case identity.AddressTypeEmail:
@@ -17,6 +17,7 @@ import (
 	"github.com/zzpu/ums/identity"
 	"github.com/zzpu/ums/internal"
 	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/login"
 	"github.com/zzpu/ums/selfservice/flow/recovery"
 	"github.com/zzpu/ums/selfservice/flow/verification"
 	"github.com/zzpu/ums/selfservice/strategy/link"
@@ -77,4 +78,24 @@ func TestManager(t *testing.T) {
 		assert.Contains(t, messages[3].Subject, "tried to verify")
 		assert.NotContains(t, messages[3].Body, urlx.AppendPaths(conf.SelfPublicURL(), link.RouteVerification).String()+"?token=")
 	})
+
+	t.Run("method=SendLoginLink", func(t *testing.T) {
+		f := login.NewFlow(time.Hour, "", u, flow.TypeBrowser)
+		require.NoError(t, reg.LoginFlowPersister().CreateLoginFlow(context.Background(), f))
+
+		require.NoError(t, reg.LinkSender().SendLoginLink(context.Background(), f, "email", "tracked@ory.sh"))
+		require.EqualError(t, reg.LinkSender().SendLoginLink(context.Background(), f, "email", "not-tracked@ory.sh"), link.ErrUnknownAddress.Error())
+
+		messages, err := reg.CourierPersister().NextMessages(context.Background(), 12)
+		require.NoError(t, err)
+		require.Len(t, messages, 6)
+
+		assert.EqualValues(t, "tracked@ory.sh", messages[4].Recipient)
+		assert.Contains(t, messages[4].Subject, "Sign in to your account")
+		assert.Contains(t, messages[4].Body, urlx.AppendPaths(conf.SelfPublicURL(), link.RouteLogin).String()+"?token=")
+
+		assert.EqualValues(t, "not-tracked@ory.sh", messages[5].Recipient)
+		assert.Contains(t, messages[5].Subject, "Account access attempted")
+		assert.NotContains(t, messages[5].Body, urlx.AppendPaths(conf.SelfPublicURL(), link.RouteLogin).String()+"?token=")
+	})
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/zzpu/ums/identity"
 	"github.com/zzpu/ums/schema"
 	"github.com/zzpu/ums/selfservice/errorx"
+	"github.com/zzpu/ums/selfservice/flow/login"
 	"github.com/zzpu/ums/selfservice/flow/recovery"
 	"github.com/zzpu/ums/selfservice/flow/settings"
 	"github.com/zzpu/ums/selfservice/flow/verification"
@@ -16,6 +17,8 @@ import (
 	"github.com/zzpu/ums/x"
 )
 
+var _ login.Strategy = new(Strategy)
+
 var _ recovery.Strategy = new(Strategy)
 var _ recovery.AdminHandler = new(Strategy)
 var _ recovery.PublicHandler = new(Strategy)
@@ -50,6 +53,11 @@ type (
 
 		errorx.ManagementProvider
 
+		login.HandlerProvider
+		login.HookExecutorProvider
+		login.FlowPersistenceProvider
+		login.ErrorHandlerProvider
+
 		recovery.ErrorHandlerProvider
 		recovery.FlowPersistenceProvider
 		recovery.StrategyProvider
@@ -60,6 +68,7 @@ type (
 
 		RecoveryTokenPersistenceProvider
 		VerificationTokenPersistenceProvider
+		LoginTokenPersistenceProvider
 		SenderProvider
 
 		IdentityTraitsSchemas() schema.Schemas
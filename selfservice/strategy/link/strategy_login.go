@@ -0,0 +1,294 @@
+package link
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/markbates/pkger"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/schema"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/login"
+	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteLogin = "/self-service/login/methods/link"
+)
+
+func (s *Strategy) ID() identity.CredentialsType {
+	return identity.CredentialsTypeMagicLink
+}
+
+func (s *Strategy) RegisterLoginRoutes(public *x.RouterPublic) {
+	s.d.CSRFHandler().ExemptPath(RouteLogin)
+	public.POST(RouteLogin, s.handleLogin)
+	public.GET(RouteLogin, s.handleLogin)
+}
+
+func (s *Strategy) PopulateLoginMethod(r *http.Request, sr *login.Flow) error {
+	// The link is opened in a browser, so there is no way to hand the session over to an API client.
+	if sr.Type != flow.TypeBrowser {
+		return nil
+	}
+
+	f := form.NewHTMLForm(sr.AppendTo(urlx.AppendPaths(s.c.SelfPublicURL(), RouteLogin)).String())
+
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+	f.SetField(form.Field{Name: "email", Type: "email", Required: true})
+
+	sr.Methods[s.ID()] = &login.FlowMethod{
+		Method: s.ID(),
+		Config: &login.FlowMethodConfig{FlowMethodConfigurator: &FlowMethod{HTMLForm: f}},
+	}
+	return nil
+}
+
+// handleLoginError is a convenience function for handling all types of errors that may occur (e.g. validation error).
+func (s *Strategy) handleLoginError(w http.ResponseWriter, r *http.Request, f *login.Flow, body *completeSelfServiceLoginFlowWithLinkMethodParameters, err error) {
+	if f != nil {
+		method, ok := f.Methods[s.ID()]
+		if !ok {
+			// API flows do not offer this method, so there is no form to attach the error to.
+			f = nil
+		} else {
+			method.Config.Reset()
+			method.Config.SetCSRF(s.d.GenerateCSRFToken(r))
+			method.Config.SetValue("email", body.Body.Email)
+			f.Methods[s.ID()] = method
+		}
+	}
+
+	s.d.LoginFlowErrorHandler().WriteFlowError(w, r, s.ID(), f, err)
+}
+
+func (s *Strategy) decodeLogin(r *http.Request, decodeBody bool) (*completeSelfServiceLoginFlowWithLinkMethodParameters, error) {
+	var body completeSelfServiceLoginFlowWithLinkMethod
+
+	if decodeBody {
+		if err := s.dx.Decode(r, &body,
+			decoderx.MustHTTPRawJSONSchemaCompiler(
+				x.MustPkgerRead(pkger.Open("/selfservice/strategy/link/.schema/email.schema.json")),
+			),
+			decoderx.HTTPDecoderSetValidatePayloads(false),
+			decoderx.HTTPDecoderJSONFollowsFormFormat()); err != nil {
+			return nil, err
+		}
+	}
+
+	q := r.URL.Query()
+	return &completeSelfServiceLoginFlowWithLinkMethodParameters{
+		Flow:  q.Get("flow"),
+		Token: q.Get("token"),
+		Body:  body,
+	}, nil
+}
+
+// swagger:parameters completeSelfServiceLoginFlowWithLinkMethod
+type completeSelfServiceLoginFlowWithLinkMethodParameters struct {
+	// in: body
+	Body completeSelfServiceLoginFlowWithLinkMethod
+
+	// Login Token
+	//
+	// The login token which completes the login flow. If the token
+	// is invalid (e.g. expired) an error will be shown to the end-user.
+	//
+	// in: query
+	Token string `json:"token"`
+
+	// The Flow ID
+	//
+	// format: uuid
+	// in: query
+	Flow string `json:"flow"`
+}
+
+type completeSelfServiceLoginFlowWithLinkMethod struct {
+	// Email to Sign In With
+	//
+	// Needs to be set when initiating the flow. If the email is a registered
+	// address, a login link will be sent. If the email is not known,
+	// a email with details on what happened will be sent instead.
+	//
+	// format: email
+	// in: body
+	Email string `json:"email"`
+
+	// Sending the anti-csrf token is only required for browser login flows.
+	CSRFToken string `form:"csrf_token" json:"csrf_token"`
+}
+
+// swagger:route POST /self-service/login/methods/link public completeSelfServiceLoginFlowWithLinkMethod
+//
+// Complete Login Flow with Link Method
+//
+// Use this endpoint to complete a login flow using the link method. This method is only available
+// for browser flows and is completed in two steps:
+//
+// - Sending `flow` (in the URL query) and `email` (in the body) sends a one-time login link to the email
+//   address and returns a HTTP 302 Found redirect to the Login UI URL with the Login Flow ID appended.
+// - Opening the login link sends the `token` in the URL query. The server responds with a HTTP 302 Found
+//   redirect to the post/after login URL or the `return_to` value if the link was valid, or a redirect to
+//   the Login UI URL with a new Login Flow ID which contains an error message that the login link was invalid.
+//
+//     Consumes:
+//     - application/x-www-form-urlencoded
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       302: emptyResponse
+//       500: genericError
+func (s *Strategy) handleLogin(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	body, err := s.decodeLogin(r, false)
+	if err != nil {
+		s.handleLoginError(w, r, nil, body, err)
+		return
+	}
+
+	if len(body.Token) > 0 {
+		s.loginUseToken(w, r, body)
+		return
+	}
+
+	rid := x.ParseUUID(body.Flow)
+	if x.IsZeroUUID(rid) {
+		s.handleLoginError(w, r, nil, body, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The flow query parameter is missing or invalid.")))
+		return
+	}
+
+	f, err := s.d.LoginFlowPersister().GetLoginFlow(r.Context(), rid)
+	if err != nil {
+		s.handleLoginError(w, r, nil, body, err)
+		return
+	}
+
+	if f.Type != flow.TypeBrowser {
+		s.handleLoginError(w, r, nil, body, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The link method is only available for browser flows.")))
+		return
+	}
+
+	if err := f.Valid(); err != nil {
+		s.handleLoginError(w, r, f, body, err)
+		return
+	}
+
+	s.loginHandleFormSubmission(w, r, f)
+}
+
+func (s *Strategy) loginHandleFormSubmission(w http.ResponseWriter, r *http.Request, f *login.Flow) {
+	body, err := s.decodeLogin(r, true)
+	if err != nil {
+		s.handleLoginError(w, r, f, new(completeSelfServiceLoginFlowWithLinkMethodParameters), err)
+		return
+	}
+
+	if len(body.Body.Email) == 0 {
+		s.handleLoginError(w, r, f, body, schema.NewRequiredError("#/email", "email"))
+		return
+	}
+
+	if err := flow.VerifyRequest(r, f.Type, s.d.GenerateCSRFToken, body.Body.CSRFToken); err != nil {
+		s.handleLoginError(w, r, f, body, err)
+		return
+	}
+
+	if _, err := s.d.SessionManager().FetchFromRequest(r.Context(), r); err == nil && !f.Forced {
+		http.Redirect(w, r, s.c.SelfServiceBrowserDefaultReturnTo().String(), http.StatusFound)
+		return
+	}
+
+	if err := s.d.LinkSender().SendLoginLink(r.Context(), f, identity.VerifiableAddressTypeEmail, body.Body.Email); err != nil {
+		if !errors.Is(err, ErrUnknownAddress) {
+			s.handleLoginError(w, r, f, body, err)
+			return
+		}
+		// Continue execution
+	}
+
+	method, ok := f.Methods[s.ID()]
+	if !ok {
+		s.handleLoginError(w, r, nil, body, errors.WithStack(herodot.ErrInternalServerError.
+			WithReasonf(`Expected login method "%s" to exist in flow.`, s.ID())))
+		return
+	}
+
+	method.Config.Reset()
+	method.Config.SetCSRF(s.d.GenerateCSRFToken(r))
+	method.Config.SetValue("email", body.Body.Email)
+
+	f.Active = s.ID()
+	f.Messages.Set(text.NewLoginEmailSent())
+	if err := s.d.LoginFlowPersister().UpdateLoginFlow(r.Context(), f); err != nil {
+		s.handleLoginError(w, r, f, body, err)
+		return
+	}
+
+	http.Redirect(w, r, f.AppendTo(s.c.SelfServiceFlowLoginUI()).String(), http.StatusFound)
+}
+
+func (s *Strategy) loginUseToken(w http.ResponseWriter, r *http.Request, body *completeSelfServiceLoginFlowWithLinkMethodParameters) {
+	token, err := s.d.LoginTokenPersister().UseLoginToken(r.Context(), body.Token)
+	if err != nil {
+		if errors.Is(err, sqlcon.ErrNoRows) {
+			s.retryLoginFlowWithMessage(w, r, text.NewErrorValidationLoginTokenInvalidOrAlreadyUsed())
+			return
+		}
+
+		s.handleLoginError(w, r, nil, body, err)
+		return
+	}
+
+	f, err := s.d.LoginFlowPersister().GetLoginFlow(r.Context(), token.FlowID)
+	if err != nil {
+		s.handleLoginError(w, r, nil, body, err)
+		return
+	}
+
+	if err := token.Valid(); err != nil {
+		s.handleLoginError(w, r, f, body, err)
+		return
+	}
+
+	i, err := s.d.IdentityPool().GetIdentity(r.Context(), token.VerifiableAddress.IdentityID)
+	if err != nil {
+		s.handleLoginError(w, r, f, body, err)
+		return
+	}
+
+	if err := s.d.LoginHookExecutor().PostLoginHook(w, r, s.ID(), f, i); err != nil {
+		s.handleLoginError(w, r, f, body, err)
+		return
+	}
+}
+
+func (s *Strategy) retryLoginFlowWithMessage(w http.ResponseWriter, r *http.Request, message *text.Message) {
+	s.d.Logger().WithRequest(r).WithField("message", message).Debug("A login flow is being retried because a validation error occurred.")
+
+	f, err := s.d.LoginHandler().NewLoginFlow(w, r, flow.TypeBrowser)
+	if err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	f.Messages.Add(message)
+	if err := s.d.LoginFlowPersister().UpdateLoginFlow(r.Context(), f); err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, f.AppendTo(s.c.SelfServiceFlowLoginUI()).String(), http.StatusFound)
+}
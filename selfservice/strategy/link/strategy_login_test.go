@@ -0,0 +1,169 @@
+package link_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/assertx"
+	"github.com/ory/x/pointerx"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/httpclient/models"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/strategy/link"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+func TestLogin(t *testing.T) {
+	var identityToLogin = &identity.Identity{
+		Traits:   identity.Traits(`{"email":"magic-link@ory.sh"}`),
+		SchemaID: configuration.DefaultIdentityTraitsSchemaID,
+	}
+	var loginEmail = gjson.GetBytes(identityToLogin.Traits, "email").String()
+
+	conf, reg := internal.NewFastRegistryWithMocks(t)
+	initViper()
+	testhelpers.StrategyEnable(identity.CredentialsTypeMagicLink.String(), true)
+
+	_ = testhelpers.NewLoginUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewErrorTestServer(t, reg)
+	_ = testhelpers.NewRedirSessionEchoTS(t, reg)
+
+	public, _ := testhelpers.NewKratosServer(t, reg)
+
+	require.NoError(t, reg.IdentityManager().Create(context.Background(), identityToLogin,
+		identity.ManagerAllowWriteProtectedTraits))
+
+	var csrfField = &models.FormField{Name: pointerx.String("csrf_token"), Required: true,
+		Type: pointerx.String("hidden"), Value: x.FakeCSRFToken}
+
+	var submit = func(t *testing.T, c *http.Client, email string) string {
+		rs := testhelpers.InitializeLoginFlowViaBrowser(t, c, public, false)
+		method := testhelpers.GetLoginFlowMethodConfig(t, rs.Payload, identity.CredentialsTypeMagicLink.String())
+
+		values := url.Values{"csrf_token": {x.FakeCSRFToken}}
+		if len(email) > 0 {
+			values.Set("email", email)
+		}
+
+		res, err := c.PostForm(pointerx.StringR(method.Action), values)
+		require.NoError(t, err)
+		assert.EqualValues(t, http.StatusOK, res.StatusCode)
+		assert.Contains(t, res.Request.URL.String(), conf.SelfServiceFlowLoginUI().String()+"?flow="+string(rs.Payload.ID))
+		return string(x.MustReadAll(res.Body))
+	}
+
+	t.Run("description=should set all the correct login payloads", func(t *testing.T) {
+		c := testhelpers.NewClientWithCookies(t)
+		rs := testhelpers.InitializeLoginFlowViaBrowser(t, c, public, false)
+		method := testhelpers.GetLoginFlowMethodConfig(t, rs.Payload, identity.CredentialsTypeMagicLink.String())
+
+		assert.EqualValues(t, models.FormFields{csrfField,
+			{Name: pointerx.String("email"), Required: true, Type: pointerx.String("email")},
+		}, method.Fields)
+		assert.EqualValues(t, public.URL+link.RouteLogin+"?flow="+string(rs.Payload.ID), *method.Action)
+		assert.Empty(t, method.Messages)
+		assert.Empty(t, rs.Payload.Messages)
+	})
+
+	t.Run("description=should not offer the method for api flows", func(t *testing.T) {
+		rs := testhelpers.InitializeLoginFlowViaAPI(t, new(http.Client), public, false)
+		assert.NotContains(t, rs.Payload.Methods, identity.CredentialsTypeMagicLink.String())
+	})
+
+	t.Run("description=should require an email to be sent", func(t *testing.T) {
+		actual := submit(t, testhelpers.NewClientWithCookies(t), "")
+		assert.EqualValues(t, "Property email is missing.",
+			gjson.Get(actual, "methods.magic_link.config.fields.#(name==email).messages.0.text").String(), "%s", actual)
+	})
+
+	t.Run("description=should send an email to an address that does not exist", func(t *testing.T) {
+		email := x.NewUUID().String() + "@ory.sh"
+		actual := submit(t, testhelpers.NewClientWithCookies(t), email)
+
+		assert.EqualValues(t, identity.CredentialsTypeMagicLink, gjson.Get(actual, "active").String(), "%s", actual)
+		assert.EqualValues(t, email, gjson.Get(actual, "methods.magic_link.config.fields.#(name==email).value").String(), "%s", actual)
+		assertx.EqualAsJSON(t, text.NewLoginEmailSent(), json.RawMessage(gjson.Get(actual, "messages.0").Raw))
+
+		message := testhelpers.CourierExpectMessage(t, reg, email, "Account access attempted")
+		assert.Contains(t, message.Body, "If this was you, check if you signed up using a different address.")
+	})
+
+	t.Run("description=should sign in using the login link", func(t *testing.T) {
+		c := testhelpers.NewClientWithCookies(t)
+		actual := submit(t, c, loginEmail)
+
+		assert.EqualValues(t, identity.CredentialsTypeMagicLink, gjson.Get(actual, "active").String(), "%s", actual)
+		assertx.EqualAsJSON(t, text.NewLoginEmailSent(), json.RawMessage(gjson.Get(actual, "messages.0").Raw))
+
+		message := testhelpers.CourierExpectMessage(t, reg, loginEmail, "Sign in to your account")
+		loginLink := testhelpers.CourierExpectLinkInMessage(t, message, 1)
+		assert.Contains(t, loginLink, public.URL+link.RouteLogin+"?token=")
+
+		res, err := c.Get(loginLink)
+		require.NoError(t, err)
+		assert.EqualValues(t, http.StatusOK, res.StatusCode)
+		assert.Contains(t, res.Request.URL.String(), "/return-ts")
+
+		body := x.MustReadAll(res.Body)
+		assert.EqualValues(t, identityToLogin.ID.String(), gjson.GetBytes(body, "identity.id").String(), "%s", body)
+
+		t.Run("case=should not be able to use the link twice", func(t *testing.T) {
+			res, err := testhelpers.NewClientWithCookies(t).Get(loginLink)
+			require.NoError(t, err)
+			assert.EqualValues(t, http.StatusOK, res.StatusCode)
+			assert.Contains(t, res.Request.URL.String(), conf.SelfServiceFlowLoginUI().String()+"?flow=")
+
+			body := x.MustReadAll(res.Body)
+			assert.EqualValues(t, text.NewErrorValidationLoginTokenInvalidOrAlreadyUsed().Text,
+				gjson.GetBytes(body, "messages.0.text").String(), "%s", body)
+		})
+	})
+
+	t.Run("description=should not be able to use an invalid link", func(t *testing.T) {
+		res, err := testhelpers.NewClientWithCookies(t).Get(public.URL + link.RouteLogin + "?token=i-do-not-exist")
+		require.NoError(t, err)
+		assert.EqualValues(t, http.StatusOK, res.StatusCode)
+		assert.Contains(t, res.Request.URL.String(), conf.SelfServiceFlowLoginUI().String()+"?flow=")
+
+		body := x.MustReadAll(res.Body)
+		assert.EqualValues(t, text.NewErrorValidationLoginTokenInvalidOrAlreadyUsed().Text,
+			gjson.GetBytes(body, "messages.0.text").String(), "%s", body)
+	})
+
+	t.Run("description=should not be able to use an outdated link", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceLoginRequestLifespan, time.Millisecond*200)
+		t.Cleanup(func() {
+			viper.Set(configuration.ViperKeySelfServiceLoginRequestLifespan, time.Hour)
+		})
+
+		c := testhelpers.NewClientWithCookies(t)
+		actual := submit(t, c, loginEmail)
+
+		message := testhelpers.CourierExpectMessage(t, reg, loginEmail, "Sign in to your account")
+		loginLink := testhelpers.CourierExpectLinkInMessage(t, message, 1)
+
+		time.Sleep(time.Millisecond * 201)
+
+		res, err := c.Get(loginLink)
+		require.NoError(t, err)
+		assert.EqualValues(t, http.StatusOK, res.StatusCode)
+		assert.Contains(t, res.Request.URL.String(), conf.SelfServiceFlowLoginUI().String())
+		assert.NotContains(t, res.Request.URL.String(), gjson.Get(actual, "id").String())
+
+		body := x.MustReadAll(res.Body)
+		assert.Contains(t, gjson.GetBytes(body, "messages.0.text").String(), "The login flow expired", "%s", body)
+	})
+}
@@ -0,0 +1,69 @@
+package link
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/randx"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/flow/login"
+	"github.com/zzpu/ums/x"
+)
+
+type LoginToken struct {
+	// ID represents the tokens's unique ID.
+	//
+	// required: true
+	// type: string
+	// format: uuid
+	ID uuid.UUID `json:"id" db:"id" faker:"-"`
+
+	// Token represents the login token. It can not be longer than 64 chars!
+	Token string `json:"-" db:"token"`
+
+	// VerifiableAddress links this token to the address the login link was sent to.
+	// required: true
+	VerifiableAddress *identity.VerifiableAddress `json:"verifiable_address" belongs_to:"identity_verifiable_addresses" fk_id:"VerifiableAddressID"`
+
+	// ExpiresAt is the time (UTC) when the token expires.
+	// required: true
+	ExpiresAt time.Time `json:"expires_at" faker:"time_type" db:"expires_at"`
+
+	// IssuedAt is the time (UTC) when the token was issued.
+	// required: true
+	IssuedAt time.Time `json:"issued_at" faker:"time_type" db:"issued_at"`
+
+	// CreatedAt is a helper struct field for gobuffalo.pop.
+	CreatedAt time.Time `json:"-" faker:"-" db:"created_at"`
+	// UpdatedAt is a helper struct field for gobuffalo.pop.
+	UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+	// VerifiableAddressID is a helper struct field for gobuffalo.pop.
+	VerifiableAddressID uuid.UUID `json:"-" faker:"-" db:"identity_verifiable_address_id"`
+	// FlowID is a helper struct field for gobuffalo.pop.
+	FlowID uuid.UUID `json:"-" faker:"-" db:"selfservice_login_flow_id"`
+}
+
+func (LoginToken) TableName() string {
+	return "identity_login_tokens"
+}
+
+func NewSelfServiceLoginToken(address *identity.VerifiableAddress, f *login.Flow) *LoginToken {
+	return &LoginToken{
+		ID:                x.NewUUID(),
+		Token:             randx.MustString(32, randx.AlphaNum),
+		VerifiableAddress: address,
+		ExpiresAt:         f.ExpiresAt,
+		IssuedAt:          time.Now().UTC(),
+		FlowID:            f.ID,
+	}
+}
+
+func (f *LoginToken) Valid() error {
+	if f.ExpiresAt.Before(time.Now()) {
+		return errors.WithStack(login.NewFlowExpiredError(f.ExpiresAt))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package oidc
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/ory/x/sqlxx"
+)
+
+type (
+	// StoredProvider is an OpenID Connect Provider configuration which is managed through the admin API instead of
+	// the configuration file. The secrets in Config are encrypted.
+	StoredProvider struct {
+		ID uuid.UUID `json:"-" db:"id" faker:"-"`
+
+		// ProviderID is the ID of the provider, equal to the `id` of the configuration.
+		ProviderID string `json:"id" db:"provider_id"`
+
+		// Config is the JSON encoded provider configuration.
+		Config sqlxx.JSONRawMessage `json:"config" db:"config" faker:"-"`
+
+		// CreatedAt is a helper struct field for gobuffalo.pop.
+		CreatedAt time.Time `json:"created_at" faker:"-" db:"created_at"`
+		// UpdatedAt is a helper struct field for gobuffalo.pop.
+		UpdatedAt time.Time `json:"updated_at" faker:"-" db:"updated_at"`
+	}
+
+	ProviderPersister interface {
+		CreateOIDCProvider(ctx context.Context, p *StoredProvider) error
+		GetOIDCProvider(ctx context.Context, id string) (*StoredProvider, error)
+		ListOIDCProviders(ctx context.Context) ([]StoredProvider, error)
+		UpdateOIDCProvider(ctx context.Context, p *StoredProvider) error
+		DeleteOIDCProvider(ctx context.Context, id string) error
+	}
+
+	ProviderPersistenceProvider interface {
+		OIDCProviderPersister() ProviderPersister
+	}
+)
+
+func (p StoredProvider) TableName() string {
+	return "selfservice_oidc_providers"
+}
@@ -0,0 +1,64 @@
+package oidc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/sqlxx"
+)
+
+func TestPersister(p ProviderPersister) func(t *testing.T) {
+	return func(t *testing.T) {
+		t.Run("case=should error when the provider does not exist", func(t *testing.T) {
+			_, err := p.GetOIDCProvider(context.Background(), "does-not-exist")
+			require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+
+			err = p.UpdateOIDCProvider(context.Background(), &StoredProvider{ProviderID: "does-not-exist", Config: sqlxx.JSONRawMessage("{}")})
+			require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+
+			err = p.DeleteOIDCProvider(context.Background(), "does-not-exist")
+			require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+		})
+
+		t.Run("case=should create, get, list, update, and delete providers", func(t *testing.T) {
+			first := &StoredProvider{ProviderID: "persister-first", Config: sqlxx.JSONRawMessage(`{"id":"persister-first"}`)}
+			require.NoError(t, p.CreateOIDCProvider(context.Background(), first))
+			require.NoError(t, p.CreateOIDCProvider(context.Background(), &StoredProvider{ProviderID: "persister-second", Config: sqlxx.JSONRawMessage(`{"id":"persister-second"}`)}))
+
+			err := p.CreateOIDCProvider(context.Background(), &StoredProvider{ProviderID: "persister-first", Config: sqlxx.JSONRawMessage(`{}`)})
+			require.True(t, errors.Is(err, sqlcon.ErrUniqueViolation), "%+v", err)
+
+			actual, err := p.GetOIDCProvider(context.Background(), "persister-first")
+			require.NoError(t, err)
+			assert.Equal(t, first.ID, actual.ID)
+			assert.JSONEq(t, `{"id":"persister-first"}`, string(actual.Config))
+
+			list, err := p.ListOIDCProviders(context.Background())
+			require.NoError(t, err)
+			var ids []string
+			for _, l := range list {
+				ids = append(ids, l.ProviderID)
+			}
+			assert.Contains(t, ids, "persister-first")
+			assert.Contains(t, ids, "persister-second")
+
+			require.NoError(t, p.UpdateOIDCProvider(context.Background(), &StoredProvider{ProviderID: "persister-first", Config: sqlxx.JSONRawMessage(`{"id":"persister-first","client_id":"updated"}`)}))
+			actual, err = p.GetOIDCProvider(context.Background(), "persister-first")
+			require.NoError(t, err)
+			assert.Equal(t, first.ID, actual.ID)
+			assert.JSONEq(t, `{"id":"persister-first","client_id":"updated"}`, string(actual.Config))
+
+			require.NoError(t, p.DeleteOIDCProvider(context.Background(), "persister-first"))
+			_, err = p.GetOIDCProvider(context.Background(), "persister-first")
+			require.True(t, errors.Is(err, sqlcon.ErrNoRows), "%+v", err)
+
+			_, err = p.GetOIDCProvider(context.Background(), "persister-second")
+			require.NoError(t, err)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package oidc
 
 import (
 	"context"
+	"net/url"
 
 	"golang.org/x/oauth2"
 )
@@ -13,9 +14,59 @@ type Provider interface {
 	AuthCodeURLOptions(r ider) []oauth2.AuthCodeOption
 }
 
+// NonStandardProvider is implemented by providers whose OAuth2 flavor deviates from the specification, for example
+// by using "appid" instead of "client_id" or by requiring signed token requests, and which can therefore not rely on
+// golang.org/x/oauth2 for the authorization URL and the token exchange.
+type NonStandardProvider interface {
+	Provider
+
+	// AuthCodeURL returns the URL the browser is redirected to for authorization.
+	AuthCodeURL(state string, r ider) string
+
+	// CodeParameter returns the name of the callback's query parameter which contains the authorization code.
+	CodeParameter() string
+
+	// Exchange exchanges the authorization code for an access token.
+	Exchange(ctx context.Context, code string) (*oauth2.Token, error)
+}
+
+func authCodeURL(p Provider, c *oauth2.Config, state string, r ider, opts ...oauth2.AuthCodeOption) string {
+	if ns, ok := p.(NonStandardProvider); ok {
+		return ns.AuthCodeURL(state, r)
+	}
+	return c.AuthCodeURL(state, append(p.AuthCodeURLOptions(r), opts...)...)
+}
+
+func codeParameter(p Provider) string {
+	if ns, ok := p.(NonStandardProvider); ok {
+		return ns.CodeParameter()
+	}
+	return "code"
+}
+
+func exchange(ctx context.Context, p Provider, c *oauth2.Config, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	if ns, ok := p.(NonStandardProvider); ok {
+		return ns.Exchange(ctx, code)
+	}
+	return c.Exchange(ctx, code, opts...)
+}
+
+// QueryClaimsDecoder is implemented by providers which send claims as part of the authorization response instead
+// of the ID Token or userinfo endpoint, for example Sign in with Apple which sends the user's name only once.
+type QueryClaimsDecoder interface {
+	DecodeQuery(query url.Values, claims *Claims)
+}
+
+func decodeQuery(p Provider, query url.Values, claims *Claims) {
+	if d, ok := p.(QueryClaimsDecoder); ok {
+		d.DecodeQuery(query, claims)
+	}
+}
+
 type Claims struct {
 	Issuer              string `json:"iss,omitempty"`
 	Subject             string `json:"sub,omitempty"`
+	Nonce               string `json:"nonce,omitempty"`
 	Name                string `json:"name,omitempty"`
 	GivenName           string `json:"given_name,omitempty"`
 	FamilyName          string `json:"family_name,omitempty"`
@@ -35,4 +86,7 @@ type Claims struct {
 	PhoneNumber         string `json:"phone_number,omitempty"`
 	PhoneNumberVerified bool   `json:"phone_number_verified,omitempty"`
 	UpdatedAt           int64  `json:"updated_at,omitempty"`
+
+	// RawClaims contains the unmodified userinfo response of providers which do not return standard claims.
+	RawClaims map[string]interface{} `json:"raw_claims,omitempty"`
 }
@@ -0,0 +1,276 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/urlx"
+)
+
+var _ NonStandardProvider = new(ProviderAlipay)
+
+// ProviderAlipay implements Alipay Login (支付宝登录).
+//
+// Alipay signs requests with RSA2 instead of using a client secret. The provider's `client_secret` therefore
+// holds the application's RSA private key, either PEM encoded or as the plain base64 string shown in the Alipay
+// console.
+//
+// The subject is the user's Alipay user_id, which is the same for all applications, and the application specific
+// open_id for applications which no longer receive the user_id.
+type ProviderAlipay struct {
+	config *Configuration
+	public *url.URL
+
+	authURL    string
+	gatewayURL string
+}
+
+func NewProviderAlipay(
+	config *Configuration,
+	public *url.URL,
+) *ProviderAlipay {
+	return &ProviderAlipay{
+		config:     config,
+		public:     public,
+		authURL:    "https://openauth.alipay.com",
+		gatewayURL: "https://openapi.alipay.com/gateway.do",
+	}
+}
+
+type alipayError struct {
+	Code    string `json:"code"`
+	Msg     string `json:"msg"`
+	SubCode string `json:"sub_code"`
+	SubMsg  string `json:"sub_msg"`
+}
+
+func (e alipayError) err() error {
+	// Successful responses of some methods do not contain a code at all.
+	if e.Code == "" || e.Code == "10000" {
+		return nil
+	}
+	return errors.WithStack(herodot.ErrBadRequest.WithReasonf("Alipay returned error %s: %s", e.Code, firstNonEmpty(e.SubMsg, e.Msg)).WithDebug(e.SubCode))
+}
+
+func (g *ProviderAlipay) Config() *Configuration {
+	return g.config
+}
+
+func (g *ProviderAlipay) scope() []string {
+	if len(g.config.Scope) == 0 {
+		return []string{"auth_user"}
+	}
+	return g.config.Scope
+}
+
+func (g *ProviderAlipay) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	if _, err := g.privateKey(); err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Config{
+		ClientID: g.config.ClientID,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  urlx.AppendPaths(urlx.ParseOrPanic(g.authURL), "/oauth2/publicAppAuthorize.htm").String(),
+			TokenURL: g.gatewayURL,
+		},
+		Scopes:      g.scope(),
+		RedirectURL: g.config.Redir(g.public),
+	}, nil
+}
+
+func (g *ProviderAlipay) AuthCodeURLOptions(r ider) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{}
+}
+
+func (g *ProviderAlipay) AuthCodeURL(state string, _ ider) string {
+	return urlx.CopyWithQuery(urlx.AppendPaths(urlx.ParseOrPanic(g.authURL), "/oauth2/publicAppAuthorize.htm"), url.Values{
+		"app_id":       {g.config.ClientID},
+		"scope":        {strings.Join(g.scope(), ",")},
+		"redirect_uri": {g.config.Redir(g.public)},
+		"state":        {state},
+	}).String()
+}
+
+func (g *ProviderAlipay) CodeParameter() string {
+	return "auth_code"
+}
+
+func (g *ProviderAlipay) privateKey() (*rsa.PrivateKey, error) {
+	raw := []byte(strings.TrimSpace(g.config.ClientSecret))
+	if block, _ := pem.Decode(raw); block != nil {
+		raw = block.Bytes
+	} else if decoded, err := base64.StdEncoding.DecodeString(string(raw)); err == nil {
+		raw = decoded
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(raw); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(raw)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The client_secret of Alipay provider %s must be an RSA private key: %s", g.config.ID, err))
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The client_secret of Alipay provider %s must be an RSA private key but got %T.", g.config.ID, key))
+	}
+	return rsaKey, nil
+}
+
+// call invokes an Alipay OpenAPI method and decodes the method's response into v.
+func (g *ProviderAlipay) call(ctx context.Context, method string, params url.Values, v interface{}) error {
+	key, err := g.privateKey()
+	if err != nil {
+		return err
+	}
+
+	params.Set("app_id", g.config.ClientID)
+	params.Set("method", method)
+	params.Set("format", "JSON")
+	params.Set("charset", "utf-8")
+	params.Set("sign_type", "RSA2")
+	params.Set("timestamp", time.Now().In(time.FixedZone("CST", 8*60*60)).Format("2006-01-02 15:04:05"))
+	params.Set("version", "1.0")
+
+	// The signature covers all parameters sorted by name and joined without URL encoding.
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if v := params.Get(k); len(v) > 0 {
+			pairs = append(pairs, k+"="+v)
+		}
+	}
+
+	digest := sha256.Sum256([]byte(strings.Join(pairs, "&")))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	params.Set("sign", base64.StdEncoding.EncodeToString(signature))
+
+	req, err := http.NewRequest("POST", g.gatewayURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=utf-8")
+
+	// The response is wrapped in a key named after the method, e.g. alipay_system_oauth_token_response.
+	var res map[string]json.RawMessage
+	if err := fetchJSON(ctx, req, &res); err != nil {
+		return err
+	}
+
+	if raw, ok := res["error_response"]; ok {
+		var e alipayError
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode the provider's response: %s", err))
+		}
+		return e.err()
+	}
+
+	raw, ok := res[strings.Replace(method, ".", "_", -1)+"_response"]
+	if !ok {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Alipay did not respond to method %s.", method))
+	}
+
+	if err := json.Unmarshal(raw, v); err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode the provider's response: %s", err))
+	}
+
+	return nil
+}
+
+func (g *ProviderAlipay) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	var res struct {
+		alipayError
+		UserID       string    `json:"user_id"`
+		OpenID       string    `json:"open_id"`
+		AccessToken  string    `json:"access_token"`
+		ExpiresIn    flexInt64 `json:"expires_in"`
+		RefreshToken string    `json:"refresh_token"`
+	}
+	if err := g.call(ctx, "alipay.system.oauth.token", url.Values{
+		"grant_type": {"authorization_code"},
+		"code":       {code},
+	}, &res); err != nil {
+		return nil, err
+	} else if err := res.err(); err != nil {
+		return nil, err
+	}
+
+	return newToken(res.AccessToken, res.RefreshToken, res.ExpiresIn, map[string]interface{}{
+		"user_id": res.UserID,
+		"open_id": res.OpenID,
+	}), nil
+}
+
+func (g *ProviderAlipay) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+	claims := &Claims{
+		Issuer:  g.authURL,
+		Subject: firstNonEmpty(extraString(exchange, "user_id"), extraString(exchange, "open_id")),
+		Locale:  "zh_CN",
+	}
+
+	// Scope auth_base only identifies the user and does not grant access to the profile.
+	if len(g.scope()) == 1 && g.scope()[0] == "auth_base" {
+		if len(claims.Subject) == 0 {
+			return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("Alipay did not return the user_id or open_id of the user."))
+		}
+		return claims, nil
+	}
+
+	var user struct {
+		alipayError
+		UserID   string `json:"user_id"`
+		OpenID   string `json:"open_id"`
+		NickName string `json:"nick_name"`
+		Avatar   string `json:"avatar"`
+		Gender   string `json:"gender"`
+	}
+	if err := g.call(ctx, "alipay.user.info.share", url.Values{"auth_token": {exchange.AccessToken}}, &user); err != nil {
+		return nil, err
+	} else if err := user.err(); err != nil {
+		return nil, err
+	}
+
+	claims.Subject = firstNonEmpty(claims.Subject, user.UserID, user.OpenID)
+	if len(claims.Subject) == 0 {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("Alipay did not return the user_id or open_id of the user."))
+	}
+
+	claims.Name = user.NickName
+	claims.Nickname = user.NickName
+	claims.Picture = user.Avatar
+	switch user.Gender {
+	case "m", "M":
+		claims.Gender = "male"
+	case "f", "F":
+		claims.Gender = "female"
+	}
+
+	return claims, nil
+}
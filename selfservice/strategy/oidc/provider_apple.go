@@ -0,0 +1,172 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+)
+
+var _ Provider = new(ProviderApple)
+var _ QueryClaimsDecoder = new(ProviderApple)
+
+// ProviderApple implements Sign in with Apple.
+//
+// Apple posts the authorization response to the callback (`response_mode=form_post`) and sends the user's name only
+// as part of the very first authorization, never in the ID Token. The client secret is a short-lived JWT signed
+// with the private key created in the Apple Developer portal.
+type ProviderApple struct {
+	*ProviderGenericOIDC
+}
+
+func NewProviderApple(
+	config *Configuration,
+	public *url.URL,
+) *ProviderApple {
+	if len(config.IssuerURL) == 0 {
+		config.IssuerURL = "https://appleid.apple.com"
+	}
+	return &ProviderApple{
+		ProviderGenericOIDC: &ProviderGenericOIDC{
+			config: config,
+			public: public,
+		},
+	}
+}
+
+func (a *ProviderApple) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	p, err := a.provider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c := a.oauth2ConfigFromEndpoint(p.Endpoint())
+	if len(a.config.Scope) == 0 {
+		c.Scopes = append(c.Scopes, "email", "name")
+	}
+
+	// Without a private key the client secret is expected to be a pre-generated JWT.
+	if len(a.config.ApplePrivateKey) > 0 {
+		secret, err := a.newClientSecret()
+		if err != nil {
+			return nil, err
+		}
+		c.ClientSecret = secret
+	}
+
+	return c, nil
+}
+
+func (a *ProviderApple) AuthCodeURLOptions(r ider) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("response_mode", "form_post"),
+	}
+}
+
+// privateKey decodes the PKCS #8 encoded key which Apple issues as .p8 file. SEC 1 encoded keys are accepted too.
+func (a *ProviderApple) privateKey() (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(a.config.ApplePrivateKey))
+	if block == nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The apple_private_key of Apple provider %s must be PEM encoded.", a.config.ID))
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The apple_private_key of Apple provider %s must be an ECDSA private key: %s", a.config.ID, err))
+	}
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The apple_private_key of Apple provider %s must be an ECDSA private key but got %T.", a.config.ID, key))
+	}
+	return ecKey, nil
+}
+
+func (a *ProviderApple) newClientSecret() (string, error) {
+	key, err := a.privateKey()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.StandardClaims{
+		Audience:  a.config.IssuerURL,
+		ExpiresAt: now.Add(time.Minute * 5).Unix(),
+		IssuedAt:  now.Unix(),
+		Issuer:    a.config.AppleTeamID,
+		Subject:   a.config.ClientID,
+	})
+	token.Header["kid"] = a.config.ApplePrivateKeyID
+
+	secret, err := token.SignedString(key)
+	if err != nil {
+		return "", errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to sign the client secret of Apple provider %s: %s", a.config.ID, err))
+	}
+	return secret, nil
+}
+
+func (a *ProviderApple) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+	raw, ok := exchange.Extra("id_token").(string)
+	if !ok || len(raw) == 0 {
+		return nil, errors.WithStack(ErrIDTokenMissing)
+	}
+
+	p, err := a.provider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := a.verifyWithProvider(ctx, p, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apple encodes the boolean claims as strings.
+	var claims struct {
+		Email         string   `json:"email"`
+		EmailVerified flexBool `json:"email_verified"`
+		Nonce         string   `json:"nonce"`
+	}
+	if err := token.Claims(&claims); err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("%s", err))
+	}
+
+	return &Claims{
+		Issuer:        token.Issuer,
+		Subject:       token.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Nonce:         claims.Nonce,
+	}, nil
+}
+
+// DecodeQuery adds the user's name which Apple only sends as the `user` field of the first authorization response.
+func (a *ProviderApple) DecodeQuery(query url.Values, claims *Claims) {
+	var user struct {
+		Name struct {
+			FirstName string `json:"firstName"`
+			LastName  string `json:"lastName"`
+		} `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(query.Get("user")), &user); err != nil {
+		return
+	}
+
+	claims.GivenName = firstNonEmpty(claims.GivenName, user.Name.FirstName)
+	claims.FamilyName = firstNonEmpty(claims.FamilyName, user.Name.LastName)
+	claims.Name = firstNonEmpty(claims.Name, strings.TrimSpace(user.Name.FirstName+" "+user.Name.LastName))
+}
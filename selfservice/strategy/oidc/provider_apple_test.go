@@ -0,0 +1,201 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/strategy/oidc"
+)
+
+func TestProviderApple(t *testing.T) {
+	p := newFakeProvider(t, "com.example.app")
+
+	t.Run("case=generates the client secret from the private key", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+
+		apple := oidc.NewProviderApple(&oidc.Configuration{
+			ID:                "apple",
+			Provider:          "apple",
+			ClientID:          "com.example.app",
+			IssuerURL:         p.URL,
+			AppleTeamID:       "team",
+			ApplePrivateKeyID: "kid",
+			ApplePrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		}, urlx.ParseOrPanic("https://ory.sh"))
+
+		c, err := apple.OAuth2(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"openid", "email", "name"}, c.Scopes)
+
+		var claims jwt.StandardClaims
+		token, err := jwt.ParseWithClaims(c.ClientSecret, &claims, func(token *jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "ES256", token.Method.Alg())
+		assert.Equal(t, "kid", token.Header["kid"])
+		assert.Equal(t, "team", claims.Issuer)
+		assert.Equal(t, "com.example.app", claims.Subject)
+		assert.Equal(t, p.URL, claims.Audience)
+	})
+
+	t.Run("case=fails with an invalid private key", func(t *testing.T) {
+		apple := oidc.NewProviderApple(&oidc.Configuration{
+			ID:              "apple",
+			Provider:        "apple",
+			IssuerURL:       p.URL,
+			ApplePrivateKey: "not-a-key",
+		}, urlx.ParseOrPanic("https://ory.sh"))
+
+		_, err := apple.OAuth2(context.Background())
+		require.Error(t, err)
+	})
+
+	t.Run("case=decodes the nonce", func(t *testing.T) {
+		p.nonce = "apple-nonce"
+		t.Cleanup(func() { p.nonce = "" })
+		p.claims = map[string]interface{}{"sub": "apple-nonce-user", "email": "apple-nonce-user@ory.sh", "email_verified": "true"}
+
+		apple := oidc.NewProviderApple(&oidc.Configuration{
+			ID:           "apple",
+			Provider:     "apple",
+			ClientID:     "com.example.app",
+			ClientSecret: "secret",
+			IssuerURL:    p.URL,
+		}, urlx.ParseOrPanic("https://ory.sh"))
+
+		c, err := apple.OAuth2(context.Background())
+		require.NoError(t, err)
+		token, err := c.Exchange(context.Background(), "code")
+		require.NoError(t, err)
+
+		claims, err := apple.Claims(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "apple-nonce", claims.Nonce)
+		assert.Equal(t, "apple-nonce-user", claims.Subject)
+		assert.True(t, claims.EmailVerified)
+	})
+
+	t.Run("case=decodes the name only if sent", func(t *testing.T) {
+		apple := oidc.NewProviderApple(&oidc.Configuration{ID: "apple", Provider: "apple"}, urlx.ParseOrPanic("https://ory.sh"))
+
+		var claims oidc.Claims
+		apple.DecodeQuery(url.Values{}, &claims)
+		assert.Empty(t, claims.Name)
+
+		apple.DecodeQuery(url.Values{"user": {`{"name":{"firstName":"Jane","lastName":"Doe"},"email":"jane@example.org"}`}}, &claims)
+		assert.Equal(t, "Jane Doe", claims.Name)
+		assert.Equal(t, "Jane", claims.GivenName)
+		assert.Equal(t, "Doe", claims.FamilyName)
+	})
+
+	t.Run("case=signs up with the name sent in the form post", func(t *testing.T) {
+		_, reg := internal.NewFastRegistryWithMocks(t)
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypeOIDC),
+			map[string]interface{}{"enabled": true, "config": &oidc.ConfigurationCollection{
+				Providers: []oidc.Configuration{{
+					ID:           "apple",
+					Provider:     "apple",
+					ClientID:     "com.example.app",
+					ClientSecret: "secret",
+					IssuerURL:    p.URL,
+					Mapper:       "file://./stub/oidc.apple.jsonnet",
+				}},
+			}})
+		viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/registration.schema.json")
+		viper.Set(configuration.HookStrategyKey(configuration.ViperKeySelfServiceRegistrationAfter,
+			identity.CredentialsTypeOIDC.String()), []configuration.SelfServiceHook{{Name: "session"}})
+
+		ts, _ := testhelpers.NewKratosServer(t, reg)
+		_ = testhelpers.NewRegistrationUIFlowEchoServer(t, reg)
+		returnTS := testhelpers.NewRedirSessionEchoTS(t, reg)
+
+		// Apple sends the email verification status as a string.
+		p.claims = map[string]interface{}{"sub": "apple-user", "email": "apple-user@ory.sh", "email_verified": "true"}
+
+		f, err := reg.RegistrationHandler().NewRegistrationFlow(httptest.NewRecorder(),
+			&http.Request{URL: urlx.ParseOrPanic(returnTS.URL)}, flow.TypeBrowser)
+		require.NoError(t, err)
+
+		// Stop at the provider, which would render a form that the browser posts back to the callback.
+		c := testhelpers.NewClientWithCookies(t)
+		c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if strings.HasPrefix(req.URL.String(), p.URL) {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		}
+
+		res, err := c.PostForm(ts.URL+strings.Replace(oidc.RouteAuth, ":flow", f.ID.String(), 1), url.Values{"provider": {"apple"}})
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		require.Equal(t, http.StatusFound, res.StatusCode)
+
+		auth, err := res.Location()
+		require.NoError(t, err)
+		assert.Equal(t, "form_post", auth.Query().Get("response_mode"))
+		assert.Equal(t, "openid email name", auth.Query().Get("scope"))
+
+		c.CheckRedirect = nil
+		res, err = c.PostForm(ts.URL+strings.Replace(oidc.RouteCallback, ":provider", "apple", 1), url.Values{
+			"code":  {"code"},
+			"state": {auth.Query().Get("state")},
+			"user":  {`{"name":{"firstName":"Jane","lastName":"Doe"},"email":"apple-user@ory.sh"}`},
+		})
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+
+		// The parameters are posted again by the browser instead of being added to a redirect URL.
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Equal(t, ts.URL+strings.Replace(oidc.RouteCallback, ":provider", "apple", 1), res.Request.URL.String())
+		action := regexp.MustCompile(`action="([^"]+)"`).FindStringSubmatch(string(body))
+		require.Len(t, action, 2, "%s", body)
+		assert.Equal(t, ts.URL+strings.Replace(oidc.RouteContinue, ":provider", "apple", 1), html.UnescapeString(action[1]))
+
+		fv := url.Values{}
+		for _, field := range regexp.MustCompile(`name="([^"]+)" value="([^"]*)"`).FindAllStringSubmatch(string(body), -1) {
+			fv.Add(html.UnescapeString(field[1]), html.UnescapeString(field[2]))
+		}
+		assert.Equal(t, "code", fv.Get("code"))
+
+		res, err = c.PostForm(html.UnescapeString(action[1]), fv)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err = ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+
+		require.Contains(t, res.Request.URL.String(), returnTS.URL, "%s", body)
+		assert.Equal(t, "apple-user@ory.sh", gjson.GetBytes(body, "identity.traits.subject").String(), "%s", body)
+		assert.Equal(t, "Jane Doe", gjson.GetBytes(body, "identity.traits.name").String(), "%s", body)
+	})
+}
@@ -0,0 +1,173 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	ClientAuthMethodSecretBasic   = "client_secret_basic"
+	ClientAuthMethodSecretPost    = "client_secret_post"
+	ClientAuthMethodPrivateKeyJWT = "private_key_jwt"
+
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+// tokenRequestContext configures how the client authenticates at the provider's token endpoint. The returned context
+// must be used for all token requests made with the given config.
+func tokenRequestContext(ctx context.Context, p Provider, c *oauth2.Config) (context.Context, error) {
+	conf := p.Config()
+	switch conf.ClientAuthMethod {
+	case "":
+		return ctx, nil
+	case ClientAuthMethodSecretBasic:
+		c.Endpoint.AuthStyle = oauth2.AuthStyleInHeader
+		return ctx, nil
+	case ClientAuthMethodSecretPost:
+		c.Endpoint.AuthStyle = oauth2.AuthStyleInParams
+		return ctx, nil
+	case ClientAuthMethodPrivateKeyJWT:
+		key, err := clientPrivateKey(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Endpoint.AuthStyle = oauth2.AuthStyleInParams
+		c.ClientSecret = ""
+
+		base := http.DefaultTransport
+		if hc, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok && hc.Transport != nil {
+			base = hc.Transport
+		}
+
+		return context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: &clientAssertionTransport{
+			base:     base,
+			config:   conf,
+			key:      key,
+			tokenURL: c.Endpoint.TokenURL,
+		}}), nil
+	}
+
+	return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf(`The client_auth_method "%s" of provider %s is not supported.`, conf.ClientAuthMethod, conf.ID))
+}
+
+// clientPrivateKey decodes the PKCS #1, PKCS #8 or SEC 1 encoded private key of the client.
+func clientPrivateKey(conf *Configuration) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(conf.ClientPrivateKey))
+	if block == nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The client_private_key of provider %s must be PEM encoded.", conf.ID))
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The client_private_key of provider %s could not be parsed: %s", conf.ID, err))
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	}
+	return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The client_private_key of provider %s must be an RSA or ECDSA private key but got %T.", conf.ID, key))
+}
+
+// clientAssertionTransport adds a signed client assertion (RFC 7523) to all requests sent to the token endpoint.
+type clientAssertionTransport struct {
+	base     http.RoundTripper
+	config   *Configuration
+	key      crypto.Signer
+	tokenURL string
+}
+
+func (t *clientAssertionTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Method != "POST" || r.URL.String() != t.tokenURL || r.Body == nil {
+		return t.base.RoundTrip(r)
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	assertion, err := t.assertion()
+	if err != nil {
+		return nil, err
+	}
+	values.Set("client_assertion_type", clientAssertionType)
+	values.Set("client_assertion", assertion)
+
+	encoded := values.Encode()
+	req := r.Clone(r.Context())
+	req.Body = ioutil.NopCloser(bytes.NewBufferString(encoded))
+	req.ContentLength = int64(len(encoded))
+	req.Header.Set("Content-Length", strconv.Itoa(len(encoded)))
+
+	return t.base.RoundTrip(req)
+}
+
+func (t *clientAssertionTransport) assertion() (string, error) {
+	var method jwt.SigningMethod = jwt.SigningMethodRS256
+	if k, ok := t.key.(*ecdsa.PrivateKey); ok {
+		switch k.Curve {
+		case elliptic.P384():
+			method = jwt.SigningMethodES384
+		case elliptic.P521():
+			method = jwt.SigningMethodES512
+		default:
+			method = jwt.SigningMethodES256
+		}
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(method, jwt.StandardClaims{
+		Audience:  t.tokenURL,
+		ExpiresAt: now.Add(time.Minute * 5).Unix(),
+		Id:        x.NewUUID().String(),
+		IssuedAt:  now.Unix(),
+		Issuer:    t.config.ClientID,
+		Subject:   t.config.ClientID,
+	})
+	if len(t.config.ClientPrivateKeyID) > 0 {
+		token.Header["kid"] = t.config.ClientPrivateKeyID
+	}
+
+	assertion, err := token.SignedString(t.key)
+	if err != nil {
+		return "", errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to sign the client assertion of provider %s: %s", t.config.ID, err))
+	}
+	return assertion, nil
+}
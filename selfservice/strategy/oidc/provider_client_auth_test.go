@@ -0,0 +1,82 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestTokenRequestContext(t *testing.T) {
+	var assertion string
+	ts := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assertion = r.PostForm.Get("client_assertion")
+		w.Header().Set("Content-Type", "application/json")
+		writeJSON(t, w, map[string]interface{}{"access_token": "token", "token_type": "bearer"})
+	})
+
+	var newConfig = func() *oauth2.Config {
+		return &oauth2.Config{ClientID: "client", ClientSecret: "secret", Endpoint: oauth2.Endpoint{TokenURL: ts.URL + "/token"}}
+	}
+
+	t.Run("case=sets the auth style", func(t *testing.T) {
+		for method, style := range map[string]oauth2.AuthStyle{
+			"":                          oauth2.AuthStyleAutoDetect,
+			ClientAuthMethodSecretBasic: oauth2.AuthStyleInHeader,
+			ClientAuthMethodSecretPost:  oauth2.AuthStyleInParams,
+		} {
+			c := newConfig()
+			_, err := tokenRequestContext(context.Background(), NewProviderGenericOIDC(&Configuration{ID: "p", ClientAuthMethod: method}, nonStandardPublic), c)
+			require.NoError(t, err)
+			assert.Equal(t, style, c.Endpoint.AuthStyle, method)
+			assert.Equal(t, "secret", c.ClientSecret, method)
+		}
+	})
+
+	t.Run("case=rejects unknown methods", func(t *testing.T) {
+		_, err := tokenRequestContext(context.Background(), NewProviderGenericOIDC(&Configuration{ID: "p", ClientAuthMethod: "tls_client_auth"}, nonStandardPublic), newConfig())
+		require.Error(t, err)
+		assert.Contains(t, errorReason(err), `"tls_client_auth" of provider p is not supported`)
+	})
+
+	t.Run("case=rejects invalid private keys", func(t *testing.T) {
+		_, err := tokenRequestContext(context.Background(), NewProviderGenericOIDC(&Configuration{ID: "p", ClientAuthMethod: ClientAuthMethodPrivateKeyJWT, ClientPrivateKey: "not-a-key"}, nonStandardPublic), newConfig())
+		require.Error(t, err)
+		assert.Contains(t, errorReason(err), "must be PEM encoded")
+	})
+
+	t.Run("case=signs the assertion with an ECDSA key", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+
+		c := newConfig()
+		ctx, err := tokenRequestContext(context.Background(), NewProviderGenericOIDC(&Configuration{
+			ID: "p", ClientID: "client", ClientAuthMethod: ClientAuthMethodPrivateKeyJWT,
+			ClientPrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		}, nonStandardPublic), c)
+		require.NoError(t, err)
+		assert.Empty(t, c.ClientSecret)
+
+		_, err = c.Exchange(ctx, "code")
+		require.NoError(t, err)
+
+		token, err := jwt.Parse(assertion, func(token *jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "ES256", token.Header["alg"])
+		assert.Nil(t, token.Header["kid"])
+	})
+}
@@ -15,19 +15,33 @@ type Configuration struct {
 	// ID is the provider's ID
 	ID string `json:"id"`
 
-	// Provider is either "generic" for a generic OAuth 2.0 / OpenID Connect Provider or one of:
+	// Provider is either "generic" for a generic OAuth 2.0 / OpenID Connect Provider, "generic_oauth2" for an
+	// OAuth 2.0 Provider without OpenID Connect support, or one of:
 	// - generic
+	// - generic_oauth2
 	// - google
+	// - github
+	// - microsoft
+	// - wechat
+	// - qq
+	// - alipay
+	// - dingtalk
+	// - apple
+	// - gitlab
+	// - discord
+	// - slack
 	Provider string `json:"provider"`
 
-	// ClientID is the application's Client ID.
+	// ClientID is the application's Client ID. For WeChat this is the AppID and for Alipay the APPID.
 	ClientID string `json:"client_id"`
 
-	// ClientSecret is the application's secret.
+	// ClientSecret is the application's secret. For Alipay this is the application's RSA private key. For Apple this
+	// can be left empty if `apple_private_key` is set.
 	ClientSecret string `json:"client_secret"`
 
 	// IssuerURL is the OpenID Connect Server URL. You can leave this empty if `provider` is not set to `generic`.
-	// If set, neither `auth_url` nor `token_url` are required.
+	// If set, neither `auth_url` nor `token_url` are required. For GitLab this is the base URL of a self-hosted
+	// instance.
 	IssuerURL string `json:"issuer_url"`
 
 	// AuthURL is the authorize url, typically something like: https://example.org/oauth2/auth
@@ -40,14 +54,57 @@ type Configuration struct {
 	// `provider` is set to `generic`.
 	TokenURL string `json:"token_url"`
 
+	// UserinfoURL is the URL which returns the user's claims for an access token, typically something like:
+	// https://example.org/api/user. It is required when `provider` is set to `generic_oauth2`.
+	UserinfoURL string `json:"userinfo_url"`
+
+	// ClaimsMapping maps claims such as `sub` or `email` to their path in the userinfo response, for example
+	// `{"sub": "data.id"}`. Unmapped claims are read from the top-level key of the same name. Only used when
+	// `provider` is set to `generic_oauth2`.
+	ClaimsMapping map[string]string `json:"claims_mapping"`
+
 	// Tenant is the Azure AD Tenant to use for authentication, and must be set when `provider` is set to `microsoft`.
 	// Can be either `common`, `organizations`, `consumers` for a multitenant application or a specific tenant like
 	// `8eaef023-2b34-4da1-9baa-8bc8c9d6a490` or `contoso.onmicrosoft.com`.
 	Tenant string `json:"tenant"`
 
+	// AppleTeamID is the Apple Developer Team ID and required when `apple_private_key` is set.
+	AppleTeamID string `json:"apple_team_id"`
+
+	// ApplePrivateKeyID is the ID of the Sign in with Apple private key and required when `apple_private_key` is set.
+	ApplePrivateKeyID string `json:"apple_private_key_id"`
+
+	// ApplePrivateKey is the PEM encoded Sign in with Apple private key (.p8) used to generate the client secret.
+	ApplePrivateKey string `json:"apple_private_key"`
+
 	// Scope specifies optional requested permissions.
 	Scope []string `json:"scope"`
 
+	// PKCE enables Proof Key for Code Exchange (RFC 7636) with the S256 code challenge method.
+	PKCE bool `json:"pkce"`
+
+	// Nonce sends a random nonce with the authorization request and requires the ID Token to contain the same
+	// nonce. Only supported by providers which issue ID Tokens.
+	Nonce bool `json:"nonce"`
+
+	// ClientAuthMethod is the method used to authenticate at the token endpoint and one of `client_secret_basic`,
+	// `client_secret_post` or `private_key_jwt`. If empty, `client_secret_basic` is tried first and
+	// `client_secret_post` second.
+	ClientAuthMethod string `json:"client_auth_method"`
+
+	// ClientPrivateKey is the PEM encoded RSA or ECDSA private key which signs the client assertion if
+	// `client_auth_method` is set to `private_key_jwt`.
+	ClientPrivateKey string `json:"client_private_key"`
+
+	// ClientPrivateKeyID is the ID of `client_private_key` which is sent as the `kid` header of the client assertion.
+	ClientPrivateKeyID string `json:"client_private_key_id"`
+
+	// TrustVerifiedEmail links the credentials to an existing identity without asking for its password if this
+	// provider asserts that the email address which matches the existing identity is verified. Only enable this
+	// for providers which verify email addresses themselves and whose `email_verified` claim can not be set by
+	// the user. Requires account linking to be enabled.
+	TrustVerifiedEmail bool `json:"trust_verified_email"`
+
 	// Mapper specifies the JSONNet code snippet which uses the OpenID Connect Provider's data (e.g. GitHub or Google
 	// profile information) to hydrate the identity's data.
 	//
@@ -61,8 +118,19 @@ func (p Configuration) Redir(public *url.URL) string {
 	).String()
 }
 
+// AccountLinkingConfiguration controls how OpenID Connect credentials are linked to an existing identity
+// which uses the same identifier for its password credentials.
+type AccountLinkingConfiguration struct {
+	// Enabled lets the user link the OpenID Connect credentials by entering the password of the existing identity.
+	Enabled bool `json:"enabled"`
+
+	// MaxAttempts is the number of wrong passwords which may be entered before linking fails. Defaults to 5.
+	MaxAttempts int `json:"max_attempts,omitempty"`
+}
+
 type ConfigurationCollection struct {
-	Providers []Configuration `json:"providers"`
+	Providers      []Configuration             `json:"providers"`
+	AccountLinking AccountLinkingConfiguration `json:"account_linking"`
 }
 
 func (c ConfigurationCollection) Provider(id string, public *url.URL) (Provider, error) {
@@ -72,14 +140,32 @@ func (c ConfigurationCollection) Provider(id string, public *url.URL) (Provider,
 			switch p.Provider {
 			case "generic":
 				return NewProviderGenericOIDC(&p, public), nil
+			case "generic_oauth2":
+				return NewProviderGenericOAuth2(&p, public), nil
 			case "google":
 				return NewProviderGoogle(&p, public), nil
 			case "github":
 				return NewProviderGitHub(&p, public), nil
 			case "microsoft":
 				return NewProviderMicrosoft(&p, public), nil
+			case "wechat":
+				return NewProviderWeChat(&p, public), nil
+			case "qq":
+				return NewProviderQQ(&p, public), nil
+			case "alipay":
+				return NewProviderAlipay(&p, public), nil
+			case "dingtalk":
+				return NewProviderDingTalk(&p, public), nil
+			case "apple":
+				return NewProviderApple(&p, public), nil
+			case "gitlab":
+				return NewProviderGitLab(&p, public), nil
+			case "discord":
+				return NewProviderDiscord(&p, public), nil
+			case "slack":
+				return NewProviderSlack(&p, public), nil
 			}
-			return nil, errors.Errorf("provider type %s is not supported, supported are: %v", p.Provider, []string{"generic", "google", "github", "microsoft"})
+			return nil, errors.Errorf("provider type %s is not supported, supported are: %v", p.Provider, []string{"generic", "generic_oauth2", "google", "github", "microsoft", "wechat", "qq", "alipay", "dingtalk", "apple", "gitlab", "discord", "slack"})
 		}
 	}
 	return nil, errors.WithStack(herodot.ErrNotFound.WithReasonf(`OpenID Connect Provider "%s" is unknown or has not been configured`, id))
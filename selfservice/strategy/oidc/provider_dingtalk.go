@@ -0,0 +1,172 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/urlx"
+)
+
+var _ NonStandardProvider = new(ProviderDingTalk)
+
+// ProviderDingTalk implements DingTalk Login (钉钉登录) for third party websites.
+//
+// The subject is the user's unionId, which is the same for all applications of a developer, and the openId
+// otherwise.
+type ProviderDingTalk struct {
+	config *Configuration
+	public *url.URL
+
+	loginURL string
+	apiURL   string
+}
+
+func NewProviderDingTalk(
+	config *Configuration,
+	public *url.URL,
+) *ProviderDingTalk {
+	return &ProviderDingTalk{
+		config:   config,
+		public:   public,
+		loginURL: "https://login.dingtalk.com",
+		apiURL:   "https://api.dingtalk.com",
+	}
+}
+
+type dingtalkError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e dingtalkError) err() error {
+	if e.Code == "" {
+		return nil
+	}
+	return errors.WithStack(herodot.ErrBadRequest.WithReasonf("DingTalk returned error %s: %s", e.Code, e.Message))
+}
+
+func (g *ProviderDingTalk) Config() *Configuration {
+	return g.config
+}
+
+func (g *ProviderDingTalk) oauth2() *oauth2.Config {
+	scope := g.config.Scope
+	if len(scope) == 0 {
+		scope = []string{"openid"}
+	}
+
+	return &oauth2.Config{
+		ClientID:     g.config.ClientID,
+		ClientSecret: g.config.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  urlx.AppendPaths(urlx.ParseOrPanic(g.loginURL), "/oauth2/auth").String(),
+			TokenURL: urlx.AppendPaths(urlx.ParseOrPanic(g.apiURL), "/v1.0/oauth2/userAccessToken").String(),
+		},
+		Scopes:      scope,
+		RedirectURL: g.config.Redir(g.public),
+	}
+}
+
+func (g *ProviderDingTalk) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	return g.oauth2(), nil
+}
+
+func (g *ProviderDingTalk) AuthCodeURLOptions(r ider) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("prompt", "consent")}
+}
+
+func (g *ProviderDingTalk) AuthCodeURL(state string, r ider) string {
+	return g.oauth2().AuthCodeURL(state, g.AuthCodeURLOptions(r)...)
+}
+
+func (g *ProviderDingTalk) CodeParameter() string {
+	return "authCode"
+}
+
+func (g *ProviderDingTalk) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	c := g.oauth2()
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(map[string]string{
+		"clientId":     c.ClientID,
+		"clientSecret": c.ClientSecret,
+		"code":         code,
+		"grantType":    "authorization_code",
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	req, err := http.NewRequest("POST", c.Endpoint.TokenURL, &body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var res struct {
+		dingtalkError
+		AccessToken  string    `json:"accessToken"`
+		RefreshToken string    `json:"refreshToken"`
+		ExpireIn     flexInt64 `json:"expireIn"`
+	}
+	if err := fetchJSON(ctx, req, &res); err != nil {
+		return nil, err
+	} else if err := res.err(); err != nil {
+		return nil, err
+	}
+
+	return newToken(res.AccessToken, res.RefreshToken, res.ExpireIn, nil), nil
+}
+
+func (g *ProviderDingTalk) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+	req, err := http.NewRequest("GET", urlx.AppendPaths(urlx.ParseOrPanic(g.apiURL), "/v1.0/contact/users/me").String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("x-acs-dingtalk-access-token", exchange.AccessToken)
+
+	var user struct {
+		dingtalkError
+		Nick      string `json:"nick"`
+		AvatarURL string `json:"avatarUrl"`
+		Mobile    string `json:"mobile"`
+		OpenID    string `json:"openId"`
+		UnionID   string `json:"unionId"`
+		Email     string `json:"email"`
+		StateCode string `json:"stateCode"`
+	}
+	if err := fetchJSON(ctx, req, &user); err != nil {
+		return nil, err
+	} else if err := user.err(); err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{
+		Issuer:   g.loginURL,
+		Subject:  firstNonEmpty(user.UnionID, user.OpenID),
+		Name:     user.Nick,
+		Nickname: user.Nick,
+		Picture:  user.AvatarURL,
+		Email:    user.Email,
+	}
+	if len(claims.Subject) == 0 {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("DingTalk did not return the unionId or openId of the user."))
+	}
+
+	// The mobile number is only returned if the Contact.User.mobile permission was granted.
+	if len(user.Mobile) > 0 {
+		claims.PhoneNumber = user.Mobile
+		if len(user.StateCode) > 0 {
+			claims.PhoneNumber = "+" + strings.TrimPrefix(user.StateCode, "+") + user.Mobile
+		}
+	}
+
+	return claims, nil
+}
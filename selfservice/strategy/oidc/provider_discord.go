@@ -0,0 +1,144 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/stringslice"
+	"github.com/ory/x/urlx"
+)
+
+var _ Provider = new(ProviderDiscord)
+
+// ProviderDiscord implements Discord. The email address is only available if the `email` scope is requested.
+type ProviderDiscord struct {
+	config *Configuration
+	public *url.URL
+
+	apiURL string
+	cdnURL string
+}
+
+func NewProviderDiscord(
+	config *Configuration,
+	public *url.URL,
+) *ProviderDiscord {
+	return &ProviderDiscord{
+		config: config,
+		public: public,
+		apiURL: "https://discord.com/api",
+		cdnURL: "https://cdn.discordapp.com",
+	}
+}
+
+type discordError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e discordError) err() error {
+	if e.Message == "" {
+		return nil
+	}
+	return errors.WithStack(herodot.ErrBadRequest.WithReasonf("Discord returned error %d: %s", e.Code, e.Message))
+}
+
+func (d *ProviderDiscord) Config() *Configuration {
+	return d.config
+}
+
+func (d *ProviderDiscord) scope() []string {
+	if len(d.config.Scope) == 0 {
+		return []string{"identify", "email"}
+	}
+	return d.config.Scope
+}
+
+func (d *ProviderDiscord) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	return &oauth2.Config{
+		ClientID:     d.config.ClientID,
+		ClientSecret: d.config.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  urlx.AppendPaths(urlx.ParseOrPanic(d.apiURL), "/oauth2/authorize").String(),
+			TokenURL: urlx.AppendPaths(urlx.ParseOrPanic(d.apiURL), "/oauth2/token").String(),
+		},
+		Scopes:      d.scope(),
+		RedirectURL: d.config.Redir(d.public),
+	}, nil
+}
+
+func (d *ProviderDiscord) AuthCodeURLOptions(r ider) []oauth2.AuthCodeOption {
+	if isForced(r) {
+		return []oauth2.AuthCodeOption{
+			oauth2.SetAuthURLParam("prompt", "consent"),
+		}
+	}
+	return []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("prompt", "none"),
+	}
+}
+
+func (d *ProviderDiscord) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+	grantedScopes := strings.Fields(fmt.Sprintf("%s", exchange.Extra("scope")))
+	for _, check := range d.scope() {
+		if !stringslice.Has(grantedScopes, check) {
+			return nil, errors.WithStack(ErrScopeMissing)
+		}
+	}
+
+	req, err := http.NewRequest("GET", urlx.AppendPaths(urlx.ParseOrPanic(d.apiURL), "/users/@me").String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	exchange.SetAuthHeader(req)
+
+	var user struct {
+		discordError
+		ID            string `json:"id"`
+		Username      string `json:"username"`
+		Discriminator string `json:"discriminator"`
+		GlobalName    string `json:"global_name"`
+		Avatar        string `json:"avatar"`
+		Email         string `json:"email"`
+		Verified      bool   `json:"verified"`
+		Locale        string `json:"locale"`
+	}
+	if err := fetchJSON(ctx, req, &user); err != nil {
+		return nil, err
+	} else if err := user.err(); err != nil {
+		return nil, err
+	}
+
+	if len(user.ID) == 0 {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("Discord did not return the id of the user."))
+	}
+
+	claims := &Claims{
+		Issuer:            d.apiURL,
+		Subject:           user.ID,
+		Name:              firstNonEmpty(user.GlobalName, user.Username),
+		Nickname:          user.Username,
+		PreferredUsername: user.Username,
+		Email:             user.Email,
+		EmailVerified:     user.Verified,
+		Locale:            user.Locale,
+	}
+
+	// Users who have not migrated to unique usernames yet are only unique together with their discriminator.
+	if len(user.Discriminator) > 0 && user.Discriminator != "0" {
+		claims.PreferredUsername = user.Username + "#" + user.Discriminator
+	}
+
+	if len(user.Avatar) > 0 {
+		claims.Picture = urlx.AppendPaths(urlx.ParseOrPanic(d.cdnURL), "avatars", user.ID, user.Avatar+".png").String()
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,162 @@
+package oidc_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/x/urlx"
+)
+
+// fakeProvider is an in-process OpenID Connect Provider which authorizes every request and issues an ID Token
+// with the configured claims. Unlike Hydra it does not need any external services.
+type fakeProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	clientID string
+	claims   jwt.MapClaims
+
+	// expiresIn is the lifetime of the issued access tokens in seconds.
+	expiresIn int
+
+	// challenge and nonce are taken from the last authorization request.
+	challenge string
+	nonce     string
+
+	// tokenRequest is the form of the last token request.
+	tokenRequest url.Values
+}
+
+func newFakeProvider(t *testing.T, clientID string) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	p := &fakeProvider{key: key, clientID: clientID, claims: jwt.MapClaims{}, expiresIn: 3600}
+	router := httprouter.New()
+	router.GET("/.well-known/openid-configuration", p.discovery)
+	router.GET("/.well-known/jwks.json", p.jwks)
+	router.GET("/oauth2/auth", p.auth)
+	router.POST("/oauth2/token", p.token)
+	router.GET("/userinfo", p.userinfo)
+
+	p.Server = httptest.NewServer(router)
+	t.Cleanup(p.Server.Close)
+	return p
+}
+
+func (p *fakeProvider) discovery(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                p.URL,
+		"authorization_endpoint":                p.URL + "/oauth2/auth",
+		"token_endpoint":                        p.URL + "/oauth2/token",
+		"jwks_uri":                              p.URL + "/.well-known/jwks.json",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (p *fakeProvider) jwks(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]interface{}{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "fake",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *fakeProvider) auth(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	p.challenge = r.URL.Query().Get("code_challenge")
+	p.nonce = r.URL.Query().Get("nonce")
+
+	redir := urlx.ParseOrPanic(r.URL.Query().Get("redirect_uri"))
+	redir.RawQuery = url.Values{"code": {"code"}, "state": {r.URL.Query().Get("state")}}.Encode()
+	http.Redirect(w, r, redir.String(), http.StatusFound)
+}
+
+func (p *fakeProvider) token(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.tokenRequest = r.PostForm
+
+	if r.PostFormValue("grant_type") == "refresh_token" {
+		if r.PostFormValue("refresh_token") != "refresh-token" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "refreshed-access-token",
+			"refresh_token": "refresh-token",
+			"token_type":    "bearer",
+			"expires_in":    3600,
+		})
+		return
+	}
+
+	if len(p.challenge) > 0 {
+		verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(verifier[:]) != p.challenge {
+			http.Error(w, `{"error":"invalid_grant","error_description":"PKCE verification failed"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	claims := jwt.MapClaims{
+		"iss": p.URL,
+		"aud": p.clientID,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	if len(p.nonce) > 0 {
+		claims["nonce"] = p.nonce
+	}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "fake"
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  "access-token",
+		"refresh_token": "refresh-token",
+		"token_type":    "bearer",
+		"expires_in":    p.expiresIn,
+		"id_token":      idToken,
+	})
+}
+
+func (p *fakeProvider) userinfo(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if r.Header.Get("Authorization") != "Bearer access-token" {
+		http.Error(w, `{"error":"invalid_token"}`, http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(p.claims)
+}
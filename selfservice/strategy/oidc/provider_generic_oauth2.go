@@ -0,0 +1,143 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+)
+
+var _ Provider = new(ProviderGenericOAuth2)
+
+// ProviderGenericOAuth2 implements OAuth 2.0 servers which support neither OpenID Connect Discovery nor ID Tokens.
+//
+// The claims are fetched from the configured userinfo URL. Each claim is read from the JSON response using the
+// path from `claims_mapping` (https://github.com/tidwall/gjson syntax) and defaults to the top-level key named
+// after the claim. The complete response is available as `raw_claims` in the Jsonnet mapper.
+type ProviderGenericOAuth2 struct {
+	config *Configuration
+	public *url.URL
+}
+
+func NewProviderGenericOAuth2(
+	config *Configuration,
+	public *url.URL,
+) *ProviderGenericOAuth2 {
+	return &ProviderGenericOAuth2{
+		config: config,
+		public: public,
+	}
+}
+
+func (g *ProviderGenericOAuth2) Config() *Configuration {
+	return g.config
+}
+
+func (g *ProviderGenericOAuth2) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	if len(g.config.AuthURL) == 0 || len(g.config.TokenURL) == 0 {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The generic_oauth2 provider %s requires auth_url and token_url to be set.", g.config.ID))
+	}
+
+	return &oauth2.Config{
+		ClientID:     g.config.ClientID,
+		ClientSecret: g.config.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  g.config.AuthURL,
+			TokenURL: g.config.TokenURL,
+		},
+		Scopes:      g.config.Scope,
+		RedirectURL: g.config.Redir(g.public),
+	}, nil
+}
+
+func (g *ProviderGenericOAuth2) AuthCodeURLOptions(r ider) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{}
+}
+
+func (g *ProviderGenericOAuth2) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+	if len(g.config.UserinfoURL) == 0 {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The generic_oauth2 provider %s requires userinfo_url to be set.", g.config.ID))
+	}
+
+	req, err := http.NewRequest("GET", g.config.UserinfoURL, nil)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The userinfo_url of provider %s is invalid: %s", g.config.ID, err))
+	}
+	req.Header.Set("Accept", "application/json")
+	exchange.SetAuthHeader(req)
+
+	res, err := oauth2.NewClient(ctx, nil).Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to reach the provider: %s", err))
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to read the provider's response: %s", err))
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The userinfo endpoint responded with status code %d.", res.StatusCode).WithDebug(string(body)))
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The userinfo endpoint did not respond with a JSON object: %s", err).WithDebug(string(body)))
+	}
+
+	claims := g.mapClaims(body)
+	if len(claims.Subject) == 0 {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The userinfo response does not contain the subject at path "%s".`, g.claimPath("sub")).WithDebug(string(body)))
+	}
+	if len(claims.Issuer) == 0 {
+		claims.Issuer = g.config.TokenURL
+	}
+	claims.RawClaims = raw
+
+	return claims, nil
+}
+
+func (g *ProviderGenericOAuth2) claimPath(claim string) string {
+	if path, ok := g.config.ClaimsMapping[claim]; ok {
+		return path
+	}
+	return claim
+}
+
+func (g *ProviderGenericOAuth2) mapClaims(body []byte) *Claims {
+	get := func(claim string) gjson.Result {
+		return gjson.GetBytes(body, g.claimPath(claim))
+	}
+
+	return &Claims{
+		Issuer:              get("iss").String(),
+		Subject:             get("sub").String(),
+		Name:                get("name").String(),
+		GivenName:           get("given_name").String(),
+		FamilyName:          get("family_name").String(),
+		LastName:            get("last_name").String(),
+		MiddleName:          get("middle_name").String(),
+		Nickname:            get("nickname").String(),
+		PreferredUsername:   get("preferred_username").String(),
+		Profile:             get("profile").String(),
+		Picture:             get("picture").String(),
+		Website:             get("website").String(),
+		Email:               get("email").String(),
+		EmailVerified:       get("email_verified").Bool(),
+		Gender:              get("gender").String(),
+		Birthdate:           get("birthdate").String(),
+		Zoneinfo:            get("zoneinfo").String(),
+		Locale:              get("locale").String(),
+		PhoneNumber:         get("phone_number").String(),
+		PhoneNumberVerified: get("phone_number_verified").Bool(),
+		UpdatedAt:           get("updated_at").Int(),
+	}
+}
@@ -0,0 +1,149 @@
+package oidc_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+	"github.com/ory/viper"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/strategy/oidc"
+)
+
+func TestProviderGenericOAuth2(t *testing.T) {
+	p := newFakeProvider(t, "client")
+	userinfo := map[string]interface{}{
+		"data": map[string]interface{}{
+			"id": 42,
+			"attributes": map[string]interface{}{
+				"mail":         "legacy@ory.sh",
+				"confirmed":    "true",
+				"display_name": "Legacy User",
+			},
+		},
+	}
+
+	var newProvider = func(c oidc.Configuration) *oidc.ProviderGenericOAuth2 {
+		c.ID, c.Provider, c.ClientID = "legacy", "generic_oauth2", "client"
+		return oidc.NewProviderGenericOAuth2(&c, urlx.ParseOrPanic("https://ory.sh"))
+	}
+
+	var reason = func(err error) string {
+		var e *herodot.DefaultError
+		require.True(t, errors.As(err, &e), "%+v", err)
+		return e.Reason()
+	}
+
+	t.Run("case=requires the endpoints", func(t *testing.T) {
+		_, err := newProvider(oidc.Configuration{}).OAuth2(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, reason(err), "requires auth_url and token_url")
+
+		_, err = newProvider(oidc.Configuration{}).Claims(context.Background(), &oauth2.Token{AccessToken: "access-token"})
+		require.Error(t, err)
+		assert.Contains(t, reason(err), "requires userinfo_url")
+	})
+
+	t.Run("case=does not add the openid scope", func(t *testing.T) {
+		c, err := newProvider(oidc.Configuration{AuthURL: p.URL + "/oauth2/auth", TokenURL: p.URL + "/oauth2/token", Scope: []string{"profile"}}).OAuth2(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"profile"}, c.Scopes)
+	})
+
+	t.Run("case=fails if the userinfo request is not authorized", func(t *testing.T) {
+		_, err := newProvider(oidc.Configuration{UserinfoURL: p.URL + "/userinfo"}).Claims(context.Background(), &oauth2.Token{AccessToken: "invalid"})
+		require.Error(t, err)
+		assert.Contains(t, reason(err), "status code 401")
+	})
+
+	t.Run("case=fails if the subject is missing", func(t *testing.T) {
+		p.claims = userinfo
+		_, err := newProvider(oidc.Configuration{UserinfoURL: p.URL + "/userinfo"}).Claims(context.Background(), &oauth2.Token{AccessToken: "access-token"})
+		require.Error(t, err)
+		assert.Contains(t, reason(err), `does not contain the subject at path "sub"`)
+	})
+
+	t.Run("case=reads unmapped claims from the top-level keys", func(t *testing.T) {
+		p.claims = map[string]interface{}{"sub": "flat", "email": "flat@ory.sh", "email_verified": true}
+		claims, err := newProvider(oidc.Configuration{UserinfoURL: p.URL + "/userinfo", TokenURL: p.URL + "/oauth2/token"}).
+			Claims(context.Background(), &oauth2.Token{AccessToken: "access-token"})
+		require.NoError(t, err)
+		assert.Equal(t, "flat", claims.Subject)
+		assert.Equal(t, "flat@ory.sh", claims.Email)
+		assert.True(t, claims.EmailVerified)
+		assert.Equal(t, p.URL+"/oauth2/token", claims.Issuer)
+	})
+
+	t.Run("case=maps nested claims", func(t *testing.T) {
+		p.claims = userinfo
+		claims, err := newProvider(oidc.Configuration{
+			UserinfoURL:   p.URL + "/userinfo",
+			ClaimsMapping: map[string]string{"sub": "data.id", "email": "data.attributes.mail", "email_verified": "data.attributes.confirmed"},
+		}).Claims(context.Background(), &oauth2.Token{AccessToken: "access-token"})
+		require.NoError(t, err)
+		assert.Equal(t, "42", claims.Subject)
+		assert.Equal(t, "legacy@ory.sh", claims.Email)
+		assert.True(t, claims.EmailVerified)
+		assert.Equal(t, userinfo["data"].(map[string]interface{})["attributes"], claims.RawClaims["data"].(map[string]interface{})["attributes"])
+	})
+
+	t.Run("case=signs up using the raw claims in the mapper", func(t *testing.T) {
+		_, reg := internal.NewFastRegistryWithMocks(t)
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypeOIDC),
+			map[string]interface{}{"enabled": true, "config": &oidc.ConfigurationCollection{
+				Providers: []oidc.Configuration{{
+					ID:            "legacy",
+					Provider:      "generic_oauth2",
+					ClientID:      "client",
+					ClientSecret:  "secret",
+					AuthURL:       p.URL + "/oauth2/auth",
+					TokenURL:      p.URL + "/oauth2/token",
+					UserinfoURL:   p.URL + "/userinfo",
+					ClaimsMapping: map[string]string{"sub": "data.id", "email": "data.attributes.mail"},
+					Mapper:        "file://./stub/oidc.raw.jsonnet",
+				}},
+			}})
+		viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/registration.schema.json")
+		viper.Set(configuration.HookStrategyKey(configuration.ViperKeySelfServiceRegistrationAfter,
+			identity.CredentialsTypeOIDC.String()), []configuration.SelfServiceHook{{Name: "session"}})
+
+		ts, _ := testhelpers.NewKratosServer(t, reg)
+		_ = testhelpers.NewRegistrationUIFlowEchoServer(t, reg)
+		returnTS := testhelpers.NewRedirSessionEchoTS(t, reg)
+		p.claims = userinfo
+
+		f, err := reg.RegistrationHandler().NewRegistrationFlow(httptest.NewRecorder(),
+			&http.Request{URL: urlx.ParseOrPanic(returnTS.URL)}, flow.TypeBrowser)
+		require.NoError(t, err)
+
+		res, err := testhelpers.NewClientWithCookies(t).PostForm(ts.URL+strings.Replace(oidc.RouteAuth, ":flow", f.ID.String(), 1), url.Values{"provider": {"legacy"}})
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+
+		require.Contains(t, res.Request.URL.String(), returnTS.URL, "%s", body)
+		assert.Equal(t, "legacy@ory.sh", gjson.GetBytes(body, "identity.traits.subject").String(), "%s", body)
+		assert.Equal(t, "Legacy User", gjson.GetBytes(body, "identity.traits.name").String(), "%s", body)
+
+		_, _, err = reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeOIDC, "legacy:42")
+		require.NoError(t, err)
+	})
+}
@@ -81,7 +81,7 @@ func (g *ProviderGenericOIDC) AuthCodeURLOptions(r ider) []oauth2.AuthCodeOption
 	return []oauth2.AuthCodeOption{}
 }
 
-func (g *ProviderGenericOIDC) verifyAndDecodeClaimsWithProvider(ctx context.Context, provider *gooidc.Provider, raw string) (*Claims, error) {
+func (g *ProviderGenericOIDC) verifyWithProvider(ctx context.Context, provider *gooidc.Provider, raw string) (*gooidc.IDToken, error) {
 	token, err := provider.
 		Verifier(&gooidc.Config{
 			ClientID: g.config.ClientID,
@@ -90,6 +90,14 @@ func (g *ProviderGenericOIDC) verifyAndDecodeClaimsWithProvider(ctx context.Cont
 	if err != nil {
 		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("%s", err))
 	}
+	return token, nil
+}
+
+func (g *ProviderGenericOIDC) verifyAndDecodeClaimsWithProvider(ctx context.Context, provider *gooidc.Provider, raw string) (*Claims, error) {
+	token, err := g.verifyWithProvider(ctx, provider, raw)
+	if err != nil {
+		return nil, err
+	}
 
 	var claims Claims
 	if err := token.Claims(&claims); err != nil {
@@ -0,0 +1,120 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	gooidc "github.com/coreos/go-oidc"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/stringslice"
+	"github.com/ory/x/urlx"
+)
+
+var _ Provider = new(ProviderGitLab)
+
+// ProviderGitLab implements GitLab.com and self-hosted GitLab instances, whose base URL is set as `issuer_url`.
+type ProviderGitLab struct {
+	config *Configuration
+	public *url.URL
+}
+
+func NewProviderGitLab(
+	config *Configuration,
+	public *url.URL,
+) *ProviderGitLab {
+	return &ProviderGitLab{
+		config: config,
+		public: public,
+	}
+}
+
+type gitlabError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (e gitlabError) err() error {
+	if e.Error == "" {
+		return nil
+	}
+	return errors.WithStack(herodot.ErrBadRequest.WithReasonf("GitLab returned error %s: %s", e.Error, e.ErrorDescription))
+}
+
+func (g *ProviderGitLab) Config() *Configuration {
+	return g.config
+}
+
+func (g *ProviderGitLab) baseURL() (*url.URL, error) {
+	if len(g.config.IssuerURL) == 0 {
+		return urlx.ParseOrPanic("https://gitlab.com"), nil
+	}
+
+	u, err := url.ParseRequestURI(g.config.IssuerURL)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The issuer_url of GitLab provider %s is not a valid URL: %s", g.config.ID, err))
+	}
+	return u, nil
+}
+
+func (g *ProviderGitLab) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	base, err := g.baseURL()
+	if err != nil {
+		return nil, err
+	}
+
+	// The userinfo endpoint requires the openid scope.
+	scope := g.config.Scope
+	if !stringslice.Has(scope, gooidc.ScopeOpenID) {
+		scope = append([]string{gooidc.ScopeOpenID}, scope...)
+	}
+
+	return &oauth2.Config{
+		ClientID:     g.config.ClientID,
+		ClientSecret: g.config.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  urlx.AppendPaths(base, "/oauth/authorize").String(),
+			TokenURL: urlx.AppendPaths(base, "/oauth/token").String(),
+		},
+		Scopes:      scope,
+		RedirectURL: g.config.Redir(g.public),
+	}, nil
+}
+
+func (g *ProviderGitLab) AuthCodeURLOptions(r ider) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{}
+}
+
+func (g *ProviderGitLab) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+	base, err := g.baseURL()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", urlx.AppendPaths(base, "/oauth/userinfo").String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	exchange.SetAuthHeader(req)
+
+	var user struct {
+		gitlabError
+		Claims
+	}
+	if err := fetchJSON(ctx, req, &user); err != nil {
+		return nil, err
+	} else if err := user.err(); err != nil {
+		return nil, err
+	}
+
+	if len(user.Subject) == 0 {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("GitLab did not return the subject of the user."))
+	}
+
+	claims := user.Claims
+	claims.Issuer = base.String()
+	return &claims, nil
+}
@@ -0,0 +1,100 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+)
+
+// fetchJSON sends the request using the HTTP client of the context, if any, and decodes the JSON response into v.
+//
+// Most non-standard providers report errors with HTTP status code 200 which is why the caller has to check the
+// decoded response for errors.
+func fetchJSON(ctx context.Context, req *http.Request, v interface{}) error {
+	res, err := oauth2.NewClient(ctx, nil).Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to reach the provider: %s", err))
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to read the provider's response: %s", err))
+	}
+
+	if res.StatusCode >= http.StatusInternalServerError {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The provider responded with status code %d.", res.StatusCode).WithDebug(string(body)))
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode the provider's response: %s", err).WithDebug(string(body)))
+	}
+
+	return nil
+}
+
+// newToken creates an OAuth2 token for the given values and keeps the provider specific values, such as the
+// subject identifiers, as extras.
+func newToken(accessToken, refreshToken string, expiresIn flexInt64, extra map[string]interface{}) *oauth2.Token {
+	token := &oauth2.Token{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		RefreshToken: refreshToken,
+	}
+	if expiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	}
+	return token.WithExtra(extra)
+}
+
+// extraString returns the token's extra value as a string.
+func extraString(token *oauth2.Token, key string) string {
+	if v, ok := token.Extra(key).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// firstNonEmpty is used to prefer identifiers which are shared across applications, such as WeChat's unionid,
+// over application specific identifiers, such as WeChat's openid.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
+
+// flexInt64 decodes integers which some providers encode as JSON strings.
+type flexInt64 int64
+
+func (i *flexInt64) UnmarshalJSON(b []byte) error {
+	v, err := strconv.ParseInt(strings.Trim(string(b), `"`), 10, 64)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	*i = flexInt64(v)
+	return nil
+}
+
+// flexBool decodes booleans which some providers, such as Apple, encode as JSON strings.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(raw []byte) error {
+	v, err := strconv.ParseBool(strings.Trim(string(raw), `"`))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	*b = flexBool(v)
+	return nil
+}
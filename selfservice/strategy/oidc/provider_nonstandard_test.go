@@ -0,0 +1,342 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/selfservice/flow/login"
+	"github.com/zzpu/ums/x"
+)
+
+var nonStandardPublic = urlx.ParseOrPanic("https://ory.sh")
+
+func newProviderServer(t *testing.T, h http.HandlerFunc) *httptest.Server {
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v interface{}) {
+	require.NoError(t, json.NewEncoder(w).Encode(v))
+}
+
+func TestProviderWeChat(t *testing.T) {
+	var unionID string
+	ts := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sns/oauth2/access_token":
+			assert.Equal(t, "appid", r.URL.Query().Get("appid"))
+			assert.Equal(t, "secret", r.URL.Query().Get("secret"))
+			if r.URL.Query().Get("code") != "code" {
+				writeJSON(t, w, map[string]interface{}{"errcode": 40029, "errmsg": "invalid code"})
+				return
+			}
+			writeJSON(t, w, map[string]interface{}{
+				"access_token": "token", "expires_in": 7200, "refresh_token": "refresh",
+				"openid": "openid", "unionid": unionID, "scope": "snsapi_login",
+			})
+		case "/sns/userinfo":
+			assert.Equal(t, "token", r.URL.Query().Get("access_token"))
+			assert.Equal(t, "openid", r.URL.Query().Get("openid"))
+			writeJSON(t, w, map[string]interface{}{
+				"openid": "openid", "unionid": unionID, "nickname": "微信用户", "sex": 2, "headimgurl": "https://wx.qlogo.cn/avatar",
+			})
+		default:
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+	})
+
+	p := NewProviderWeChat(&Configuration{ID: "wechat", Provider: "wechat", ClientID: "appid", ClientSecret: "secret"}, nonStandardPublic)
+	p.openURL, p.apiURL = ts.URL, ts.URL
+
+	t.Run("case=builds the authorization url with appid", func(t *testing.T) {
+		u := p.AuthCodeURL("state", &login.Flow{ID: x.NewUUID()})
+		assert.True(t, strings.HasPrefix(u, ts.URL+"/connect/qrconnect?"), u)
+		assert.True(t, strings.HasSuffix(u, "#wechat_redirect"), u)
+
+		parsed := urlx.ParseOrPanic(u)
+		assert.Equal(t, "appid", parsed.Query().Get("appid"))
+		assert.Equal(t, "snsapi_login", parsed.Query().Get("scope"))
+		assert.Equal(t, "state", parsed.Query().Get("state"))
+		assert.Equal(t, "https://ory.sh/self-service/methods/oidc/callback/wechat", parsed.Query().Get("redirect_uri"))
+		assert.Empty(t, parsed.Query().Get("client_id"))
+	})
+
+	t.Run("case=uses the in-app authorization endpoint for snsapi_userinfo", func(t *testing.T) {
+		p := NewProviderWeChat(&Configuration{ID: "wechat", ClientID: "appid", Scope: []string{"snsapi_userinfo"}}, nonStandardPublic)
+		assert.Contains(t, p.AuthCodeURL("state", &login.Flow{ID: x.NewUUID()}), "https://open.weixin.qq.com/connect/oauth2/authorize?")
+	})
+
+	t.Run("case=fails on an invalid code", func(t *testing.T) {
+		_, err := p.Exchange(context.Background(), "invalid")
+		require.Error(t, err)
+		assert.Contains(t, errorReason(err), "invalid code")
+	})
+
+	t.Run("case=uses the openid as subject without unionid", func(t *testing.T) {
+		unionID = ""
+		token, err := p.Exchange(context.Background(), "code")
+		require.NoError(t, err)
+		assert.Equal(t, "refresh", token.RefreshToken)
+
+		claims, err := p.Claims(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "openid", claims.Subject)
+		assert.Equal(t, "微信用户", claims.Nickname)
+		assert.Equal(t, "female", claims.Gender)
+		assert.Equal(t, "https://wx.qlogo.cn/avatar", claims.Picture)
+	})
+
+	t.Run("case=prefers the unionid as subject", func(t *testing.T) {
+		unionID = "unionid"
+		token, err := p.Exchange(context.Background(), "code")
+		require.NoError(t, err)
+
+		claims, err := p.Claims(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "unionid", claims.Subject)
+	})
+}
+
+func TestProviderQQ(t *testing.T) {
+	var unionID string
+	ts := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth2.0/token":
+			assert.Equal(t, "json", r.URL.Query().Get("fmt"))
+			assert.Equal(t, "secret", r.URL.Query().Get("client_secret"))
+			writeJSON(t, w, map[string]interface{}{"access_token": "token", "expires_in": "7776000", "refresh_token": "refresh"})
+		case "/oauth2.0/me":
+			if r.URL.Query().Get("access_token") != "token" {
+				writeJSON(t, w, map[string]interface{}{"error": 100016, "error_description": "access token check failed"})
+				return
+			}
+			writeJSON(t, w, map[string]interface{}{"client_id": "client", "openid": "openid", "unionid": unionID})
+		case "/user/get_user_info":
+			assert.Equal(t, "client", r.URL.Query().Get("oauth_consumer_key"))
+			assert.Equal(t, "openid", r.URL.Query().Get("openid"))
+			writeJSON(t, w, map[string]interface{}{"ret": 0, "nickname": "QQ用户", "gender": "男", "figureurl_qq_2": "https://q.qlogo.cn/100"})
+		default:
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+	})
+
+	p := NewProviderQQ(&Configuration{ID: "qq", Provider: "qq", ClientID: "client", ClientSecret: "secret"}, nonStandardPublic)
+	p.graphURL = ts.URL
+
+	t.Run("case=builds the authorization url", func(t *testing.T) {
+		parsed := urlx.ParseOrPanic(p.AuthCodeURL("state", &login.Flow{ID: x.NewUUID()}))
+		assert.Equal(t, "/oauth2.0/authorize", parsed.Path)
+		assert.Equal(t, "client", parsed.Query().Get("client_id"))
+		assert.Equal(t, "get_user_info", parsed.Query().Get("scope"))
+	})
+
+	t.Run("case=fails with an invalid access token", func(t *testing.T) {
+		_, err := p.Claims(context.Background(), newToken("invalid", "", 0, nil))
+		require.Error(t, err)
+		assert.Contains(t, errorReason(err), "access token check failed")
+	})
+
+	t.Run("case=exchanges the code and fetches the profile", func(t *testing.T) {
+		for _, tc := range []struct{ unionID, subject string }{{"", "openid"}, {"unionid", "unionid"}} {
+			unionID = tc.unionID
+			token, err := p.Exchange(context.Background(), "code")
+			require.NoError(t, err)
+			assert.False(t, token.Expiry.IsZero())
+
+			claims, err := p.Claims(context.Background(), token)
+			require.NoError(t, err)
+			assert.Equal(t, tc.subject, claims.Subject)
+			assert.Equal(t, "QQ用户", claims.Nickname)
+			assert.Equal(t, "male", claims.Gender)
+			assert.Equal(t, "https://q.qlogo.cn/100", claims.Picture)
+		}
+	})
+}
+
+func TestProviderAlipay(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ts := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "app", r.PostForm.Get("app_id"))
+		assert.Equal(t, "RSA2", r.PostForm.Get("sign_type"))
+
+		// verify the request signature
+		var keys []string
+		for k := range r.PostForm {
+			if k != "sign" {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		var pairs []string
+		for _, k := range keys {
+			pairs = append(pairs, k+"="+r.PostForm.Get(k))
+		}
+		signature, err := base64.StdEncoding.DecodeString(r.PostForm.Get("sign"))
+		require.NoError(t, err)
+		digest := sha256.Sum256([]byte(strings.Join(pairs, "&")))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			writeJSON(t, w, map[string]interface{}{"error_response": map[string]interface{}{"code": "40002", "msg": "Invalid Arguments", "sub_msg": "invalid signature"}})
+			return
+		}
+
+		switch r.PostForm.Get("method") {
+		case "alipay.system.oauth.token":
+			if r.PostForm.Get("code") != "code" {
+				writeJSON(t, w, map[string]interface{}{"error_response": map[string]interface{}{"code": "40002", "msg": "Invalid Arguments", "sub_code": "isv.code-invalid", "sub_msg": "授权码code无效"}})
+				return
+			}
+			writeJSON(t, w, map[string]interface{}{"alipay_system_oauth_token_response": map[string]interface{}{
+				"user_id": "2088102104794936", "access_token": "token", "expires_in": 3600, "refresh_token": "refresh",
+			}})
+		case "alipay.user.info.share":
+			assert.Equal(t, "token", r.PostForm.Get("auth_token"))
+			writeJSON(t, w, map[string]interface{}{"alipay_user_info_share_response": map[string]interface{}{
+				"code": "10000", "msg": "Success", "user_id": "2088102104794936", "nick_name": "支付宝用户", "avatar": "https://tfs.alipayobjects.com/avatar", "gender": "F",
+			}})
+		default:
+			t.Errorf("unexpected method: %s", r.PostForm.Get("method"))
+		}
+	})
+
+	for name, secret := range map[string]string{
+		"pem":    string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		"base64": base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PrivateKey(key)),
+	} {
+		t.Run("key="+name, func(t *testing.T) {
+			p := NewProviderAlipay(&Configuration{ID: "alipay", Provider: "alipay", ClientID: "app", ClientSecret: secret}, nonStandardPublic)
+			p.authURL, p.gatewayURL = ts.URL, ts.URL
+
+			_, err := p.OAuth2(context.Background())
+			require.NoError(t, err)
+
+			token, err := p.Exchange(context.Background(), "code")
+			require.NoError(t, err)
+
+			claims, err := p.Claims(context.Background(), token)
+			require.NoError(t, err)
+			assert.Equal(t, "2088102104794936", claims.Subject)
+			assert.Equal(t, "支付宝用户", claims.Nickname)
+			assert.Equal(t, "female", claims.Gender)
+		})
+	}
+
+	p := NewProviderAlipay(&Configuration{ID: "alipay", Provider: "alipay", ClientID: "app",
+		ClientSecret: base64.StdEncoding.EncodeToString(x509.MarshalPKCS1PrivateKey(key))}, nonStandardPublic)
+	p.authURL, p.gatewayURL = ts.URL, ts.URL
+
+	t.Run("case=builds the authorization url with app_id", func(t *testing.T) {
+		parsed := urlx.ParseOrPanic(p.AuthCodeURL("state", &login.Flow{ID: x.NewUUID()}))
+		assert.Equal(t, "/oauth2/publicAppAuthorize.htm", parsed.Path)
+		assert.Equal(t, "app", parsed.Query().Get("app_id"))
+		assert.Equal(t, "auth_user", parsed.Query().Get("scope"))
+		assert.Equal(t, "auth_code", p.CodeParameter())
+	})
+
+	t.Run("case=fails on an invalid code", func(t *testing.T) {
+		_, err := p.Exchange(context.Background(), "invalid")
+		require.Error(t, err)
+		assert.Contains(t, errorReason(err), "授权码code无效")
+	})
+
+	t.Run("case=fails with an invalid private key", func(t *testing.T) {
+		p := NewProviderAlipay(&Configuration{ID: "alipay", Provider: "alipay", ClientID: "app", ClientSecret: "not-a-key"}, nonStandardPublic)
+		_, err := p.OAuth2(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, errorReason(err), "must be an RSA private key")
+	})
+}
+
+func TestProviderDingTalk(t *testing.T) {
+	ts := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1.0/oauth2/userAccessToken":
+			var body map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, "client", body["clientId"])
+			assert.Equal(t, "secret", body["clientSecret"])
+			if body["code"] != "code" {
+				w.WriteHeader(http.StatusBadRequest)
+				writeJSON(t, w, map[string]interface{}{"code": "InvalidAuthCode", "message": "authCode is invalid"})
+				return
+			}
+			writeJSON(t, w, map[string]interface{}{"accessToken": "token", "refreshToken": "refresh", "expireIn": 7200})
+		case "/v1.0/contact/users/me":
+			assert.Equal(t, "token", r.Header.Get("x-acs-dingtalk-access-token"))
+			writeJSON(t, w, map[string]interface{}{
+				"nick": "钉钉用户", "avatarUrl": "https://static.dingtalk.com/avatar", "mobile": "13800000000", "stateCode": "86",
+				"openId": "openid", "unionId": "unionid", "email": "user@example.org",
+			})
+		default:
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+	})
+
+	p := NewProviderDingTalk(&Configuration{ID: "dingtalk", Provider: "dingtalk", ClientID: "client", ClientSecret: "secret"}, nonStandardPublic)
+	p.loginURL, p.apiURL = ts.URL, ts.URL
+
+	t.Run("case=builds the authorization url", func(t *testing.T) {
+		parsed := urlx.ParseOrPanic(p.AuthCodeURL("state", &login.Flow{ID: x.NewUUID()}))
+		assert.Equal(t, "/oauth2/auth", parsed.Path)
+		assert.Equal(t, "client", parsed.Query().Get("client_id"))
+		assert.Equal(t, "openid", parsed.Query().Get("scope"))
+		assert.Equal(t, "consent", parsed.Query().Get("prompt"))
+		assert.Equal(t, "authCode", p.CodeParameter())
+	})
+
+	t.Run("case=fails on an invalid code", func(t *testing.T) {
+		_, err := p.Exchange(context.Background(), "invalid")
+		require.Error(t, err)
+		assert.Contains(t, errorReason(err), "authCode is invalid")
+	})
+
+	t.Run("case=exchanges the code and fetches the profile", func(t *testing.T) {
+		token, err := p.Exchange(context.Background(), "code")
+		require.NoError(t, err)
+
+		claims, err := p.Claims(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "unionid", claims.Subject)
+		assert.Equal(t, "钉钉用户", claims.Nickname)
+		assert.Equal(t, "+8613800000000", claims.PhoneNumber)
+		assert.Equal(t, "user@example.org", claims.Email)
+		assert.False(t, claims.EmailVerified)
+	})
+}
+
+func TestConfigurationCollectionNonStandardProviders(t *testing.T) {
+	for _, provider := range []string{"wechat", "qq", "alipay", "dingtalk"} {
+		c := ConfigurationCollection{Providers: []Configuration{{ID: provider, Provider: provider}}}
+		p, err := c.Provider(provider, nonStandardPublic)
+		require.NoError(t, err)
+		assert.Implements(t, (*NonStandardProvider)(nil), p)
+	}
+}
+
+func errorReason(err error) string {
+	if e, ok := errors.Cause(err).(interface{ Reason() string }); ok {
+		return e.Reason()
+	}
+	return err.Error()
+}
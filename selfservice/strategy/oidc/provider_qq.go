@@ -0,0 +1,189 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/urlx"
+)
+
+var _ NonStandardProvider = new(ProviderQQ)
+
+// ProviderQQ implements QQ Login (QQ互联).
+//
+// The subject is the user's unionid if the application has been granted access to it and the openid otherwise.
+type ProviderQQ struct {
+	config *Configuration
+	public *url.URL
+
+	graphURL string
+}
+
+func NewProviderQQ(
+	config *Configuration,
+	public *url.URL,
+) *ProviderQQ {
+	return &ProviderQQ{
+		config:   config,
+		public:   public,
+		graphURL: "https://graph.qq.com",
+	}
+}
+
+type qqError struct {
+	Error            int    `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (e qqError) err() error {
+	if e.Error == 0 {
+		return nil
+	}
+	return errors.WithStack(herodot.ErrBadRequest.WithReasonf("QQ returned error %d: %s", e.Error, e.ErrorDescription))
+}
+
+func (g *ProviderQQ) Config() *Configuration {
+	return g.config
+}
+
+func (g *ProviderQQ) oauth2() *oauth2.Config {
+	scope := g.config.Scope
+	if len(scope) == 0 {
+		scope = []string{"get_user_info"}
+	}
+
+	return &oauth2.Config{
+		ClientID:     g.config.ClientID,
+		ClientSecret: g.config.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  urlx.AppendPaths(urlx.ParseOrPanic(g.graphURL), "/oauth2.0/authorize").String(),
+			TokenURL: urlx.AppendPaths(urlx.ParseOrPanic(g.graphURL), "/oauth2.0/token").String(),
+		},
+		Scopes:      scope,
+		RedirectURL: g.config.Redir(g.public),
+	}
+}
+
+func (g *ProviderQQ) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	return g.oauth2(), nil
+}
+
+func (g *ProviderQQ) AuthCodeURLOptions(r ider) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{}
+}
+
+func (g *ProviderQQ) AuthCodeURL(state string, r ider) string {
+	c := g.oauth2()
+	return urlx.CopyWithQuery(urlx.ParseOrPanic(c.Endpoint.AuthURL), url.Values{
+		"response_type": {"code"},
+		"client_id":     {c.ClientID},
+		"redirect_uri":  {c.RedirectURL},
+		"scope":         {strings.Join(c.Scopes, ",")},
+		"state":         {state},
+	}).String()
+}
+
+func (g *ProviderQQ) CodeParameter() string {
+	return "code"
+}
+
+func (g *ProviderQQ) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	c := g.oauth2()
+	req, err := http.NewRequest("GET", urlx.CopyWithQuery(urlx.ParseOrPanic(c.Endpoint.TokenURL), url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+		"code":          {code},
+		"redirect_uri":  {c.RedirectURL},
+		"fmt":           {"json"},
+	}).String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var res struct {
+		qqError
+		AccessToken  string    `json:"access_token"`
+		ExpiresIn    flexInt64 `json:"expires_in"`
+		RefreshToken string    `json:"refresh_token"`
+	}
+	if err := fetchJSON(ctx, req, &res); err != nil {
+		return nil, err
+	} else if err := res.err(); err != nil {
+		return nil, err
+	}
+
+	return newToken(res.AccessToken, res.RefreshToken, res.ExpiresIn, nil), nil
+}
+
+func (g *ProviderQQ) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+	req, err := http.NewRequest("GET", urlx.CopyWithQuery(urlx.AppendPaths(urlx.ParseOrPanic(g.graphURL), "/oauth2.0/me"), url.Values{
+		"access_token": {exchange.AccessToken},
+		"unionid":      {"1"},
+		"fmt":          {"json"},
+	}).String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var me struct {
+		qqError
+		ClientID string `json:"client_id"`
+		OpenID   string `json:"openid"`
+		UnionID  string `json:"unionid"`
+	}
+	if err := fetchJSON(ctx, req, &me); err != nil {
+		return nil, err
+	} else if err := me.err(); err != nil {
+		return nil, err
+	} else if me.ClientID != g.config.ClientID {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The QQ access token was issued to another application."))
+	}
+
+	req, err = http.NewRequest("GET", urlx.CopyWithQuery(urlx.AppendPaths(urlx.ParseOrPanic(g.graphURL), "/user/get_user_info"), url.Values{
+		"access_token":       {exchange.AccessToken},
+		"oauth_consumer_key": {g.config.ClientID},
+		"openid":             {me.OpenID},
+	}).String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var user struct {
+		Ret          int    `json:"ret"`
+		Msg          string `json:"msg"`
+		Nickname     string `json:"nickname"`
+		Gender       string `json:"gender"`
+		FigureURLQQ1 string `json:"figureurl_qq_1"`
+		FigureURLQQ2 string `json:"figureurl_qq_2"`
+	}
+	if err := fetchJSON(ctx, req, &user); err != nil {
+		return nil, err
+	} else if user.Ret != 0 {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("QQ returned error %d: %s", user.Ret, user.Msg))
+	}
+
+	claims := &Claims{
+		Issuer:   g.graphURL,
+		Subject:  firstNonEmpty(me.UnionID, me.OpenID),
+		Name:     user.Nickname,
+		Nickname: user.Nickname,
+		Picture:  firstNonEmpty(user.FigureURLQQ2, user.FigureURLQQ1),
+		Locale:   "zh_CN",
+	}
+
+	switch user.Gender {
+	case "男":
+		claims.Gender = "male"
+	case "女":
+		claims.Gender = "female"
+	}
+
+	return claims, nil
+}
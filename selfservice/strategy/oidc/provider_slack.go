@@ -0,0 +1,106 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	gooidc "github.com/coreos/go-oidc"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/stringslice"
+	"github.com/ory/x/urlx"
+)
+
+var _ Provider = new(ProviderSlack)
+
+// ProviderSlack implements Sign in with Slack.
+//
+// Slack reports errors with HTTP status code 200 and `"ok": false`, which is why the claims are fetched from Slack's
+// userinfo method instead of relying on OpenID Connect Discovery.
+type ProviderSlack struct {
+	config *Configuration
+	public *url.URL
+
+	slackURL string
+}
+
+func NewProviderSlack(
+	config *Configuration,
+	public *url.URL,
+) *ProviderSlack {
+	return &ProviderSlack{
+		config:   config,
+		public:   public,
+		slackURL: "https://slack.com",
+	}
+}
+
+type slackError struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+func (e slackError) err() error {
+	if e.OK {
+		return nil
+	}
+	return errors.WithStack(herodot.ErrBadRequest.WithReasonf("Slack returned error: %s", e.Error))
+}
+
+func (s *ProviderSlack) Config() *Configuration {
+	return s.config
+}
+
+func (s *ProviderSlack) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	scope := s.config.Scope
+	if len(scope) == 0 {
+		scope = []string{"email", "profile"}
+	}
+	if !stringslice.Has(scope, gooidc.ScopeOpenID) {
+		scope = append([]string{gooidc.ScopeOpenID}, scope...)
+	}
+
+	return &oauth2.Config{
+		ClientID:     s.config.ClientID,
+		ClientSecret: s.config.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  urlx.AppendPaths(urlx.ParseOrPanic(s.slackURL), "/openid/connect/authorize").String(),
+			TokenURL: urlx.AppendPaths(urlx.ParseOrPanic(s.slackURL), "/api/openid.connect.token").String(),
+		},
+		Scopes:      scope,
+		RedirectURL: s.config.Redir(s.public),
+	}, nil
+}
+
+func (s *ProviderSlack) AuthCodeURLOptions(r ider) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{}
+}
+
+func (s *ProviderSlack) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+	req, err := http.NewRequest("GET", urlx.AppendPaths(urlx.ParseOrPanic(s.slackURL), "/api/openid.connect.userInfo").String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	exchange.SetAuthHeader(req)
+
+	var user struct {
+		slackError
+		Claims
+	}
+	if err := fetchJSON(ctx, req, &user); err != nil {
+		return nil, err
+	} else if err := user.err(); err != nil {
+		return nil, err
+	}
+
+	if len(user.Subject) == 0 {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("Slack did not return the subject of the user."))
+	}
+
+	claims := user.Claims
+	claims.Issuer = s.slackURL
+	return &claims, nil
+}
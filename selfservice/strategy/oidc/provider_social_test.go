@@ -0,0 +1,164 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/selfservice/flow/login"
+	"github.com/zzpu/ums/x"
+)
+
+func TestProviderGitLab(t *testing.T) {
+	ts := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/gitlab/oauth/userinfo", r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			writeJSON(t, w, map[string]interface{}{"error": "invalid_token", "error_description": "Token was revoked."})
+			return
+		}
+		writeJSON(t, w, map[string]interface{}{
+			"sub": "1234", "name": "GitLab User", "nickname": "gitlab-user", "email": "user@example.org", "email_verified": true,
+			"profile": "https://gitlab.example.org/gitlab-user", "groups": []string{"ory"},
+		})
+	})
+
+	t.Run("case=defaults to gitlab.com", func(t *testing.T) {
+		p := NewProviderGitLab(&Configuration{ID: "gitlab", Provider: "gitlab", ClientID: "client"}, nonStandardPublic)
+		c, err := p.OAuth2(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "https://gitlab.com/oauth/authorize", c.Endpoint.AuthURL)
+		assert.Equal(t, "https://gitlab.com/oauth/token", c.Endpoint.TokenURL)
+		assert.Equal(t, []string{"openid"}, c.Scopes)
+	})
+
+	p := NewProviderGitLab(&Configuration{ID: "gitlab", Provider: "gitlab", ClientID: "client", IssuerURL: ts.URL + "/gitlab", Scope: []string{"read_user"}}, nonStandardPublic)
+
+	t.Run("case=uses the self-hosted base url", func(t *testing.T) {
+		c, err := p.OAuth2(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, ts.URL+"/gitlab/oauth/authorize", c.Endpoint.AuthURL)
+		assert.Equal(t, ts.URL+"/gitlab/oauth/token", c.Endpoint.TokenURL)
+		assert.Equal(t, []string{"openid", "read_user"}, c.Scopes)
+	})
+
+	t.Run("case=fails with an invalid token", func(t *testing.T) {
+		_, err := p.Claims(context.Background(), &oauth2.Token{AccessToken: "invalid"})
+		require.Error(t, err)
+		assert.Contains(t, errorReason(err), "Token was revoked.")
+	})
+
+	t.Run("case=fetches the userinfo", func(t *testing.T) {
+		claims, err := p.Claims(context.Background(), &oauth2.Token{AccessToken: "token"})
+		require.NoError(t, err)
+		assert.Equal(t, "1234", claims.Subject)
+		assert.Equal(t, ts.URL+"/gitlab", claims.Issuer)
+		assert.Equal(t, "user@example.org", claims.Email)
+		assert.True(t, claims.EmailVerified)
+		assert.Equal(t, "gitlab-user", claims.Nickname)
+	})
+}
+
+func TestProviderDiscord(t *testing.T) {
+	var discriminator string
+	ts := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/users/@me", r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			writeJSON(t, w, map[string]interface{}{"message": "401: Unauthorized", "code": 0})
+			return
+		}
+		writeJSON(t, w, map[string]interface{}{
+			"id": "80351110224678912", "username": "nelly", "discriminator": discriminator, "global_name": "Nelly",
+			"avatar": "8342729096ea3675442027381ff50dfe", "email": "nelly@discord.com", "verified": true, "locale": "en-US",
+		})
+	})
+
+	p := NewProviderDiscord(&Configuration{ID: "discord", Provider: "discord", ClientID: "client"}, nonStandardPublic)
+	p.apiURL = ts.URL
+
+	t.Run("case=skips the consent screen unless forced", func(t *testing.T) {
+		c, err := p.OAuth2(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"identify", "email"}, c.Scopes)
+
+		u := urlx.ParseOrPanic(c.AuthCodeURL("state", p.AuthCodeURLOptions(&login.Flow{ID: x.NewUUID()})...))
+		assert.Equal(t, "none", u.Query().Get("prompt"))
+
+		u = urlx.ParseOrPanic(c.AuthCodeURL("state", p.AuthCodeURLOptions(&login.Flow{ID: x.NewUUID(), Forced: true})...))
+		assert.Equal(t, "consent", u.Query().Get("prompt"))
+	})
+
+	t.Run("case=fails if a scope was not granted", func(t *testing.T) {
+		_, err := p.Claims(context.Background(), (&oauth2.Token{AccessToken: "token"}).WithExtra(map[string]interface{}{"scope": "identify"}))
+		require.Error(t, err)
+		assert.Equal(t, ErrScopeMissing, errors.Cause(err))
+	})
+
+	t.Run("case=fails with an invalid token", func(t *testing.T) {
+		_, err := p.Claims(context.Background(), (&oauth2.Token{AccessToken: "invalid"}).WithExtra(map[string]interface{}{"scope": "identify email"}))
+		require.Error(t, err)
+		assert.Contains(t, errorReason(err), "401: Unauthorized")
+	})
+
+	t.Run("case=fetches the user", func(t *testing.T) {
+		for _, tc := range []struct{ discriminator, username string }{{"0", "nelly"}, {"1337", "nelly#1337"}} {
+			discriminator = tc.discriminator
+			claims, err := p.Claims(context.Background(), (&oauth2.Token{AccessToken: "token"}).WithExtra(map[string]interface{}{"scope": "email identify"}))
+			require.NoError(t, err)
+			assert.Equal(t, "80351110224678912", claims.Subject)
+			assert.Equal(t, "Nelly", claims.Name)
+			assert.Equal(t, tc.username, claims.PreferredUsername)
+			assert.Equal(t, "nelly@discord.com", claims.Email)
+			assert.True(t, claims.EmailVerified)
+			assert.Equal(t, "https://cdn.discordapp.com/avatars/80351110224678912/8342729096ea3675442027381ff50dfe.png", claims.Picture)
+		}
+	})
+}
+
+func TestProviderSlack(t *testing.T) {
+	ts := newProviderServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/openid.connect.userInfo", r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer token" {
+			writeJSON(t, w, map[string]interface{}{"ok": false, "error": "invalid_auth"})
+			return
+		}
+		writeJSON(t, w, map[string]interface{}{
+			"ok": true, "sub": "U0R7JM", "https://slack.com/team_id": "T0R7GR", "email": "krane@slack-corp.com", "email_verified": true,
+			"name": "krane", "given_name": "Bront", "picture": "https://secure.gravatar.com/avatar/bc.png", "locale": "en-US",
+		})
+	})
+
+	p := NewProviderSlack(&Configuration{ID: "slack", Provider: "slack", ClientID: "client"}, nonStandardPublic)
+	p.slackURL = ts.URL
+
+	t.Run("case=requests the openid scope", func(t *testing.T) {
+		c, err := p.OAuth2(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"openid", "email", "profile"}, c.Scopes)
+		assert.Equal(t, ts.URL+"/openid/connect/authorize", c.Endpoint.AuthURL)
+		assert.Equal(t, ts.URL+"/api/openid.connect.token", c.Endpoint.TokenURL)
+	})
+
+	t.Run("case=fails with an invalid token", func(t *testing.T) {
+		_, err := p.Claims(context.Background(), &oauth2.Token{AccessToken: "invalid"})
+		require.Error(t, err)
+		assert.Contains(t, errorReason(err), "invalid_auth")
+	})
+
+	t.Run("case=fetches the userinfo", func(t *testing.T) {
+		claims, err := p.Claims(context.Background(), &oauth2.Token{AccessToken: "token"})
+		require.NoError(t, err)
+		assert.Equal(t, "U0R7JM", claims.Subject)
+		assert.Equal(t, "krane@slack-corp.com", claims.Email)
+		assert.True(t, claims.EmailVerified)
+		assert.Equal(t, "Bront", claims.GivenName)
+	})
+}
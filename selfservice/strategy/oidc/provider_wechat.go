@@ -0,0 +1,194 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/stringslice"
+	"github.com/ory/x/urlx"
+)
+
+var _ NonStandardProvider = new(ProviderWeChat)
+
+// ProviderWeChat implements WeChat Login for websites (QR code login) and, if scope `snsapi_userinfo` or
+// `snsapi_base` is requested, for web pages opened in the WeChat app.
+//
+// The subject is the user's unionid if the application is bound to a WeChat Open Platform account and the
+// openid otherwise.
+type ProviderWeChat struct {
+	config *Configuration
+	public *url.URL
+
+	openURL string
+	apiURL  string
+}
+
+func NewProviderWeChat(
+	config *Configuration,
+	public *url.URL,
+) *ProviderWeChat {
+	return &ProviderWeChat{
+		config:  config,
+		public:  public,
+		openURL: "https://open.weixin.qq.com",
+		apiURL:  "https://api.weixin.qq.com",
+	}
+}
+
+type wechatError struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func (e wechatError) err() error {
+	if e.ErrCode == 0 {
+		return nil
+	}
+	return errors.WithStack(herodot.ErrBadRequest.WithReasonf("WeChat returned error %d: %s", e.ErrCode, e.ErrMsg))
+}
+
+func (g *ProviderWeChat) Config() *Configuration {
+	return g.config
+}
+
+func (g *ProviderWeChat) OAuth2(ctx context.Context) (*oauth2.Config, error) {
+	return &oauth2.Config{
+		ClientID:     g.config.ClientID,
+		ClientSecret: g.config.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  urlx.AppendPaths(urlx.ParseOrPanic(g.openURL), "/connect/qrconnect").String(),
+			TokenURL: urlx.AppendPaths(urlx.ParseOrPanic(g.apiURL), "/sns/oauth2/access_token").String(),
+		},
+		Scopes:      g.scope(),
+		RedirectURL: g.config.Redir(g.public),
+	}, nil
+}
+
+func (g *ProviderWeChat) AuthCodeURLOptions(r ider) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{}
+}
+
+func (g *ProviderWeChat) scope() []string {
+	if len(g.config.Scope) == 0 {
+		return []string{"snsapi_login"}
+	}
+	return g.config.Scope
+}
+
+// inApp is true if the login happens in the WeChat app instead of by scanning a QR code.
+func (g *ProviderWeChat) inApp() bool {
+	return stringslice.Has(g.scope(), "snsapi_userinfo") || stringslice.Has(g.scope(), "snsapi_base")
+}
+
+func (g *ProviderWeChat) AuthCodeURL(state string, _ ider) string {
+	path := "/connect/qrconnect"
+	if g.inApp() {
+		path = "/connect/oauth2/authorize"
+	}
+
+	return urlx.CopyWithQuery(urlx.AppendPaths(urlx.ParseOrPanic(g.openURL), path), url.Values{
+		"appid":         {g.config.ClientID},
+		"redirect_uri":  {g.config.Redir(g.public)},
+		"response_type": {"code"},
+		"scope":         {strings.Join(g.scope(), ",")},
+		"state":         {state},
+	}).String() + "#wechat_redirect"
+}
+
+func (g *ProviderWeChat) CodeParameter() string {
+	return "code"
+}
+
+func (g *ProviderWeChat) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	req, err := http.NewRequest("GET", urlx.CopyWithQuery(urlx.AppendPaths(urlx.ParseOrPanic(g.apiURL), "/sns/oauth2/access_token"), url.Values{
+		"appid":      {g.config.ClientID},
+		"secret":     {g.config.ClientSecret},
+		"code":       {code},
+		"grant_type": {"authorization_code"},
+	}).String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var res struct {
+		wechatError
+		AccessToken  string    `json:"access_token"`
+		ExpiresIn    flexInt64 `json:"expires_in"`
+		RefreshToken string    `json:"refresh_token"`
+		OpenID       string    `json:"openid"`
+		UnionID      string    `json:"unionid"`
+		Scope        string    `json:"scope"`
+	}
+	if err := fetchJSON(ctx, req, &res); err != nil {
+		return nil, err
+	} else if err := res.err(); err != nil {
+		return nil, err
+	}
+
+	return newToken(res.AccessToken, res.RefreshToken, res.ExpiresIn, map[string]interface{}{
+		"openid":  res.OpenID,
+		"unionid": res.UnionID,
+		"scope":   res.Scope,
+	}), nil
+}
+
+func (g *ProviderWeChat) Claims(ctx context.Context, exchange *oauth2.Token) (*Claims, error) {
+	openID, unionID := extraString(exchange, "openid"), extraString(exchange, "unionid")
+	if len(openID) == 0 {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("WeChat did not return the openid of the user."))
+	}
+
+	claims := &Claims{
+		Issuer:  g.openURL,
+		Subject: firstNonEmpty(unionID, openID),
+	}
+
+	// Scope snsapi_base does not grant access to the user's profile.
+	granted := strings.Split(extraString(exchange, "scope"), ",")
+	if stringslice.Has(granted, "snsapi_base") && !stringslice.Has(granted, "snsapi_userinfo") {
+		return claims, nil
+	}
+
+	req, err := http.NewRequest("GET", urlx.CopyWithQuery(urlx.AppendPaths(urlx.ParseOrPanic(g.apiURL), "/sns/userinfo"), url.Values{
+		"access_token": {exchange.AccessToken},
+		"openid":       {openID},
+		"lang":         {"zh_CN"},
+	}).String(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var user struct {
+		wechatError
+		OpenID     string `json:"openid"`
+		UnionID    string `json:"unionid"`
+		Nickname   string `json:"nickname"`
+		Sex        int    `json:"sex"`
+		HeadImgURL string `json:"headimgurl"`
+	}
+	if err := fetchJSON(ctx, req, &user); err != nil {
+		return nil, err
+	} else if err := user.err(); err != nil {
+		return nil, err
+	}
+
+	claims.Subject = firstNonEmpty(unionID, user.UnionID, openID)
+	claims.Name = user.Nickname
+	claims.Nickname = user.Nickname
+	claims.Picture = user.HeadImgURL
+	claims.Locale = "zh_CN"
+	switch user.Sex {
+	case 1:
+		claims.Gender = "male"
+	case 2:
+		claims.Gender = "female"
+	}
+
+	return claims, nil
+}
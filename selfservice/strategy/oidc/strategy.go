@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"net/http"
 	"net/url"
 	"strings"
@@ -22,8 +23,10 @@ import (
 	"github.com/ory/herodot"
 	"github.com/ory/x/urlx"
 
+	"github.com/zzpu/ums/cipher"
 	"github.com/zzpu/ums/continuity"
 	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/hash"
 	"github.com/zzpu/ums/identity"
 	"github.com/zzpu/ums/schema"
 	"github.com/zzpu/ums/selfservice/errorx"
@@ -41,6 +44,8 @@ const (
 
 	RouteAuth     = RouteBase + "/auth/:flow"
 	RouteCallback = RouteBase + "/callback/:provider"
+	RouteContinue = RouteBase + "/continue/:provider"
+	RouteLink     = RouteBase + "/link"
 )
 
 var _ identity.ActiveCredentialsCounter = new(Strategy)
@@ -50,10 +55,18 @@ type dependencies interface {
 
 	x.LoggingProvider
 	x.CookieProvider
+	x.CSRFProvider
 	x.CSRFTokenGeneratorProvider
+	x.WriterProvider
 
 	identity.ValidationProvider
 	identity.PrivilegedPoolProvider
+	identity.ManagementProvider
+
+	hash.HashProvider
+	cipher.Provider
+
+	ProviderPersistenceProvider
 
 	session.ManagementProvider
 	session.HandlerProvider
@@ -98,9 +111,11 @@ type Strategy struct {
 }
 
 type authCodeContainer struct {
-	FlowID string     `json:"flow_id"`
-	State  string     `json:"state"`
-	Form   url.Values `json:"form"`
+	FlowID       string     `json:"flow_id"`
+	State        string     `json:"state"`
+	Form         url.Values `json:"form"`
+	CodeVerifier string     `json:"code_verifier,omitempty"`
+	Nonce        string     `json:"nonce,omitempty"`
 }
 
 func (s *Strategy) CountActiveCredentials(cc map[identity.CredentialsType]identity.Credentials) (count int, err error) {
@@ -133,6 +148,18 @@ func (s *Strategy) setRoutes(r *x.RouterPublic) {
 		r.GET(RouteCallback, s.handleCallback)
 	}
 
+	if handle, _, _ := r.Lookup("POST", RouteCallback); handle == nil {
+		// Providers using response_mode=form_post can not include a CSRF token.
+		s.d.CSRFHandler().ExemptGlob(strings.Replace(RouteCallback, ":provider", "*", 1))
+		r.POST(RouteCallback, s.handleCallbackFormPost)
+	}
+
+	if handle, _, _ := r.Lookup("POST", RouteContinue); handle == nil {
+		// The request is protected by the state parameter which must match the continuity cookie.
+		s.d.CSRFHandler().ExemptGlob(strings.Replace(RouteContinue, ":provider", "*", 1))
+		r.POST(RouteContinue, s.handleContinue)
+	}
+
 	if handle, _, _ := r.Lookup("POST", RouteAuth); handle == nil {
 		r.POST(RouteAuth, s.handleAuth)
 	}
@@ -140,6 +167,10 @@ func (s *Strategy) setRoutes(r *x.RouterPublic) {
 	if handle, _, _ := r.Lookup("GET", RouteAuth); handle == nil {
 		r.GET(RouteAuth, s.handleAuth)
 	}
+
+	if handle, _, _ := r.Lookup("POST", RouteLink); handle == nil {
+		r.POST(RouteLink, s.handleLink)
+	}
 }
 
 func NewStrategy(
@@ -171,7 +202,7 @@ func (s *Strategy) handleAuth(w http.ResponseWriter, r *http.Request, ps httprou
 		return
 	}
 
-	provider, err := s.provider(pid)
+	provider, err := s.provider(r.Context(), pid)
 	if err != nil {
 		s.handleError(w, r, rid, pid, nil, err)
 		return
@@ -194,18 +225,21 @@ func (s *Strategy) handleAuth(w http.ResponseWriter, r *http.Request, ps httprou
 	}
 
 	state := x.NewUUID().String()
+	container := &authCodeContainer{
+		State:  state,
+		FlowID: rid.String(),
+		Form:   r.PostForm,
+	}
+	opts := container.bind(provider.Config())
+
 	if err := s.d.ContinuityManager().Pause(r.Context(), w, r, sessionName,
-		continuity.WithPayload(&authCodeContainer{
-			State:  state,
-			FlowID: rid.String(),
-			Form:   r.PostForm,
-		}),
+		continuity.WithPayload(container),
 		continuity.WithLifespan(time.Minute*30)); err != nil {
 		s.handleError(w, r, rid, pid, nil, err)
 		return
 	}
 
-	http.Redirect(w, r, config.AuthCodeURL(state, provider.AuthCodeURLOptions(req)...), http.StatusFound)
+	http.Redirect(w, r, authCodeURL(provider, config, state, req, opts...), http.StatusFound)
 }
 
 func (s *Strategy) validateFlow(ctx context.Context, r *http.Request, rid uuid.UUID) (ider, error) {
@@ -255,11 +289,8 @@ func (s *Strategy) validateFlow(ctx context.Context, r *http.Request, rid uuid.U
 	return ar, err // this must return the error
 }
 
-func (s *Strategy) validateCallback(w http.ResponseWriter, r *http.Request) (ider, *authCodeContainer, error) {
-	var (
-		code  = r.URL.Query().Get("code")
-		state = r.URL.Query().Get("state")
-	)
+func (s *Strategy) validateCallback(w http.ResponseWriter, r *http.Request, query url.Values) (ider, *authCodeContainer, error) {
+	var state = query.Get("state")
 
 	if state == "" {
 		return nil, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete OpenID Connect flow because the OpenID Provider did not return the state query parameter.`))
@@ -279,12 +310,8 @@ func (s *Strategy) validateCallback(w http.ResponseWriter, r *http.Request) (ide
 		return nil, &container, err
 	}
 
-	if r.URL.Query().Get("error") != "" {
-		return req, &container, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete OpenID Connect flow because the OpenID Provider returned error "%s": %s`, r.URL.Query().Get("error"), r.URL.Query().Get("error_description")))
-	}
-
-	if code == "" {
-		return req, &container, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete OpenID Connect flow because the OpenID Provider did not return the code query parameter.`))
+	if query.Get("error") != "" {
+		return req, &container, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete OpenID Connect flow because the OpenID Provider returned error "%s": %s`, query.Get("error"), query.Get("error_description")))
 	}
 
 	return req, &container, nil
@@ -304,13 +331,56 @@ func (s *Strategy) alreadyAuthenticated(w http.ResponseWriter, r *http.Request,
 	return false
 }
 
+var continueTemplate = template.Must(template.New("continue").Parse(`<!DOCTYPE html>
+<html>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{ .Action }}">
+{{- range $name, $values := .Fields }}{{ range $values }}
+<input type="hidden" name="{{ $name }}" value="{{ . }}" />
+{{- end }}{{ end }}
+<noscript><input type="submit" value="Continue" /></noscript>
+</form>
+</body>
+</html>`))
+
+// handleCallbackFormPost receives callbacks which are posted by the provider (response_mode=form_post), such as
+// Sign in with Apple. Because this is a cross-site request, browsers do not send the SameSite=Lax continuity cookie.
+// The parameters are therefore posted again from a page served by ORY Kratos to RouteContinue, where the cookie is
+// available. They are not added to a redirect URL because they would end up in logs and the browser history.
+func (s *Strategy) handleCallbackFormPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var pid = ps.ByName("provider")
+	if err := r.ParseForm(); err != nil {
+		s.handleError(w, r, x.EmptyUUID, pid, nil, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := continueTemplate.Execute(w, map[string]interface{}{
+		"Action": urlx.AppendPaths(s.c.SelfPublicURL(), strings.Replace(RouteContinue, ":provider", pid, 1)).String(),
+		"Fields": r.PostForm,
+	}); err != nil {
+		s.d.Logger().WithError(err).Error("Unable to render the OpenID Connect callback form.")
+	}
+}
+
+func (s *Strategy) handleContinue(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var pid = ps.ByName("provider")
+	if err := r.ParseForm(); err != nil {
+		s.handleError(w, r, x.EmptyUUID, pid, nil, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	s.callback(w, r, pid, r.PostForm)
+}
+
 func (s *Strategy) handleCallback(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	var (
-		code = r.URL.Query().Get("code")
-		pid  = ps.ByName("provider")
-	)
+	s.callback(w, r, ps.ByName("provider"), r.URL.Query())
+}
 
-	req, container, err := s.validateCallback(w, r)
+// callback completes the flow with the parameters the provider sent to the callback.
+func (s *Strategy) callback(w http.ResponseWriter, r *http.Request, pid string, query url.Values) {
+	req, container, err := s.validateCallback(w, r, query)
 	if err != nil {
 		if req != nil {
 			s.handleError(w, r, req.GetID(), pid, nil, err)
@@ -324,19 +394,31 @@ func (s *Strategy) handleCallback(w http.ResponseWriter, r *http.Request, ps htt
 		return
 	}
 
-	provider, err := s.provider(pid)
+	provider, err := s.provider(r.Context(), pid)
 	if err != nil {
 		s.handleError(w, r, req.GetID(), pid, nil, err)
 		return
 	}
 
+	code := query.Get(codeParameter(provider))
+	if code == "" {
+		s.handleError(w, r, req.GetID(), pid, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete OpenID Connect flow because the OpenID Provider did not return the %s query parameter.`, codeParameter(provider))))
+		return
+	}
+
 	config, err := provider.OAuth2(context.Background())
 	if err != nil {
 		s.handleError(w, r, req.GetID(), pid, nil, err)
 		return
 	}
 
-	token, err := config.Exchange(r.Context(), code)
+	ctx, err := tokenRequestContext(r.Context(), provider, config)
+	if err != nil {
+		s.handleError(w, r, req.GetID(), pid, nil, err)
+		return
+	}
+
+	token, err := exchange(ctx, provider, config, code, container.exchangeOptions()...)
 	if err != nil {
 		s.handleError(w, r, req.GetID(), pid, nil, err)
 		return
@@ -348,12 +430,18 @@ func (s *Strategy) handleCallback(w http.ResponseWriter, r *http.Request, ps htt
 		return
 	}
 
+	if err := container.verifyNonce(claims); err != nil {
+		s.handleError(w, r, req.GetID(), pid, nil, err)
+		return
+	}
+	decodeQuery(provider, query, claims)
+
 	switch a := req.(type) {
 	case *login.Flow:
-		s.processLogin(w, r, a, claims, provider, container)
+		s.processLogin(w, r, a, token, claims, provider, container)
 		return
 	case *registration.Flow:
-		s.processRegistration(w, r, a, claims, provider, container)
+		s.processRegistration(w, r, a, token, claims, provider, container)
 		return
 	case *settings.Flow:
 		sess, err := s.d.SessionManager().FetchFromRequest(r.Context(), r)
@@ -361,7 +449,7 @@ func (s *Strategy) handleCallback(w http.ResponseWriter, r *http.Request, ps htt
 			s.handleError(w, r, req.GetID(), pid, nil, err)
 			return
 		}
-		s.linkProvider(w, r, &settings.UpdateContext{Session: sess, Flow: a}, claims, provider)
+		s.linkProvider(w, r, &settings.UpdateContext{Session: sess, Flow: a}, token, claims, provider)
 		return
 	default:
 		s.handleError(w, r, req.GetID(), pid, nil, errors.WithStack(x.PseudoPanic.
@@ -384,7 +472,7 @@ func (s *Strategy) authURL(flowID uuid.UUID) string {
 }
 
 func (s *Strategy) populateMethod(r *http.Request, flowID uuid.UUID) (*FlowMethod, error) {
-	conf, err := s.Config()
+	conf, err := s.providers(r.Context())
 	if err != nil {
 		return nil, err
 	}
@@ -397,7 +485,7 @@ func (s *Strategy) populateMethod(r *http.Request, flowID uuid.UUID) (*FlowMetho
 }
 
 func (s *Strategy) Config() (*ConfigurationCollection, error) {
-	var c ConfigurationCollection
+	c := ConfigurationCollection{AccountLinking: AccountLinkingConfiguration{MaxAttempts: 5}}
 
 	config := s.c.SelfServiceStrategy(string(s.ID())).Config
 	if err := jsonx.
@@ -410,8 +498,8 @@ func (s *Strategy) Config() (*ConfigurationCollection, error) {
 	return &c, nil
 }
 
-func (s *Strategy) provider(id string) (Provider, error) {
-	if c, err := s.Config(); err != nil {
+func (s *Strategy) provider(ctx context.Context, id string) (Provider, error) {
+	if c, err := s.providers(ctx); err != nil {
 		return nil, err
 	} else if provider, err := c.Provider(id, s.c.SelfPublicURL()); err != nil {
 		return nil, err
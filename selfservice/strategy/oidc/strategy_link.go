@@ -0,0 +1,326 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/continuity"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/schema"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/login"
+	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/selfservice/strategy/password"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+// linkContainer remembers the OpenID Connect credentials while the user proves ownership of the existing identity.
+type linkContainer struct {
+	FlowID      string                    `json:"flow_id"`
+	IdentityID  uuid.UUID                 `json:"identity_id"`
+	Identifier  string                    `json:"identifier"`
+	Credentials ProviderCredentialsConfig `json:"credentials"`
+
+	// Attempts is the number of wrong passwords which were entered.
+	Attempts int `json:"attempts"`
+}
+
+// passwordLockout is implemented by the password strategy which delays and locks logins after too many wrong
+// passwords. Linking uses it so that the password can not be guessed here instead of at the password login.
+type passwordLockout interface {
+	CheckLoginAttempt(r *http.Request, identifier string) error
+	RecordFailedLoginAttempt(r *http.Request, identifier string) error
+	ResetFailedLoginAttempts(r *http.Request, identifier string) error
+}
+
+func (s *Strategy) passwordLockout() passwordLockout {
+	for _, ls := range s.d.LoginStrategies() {
+		if pl, ok := ls.(passwordLockout); ok {
+			return pl
+		}
+	}
+	return nil
+}
+
+// linkableIdentity returns the identity whose password credentials use one of the identifiers of the given
+// identity, or nil if there is none.
+func (s *Strategy) linkableIdentity(ctx context.Context, i *identity.Identity) (*identity.Identity, string, error) {
+	creds, ok := i.GetCredentials(identity.CredentialsTypePassword)
+	if !ok {
+		return nil, "", nil
+	}
+
+	for _, identifier := range creds.Identifiers {
+		existing, c, err := s.d.PrivilegedIdentityPool().FindByCredentialsIdentifier(ctx, identity.CredentialsTypePassword, identifier)
+		if errors.Is(err, herodot.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, "", err
+		}
+
+		var o password.CredentialsConfig
+		if err := json.Unmarshal(c.Config, &o); err != nil {
+			return nil, "", errors.WithStack(herodot.ErrInternalServerError.WithReason("The password credentials could not be decoded properly").WithDebug(err.Error()))
+		}
+
+		// Identities without a password, for example those created by another OpenID Connect provider, can
+		// not prove ownership and are therefore never linked.
+		if len(o.HashedPassword) == 0 {
+			continue
+		}
+
+		return existing, identifier, nil
+	}
+
+	return nil, "", nil
+}
+
+// linkExistingIdentity links the OpenID Connect credentials to an existing password identity with the same
+// identifier if account linking is enabled. It returns false if there is no identity to link to.
+func (s *Strategy) linkExistingIdentity(w http.ResponseWriter, r *http.Request, provider *Configuration, i *identity.Identity, claims *Claims, pc ProviderCredentialsConfig) (bool, error) {
+	conf, err := s.Config()
+	if err != nil {
+		return false, err
+	} else if !conf.AccountLinking.Enabled {
+		return false, nil
+	}
+
+	existing, identifier, err := s.linkableIdentity(r.Context(), i)
+	if err != nil || existing == nil {
+		return false, err
+	}
+
+	// Linking signs the user in to the existing identity which is why it continues as a login flow.
+	ar, err := s.d.LoginHandler().NewLoginFlow(w, r, flow.TypeBrowser)
+	if err != nil {
+		return false, err
+	}
+
+	if provider.TrustVerifiedEmail && claims.EmailVerified && strings.EqualFold(claims.Email, identifier) {
+		s.d.Logger().WithRequest(r).WithField("provider", pc.Provider).
+			WithField("subject", claims.Subject).
+			Debug("OpenID Connect Provider verified the email address of an existing identity. Linking the credentials without asking for its password.")
+
+		confidential, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), existing.ID)
+		if err != nil {
+			return false, err
+		}
+
+		return true, s.linkIdentity(w, r, ar, confidential, pc)
+	}
+
+	if err := s.d.ContinuityManager().Pause(r.Context(), w, r, linkSessionName,
+		continuity.WithPayload(&linkContainer{
+			FlowID:      ar.ID.String(),
+			IdentityID:  existing.ID,
+			Identifier:  identifier,
+			Credentials: pc,
+		}),
+		continuity.WithLifespan(time.Until(ar.ExpiresAt))); err != nil {
+		return false, err
+	}
+
+	f := &form.HTMLForm{
+		Action: ar.AppendTo(urlx.AppendPaths(s.c.SelfPublicURL(), RouteLink)).String(),
+		Method: "POST",
+		Fields: form.Fields{{
+			Name:     "identifier",
+			Type:     "text",
+			Value:    identifier,
+			Disabled: true,
+		}, {
+			Name:     "password",
+			Type:     "password",
+			Required: true,
+		}}}
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+
+	// The user may only complete the flow by linking the accounts.
+	ar.Methods = map[identity.CredentialsType]*login.FlowMethod{
+		s.ID(): {Method: s.ID(), Config: &login.FlowMethodConfig{FlowMethodConfigurator: NewFlowMethod(f)}},
+	}
+	ar.Messages.Clear()
+	ar.Messages.Add(text.NewInfoSelfServiceLoginLinkAccount(identifier, pc.Provider))
+	if err := s.d.LoginFlowPersister().UpdateLoginFlow(r.Context(), ar); err != nil {
+		return false, err
+	}
+
+	http.Redirect(w, r, ar.AppendTo(s.c.SelfServiceFlowLoginUI()).String(), http.StatusFound)
+	return true, nil
+}
+
+func (s *Strategy) handleLink(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ar, err := s.d.LoginFlowPersister().GetLoginFlow(r.Context(), x.ParseUUID(r.URL.Query().Get("flow")))
+	if err != nil {
+		s.handleError(w, r, x.EmptyUUID, "", nil, err)
+		return
+	}
+
+	if err := ar.Valid(); err != nil {
+		s.handleError(w, r, ar.ID, "", nil, err)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.handleError(w, r, ar.ID, "", nil, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	var container linkContainer
+	if _, err := s.d.ContinuityManager().Continue(r.Context(), w, r, linkSessionName, continuity.WithPayload(&container)); err != nil {
+		s.handleError(w, r, ar.ID, "", nil, err)
+		return
+	}
+
+	if container.FlowID != ar.ID.String() {
+		s.handleError(w, r, ar.ID, container.Credentials.Provider, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to link the OpenID Connect credentials because the login flow does not match the flow from the session cookie.`)))
+		return
+	}
+
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), container.IdentityID)
+	if err != nil {
+		s.handleError(w, r, ar.ID, container.Credentials.Provider, nil, err)
+		return
+	}
+
+	var o password.CredentialsConfig
+	if _, err := i.ParseCredentials(identity.CredentialsTypePassword, &o); err != nil {
+		s.handleError(w, r, ar.ID, container.Credentials.Provider, nil, err)
+		return
+	}
+
+	conf, err := s.Config()
+	if err != nil {
+		s.handleError(w, r, ar.ID, container.Credentials.Provider, nil, err)
+		return
+	}
+
+	lockout := s.passwordLockout()
+	if lockout != nil {
+		if err := lockout.CheckLoginAttempt(r, container.Identifier); err != nil {
+			s.pauseLink(w, r, ar, &container, err)
+			return
+		}
+	}
+
+	if err := s.d.Hasher().Compare([]byte(r.PostForm.Get("password")), []byte(o.HashedPassword)); err != nil {
+		if lockout != nil {
+			if err := lockout.RecordFailedLoginAttempt(r, container.Identifier); err != nil {
+				s.handleError(w, r, ar.ID, container.Credentials.Provider, nil, err)
+				return
+			}
+		}
+
+		container.Attempts++
+		if container.Attempts >= conf.AccountLinking.MaxAttempts {
+			s.d.Audit().
+				WithRequest(r).
+				WithField("identity_id", container.IdentityID).
+				WithField("provider", container.Credentials.Provider).
+				Info("Stopped linking OpenID Connect credentials because too many wrong passwords were entered.")
+			s.handleError(w, r, ar.ID, container.Credentials.Provider, nil, errors.WithStack(herodot.ErrForbidden.
+				WithReason("Too many wrong passwords were entered. Please sign in with your password and link the account in your settings instead.")))
+			return
+		}
+
+		s.pauseLink(w, r, ar, &container, errors.WithStack(schema.NewInvalidCredentialsError()))
+		return
+	}
+
+	if lockout != nil {
+		if err := lockout.ResetFailedLoginAttempts(r, container.Identifier); err != nil {
+			s.handleError(w, r, ar.ID, container.Credentials.Provider, nil, err)
+			return
+		}
+	}
+
+	if err := s.linkIdentity(w, r, ar, i, container.Credentials); err != nil {
+		s.handleError(w, r, ar.ID, container.Credentials.Provider, nil, err)
+		return
+	}
+}
+
+// pauseLink allows another attempt for as long as the login flow is valid and responds with the error.
+func (s *Strategy) pauseLink(w http.ResponseWriter, r *http.Request, ar *login.Flow, container *linkContainer, err error) {
+	if err := s.d.ContinuityManager().Pause(r.Context(), w, r, linkSessionName,
+		continuity.WithPayload(container),
+		continuity.WithLifespan(time.Until(ar.ExpiresAt))); err != nil {
+		s.handleError(w, r, ar.ID, container.Credentials.Provider, nil, err)
+		return
+	}
+
+	s.handleLinkError(w, r, ar, err)
+}
+
+func (s *Strategy) handleLinkError(w http.ResponseWriter, r *http.Request, ar *login.Flow, err error) {
+	if method, ok := ar.Methods[s.ID()]; ok {
+		method.Config.Reset("identifier")
+		method.Config.SetCSRF(s.d.GenerateCSRFToken(r))
+		ar.Methods[s.ID()] = method
+	}
+
+	s.d.LoginFlowErrorHandler().WriteFlowError(w, r, s.ID(), ar, err)
+}
+
+// linkIdentity adds the OpenID Connect credentials to the identity and signs it in.
+func (s *Strategy) linkIdentity(w http.ResponseWriter, r *http.Request, ar *login.Flow, i *identity.Identity, pc ProviderCredentialsConfig) error {
+	if err := s.addProviderCredentials(i, pc); err != nil {
+		return err
+	}
+
+	if err := s.d.IdentityManager().Update(r.Context(), i, identity.ManagerAllowWriteProtectedTraits); err != nil {
+		return err
+	}
+
+	s.d.Audit().
+		WithRequest(r).
+		WithField("identity_id", i.ID).
+		WithField("provider", pc.Provider).
+		Info("Linked OpenID Connect credentials to an existing identity.")
+
+	return s.d.LoginHookExecutor().PostLoginHook(w, r, s.ID(), ar, i)
+}
+
+// addProviderCredentials adds the provider credentials to the identity's OpenID Connect credentials, or replaces
+// the tokens if the identity has these credentials already.
+func (s *Strategy) addProviderCredentials(i *identity.Identity, pc ProviderCredentialsConfig) error {
+	var conf CredentialsConfig
+	creds, err := i.ParseCredentials(s.ID(), &conf)
+	if errors.Is(err, herodot.ErrNotFound) {
+		creds = &identity.Credentials{Type: s.ID()}
+	} else if err != nil {
+		return err
+	}
+
+	var found bool
+	for k, c := range conf.Providers {
+		if c.Provider == pc.Provider && c.Subject == pc.Subject {
+			conf.Providers[k] = pc
+			found = true
+		}
+	}
+
+	if !found {
+		creds.Identifiers = append(creds.Identifiers, uid(pc.Provider, pc.Subject))
+		conf.Providers = append(conf.Providers, pc)
+	}
+
+	creds.Config, err = json.Marshal(conf)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	i.SetCredentials(s.ID(), *creds)
+	return nil
+}
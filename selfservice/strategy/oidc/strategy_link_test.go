@@ -0,0 +1,278 @@
+package oidc_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/sqlxx"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/strategy/oidc"
+	"github.com/zzpu/ums/text"
+)
+
+func TestAccountLinking(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+
+	p := newFakeProvider(t, "client")
+	var setLinking = func(linking oidc.AccountLinkingConfiguration, trustVerifiedEmail bool) {
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypeOIDC),
+			map[string]interface{}{"enabled": true, "config": &oidc.ConfigurationCollection{
+				Providers: []oidc.Configuration{{
+					ID:           "fake",
+					Provider:     "generic",
+					ClientID:     "client",
+					ClientSecret: "secret",
+					IssuerURL:    p.URL,
+					Mapper:       "file://./stub/oidc.email.jsonnet",
+
+					TrustVerifiedEmail: trustVerifiedEmail,
+				}},
+				AccountLinking: linking,
+			}})
+	}
+	setLinking(oidc.AccountLinkingConfiguration{}, false)
+	var setPasswordLockout = func(lockout map[string]interface{}) {
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypePassword),
+			map[string]interface{}{"enabled": true, "config": map[string]interface{}{"lockout": lockout}})
+	}
+	setPasswordLockout(map[string]interface{}{})
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/registration.schema.json")
+	viper.Set(configuration.HookStrategyKey(configuration.ViperKeySelfServiceRegistrationAfter,
+		identity.CredentialsTypeOIDC.String()), []configuration.SelfServiceHook{{Name: "session"}})
+
+	ts, _ := testhelpers.NewKratosServer(t, reg)
+	loginUI := testhelpers.NewLoginUIFlowEchoServer(t, reg)
+	registrationUI := testhelpers.NewRegistrationUIFlowEchoServer(t, reg)
+	returnTS := testhelpers.NewRedirSessionEchoTS(t, reg)
+	errTS := testhelpers.NewErrorTestServer(t, reg)
+
+	var newPasswordIdentity = func(t *testing.T, email, password string) *identity.Identity {
+		var config []byte
+		if password != "" {
+			hashed, err := reg.Hasher().Generate([]byte(password))
+			require.NoError(t, err)
+			config = []byte(fmt.Sprintf(`{"hashed_password":"%s"}`, hashed))
+		}
+
+		i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+		i.Traits = identity.Traits(`{"subject":"` + email + `"}`)
+		i.SetCredentials(identity.CredentialsTypePassword, identity.Credentials{
+			Type:        identity.CredentialsTypePassword,
+			Identifiers: []string{email},
+			Config:      sqlxx.JSONRawMessage(config),
+		})
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+		return i
+	}
+
+	var signUp = func(t *testing.T, c *http.Client) (*http.Response, []byte) {
+		f, err := reg.RegistrationHandler().NewRegistrationFlow(httptest.NewRecorder(),
+			&http.Request{URL: urlx.ParseOrPanic(returnTS.URL)}, flow.TypeBrowser)
+		require.NoError(t, err)
+
+		res, err := c.PostForm(ts.URL+strings.Replace(oidc.RouteAuth, ":flow", f.ID.String(), 1), url.Values{"provider": {"fake"}})
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+
+	var submitPassword = func(t *testing.T, c *http.Client, loginFlow []byte, password string) (*http.Response, []byte) {
+		res, err := c.PostForm(gjson.GetBytes(loginFlow, "methods.oidc.config.action").String(), url.Values{
+			"csrf_token": {gjson.GetBytes(loginFlow, "methods.oidc.config.fields.#(name==csrf_token).value").String()},
+			"password":   {password},
+		})
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+
+	// assert the identity is signed in
+	var ai = func(t *testing.T, res *http.Response, body []byte, id uuid.UUID) {
+		require.Contains(t, res.Request.URL.String(), returnTS.URL, "%s", body)
+		assert.Equal(t, id.String(), gjson.GetBytes(body, "identity.id").String(), "%s", body)
+	}
+
+	// assert that the user is asked for the password of the existing identity
+	var aLinkForm = func(t *testing.T, res *http.Response, body []byte, email string) {
+		require.Contains(t, res.Request.URL.String(), loginUI.URL, "%s", body)
+		assert.EqualValues(t, text.InfoSelfServiceLoginLinkAccount, gjson.GetBytes(body, "messages.0.id").Int(), "%s", body)
+		assert.Equal(t, email, gjson.GetBytes(body, "methods.oidc.config.fields.#(name==identifier).value").String(), "%s", body)
+		assert.Contains(t, gjson.GetBytes(body, "methods.oidc.config.action").String(), ts.URL+oidc.RouteLink, "%s", body)
+		assert.False(t, gjson.GetBytes(body, "methods.password").Exists(), "%s", body)
+	}
+
+	var assertLinked = func(t *testing.T, id uuid.UUID, subject string) {
+		i, c, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeOIDC, "fake:"+subject)
+		require.NoError(t, err)
+		assert.Equal(t, id, i.ID)
+		assert.Equal(t, []string{"fake:" + subject}, c.Identifiers)
+	}
+
+	t.Run("case=should fail with a duplicate identifier if linking is disabled", func(t *testing.T) {
+		setLinking(oidc.AccountLinkingConfiguration{}, false)
+		email := "linking-disabled@ory.sh"
+		newPasswordIdentity(t, email, "password")
+		p.claims = map[string]interface{}{"sub": "linking-disabled", "email": email}
+
+		res, body := signUp(t, testhelpers.NewClientWithCookies(t))
+		require.Contains(t, res.Request.URL.String(), registrationUI.URL, "%s", body)
+		assert.Contains(t, gjson.GetBytes(body, "methods.oidc.config.messages.0.text").String(), "An account with the same identifier (email, phone, username, ...) exists already.", "%s", body)
+	})
+
+	t.Run("case=should link after proving ownership with the password", func(t *testing.T) {
+		setLinking(oidc.AccountLinkingConfiguration{Enabled: true}, false)
+		email := "link-with-password@ory.sh"
+		existing := newPasswordIdentity(t, email, "password")
+		p.claims = map[string]interface{}{"sub": "link-with-password", "email": email}
+
+		c := testhelpers.NewClientWithCookies(t)
+		res, loginFlow := signUp(t, c)
+		aLinkForm(t, res, loginFlow, email)
+
+		t.Run("case=should reject the wrong password", func(t *testing.T) {
+			res, body := submitPassword(t, c, loginFlow, "not-the-password")
+			require.Contains(t, res.Request.URL.String(), loginUI.URL, "%s", body)
+			assert.Contains(t, gjson.GetBytes(body, "methods.oidc.config.messages.0.text").String(), "credentials are invalid", "%s", body)
+			assert.Equal(t, email, gjson.GetBytes(body, "methods.oidc.config.fields.#(name==identifier).value").String(), "%s", body)
+
+			_, _, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeOIDC, "fake:link-with-password")
+			require.Error(t, err)
+		})
+
+		t.Run("case=should link with the right password", func(t *testing.T) {
+			res, body := submitPassword(t, c, loginFlow, "password")
+			ai(t, res, body, existing.ID)
+			assertLinked(t, existing.ID, "link-with-password")
+		})
+
+		t.Run("case=should sign in with the provider afterwards", func(t *testing.T) {
+			res, body := signUp(t, testhelpers.NewClientWithCookies(t))
+			ai(t, res, body, existing.ID)
+		})
+	})
+
+	t.Run("case=should not accept a link session from another browser", func(t *testing.T) {
+		setLinking(oidc.AccountLinkingConfiguration{Enabled: true}, false)
+		email := "link-other-browser@ory.sh"
+		newPasswordIdentity(t, email, "password")
+		p.claims = map[string]interface{}{"sub": "link-other-browser", "email": email}
+
+		res, loginFlow := signUp(t, testhelpers.NewClientWithCookies(t))
+		aLinkForm(t, res, loginFlow, email)
+
+		res, body := submitPassword(t, testhelpers.NewClientWithCookies(t), loginFlow, "password")
+		require.Contains(t, res.Request.URL.String(), loginUI.URL, "%s", body)
+		assert.Contains(t, gjson.GetBytes(body, "methods.oidc.config.messages.0.text").String(), "No resumable session could be found", "%s", body)
+	})
+
+	t.Run("case=should link without password if the provider verified the email address", func(t *testing.T) {
+		setLinking(oidc.AccountLinkingConfiguration{Enabled: true}, true)
+		email := "link-verified@ory.sh"
+		existing := newPasswordIdentity(t, email, "password")
+		p.claims = map[string]interface{}{"sub": "link-verified", "email": email, "email_verified": true}
+
+		res, body := signUp(t, testhelpers.NewClientWithCookies(t))
+		ai(t, res, body, existing.ID)
+		assertLinked(t, existing.ID, "link-verified")
+	})
+
+	t.Run("case=should ask for the password if the provider is not trusted to verify email addresses", func(t *testing.T) {
+		setLinking(oidc.AccountLinkingConfiguration{Enabled: true}, false)
+		email := "link-verified-untrusted@ory.sh"
+		newPasswordIdentity(t, email, "password")
+		p.claims = map[string]interface{}{"sub": "link-verified-untrusted", "email": email, "email_verified": true}
+
+		res, body := signUp(t, testhelpers.NewClientWithCookies(t))
+		aLinkForm(t, res, body, email)
+	})
+
+	t.Run("case=should stop linking after too many wrong passwords", func(t *testing.T) {
+		setLinking(oidc.AccountLinkingConfiguration{Enabled: true, MaxAttempts: 2}, false)
+		email := "link-too-many-attempts@ory.sh"
+		newPasswordIdentity(t, email, "password")
+		p.claims = map[string]interface{}{"sub": "link-too-many-attempts", "email": email}
+
+		c := testhelpers.NewClientWithCookies(t)
+		res, loginFlow := signUp(t, c)
+		aLinkForm(t, res, loginFlow, email)
+
+		res, body := submitPassword(t, c, loginFlow, "not-the-password")
+		assert.Contains(t, gjson.GetBytes(body, "methods.oidc.config.messages.0.text").String(), "credentials are invalid", "%s", body)
+
+		res, body = submitPassword(t, c, loginFlow, "still-not-the-password")
+		require.Contains(t, res.Request.URL.String(), errTS.URL, "%s", body)
+		assert.Contains(t, string(body), "Too many wrong passwords were entered", "%s", body)
+
+		_, body = submitPassword(t, c, loginFlow, "password")
+		assert.Contains(t, string(body), "No resumable session could be found", "%s", body)
+		_, _, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeOIDC, "fake:link-too-many-attempts")
+		require.Error(t, err)
+	})
+
+	t.Run("case=should respect the password lockout", func(t *testing.T) {
+		setLinking(oidc.AccountLinkingConfiguration{Enabled: true}, false)
+		setPasswordLockout(map[string]interface{}{"enabled": true, "max_attempts": 1})
+		t.Cleanup(func() {
+			setPasswordLockout(map[string]interface{}{})
+		})
+
+		email := "link-locked@ory.sh"
+		newPasswordIdentity(t, email, "password")
+		p.claims = map[string]interface{}{"sub": "link-locked", "email": email}
+
+		c := testhelpers.NewClientWithCookies(t)
+		res, loginFlow := signUp(t, c)
+		aLinkForm(t, res, loginFlow, email)
+
+		_, body := submitPassword(t, c, loginFlow, "not-the-password")
+		assert.Contains(t, gjson.GetBytes(body, "methods.oidc.config.messages.0.text").String(), "credentials are invalid", "%s", body)
+
+		_, body = submitPassword(t, c, loginFlow, "password")
+		assert.EqualValues(t, text.ErrorValidationLoginLocked, gjson.GetBytes(body, "methods.oidc.config.messages.0.id").Int(), "%s", body)
+		_, _, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeOIDC, "fake:link-locked")
+		require.Error(t, err)
+	})
+
+	t.Run("case=should ask for the password if the email address is not verified", func(t *testing.T) {
+		setLinking(oidc.AccountLinkingConfiguration{Enabled: true}, true)
+		email := "link-unverified@ory.sh"
+		newPasswordIdentity(t, email, "password")
+		p.claims = map[string]interface{}{"sub": "link-unverified", "email": email, "email_verified": false}
+
+		res, body := signUp(t, testhelpers.NewClientWithCookies(t))
+		aLinkForm(t, res, body, email)
+	})
+
+	t.Run("case=should not link identities without a password", func(t *testing.T) {
+		setLinking(oidc.AccountLinkingConfiguration{Enabled: true}, true)
+		email := "link-no-password@ory.sh"
+		newPasswordIdentity(t, email, "")
+		p.claims = map[string]interface{}{"sub": "link-no-password", "email": email, "email_verified": true}
+
+		res, body := signUp(t, testhelpers.NewClientWithCookies(t))
+		require.Contains(t, res.Request.URL.String(), registrationUI.URL, "%s", body)
+		assert.Contains(t, gjson.GetBytes(body, "methods.oidc.config.messages.0.text").String(), "An account with the same identifier (email, phone, username, ...) exists already.", "%s", body)
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
 
 	"github.com/ory/herodot"
 
@@ -35,7 +36,7 @@ func (s *Strategy) PopulateLoginMethod(r *http.Request, sr *login.Flow) error {
 	return nil
 }
 
-func (s *Strategy) processLogin(w http.ResponseWriter, r *http.Request, a *login.Flow, claims *Claims, provider Provider, container *authCodeContainer) {
+func (s *Strategy) processLogin(w http.ResponseWriter, r *http.Request, a *login.Flow, token *oauth2.Token, claims *Claims, provider Provider, container *authCodeContainer) {
 	i, c, err := s.d.PrivilegedIdentityPool().FindByCredentialsIdentifier(r.Context(), identity.CredentialsTypeOIDC, uid(provider.Config().ID, claims.Subject))
 	if err != nil {
 		if errors.Is(err, herodot.ErrNotFound) {
@@ -59,7 +60,7 @@ func (s *Strategy) processLogin(w http.ResponseWriter, r *http.Request, a *login
 				return
 			}
 
-			s.processRegistration(w, r, aa, claims, provider, container)
+			s.processRegistration(w, r, aa, token, claims, provider, container)
 			return
 		}
 
@@ -75,6 +76,11 @@ func (s *Strategy) processLogin(w http.ResponseWriter, r *http.Request, a *login
 
 	for _, c := range o.Providers {
 		if c.Subject == claims.Subject && c.Provider == provider.Config().ID {
+			if err := s.updateProviderTokens(r.Context(), i.ID, c, token); err != nil {
+				s.handleError(w, r, a.GetID(), provider.Config().ID, nil, err)
+				return
+			}
+
 			if err = s.d.LoginHookExecutor().PostLoginHook(w, r, identity.CredentialsTypeOIDC, a, i); err != nil {
 				s.handleError(w, r, a.GetID(), provider.Config().ID, nil, err)
 				return
@@ -0,0 +1,55 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/randx"
+)
+
+// bind generates the PKCE code verifier and the nonce if the provider is configured to use them, and returns the
+// authorization request parameters which bind the authorization code to the browser's continuity session.
+func (c *authCodeContainer) bind(conf *Configuration) []oauth2.AuthCodeOption {
+	var opts []oauth2.AuthCodeOption
+
+	if conf.PKCE {
+		c.CodeVerifier = string(randx.MustString(64, randx.AlphaNum))
+		challenge := sha256.Sum256([]byte(c.CodeVerifier))
+		opts = append(opts,
+			oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+			oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+		)
+	}
+
+	if conf.Nonce {
+		c.Nonce = string(randx.MustString(32, randx.AlphaNum))
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", c.Nonce))
+	}
+
+	return opts
+}
+
+// exchangeOptions returns the token request parameters which prove that the authorization request was initiated by
+// this browser.
+func (c *authCodeContainer) exchangeOptions() []oauth2.AuthCodeOption {
+	if len(c.CodeVerifier) == 0 {
+		return nil
+	}
+	return []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("code_verifier", c.CodeVerifier)}
+}
+
+// verifyNonce checks that the ID Token was issued for the authorization request of this browser.
+func (c *authCodeContainer) verifyNonce(claims *Claims) error {
+	if len(c.Nonce) == 0 {
+		return nil
+	}
+
+	if claims.Nonce != c.Nonce {
+		return errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete OpenID Connect flow because the ID Token's nonce does not match the nonce from the session cookie.`))
+	}
+	return nil
+}
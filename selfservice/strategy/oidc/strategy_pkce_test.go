@@ -0,0 +1,106 @@
+package oidc_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/strategy/oidc"
+)
+
+func TestAuthCodeBinding(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	p := newFakeProvider(t, "client")
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypeOIDC),
+		map[string]interface{}{"enabled": true, "config": &oidc.ConfigurationCollection{
+			Providers: []oidc.Configuration{{
+				ID:                 "fake",
+				Provider:           "generic",
+				ClientID:           "client",
+				IssuerURL:          p.URL,
+				Mapper:             "file://./stub/oidc.email.jsonnet",
+				PKCE:               true,
+				Nonce:              true,
+				ClientAuthMethod:   oidc.ClientAuthMethodPrivateKeyJWT,
+				ClientPrivateKey:   string(pemKey),
+				ClientPrivateKeyID: "client-key",
+			}},
+		}})
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/registration.schema.json")
+	viper.Set(configuration.HookStrategyKey(configuration.ViperKeySelfServiceRegistrationAfter,
+		identity.CredentialsTypeOIDC.String()), []configuration.SelfServiceHook{{Name: "session"}})
+
+	ts, _ := testhelpers.NewKratosServer(t, reg)
+	registrationUI := testhelpers.NewRegistrationUIFlowEchoServer(t, reg)
+	returnTS := testhelpers.NewRedirSessionEchoTS(t, reg)
+
+	var signUp = func(t *testing.T) (*http.Response, []byte) {
+		f, err := reg.RegistrationHandler().NewRegistrationFlow(httptest.NewRecorder(),
+			&http.Request{URL: urlx.ParseOrPanic(returnTS.URL)}, flow.TypeBrowser)
+		require.NoError(t, err)
+
+		res, err := testhelpers.NewClientWithCookies(t).PostForm(ts.URL+strings.Replace(oidc.RouteAuth, ":flow", f.ID.String(), 1), url.Values{"provider": {"fake"}})
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+
+	t.Run("case=signs up with pkce, nonce and a client assertion", func(t *testing.T) {
+		p.claims = map[string]interface{}{"sub": "binding", "email": "binding@ory.sh"}
+		res, body := signUp(t)
+		require.Contains(t, res.Request.URL.String(), returnTS.URL, "%s", body)
+		assert.Equal(t, "binding@ory.sh", gjson.GetBytes(body, "identity.traits.subject").String(), "%s", body)
+
+		assert.NotEmpty(t, p.challenge)
+		assert.NotEmpty(t, p.nonce)
+		assert.NotEmpty(t, p.tokenRequest.Get("code_verifier"))
+		assert.Empty(t, p.tokenRequest.Get("client_secret"))
+		assert.Equal(t, "urn:ietf:params:oauth:client-assertion-type:jwt-bearer", p.tokenRequest.Get("client_assertion_type"))
+
+		var claims jwt.StandardClaims
+		token, err := jwt.ParseWithClaims(p.tokenRequest.Get("client_assertion"), &claims, func(token *jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "client-key", token.Header["kid"])
+		assert.Equal(t, "RS256", token.Header["alg"])
+		assert.Equal(t, "client", claims.Issuer)
+		assert.Equal(t, "client", claims.Subject)
+		assert.Equal(t, p.URL+"/oauth2/token", claims.Audience)
+		assert.NotEmpty(t, claims.Id)
+	})
+
+	t.Run("case=fails if the nonce does not match", func(t *testing.T) {
+		p.claims = map[string]interface{}{"sub": "wrong-nonce", "email": "wrong-nonce@ory.sh", "nonce": "wrong"}
+		res, body := signUp(t)
+		require.Contains(t, res.Request.URL.String(), registrationUI.URL, "%s", body)
+		assert.Contains(t, gjson.GetBytes(body, "methods.oidc.config.messages.0.text").String(), "nonce does not match", "%s", body)
+	})
+}
@@ -0,0 +1,430 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/markbates/pkger"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/jsonschema/v3"
+	"github.com/ory/x/jsonx"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteAdminProviders = "/oidc/providers"
+	RouteAdminProvider  = RouteAdminProviders + "/:id"
+
+	providerSchemaPath = "config.schema.json#/definitions/selfServiceOIDCProvider"
+)
+
+// A single OpenID Connect Provider configuration.
+//
+// swagger:response oidcProviderResponse
+// nolint:deadcode,unused
+type oidcProviderResponse struct {
+	// required: true
+	// in: body
+	Body *Configuration
+}
+
+// A list of OpenID Connect Provider configurations.
+//
+// swagger:response oidcProviderList
+// nolint:deadcode,unused
+type oidcProviderListResponse struct {
+	// in: body
+	// required: true
+	// type: array
+	Body []Configuration
+}
+
+// swagger:parameters getOIDCProvider deleteOIDCProvider
+// nolint:deadcode,unused
+type oidcProviderParameters struct {
+	// ID is the provider's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// swagger:parameters createOIDCProvider
+// nolint:deadcode,unused
+type createOIDCProviderParameters struct {
+	// in: body
+	Body Configuration
+}
+
+// swagger:parameters updateOIDCProvider
+// nolint:deadcode,unused
+type updateOIDCProviderParameters struct {
+	// ID is the provider's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// in: body
+	Body Configuration
+}
+
+func (s *Strategy) registerProviderRoutes(admin *x.RouterAdmin) {
+	if handle, _, _ := admin.Lookup("GET", RouteAdminProviders); handle == nil {
+		admin.GET(RouteAdminProviders, s.listProviders)
+		admin.POST(RouteAdminProviders, s.createProvider)
+		admin.GET(RouteAdminProvider, s.getProvider)
+		admin.PUT(RouteAdminProvider, s.updateProvider)
+		admin.DELETE(RouteAdminProvider, s.deleteProvider)
+	}
+}
+
+// swagger:route GET /oidc/providers admin listOIDCProviders
+//
+// List OpenID Connect Providers
+//
+// Lists the OpenID Connect Providers which are managed through the admin API. Providers from the configuration
+// file are not included. Secrets are never returned.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: oidcProviderList
+//       500: genericError
+func (s *Strategy) listProviders(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	stored, err := s.d.OIDCProviderPersister().ListOIDCProviders(r.Context())
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	providers := make([]Configuration, len(stored))
+	for k := range stored {
+		c, err := s.decodeStoredProvider(&stored[k])
+		if err != nil {
+			s.d.Writer().WriteError(w, r, err)
+			return
+		}
+		providers[k] = redactProvider(*c)
+	}
+
+	s.d.Writer().Write(w, r, providers)
+}
+
+// swagger:route GET /oidc/providers/{id} admin getOIDCProvider
+//
+// Get an OpenID Connect Provider
+//
+// Secrets are never returned.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: oidcProviderResponse
+//       404: genericError
+//       500: genericError
+func (s *Strategy) getProvider(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	stored, err := s.d.OIDCProviderPersister().GetOIDCProvider(r.Context(), ps.ByName("id"))
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	c, err := s.decodeStoredProvider(stored)
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	s.d.Writer().Write(w, r, redactProvider(*c))
+}
+
+// swagger:route POST /oidc/providers admin createOIDCProvider
+//
+// Create an OpenID Connect Provider
+//
+// The configuration is validated before it is stored, which includes OpenID Connect Discovery for generic
+// providers. Secrets are stored encrypted.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       201: oidcProviderResponse
+//       400: genericError
+//       409: genericError
+//       500: genericError
+func (s *Strategy) createProvider(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	c, err := s.decodeProviderRequest(r)
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	stored, err := s.encodeStoredProvider(c)
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := s.d.OIDCProviderPersister().CreateOIDCProvider(r.Context(), stored); err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	s.d.Writer().WriteCreated(w, r,
+		urlx.AppendPaths(s.c.SelfAdminURL(), RouteAdminProviders, c.ID).String(),
+		redactProvider(*c),
+	)
+}
+
+// swagger:route PUT /oidc/providers/{id} admin updateOIDCProvider
+//
+// Update an OpenID Connect Provider
+//
+// Replaces the provider's configuration including its secrets. The configuration is validated the same way as
+// when creating a provider.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: oidcProviderResponse
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (s *Strategy) updateProvider(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	c, err := s.decodeProviderRequest(r)
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if c.ID != ps.ByName("id") {
+		s.d.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The provider ID "%s" does not match the ID "%s" in the URL.`, c.ID, ps.ByName("id"))))
+		return
+	}
+
+	stored, err := s.encodeStoredProvider(c)
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := s.d.OIDCProviderPersister().UpdateOIDCProvider(r.Context(), stored); err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	s.d.Writer().Write(w, r, redactProvider(*c))
+}
+
+// swagger:route DELETE /oidc/providers/{id} admin deleteOIDCProvider
+//
+// Delete an OpenID Connect Provider
+//
+// Identities which signed up with the provider keep their credentials but can not sign in with the provider
+// any more.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       500: genericError
+func (s *Strategy) deleteProvider(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := s.d.OIDCProviderPersister().DeleteOIDCProvider(r.Context(), ps.ByName("id")); err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeProviderRequest decodes the provider configuration from the request body and rejects invalid configurations.
+func (s *Strategy) decodeProviderRequest(r *http.Request) (*Configuration, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to read the request body: %s", err))
+	}
+
+	if err := validateProviderSchema(body); err != nil {
+		return nil, err
+	}
+
+	var c Configuration
+	if err := jsonx.NewStrictDecoder(bytes.NewBuffer(body)).Decode(&c); err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to decode the provider configuration: %s", err))
+	}
+
+	if err := s.validateProvider(r.Context(), &c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func validateProviderSchema(body []byte) error {
+	f, err := pkger.Open("/.schema/config.schema.json")
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to open the configuration schema: %s", err))
+	}
+	defer f.Close()
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("config.schema.json", f); err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to load the configuration schema: %s", err))
+	}
+
+	schema, err := compiler.Compile(providerSchemaPath)
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to compile the provider schema: %s", err))
+	}
+
+	if err := schema.Validate(bytes.NewBuffer(body)); err != nil {
+		return errors.WithStack(herodot.ErrBadRequest.WithReasonf("The provider configuration is invalid: %s", err))
+	}
+	return nil
+}
+
+// validateProvider rejects configurations which would fail at sign in: unknown provider types, OpenID Connect
+// Providers which fail discovery, invalid client authentication settings and mappers which can not be loaded.
+func (s *Strategy) validateProvider(ctx context.Context, c *Configuration) error {
+	static, err := s.Config()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range static.Providers {
+		if p.ID == c.ID {
+			return errors.WithStack(herodot.ErrConflict.WithReasonf(`The provider "%s" is defined in the configuration file and can not be managed through the API.`, c.ID))
+		}
+	}
+
+	var invalid = func(err error) error {
+		reason := err.Error()
+		var e *herodot.DefaultError
+		if errors.As(err, &e) {
+			reason = e.Reason()
+		}
+		return errors.WithStack(herodot.ErrBadRequest.WithReasonf("The provider configuration is invalid: %s", reason))
+	}
+
+	provider, err := (&ConfigurationCollection{Providers: []Configuration{*c}}).Provider(c.ID, s.c.SelfPublicURL())
+	if err != nil {
+		return invalid(err)
+	}
+
+	config, err := provider.OAuth2(ctx)
+	if err != nil {
+		return invalid(err)
+	}
+
+	if _, err := tokenRequestContext(ctx, provider, config); err != nil {
+		return invalid(err)
+	}
+
+	if _, err := s.f.Fetch(c.Mapper); err != nil {
+		return invalid(errors.Errorf("unable to load the mapper_url: %s", err))
+	}
+
+	return nil
+}
+
+// providerSecrets returns the fields of the configuration which are stored encrypted.
+func providerSecrets(c *Configuration) []*string {
+	return []*string{&c.ClientSecret, &c.ClientPrivateKey, &c.ApplePrivateKey}
+}
+
+func redactProvider(c Configuration) Configuration {
+	for _, secret := range providerSecrets(&c) {
+		*secret = ""
+	}
+	return c
+}
+
+func (s *Strategy) encodeStoredProvider(c *Configuration) (*StoredProvider, error) {
+	encrypted := *c
+	for _, secret := range providerSecrets(&encrypted) {
+		ciphertext, err := s.d.Cipher().Encrypt([]byte(*secret))
+		if err != nil {
+			return nil, err
+		}
+		*secret = ciphertext
+	}
+
+	config, err := json.Marshal(encrypted)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &StoredProvider{ProviderID: c.ID, Config: config}, nil
+}
+
+func (s *Strategy) decodeStoredProvider(stored *StoredProvider) (*Configuration, error) {
+	var c Configuration
+	if err := json.Unmarshal(stored.Config, &c); err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode the configuration of provider %s: %s", stored.ProviderID, err))
+	}
+
+	for _, secret := range providerSecrets(&c) {
+		plaintext, err := s.d.Cipher().Decrypt(*secret)
+		if err != nil {
+			return nil, err
+		}
+		*secret = string(plaintext)
+	}
+
+	return &c, nil
+}
+
+// providers returns the providers from the configuration file followed by the providers managed through the
+// admin API.
+func (s *Strategy) providers(ctx context.Context) (*ConfigurationCollection, error) {
+	c, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := s.d.OIDCProviderPersister().ListOIDCProviders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for k := range stored {
+		p, err := s.decodeStoredProvider(&stored[k])
+		if err != nil {
+			return nil, err
+		}
+		c.Providers = append(c.Providers, *p)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,201 @@
+package oidc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/strategy/oidc"
+)
+
+func TestProviderAdmin(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+
+	p := newFakeProvider(t, "client")
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypeOIDC),
+		map[string]interface{}{"enabled": true, "config": &oidc.ConfigurationCollection{
+			Providers: []oidc.Configuration{{
+				ID:           "static",
+				Provider:     "generic",
+				ClientID:     "client",
+				ClientSecret: "secret",
+				IssuerURL:    p.URL,
+				Mapper:       "file://./stub/oidc.email.jsonnet",
+			}},
+		}})
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/registration.schema.json")
+	viper.Set(configuration.HookStrategyKey(configuration.ViperKeySelfServiceRegistrationAfter,
+		identity.CredentialsTypeOIDC.String()), []configuration.SelfServiceHook{{Name: "session"}})
+
+	ts, admin := testhelpers.NewKratosServer(t, reg)
+	errTS := testhelpers.NewErrorTestServer(t, reg)
+	_ = testhelpers.NewRegistrationUIFlowEchoServer(t, reg)
+	returnTS := testhelpers.NewRedirSessionEchoTS(t, reg)
+
+	var newConfig = func(id string) map[string]interface{} {
+		return map[string]interface{}{
+			"id":            id,
+			"provider":      "generic",
+			"client_id":     "client",
+			"client_secret": "secret",
+			"issuer_url":    p.URL,
+			"mapper_url":    "file://./stub/oidc.email.jsonnet",
+		}
+	}
+
+	var do = func(t *testing.T, method, path string, body interface{}) (*http.Response, []byte) {
+		var payload bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&payload).Encode(body))
+		}
+
+		req, err := http.NewRequest(method, admin.URL+path, &payload)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		result, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, result
+	}
+
+	t.Run("case=creates a provider with an encrypted secret", func(t *testing.T) {
+		res, body := do(t, "POST", oidc.RouteAdminProviders, newConfig("customer"))
+		require.Equal(t, http.StatusCreated, res.StatusCode, "%s", body)
+		assert.Equal(t, "customer", gjson.GetBytes(body, "id").String(), "%s", body)
+		assert.Empty(t, gjson.GetBytes(body, "client_secret").String(), "%s", body)
+		assert.Equal(t, admin.URL+oidc.RouteAdminProviders+"/customer", res.Header.Get("Location"))
+
+		stored, err := reg.OIDCProviderPersister().GetOIDCProvider(context.Background(), "customer")
+		require.NoError(t, err)
+		assert.NotEmpty(t, gjson.GetBytes(stored.Config, "client_secret").String(), "%s", stored.Config)
+		assert.NotContains(t, string(stored.Config), `"secret"`)
+	})
+
+	t.Run("case=rejects invalid configurations", func(t *testing.T) {
+		for k, tc := range []struct {
+			config map[string]interface{}
+			code   int
+			reason string
+		}{
+			{config: newConfig("customer"), code: http.StatusConflict},
+			{config: newConfig("static"), code: http.StatusConflict, reason: "is defined in the configuration file"},
+			{config: func() map[string]interface{} {
+				c := newConfig("no-mapper")
+				delete(c, "mapper_url")
+				return c
+			}(), code: http.StatusBadRequest, reason: "mapper_url"},
+			{config: func() map[string]interface{} {
+				c := newConfig("unknown-type")
+				c["provider"] = "unknown"
+				return c
+			}(), code: http.StatusBadRequest, reason: "provider"},
+			{config: func() map[string]interface{} {
+				c := newConfig("no-discovery")
+				c["issuer_url"] = ts.URL + "/not-an-issuer"
+				return c
+			}(), code: http.StatusBadRequest, reason: "Unable to initialize OpenID Connect Provider"},
+			{config: func() map[string]interface{} {
+				c := newConfig("invalid-key")
+				c["client_auth_method"] = "private_key_jwt"
+				c["client_private_key"] = "not-a-key"
+				return c
+			}(), code: http.StatusBadRequest, reason: "must be PEM encoded"},
+		} {
+			res, body := do(t, "POST", oidc.RouteAdminProviders, tc.config)
+			assert.Equal(t, tc.code, res.StatusCode, "%d: %s", k, body)
+			assert.Contains(t, gjson.GetBytes(body, "error.reason").String(), tc.reason, "%d: %s", k, body)
+		}
+
+		res, body := do(t, "GET", oidc.RouteAdminProviders, nil)
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Len(t, gjson.ParseBytes(body).Array(), 1, "%s", body)
+	})
+
+	t.Run("case=signs up with the stored provider", func(t *testing.T) {
+		f, err := reg.RegistrationHandler().NewRegistrationFlow(httptest.NewRecorder(),
+			&http.Request{URL: urlx.ParseOrPanic(returnTS.URL)}, flow.TypeBrowser)
+		require.NoError(t, err)
+
+		method, err := json.Marshal(f.Methods[identity.CredentialsTypeOIDC])
+		require.NoError(t, err)
+		fields := gjson.GetBytes(method, "config.fields.#.value").String()
+		assert.Contains(t, fields, "static")
+		assert.Contains(t, fields, "customer")
+
+		p.claims = map[string]interface{}{"sub": "stored-provider", "email": "stored-provider@ory.sh"}
+		res, err := testhelpers.NewClientWithCookies(t).PostForm(ts.URL+strings.Replace(oidc.RouteAuth, ":flow", f.ID.String(), 1), url.Values{"provider": {"customer"}})
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+
+		require.Contains(t, res.Request.URL.String(), returnTS.URL, "%s", body)
+		_, _, err = reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeOIDC, "customer:stored-provider")
+		require.NoError(t, err)
+	})
+
+	t.Run("case=gets and updates the provider", func(t *testing.T) {
+		res, body := do(t, "GET", oidc.RouteAdminProviders+"/customer", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Equal(t, "client", gjson.GetBytes(body, "client_id").String(), "%s", body)
+		assert.Empty(t, gjson.GetBytes(body, "client_secret").String(), "%s", body)
+
+		c := newConfig("customer")
+		c["client_id"] = "updated"
+		res, body = do(t, "PUT", oidc.RouteAdminProviders+"/other", c)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, "%s", body)
+
+		res, body = do(t, "PUT", oidc.RouteAdminProviders+"/customer", c)
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Equal(t, "updated", gjson.GetBytes(body, "client_id").String(), "%s", body)
+
+		res, body = do(t, "GET", oidc.RouteAdminProviders+"/customer", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Equal(t, "updated", gjson.GetBytes(body, "client_id").String(), "%s", body)
+	})
+
+	t.Run("case=deletes the provider", func(t *testing.T) {
+		res, body := do(t, "DELETE", oidc.RouteAdminProviders+"/customer", nil)
+		require.Equal(t, http.StatusNoContent, res.StatusCode, "%s", body)
+
+		res, body = do(t, "GET", oidc.RouteAdminProviders+"/customer", nil)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, "%s", body)
+
+		res, body = do(t, "DELETE", oidc.RouteAdminProviders+"/customer", nil)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, "%s", body)
+
+		f, err := reg.RegistrationHandler().NewRegistrationFlow(httptest.NewRecorder(),
+			&http.Request{URL: urlx.ParseOrPanic(returnTS.URL)}, flow.TypeBrowser)
+		require.NoError(t, err)
+
+		res, err = testhelpers.NewClientWithCookies(t).PostForm(ts.URL+strings.Replace(oidc.RouteAuth, ":flow", f.ID.String(), 1), url.Values{"provider": {"customer"}})
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err = ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Contains(t, res.Request.URL.String(), errTS.URL, "%s", body)
+		assert.Equal(t, int64(http.StatusNotFound), gjson.GetBytes(body, "0.code").Int(), "%s", body)
+		assert.Contains(t, gjson.GetBytes(body, "0.reason").String(), "is unknown or has not been configured", "%s", body)
+	})
+}
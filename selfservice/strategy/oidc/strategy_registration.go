@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/go-jsonnet"
 	"github.com/tidwall/gjson"
+	"golang.org/x/oauth2"
 
 	"github.com/zzpu/ums/driver/configuration"
 	"github.com/zzpu/ums/identity"
@@ -48,7 +49,7 @@ func (s *Strategy) PopulateRegistrationMethod(r *http.Request, sr *registration.
 	return nil
 }
 
-func (s *Strategy) processRegistration(w http.ResponseWriter, r *http.Request, a *registration.Flow, claims *Claims, provider Provider, container *authCodeContainer) {
+func (s *Strategy) processRegistration(w http.ResponseWriter, r *http.Request, a *registration.Flow, token *oauth2.Token, claims *Claims, provider Provider, container *authCodeContainer) {
 	if _, _, err := s.d.PrivilegedIdentityPool().FindByCredentialsIdentifier(r.Context(), identity.CredentialsTypeOIDC, uid(provider.Config().ID, claims.Subject)); err == nil {
 		// If the identity already exists, we should perform the login flow instead.
 
@@ -70,7 +71,7 @@ func (s *Strategy) processRegistration(w http.ResponseWriter, r *http.Request, a
 			return
 		}
 
-		s.processLogin(w, r, ar, claims, provider, container)
+		s.processLogin(w, r, ar, token, claims, provider, container)
 		return
 	}
 
@@ -133,13 +134,25 @@ func (s *Strategy) processRegistration(w http.ResponseWriter, r *http.Request, a
 		return
 	}
 
-	creds, err := NewCredentials(provider.Config().ID, claims.Subject)
+	pc, err := s.providerCredentials(provider.Config().ID, claims.Subject, token)
 	if err != nil {
 		s.handleError(w, r, a.GetID(), provider.Config().ID, i.Traits, err)
 		return
 	}
 
-	i.SetCredentials(s.ID(), *creds)
+	// If the identifier already belongs to a password identity, the credentials may be linked to it instead.
+	if linked, err := s.linkExistingIdentity(w, r, provider.Config(), i, claims, pc); err != nil {
+		s.handleError(w, r, a.GetID(), provider.Config().ID, i.Traits, err)
+		return
+	} else if linked {
+		return
+	}
+
+	if err := s.addProviderCredentials(i, pc); err != nil {
+		s.handleError(w, r, a.GetID(), provider.Config().ID, i.Traits, err)
+		return
+	}
+
 	if err := s.d.RegistrationExecutor().PostRegistrationHook(w, r, identity.CredentialsTypeOIDC, a, i); err != nil {
 		s.handleError(w, r, a.GetID(), provider.Config().ID, i.Traits, err)
 		return
@@ -10,6 +10,7 @@ import (
 	"github.com/gobuffalo/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
 
 	"github.com/ory/herodot"
 	"github.com/ory/jsonschema/v3"
@@ -119,7 +120,7 @@ func (s *Strategy) PopulateSettingsMethod(r *http.Request, id *identity.Identity
 		return nil
 	}
 
-	conf, err := s.Config()
+	conf, err := s.providers(r.Context())
 	if err != nil {
 		return err
 	}
@@ -264,7 +265,7 @@ func (s *Strategy) completeSettingsFlow(w http.ResponseWriter, r *http.Request,
 }
 
 func (s *Strategy) isLinkable(r *http.Request, ctxUpdate *settings.UpdateContext, toLink string) (*identity.Identity, error) {
-	providers, err := s.Config()
+	providers, err := s.providers(r.Context())
 	if err != nil {
 		return nil, err
 	}
@@ -311,7 +312,7 @@ func (s *Strategy) initLinkProvider(w http.ResponseWriter, r *http.Request, ctxU
 }
 
 func (s *Strategy) linkProvider(w http.ResponseWriter, r *http.Request,
-	ctxUpdate *settings.UpdateContext, claims *Claims, provider Provider) {
+	ctxUpdate *settings.UpdateContext, token *oauth2.Token, claims *Claims, provider Provider) {
 	p := &completeSelfServiceBrowserSettingsOIDCFlowPayload{
 		Link: provider.Config().ID, FlowID: ctxUpdate.Flow.ID.String()}
 	if ctxUpdate.Session.AuthenticatedAt.Add(s.c.SelfServiceFlowSettingsPrivilegedSessionMaxAge()).Before(time.Now()) {
@@ -325,29 +326,17 @@ func (s *Strategy) linkProvider(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	var conf CredentialsConfig
-	creds, err := i.ParseCredentials(s.ID(), &conf)
-	if errors.Is(err, herodot.ErrNotFound) {
-		var err error
-		if creds, err = NewCredentials(provider.Config().ID, claims.Subject); err != nil {
-			s.handleSettingsError(w, r, ctxUpdate, p, err)
-			return
-		}
-	} else if err != nil {
+	pc, err := s.providerCredentials(provider.Config().ID, claims.Subject, token)
+	if err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	if err := s.addProviderCredentials(i, pc); err != nil {
 		s.handleSettingsError(w, r, ctxUpdate, p, err)
 		return
-	} else {
-		creds.Identifiers = append(creds.Identifiers, uid(provider.Config().ID, claims.Subject))
-		conf.Providers = append(conf.Providers, ProviderCredentialsConfig{
-			Subject: claims.Subject, Provider: provider.Config().ID})
-		creds.Config, err = json.Marshal(conf)
-		if err != nil {
-			s.handleSettingsError(w, r, ctxUpdate, p, err)
-			return
-		}
 	}
 
-	i.Credentials[s.ID()] = *creds
 	if err := s.d.SettingsHookExecutor().PostSettingsHook(w, r, s.SettingsStrategyID(), ctxUpdate, i, settings.WithCallback(func(ctxUpdate *settings.UpdateContext) error {
 		return s.PopulateSettingsMethod(r, ctxUpdate.Session.Identity, ctxUpdate.Flow)
 	})); err != nil {
@@ -363,7 +352,7 @@ func (s *Strategy) unlinkProvider(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	providers, err := s.Config()
+	providers, err := s.providers(r.Context())
 	if err != nil {
 		s.handleSettingsError(w, r, ctxUpdate, p, err)
 		return
@@ -0,0 +1,258 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/ory/herodot"
+
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteAdminTokens = "/identities/:id/credentials/oidc/tokens"
+)
+
+// Tokens of an OpenID Connect or OAuth2 Provider
+//
+// swagger:model oidcProviderTokens
+type ProviderTokens struct {
+	// Provider is the ID of the provider which issued the tokens.
+	//
+	// required: true
+	Provider string `json:"provider"`
+
+	// Subject is the identity's subject at the provider.
+	//
+	// required: true
+	Subject string `json:"subject"`
+
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+
+	// Expiry is the time at which the access token expires. It is empty if the token does not expire.
+	Expiry *time.Time `json:"expiry,omitempty"`
+}
+
+// A list of provider tokens.
+//
+// swagger:response oidcProviderTokensList
+// nolint:deadcode,unused
+type providerTokensListResponse struct {
+	// in: body
+	// required: true
+	// type: array
+	Body []ProviderTokens
+}
+
+// swagger:parameters getIdentityOIDCTokens
+// nolint:deadcode,unused
+type getIdentityOIDCTokensParameters struct {
+	// ID must be set to the ID of identity you want to get the tokens for
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// Provider limits the response to the tokens of this provider
+	//
+	// required: false
+	// in: query
+	Provider string `json:"provider"`
+}
+
+func (s *Strategy) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	if handle, _, _ := admin.Lookup("GET", RouteAdminTokens); handle == nil {
+		admin.GET(RouteAdminTokens, s.getTokens)
+	}
+
+	s.registerProviderRoutes(admin)
+}
+
+// swagger:route GET /identities/{id}/credentials/oidc/tokens admin getIdentityOIDCTokens
+//
+// Get the OpenID Connect Tokens of an Identity
+//
+// Returns the decrypted tokens which the upstream OpenID Connect and OAuth2 Providers issued to the identity
+// during the most recent sign in. Expired access tokens are refreshed first if a refresh token is available.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: oidcProviderTokensList
+//       404: genericError
+//       500: genericError
+func (s *Strategy) getTokens(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	var conf CredentialsConfig
+	if _, err := i.ParseCredentials(s.ID(), &conf); errors.Is(err, herodot.ErrNotFound) {
+		s.d.Writer().Write(w, r, []ProviderTokens{})
+		return
+	} else if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	filter := r.URL.Query().Get("provider")
+	tokens := make([]ProviderTokens, 0, len(conf.Providers))
+	for _, pc := range conf.Providers {
+		if len(filter) > 0 && pc.Provider != filter {
+			continue
+		}
+
+		token, err := s.providerToken(pc)
+		if err != nil {
+			s.d.Writer().WriteError(w, r, err)
+			return
+		}
+
+		if token, err = s.refreshProviderToken(r.Context(), i.ID, pc, token); err != nil {
+			s.d.Writer().WriteError(w, r, err)
+			return
+		}
+
+		pt := ProviderTokens{
+			Provider:     pc.Provider,
+			Subject:      pc.Subject,
+			AccessToken:  token.AccessToken,
+			RefreshToken: token.RefreshToken,
+		}
+		if idToken, ok := token.Extra("id_token").(string); ok {
+			pt.IDToken = idToken
+		}
+		if !token.Expiry.IsZero() {
+			pt.Expiry = &token.Expiry
+		}
+		tokens = append(tokens, pt)
+	}
+
+	s.d.Writer().Write(w, r, tokens)
+}
+
+// providerCredentials returns the credentials of the given provider and subject with the encrypted tokens.
+func (s *Strategy) providerCredentials(provider, subject string, token *oauth2.Token) (pc ProviderCredentialsConfig, err error) {
+	pc = ProviderCredentialsConfig{Provider: provider, Subject: subject}
+	if token == nil {
+		return pc, nil
+	}
+
+	idToken, _ := token.Extra("id_token").(string)
+	if pc.AccessToken, err = s.d.Cipher().Encrypt([]byte(token.AccessToken)); err != nil {
+		return pc, err
+	}
+	if pc.RefreshToken, err = s.d.Cipher().Encrypt([]byte(token.RefreshToken)); err != nil {
+		return pc, err
+	}
+	if pc.IDToken, err = s.d.Cipher().Encrypt([]byte(idToken)); err != nil {
+		return pc, err
+	}
+	pc.Expiry = token.Expiry
+
+	return pc, nil
+}
+
+// providerToken decrypts the tokens of the given provider credentials.
+func (s *Strategy) providerToken(pc ProviderCredentialsConfig) (*oauth2.Token, error) {
+	accessToken, err := s.d.Cipher().Decrypt(pc.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := s.d.Cipher().Decrypt(pc.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := s.d.Cipher().Decrypt(pc.IDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  string(accessToken),
+		RefreshToken: string(refreshToken),
+		Expiry:       pc.Expiry,
+	}
+	if len(idToken) > 0 {
+		token = token.WithExtra(map[string]interface{}{"id_token": string(idToken)})
+	}
+	return token, nil
+}
+
+// refreshProviderToken refreshes an expired token if the provider issued a refresh token and stores the new tokens.
+// Tokens of providers which do not follow the OAuth2 specification are returned as they are.
+func (s *Strategy) refreshProviderToken(ctx context.Context, id uuid.UUID, pc ProviderCredentialsConfig, token *oauth2.Token) (*oauth2.Token, error) {
+	if token.Valid() || len(token.AccessToken) == 0 || len(token.RefreshToken) == 0 {
+		return token, nil
+	}
+
+	provider, err := s.provider(ctx, pc.Provider)
+	if err != nil {
+		// The provider was removed from the configuration, there is nothing to refresh the token with.
+		return token, nil
+	}
+
+	if _, ok := provider.(NonStandardProvider); ok {
+		return token, nil
+	}
+
+	config, err := provider.OAuth2(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err = tokenRequestContext(ctx, provider, config)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshed, err := config.TokenSource(ctx, token).Token()
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("Unable to refresh the tokens of provider %s: %s", pc.Provider, err))
+	}
+
+	// Providers usually return an ID Token only on the initial exchange.
+	if _, ok := refreshed.Extra("id_token").(string); !ok {
+		if idToken, ok := token.Extra("id_token").(string); ok {
+			refreshed = refreshed.WithExtra(map[string]interface{}{"id_token": idToken})
+		}
+	}
+
+	if err := s.updateProviderTokens(ctx, id, pc, refreshed); err != nil {
+		return nil, err
+	}
+
+	return refreshed, nil
+}
+
+// updateProviderTokens stores the encrypted tokens in the identity's credentials of the given provider.
+func (s *Strategy) updateProviderTokens(ctx context.Context, id uuid.UUID, c ProviderCredentialsConfig, token *oauth2.Token) error {
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	pc, err := s.providerCredentials(c.Provider, c.Subject, token)
+	if err != nil {
+		return err
+	}
+
+	if err := s.addProviderCredentials(i, pc); err != nil {
+		return err
+	}
+
+	return s.d.PrivilegedIdentityPool().UpdateIdentity(ctx, i)
+}
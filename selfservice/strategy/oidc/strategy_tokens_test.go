@@ -0,0 +1,137 @@
+package oidc_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/strategy/oidc"
+	"github.com/zzpu/ums/x"
+)
+
+func TestProviderTokens(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+
+	p := newFakeProvider(t, "client")
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypeOIDC),
+		map[string]interface{}{"enabled": true, "config": &oidc.ConfigurationCollection{
+			Providers: []oidc.Configuration{{
+				ID:           "fake",
+				Provider:     "generic",
+				ClientID:     "client",
+				ClientSecret: "secret",
+				IssuerURL:    p.URL,
+				Mapper:       "file://./stub/oidc.email.jsonnet",
+			}},
+		}})
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/registration.schema.json")
+	viper.Set(configuration.HookStrategyKey(configuration.ViperKeySelfServiceRegistrationAfter,
+		identity.CredentialsTypeOIDC.String()), []configuration.SelfServiceHook{{Name: "session"}})
+
+	ts, admin := testhelpers.NewKratosServer(t, reg)
+	_ = testhelpers.NewLoginUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewRegistrationUIFlowEchoServer(t, reg)
+	returnTS := testhelpers.NewRedirSessionEchoTS(t, reg)
+
+	var signIn = func(t *testing.T) string {
+		f, err := reg.RegistrationHandler().NewRegistrationFlow(httptest.NewRecorder(),
+			&http.Request{URL: urlx.ParseOrPanic(returnTS.URL)}, flow.TypeBrowser)
+		require.NoError(t, err)
+
+		res, err := testhelpers.NewClientWithCookies(t).PostForm(ts.URL+strings.Replace(oidc.RouteAuth, ":flow", f.ID.String(), 1), url.Values{"provider": {"fake"}})
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+
+		require.Contains(t, res.Request.URL.String(), returnTS.URL, "%s", body)
+		return gjson.GetBytes(body, "identity.id").String()
+	}
+
+	var getTokens = func(t *testing.T, id, query string) (*http.Response, []byte) {
+		res, err := http.Get(admin.URL + strings.Replace(oidc.RouteAdminTokens, ":id", id, 1) + query)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+
+	p.claims = map[string]interface{}{"sub": "tokens", "email": "tokens@ory.sh"}
+	id := signIn(t)
+
+	t.Run("case=stores the tokens encrypted", func(t *testing.T) {
+		_, c, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeOIDC, "fake:tokens")
+		require.NoError(t, err)
+
+		for _, key := range []string{"access_token", "refresh_token", "id_token"} {
+			stored := gjson.GetBytes(c.Config, "providers.0."+key).String()
+			assert.NotEmpty(t, stored, "%s", c.Config)
+			assert.NotContains(t, stored, "token", "%s", c.Config)
+		}
+		assert.NotContains(t, string(c.Config), "access-token")
+		assert.True(t, gjson.GetBytes(c.Config, "providers.0.expiry").Exists(), "%s", c.Config)
+	})
+
+	t.Run("case=returns the decrypted tokens", func(t *testing.T) {
+		res, body := getTokens(t, id, "")
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Equal(t, "fake", gjson.GetBytes(body, "0.provider").String(), "%s", body)
+		assert.Equal(t, "tokens", gjson.GetBytes(body, "0.subject").String(), "%s", body)
+		assert.Equal(t, "access-token", gjson.GetBytes(body, "0.access_token").String(), "%s", body)
+		assert.Equal(t, "refresh-token", gjson.GetBytes(body, "0.refresh_token").String(), "%s", body)
+		assert.NotEmpty(t, gjson.GetBytes(body, "0.id_token").String(), "%s", body)
+		assert.NotEmpty(t, gjson.GetBytes(body, "0.expiry").String(), "%s", body)
+	})
+
+	t.Run("case=filters by provider", func(t *testing.T) {
+		res, body := getTokens(t, id, "?provider=other")
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Equal(t, "[]", strings.TrimSpace(string(body)))
+	})
+
+	t.Run("case=fails for an unknown identity", func(t *testing.T) {
+		res, body := getTokens(t, x.NewUUID().String(), "")
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, "%s", body)
+	})
+
+	t.Run("case=updates the tokens on sign in and refreshes them when expired", func(t *testing.T) {
+		// Tokens which expire within the next seconds are considered expired already.
+		p.expiresIn = 5
+		t.Cleanup(func() { p.expiresIn = 3600 })
+		require.Equal(t, id, signIn(t))
+
+		_, c, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeOIDC, "fake:tokens")
+		require.NoError(t, err)
+		assert.Len(t, gjson.GetBytes(c.Config, "providers").Array(), 1, "%s", c.Config)
+
+		res, body := getTokens(t, id, "")
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Equal(t, "refreshed-access-token", gjson.GetBytes(body, "0.access_token").String(), "%s", body)
+		assert.NotEmpty(t, gjson.GetBytes(body, "0.id_token").String(), "%s", body)
+
+		_, c, err = reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeOIDC, "fake:tokens")
+		require.NoError(t, err)
+		assert.NotContains(t, string(c.Config), "refreshed-access-token")
+
+		res, body = getTokens(t, id, "")
+		require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+		assert.Equal(t, "refreshed-access-token", gjson.GetBytes(body, "0.access_token").String(), "%s", body)
+	})
+}
@@ -3,6 +3,7 @@ package oidc
 import (
 	"bytes"
 	"encoding/json"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
@@ -35,6 +36,12 @@ func NewCredentials(provider, subject string) (*identity.Credentials, error) {
 type ProviderCredentialsConfig struct {
 	Subject  string `json:"subject"`
 	Provider string `json:"provider"`
+
+	// The provider's tokens from the most recent sign in or refresh, encrypted using the default secrets.
+	AccessToken  string    `json:"access_token,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	IDToken      string    `json:"id_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
 }
 
 type FlowMethod struct {
@@ -0,0 +1,115 @@
+package password
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/jsonx"
+)
+
+// Configuration is the configuration of the password method.
+type Configuration struct {
+	ValidatorConfiguration
+
+	// HistorySize is the number of most recent passwords, including the current one, which can not be reused
+	// when changing the password. Zero allows reusing any password.
+	HistorySize int `json:"history_size"`
+
+	// MaxAge is the duration after which a password expires and has to be changed. Users logging in with an
+	// expired password are sent to the settings flow. An empty value disables password expiry.
+	MaxAge string `json:"max_age"`
+
+	// Lockout configures the protection of password logins against brute-force attacks.
+	Lockout LockoutConfiguration `json:"lockout"`
+}
+
+// LockoutConfiguration configures how failed password logins are throttled.
+type LockoutConfiguration struct {
+	// Enabled enables tracking failed logins.
+	Enabled bool `json:"enabled"`
+
+	// DelayAfter is the number of failed logins of an identifier after which every further attempt has to wait
+	// for a delay which doubles with each failure. Zero disables delays.
+	DelayAfter int `json:"delay_after"`
+
+	// BaseDelay is the delay after DelayAfter failed logins.
+	BaseDelay string `json:"base_delay"`
+
+	// MaxDelay is the longest delay between two attempts.
+	MaxDelay string `json:"max_delay"`
+
+	// MaxAttempts is the number of failed logins of an identifier within Duration after which the identifier
+	// is locked. Zero disables the lockout of identifiers.
+	MaxAttempts int `json:"max_attempts"`
+
+	// MaxAttemptsPerIPAddress is the number of failed logins from an IP address within Duration after which
+	// the IP address is locked. Zero disables the lockout of IP addresses.
+	MaxAttemptsPerIPAddress int `json:"max_attempts_per_ip_address"`
+
+	// Duration is the time window in which failed logins are counted.
+	Duration string `json:"duration"`
+
+	// ClientIPHeader is the header which contains the IP address of the client, for example `X-Forwarded-For`. It
+	// must only be set if all requests pass a proxy which sets the header. If empty, the remote address is used.
+	ClientIPHeader string `json:"client_ip_header"`
+}
+
+func defaultLockoutConfiguration() LockoutConfiguration {
+	return LockoutConfiguration{
+		DelayAfter:              3,
+		BaseDelay:               "1s",
+		MaxDelay:                "1m",
+		MaxAttempts:             10,
+		MaxAttemptsPerIPAddress: 100,
+		Duration:                "15m",
+	}
+}
+
+func (s *Strategy) Config() (*Configuration, error) {
+	c := Configuration{
+		ValidatorConfiguration: defaultValidatorConfiguration(),
+		Lockout:                defaultLockoutConfiguration(),
+	}
+
+	config := s.c.SelfServiceStrategy(string(s.ID())).Config
+	if err := jsonx.
+		NewStrictDecoder(bytes.NewBuffer(config)).
+		Decode(&c); err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode password configuration: %s", err))
+	}
+
+	return &c, nil
+}
+
+// maxAge returns the duration after which passwords expire or zero if passwords do not expire.
+func (c *Configuration) maxAge() time.Duration {
+	return parseDuration(c.MaxAge, 0)
+}
+
+func (c *LockoutConfiguration) duration() time.Duration {
+	return parseDuration(c.Duration, 15*time.Minute)
+}
+
+// delay returns how long to wait after the given number of failed logins.
+func (c *LockoutConfiguration) delay(failures int) time.Duration {
+	d, max := parseDuration(c.BaseDelay, time.Second), parseDuration(c.MaxDelay, time.Minute)
+	for k := c.DelayAfter; k < failures && d < max; k++ {
+		d *= 2
+	}
+
+	if d > max {
+		return max
+	}
+	return d
+}
+
+func parseDuration(value string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,174 @@
+package password
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/zzpu/ums/schema"
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteAdminLockout = "/identities/:id/credentials/password/lockout"
+)
+
+// swagger:parameters unlockIdentityPasswordLogin
+// nolint:deadcode,unused
+type unlockIdentityPasswordLoginParameters struct {
+	// ID must be set to the ID of identity you want to unlock
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+func (s *Strategy) RegisterAdminRoutes(admin *x.RouterAdmin) {
+	if handle, _, _ := admin.Lookup("DELETE", RouteAdminLockout); handle == nil {
+		admin.DELETE(RouteAdminLockout, s.unlockLogin)
+	}
+}
+
+// swagger:route DELETE /identities/{id}/credentials/password/lockout admin unlockIdentityPasswordLogin
+//
+// Unlock the Password Login of an Identity
+//
+// Removes the failed password logins of all identifiers of the identity, which lifts the delays and lockouts
+// caused by them. Lockouts of IP addresses are not lifted.
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       500: genericError
+func (s *Strategy) unlockLogin(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if c, ok := i.GetCredentials(s.ID()); ok {
+		for _, identifier := range c.Identifiers {
+			if err := s.d.LoginFailurePersister().DeleteLoginFailuresByIdentifier(r.Context(), identifier); err != nil {
+				s.d.Writer().WriteError(w, r, err)
+				return
+			}
+		}
+	}
+
+	s.d.Audit().
+		WithRequest(r).
+		WithField("identity_id", i.ID).
+		Info("The password login of the identity was unlocked.")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CheckLoginAttempt returns an error if password logins with the identifier or from the client's IP address are
+// delayed or locked. It is used by other strategies which ask for the password, for example to link accounts, and
+// does nothing if the lockout is disabled.
+func (s *Strategy) CheckLoginAttempt(r *http.Request, identifier string) error {
+	conf, err := s.Config()
+	if err != nil {
+		return err
+	} else if !conf.Lockout.Enabled {
+		return nil
+	}
+	return s.checkLockout(r, &conf.Lockout, identifier)
+}
+
+// RecordFailedLoginAttempt records that a wrong password was entered for the identifier if the lockout is enabled.
+func (s *Strategy) RecordFailedLoginAttempt(r *http.Request, identifier string) error {
+	conf, err := s.Config()
+	if err != nil {
+		return err
+	} else if !conf.Lockout.Enabled {
+		return nil
+	}
+	return s.recordLoginFailure(r, &conf.Lockout, identifier)
+}
+
+// ResetFailedLoginAttempts removes the failed logins with the identifier once the right password was entered.
+func (s *Strategy) ResetFailedLoginAttempts(r *http.Request, identifier string) error {
+	conf, err := s.Config()
+	if err != nil {
+		return err
+	} else if !conf.Lockout.Enabled {
+		return nil
+	}
+	return s.d.LoginFailurePersister().DeleteLoginFailuresByIdentifier(r.Context(), identifier)
+}
+
+// checkLockout returns an error if logins with the identifier or from the client's IP address are delayed or locked
+// because too many attempts failed.
+func (s *Strategy) checkLockout(r *http.Request, c *LockoutConfiguration, identifier string) error {
+	now := time.Now().UTC()
+	since := now.Add(-c.duration())
+
+	if c.MaxAttemptsPerIPAddress > 0 {
+		ip := c.clientIPAddress(r)
+		failures, err := s.d.LoginFailurePersister().ListLoginFailuresByIPAddress(r.Context(), ip, since)
+		if err != nil {
+			return err
+		}
+
+		if len(failures) >= c.MaxAttemptsPerIPAddress {
+			s.d.Audit().
+				WithRequest(r).
+				WithField("ip_address", ip).
+				Info("Rejected a password login because too many logins from the IP address failed.")
+			return schema.NewLoginLockedError(failures[len(failures)-c.MaxAttemptsPerIPAddress].CreatedAt.Add(c.duration()))
+		}
+	}
+
+	failures, err := s.d.LoginFailurePersister().ListLoginFailuresByIdentifier(r.Context(), identifier, since)
+	if err != nil {
+		return err
+	}
+
+	if c.MaxAttempts > 0 && len(failures) >= c.MaxAttempts {
+		s.d.Audit().
+			WithRequest(r).
+			Info("Rejected a password login because too many logins with the identifier failed.")
+		return schema.NewLoginLockedError(failures[len(failures)-c.MaxAttempts].CreatedAt.Add(c.duration()))
+	}
+
+	if c.DelayAfter > 0 && len(failures) >= c.DelayAfter {
+		if retryAt := failures[len(failures)-1].CreatedAt.Add(c.delay(len(failures))); now.Before(retryAt) {
+			return schema.NewLoginDelayedError(retryAt)
+		}
+	}
+
+	return nil
+}
+
+// recordLoginFailure stores a failed login with the identifier.
+func (s *Strategy) recordLoginFailure(r *http.Request, c *LockoutConfiguration, identifier string) error {
+	return s.d.LoginFailurePersister().CreateLoginFailure(r.Context(), &LoginFailure{
+		Identifier: identifier,
+		IPAddress:  c.clientIPAddress(r),
+	})
+}
+
+// clientIPAddress returns the IP address of the client which sent the request.
+func (c *LockoutConfiguration) clientIPAddress(r *http.Request) string {
+	if len(c.ClientIPHeader) > 0 {
+		// Proxies append the address of their client to headers such as X-Forwarded-For. Only the last address was
+		// added by the trusted proxy, all others could have been sent by the client.
+		values := strings.Split(r.Header.Get(c.ClientIPHeader), ",")
+		if ip := net.ParseIP(strings.TrimSpace(values[len(values)-1])); ip != nil {
+			return ip.String()
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,55 @@
+package password
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockoutConfiguration(t *testing.T) {
+	t.Run("method=delay", func(t *testing.T) {
+		c := LockoutConfiguration{DelayAfter: 3, BaseDelay: "1s", MaxDelay: "10s"}
+		for failures, expected := range map[int]time.Duration{
+			3:   time.Second,
+			4:   2 * time.Second,
+			5:   4 * time.Second,
+			6:   8 * time.Second,
+			7:   10 * time.Second,
+			100: 10 * time.Second,
+		} {
+			assert.Equal(t, expected, c.delay(failures), "%d", failures)
+		}
+
+		c = LockoutConfiguration{DelayAfter: 1, BaseDelay: "invalid", MaxDelay: "invalid"}
+		assert.Equal(t, time.Second, c.delay(1))
+		assert.Equal(t, time.Minute, c.delay(100))
+	})
+
+	t.Run("method=clientIPAddress", func(t *testing.T) {
+		for k, tc := range []struct {
+			header     string
+			value      string
+			remoteAddr string
+			expected   string
+		}{
+			{remoteAddr: "192.0.2.1:1234", expected: "192.0.2.1"},
+			{remoteAddr: "[2001:db8::1]:1234", expected: "2001:db8::1"},
+			{value: "198.51.100.1", remoteAddr: "192.0.2.1:1234", expected: "192.0.2.1"},
+			{header: "X-Forwarded-For", remoteAddr: "192.0.2.1:1234", expected: "192.0.2.1"},
+			{header: "X-Forwarded-For", value: "198.51.100.1", remoteAddr: "192.0.2.1:1234", expected: "198.51.100.1"},
+			{header: "X-Forwarded-For", value: "203.0.113.1, 198.51.100.1", remoteAddr: "192.0.2.1:1234", expected: "198.51.100.1"},
+			{header: "X-Forwarded-For", value: "198.51.100.1, not-an-ip", remoteAddr: "192.0.2.1:1234", expected: "192.0.2.1"},
+		} {
+			t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+				r := &http.Request{Header: http.Header{}, RemoteAddr: tc.remoteAddr}
+				r.Header.Set("X-Forwarded-For", tc.value)
+
+				c := LockoutConfiguration{ClientIPHeader: tc.header}
+				assert.Equal(t, tc.expected, c.clientIPAddress(r))
+			})
+		}
+	})
+}
@@ -2,9 +2,12 @@ package password
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
+	"time"
 
+	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/markbates/pkger"
 	"github.com/pkg/errors"
@@ -132,9 +135,22 @@ func (s *Strategy) handleLogin(w http.ResponseWriter, r *http.Request, _ httprou
 		return
 	}
 
+	conf, err := s.Config()
+	if err != nil {
+		s.handleLoginError(w, r, ar, &p, err)
+		return
+	}
+
+	if conf.Lockout.Enabled {
+		if err := s.checkLockout(r, &conf.Lockout, p.Identifier); err != nil {
+			s.handleLoginError(w, r, ar, &p, err)
+			return
+		}
+	}
+
 	i, c, err := s.d.PrivilegedIdentityPool().FindByCredentialsIdentifier(r.Context(), s.ID(), p.Identifier)
 	if err != nil {
-		s.handleLoginError(w, r, ar, &p, errors.WithStack(schema.NewInvalidCredentialsError()))
+		s.handleInvalidCredentials(w, r, ar, &p, conf)
 		return
 	}
 
@@ -146,16 +162,122 @@ func (s *Strategy) handleLogin(w http.ResponseWriter, r *http.Request, _ httprou
 	}
 
 	if err := s.d.Hasher().Compare([]byte(p.Password), []byte(o.HashedPassword)); err != nil {
-		s.handleLoginError(w, r, ar, &p, errors.WithStack(schema.NewInvalidCredentialsError()))
+		s.handleInvalidCredentials(w, r, ar, &p, conf)
 		return
 	}
 
+	if conf.Lockout.Enabled {
+		if err := s.d.LoginFailurePersister().DeleteLoginFailuresByIdentifier(r.Context(), p.Identifier); err != nil {
+			s.handleLoginError(w, r, ar, &p, err)
+			return
+		}
+	}
+
+	// Passwords set before password expiry was enabled expire once the maximum age has passed since the first login.
+	rehash := s.d.Hasher().NeedsRehash([]byte(o.HashedPassword))
+	track := conf.maxAge() > 0 && o.ChangedAt == nil
+	if rehash || track {
+		if err := s.updateCredentialsConfig(r.Context(), i.ID, func(o *CredentialsConfig) error {
+			if rehash {
+				hpw, err := s.d.Hasher().Generate([]byte(p.Password))
+				if err != nil {
+					return err
+				}
+				o.HashedPassword = string(hpw)
+			}
+
+			if track {
+				now := time.Now().UTC()
+				o.ChangedAt = &now
+			}
+			return nil
+		}); err != nil {
+			s.handleLoginError(w, r, ar, &p, err)
+			return
+		}
+	}
+
 	if err := s.d.LoginHookExecutor().PostLoginHook(w, r, identity.CredentialsTypePassword, ar, i); err != nil {
 		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
 		return
 	}
 }
 
+// handleInvalidCredentials records the failed login if brute-force protection is enabled and responds with an
+// invalid credentials error.
+func (s *Strategy) handleInvalidCredentials(w http.ResponseWriter, r *http.Request, ar *login.Flow, p *CompleteSelfServiceLoginFlowWithPasswordMethod, conf *Configuration) {
+	if conf.Lockout.Enabled {
+		if err := s.recordLoginFailure(r, &conf.Lockout, p.Identifier); err != nil {
+			s.handleLoginError(w, r, ar, p, err)
+			return
+		}
+	}
+
+	s.handleLoginError(w, r, ar, p, errors.WithStack(schema.NewInvalidCredentialsError()))
+}
+
+// updateCredentialsConfig applies update to the stored password credentials of the identity.
+func (s *Strategy) updateCredentialsConfig(ctx context.Context, id uuid.UUID, update func(o *CredentialsConfig) error) error {
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	c, ok := i.GetCredentials(s.ID())
+	if !ok {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReason("The password credentials could not be found."))
+	}
+
+	var o CredentialsConfig
+	if err := json.Unmarshal(c.Config, &o); err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReason("The password credentials could not be decoded properly").WithDebug(err.Error()))
+	}
+
+	if err := update(&o); err != nil {
+		return err
+	}
+
+	co, err := json.Marshal(&o)
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode password options to JSON: %s", err))
+	}
+
+	c.Config = co
+	i.SetCredentials(s.ID(), *c)
+	return s.d.PrivilegedIdentityPool().UpdateIdentity(ctx, i)
+}
+
+// CredentialsExpired returns true if a maximum password age is configured and the identity's password is older.
+func (s *Strategy) CredentialsExpired(r *http.Request, i *identity.Identity) (bool, error) {
+	conf, err := s.Config()
+	if err != nil {
+		return false, err
+	}
+
+	maxAge := conf.maxAge()
+	if maxAge == 0 {
+		return false, nil
+	}
+
+	// The identity does not necessarily include its credentials.
+	i, err = s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), i.ID)
+	if err != nil {
+		return false, err
+	}
+
+	c, ok := i.GetCredentials(s.ID())
+	if !ok || len(c.Config) == 0 {
+		return false, nil
+	}
+
+	var o CredentialsConfig
+	if err := json.Unmarshal(c.Config, &o); err != nil {
+		return false, errors.WithStack(herodot.ErrInternalServerError.WithReason("The password credentials could not be decoded properly").WithDebug(err.Error()))
+	}
+
+	return o.ChangedAt != nil && o.ChangedAt.Add(maxAge).Before(time.Now()), nil
+}
+
 func (s *Strategy) PopulateLoginMethod(r *http.Request, sr *login.Flow) error {
 	// This block adds the identifier to the method when the request is forced - as a hint for the user.
 	var identifier string
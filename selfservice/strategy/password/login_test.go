@@ -7,9 +7,12 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gofrs/uuid"
+
 	"github.com/ory/x/assertx"
 	"github.com/ory/x/errorsx"
 	"github.com/ory/x/sqlxx"
@@ -23,6 +26,7 @@ import (
 	"github.com/ory/viper"
 
 	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/hash"
 	"github.com/zzpu/ums/identity"
 	"github.com/zzpu/ums/internal"
 	"github.com/zzpu/ums/internal/httpclient/models"
@@ -30,6 +34,7 @@ import (
 	"github.com/zzpu/ums/schema"
 	"github.com/zzpu/ums/selfservice/flow/login"
 	"github.com/zzpu/ums/selfservice/strategy/password"
+	"github.com/zzpu/ums/session"
 	"github.com/zzpu/ums/text"
 	"github.com/zzpu/ums/x"
 )
@@ -58,19 +63,29 @@ func TestCompleteLogin(t *testing.T) {
 			"csrf_token")
 	}
 
-	createIdentity := func(identifier, password string) {
-		p, _ := reg.Hasher().Generate([]byte(password))
-		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), &identity.Identity{
+	createIdentityWithConfig := func(identifier string, config string) uuid.UUID {
+		i := &identity.Identity{
 			ID:     x.NewUUID(),
 			Traits: identity.Traits(fmt.Sprintf(`{"subject":"%s"}`, identifier)),
 			Credentials: map[identity.CredentialsType]identity.Credentials{
 				identity.CredentialsTypePassword: {
 					Type:        identity.CredentialsTypePassword,
 					Identifiers: []string{identifier},
-					Config:      sqlxx.JSONRawMessage(`{"hashed_password":"` + string(p) + `"}`),
+					Config:      sqlxx.JSONRawMessage(config),
 				},
 			},
-		}))
+		}
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+		return i.ID
+	}
+
+	createIdentityWithHash := func(identifier string, p []byte) uuid.UUID {
+		return createIdentityWithConfig(identifier, `{"hashed_password":"`+string(p)+`"}`)
+	}
+
+	createIdentity := func(identifier, password string) {
+		p, _ := reg.Hasher().Generate([]byte(password))
+		createIdentityWithHash(identifier, p)
 	}
 
 	apiClient := testhelpers.NewDebugClient(t)
@@ -431,6 +446,147 @@ func TestCompleteLogin(t *testing.T) {
 		})
 	})
 
+	t.Run("case=should upgrade the password hash on login", func(t *testing.T) {
+		var generate = func(t *testing.T, h hash.Hasher, password string) []byte {
+			p, err := h.Generate([]byte(password))
+			require.NoError(t, err)
+			return p
+		}
+
+		viper.Set(configuration.ViperKeyHasherArgon2ConfigIterations, 2)
+		outdatedArgon2 := generate(t, reg.Hasher(), "password")
+		viper.Set(configuration.ViperKeyHasherArgon2ConfigIterations, 1)
+
+		for k, tc := range []struct {
+			d    string
+			hash []byte
+		}{
+			{d: "bcrypt", hash: generate(t, hash.NewHasherBcrypt(conf), "password")},
+			{d: "pbkdf2", hash: generate(t, &hash.PBKDF2{Algorithm: "sha512", Iterations: 10, SaltLength: 8, KeyLength: 32}, "password")},
+			{d: "ssha", hash: generate(t, &hash.SaltedSHA{Prefix: "{SSHA}", SaltLength: 8}, "password")},
+			{d: "argon2 with outdated parameters", hash: outdatedArgon2},
+		} {
+			t.Run(fmt.Sprintf("case=%d/description=%s", k, tc.d), func(t *testing.T) {
+				require.True(t, reg.Hasher().NeedsRehash(tc.hash))
+
+				identifier := x.NewUUID().String()
+				id := createIdentityWithHash(identifier, tc.hash)
+
+				body := testhelpers.SubmitLoginForm(t, true, nil, publicTS, func(v url.Values) {
+					v.Set("identifier", identifier)
+					v.Set("password", "password")
+				}, identity.CredentialsTypePassword, false, http.StatusOK, publicTS.URL+password.RouteLogin)
+				assert.Equal(t, identifier, gjson.Get(body, "session.identity.traits.subject").String(), "%s", body)
+
+				i, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), id)
+				require.NoError(t, err)
+				c, ok := i.GetCredentials(identity.CredentialsTypePassword)
+				require.True(t, ok)
+
+				upgraded := []byte(gjson.GetBytes(c.Config, "hashed_password").String())
+				assert.NotEqual(t, tc.hash, upgraded)
+				assert.False(t, reg.Hasher().NeedsRehash(upgraded), "%s", upgraded)
+				require.NoError(t, reg.Hasher().Compare([]byte("password"), upgraded))
+			})
+		}
+	})
+
+	t.Run("case=should rehash the password once the pepper was rotated", func(t *testing.T) {
+		old := configuration.PepperSecret{ID: "old", Secret: "an-old-pepper-secret-which-is-long-enough"}
+		viper.Set(configuration.ViperKeySecretsPepper, []configuration.PepperSecret{old})
+		defer viper.Set(configuration.ViperKeySecretsPepper, nil)
+
+		identifier := x.NewUUID().String()
+		p, err := reg.Hasher().Generate([]byte("password"))
+		require.NoError(t, err)
+		id := createIdentityWithHash(identifier, p)
+
+		viper.Set(configuration.ViperKeySecretsPepper, []configuration.PepperSecret{
+			{ID: "new", Secret: "a-new-pepper-secret-which-is-long-enough"}, old})
+
+		body := testhelpers.SubmitLoginForm(t, true, nil, publicTS, func(v url.Values) {
+			v.Set("identifier", identifier)
+			v.Set("password", "password")
+		}, identity.CredentialsTypePassword, false, http.StatusOK, publicTS.URL+password.RouteLogin)
+		assert.Equal(t, identifier, gjson.Get(body, "session.identity.traits.subject").String(), "%s", body)
+
+		i, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), id)
+		require.NoError(t, err)
+		c, ok := i.GetCredentials(identity.CredentialsTypePassword)
+		require.True(t, ok)
+		assert.True(t, strings.HasPrefix(gjson.GetBytes(c.Config, "hashed_password").String(), "$pepper$new$"), "%s", c.Config)
+	})
+
+	t.Run("case=should ask to change an expired password", func(t *testing.T) {
+		settingsTS := testhelpers.NewSettingsUIFlowEchoServer(t, reg)
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypePassword)+".config",
+			map[string]interface{}{"max_age": "1h"})
+		defer viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypePassword)+".config", nil)
+
+		p, err := reg.Hasher().Generate([]byte("password"))
+		require.NoError(t, err)
+
+		var login = func(t *testing.T, isAPI bool, identifier, expectedURL string) string {
+			return testhelpers.SubmitLoginForm(t, isAPI, nil, publicTS, func(v url.Values) {
+				v.Set("identifier", identifier)
+				v.Set("password", "password")
+			}, identity.CredentialsTypePassword, false, http.StatusOK, expectedURL)
+		}
+
+		t.Run("description=expired password", func(t *testing.T) {
+			identifier := x.NewUUID().String()
+			changedAt, err := time.Now().Add(-2 * time.Hour).MarshalJSON()
+			require.NoError(t, err)
+			createIdentityWithConfig(identifier, `{"hashed_password":"`+string(p)+`","changed_at":`+string(changedAt)+`}`)
+
+			t.Run("type=browser", func(t *testing.T) {
+				body := login(t, false, identifier, settingsTS.URL+"/settings-ts")
+				assert.Equal(t, identifier, gjson.Get(body, "identity.traits.subject").String(), "%s", body)
+				assert.EqualValues(t, text.InfoSelfServiceSettingsPasswordExpired, gjson.Get(body, "messages.0.id").Int(), "%s", body)
+			})
+
+			t.Run("type=api", func(t *testing.T) {
+				body := login(t, true, identifier, publicTS.URL+password.RouteLogin)
+				assert.Equal(t, identifier, gjson.Get(body, "session.identity.traits.subject").String(), "%s", body)
+				assert.True(t, gjson.Get(body, "session.credentials_expired").Bool(), "%s", body)
+
+				req, err := http.NewRequest("GET", publicTS.URL+session.RouteWhoami, nil)
+				require.NoError(t, err)
+				req.Header.Set("Authorization", "Bearer "+gjson.Get(body, "session_token").String())
+				res, err := http.DefaultClient.Do(req)
+				require.NoError(t, err)
+				defer res.Body.Close()
+				assert.Equal(t, http.StatusForbidden, res.StatusCode)
+			})
+		})
+
+		t.Run("description=password which is not expired yet", func(t *testing.T) {
+			identifier := x.NewUUID().String()
+			changedAt, err := time.Now().Add(-time.Minute).MarshalJSON()
+			require.NoError(t, err)
+			createIdentityWithConfig(identifier, `{"hashed_password":"`+string(p)+`","changed_at":`+string(changedAt)+`}`)
+
+			body := login(t, false, identifier, redirTS.URL)
+			assert.Equal(t, identifier, gjson.Get(body, "identity.traits.subject").String(), "%s", body)
+			assert.False(t, gjson.Get(body, "credentials_expired").Bool(), "%s", body)
+		})
+
+		t.Run("description=should start tracking the age of passwords without a change date", func(t *testing.T) {
+			identifier := x.NewUUID().String()
+			id := createIdentityWithHash(identifier, p)
+
+			body := login(t, false, identifier, redirTS.URL)
+			assert.Equal(t, identifier, gjson.Get(body, "identity.traits.subject").String(), "%s", body)
+
+			i, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), id)
+			require.NoError(t, err)
+			c, ok := i.GetCredentials(identity.CredentialsTypePassword)
+			require.True(t, ok)
+			assert.True(t, gjson.GetBytes(c.Config, "changed_at").Exists(), "%s", c.Config)
+			assert.Equal(t, string(p), gjson.GetBytes(c.Config, "hashed_password").String(), "%s", c.Config)
+		})
+	})
+
 	t.Run("should be a new session with forced flag", func(t *testing.T) {
 		identifier, pwd := x.NewUUID().String(), "password"
 		createIdentity(identifier, pwd)
@@ -453,3 +609,133 @@ func TestCompleteLogin(t *testing.T) {
 		assert.NotEqual(t, gjson.Get(body1, "id").String(), gjson.Get(body2, "id").String(), "%s\n\n%s\n", body1, body2)
 	})
 }
+
+type forwardedForTransport string
+
+func (ip forwardedForTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set("X-Forwarded-For", "192.0.2.255, "+string(ip))
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestLoginLockout(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/login.schema.json")
+	viper.Set(configuration.ViperKeySecretsDefault, []string{"not-a-secure-session-key"})
+
+	publicTS, adminTS := testhelpers.NewKratosServer(t, reg)
+	_ = testhelpers.NewLoginUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewErrorTestServer(t, reg)
+
+	setLockout := func(t *testing.T, lockout map[string]interface{}) {
+		lockout["enabled"] = true
+		lockout["client_ip_header"] = "X-Forwarded-For"
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypePassword),
+			map[string]interface{}{"enabled": true, "config": map[string]interface{}{"lockout": lockout}})
+	}
+
+	createIdentity := func(t *testing.T) (uuid.UUID, string) {
+		identifier := x.NewUUID().String()
+		p, err := reg.Hasher().Generate([]byte("password"))
+		require.NoError(t, err)
+		i := &identity.Identity{
+			ID:     x.NewUUID(),
+			Traits: identity.Traits(fmt.Sprintf(`{"subject":"%s"}`, identifier)),
+			Credentials: map[identity.CredentialsType]identity.Credentials{
+				identity.CredentialsTypePassword: {
+					Type:        identity.CredentialsTypePassword,
+					Identifiers: []string{identifier},
+					Config:      sqlxx.JSONRawMessage(`{"hashed_password":"` + string(p) + `"}`),
+				},
+			},
+		}
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+		return i.ID, identifier
+	}
+
+	login := func(t *testing.T, ip, identifier, pw string, code int) string {
+		return testhelpers.SubmitLoginForm(t, true, &http.Client{Transport: forwardedForTransport(ip)}, publicTS, func(v url.Values) {
+			v.Set("identifier", identifier)
+			v.Set("password", pw)
+		}, identity.CredentialsTypePassword, false, code, publicTS.URL+password.RouteLogin)
+	}
+
+	expectMessage := func(t *testing.T, body string, id text.ID) {
+		assert.EqualValues(t, id, gjson.Get(body, "methods.password.config.messages.0.id").Int(), "%s", body)
+	}
+
+	t.Run("case=should lock the identifier and unlock it through the admin API", func(t *testing.T) {
+		setLockout(t, map[string]interface{}{"delay_after": 0, "max_attempts": 2})
+		id, identifier := createIdentity(t)
+
+		for k := 0; k < 2; k++ {
+			expectMessage(t, login(t, "198.51.100.1", identifier, "wrong", http.StatusBadRequest), text.ErrorValidationInvalidCredentials)
+		}
+
+		// The identifier is locked even for the correct password and clients with other IP addresses.
+		expectMessage(t, login(t, "198.51.100.2", identifier, "password", http.StatusBadRequest), text.ErrorValidationLoginLocked)
+
+		req, err := http.NewRequest("DELETE", adminTS.URL+"/identities/"+id.String()+"/credentials/password/lockout", nil)
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+		body := login(t, "198.51.100.1", identifier, "password", http.StatusOK)
+		assert.Equal(t, identifier, gjson.Get(body, "session.identity.traits.subject").String(), "%s", body)
+	})
+
+	t.Run("case=should return 404 when unlocking an unknown identity", func(t *testing.T) {
+		req, err := http.NewRequest("DELETE", adminTS.URL+"/identities/"+x.NewUUID().String()+"/credentials/password/lockout", nil)
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("case=should reset the failures after a successful login", func(t *testing.T) {
+		setLockout(t, map[string]interface{}{"delay_after": 0, "max_attempts": 2})
+		_, identifier := createIdentity(t)
+
+		expectMessage(t, login(t, "198.51.100.3", identifier, "wrong", http.StatusBadRequest), text.ErrorValidationInvalidCredentials)
+		login(t, "198.51.100.3", identifier, "password", http.StatusOK)
+		expectMessage(t, login(t, "198.51.100.3", identifier, "wrong", http.StatusBadRequest), text.ErrorValidationInvalidCredentials)
+		login(t, "198.51.100.3", identifier, "password", http.StatusOK)
+	})
+
+	t.Run("case=should delay attempts after failures", func(t *testing.T) {
+		setLockout(t, map[string]interface{}{"delay_after": 1, "base_delay": "1h"})
+		_, identifier := createIdentity(t)
+
+		expectMessage(t, login(t, "198.51.100.4", identifier, "wrong", http.StatusBadRequest), text.ErrorValidationInvalidCredentials)
+		expectMessage(t, login(t, "198.51.100.4", identifier, "password", http.StatusBadRequest), text.ErrorValidationLoginDelayed)
+
+		setLockout(t, map[string]interface{}{"delay_after": 1, "base_delay": "1ns"})
+		login(t, "198.51.100.4", identifier, "password", http.StatusOK)
+	})
+
+	t.Run("case=should lock the IP address", func(t *testing.T) {
+		setLockout(t, map[string]interface{}{"delay_after": 0, "max_attempts_per_ip_address": 2})
+		_, identifier := createIdentity(t)
+
+		// Credential stuffing uses a different identifier for every attempt.
+		for k := 0; k < 2; k++ {
+			expectMessage(t, login(t, "198.51.100.5", x.NewUUID().String(), "wrong", http.StatusBadRequest), text.ErrorValidationInvalidCredentials)
+		}
+
+		expectMessage(t, login(t, "198.51.100.5", identifier, "password", http.StatusBadRequest), text.ErrorValidationLoginLocked)
+		login(t, "198.51.100.6", identifier, "password", http.StatusOK)
+	})
+
+	t.Run("case=should not track failures if disabled", func(t *testing.T) {
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypePassword),
+			map[string]interface{}{"enabled": true, "config": map[string]interface{}{"lockout": map[string]interface{}{"max_attempts": 1}}})
+		_, identifier := createIdentity(t)
+
+		for k := 0; k < 3; k++ {
+			expectMessage(t, login(t, "198.51.100.7", identifier, "wrong", http.StatusBadRequest), text.ErrorValidationInvalidCredentials)
+		}
+		login(t, "198.51.100.7", identifier, "password", http.StatusOK)
+	})
+}
@@ -0,0 +1,44 @@
+package password
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+type (
+	// LoginFailure is a failed attempt to sign in with a password.
+	LoginFailure struct {
+		ID uuid.UUID `json:"id" db:"id" faker:"-"`
+
+		// Identifier is the identifier which was used to sign in. It is stored as a keyed hash because it might
+		// not belong to any identity and could even be a mistyped password.
+		Identifier string `json:"-" db:"identifier"`
+
+		// IPAddress is the IP address of the client which tried to sign in.
+		IPAddress string `json:"-" db:"ip_address"`
+
+		// CreatedAt is a helper struct field for gobuffalo.pop.
+		CreatedAt time.Time `json:"-" faker:"-" db:"created_at"`
+		// UpdatedAt is a helper struct field for gobuffalo.pop.
+		UpdatedAt time.Time `json:"-" faker:"-" db:"updated_at"`
+	}
+
+	// LoginFailurePersister stores failed logins. Identifiers are compared case-insensitively and without
+	// surrounding whitespace.
+	LoginFailurePersister interface {
+		CreateLoginFailure(ctx context.Context, failure *LoginFailure) error
+		ListLoginFailuresByIdentifier(ctx context.Context, identifier string, since time.Time) ([]LoginFailure, error)
+		ListLoginFailuresByIPAddress(ctx context.Context, ipAddress string, since time.Time) ([]LoginFailure, error)
+		DeleteLoginFailuresByIdentifier(ctx context.Context, identifier string) error
+	}
+
+	LoginFailurePersistenceProvider interface {
+		LoginFailurePersister() LoginFailurePersister
+	}
+)
+
+func (f LoginFailure) TableName() string {
+	return "selfservice_login_failures"
+}
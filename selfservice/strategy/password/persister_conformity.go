@@ -0,0 +1,86 @@
+package password
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zzpu/ums/x"
+)
+
+func TestPersister(p LoginFailurePersister) func(t *testing.T) {
+	return func(t *testing.T) {
+		t.Run("case=should list no failures for unknown identifiers and addresses", func(t *testing.T) {
+			actual, err := p.ListLoginFailuresByIdentifier(context.Background(), x.NewUUID().String(), time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Len(t, actual, 0)
+
+			actual, err = p.ListLoginFailuresByIPAddress(context.Background(), "198.51.100.1", time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Len(t, actual, 0)
+		})
+
+		t.Run("case=should create, list, and delete failures", func(t *testing.T) {
+			identifier, other := x.NewUUID().String(), x.NewUUID().String()
+			ip := "203.0.113." + identifier[:2]
+
+			for k := 0; k < 3; k++ {
+				f := &LoginFailure{Identifier: identifier, IPAddress: ip}
+				require.NoError(t, p.CreateLoginFailure(context.Background(), f))
+				assert.Equal(t, identifier, f.Identifier)
+			}
+			require.NoError(t, p.CreateLoginFailure(context.Background(), &LoginFailure{Identifier: other, IPAddress: ip}))
+
+			actual, err := p.ListLoginFailuresByIdentifier(context.Background(), identifier, time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			require.Len(t, actual, 3)
+			for k := range actual {
+				assert.NotEqual(t, identifier, actual[k].Identifier, "the identifier must not be stored in plain text")
+				if k > 0 {
+					assert.False(t, actual[k].CreatedAt.Before(actual[k-1].CreatedAt))
+				}
+			}
+
+			actual, err = p.ListLoginFailuresByIdentifier(context.Background(), identifier, time.Now().Add(time.Hour))
+			require.NoError(t, err)
+			assert.Len(t, actual, 0)
+
+			actual, err = p.ListLoginFailuresByIPAddress(context.Background(), ip, time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Len(t, actual, 4)
+
+			require.NoError(t, p.DeleteLoginFailuresByIdentifier(context.Background(), identifier))
+			actual, err = p.ListLoginFailuresByIdentifier(context.Background(), identifier, time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Len(t, actual, 0)
+
+			actual, err = p.ListLoginFailuresByIdentifier(context.Background(), other, time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Len(t, actual, 1)
+
+			actual, err = p.ListLoginFailuresByIPAddress(context.Background(), ip, time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Len(t, actual, 1)
+		})
+
+		t.Run("case=should normalize the identifier", func(t *testing.T) {
+			identifier := x.NewUUID().String() + "@ory.sh"
+
+			require.NoError(t, p.CreateLoginFailure(context.Background(), &LoginFailure{Identifier: " " + strings.ToUpper(identifier), IPAddress: "203.0.113.1"}))
+			require.NoError(t, p.CreateLoginFailure(context.Background(), &LoginFailure{Identifier: identifier, IPAddress: "203.0.113.1"}))
+
+			actual, err := p.ListLoginFailuresByIdentifier(context.Background(), strings.ToUpper(identifier)+"\t", time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Len(t, actual, 2)
+
+			require.NoError(t, p.DeleteLoginFailuresByIdentifier(context.Background(), " "+identifier))
+			actual, err = p.ListLoginFailuresByIdentifier(context.Background(), identifier, time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Len(t, actual, 0)
+		})
+	}
+}
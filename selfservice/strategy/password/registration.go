@@ -3,6 +3,7 @@ package password
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/markbates/pkger"
@@ -34,9 +35,10 @@ const (
 )
 
 type RegistrationFormPayload struct {
-	Password  string          `json:"password"`
-	Traits    json.RawMessage `json:"traits"`
-	CSRFToken string          `json:"csrf_token"`
+	Password        string            `json:"password"`
+	Traits          json.RawMessage   `json:"traits"`
+	SecurityAnswers map[string]string `json:"security_answers"`
+	CSRFToken       string            `json:"csrf_token"`
 }
 
 func (s *Strategy) RegisterRegistrationRoutes(public *x.RouterPublic) {
@@ -63,6 +65,14 @@ func (s *Strategy) handleRegistrationError(w http.ResponseWriter, r *http.Reques
 				}
 			}
 
+			if s.d.SecurityQuestionsManager().Enabled() {
+				// Resetting the form removes the questions which are attached to the fields as messages.
+				if errSec := s.d.SecurityQuestionsManager().SetSecurityFormFields("security_answers", method.Config); errSec != nil {
+					s.d.RegistrationFlowErrorHandler().WriteFlowError(w, r, identity.CredentialsTypePassword, rr, errors.Wrap(err, errSec.Error()))
+					return
+				}
+			}
+
 			method.Config.SetCSRF(s.d.GenerateCSRFToken(r))
 			rr.Methods[identity.CredentialsTypePassword] = method
 			if errSec := method.Config.SortFields(s.c.DefaultIdentityTraitsSchemaURL().String()); errSec != nil {
@@ -82,6 +92,13 @@ func (s *Strategy) decode(p *RegistrationFormPayload, r *http.Request) error {
 		return errors.WithStack(err)
 	}
 
+	if s.d.SecurityQuestionsManager().Enabled() {
+		raw, err = s.d.SecurityQuestionsManager().AddAnswersToSchema(raw, "properties.security_answers")
+		if err != nil {
+			return err
+		}
+	}
+
 	compiler, err := decoderx.HTTPRawJSONSchemaCompiler(raw)
 	if err != nil {
 		return errors.WithStack(err)
@@ -179,7 +196,8 @@ func (s *Strategy) handleRegistration(w http.ResponseWriter, r *http.Request, _
 		return
 	}
 
-	co, err := json.Marshal(&CredentialsConfig{HashedPassword: string(hpw)})
+	now := time.Now().UTC()
+	co, err := json.Marshal(&CredentialsConfig{HashedPassword: string(hpw), ChangedAt: &now})
 	if err != nil {
 		s.handleRegistrationError(w, r, ar, &p, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode password options to JSON: %s", err)))
 		return
@@ -194,6 +212,13 @@ func (s *Strategy) handleRegistration(w http.ResponseWriter, r *http.Request, _
 		return
 	}
 
+	if s.d.SecurityQuestionsManager().Enabled() {
+		if err := s.d.SecurityQuestionsManager().SetSecurityAnswers(r.Context(), i, p.SecurityAnswers, "#/security_answers"); err != nil {
+			s.handleRegistrationError(w, r, ar, &p, err)
+			return
+		}
+	}
+
 	if err := s.d.RegistrationExecutor().PostRegistrationHook(w, r, identity.CredentialsTypePassword, ar, i); err != nil {
 		s.handleRegistrationError(w, r, ar, &p, err)
 		return
@@ -237,6 +262,12 @@ func (s *Strategy) PopulateRegistrationMethod(r *http.Request, sr *registration.
 	htmlf.SetCSRF(s.d.GenerateCSRFToken(r))
 	htmlf.SetField(form.Field{Name: "password", Type: "password", Required: true})
 
+	if s.d.SecurityQuestionsManager().Enabled() {
+		if err := s.d.SecurityQuestionsManager().SetSecurityFormFields("security_answers", htmlf); err != nil {
+			return err
+		}
+	}
+
 	if err := htmlf.SortFields(s.c.DefaultIdentityTraitsSchemaURL().String()); err != nil {
 		return err
 	}
@@ -1,6 +1,7 @@
 package password_test
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -498,6 +499,42 @@ func TestRegistration(t *testing.T) {
 				assert.Equal(t, `registration-identifier-10-browser`, gjson.Get(actual, "identity.traits.username").String(), "%s", actual)
 			})
 		})
+
+		t.Run("case=should save the answers to the security questions", func(t *testing.T) {
+			viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://stub/registration.schema.json")
+			viper.Set(configuration.HookStrategyKey(configuration.ViperKeySelfServiceRegistrationAfter, identity.CredentialsTypePassword.String()), []configuration.SelfServiceHook{{Name: "session"}})
+			viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".security_questions", map[string]interface{}{
+				"enabled": true, "config": map[string]interface{}{"questions": []map[string]interface{}{{"id": "first_pet", "label": "What was the name of your first pet?"}}}})
+			defer viper.Set(configuration.HookStrategyKey(configuration.ViperKeySelfServiceRegistrationAfter, identity.CredentialsTypePassword.String()), nil)
+			defer viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".security_questions", nil)
+
+			var values = func(isAPI bool) func(v url.Values) {
+				return func(v url.Values) {
+					v.Set("traits.username", "registration-identifier-11-browser")
+					if isAPI {
+						v.Set("traits.username", "registration-identifier-11-api")
+					}
+					v.Set("password", x.NewUUID().String())
+					v.Set("traits.foobar", "bar")
+					v.Set("security_answers.first_pet", "Rex the dog")
+				}
+			}
+
+			var check = func(t *testing.T, actual string) {
+				i, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), x.ParseUUID(gjson.Get(actual, "identity.id").String()))
+				require.NoError(t, err, "%s", actual)
+				require.Len(t, i.RecoverySecurityAnswers, 1)
+				assert.Equal(t, "first_pet", i.RecoverySecurityAnswers[0].QuestionID)
+			}
+
+			t.Run("type=api", func(t *testing.T) {
+				check(t, expectSuccessfulLogin(t, true, nil, values(true)))
+			})
+
+			t.Run("type=browser", func(t *testing.T) {
+				check(t, expectSuccessfulLogin(t, false, nil, values(false)))
+			})
+		})
 	})
 
 	t.Run("method=PopulateSignUpMethod", func(t *testing.T) {
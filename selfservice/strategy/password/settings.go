@@ -2,6 +2,7 @@ package password
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
 	"time"
@@ -20,6 +21,7 @@ import (
 	"github.com/zzpu/ums/selfservice/flow"
 	"github.com/zzpu/ums/selfservice/flow/settings"
 	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/text"
 	"github.com/zzpu/ums/x"
 )
 
@@ -168,29 +170,46 @@ func (s *Strategy) continueSettingsFlow(
 		return
 	}
 
-	hpw, err := s.d.Hasher().Generate([]byte(p.Password))
+	conf, err := s.Config()
 	if err != nil {
 		s.handleSettingsError(w, r, ctxUpdate, p, err)
 		return
 	}
 
-	co, err := json.Marshal(&CredentialsConfig{HashedPassword: string(hpw)})
-	if err != nil {
-		s.handleSettingsError(w, r, ctxUpdate, p, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode password options to JSON: %s", err)))
-		return
-	}
-
 	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), ctxUpdate.Session.Identity.ID)
 	if err != nil {
 		s.handleSettingsError(w, r, ctxUpdate, p, err)
 		return
 	}
 
+	var o CredentialsConfig
 	c, ok := i.GetCredentials(s.ID())
 	if !ok {
 		c = &identity.Credentials{Type: s.ID(),
 			// We need to insert a random identifier now...
 			Identifiers: []string{x.NewUUID().String()}}
+	} else if len(c.Config) > 0 {
+		if err := json.Unmarshal(c.Config, &o); err != nil {
+			s.handleSettingsError(w, r, ctxUpdate, p, errors.WithStack(herodot.ErrInternalServerError.WithReason("The password credentials could not be decoded properly").WithDebug(err.Error())))
+			return
+		}
+	}
+
+	hpw, err := s.d.Hasher().Generate([]byte(p.Password))
+	if err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	co, err := json.Marshal(&CredentialsConfig{
+		HashedPassword:          string(hpw),
+		PreviousHashedPasswords: recentHashedPasswords(&o, conf.HistorySize-1),
+		ChangedAt:               &now,
+	})
+	if err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode password options to JSON: %s", err)))
+		return
 	}
 
 	c.Config = co
@@ -200,14 +219,55 @@ func (s *Strategy) continueSettingsFlow(
 		return
 	}
 
-	if err := s.d.SettingsHookExecutor().PostSettingsHook(w, r,
-		s.SettingsStrategyID(), ctxUpdate, i); err != nil {
+	if err := s.validatePasswordHistory(&o, p.Password, conf.HistorySize); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	if err := s.d.SettingsHookExecutor().PostSettingsHook(w, r, s.SettingsStrategyID(), ctxUpdate, i, settings.WithCallback(func(ctxUpdate *settings.UpdateContext) error {
+		// The new password has not expired, so the sessions issued with the old one can be used again.
+		ctxUpdate.Session.CredentialsExpired = false
+		return s.d.SessionPersister().ClearCredentialsExpiredByIdentity(r.Context(), i.ID)
+	})); err != nil {
 		s.handleSettingsError(w, r, ctxUpdate, p, err)
 		return
 	}
 }
 
-func (s *Strategy) PopulateSettingsMethod(r *http.Request, _ *identity.Identity, f *settings.Flow) error {
+// validatePasswordHistory returns an error if the password matches one of the size most recent passwords.
+func (s *Strategy) validatePasswordHistory(o *CredentialsConfig, password string, size int) error {
+	for _, hpw := range recentHashedPasswords(o, size) {
+		// Hashes which can no longer be compared, for example because their pepper was removed, are skipped.
+		if err := s.d.Hasher().Compare([]byte(password), []byte(hpw)); err == nil {
+			return schema.NewPasswordPolicyViolationError("#/password", fmt.Sprintf("it matches one of the last %d passwords", size))
+		}
+	}
+	return nil
+}
+
+// recentHashedPasswords returns the hashes of the current and the previous passwords, limited to the n most recent ones.
+func recentHashedPasswords(o *CredentialsConfig, n int) []string {
+	var hashes []string
+	if len(o.HashedPassword) > 0 {
+		hashes = append(hashes, o.HashedPassword)
+	}
+	hashes = append(hashes, o.PreviousHashedPasswords...)
+
+	if n <= 0 {
+		return nil
+	} else if len(hashes) > n {
+		return hashes[:n]
+	}
+	return hashes
+}
+
+func (s *Strategy) PopulateSettingsMethod(r *http.Request, i *identity.Identity, f *settings.Flow) error {
+	if expired, err := s.CredentialsExpired(r, i); err != nil {
+		return err
+	} else if expired {
+		f.Messages.Add(text.NewInfoSelfServiceSettingsPasswordExpired())
+	}
+
 	hf := &form.HTMLForm{Action: urlx.CopyWithQuery(urlx.AppendPaths(s.c.SelfPublicURL(), RouteSettings),
 		url.Values{"flow": {f.ID.String()}}).String(), Fields: form.Fields{{Name: "password",
 		Type: "password", Required: true}}, Method: "POST"}
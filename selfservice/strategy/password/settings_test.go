@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -26,6 +27,7 @@ import (
 	"github.com/zzpu/ums/selfservice/flow/settings"
 	"github.com/zzpu/ums/selfservice/strategy/password"
 	"github.com/zzpu/ums/selfservice/strategy/profile"
+	"github.com/zzpu/ums/session"
 	"github.com/zzpu/ums/x"
 )
 
@@ -288,3 +290,87 @@ func TestSettings(t *testing.T) {
 		})
 	})
 }
+
+func TestSettingsPasswordHistory(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+	viper.Set(configuration.ViperKeySelfServiceBrowserDefaultReturnTo, "https://www.ory.sh/")
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/profile.schema.json")
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypePassword),
+		map[string]interface{}{"enabled": true, "config": map[string]interface{}{"history_size": 3}})
+	testhelpers.StrategyEnable(settings.StrategyProfile, true)
+
+	_ = testhelpers.NewSettingsUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewErrorTestServer(t, reg)
+	_ = testhelpers.NewLoginUIWith401Response(t)
+	viper.Set(configuration.ViperKeySelfServiceSettingsPrivilegedAuthenticationAfter, "5m")
+
+	id := newIdentityWithPassword("john-history@doe.com")
+	publicTS, _ := testhelpers.NewKratosServer(t, reg)
+	hc := testhelpers.NewHTTPClientWithIdentitySessionToken(t, reg, id)
+
+	var submit = func(t *testing.T, pw string, code int) string {
+		return testhelpers.SubmitSettingsForm(t, true, hc, publicTS, func(v url.Values) {
+			v.Set("password", pw)
+		}, identity.CredentialsTypePassword.String(), code, publicTS.URL+password.RouteSettings)
+	}
+
+	passwords := []string{"cojaqeflkgokpapvisvojn", "luxekofaxohtzmuvbzruyl", "nebrumwaspuxowgjicikfa", "vuzyqiwamojmzobsuxmsnq"}
+	for _, pw := range passwords[:3] {
+		submit(t, pw, http.StatusOK)
+	}
+
+	for _, pw := range passwords[:3] {
+		actual := submit(t, pw, http.StatusBadRequest)
+		assert.Contains(t, gjson.Get(actual, "methods.password.config.fields.#(name==password).messages.0.text").String(), "it matches one of the last 3 passwords", "%s", actual)
+	}
+
+	// The first password dropped out of the history once the fourth was set.
+	submit(t, passwords[3], http.StatusOK)
+	submit(t, passwords[0], http.StatusOK)
+
+	actualIdentity, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), id.ID)
+	require.NoError(t, err)
+	cfg := actualIdentity.Credentials[identity.CredentialsTypePassword].Config
+	assert.True(t, gjson.GetBytes(cfg, "changed_at").Exists(), "%s", cfg)
+	assert.Len(t, gjson.GetBytes(cfg, "previous_hashed_passwords").Array(), 2, "%s", cfg)
+	require.NoError(t, reg.Hasher().Compare([]byte(passwords[0]), []byte(gjson.GetBytes(cfg, "hashed_password").String())))
+}
+
+func TestSettingsExpiredPassword(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+	viper.Set(configuration.ViperKeySelfServiceBrowserDefaultReturnTo, "https://www.ory.sh/")
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/profile.schema.json")
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypePassword),
+		map[string]interface{}{"enabled": true, "config": map[string]interface{}{"max_age": "1h"}})
+	testhelpers.StrategyEnable(settings.StrategyProfile, true)
+
+	_ = testhelpers.NewSettingsUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewErrorTestServer(t, reg)
+	_ = testhelpers.NewLoginUIWith401Response(t)
+	viper.Set(configuration.ViperKeySelfServiceSettingsPrivilegedAuthenticationAfter, "5m")
+
+	id := newIdentityWithPassword("john-expired@doe.com")
+	publicTS, _ := testhelpers.NewKratosServer(t, reg)
+
+	sess := session.NewActiveSession(id, testhelpers.NewSessionLifespanProvider(time.Hour), time.Now())
+	sess.CredentialsExpired = true
+	hc := testhelpers.NewHTTPClientWithSessionToken(t, reg, sess)
+
+	res, err := hc.Get(publicTS.URL + session.RouteWhoami)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	testhelpers.SubmitSettingsForm(t, true, hc, publicTS, func(v url.Values) {
+		v.Set("password", "cojaqeflkgokpapvisvojn")
+	}, identity.CredentialsTypePassword.String(), http.StatusOK, publicTS.URL+password.RouteSettings)
+
+	actual, err := reg.SessionPersister().GetSession(context.Background(), sess.ID)
+	require.NoError(t, err)
+	assert.False(t, actual.CredentialsExpired)
+
+	res, err = hc.Get(publicTS.URL + session.RouteWhoami)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
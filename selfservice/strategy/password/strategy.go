@@ -2,7 +2,6 @@ package password
 
 import (
 	"encoding/json"
-	"strings"
 
 	"github.com/pkg/errors"
 	"gopkg.in/go-playground/validator.v9"
@@ -17,11 +16,13 @@ import (
 	"github.com/zzpu/ums/selfservice/flow/login"
 	"github.com/zzpu/ums/selfservice/flow/registration"
 	"github.com/zzpu/ums/selfservice/flow/settings"
+	"github.com/zzpu/ums/selfservice/mfa/questions"
 	"github.com/zzpu/ums/session"
 	"github.com/zzpu/ums/x"
 )
 
 var _ login.Strategy = new(Strategy)
+var _ login.ExpiringCredentialsStrategy = new(Strategy)
 var _ registration.Strategy = new(Strategy)
 var _ identity.ActiveCredentialsCounter = new(Strategy)
 
@@ -59,6 +60,11 @@ type registrationStrategyDependencies interface {
 
 	session.HandlerProvider
 	session.ManagementProvider
+	session.PersistenceProvider
+
+	questions.ManagementProvider
+
+	LoginFailurePersistenceProvider
 }
 
 type Strategy struct {
@@ -77,7 +83,7 @@ func (s *Strategy) CountActiveCredentials(cc map[identity.CredentialsType]identi
 			}
 
 			if len(c.Identifiers) > 0 && len(c.Identifiers[0]) > 0 &&
-				strings.HasPrefix(conf.HashedPassword, "$argon2id$") {
+				hash.HasKnownAlgorithm([]byte(conf.HashedPassword)) {
 				count++
 			}
 		}
@@ -85,6 +85,14 @@ func TestCountActiveCredentials(t *testing.T) {
 			}},
 			expected: 1,
 		},
+		{
+			in: identity.CredentialsCollection{{
+				Type:        strategy.ID(),
+				Identifiers: []string{"foo"},
+				Config:      []byte(`{"hashed_password": "$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga"}`),
+			}},
+			expected: 1,
+		},
 		{
 			in: identity.CredentialsCollection{{
 				Type:   strategy.ID(),
@@ -92,6 +100,14 @@ func TestCountActiveCredentials(t *testing.T) {
 			}},
 			expected: 0,
 		},
+		{
+			in: identity.CredentialsCollection{{
+				Type:        strategy.ID(),
+				Identifiers: []string{"foo"},
+				Config:      []byte(`{"hashed_password": "asdf"}`),
+			}},
+			expected: 0,
+		},
 		{
 			in: identity.CredentialsCollection{{
 				Type:   strategy.ID(),
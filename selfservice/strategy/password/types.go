@@ -1,12 +1,23 @@
 package password
 
-import "github.com/zzpu/ums/selfservice/form"
+import (
+	"time"
+
+	"github.com/zzpu/ums/selfservice/form"
+)
 
 type (
 	// CredentialsConfig is the struct that is being used as part of the identity credentials.
 	CredentialsConfig struct {
 		// HashedPassword is a hash-representation of the password.
 		HashedPassword string `json:"hashed_password"`
+
+		// PreviousHashedPasswords are the hashes of the passwords used before, most recent first. They are
+		// kept to prevent reusing passwords.
+		PreviousHashedPasswords []string `json:"previous_hashed_passwords,omitempty"`
+
+		// ChangedAt is the time the password was set. It is used to expire passwords.
+		ChangedAt *time.Time `json:"changed_at,omitempty"`
 	}
 
 	// CompleteSelfServiceLoginFlowWithPasswordMethod is used to decode the login form payload.
@@ -2,13 +2,19 @@ package password
 
 import (
 	"bufio"
+	"bytes"
 	/* #nosec G505 sha1 is used for k-anonymity */
 	"crypto/sha1"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math/bits"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"unicode/utf8"
 
 	"github.com/arbovm/levenshtein"
 
@@ -46,26 +52,106 @@ var ErrUnexpectedStatusCode = errors.New("unexpected status code")
 // Additionally passwords are being checked against Troy Hunt's
 // [haveibeenpwnd](https://haveibeenpwned.com/API/v2#SearchingPwnedPasswordsByRange) service to check if the
 // password has been breached in a previous data leak using k-anonymity.
+//
+// If a local haveibeenpwned dataset is configured, passwords are checked against the dataset instead and no
+// network requests are made.
 type DefaultPasswordValidator struct {
 	sync.RWMutex
 	c      *http.Client
 	hashes map[string]int64
 
-	maxBreachesThreshold int64
-	ignoreNetworkErrors  bool
+	haveIBeenPwnedEnabled bool
+	dataset               string
+	maxBreachesThreshold  int64
+	ignoreNetworkErrors   bool
 
 	minIdentifierPasswordDist            int
 	maxIdentifierPasswordSubstrThreshold float32
+
+	minLength                int
+	maxLength                int
+	requiredCharacterClasses []characterClass
+	minCharacterClasses      int
+	minStrengthScore         int
+	bannedWords              []string
+}
+
+// ValidatorConfiguration is the part of the password method's configuration used by the DefaultPasswordValidator.
+type ValidatorConfiguration struct {
+	// HaveIBeenPwnedEnabled enables checking passwords against the haveibeenpwned dataset.
+	HaveIBeenPwnedEnabled bool `json:"haveibeenpwned_enabled"`
+
+	// HaveIBeenPwnedDataset is the path of a local haveibeenpwned dataset. It is either a directory containing
+	// one `<PREFIX>.txt` file per range or an index built with `kratos hibp index`. If set, passwords are
+	// checked offline.
+	HaveIBeenPwnedDataset string `json:"haveibeenpwned_dataset"`
+
+	// MaxBreaches is the number of data breaches a password may appear in before it is rejected.
+	MaxBreaches int64 `json:"max_breaches"`
+
+	// IgnoreNetworkErrors accepts passwords if the haveibeenpwned API can not be reached.
+	IgnoreNetworkErrors bool `json:"ignore_network_errors"`
+
+	// MinLength is the minimum number of characters of a password.
+	MinLength int `json:"min_length"`
+
+	// MaxLength is the maximum number of characters of a password. Zero does not limit the length.
+	MaxLength int `json:"max_length"`
+
+	// MinIdentifierDistance is the minimum Levenshtein distance between the password and the identifiers.
+	MinIdentifierDistance int `json:"min_identifier_distance"`
+
+	// MaxIdentifierSubstringRatio is the maximum length of the longest common substring of the password and
+	// an identifier, relative to the length of the password.
+	MaxIdentifierSubstringRatio float32 `json:"max_identifier_substring_ratio"`
+
+	// RequiredCharacterClasses are the character classes (lowercase, uppercase, digit and symbol) every
+	// password must contain.
+	RequiredCharacterClasses []string `json:"required_character_classes"`
+
+	// MinCharacterClasses is the number of distinct character classes every password must contain.
+	MinCharacterClasses int `json:"min_character_classes"`
+
+	// MinStrengthScore is the minimum estimated strength of a password, from 0 (too guessable) to 4 (very
+	// unguessable).
+	MinStrengthScore int `json:"min_strength_score"`
+
+	// BannedWords are words which passwords must not contain.
+	BannedWords []string `json:"banned_words"`
+
+	// BannedWordsFile is the path of a file containing one banned word per line.
+	BannedWordsFile string `json:"banned_words_file"`
+}
+
+func defaultValidatorConfiguration() ValidatorConfiguration {
+	return ValidatorConfiguration{
+		HaveIBeenPwnedEnabled:       true,
+		IgnoreNetworkErrors:         true,
+		MinLength:                   6,
+		MinIdentifierDistance:       5,
+		MaxIdentifierSubstringRatio: 0.5,
+	}
+}
+
+// NewValidatorConfiguration decodes the password method's configuration. Keys not used by the validator are ignored.
+func NewValidatorConfiguration(config json.RawMessage) (*ValidatorConfiguration, error) {
+	c := defaultValidatorConfiguration()
+	if err := json.NewDecoder(bytes.NewBuffer(config)).Decode(&c); err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode password method configuration: %s", err))
+	}
+	return &c, nil
 }
 
 func NewDefaultPasswordValidatorStrategy() *DefaultPasswordValidator {
 	return &DefaultPasswordValidator{
 		c:                                    httpx.NewResilientClientLatencyToleranceMedium(nil),
+		haveIBeenPwnedEnabled:                true,
 		maxBreachesThreshold:                 0,
 		hashes:                               map[string]int64{},
 		ignoreNetworkErrors:                  true,
 		minIdentifierPasswordDist:            5,
 		maxIdentifierPasswordSubstrThreshold: 0.5,
+		minLength:                            6,
 	}
 }
 
@@ -75,6 +161,53 @@ func NewDefaultPasswordValidatorStrategyStrict() *DefaultPasswordValidator {
 	return v
 }
 
+func NewDefaultPasswordValidatorStrategyFromConfig(c *ValidatorConfiguration) (*DefaultPasswordValidator, error) {
+	v := NewDefaultPasswordValidatorStrategy()
+	v.haveIBeenPwnedEnabled = c.HaveIBeenPwnedEnabled
+	v.dataset = c.HaveIBeenPwnedDataset
+	v.maxBreachesThreshold = c.MaxBreaches
+	v.ignoreNetworkErrors = c.IgnoreNetworkErrors
+	v.minIdentifierPasswordDist = c.MinIdentifierDistance
+	v.maxIdentifierPasswordSubstrThreshold = c.MaxIdentifierSubstringRatio
+	v.minLength = c.MinLength
+	v.maxLength = c.MaxLength
+	v.minCharacterClasses = c.MinCharacterClasses
+	v.minStrengthScore = c.MinStrengthScore
+
+	for _, name := range c.RequiredCharacterClasses {
+		class, ok := characterClassesByName[name]
+		if !ok {
+			return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unknown character class %q, expected one of lowercase, uppercase, digit and symbol.", name))
+		}
+		v.requiredCharacterClasses = append(v.requiredCharacterClasses, class)
+	}
+
+	words := c.BannedWords
+	if len(c.BannedWordsFile) > 0 {
+		f, err := os.Open(c.BannedWordsFile)
+		if err != nil {
+			return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to open the banned words file: %s", err))
+		}
+		defer f.Close()
+
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			words = append(words, sc.Text())
+		}
+		if err := sc.Err(); err != nil {
+			return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to read the banned words file: %s", err))
+		}
+	}
+
+	for _, word := range words {
+		if word = normalizeWord(strings.TrimSpace(word)); len(word) > 0 {
+			v.bannedWords = append(v.bannedWords, word)
+		}
+	}
+
+	return v, nil
+}
+
 func b20(src []byte) string {
 	return fmt.Sprintf("%X", src)
 }
@@ -102,6 +235,10 @@ func lcsLength(a, b string) int {
 }
 
 func (s *DefaultPasswordValidator) fetch(hpw []byte) error {
+	if len(s.dataset) > 0 {
+		return s.fetchOffline(hpw)
+	}
+
 	prefix := fmt.Sprintf("%X", hpw)[0:5]
 	loc := fmt.Sprintf("https://api.pwnedpasswords.com/range/%s", prefix)
 	res, err := s.c.Get(loc)
@@ -114,15 +251,34 @@ func (s *DefaultPasswordValidator) fetch(hpw []byte) error {
 		return errors.Wrapf(ErrUnexpectedStatusCode, "%d", res.StatusCode)
 	}
 
+	return s.storeRange(hpw, prefix, res.Body)
+}
+
+// storeRange caches the hashes of a range in the format `<SUFFIX>:<COUNT>` as returned by the
+// haveibeenpwned API.
+func (s *DefaultPasswordValidator) storeRange(hpw []byte, prefix string, r io.Reader) error {
 	s.Lock()
 	s.hashes[b20(hpw)] = 0
 	s.Unlock()
 
-	sc := bufio.NewScanner(res.Body)
+	return scanRange(prefix, r, func(hash string, count int64) error {
+		s.Lock()
+		s.hashes[hash] = count
+		s.Unlock()
+		return nil
+	})
+}
+
+// scanRange parses rows in the format `<HASH>:<COUNT>` and calls fn with the prefix prepended to each hash.
+func scanRange(prefix string, r io.Reader, fn func(hash string, count int64) error) error {
+	sc := bufio.NewScanner(r)
 	for sc.Scan() {
 		row := sc.Text()
-		result := stringsx.Splitx(strings.TrimSpace(row), ":")
+		if len(strings.TrimSpace(row)) == 0 {
+			continue
+		}
 
+		result := stringsx.Splitx(strings.TrimSpace(row), ":")
 		if len(result) != 2 {
 			return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Expected password hash from remote to contain two parts separated by a double dot but got: %v (%s)", result, row))
 		}
@@ -132,9 +288,9 @@ func (s *DefaultPasswordValidator) fetch(hpw []byte) error {
 			return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Expected password hash to contain a count formatted as int but got: %s", result[1]))
 		}
 
-		s.Lock()
-		s.hashes[(prefix + result[0])] = count
-		s.Unlock()
+		if err := fn(prefix+strings.ToUpper(result[0]), count); err != nil {
+			return err
+		}
 	}
 
 	if err := sc.Err(); err != nil {
@@ -145,8 +301,10 @@ func (s *DefaultPasswordValidator) fetch(hpw []byte) error {
 }
 
 func (s *DefaultPasswordValidator) Validate(identifier, password string) error {
-	if len(password) < 6 {
-		return errors.Errorf("password length must be at least 6 characters but only got %d", len(password))
+	if l := utf8.RuneCountInString(password); l < s.minLength {
+		return errors.Errorf("password length must be at least %d characters but only got %d", s.minLength, l)
+	} else if s.maxLength > 0 && l > s.maxLength {
+		return errors.Errorf("password length must be at most %d characters but got %d", s.maxLength, l)
 	}
 
 	compIdentifier, compPassword := strings.ToLower(identifier), strings.ToLower(password)
@@ -156,6 +314,46 @@ func (s *DefaultPasswordValidator) Validate(identifier, password string) error {
 		return errors.Errorf("the password is too similar to the user identifier")
 	}
 
+	if err := s.validateCharacterClasses(password); err != nil {
+		return err
+	}
+
+	normalized := normalizeWord(password)
+	for _, word := range s.bannedWords {
+		if strings.Contains(normalized, word) {
+			return errors.Errorf("the password contains the banned word %q", word)
+		}
+	}
+
+	if s.minStrengthScore > 0 {
+		if score := estimateStrength(password, s.bannedWords); score < s.minStrengthScore {
+			return errors.Errorf("the password is too easy to guess, its strength is %d but must be at least %d", score, s.minStrengthScore)
+		}
+	}
+
+	if !s.haveIBeenPwnedEnabled {
+		return nil
+	}
+
+	return s.validateBreaches(password)
+}
+
+func (s *DefaultPasswordValidator) validateCharacterClasses(password string) error {
+	found := characterClasses(password)
+	for _, class := range s.requiredCharacterClasses {
+		if found&class == 0 {
+			return errors.Errorf("the password must contain at least one %s", characterClassDescriptions[class])
+		}
+	}
+
+	if n := bits.OnesCount(uint(found)); n < s.minCharacterClasses {
+		return errors.Errorf("the password must contain characters of at least %d of the classes lowercase letters, uppercase letters, digits and symbols but only contains %d", s.minCharacterClasses, n)
+	}
+
+	return nil
+}
+
+func (s *DefaultPasswordValidator) validateBreaches(password string) error {
 	/* #nosec G401 sha1 is used for k-anonymity */
 	h := sha1.New()
 	if _, err := h.Write([]byte(password)); err != nil {
@@ -175,7 +373,7 @@ func (s *DefaultPasswordValidator) Validate(identifier, password string) error {
 			return err
 		}
 
-		return s.Validate(identifier, password)
+		return s.validateBreaches(password)
 	}
 
 	if c > s.maxBreachesThreshold {
@@ -0,0 +1,201 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// The index of a haveibeenpwned dataset starts with indexMagic followed by records which are sorted by hash.
+// Each record consists of the 20 byte SHA-1 hash and the number of breaches as big-endian uint32.
+const (
+	indexMagic      = "HIBPIDX1"
+	indexHashLength = 20
+	indexRecordSize = indexHashLength + 4
+)
+
+var rangeFilePattern = regexp.MustCompile(`^[0-9A-Fa-f]{5}\.txt$`)
+
+// fetchOffline looks the password hash up in the local dataset which is either a directory of range files
+// or an index built by BuildHaveIBeenPwnedIndex.
+func (s *DefaultPasswordValidator) fetchOffline(hpw []byte) error {
+	fi, err := os.Stat(s.dataset)
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to open the haveibeenpwned dataset: %s", err))
+	}
+
+	if fi.IsDir() {
+		prefix := b20(hpw)[0:5]
+		f, err := os.Open(filepath.Join(s.dataset, prefix+".txt"))
+		if err != nil {
+			return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to open range %s of the haveibeenpwned dataset: %s", prefix, err))
+		}
+		defer f.Close()
+
+		return s.storeRange(hpw, prefix, f)
+	}
+
+	count, err := lookupIndex(s.dataset, hpw)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	s.hashes[b20(hpw)] = count
+	s.Unlock()
+	return nil
+}
+
+// lookupIndex returns the number of breaches of the SHA-1 hash using a binary search over the index.
+func lookupIndex(path string, hpw []byte) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to open the haveibeenpwned index: %s", err))
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to open the haveibeenpwned index: %s", err))
+	}
+
+	magic := make([]byte, len(indexMagic))
+	if _, err := f.ReadAt(magic, 0); err != nil || string(magic) != indexMagic || (fi.Size()-int64(len(indexMagic)))%indexRecordSize != 0 {
+		return 0, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("File %s is not a valid haveibeenpwned index.", path))
+	}
+
+	record := make([]byte, indexRecordSize)
+	lo, hi := int64(0), (fi.Size()-int64(len(indexMagic)))/indexRecordSize
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if _, err := f.ReadAt(record, int64(len(indexMagic))+mid*indexRecordSize); err != nil {
+			return 0, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to read the haveibeenpwned index: %s", err))
+		}
+
+		switch c := bytes.Compare(record[:indexHashLength], hpw); {
+		case c == 0:
+			return int64(binary.BigEndian.Uint32(record[indexHashLength:])), nil
+		case c < 0:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+
+	return 0, nil
+}
+
+// BuildHaveIBeenPwnedIndex writes a compact index of a haveibeenpwned dataset to w. The source is either a
+// directory containing one `<PREFIX>.txt` file per range with rows in the format `<SUFFIX>:<COUNT>`, or a
+// single file with rows in the format `<HASH>:<COUNT>`. This is the format of the dataset downloaded with
+// the official PwnedPasswordsDownloader. Rows must be ordered by hash, which they are in the downloaded
+// dataset, and counts exceeding the range of uint32 are capped.
+//
+// It returns the number of hashes written to the index.
+func BuildHaveIBeenPwnedIndex(w io.Writer, source string) (int64, error) {
+	fi, err := os.Stat(source)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(indexMagic); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	var written int64
+	var previous []byte
+	record := make([]byte, indexRecordSize)
+	add := func(hash string, count int64) error {
+		if len(hash) != indexHashLength*2 {
+			return errors.Errorf("expected a SHA-1 hash with %d hexadecimal characters but got: %s", indexHashLength*2, hash)
+		}
+
+		if _, err := hex.Decode(record[:indexHashLength], []byte(hash)); err != nil {
+			return errors.Errorf("expected a hexadecimal SHA-1 hash but got: %s", hash)
+		}
+
+		if previous != nil && bytes.Compare(previous, record[:indexHashLength]) >= 0 {
+			return errors.Errorf("the hashes of the dataset must be in ascending order but %s is not", hash)
+		}
+
+		if count > math.MaxUint32 {
+			count = math.MaxUint32
+		} else if count < 0 {
+			count = 0
+		}
+		binary.BigEndian.PutUint32(record[indexHashLength:], uint32(count))
+
+		if _, err := bw.Write(record); err != nil {
+			return errors.WithStack(err)
+		}
+
+		previous = append(previous[:0], record[:indexHashLength]...)
+		written++
+		return nil
+	}
+
+	if !fi.IsDir() {
+		if err := scanFile(source, "", add); err != nil {
+			return 0, err
+		}
+	} else {
+		files, err := ioutil.ReadDir(source)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		var ranges []string
+		for _, f := range files {
+			if !f.IsDir() && rangeFilePattern.MatchString(f.Name()) {
+				ranges = append(ranges, f.Name())
+			}
+		}
+
+		if len(ranges) == 0 {
+			return 0, errors.Errorf("directory %s does not contain any range files named <PREFIX>.txt", source)
+		}
+
+		for _, name := range ranges {
+			prefix := strings.ToUpper(strings.TrimSuffix(name, ".txt"))
+			if err := scanFile(filepath.Join(source, name), prefix, add); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return written, nil
+}
+
+func scanFile(path, prefix string, fn func(hash string, count int64) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	if err := scanRange(prefix, f, fn); err != nil {
+		var he *herodot.DefaultError
+		if errors.As(err, &he) {
+			return errors.Errorf("unable to read %s: %s", path, he.ReasonField)
+		}
+		return errors.WithMessagef(err, "unable to read %s", path)
+	}
+	return nil
+}
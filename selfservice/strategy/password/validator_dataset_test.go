@@ -0,0 +1,182 @@
+package password
+
+import (
+	"bytes"
+	/* #nosec G505 sha1 is used for k-anonymity */
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha1Hex(password string) string {
+	/* #nosec G401 sha1 is used for k-anonymity */
+	h := sha1.Sum([]byte(password))
+	return b20(h[:])
+}
+
+func TestOfflinePasswordValidationStrategy(t *testing.T) {
+	breached := map[string]int64{
+		"mafgupfuwo": 1,
+		"zunhenrimo": 5,
+		"wubulsomok": 1 << 40,
+	}
+
+	// Every password shares its range with a few other hashes, as is the case in the real dataset.
+	rows := map[string][]string{}
+	for pw, count := range breached {
+		hash := sha1Hex(pw)
+		rows[hash[:5]] = append(rows[hash[:5]], fmt.Sprintf("%s:%d", hash[5:], count))
+	}
+	for _, pw := range []string{"rarjuvdoco", "pastibifda"} {
+		hash := sha1Hex(pw)
+		if _, ok := rows[hash[:5]]; !ok {
+			rows[hash[:5]] = []string{}
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "kratos-hibp-")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	ranges := filepath.Join(dir, "ranges")
+	require.NoError(t, os.Mkdir(ranges, 0700))
+	for prefix, r := range rows {
+		var b bytes.Buffer
+		for _, hash := range []string{"00000000000000000000000000000000000", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"} {
+			r = append(r, hash+":3")
+		}
+		sort.Strings(r)
+		for _, row := range r {
+			_, _ = fmt.Fprintf(&b, "%s\r\n", row)
+		}
+		require.NoError(t, ioutil.WriteFile(filepath.Join(ranges, prefix+".txt"), b.Bytes(), 0600))
+	}
+
+	index := filepath.Join(dir, "hibp.idx")
+	f, err := os.Create(index)
+	require.NoError(t, err)
+	count, err := BuildHaveIBeenPwnedIndex(f, ranges)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.EqualValues(t, len(breached)+2*len(rows), count)
+
+	for _, dataset := range []string{ranges, index} {
+		t.Run("dataset="+filepath.Base(dataset), func(t *testing.T) {
+			fakeClient := NewFakeHTTPClient()
+			fakeClient.RespondWithError("the network must not be used")
+
+			for _, tc := range []struct {
+				pw          string
+				maxBreaches int64
+				pass        bool
+			}{
+				{pw: "mafgupfuwo", pass: false},
+				{pw: "mafgupfuwo", maxBreaches: 1, pass: true},
+				{pw: "zunhenrimo", maxBreaches: 4, pass: false},
+				{pw: "zunhenrimo", maxBreaches: 5, pass: true},
+				{pw: "wubulsomok", maxBreaches: 1 << 31, pass: false},
+				{pw: "rarjuvdoco", pass: true},
+				{pw: "pastibifda", pass: true},
+			} {
+				t.Run(fmt.Sprintf("case=pw=%s/max=%d", tc.pw, tc.maxBreaches), func(t *testing.T) {
+					s := newValidator(t, func(c *ValidatorConfiguration) {
+						c.HaveIBeenPwnedDataset = dataset
+						c.MaxBreaches = tc.maxBreaches
+					})
+					s.c = &fakeClient.Client
+
+					err := s.Validate("", tc.pw)
+					if tc.pass {
+						require.NoError(t, err)
+					} else {
+						require.Error(t, err)
+					}
+				})
+			}
+
+			assert.Empty(t, fakeClient.RequestedURLs())
+		})
+	}
+
+	t.Run("case=should fail if the dataset does not contain the range", func(t *testing.T) {
+		s := newValidator(t, func(c *ValidatorConfiguration) {
+			c.HaveIBeenPwnedDataset = filepath.Join(dir, "empty")
+		})
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "empty"), 0700))
+		require.Error(t, s.Validate("", "mafgupfuwo"))
+	})
+
+	t.Run("case=should fail if the dataset does not exist", func(t *testing.T) {
+		s := newValidator(t, func(c *ValidatorConfiguration) {
+			c.HaveIBeenPwnedDataset = filepath.Join(dir, "does-not-exist")
+		})
+		require.Error(t, s.Validate("", "mafgupfuwo"))
+	})
+
+	t.Run("case=should fail if the index is invalid", func(t *testing.T) {
+		invalid := filepath.Join(dir, "invalid.idx")
+		require.NoError(t, ioutil.WriteFile(invalid, []byte("not an index"), 0600))
+		s := newValidator(t, func(c *ValidatorConfiguration) {
+			c.HaveIBeenPwnedDataset = invalid
+		})
+		require.Error(t, s.Validate("", "mafgupfuwo"))
+	})
+
+	t.Run("case=should not check the dataset if disabled", func(t *testing.T) {
+		s := newValidator(t, func(c *ValidatorConfiguration) {
+			c.HaveIBeenPwnedEnabled = false
+			c.HaveIBeenPwnedDataset = index
+		})
+		require.NoError(t, s.Validate("", "mafgupfuwo"))
+	})
+}
+
+func TestBuildHaveIBeenPwnedIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kratos-hibp-")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	for k, tc := range []struct {
+		content string
+		count   int64
+		err     string
+	}{
+		{content: "0000000000000000000000000000000000000001:2\n0000000000000000000000000000000000000002:1\n", count: 2},
+		{content: "0000000000000000000000000000000000000002:2\n0000000000000000000000000000000000000001:1\n", err: "ascending order"},
+		{content: "0000000000000000000000000000000000000001:2\n0000000000000000000000000000000000000001:1\n", err: "ascending order"},
+		{content: "00000000000000000000000000000000001:2\n", err: "hexadecimal characters"},
+		{content: "000000000000000000000000000000000000000Z:2\n", err: "hexadecimal SHA-1"},
+		{content: "0000000000000000000000000000000000000001\n", err: "two parts"},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			source := filepath.Join(dir, fmt.Sprintf("%d.txt", k))
+			require.NoError(t, ioutil.WriteFile(source, []byte(tc.content), 0600))
+
+			var b bytes.Buffer
+			count, err := BuildHaveIBeenPwnedIndex(&b, source)
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.count, count)
+			assert.Len(t, b.Bytes(), len(indexMagic)+int(count)*indexRecordSize)
+		})
+	}
+
+	t.Run("case=should fail if the directory contains no ranges", func(t *testing.T) {
+		empty := filepath.Join(dir, "empty")
+		require.NoError(t, os.Mkdir(empty, 0700))
+		_, err := BuildHaveIBeenPwnedIndex(new(bytes.Buffer), empty)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,197 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+type characterClass uint
+
+const (
+	characterClassLowercase characterClass = 1 << iota
+	characterClassUppercase
+	characterClassDigit
+	characterClassSymbol
+)
+
+var characterClassesByName = map[string]characterClass{
+	"lowercase": characterClassLowercase,
+	"uppercase": characterClassUppercase,
+	"digit":     characterClassDigit,
+	"symbol":    characterClassSymbol,
+}
+
+var characterClassDescriptions = map[characterClass]string{
+	characterClassLowercase: "lowercase letter",
+	characterClassUppercase: "uppercase letter",
+	characterClassDigit:     "digit",
+	characterClassSymbol:    "symbol",
+}
+
+// characterClasses returns the character classes found in the password. Letters without case, for example
+// Chinese characters, are counted as symbols.
+func characterClasses(password string) characterClass {
+	var found characterClass
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			found |= characterClassLowercase
+		case unicode.IsUpper(r):
+			found |= characterClassUppercase
+		case unicode.IsDigit(r):
+			found |= characterClassDigit
+		default:
+			found |= characterClassSymbol
+		}
+	}
+	return found
+}
+
+var leetSubstitutions = map[rune]rune{
+	'@': 'a', '4': 'a',
+	'3': 'e',
+	'1': 'i', '!': 'i', '|': 'i',
+	'0': 'o',
+	'$': 's', '5': 's',
+	'7': 't', '+': 't',
+}
+
+// normalizeWord lower-cases the word and reverses common character substitutions, so that for example
+// `P@ssw0rd` becomes `password`. Every rune is mapped to exactly one rune.
+func normalizeWord(word string) string {
+	return strings.Map(func(r rune) rune {
+		if s, ok := leetSubstitutions[r]; ok {
+			return s
+		}
+		return unicode.ToLower(r)
+	}, word)
+}
+
+// commonWords are passwords and words which are among the first guesses of every attacker.
+var commonWords = []string{
+	"password", "passwort", "qwerty", "azerty", "letmein", "welcome", "admin", "login", "secret",
+	"dragon", "monkey", "football", "baseball", "soccer", "iloveyou", "master", "sunshine", "princess",
+	"shadow", "superman", "batman", "trustno", "starwars", "whatever", "freedom", "hello", "charlie",
+	"summer", "winter", "spring", "autumn", "changeme", "default", "access", "abc", "love",
+}
+
+// keyboardSequences are sequences of characters which are commonly typed in order or in reverse.
+var keyboardSequences = []string{
+	"abcdefghijklmnopqrstuvwxyz",
+	"01234567890",
+	"qwertyuiop",
+	"asdfghjkl",
+	"zxcvbnm",
+	"qwertzuiop",
+	"yxcvbnm",
+	"azertyuiop",
+}
+
+// estimateStrength estimates how hard the password is to guess and returns a score between 0 (too guessable)
+// and 4 (very unguessable). The score uses the same scale as zxcvbn:
+//
+// - 0: less than 10^3 guesses
+// - 1: less than 10^6 guesses
+// - 2: less than 10^8 guesses
+// - 3: less than 10^10 guesses
+// - 4: 10^10 guesses or more
+//
+// Like zxcvbn, every character which is not part of a known pattern counts as ten guesses. Common and
+// banned words, years, repeated characters, keyboard sequences and repetitions of the whole password only
+// count as few guesses.
+func estimateStrength(password string, dictionary []string) int {
+	words := append(append([]string{}, commonWords...), dictionary...)
+	switch guesses := estimateGuesses([]rune(password), words); {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	}
+	return 4
+}
+
+// estimateGuesses returns the base 10 logarithm of the estimated number of guesses needed to guess the password.
+func estimateGuesses(password []rune, words []string) float64 {
+	lower := []rune(strings.ToLower(string(password)))
+
+	// Passwords such as "abcabcabc" are as easy to guess as their repeated part.
+	for period := 1; period <= len(lower)/2; period++ {
+		if len(lower)%period != 0 {
+			continue
+		}
+
+		repeated := true
+		for i := period; i < len(lower) && repeated; i++ {
+			repeated = lower[i] == lower[i%period]
+		}
+
+		if repeated {
+			return estimateGuesses(password[:period], words) + math.Log10(float64(len(lower)/period))
+		}
+	}
+
+	var guesses float64
+	normalized := []rune(normalizeWord(string(password)))
+	covered := make([]bool, len(normalized))
+	cover := func(from, to int, g float64) {
+		var uncovered bool
+		for j := from; j < to; j++ {
+			uncovered = uncovered || !covered[j]
+			covered[j] = true
+		}
+
+		if uncovered {
+			guesses += g
+		}
+	}
+
+	wordGuesses := math.Log10(float64(len(words))) + 1
+	for _, word := range words {
+		w := []rune(word)
+		for i := 0; len(w) > 0 && i+len(w) <= len(normalized); i++ {
+			if string(normalized[i:i+len(w)]) == word {
+				cover(i, i+len(w), wordGuesses)
+			}
+		}
+	}
+
+	for i := 0; i+4 <= len(lower); i++ {
+		if isYear(lower[i : i+4]) {
+			cover(i, i+4, math.Log10(200))
+		}
+	}
+
+	for i := range lower {
+		if covered[i] {
+			continue
+		}
+
+		if i > 0 && (lower[i] == lower[i-1] || isKeyboardSequence(lower[i-1], lower[i])) {
+			guesses += math.Log10(1.5)
+			continue
+		}
+
+		guesses++
+	}
+
+	return guesses
+}
+
+// isYear returns true if the four runes are a year between 1900 and 2099.
+func isYear(r []rune) bool {
+	return ((r[0] == '1' && r[1] == '9') || (r[0] == '2' && r[1] == '0')) && unicode.IsDigit(r[2]) && unicode.IsDigit(r[3])
+}
+
+func isKeyboardSequence(a, b rune) bool {
+	for _, seq := range keyboardSequences {
+		if strings.Contains(seq, string([]rune{a, b})) || strings.Contains(seq, string([]rune{b, a})) {
+			return true
+		}
+	}
+	return false
+}
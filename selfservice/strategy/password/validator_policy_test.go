@@ -0,0 +1,153 @@
+package password
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newValidator(t *testing.T, update func(c *ValidatorConfiguration)) *DefaultPasswordValidator {
+	c := defaultValidatorConfiguration()
+	update(&c)
+	v, err := NewDefaultPasswordValidatorStrategyFromConfig(&c)
+	require.NoError(t, err)
+	return v
+}
+
+func TestNewValidatorConfiguration(t *testing.T) {
+	c, err := NewValidatorConfiguration([]byte(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, &ValidatorConfiguration{
+		HaveIBeenPwnedEnabled:       true,
+		IgnoreNetworkErrors:         true,
+		MinLength:                   6,
+		MinIdentifierDistance:       5,
+		MaxIdentifierSubstringRatio: 0.5,
+	}, c)
+
+	c, err = NewValidatorConfiguration([]byte(`{"haveibeenpwned_dataset":"/tmp/hibp.idx","max_breaches":10,"ignore_network_errors":false,"min_length":12,"required_character_classes":["digit"],"history_size":5}`))
+	require.NoError(t, err)
+	assert.Equal(t, &ValidatorConfiguration{
+		HaveIBeenPwnedEnabled:       true,
+		HaveIBeenPwnedDataset:       "/tmp/hibp.idx",
+		MaxBreaches:                 10,
+		MinLength:                   12,
+		MinIdentifierDistance:       5,
+		MaxIdentifierSubstringRatio: 0.5,
+		RequiredCharacterClasses:    []string{"digit"},
+	}, c)
+
+	_, err = NewValidatorConfiguration([]byte(`{"max_breaches":"ten"}`))
+	require.Error(t, err)
+}
+
+func TestNewDefaultPasswordValidatorStrategyFromConfig(t *testing.T) {
+	t.Run("case=should fail on unknown character classes", func(t *testing.T) {
+		c := defaultValidatorConfiguration()
+		c.RequiredCharacterClasses = []string{"emoji"}
+		_, err := NewDefaultPasswordValidatorStrategyFromConfig(&c)
+		require.Error(t, err)
+	})
+
+	t.Run("case=should fail if the banned words file does not exist", func(t *testing.T) {
+		c := defaultValidatorConfiguration()
+		c.BannedWordsFile = "does-not-exist.txt"
+		_, err := NewDefaultPasswordValidatorStrategyFromConfig(&c)
+		require.Error(t, err)
+	})
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kratos-password-policy-")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	bannedWordsFile := filepath.Join(dir, "banned.txt")
+	require.NoError(t, ioutil.WriteFile(bannedWordsFile, []byte("kratos\n\n  hydra \n"), 0600))
+
+	for k, tc := range []struct {
+		update func(c *ValidatorConfiguration)
+		id     string
+		pw     string
+		err    string
+	}{
+		{update: func(c *ValidatorConfiguration) {}, pw: "l3f9t", err: "at least 6 characters"},
+		{update: func(c *ValidatorConfiguration) {}, pw: "l3f9to"},
+		{update: func(c *ValidatorConfiguration) { c.MinLength = 12 }, pw: "l3f9toh1uaf", err: "at least 12 characters"},
+		{update: func(c *ValidatorConfiguration) { c.MinLength = 12 }, pw: "l3f9toh1uaf8"},
+		// Length is counted in characters, not bytes.
+		{update: func(c *ValidatorConfiguration) { c.MinLength = 7 }, pw: "pässwö", err: "at least 7 characters"},
+		{update: func(c *ValidatorConfiguration) { c.MaxLength = 10 }, pw: "l3f9toh1uaf", err: "at most 10 characters"},
+		{update: func(c *ValidatorConfiguration) { c.MaxLength = 10 }, pw: "l3f9toh1ua"},
+		{update: func(c *ValidatorConfiguration) {}, id: "hello@example.com", pw: "hello@example.com1", err: "too similar"},
+		{update: func(c *ValidatorConfiguration) {
+			c.MinIdentifierDistance = 0
+			c.MaxIdentifierSubstringRatio = 1
+		}, id: "hello@example.com", pw: "hello@example.com1"},
+		{update: func(c *ValidatorConfiguration) { c.RequiredCharacterClasses = []string{"uppercase"} }, pw: "l3f9toh1", err: "at least one uppercase letter"},
+		{update: func(c *ValidatorConfiguration) { c.RequiredCharacterClasses = []string{"uppercase", "symbol"} }, pw: "l3F9toh1", err: "at least one symbol"},
+		{update: func(c *ValidatorConfiguration) {
+			c.RequiredCharacterClasses = []string{"lowercase", "uppercase", "digit", "symbol"}
+		}, pw: "l3F9to h1"},
+		{update: func(c *ValidatorConfiguration) { c.MinCharacterClasses = 3 }, pw: "l3f9toh1", err: "at least 3 of the classes"},
+		{update: func(c *ValidatorConfiguration) { c.MinCharacterClasses = 3 }, pw: "l3f9-toh1"},
+		{update: func(c *ValidatorConfiguration) { c.BannedWords = []string{"Ory"} }, pw: "l3f9toryh1", err: `banned word "ory"`},
+		{update: func(c *ValidatorConfiguration) { c.BannedWords = []string{"ory"} }, pw: "l3f9t0RYh1", err: `banned word "ory"`},
+		{update: func(c *ValidatorConfiguration) { c.BannedWords = []string{"ory"} }, pw: "l3f9toh1"},
+		{update: func(c *ValidatorConfiguration) { c.BannedWordsFile = bannedWordsFile }, pw: "l3f9HYDRAh1", err: `banned word "hydra"`},
+		{update: func(c *ValidatorConfiguration) { c.BannedWordsFile = bannedWordsFile }, pw: "l3f9kr@tos", err: `banned word "kratos"`},
+		{update: func(c *ValidatorConfiguration) { c.MinStrengthScore = 3 }, pw: "aaaaaaaaaaaa", err: "too easy to guess"},
+		{update: func(c *ValidatorConfiguration) { c.MinStrengthScore = 3 }, pw: "P@ssw0rd2020", err: "too easy to guess"},
+		{update: func(c *ValidatorConfiguration) { c.MinStrengthScore = 3 }, pw: "correcthorsebatterystaple"},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			s := newValidator(t, func(c *ValidatorConfiguration) {
+				c.HaveIBeenPwnedEnabled = false
+				tc.update(c)
+			})
+
+			err := s.Validate(tc.id, tc.pw)
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func TestEstimateStrength(t *testing.T) {
+	for _, tc := range []struct {
+		pw    string
+		words []string
+		score int
+	}{
+		{pw: "", score: 0},
+		{pw: "password", score: 0},
+		{pw: "P@ssw0rd", score: 0},
+		{pw: "aaaaaaaaaaaa", score: 0},
+		{pw: "qwertyuiop123", score: 1},
+		{pw: "abcdef123456", score: 1},
+		{pw: "letmein2020", score: 1},
+		{pw: "kdjz8s", score: 2},
+		{pw: "acme-rocks-2020", score: 4},
+		{pw: "acme-rocks-2020", words: []string{"acme", "rocks"}, score: 3},
+		{pw: "Jd8w!kq2", score: 3},
+		{pw: "Jd8w!kq2x9Lm", score: 4},
+		{pw: "correcthorsebatterystaple", score: 4},
+		{pw: strings.Repeat("ab", 20), score: 0},
+		{pw: strings.Repeat("Jd8w", 3), score: 1},
+	} {
+		t.Run("case="+tc.pw, func(t *testing.T) {
+			assert.Equal(t, tc.score, estimateStrength(tc.pw, tc.words))
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package saml
+
+import "time"
+
+const (
+	containerName = "ory_kratos_saml_authn_request"
+
+	// cookieName is the name of the cookie which binds the authentication request to the browser which started it.
+	cookieName = "ory_kratos_saml"
+
+	// metadataCacheTTL is how long Identity Provider metadata is cached unless the metadata asks for less.
+	metadataCacheTTL = time.Hour
+
+	// assertionNamespace is the XML namespace of SAML assertions.
+	assertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+)
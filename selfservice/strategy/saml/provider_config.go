@@ -0,0 +1,62 @@
+package saml
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/urlx"
+)
+
+type Configuration struct {
+	// ID is the provider's ID
+	ID string `json:"id"`
+
+	// MetadataURL is the location of the Identity Provider's SAML metadata. It can be either a http(s):// URL
+	// or a file:// or base64:// URL if the metadata is not published by the Identity Provider.
+	MetadataURL string `json:"metadata_url"`
+
+	// EntityID is the entity ID ORY Kratos uses when talking to this Identity Provider. It defaults to the
+	// URL of the service provider metadata endpoint.
+	EntityID string `json:"entity_id"`
+
+	// Mapper specifies the JSONNet code snippet which uses the SAML assertion's subject and attributes to hydrate
+	// the identity's data.
+	//
+	// It can be either a URL (file://, http(s)://, base64://) or an inline JSONNet code snippet.
+	Mapper string `json:"mapper_url"`
+}
+
+// Metadata returns the URL of the service provider metadata for this Identity Provider.
+func (p Configuration) Metadata(public *url.URL) *url.URL {
+	return urlx.AppendPaths(public,
+		strings.Replace(RouteMetadata, ":provider", p.ID, 1),
+	)
+}
+
+// ACS returns the URL of the assertion consumer service.
+func (p Configuration) ACS(public *url.URL) *url.URL {
+	return urlx.AppendPaths(public, RouteACS)
+}
+
+type ConfigurationCollection struct {
+	// CertificateURL is the location of the PEM encoded certificate of the service provider.
+	CertificateURL string `json:"certificate_url"`
+
+	// KeyURL is the location of the PEM encoded RSA private key of the service provider. If set together with
+	// CertificateURL, authentication requests are signed and encrypted assertions are supported.
+	KeyURL string `json:"key_url"`
+
+	Providers []Configuration `json:"providers"`
+}
+
+func (c ConfigurationCollection) Provider(id string) (*Configuration, error) {
+	for k := range c.Providers {
+		if p := c.Providers[k]; p.ID == id {
+			return &p, nil
+		}
+	}
+	return nil, errors.WithStack(herodot.ErrNotFound.WithReasonf(`SAML Identity Provider "%s" is unknown or has not been configured`, id))
+}
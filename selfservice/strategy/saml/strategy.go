@@ -0,0 +1,722 @@
+package saml
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/fetcher"
+	"github.com/ory/x/jsonx"
+	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/sqlxx"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/continuity"
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/errorx"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/login"
+	"github.com/zzpu/ums/selfservice/flow/registration"
+	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/session"
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteBase = "/self-service/methods/saml"
+
+	RouteAuth     = RouteBase + "/auth/:flow"
+	RouteMetadata = RouteBase + "/metadata/:provider"
+	RouteACS      = RouteBase + "/acs"
+	RouteContinue = RouteBase + "/continue"
+)
+
+var _ identity.ActiveCredentialsCounter = new(Strategy)
+
+type dependencies interface {
+	errorx.ManagementProvider
+
+	x.LoggingProvider
+	x.WriterProvider
+	x.CSRFProvider
+	x.CSRFTokenGeneratorProvider
+	x.CookieProvider
+
+	identity.ValidationProvider
+	identity.PrivilegedPoolProvider
+
+	session.ManagementProvider
+
+	login.HookExecutorProvider
+	login.FlowPersistenceProvider
+	login.HandlerProvider
+	login.ErrorHandlerProvider
+
+	registration.HookExecutorProvider
+	registration.FlowPersistenceProvider
+	registration.HandlerProvider
+	registration.ErrorHandlerProvider
+
+	continuity.PersistenceProvider
+}
+
+func isForced(req interface{}) bool {
+	f, ok := req.(interface {
+		IsForced() bool
+	})
+	return ok && f.IsForced()
+}
+
+// Strategy implements selfservice.LoginStrategy, selfservice.RegistrationStrategy. It supports both login
+// and registration via SAML 2.0 Identity Providers.
+type Strategy struct {
+	c configuration.Provider
+	d dependencies
+	f *fetcher.Fetcher
+
+	mu       sync.RWMutex
+	metadata map[string]cachedMetadata
+}
+
+type cachedMetadata struct {
+	descriptor *saml.EntityDescriptor
+	expiresAt  time.Time
+}
+
+func NewStrategy(
+	d dependencies,
+	c configuration.Provider,
+) *Strategy {
+	return &Strategy{
+		c: c,
+		d: d,
+		f: fetcher.NewFetcher(),
+
+		metadata: map[string]cachedMetadata{},
+	}
+}
+
+func (s *Strategy) ID() identity.CredentialsType {
+	return identity.CredentialsTypeSAML
+}
+
+func (s *Strategy) CountActiveCredentials(cc map[identity.CredentialsType]identity.Credentials) (count int, err error) {
+	for _, c := range cc {
+		if c.Type == s.ID() && gjson.ValidBytes(c.Config) {
+			var conf CredentialsConfig
+			if err = json.Unmarshal(c.Config, &conf); err != nil {
+				return 0, errors.WithStack(err)
+			}
+
+			for _, ider := range c.Identifiers {
+				parts := strings.SplitN(ider, ":", 2)
+				if len(parts) != 2 {
+					continue
+				}
+
+				for _, prov := range conf.Providers {
+					if parts[0] == prov.Provider && parts[1] == prov.Subject && len(prov.Subject) > 1 && len(prov.Provider) > 1 {
+						count++
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+func (s *Strategy) setRoutes(r *x.RouterPublic) {
+	if handle, _, _ := r.Lookup("POST", RouteACS); handle == nil {
+		// The Identity Provider posts the response, so it can not include a CSRF token.
+		s.d.CSRFHandler().ExemptPath(RouteACS)
+		r.POST(RouteACS, s.handleACS)
+	}
+
+	if handle, _, _ := r.Lookup("POST", RouteContinue); handle == nil {
+		// The request is protected by the cookie which binds the authentication request to the browser.
+		s.d.CSRFHandler().ExemptPath(RouteContinue)
+		r.POST(RouteContinue, s.handleContinue)
+	}
+
+	if handle, _, _ := r.Lookup("GET", RouteMetadata); handle == nil {
+		r.GET(RouteMetadata, s.handleMetadata)
+	}
+
+	if handle, _, _ := r.Lookup("POST", RouteAuth); handle == nil {
+		r.POST(RouteAuth, s.handleAuth)
+	}
+
+	if handle, _, _ := r.Lookup("GET", RouteAuth); handle == nil {
+		r.GET(RouteAuth, s.handleAuth)
+	}
+}
+
+func (s *Strategy) handleMetadata(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	c, err := s.Config()
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	provider, err := c.Provider(ps.ByName("provider"))
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	sp, err := s.serviceProvider(c, provider)
+	if err != nil {
+		s.d.Writer().WriteError(w, r, err)
+		return
+	}
+
+	metadata, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		s.d.Writer().WriteError(w, r, errors.WithStack(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	_, _ = w.Write(metadata)
+}
+
+func (s *Strategy) handleAuth(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	rid := x.ParseUUID(ps.ByName("flow"))
+	if err := r.ParseForm(); err != nil {
+		s.handleError(w, r, rid, "", nil, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	var pid = r.Form.Get("provider") // this can come from both url query and post body
+	if pid == "" {
+		s.handleError(w, r, rid, pid, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`The HTTP request did not contain the required "provider" form field`)))
+		return
+	}
+
+	sp, _, err := s.provider(pid)
+	if err != nil {
+		s.handleError(w, r, rid, pid, nil, err)
+		return
+	}
+
+	req, err := s.validateFlow(r.Context(), rid)
+	if err != nil {
+		s.handleError(w, r, rid, pid, nil, err)
+		return
+	}
+
+	if s.alreadyAuthenticated(w, r, req) {
+		return
+	}
+
+	location := sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if location == "" {
+		s.handleError(w, r, rid, pid, nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf(`SAML Identity Provider "%s" does not support the HTTP-Redirect binding.`, pid)))
+		return
+	}
+
+	authn, err := sp.MakeAuthenticationRequest(location, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		s.handleError(w, r, rid, pid, nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to create SAML authentication request: %s", err)))
+		return
+	}
+
+	var payload bytes.Buffer
+	if err := json.NewEncoder(&payload).Encode(&authnRequestContainer{
+		FlowID:    rid.String(),
+		Provider:  pid,
+		RequestID: authn.ID,
+		Form:      r.PostForm,
+	}); err != nil {
+		s.handleError(w, r, rid, pid, nil, errors.WithStack(err))
+		return
+	}
+
+	container := &continuity.Container{
+		ID:        x.NewUUID(),
+		Name:      containerName,
+		ExpiresAt: time.Now().Add(time.Minute * 30).UTC().Truncate(time.Second),
+		Payload:   sqlxx.NullJSONRawMessage(payload.Bytes()),
+	}
+	if err := s.d.ContinuityPersister().SaveContinuitySession(r.Context(), container); err != nil {
+		s.handleError(w, r, rid, pid, nil, err)
+		return
+	}
+
+	if err := x.SessionPersistValues(w, r, s.d.ContinuityCookieManager(), cookieName, map[string]interface{}{
+		containerName: container.ID.String(),
+	}); err != nil {
+		s.handleError(w, r, rid, pid, nil, err)
+		return
+	}
+
+	redirect, err := authn.Redirect(container.ID.String(), sp)
+	if err != nil {
+		s.handleError(w, r, rid, pid, nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to create SAML authentication request: %s", err)))
+		return
+	}
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *Strategy) validateFlow(ctx context.Context, rid uuid.UUID) (ider, error) {
+	if x.IsZeroUUID(rid) {
+		return nil, errors.WithStack(herodot.ErrBadRequest.WithReason("The session cookie contains invalid values and the flow could not be executed. Please try again."))
+	}
+
+	if ar, err := s.d.RegistrationFlowPersister().GetRegistrationFlow(ctx, rid); err == nil {
+		if ar.Type != flow.TypeBrowser {
+			return ar, ErrAPIFlowNotSupported
+		}
+
+		if err := ar.Valid(); err != nil {
+			return ar, err
+		}
+		return ar, nil
+	}
+
+	ar, err := s.d.LoginFlowPersister().GetLoginFlow(ctx, rid)
+	if err != nil {
+		return nil, err
+	}
+
+	if ar.Type != flow.TypeBrowser {
+		return ar, ErrAPIFlowNotSupported
+	}
+
+	if err := ar.Valid(); err != nil {
+		return ar, err
+	}
+	return ar, nil
+}
+
+// requireSingleAssertion rejects SAML responses which do not contain exactly one assertion. Additional assertions
+// might not be signed, which is why such responses are rejected instead of picking one of the assertions.
+func requireSingleAssertion(encoded string) error {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var depth, assertions int
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 && t.Name.Space == assertionNamespace && (t.Name.Local == "Assertion" || t.Name.Local == "EncryptedAssertion") {
+				assertions++
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+
+	if assertions != 1 {
+		return errors.Errorf("expected exactly one assertion but the response contains %d", assertions)
+	}
+	return nil
+}
+
+// validateACS loads and removes the stored authentication request referenced by the RelayState. The request must have
+// been started by the browser posting the response, and removing it first ensures that every response can only be
+// used once.
+func (s *Strategy) validateACS(w http.ResponseWriter, r *http.Request) (ider, *authnRequestContainer, error) {
+	id := x.ParseUUID(r.PostForm.Get("RelayState"))
+	if x.IsZeroUUID(id) {
+		return nil, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete SAML flow because the Identity Provider did not return the RelayState parameter.`))
+	}
+
+	c, err := s.d.ContinuityPersister().GetContinuitySession(r.Context(), id)
+	if errors.Is(err, sqlcon.ErrNoRows) {
+		return nil, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete SAML flow because the authentication request is unknown or was already used. Please try again.`))
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	if bound, err := x.SessionGetString(r, s.d.ContinuityCookieManager(), cookieName, containerName); err != nil || bound != c.ID.String() {
+		return nil, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete SAML flow because the authentication request was started in another browser. Please try again.`))
+	}
+
+	if err := x.SessionUnsetKey(w, r, s.d.ContinuityCookieManager(), cookieName, containerName); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.d.ContinuityPersister().DeleteContinuitySession(r.Context(), c.ID); err != nil {
+		return nil, nil, err
+	}
+
+	if c.Name != containerName {
+		return nil, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf(`Unable to complete SAML flow because the authentication request is unknown or was already used. Please try again.`))
+	}
+
+	var container authnRequestContainer
+	if err := json.NewDecoder(bytes.NewBuffer(c.Payload)).Decode(&container); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	if err := c.Valid(uuid.Nil); err != nil {
+		return nil, &container, err
+	}
+
+	req, err := s.validateFlow(r.Context(), x.ParseUUID(container.FlowID))
+	if err != nil {
+		return req, &container, err
+	}
+
+	return req, &container, nil
+}
+
+func (s *Strategy) alreadyAuthenticated(w http.ResponseWriter, r *http.Request, req interface{}) bool {
+	// we assume an error means the user has no session
+	if _, err := s.d.SessionManager().FetchFromRequest(r.Context(), r); err == nil && !isForced(req) {
+		http.Redirect(w, r, s.c.SelfServiceBrowserDefaultReturnTo().String(), http.StatusFound)
+		return true
+	}
+
+	return false
+}
+
+var continueTemplate = template.Must(template.New("continue").Parse(`<!DOCTYPE html>
+<html>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{ .Action }}">
+<input type="hidden" name="SAMLResponse" value="{{ .SAMLResponse }}" />
+<input type="hidden" name="RelayState" value="{{ .RelayState }}" />
+<noscript><input type="submit" value="Continue" /></noscript>
+</form>
+</body>
+</html>`))
+
+// handleACS receives the response posted by the Identity Provider. Because this is a cross-site request, browsers
+// do not send the cookie binding the authentication request to them. The response is therefore posted again from
+// a page served by ORY Kratos to RouteContinue, where the cookie is available.
+func (s *Strategy) handleACS(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if err := r.ParseForm(); err != nil {
+		s.handleError(w, r, x.EmptyUUID, "", nil, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := continueTemplate.Execute(w, map[string]string{
+		"Action":       urlx.AppendPaths(s.c.SelfPublicURL(), RouteContinue).String(),
+		"SAMLResponse": r.PostForm.Get("SAMLResponse"),
+		"RelayState":   r.PostForm.Get("RelayState"),
+	}); err != nil {
+		s.d.Logger().WithError(err).Error("Unable to render the SAML response form.")
+	}
+}
+
+func (s *Strategy) handleContinue(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if err := r.ParseForm(); err != nil {
+		s.handleError(w, r, x.EmptyUUID, "", nil, errors.WithStack(herodot.ErrBadRequest.WithDebug(err.Error()).WithReasonf("Unable to parse HTTP form request: %s", err.Error())))
+		return
+	}
+
+	req, container, err := s.validateACS(w, r)
+	if err != nil {
+		if req != nil {
+			s.handleError(w, r, req.GetID(), "", nil, err)
+		} else {
+			s.handleError(w, r, x.EmptyUUID, "", nil, err)
+		}
+		return
+	}
+
+	pid := container.Provider
+	if s.alreadyAuthenticated(w, r, req) {
+		return
+	}
+
+	sp, provider, err := s.provider(pid)
+	if err != nil {
+		s.handleError(w, r, req.GetID(), pid, nil, err)
+		return
+	}
+
+	if err := requireSingleAssertion(r.PostForm.Get("SAMLResponse")); err != nil {
+		s.handleError(w, r, req.GetID(), pid, nil, errors.WithStack(ErrInvalidResponse.WithDebug(err.Error())))
+		return
+	}
+
+	assertion, err := sp.ParseResponse(r, []string{container.RequestID})
+	if err != nil {
+		var debug string
+		var ierr *saml.InvalidResponseError
+		if errors.As(err, &ierr) && ierr.PrivateErr != nil {
+			debug = ierr.PrivateErr.Error()
+		}
+		s.handleError(w, r, req.GetID(), pid, nil, errors.WithStack(ErrInvalidResponse.WithDebug(debug)))
+		return
+	}
+
+	claims := newClaims(assertion)
+	if claims.Subject == "" {
+		s.handleError(w, r, req.GetID(), pid, nil, errors.WithStack(ErrInvalidResponse.WithDebug("The assertion does not contain a NameID.")))
+		return
+	}
+
+	switch a := req.(type) {
+	case *login.Flow:
+		s.processLogin(w, r, a, claims, provider, container)
+		return
+	case *registration.Flow:
+		s.processRegistration(w, r, a, claims, provider, container)
+		return
+	default:
+		s.handleError(w, r, req.GetID(), pid, nil, errors.WithStack(x.PseudoPanic.
+			WithDetailf("cause", "Unexpected type in SAML flow: %T", a)))
+		return
+	}
+}
+
+func uid(provider, subject string) string {
+	return fmt.Sprintf("%s:%s", provider, subject)
+}
+
+func (s *Strategy) authURL(flowID uuid.UUID) string {
+	return urlx.AppendPaths(
+		urlx.Copy(s.c.SelfPublicURL()),
+		strings.Replace(
+			RouteAuth, ":flow", flowID.String(), 1,
+		),
+	).String()
+}
+
+func (s *Strategy) populateMethod(r *http.Request, flowID uuid.UUID) (*FlowMethod, error) {
+	conf, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	f := form.NewHTMLForm(s.authURL(flowID))
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+	// does not need sorting because there is only one field
+
+	return NewFlowMethod(f).AddProviders(conf.Providers), nil
+}
+
+func (s *Strategy) Config() (*ConfigurationCollection, error) {
+	var c ConfigurationCollection
+
+	config := s.c.SelfServiceStrategy(string(s.ID())).Config
+	if err := jsonx.
+		NewStrictDecoder(bytes.NewBuffer(config)).
+		Decode(&c); err != nil {
+		s.d.Logger().WithError(err).WithField("config", config)
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode SAML Identity Provider configuration: %s", err))
+	}
+
+	return &c, nil
+}
+
+// provider returns the service provider for the given Identity Provider including the Identity Provider's metadata.
+func (s *Strategy) provider(id string) (*saml.ServiceProvider, *Configuration, error) {
+	c, err := s.Config()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider, err := c.Provider(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sp, err := s.serviceProvider(c, provider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sp.IDPMetadata, err = s.idpMetadata(provider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sp, provider, nil
+}
+
+// idpMetadata returns the metadata of the Identity Provider. The metadata is cached for the duration it asks for
+// but at most for metadataCacheTTL and never past its validity.
+func (s *Strategy) idpMetadata(provider *Configuration) (*saml.EntityDescriptor, error) {
+	s.mu.RLock()
+	cached, ok := s.metadata[provider.MetadataURL]
+	s.mu.RUnlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.descriptor, nil
+	}
+
+	raw, err := s.f.Fetch(provider.MetadataURL)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf(`Unable to fetch the metadata of SAML Identity Provider "%s": %s`, provider.ID, err))
+	}
+
+	descriptor, err := samlsp.ParseMetadata(raw.Bytes())
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf(`Unable to parse the metadata of SAML Identity Provider "%s": %s`, provider.ID, err))
+	}
+
+	ttl := metadataCacheTTL
+	if descriptor.CacheDuration > 0 && descriptor.CacheDuration < ttl {
+		ttl = descriptor.CacheDuration
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	if !descriptor.ValidUntil.IsZero() && descriptor.ValidUntil.Before(expiresAt) {
+		expiresAt = descriptor.ValidUntil
+	}
+
+	s.mu.Lock()
+	s.metadata[provider.MetadataURL] = cachedMetadata{descriptor: descriptor, expiresAt: expiresAt}
+	s.mu.Unlock()
+
+	return descriptor, nil
+}
+
+// serviceProvider returns the service provider ORY Kratos acts as towards the given Identity Provider.
+func (s *Strategy) serviceProvider(c *ConfigurationCollection, provider *Configuration) (*saml.ServiceProvider, error) {
+	sp := &saml.ServiceProvider{
+		EntityID:    provider.EntityID,
+		MetadataURL: *provider.Metadata(s.c.SelfPublicURL()),
+		AcsURL:      *provider.ACS(s.c.SelfPublicURL()),
+		// Let the Identity Provider choose the NameID format instead of requesting transient identifiers.
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+	}
+
+	if c.KeyURL == "" && c.CertificateURL == "" {
+		return sp, nil
+	} else if c.KeyURL == "" || c.CertificateURL == "" {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("SAML service provider key_url and certificate_url must be set together."))
+	}
+
+	key, err := s.f.Fetch(c.KeyURL)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to fetch the SAML service provider key: %s", err))
+	}
+
+	cert, err := s.f.Fetch(c.CertificateURL)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to fetch the SAML service provider certificate: %s", err))
+	}
+
+	if sp.Key, err = parseKey(key.Bytes()); err != nil {
+		return nil, err
+	}
+
+	if sp.Certificate, err = parseCertificate(cert.Bytes()); err != nil {
+		return nil, err
+	}
+
+	sp.SignatureMethod = dsig.RSASHA256SignatureMethod
+	return sp, nil
+}
+
+func parseKey(raw []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The SAML service provider key is not PEM encoded."))
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to parse the SAML service provider key: %s", err))
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The SAML service provider key must be an RSA private key."))
+	}
+
+	return rsaKey, nil
+}
+
+func parseCertificate(raw []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("The SAML service provider certificate is not PEM encoded."))
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to parse the SAML service provider certificate: %s", err))
+	}
+
+	return cert, nil
+}
+
+func (s *Strategy) handleError(w http.ResponseWriter, r *http.Request, rid uuid.UUID, provider string, traits []byte, err error) {
+	if x.IsZeroUUID(rid) {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+
+	if lr, rerr := s.d.LoginFlowPersister().GetLoginFlow(r.Context(), rid); rerr == nil {
+		s.d.LoginFlowErrorHandler().WriteFlowError(w, r, s.ID(), lr, err)
+		return
+	} else if rr, rerr := s.d.RegistrationFlowPersister().GetRegistrationFlow(r.Context(), rid); rerr == nil {
+		if method, ok := rr.Methods[s.ID()]; ok {
+			method.Config.UnsetField("provider")
+			method.Config.Reset()
+
+			if traits != nil {
+				for _, field := range form.NewHTMLFormFromJSON("", traits, "traits").Fields {
+					method.Config.SetField(field)
+				}
+			}
+
+			if errSec := method.Config.ParseError(err); errSec != nil {
+				s.d.RegistrationFlowErrorHandler().WriteFlowError(w, r, s.ID(), rr, errSec)
+				return
+			}
+			method.Config.ResetMessages()
+
+			method.Config.SetCSRF(s.d.GenerateCSRFToken(r))
+			if errSec := method.Config.SortFields(s.c.DefaultIdentityTraitsSchemaURL().String()); errSec != nil {
+				s.d.RegistrationFlowErrorHandler().WriteFlowError(w, r, s.ID(), rr, errors.Wrap(err, errSec.Error()))
+				return
+			}
+
+			method.Config.UnsetField("provider")
+			method.Config.SetField(form.Field{Name: "provider", Value: provider, Type: "submit"})
+			rr.Methods[s.ID()] = method
+		}
+
+		s.d.RegistrationFlowErrorHandler().WriteFlowError(w, r, s.ID(), rr, err)
+		return
+	}
+
+	s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+}
@@ -0,0 +1,165 @@
+package saml_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/xml"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/logger"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/x/urlx"
+)
+
+// identityProvider is a SAML Identity Provider which authenticates every request as the configured subject.
+type identityProvider struct {
+	*httptest.Server
+	idp *saml.IdentityProvider
+
+	subject string
+	mail    string
+
+	metadataRequests int32
+}
+
+func (p *identityProvider) GetServiceProvider(_ *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	// The service provider's entity ID defaults to the URL of its metadata.
+	res, err := http.Get(serviceProviderID)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata saml.EntityDescriptor
+	if err := xml.Unmarshal(body, &metadata); err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
+
+func (p *identityProvider) GetSession(_ http.ResponseWriter, _ *http.Request, _ *saml.IdpAuthnRequest) *saml.Session {
+	return &saml.Session{
+		ID:         "session",
+		CreateTime: time.Now(),
+		ExpireTime: time.Now().Add(time.Hour),
+		NameID:     p.subject,
+		CustomAttributes: []saml.Attribute{{
+			Name:   "mail",
+			Values: []saml.AttributeValue{{Type: "xs:string", Value: p.mail}},
+		}},
+	}
+}
+
+func newCertificate(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "saml.example.org"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(raw)
+	require.NoError(t, err)
+	return key, cert
+}
+
+func newIdentityProvider(t *testing.T) *identityProvider {
+	key, cert := newCertificate(t)
+
+	p := new(identityProvider)
+	p.idp = &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		Logger:                  logger.DefaultLogger,
+		ServiceProviderProvider: p,
+		SessionProvider:         p,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metadata", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&p.metadataRequests, 1)
+		p.idp.ServeMetadata(w, r)
+	})
+	mux.HandleFunc("/sso", p.idp.ServeSSO)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Server.Close)
+
+	p.idp.MetadataURL = *urlx.ParseOrPanic(p.URL + "/metadata")
+	p.idp.SSOURL = *urlx.ParseOrPanic(p.URL + "/sso")
+	return p
+}
+
+var (
+	responseForm = regexp.MustCompile(`action="([^"]+)".*name="SAMLResponse" value="([^"]+)".*name="RelayState" value="([^"]+)"`)
+	continueForm = regexp.MustCompile(`(?s)action="([^"]+)".*name="SAMLResponse" value="([^"]*)".*name="RelayState" value="([^"]*)"`)
+)
+
+// authenticate follows the redirect to the Identity Provider and returns the response it would post to the
+// assertion consumer service.
+func authenticate(t *testing.T, c *http.Client, action string, fv url.Values) (acs string, response url.Values) {
+	res, err := c.PostForm(action, fv)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode, "%s: %s", res.Request.URL, body)
+
+	matches := responseForm.FindStringSubmatch(string(body))
+	require.Len(t, matches, 4, "%s: %s", res.Request.URL, body)
+
+	return unescape(matches[1]), url.Values{"SAMLResponse": {unescape(matches[2])}, "RelayState": {unescape(matches[3])}}
+}
+
+func unescape(s string) string {
+	var v struct {
+		Value string `xml:",chardata"`
+	}
+	if err := xml.Unmarshal([]byte("<v>"+s+"</v>"), &v); err != nil {
+		panic(err)
+	}
+	return v.Value
+}
+
+// post posts the response to the assertion consumer service and submits the form it renders, like a browser would.
+func post(t *testing.T, c *http.Client, acs string, response url.Values) (*http.Response, []byte) {
+	res, body := submit(t, c, acs, response)
+	require.Equal(t, http.StatusOK, res.StatusCode, "%s", body)
+
+	matches := continueForm.FindStringSubmatch(string(body))
+	require.Len(t, matches, 4, "%s", body)
+
+	return submit(t, c, unescape(matches[1]), url.Values{"SAMLResponse": {unescape(matches[2])}, "RelayState": {unescape(matches[3])}})
+}
+
+func submit(t *testing.T, c *http.Client, action string, fv url.Values) (*http.Response, []byte) {
+	res, err := c.PostForm(action, fv)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, body
+}
@@ -0,0 +1,79 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/login"
+	"github.com/zzpu/ums/x"
+)
+
+var _ login.Strategy = new(Strategy)
+
+func (s *Strategy) RegisterLoginRoutes(r *x.RouterPublic) {
+	s.setRoutes(r)
+}
+
+func (s *Strategy) PopulateLoginMethod(r *http.Request, sr *login.Flow) error {
+	if sr.Type != flow.TypeBrowser {
+		return nil
+	}
+
+	config, err := s.populateMethod(r, sr.ID)
+	if err != nil {
+		return err
+	}
+	sr.Methods[s.ID()] = &login.FlowMethod{Method: s.ID(),
+		Config: &login.FlowMethodConfig{FlowMethodConfigurator: config}}
+	return nil
+}
+
+func (s *Strategy) processLogin(w http.ResponseWriter, r *http.Request, a *login.Flow, claims *Claims, provider *Configuration, container *authnRequestContainer) {
+	i, c, err := s.d.PrivilegedIdentityPool().FindByCredentialsIdentifier(r.Context(), identity.CredentialsTypeSAML, uid(provider.ID, claims.Subject))
+	if err != nil {
+		if errors.Is(err, herodot.ErrNotFound) {
+			// If no account was found we're "manually" creating a new registration flow and continue with it
+			// so that the "pre registration" hooks are executed. This works the same way as in the OpenID Connect
+			// strategy.
+			s.d.Logger().WithField("provider", provider.ID).WithField("subject", claims.Subject).Debug("Received successful SAML response but user is not registered. Re-initializing registration flow now.")
+
+			// This flow only works for browsers anyways.
+			aa, err := s.d.RegistrationHandler().NewRegistrationFlow(w, r, flow.TypeBrowser)
+			if err != nil {
+				s.handleError(w, r, a.GetID(), provider.ID, nil, err)
+				return
+			}
+
+			s.processRegistration(w, r, aa, claims, provider, container)
+			return
+		}
+
+		s.handleError(w, r, a.GetID(), provider.ID, nil, err)
+		return
+	}
+
+	var o CredentialsConfig
+	if err := json.NewDecoder(bytes.NewBuffer(c.Config)).Decode(&o); err != nil {
+		s.handleError(w, r, a.GetID(), provider.ID, nil, errors.WithStack(herodot.ErrInternalServerError.WithReason("The SAML credentials could not be decoded properly").WithDebug(err.Error())))
+		return
+	}
+
+	for _, c := range o.Providers {
+		if c.Subject == claims.Subject && c.Provider == provider.ID {
+			if err = s.d.LoginHookExecutor().PostLoginHook(w, r, identity.CredentialsTypeSAML, a, i); err != nil {
+				s.handleError(w, r, a.GetID(), provider.ID, nil, err)
+				return
+			}
+			return
+		}
+	}
+
+	s.handleError(w, r, a.GetID(), provider.ID, nil, errors.WithStack(herodot.ErrInternalServerError.WithReason("Unable to find matching SAML Credentials.").WithDebugf(`Unable to find credentials that match the given provider "%s" and subject "%s".`, provider.ID, claims.Subject)))
+}
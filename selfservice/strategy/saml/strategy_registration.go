@@ -0,0 +1,140 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/go-jsonnet"
+	"github.com/tidwall/gjson"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/registration"
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	registrationFormPayloadSchema = `{
+  "$id": "https://schemas.ory.sh/kratos/selfservice/saml/registration/config.schema.json",
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "properties": {
+    "traits": {}
+  }
+}`
+)
+
+var _ registration.Strategy = new(Strategy)
+
+func (s *Strategy) RegisterRegistrationRoutes(r *x.RouterPublic) {
+	s.setRoutes(r)
+}
+
+func (s *Strategy) PopulateRegistrationMethod(r *http.Request, sr *registration.Flow) error {
+	if sr.Type != flow.TypeBrowser {
+		return nil
+	}
+
+	config, err := s.populateMethod(r, sr.ID)
+	if err != nil {
+		return err
+	}
+	sr.Methods[s.ID()] = &registration.FlowMethod{
+		Method: s.ID(),
+		Config: &registration.FlowMethodConfig{FlowMethodConfigurator: config},
+	}
+	return nil
+}
+
+func (s *Strategy) processRegistration(w http.ResponseWriter, r *http.Request, a *registration.Flow, claims *Claims, provider *Configuration, container *authnRequestContainer) {
+	if _, _, err := s.d.PrivilegedIdentityPool().FindByCredentialsIdentifier(r.Context(), identity.CredentialsTypeSAML, uid(provider.ID, claims.Subject)); err == nil {
+		// If the identity already exists, we perform the login flow instead. This works the same way as in the
+		// OpenID Connect strategy.
+		s.d.Logger().WithRequest(r).WithField("provider", provider.ID).
+			WithField("subject", claims.Subject).
+			Debug("Received successful SAML response but user is already registered. Re-initializing login flow now.")
+
+		// This endpoint only handles browser flow at the moment.
+		ar, err := s.d.LoginHandler().NewLoginFlow(w, r, flow.TypeBrowser)
+		if err != nil {
+			s.handleError(w, r, a.GetID(), provider.ID, nil, err)
+			return
+		}
+
+		s.processLogin(w, r, ar, claims, provider, container)
+		return
+	}
+
+	jn, err := s.f.Fetch(provider.Mapper)
+	if err != nil {
+		s.handleError(w, r, a.GetID(), provider.ID, nil, err)
+		return
+	}
+
+	var jsonClaims bytes.Buffer
+	if err := json.NewEncoder(&jsonClaims).Encode(claims); err != nil {
+		s.handleError(w, r, a.GetID(), provider.ID, nil, err)
+		return
+	}
+
+	i := identity.NewIdentity(configuration.DefaultIdentityTraitsSchemaID)
+
+	vm := jsonnet.MakeVM()
+	vm.ExtCode("claims", jsonClaims.String())
+	evaluated, err := vm.EvaluateSnippet(provider.Mapper, jn.String())
+	if err != nil {
+		s.handleError(w, r, a.GetID(), provider.ID, nil, err)
+		return
+	} else if traits := gjson.Get(evaluated, "identity.traits"); !traits.IsObject() {
+		i.Traits = []byte{'{', '}'}
+		s.d.Logger().
+			WithRequest(r).
+			WithField("saml_provider", provider.ID).
+			WithSensitiveField("saml_claims", claims).
+			WithField("mapper_jsonnet_output", evaluated).
+			WithField("mapper_jsonnet_url", provider.Mapper).
+			Error("SAML Jsonnet mapper did not return an object for key identity.traits. Please check your Jsonnet code!")
+	} else {
+		i.Traits = []byte(traits.Raw)
+	}
+
+	s.d.Logger().
+		WithRequest(r).
+		WithField("saml_provider", provider.ID).
+		WithSensitiveField("saml_claims", claims).
+		WithField("mapper_jsonnet_output", evaluated).
+		WithField("mapper_jsonnet_url", provider.Mapper).
+		Debug("SAML Jsonnet mapper completed.")
+
+	option, err := decoderRegistration(s.c.DefaultIdentityTraitsSchemaURL().String())
+	if err != nil {
+		s.handleError(w, r, a.GetID(), provider.ID, nil, err)
+		return
+	}
+
+	i.Traits, err = merge(container.Form.Encode(), json.RawMessage(i.Traits), option)
+	if err != nil {
+		s.handleError(w, r, a.GetID(), provider.ID, nil, err)
+		return
+	}
+
+	// Validate the identity itself
+	if err := s.d.IdentityValidator().Validate(i); err != nil {
+		s.handleError(w, r, a.GetID(), provider.ID, i.Traits, err)
+		return
+	}
+
+	creds, err := NewCredentials(provider.ID, claims.Subject)
+	if err != nil {
+		s.handleError(w, r, a.GetID(), provider.ID, i.Traits, err)
+		return
+	}
+
+	i.SetCredentials(s.ID(), *creds)
+	if err := s.d.RegistrationExecutor().PostRegistrationHook(w, r, identity.CredentialsTypeSAML, a, i); err != nil {
+		s.handleError(w, r, a.GetID(), provider.ID, i.Traits, err)
+		return
+	}
+}
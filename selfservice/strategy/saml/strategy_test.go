@@ -0,0 +1,373 @@
+package saml_test
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/sqlxx"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/login"
+	"github.com/zzpu/ums/selfservice/flow/registration"
+	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/selfservice/strategy/saml"
+	"github.com/zzpu/ums/x"
+)
+
+func TestStrategy(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+
+	idp := newIdentityProvider(t)
+	viper.Set(configuration.ViperKeySelfServiceStrategyConfig+"."+string(identity.CredentialsTypeSAML), map[string]interface{}{
+		"enabled": true,
+		"config": map[string]interface{}{
+			"providers": []map[string]interface{}{{
+				"id":           "idp",
+				"metadata_url": idp.URL + "/metadata",
+				"mapper_url":   "file://./stub/saml.jsonnet",
+			}},
+		},
+	})
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/registration.schema.json")
+	viper.Set(configuration.HookStrategyKey(configuration.ViperKeySelfServiceRegistrationAfter,
+		identity.CredentialsTypeSAML.String()), []configuration.SelfServiceHook{{Name: "session"}})
+
+	ts, _ := testhelpers.NewKratosServer(t, reg)
+	errTS := testhelpers.NewErrorTestServer(t, reg)
+	loginUI := testhelpers.NewLoginUIFlowEchoServer(t, reg)
+	registrationUI := testhelpers.NewRegistrationUIFlowEchoServer(t, reg)
+	returnTS := testhelpers.NewRedirSessionEchoTS(t, reg)
+
+	var newLoginFlow = func(t *testing.T) *login.Flow {
+		req, err := reg.LoginHandler().NewLoginFlow(httptest.NewRecorder(),
+			&http.Request{URL: urlx.ParseOrPanic(returnTS.URL)}, flow.TypeBrowser)
+		require.NoError(t, err)
+		return req
+	}
+
+	var newRegistrationFlow = func(t *testing.T) *registration.Flow {
+		req, err := reg.RegistrationHandler().NewRegistrationFlow(httptest.NewRecorder(),
+			&http.Request{URL: urlx.ParseOrPanic(returnTS.URL)}, flow.TypeBrowser)
+		require.NoError(t, err)
+		return req
+	}
+
+	var action = func(id uuid.UUID) string {
+		return ts.URL + strings.Replace(saml.RouteAuth, ":flow", id.String(), 1)
+	}
+
+	var signIn = func(t *testing.T, id uuid.UUID, fv url.Values) (*http.Response, []byte) {
+		c := testhelpers.NewClientWithCookies(t)
+		fv.Set("provider", "idp")
+		acs, response := authenticate(t, c, action(id), fv)
+		assert.Equal(t, ts.URL+saml.RouteACS, acs)
+		return post(t, c, acs, response)
+	}
+
+	// assert identity (success)
+	var ai = func(t *testing.T, res *http.Response, body []byte, mail string) {
+		require.Contains(t, res.Request.URL.String(), returnTS.URL, "%s", body)
+		assert.Equal(t, mail, gjson.GetBytes(body, "identity.traits.email").String(), "%s", body)
+	}
+
+	// assert system error (redirect to error endpoint)
+	var asem = func(t *testing.T, res *http.Response, body []byte, code int, reason string) {
+		require.Contains(t, res.Request.URL.String(), errTS.URL, "%s", body)
+		assert.Equal(t, int64(code), gjson.GetBytes(body, "0.code").Int(), "%s", body)
+		assert.Contains(t, gjson.GetBytes(body, "0.reason").String(), reason, "%s", body)
+	}
+
+	t.Run("case=should expose the service provider metadata", func(t *testing.T) {
+		res, err := http.Get(ts.URL + strings.Replace(saml.RouteMetadata, ":provider", "idp", 1))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "application/samlmetadata+xml", res.Header.Get("Content-Type"))
+		assert.Contains(t, string(body), `entityID="`+ts.URL+strings.Replace(saml.RouteMetadata, ":provider", "idp", 1)+`"`)
+		assert.Contains(t, string(body), `Location="`+ts.URL+saml.RouteACS+`"`)
+	})
+
+	t.Run("case=should fail because provider does not exist", func(t *testing.T) {
+		res, err := testhelpers.NewClientWithCookies(t).PostForm(action(x.NewUUID()), url.Values{"provider": {"does-not-exist"}})
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		asem(t, res, body, http.StatusNotFound, "is unknown or has not been configured")
+	})
+
+	t.Run("case=register and then login", func(t *testing.T) {
+		idp.subject, idp.mail = "register-then-login", "register-then-login@example.org"
+
+		res, body := signIn(t, newRegistrationFlow(t).ID, url.Values{})
+		ai(t, res, body, idp.mail)
+		id := gjson.GetBytes(body, "identity.id").String()
+
+		_, c, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeSAML, "idp:register-then-login")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"idp:register-then-login"}, c.Identifiers)
+
+		res, body = signIn(t, newLoginFlow(t).ID, url.Values{})
+		ai(t, res, body, idp.mail)
+		assert.Equal(t, id, gjson.GetBytes(body, "identity.id").String(), "%s", body)
+	})
+
+	t.Run("case=should register when logging in without an account", func(t *testing.T) {
+		idp.subject, idp.mail = "login-without-register", "login-without-register@example.org"
+
+		res, body := signIn(t, newLoginFlow(t).ID, url.Values{})
+		ai(t, res, body, idp.mail)
+	})
+
+	t.Run("case=should use the form values to complete the traits", func(t *testing.T) {
+		idp.subject, idp.mail = "complete-data", "complete-data@example.org"
+
+		res, body := signIn(t, newRegistrationFlow(t).ID, url.Values{"traits.name": {"i"}})
+		require.Contains(t, res.Request.URL.String(), registrationUI.URL, "%s", body)
+		assert.Equal(t, "length must be >= 2, but got 1", gjson.GetBytes(body, "methods.saml.config.fields.#(name==traits.name).messages.0.text").String(), "%s", body)
+		assert.Equal(t, "i", gjson.GetBytes(body, "methods.saml.config.fields.#(name==traits.name).value").String(), "%s", body)
+
+		res, body = signIn(t, newRegistrationFlow(t).ID, url.Values{"traits.name": {"valid-name"}})
+		ai(t, res, body, idp.mail)
+		assert.Equal(t, "valid-name", gjson.GetBytes(body, "identity.traits.name").String(), "%s", body)
+	})
+
+	t.Run("case=should fail registration because the mapped traits are invalid", func(t *testing.T) {
+		idp.subject, idp.mail = "invalid-mail", "not-an-email"
+
+		res, body := signIn(t, newRegistrationFlow(t).ID, url.Values{})
+		require.Contains(t, res.Request.URL.String(), registrationUI.URL, "%s", body)
+		assert.Contains(t, gjson.GetBytes(body, "methods.saml.config.fields.#(name==traits.email).messages.0.text").String(), "is not valid", "%s", body)
+	})
+
+	t.Run("case=should not accept a response twice", func(t *testing.T) {
+		idp.subject, idp.mail = "replay", "replay@example.org"
+
+		c := testhelpers.NewClientWithCookies(t)
+		acs, response := authenticate(t, c, action(newLoginFlow(t).ID), url.Values{"provider": {"idp"}})
+
+		res, body := post(t, c, acs, response)
+		ai(t, res, body, idp.mail)
+
+		res, body = post(t, testhelpers.NewClientWithCookies(t), acs, response)
+		asem(t, res, body, http.StatusBadRequest, "unknown or was already used")
+	})
+
+	t.Run("case=should fail because the response is posted by another browser", func(t *testing.T) {
+		idp.subject, idp.mail = "other-browser", "other-browser@example.org"
+
+		c := testhelpers.NewClientWithCookies(t)
+		acs, response := authenticate(t, c, action(newLoginFlow(t).ID), url.Values{"provider": {"idp"}})
+
+		res, body := post(t, testhelpers.NewClientWithCookies(t), acs, response)
+		asem(t, res, body, http.StatusBadRequest, "started in another browser")
+
+		res, body = post(t, c, acs, response)
+		ai(t, res, body, idp.mail)
+	})
+
+	t.Run("case=should fail because the response was not issued for the request", func(t *testing.T) {
+		idp.subject, idp.mail = "mismatch", "mismatch@example.org"
+
+		c := testhelpers.NewClientWithCookies(t)
+		acs, first := authenticate(t, c, action(newLoginFlow(t).ID), url.Values{"provider": {"idp"}})
+		f := newLoginFlow(t)
+		_, second := authenticate(t, c, action(f.ID), url.Values{"provider": {"idp"}})
+
+		res, body := post(t, c, acs, url.Values{"SAMLResponse": first["SAMLResponse"], "RelayState": second["RelayState"]})
+		require.Contains(t, res.Request.URL.String(), loginUI.URL, "%s", body)
+		assert.Equal(t, f.ID.String(), gjson.GetBytes(body, "id").String(), "%s", body)
+		assert.Contains(t, gjson.GetBytes(body, "methods.saml.config.messages.0.text").String(), "invalid or expired response", "%s", body)
+	})
+
+	t.Run("case=should fail because the response contains an unsigned assertion", func(t *testing.T) {
+		idp.subject, idp.mail = "unsigned-assertion", "unsigned-assertion@example.org"
+
+		c := testhelpers.NewClientWithCookies(t)
+		f := newLoginFlow(t)
+		acs, response := authenticate(t, c, action(f.ID), url.Values{"provider": {"idp"}})
+
+		raw, err := base64.StdEncoding.DecodeString(response.Get("SAMLResponse"))
+		require.NoError(t, err)
+		signed := string(raw)
+
+		// withoutSignature removes the first signature from the element.
+		withoutSignature := func(element string) string {
+			start, end := strings.Index(element, "<ds:Signature"), strings.Index(element, "</ds:Signature>")+len("</ds:Signature>")
+			require.True(t, start >= 0 && end > start, "%s", element)
+			return element[:start] + element[end:]
+		}
+
+		// Only the assertion stays signed, while the injected assertion is an unsigned copy for another subject.
+		start, end := strings.Index(signed, "<saml:Assertion"), strings.Index(signed, "</saml:Assertion>")+len("</saml:Assertion>")
+		require.True(t, start >= 0 && end > start, "%s", signed)
+		unsigned := withoutSignature(signed[start:end])
+		unsigned = strings.Replace(unsigned, `ID="`, `ID="injected-`, 1)
+		unsigned = strings.Replace(unsigned, idp.subject, "attacker", -1)
+		unsigned = strings.Replace(unsigned, idp.mail, "attacker@example.org", -1)
+
+		response.Set("SAMLResponse", base64.StdEncoding.EncodeToString([]byte(withoutSignature(signed[:start])+unsigned+signed[start:])))
+		res, body := post(t, c, acs, response)
+		require.Contains(t, res.Request.URL.String(), loginUI.URL, "%s", body)
+		assert.Equal(t, f.ID.String(), gjson.GetBytes(body, "id").String(), "%s", body)
+		assert.Contains(t, gjson.GetBytes(body, "methods.saml.config.messages.0.text").String(), "invalid or expired response", "%s", body)
+
+		_, _, err = reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeSAML, "idp:attacker")
+		require.Error(t, err)
+	})
+
+	t.Run("case=should fail because the relay state is missing", func(t *testing.T) {
+		idp.subject, idp.mail = "missing-relay-state", "missing-relay-state@example.org"
+
+		c := testhelpers.NewClientWithCookies(t)
+		acs, response := authenticate(t, c, action(newLoginFlow(t).ID), url.Values{"provider": {"idp"}})
+		response.Del("RelayState")
+
+		res, body := post(t, c, acs, response)
+		asem(t, res, body, http.StatusBadRequest, "did not return the RelayState")
+	})
+
+	t.Run("case=should sign requests and decrypt assertions if a key is configured", func(t *testing.T) {
+		idp.subject, idp.mail = "encrypted", "encrypted@example.org"
+
+		key, cert := newCertificate(t)
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+
+		prefix := configuration.ViperKeySelfServiceStrategyConfig + "." + string(identity.CredentialsTypeSAML) + ".config"
+		viper.Set(prefix+".key_url", "base64://"+base64.StdEncoding.EncodeToString(keyPEM))
+		viper.Set(prefix+".certificate_url", "base64://"+base64.StdEncoding.EncodeToString(certPEM))
+		t.Cleanup(func() {
+			viper.Set(prefix+".key_url", "")
+			viper.Set(prefix+".certificate_url", "")
+		})
+
+		c := testhelpers.NewClientWithCookies(t)
+		acs, response := authenticate(t, c, action(newLoginFlow(t).ID), url.Values{"provider": {"idp"}})
+		raw, err := base64.StdEncoding.DecodeString(response.Get("SAMLResponse"))
+		require.NoError(t, err)
+		assert.Contains(t, string(raw), "EncryptedAssertion")
+
+		res, body := post(t, c, acs, response)
+		ai(t, res, body, idp.mail)
+	})
+
+	t.Run("case=should cache the metadata of the identity provider", func(t *testing.T) {
+		idp.subject, idp.mail = "cached-metadata", "cached-metadata@example.org"
+
+		res, body := signIn(t, newLoginFlow(t).ID, url.Values{})
+		ai(t, res, body, idp.mail)
+		res, body = signIn(t, newLoginFlow(t).ID, url.Values{})
+		ai(t, res, body, idp.mail)
+
+		assert.EqualValues(t, 1, atomic.LoadInt32(&idp.metadataRequests))
+	})
+
+	t.Run("method=PopulateLoginMethod", func(t *testing.T) {
+		sr := login.NewFlow(time.Minute, "nosurf", &http.Request{URL: urlx.ParseOrPanic("/")}, flow.TypeBrowser)
+		require.NoError(t, reg.LoginStrategies().MustStrategy(identity.CredentialsTypeSAML).(*saml.Strategy).PopulateLoginMethod(&http.Request{}, sr))
+
+		assert.EqualValues(t, &form.HTMLForm{
+			Action: ts.URL + strings.ReplaceAll(saml.RouteAuth, ":flow", sr.ID.String()),
+			Method: "POST",
+			Fields: form.Fields{
+				{Name: "csrf_token", Type: "hidden", Required: true, Value: x.FakeCSRFToken},
+				{Name: "provider", Type: "submit", Value: "idp"},
+			},
+		}, sr.Methods[identity.CredentialsTypeSAML].Config.FlowMethodConfigurator.(*saml.FlowMethod).HTMLForm)
+	})
+
+	t.Run("method=PopulateLoginMethod should ignore API flows", func(t *testing.T) {
+		sr := login.NewFlow(time.Minute, "nosurf", &http.Request{URL: urlx.ParseOrPanic("/")}, flow.TypeAPI)
+		require.NoError(t, reg.LoginStrategies().MustStrategy(identity.CredentialsTypeSAML).(*saml.Strategy).PopulateLoginMethod(&http.Request{}, sr))
+		assert.Empty(t, sr.Methods[identity.CredentialsTypeSAML])
+	})
+}
+
+func TestCountActiveCredentials(t *testing.T) {
+	conf, reg := internal.NewFastRegistryWithMocks(t)
+	strategy := saml.NewStrategy(reg, conf)
+
+	toJson := func(c saml.CredentialsConfig) []byte {
+		out, err := json.Marshal(&c)
+		require.NoError(t, err)
+		return out
+	}
+
+	for k, tc := range []struct {
+		in       identity.CredentialsCollection
+		expected int
+	}{
+		{
+			in: identity.CredentialsCollection{{
+				Type:   strategy.ID(),
+				Config: sqlxx.JSONRawMessage{},
+			}},
+		},
+		{
+			in: identity.CredentialsCollection{{
+				Type:        strategy.ID(),
+				Identifiers: []string{"bar:not-foo"},
+				Config: toJson(saml.CredentialsConfig{Providers: []saml.ProviderCredentialsConfig{
+					{Subject: "foo", Provider: "bar"},
+				}}),
+			}},
+		},
+		{
+			in: identity.CredentialsCollection{{
+				Type:        strategy.ID(),
+				Identifiers: []string{"bar:foo"},
+				Config: toJson(saml.CredentialsConfig{Providers: []saml.ProviderCredentialsConfig{
+					{Subject: "foo", Provider: "bar"},
+				}}),
+			}},
+			expected: 1,
+		},
+		{
+			in: identity.CredentialsCollection{{
+				Type:        strategy.ID(),
+				Identifiers: []string{"bar:urn:foo"},
+				Config: toJson(saml.CredentialsConfig{Providers: []saml.ProviderCredentialsConfig{
+					{Subject: "urn:foo", Provider: "bar"},
+				}}),
+			}},
+			expected: 1,
+		},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			in := make(map[identity.CredentialsType]identity.Credentials)
+			for _, v := range tc.in {
+				in[v.Type] = v
+			}
+			actual, err := strategy.CountActiveCredentials(in)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+
+	"github.com/crewjam/saml"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/x"
+)
+
+type CredentialsConfig struct {
+	Providers []ProviderCredentialsConfig `json:"providers"`
+}
+
+func NewCredentials(provider, subject string) (*identity.Credentials, error) {
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(CredentialsConfig{
+		Providers: []ProviderCredentialsConfig{{Subject: subject, Provider: provider}},
+	}); err != nil {
+		return nil, errors.WithStack(x.PseudoPanic.
+			WithDebugf("Unable to encode SAML options to JSON: %s", err))
+	}
+
+	return &identity.Credentials{
+		Type:        identity.CredentialsTypeSAML,
+		Identifiers: []string{uid(provider, subject)},
+		Config:      b.Bytes(),
+	}, nil
+}
+
+type ProviderCredentialsConfig struct {
+	Subject  string `json:"subject"`
+	Provider string `json:"provider"`
+}
+
+// Claims contains the subject and the attributes of a verified SAML assertion. It is
+// available in the Jsonnet mapper as `std.extVar('claims')`.
+type Claims struct {
+	Subject    string              `json:"sub"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+func newClaims(assertion *saml.Assertion) *Claims {
+	c := &Claims{Attributes: map[string][]string{}}
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		c.Subject = assertion.Subject.NameID.Value
+	}
+
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			values := make([]string, len(attribute.Values))
+			for k, v := range attribute.Values {
+				values[k] = v.Value
+			}
+
+			c.Attributes[attribute.Name] = append(c.Attributes[attribute.Name], values...)
+			if attribute.FriendlyName != "" && attribute.FriendlyName != attribute.Name {
+				c.Attributes[attribute.FriendlyName] = append(c.Attributes[attribute.FriendlyName], values...)
+			}
+		}
+	}
+
+	return c
+}
+
+// authnRequestContainer is stored server-side while the user authenticates at the Identity Provider. The container
+// ID is sent as RelayState and bound to the browser using a cookie, and the response must be issued in response to
+// the stored AuthnRequest ID.
+type authnRequestContainer struct {
+	FlowID    string     `json:"flow_id"`
+	Provider  string     `json:"provider"`
+	RequestID string     `json:"request_id"`
+	Form      url.Values `json:"form"`
+}
+
+type FlowMethod struct {
+	*form.HTMLForm
+}
+
+func (r *FlowMethod) AddProviders(providers []Configuration) *FlowMethod {
+	for _, p := range providers {
+		r.Fields = append(r.Fields, form.Field{Name: "provider", Type: "submit", Value: p.ID})
+	}
+	return r
+}
+
+func NewFlowMethod(f *form.HTMLForm) *FlowMethod {
+	return &FlowMethod{HTMLForm: f}
+}
+
+type ider interface {
+	GetID() uuid.UUID
+}
@@ -0,0 +1,78 @@
+package totp
+
+import (
+	"crypto/subtle"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pquerna/otp"
+	stdtotp "github.com/pquerna/otp/totp"
+
+	"github.com/zzpu/ums/identity"
+)
+
+// NewKey generates a new TOTP key for the identity. The account name shown in the
+// authenticator app is the first password identifier or the identity's ID.
+func (s *Strategy) NewKey(i *identity.Identity) (*otp.Key, error) {
+	conf, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	account := i.ID.String()
+	if c, ok := i.GetCredentials(identity.CredentialsTypePassword); ok && len(c.Identifiers) > 0 && len(c.Identifiers[0]) > 0 {
+		account = c.Identifiers[0]
+	}
+
+	key, err := stdtotp.Generate(stdtotp.GenerateOpts{Issuer: conf.Issuer, AccountName: account})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return key, nil
+}
+
+// Validate checks the code against the key URL and returns the time step the code belongs to. Codes
+// of the previous and the next time step are accepted as well to allow for clock skew, but codes of
+// time steps up to and including lastTimeStep are rejected so that a code can not be used twice.
+func Validate(code, keyURL string, lastTimeStep int64) (int64, bool, error) {
+	key, err := otp.NewKeyFromURL(keyURL)
+	if err != nil {
+		return 0, false, errors.WithStack(err)
+	}
+
+	period := uint64(30)
+	if u, err := url.Parse(keyURL); err == nil {
+		if p, err := strconv.ParseUint(u.Query().Get("period"), 10, 32); err == nil && p > 0 {
+			period = p
+		}
+	}
+
+	code = strings.TrimSpace(code)
+	now := time.Now().UTC()
+	for _, skew := range []int64{0, -1, 1} {
+		t := now.Add(time.Duration(skew*int64(period)) * time.Second)
+		step := t.Unix() / int64(period)
+		if step <= lastTimeStep {
+			continue
+		}
+
+		expected, err := stdtotp.GenerateCodeCustom(key.Secret(), t, stdtotp.ValidateOpts{
+			Period:    uint(period),
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return 0, false, errors.WithStack(err)
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
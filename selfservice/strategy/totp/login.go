@@ -0,0 +1,269 @@
+package totp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/markbates/pkger"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/schema"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/login"
+	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/selfservice/strategy/password"
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteLogin = "/self-service/login/methods/totp"
+)
+
+func (s *Strategy) RegisterLoginRoutes(r *x.RouterPublic) {
+	s.d.CSRFHandler().ExemptPath(RouteLogin)
+	r.POST(RouteLogin, s.handleLogin)
+}
+
+func (s *Strategy) handleLoginError(w http.ResponseWriter, r *http.Request, f *login.Flow, err error) {
+	if f != nil {
+		method, ok := f.Methods[s.ID()]
+		if !ok {
+			// The method is only available once the first factor was completed, so there is no form to
+			// attach the error to.
+			f = nil
+		} else {
+			method.Config.Reset()
+			if f.Type == flow.TypeBrowser {
+				method.Config.SetCSRF(s.d.GenerateCSRFToken(r))
+			}
+
+			f.Methods[s.ID()] = method
+		}
+	}
+
+	s.d.LoginFlowErrorHandler().WriteFlowError(w, r, s.ID(), f, err)
+}
+
+// nolint:deadcode,unused
+// swagger:parameters completeSelfServiceLoginFlowWithTOTPMethod
+type completeSelfServiceLoginFlowWithTOTPMethodParameters struct {
+	// The Flow ID
+	//
+	// required: true
+	// in: query
+	Flow string `json:"flow"`
+
+	// in: body
+	CompleteSelfServiceLoginFlowWithTOTPMethod
+}
+
+// swagger:route POST /self-service/login/methods/totp public completeSelfServiceLoginFlowWithTOTPMethod
+//
+// Complete Login Flow with the TOTP Method
+//
+// Use this endpoint to complete a login flow by sending the code of the identity's authenticator app. This
+// is only possible after the identity completed the first factor (e.g. the password method) of the same flow.
+// This endpoint behaves differently for API and browser flows.
+//
+// API flows expect `application/json` to be sent in the body and responds with
+//   - HTTP 200 and a application/json body with the session token on success;
+//   - HTTP 302 redirect to a fresh login flow if the original flow expired with the appropriate error messages set;
+//   - HTTP 400 on form validation errors.
+//
+// Browser flows expect `application/x-www-form-urlencoded` to be sent in the body and responds with
+//   - a HTTP 302 redirect to the post/after login URL or the `return_to` value if it was set and if the login succeeded;
+//   - a HTTP 302 redirect to the login UI URL with the flow ID containing the validation errors otherwise.
+//
+//     Schemes: http, https
+//
+//     Consumes:
+//     - application/json
+//     - application/x-www-form-urlencoded
+//
+//     Produces:
+//     - application/json
+//
+//     Responses:
+//       200: loginViaApiResponse
+//       302: emptyResponse
+//       400: loginFlow
+//       500: genericError
+func (s *Strategy) handleLogin(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rid := x.ParseUUID(r.URL.Query().Get("flow"))
+	if x.IsZeroUUID(rid) {
+		s.handleLoginError(w, r, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The flow query parameter is missing or invalid.")))
+		return
+	}
+
+	ar, err := s.d.LoginFlowPersister().GetLoginFlow(r.Context(), rid)
+	if err != nil {
+		s.handleLoginError(w, r, nil, err)
+		return
+	}
+
+	var p CompleteSelfServiceLoginFlowWithTOTPMethod
+	if err := s.hd.Decode(r, &p, decoderx.MustHTTPRawJSONSchemaCompiler(x.MustPkgerRead(
+		pkger.Open("/selfservice/strategy/totp/.schema/login.schema.json")))); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if err := flow.VerifyRequest(r, ar.Type, s.d.GenerateCSRFToken, p.CSRFToken); err != nil {
+		s.handleLoginError(w, r, ar, x.ErrInvalidCSRFToken)
+		return
+	}
+
+	if _, err := s.d.SessionManager().FetchFromRequest(r.Context(), r); err == nil && !ar.Forced && !ar.IsStepUp() {
+		if ar.Type == flow.TypeBrowser {
+			http.Redirect(w, r, s.c.SelfServiceBrowserDefaultReturnTo().String(), http.StatusFound)
+			return
+		}
+
+		s.d.Writer().WriteError(w, r, errors.WithStack(login.ErrAlreadyLoggedIn))
+		return
+	}
+
+	if err := ar.Valid(); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if !ar.RequiresSecondFactor() {
+		s.handleLoginError(w, r, ar, errors.WithStack(login.ErrFirstFactorRequired))
+		return
+	}
+
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), ar.IdentityID.UUID)
+	if err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	var o CredentialsConfig
+	if _, err := i.ParseCredentials(s.ID(), &o); err != nil {
+		s.handleLoginError(w, r, ar, errors.WithStack(schema.NewTOTPVerifierWrongError("#/totp_code")))
+		return
+	}
+
+	conf, err := s.Config()
+	if err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	// The attempt is counted before the code is checked so that concurrent requests can not exceed the limit.
+	if err := s.countAttempt(r, conf, i); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	step, ok, err := Validate(p.TOTPCode, o.TOTPURL, o.LastTimeStep)
+	if err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, herodot.ErrInternalServerError.WithReason("The TOTP credentials could not be decoded properly").WithDebug(err.Error()))
+		return
+	} else if !ok {
+		s.handleLoginError(w, r, ar, errors.WithStack(schema.NewTOTPVerifierWrongError("#/totp_code")))
+		return
+	}
+
+	if err := s.useTimeStep(r.Context(), conf, i, &o, step); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if err := s.d.LoginHookExecutor().PostLoginHook(w, r, s.ID(), ar, i); err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+}
+
+// attemptsIdentifier returns the identifier under which wrong codes of the identity are counted. It can
+// not collide with password identifiers because those never start with the prefix.
+func attemptsIdentifier(i *identity.Identity) string {
+	return "totp:" + i.ID.String()
+}
+
+// countAttempt stores an attempt to enter a code for the identity and returns an error if too many attempts
+// were made. Attempts are forgotten once a code was accepted.
+func (s *Strategy) countAttempt(r *http.Request, c *Configuration, i *identity.Identity) error {
+	if c.MaxAttempts <= 0 {
+		return nil
+	}
+
+	if err := s.d.LoginFailurePersister().CreateLoginFailure(r.Context(), &password.LoginFailure{
+		Identifier: attemptsIdentifier(i),
+	}); err != nil {
+		return err
+	}
+
+	failures, err := s.d.LoginFailurePersister().ListLoginFailuresByIdentifier(r.Context(), attemptsIdentifier(i), time.Now().UTC().Add(-c.lockoutDuration()))
+	if err != nil {
+		return err
+	}
+
+	if len(failures) > c.MaxAttempts {
+		s.d.Audit().
+			WithRequest(r).
+			WithField("identity_id", i.ID).
+			Info("Rejected a TOTP code because too many wrong codes were entered.")
+		return schema.NewLoginLockedError(failures[len(failures)-c.MaxAttempts].CreatedAt.Add(c.lockoutDuration()))
+	}
+
+	return nil
+}
+
+// useTimeStep remembers the time step of the accepted code so that the code can not be replayed, and
+// forgets the attempts made before.
+func (s *Strategy) useTimeStep(ctx context.Context, c *Configuration, i *identity.Identity, o *CredentialsConfig, step int64) error {
+	o.LastTimeStep = step
+	co, err := json.Marshal(o)
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode totp options to JSON: %s", err))
+	}
+
+	// The update fails if the credentials were changed since they were loaded, for example because a concurrent
+	// request accepted the same code.
+	credentials, _ := i.GetCredentials(s.ID())
+	if err := s.d.PrivilegedIdentityPool().UpdateIdentityCredentialsConfig(ctx, credentials, co); errors.Is(err, sqlcon.ErrNoRows) {
+		return errors.WithStack(schema.NewTOTPVerifierWrongError("#/totp_code"))
+	} else if err != nil {
+		return err
+	}
+	i.SetCredentials(s.ID(), *credentials)
+
+	if c.MaxAttempts <= 0 {
+		return nil
+	}
+	return s.d.LoginFailurePersister().DeleteLoginFailuresByIdentifier(ctx, attemptsIdentifier(i))
+}
+
+// PopulateLoginMethod only adds the TOTP method once the first factor of the flow was completed.
+func (s *Strategy) PopulateLoginMethod(r *http.Request, sr *login.Flow) error {
+	if !sr.RequiresSecondFactor() {
+		return nil
+	}
+
+	f := &form.HTMLForm{
+		Action: sr.AppendTo(urlx.AppendPaths(s.c.SelfPublicURL(), RouteLogin)).String(),
+		Method: "POST",
+		Fields: form.Fields{{
+			Name:     "totp_code",
+			Type:     "text",
+			Required: true,
+		}}}
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+
+	sr.Methods[s.ID()] = &login.FlowMethod{
+		Method: s.ID(),
+		Config: &login.FlowMethodConfig{FlowMethodConfigurator: &FlowMethod{HTMLForm: f}}}
+	return nil
+}
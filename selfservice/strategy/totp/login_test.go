@@ -0,0 +1,309 @@
+package totp_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	stdtotp "github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/sqlxx"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/httpclient/models"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/flow/login"
+	"github.com/zzpu/ums/selfservice/strategy/totp"
+	"github.com/zzpu/ums/session"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+func TestCompleteLogin(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+	testhelpers.StrategyEnable(identity.CredentialsTypePassword.String(), true)
+	testhelpers.StrategyEnable(identity.CredentialsTypeTOTP.String(), true)
+
+	publicTS, _ := testhelpers.NewKratosServer(t, reg)
+	_ = testhelpers.NewErrorTestServer(t, reg)
+	uiTS := testhelpers.NewLoginUIFlowEchoServer(t, reg)
+	redirTS := testhelpers.NewRedirSessionEchoTS(t, reg)
+
+	viper.Set(configuration.ViperKeySelfServiceBrowserDefaultReturnTo, redirTS.URL+"/return-ts")
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/login.schema.json")
+	viper.Set(configuration.ViperKeySecretsDefault, []string{"not-a-secure-session-key"})
+
+	createIdentity := func(t *testing.T, identifier, pw string, withTOTP bool) string {
+		p, _ := reg.Hasher().Generate([]byte(pw))
+		i := &identity.Identity{
+			ID:     x.NewUUID(),
+			Traits: identity.Traits(`{}`),
+			Credentials: map[identity.CredentialsType]identity.Credentials{
+				identity.CredentialsTypePassword: {
+					Type:        identity.CredentialsTypePassword,
+					Identifiers: []string{identifier},
+					Config:      sqlxx.JSONRawMessage(`{"hashed_password":"` + string(p) + `"}`),
+				},
+			},
+		}
+
+		var secret string
+		if withTOTP {
+			key, err := stdtotp.Generate(stdtotp.GenerateOpts{Issuer: "ORY Kratos", AccountName: identifier})
+			require.NoError(t, err)
+			secret = key.Secret()
+
+			config, err := json.Marshal(totp.CredentialsConfig{TOTPURL: key.URL()})
+			require.NoError(t, err)
+			i.Credentials[identity.CredentialsTypeTOTP] = identity.Credentials{
+				Type:        identity.CredentialsTypeTOTP,
+				Identifiers: []string{i.ID.String()},
+				Config:      config,
+			}
+		}
+
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+		return secret
+	}
+
+	loginWithPassword := func(t *testing.T, isAPI bool, hc *http.Client, identifier, pw string) string {
+		var f *models.LoginFlow
+		if isAPI {
+			f = testhelpers.InitializeLoginFlowViaAPI(t, hc, publicTS, false).Payload
+		} else {
+			f = testhelpers.InitializeLoginFlowViaBrowser(t, hc, publicTS, false).Payload
+		}
+
+		_, ok := f.Methods[identity.CredentialsTypeTOTP.String()]
+		assert.False(t, ok, "the second factor must not be offered before the first factor was completed")
+
+		c := testhelpers.GetLoginFlowMethodConfig(t, f, identity.CredentialsTypePassword.String())
+		body, res := testhelpers.LoginMakeRequest(t, isAPI, c, hc, testhelpers.EncodeFormAsJSON(t, isAPI, url.Values{
+			"csrf_token": {x.FakeCSRFToken}, "identifier": {identifier}, "password": {pw}}))
+		assert.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body)
+		return body
+	}
+
+	submitCode := func(t *testing.T, isAPI bool, hc *http.Client, flow, code string) (string, *http.Response) {
+		action := gjson.Get(flow, "methods.totp.config.action").String()
+		require.NotEmpty(t, action, "%s", flow)
+		return testhelpers.LoginMakeRequest(t, isAPI, &models.LoginFlowMethodConfig{Action: &action}, hc,
+			testhelpers.EncodeFormAsJSON(t, isAPI, url.Values{"csrf_token": {x.FakeCSRFToken}, "totp_code": {code}}))
+	}
+
+	for _, tc := range []struct {
+		d     string
+		isAPI bool
+	}{
+		{d: "type=api", isAPI: true},
+		{d: "type=browser", isAPI: false},
+	} {
+		t.Run(tc.d, func(t *testing.T) {
+			newClient := func() *http.Client {
+				if tc.isAPI {
+					return testhelpers.NewDebugClient(t)
+				}
+				return testhelpers.NewClientWithCookies(t)
+			}
+
+			t.Run("case=should require the second factor after the password was accepted", func(t *testing.T) {
+				identifier := fmt.Sprintf("login-totp-%s@ory.sh", x.NewUUID())
+				secret := createIdentity(t, identifier, "password", true)
+				hc := newClient()
+
+				flow := loginWithPassword(t, tc.isAPI, hc, identifier, "password")
+				assert.Empty(t, gjson.Get(flow, "session").Raw, "%s", flow)
+				assert.Empty(t, gjson.Get(flow, "methods.password").Raw, "%s", flow)
+				assert.EqualValues(t, text.InfoSelfServiceMFASecondFactorRequired, gjson.Get(flow, "messages.0.id").Int(), "%s", flow)
+				assert.EqualValues(t, "totp_code", gjson.Get(flow, "methods.totp.config.fields.0.name").String(), "%s", flow)
+
+				t.Run("case=should fail with an invalid code", func(t *testing.T) {
+					body, res := submitCode(t, tc.isAPI, hc, flow, "000000")
+					if tc.isAPI {
+						assert.EqualValues(t, http.StatusBadRequest, res.StatusCode, "%s", body)
+					} else {
+						assert.Contains(t, res.Request.URL.String(), uiTS.URL, "%s", body)
+					}
+					assert.EqualValues(t, text.ErrorValidationTOTPVerifierWrong, gjson.Get(body, "methods.totp.config.fields.#(name==totp_code).messages.0.id").Int(), "%s", body)
+				})
+
+				t.Run("case=should issue a session with a valid code", func(t *testing.T) {
+					code, err := stdtotp.GenerateCode(secret, time.Now())
+					require.NoError(t, err)
+
+					body, res := submitCode(t, tc.isAPI, hc, flow, code)
+					assert.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body)
+					if tc.isAPI {
+						assert.NotEmpty(t, gjson.Get(body, "session_token").String(), "%s", body)
+						assert.NotEmpty(t, gjson.Get(body, "session.identity.id").String(), "%s", body)
+						assert.EqualValues(t, session.AuthenticatorAssuranceLevel2, gjson.Get(body, "session.aal").String(), "%s", body)
+					} else {
+						assert.Contains(t, res.Request.URL.String(), redirTS.URL, "%s", body)
+						assert.NotEmpty(t, gjson.Get(body, "identity.id").String(), "%s", body)
+						assert.EqualValues(t, session.AuthenticatorAssuranceLevel2, gjson.Get(body, "aal").String(), "%s", body)
+					}
+				})
+			})
+
+			t.Run("case=should not accept the same code twice", func(t *testing.T) {
+				identifier := fmt.Sprintf("login-totp-replay-%s@ory.sh", x.NewUUID())
+				secret := createIdentity(t, identifier, "password", true)
+
+				code, err := stdtotp.GenerateCode(secret, time.Now())
+				require.NoError(t, err)
+
+				hc := newClient()
+				body, res := submitCode(t, tc.isAPI, hc, loginWithPassword(t, tc.isAPI, hc, identifier, "password"), code)
+				assert.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body)
+				assert.Contains(t, body, `"aal":"aal2"`, "%s", body)
+
+				hc = newClient()
+				body, res = submitCode(t, tc.isAPI, hc, loginWithPassword(t, tc.isAPI, hc, identifier, "password"), code)
+				if tc.isAPI {
+					assert.EqualValues(t, http.StatusBadRequest, res.StatusCode, "%s", body)
+				}
+				assert.EqualValues(t, text.ErrorValidationTOTPVerifierWrong, gjson.Get(body, "methods.totp.config.fields.#(name==totp_code).messages.0.id").Int(), "%s", body)
+			})
+
+			t.Run("case=should lock the second factor after too many wrong codes", func(t *testing.T) {
+				viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".totp.config", map[string]interface{}{"max_attempts": 2})
+				t.Cleanup(func() {
+					viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".totp.config", map[string]interface{}{})
+				})
+
+				identifier := fmt.Sprintf("login-totp-locked-%s@ory.sh", x.NewUUID())
+				secret := createIdentity(t, identifier, "password", true)
+				hc := newClient()
+				flow := loginWithPassword(t, tc.isAPI, hc, identifier, "password")
+
+				for k := 0; k < 2; k++ {
+					body, _ := submitCode(t, tc.isAPI, hc, flow, "000000")
+					assert.EqualValues(t, text.ErrorValidationTOTPVerifierWrong, gjson.Get(body, "methods.totp.config.fields.#(name==totp_code).messages.0.id").Int(), "%s", body)
+				}
+
+				code, err := stdtotp.GenerateCode(secret, time.Now())
+				require.NoError(t, err)
+
+				body, res := submitCode(t, tc.isAPI, hc, flow, code)
+				if tc.isAPI {
+					assert.EqualValues(t, http.StatusBadRequest, res.StatusCode, "%s", body)
+				}
+				assert.EqualValues(t, text.ErrorValidationLoginLocked, gjson.Get(body, "methods.totp.config.messages.0.id").Int(), "%s", body)
+				assert.Empty(t, gjson.Get(body, "session").Raw, "%s", body)
+			})
+
+			t.Run("case=should not require a second factor if none was set up", func(t *testing.T) {
+				identifier := fmt.Sprintf("login-no-totp-%s@ory.sh", x.NewUUID())
+				createIdentity(t, identifier, "password", false)
+
+				body := loginWithPassword(t, tc.isAPI, newClient(), identifier, "password")
+				if tc.isAPI {
+					assert.NotEmpty(t, gjson.Get(body, "session_token").String(), "%s", body)
+					assert.EqualValues(t, session.AuthenticatorAssuranceLevel1, gjson.Get(body, "session.aal").String(), "%s", body)
+				} else {
+					assert.NotEmpty(t, gjson.Get(body, "identity.id").String(), "%s", body)
+					assert.EqualValues(t, session.AuthenticatorAssuranceLevel1, gjson.Get(body, "aal").String(), "%s", body)
+				}
+			})
+
+			t.Run("case=step-up", func(t *testing.T) {
+				newSessionClient := func(t *testing.T, identifier string) (*http.Client, *session.Session) {
+					i, _, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypePassword, identifier)
+					require.NoError(t, err)
+
+					sess := session.NewActiveSession(i, testhelpers.NewSessionLifespanProvider(time.Hour), time.Now())
+					if tc.isAPI {
+						return testhelpers.NewHTTPClientWithSessionToken(t, reg, sess), sess
+					}
+					return testhelpers.NewHTTPClientWithSessionCookie(t, reg, sess), sess
+				}
+
+				initStepUp := func(t *testing.T, hc *http.Client) (string, *http.Response) {
+					route := login.RouteInitBrowserFlow
+					if tc.isAPI {
+						route = login.RouteInitAPIFlow
+					}
+
+					res, err := hc.Get(publicTS.URL + route + "?aal=aal2")
+					require.NoError(t, err)
+					defer res.Body.Close()
+					body, err := ioutil.ReadAll(res.Body)
+					require.NoError(t, err)
+					return string(body), res
+				}
+
+				t.Run("case=should upgrade the existing session with a valid code", func(t *testing.T) {
+					identifier := fmt.Sprintf("login-totp-step-up-%s@ory.sh", x.NewUUID())
+					secret := createIdentity(t, identifier, "password", true)
+					hc, sess := newSessionClient(t, identifier)
+
+					flow, res := initStepUp(t, hc)
+					assert.EqualValues(t, http.StatusOK, res.StatusCode, "%s", flow)
+					assert.EqualValues(t, session.AuthenticatorAssuranceLevel2, gjson.Get(flow, "requested_aal").String(), "%s", flow)
+					assert.Empty(t, gjson.Get(flow, "methods.password").Raw, "%s", flow)
+					assert.EqualValues(t, "totp_code", gjson.Get(flow, "methods.totp.config.fields.0.name").String(), "%s", flow)
+
+					code, err := stdtotp.GenerateCode(secret, time.Now())
+					require.NoError(t, err)
+
+					body, res := submitCode(t, tc.isAPI, hc, flow, code)
+					assert.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body)
+					if tc.isAPI {
+						assert.EqualValues(t, sess.Token, gjson.Get(body, "session_token").String(), "%s", body)
+						assert.EqualValues(t, sess.ID.String(), gjson.Get(body, "session.id").String(), "%s", body)
+						assert.EqualValues(t, session.AuthenticatorAssuranceLevel2, gjson.Get(body, "session.aal").String(), "%s", body)
+					} else {
+						assert.Contains(t, res.Request.URL.String(), redirTS.URL, "%s", body)
+						assert.EqualValues(t, sess.ID.String(), gjson.Get(body, "id").String(), "%s", body)
+						assert.EqualValues(t, session.AuthenticatorAssuranceLevel2, gjson.Get(body, "aal").String(), "%s", body)
+					}
+
+					actual, err := reg.SessionPersister().GetSession(context.Background(), sess.ID)
+					require.NoError(t, err)
+					assert.Equal(t, session.AuthenticatorAssuranceLevel2, actual.AAL)
+				})
+
+				t.Run("case=should fail if no second factor was set up", func(t *testing.T) {
+					identifier := fmt.Sprintf("login-no-totp-step-up-%s@ory.sh", x.NewUUID())
+					createIdentity(t, identifier, "password", false)
+					hc, _ := newSessionClient(t, identifier)
+
+					body, res := initStepUp(t, hc)
+					if tc.isAPI {
+						assert.EqualValues(t, http.StatusBadRequest, res.StatusCode, "%s", body)
+					}
+					assert.Contains(t, body, "has not set up a second authentication factor", "%s", body)
+				})
+			})
+
+			t.Run("case=should not allow the second factor without the first one", func(t *testing.T) {
+				hc := newClient()
+				var f *models.LoginFlow
+				if tc.isAPI {
+					f = testhelpers.InitializeLoginFlowViaAPI(t, hc, publicTS, false).Payload
+				} else {
+					f = testhelpers.InitializeLoginFlowViaBrowser(t, hc, publicTS, false).Payload
+				}
+
+				action := publicTS.URL + totp.RouteLogin + "?flow=" + string(f.ID)
+				body, res := testhelpers.LoginMakeRequest(t, tc.isAPI, &models.LoginFlowMethodConfig{Action: &action}, hc,
+					testhelpers.EncodeFormAsJSON(t, tc.isAPI, url.Values{"csrf_token": {x.FakeCSRFToken}, "totp_code": {"123456"}}))
+				assert.Contains(t, body, "can only be used once the first factor was completed", "%s", body)
+				if tc.isAPI {
+					assert.EqualValues(t, http.StatusBadRequest, res.StatusCode, "%s", body)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,7 @@
+package totp
+
+import (
+	"github.com/markbates/pkger"
+)
+
+var _ = pkger.Dir("/selfservice/strategy/totp/.schema")
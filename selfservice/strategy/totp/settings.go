@@ -0,0 +1,304 @@
+package totp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/markbates/pkger"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/schema"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/settings"
+	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteSettings = "/self-service/settings/methods/totp"
+)
+
+func (s *Strategy) RegisterSettingsRoutes(router *x.RouterPublic) {
+	s.d.CSRFHandler().ExemptPath(RouteSettings)
+	router.POST(RouteSettings, s.submitSettingsFlow)
+	router.GET(RouteSettings, s.submitSettingsFlow)
+}
+
+func (s *Strategy) SettingsStrategyID() string {
+	return s.ID().String()
+}
+
+// nolint:deadcode,unused
+// swagger:parameters completeSelfServiceSettingsFlowWithTOTPMethod
+type completeSelfServiceSettingsFlowWithTOTPMethod struct {
+	// in: body
+	Body CompleteSelfServiceSettingsFlowWithTOTPMethod
+
+	// Flow is flow ID.
+	//
+	// in: query
+	Flow string `json:"flow"`
+}
+
+type CompleteSelfServiceSettingsFlowWithTOTPMethod struct {
+	// TOTPCode is the code generated by the authenticator app. It confirms
+	// that the app was set up correctly.
+	//
+	// type: string
+	TOTPCode string `json:"totp_code"`
+
+	// TOTPUnlink removes the authenticator app from the identity.
+	//
+	// type: boolean
+	TOTPUnlink bool `json:"totp_unlink"`
+
+	// CSRFToken is the anti-CSRF token
+	//
+	// type: string
+	CSRFToken string `json:"csrf_token"`
+
+	// Flow is flow ID.
+	//
+	// swagger:ignore
+	Flow string `json:"flow"`
+}
+
+func (p *CompleteSelfServiceSettingsFlowWithTOTPMethod) GetFlowID() uuid.UUID {
+	return x.ParseUUID(p.Flow)
+}
+
+func (p *CompleteSelfServiceSettingsFlowWithTOTPMethod) SetFlowID(rid uuid.UUID) {
+	p.Flow = rid.String()
+}
+
+// swagger:route POST /self-service/settings/methods/totp public completeSelfServiceSettingsFlowWithTOTPMethod
+//
+// Complete Settings Flow with the TOTP Method
+//
+// Use this endpoint to set up an authenticator app by sending a code generated by the app for the key
+// shown in the settings flow (`totp_url` and `totp_secret_key`), or to remove the authenticator app by
+// sending `totp_unlink`. This endpoint behaves differently for API and browser flows.
+//
+// API-initiated flows expect `application/json` to be sent in the body and respond with
+//   - HTTP 200 and an application/json body with the session token on success;
+//   - HTTP 302 redirect to a fresh settings flow if the original flow expired with the appropriate error messages set;
+//   - HTTP 400 on form validation errors.
+//   - HTTP 401 when the endpoint is called without a valid session token.
+//   - HTTP 403 when `selfservice.flows.settings.privileged_session_max_age` was reached.
+//     Implies that the user needs to re-authenticate.
+//
+// Browser flows expect `application/x-www-form-urlencoded` to be sent in the body and responds with
+//   - a HTTP 302 redirect to the post/after settings URL or the `return_to` value if it was set and if the flow succeeded;
+//   - a HTTP 302 redirect to the Settings UI URL with the flow ID containing the validation errors otherwise.
+//   - a HTTP 302 redirect to the login endpoint when `selfservice.flows.settings.privileged_session_max_age` was reached.
+//
+//     Consumes:
+//     - application/json
+//     - application/x-www-form-urlencoded
+//
+//     Produces:
+//     - application/json
+//
+//     Security:
+//       sessionToken:
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: settingsViaApiResponse
+//       302: emptyResponse
+//       400: settingsFlow
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (s *Strategy) submitSettingsFlow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var p CompleteSelfServiceSettingsFlowWithTOTPMethod
+	ctxUpdate, err := settings.PrepareUpdate(s.d, w, r, settings.ContinuityKey(s.SettingsStrategyID()), &p)
+	if errors.Is(err, settings.ErrContinuePreviousAction) {
+		s.continueSettingsFlow(w, r, ctxUpdate, &p)
+		return
+	} else if err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, &p, err)
+		return
+	}
+
+	if err := s.decodeSettingsFlow(r, &p); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, &p, err)
+		return
+	}
+
+	// This does not come from the payload!
+	p.Flow = ctxUpdate.Flow.ID.String()
+	s.continueSettingsFlow(w, r, ctxUpdate, &p)
+}
+
+func (s *Strategy) decodeSettingsFlow(r *http.Request, dest interface{}) error {
+	compiler, err := decoderx.HTTPRawJSONSchemaCompiler(x.MustPkgerRead(pkger.Open("/selfservice/strategy/totp/.schema/settings.schema.json")))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return decoderx.NewHTTP().Decode(r, dest, compiler,
+		decoderx.HTTPDecoderSetValidatePayloads(false),
+		decoderx.HTTPDecoderJSONFollowsFormFormat(),
+	)
+}
+
+func (s *Strategy) continueSettingsFlow(
+	w http.ResponseWriter, r *http.Request,
+	ctxUpdate *settings.UpdateContext, p *CompleteSelfServiceSettingsFlowWithTOTPMethod,
+) {
+	if err := flow.VerifyRequest(r, ctxUpdate.Flow.Type, s.d.GenerateCSRFToken, p.CSRFToken); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	if ctxUpdate.Session.AuthenticatedAt.Add(s.c.SelfServiceFlowSettingsPrivilegedSessionMaxAge()).Before(time.Now()) {
+		s.handleSettingsError(w, r, ctxUpdate, p, errors.WithStack(settings.NewFlowNeedsReAuth()))
+		return
+	}
+
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), ctxUpdate.Session.Identity.ID)
+	if err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	if p.TOTPUnlink {
+		delete(i.Credentials, s.ID())
+	} else if err := s.linkKey(ctxUpdate, p, i); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	if err := s.d.SettingsHookExecutor().PostSettingsHook(w, r, s.SettingsStrategyID(), ctxUpdate, i, settings.WithCallback(func(ctxUpdate *settings.UpdateContext) error {
+		return s.PopulateSettingsMethod(r, ctxUpdate.Session.Identity, ctxUpdate.Flow)
+	})); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+}
+
+// linkKey verifies the code against the key which was shown in the settings flow and adds
+// the key to the identity's credentials.
+func (s *Strategy) linkKey(ctxUpdate *settings.UpdateContext, p *CompleteSelfServiceSettingsFlowWithTOTPMethod, i *identity.Identity) error {
+	if len(p.TOTPCode) == 0 {
+		return schema.NewRequiredError("#/totp_code", "totp_code")
+	}
+
+	keyURL := pendingKeyURL(ctxUpdate.Flow)
+	if len(keyURL) == 0 {
+		return errors.WithStack(herodot.ErrBadRequest.WithReason("The settings flow does not contain a TOTP key to set up. Please restart the flow."))
+	}
+
+	step, ok, err := Validate(p.TOTPCode, keyURL, 0)
+	if err != nil {
+		return err
+	} else if !ok {
+		return schema.NewTOTPVerifierWrongError("#/totp_code")
+	}
+
+	co, err := json.Marshal(&CredentialsConfig{TOTPURL: keyURL, LastTimeStep: step})
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode totp options to JSON: %s", err))
+	}
+
+	i.SetCredentials(s.ID(), identity.Credentials{
+		Type:        s.ID(),
+		Identifiers: []string{i.ID.String()},
+		Config:      co,
+	})
+	return nil
+}
+
+// pendingKeyURL returns the key URL stored in the flow by PopulateSettingsMethod. The key is
+// read from the stored flow and never from the payload.
+func pendingKeyURL(f *settings.Flow) string {
+	method, ok := f.Methods[identity.CredentialsTypeTOTP.String()]
+	if !ok || method.Config == nil {
+		return ""
+	}
+
+	var hf *form.HTMLForm
+	switch c := method.Config.FlowMethodConfigurator.(type) {
+	case *form.HTMLForm:
+		hf = c
+	case *FlowMethod:
+		hf = c.HTMLForm
+	default:
+		return ""
+	}
+
+	for _, field := range hf.Fields {
+		if field.Name == "totp_url" {
+			v, _ := field.Value.(string)
+			return v
+		}
+	}
+
+	return ""
+}
+
+func (s *Strategy) PopulateSettingsMethod(r *http.Request, id *identity.Identity, f *settings.Flow) error {
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), id.ID)
+	if err != nil {
+		return err
+	}
+
+	hf := &form.HTMLForm{Action: urlx.CopyWithQuery(urlx.AppendPaths(s.c.SelfPublicURL(), RouteSettings),
+		url.Values{"flow": {f.ID.String()}}).String(), Method: "POST"}
+
+	if has, err := s.HasSecondFactor(i); err != nil {
+		return err
+	} else if has {
+		hf.Fields = form.Fields{{Name: "totp_unlink", Type: "submit", Value: "true"}}
+	} else {
+		key, err := s.NewKey(i)
+		if err != nil {
+			return err
+		}
+
+		hf.Fields = form.Fields{
+			{Name: "totp_url", Type: "hidden", Value: key.URL()},
+			{Name: "totp_secret_key", Type: "text", Value: key.Secret(), Disabled: true},
+			{Name: "totp_code", Type: "text", Required: true},
+		}
+	}
+	hf.SetCSRF(s.d.GenerateCSRFToken(r))
+
+	f.Methods[s.SettingsStrategyID()] = &settings.FlowMethod{
+		Method: s.SettingsStrategyID(),
+		Config: &settings.FlowMethodConfig{FlowMethodConfigurator: &FlowMethod{HTMLForm: hf}},
+	}
+	return nil
+}
+
+func (s *Strategy) handleSettingsError(w http.ResponseWriter, r *http.Request, ctxUpdate *settings.UpdateContext, p *CompleteSelfServiceSettingsFlowWithTOTPMethod, err error) {
+	// Do not pause flow if the flow type is an API flow as we can't save cookies in those flows.
+	if e := new(settings.FlowNeedsReAuth); errors.As(err, &e) && ctxUpdate.Flow != nil && ctxUpdate.Flow.Type == flow.TypeBrowser {
+		if err := s.d.ContinuityManager().Pause(r.Context(), w, r,
+			settings.ContinuityKey(s.SettingsStrategyID()), settings.ContinuityOptions(p, ctxUpdate.Session.Identity)...); err != nil {
+			s.d.SettingsFlowErrorHandler().WriteFlowError(w, r, s.SettingsStrategyID(), ctxUpdate.Flow, ctxUpdate.Session.Identity, err)
+			return
+		}
+	}
+
+	var id *identity.Identity
+	if ctxUpdate.Flow != nil {
+		// The key URL must survive the error, otherwise the key scanned by the user becomes useless.
+		ctxUpdate.Flow.Methods[s.SettingsStrategyID()].Config.Reset("totp_url", "totp_secret_key", "totp_unlink")
+		ctxUpdate.Flow.Methods[s.SettingsStrategyID()].Config.SetCSRF(s.d.GenerateCSRFToken(r))
+		id = ctxUpdate.Session.Identity
+	}
+
+	s.d.SettingsFlowErrorHandler().WriteFlowError(w, r, s.SettingsStrategyID(), ctxUpdate.Flow, id, err)
+}
@@ -0,0 +1,111 @@
+package totp_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	stdtotp "github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/flow/settings"
+	"github.com/zzpu/ums/selfservice/strategy/totp"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+func TestSettings(t *testing.T) {
+	conf, reg := internal.NewFastRegistryWithMocks(t)
+	viper.Set(configuration.ViperKeySelfServiceBrowserDefaultReturnTo, "https://www.ory.sh/")
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/login.schema.json")
+	testhelpers.StrategyEnable(identity.CredentialsTypeTOTP.String(), true)
+	testhelpers.StrategyEnable(settings.StrategyProfile, true)
+
+	_ = testhelpers.NewSettingsUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewErrorTestServer(t, reg)
+	_ = testhelpers.NewLoginUIWith401Response(t)
+	viper.Set(configuration.ViperKeySelfServiceSettingsPrivilegedAuthenticationAfter, "5m")
+
+	publicTS, _ := testhelpers.NewKratosServer(t, reg)
+
+	newIdentity := func() *identity.Identity {
+		return &identity.Identity{
+			ID:       x.NewUUID(),
+			Traits:   identity.Traits(`{}`),
+			SchemaID: configuration.DefaultIdentityTraitsSchemaID,
+		}
+	}
+
+	submit := func(t *testing.T, isAPI bool, hc *http.Client, values func(url.Values), expectedStatusCode int) string {
+		return testhelpers.SubmitSettingsForm(t, isAPI, hc, publicTS, values,
+			identity.CredentialsTypeTOTP.String(), expectedStatusCode,
+			testhelpers.ExpectURL(isAPI, publicTS.URL+totp.RouteSettings, conf.SelfServiceFlowSettingsUI().String()))
+	}
+
+	hasTOTP := func(t *testing.T, id *identity.Identity) bool {
+		i, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), id.ID)
+		require.NoError(t, err)
+		_, ok := i.GetCredentials(identity.CredentialsTypeTOTP)
+		return ok
+	}
+
+	for _, tc := range []struct {
+		d     string
+		isAPI bool
+	}{
+		{d: "type=api", isAPI: true},
+		{d: "type=browser", isAPI: false},
+	} {
+		t.Run(tc.d, func(t *testing.T) {
+			id := newIdentity()
+			var hc *http.Client
+			if tc.isAPI {
+				hc = testhelpers.NewHTTPClientWithIdentitySessionToken(t, reg, id)
+			} else {
+				hc = testhelpers.NewHTTPClientWithIdentitySessionCookie(t, reg, id)
+			}
+
+			t.Run("description=should fail if the code is invalid", func(t *testing.T) {
+				actual := submit(t, tc.isAPI, hc, func(v url.Values) {
+					v.Set("totp_code", "000000")
+				}, testhelpers.ExpectStatusCode(tc.isAPI, http.StatusBadRequest, http.StatusOK))
+
+				assert.EqualValues(t, text.ErrorValidationTOTPVerifierWrong, gjson.Get(actual, "methods.totp.config.fields.#(name==totp_code).messages.0.id").Int(), "%s", actual)
+				assert.NotEmpty(t, gjson.Get(actual, "methods.totp.config.fields.#(name==totp_url).value").String(), "%s", actual)
+				assert.False(t, hasTOTP(t, id))
+			})
+
+			t.Run("description=should set up the authenticator app", func(t *testing.T) {
+				actual := submit(t, tc.isAPI, hc, func(v url.Values) {
+					code, err := stdtotp.GenerateCode(v.Get("totp_secret_key"), time.Now())
+					require.NoError(t, err)
+					v.Set("totp_code", code)
+				}, http.StatusOK)
+
+				assert.EqualValues(t, settings.StateSuccess, gjson.Get(actual, testhelpers.ExpectURL(tc.isAPI, "flow.state", "state")).String(), "%s", actual)
+				assert.True(t, gjson.Get(actual, testhelpers.ExpectURL(tc.isAPI, "flow.methods.totp.config.fields.#(name==totp_unlink)", "methods.totp.config.fields.#(name==totp_unlink)")).Exists(), "%s", actual)
+				assert.True(t, hasTOTP(t, id))
+			})
+
+			t.Run("description=should unlink the authenticator app", func(t *testing.T) {
+				actual := submit(t, tc.isAPI, hc, func(v url.Values) {
+					v.Set("totp_unlink", "true")
+				}, http.StatusOK)
+
+				assert.EqualValues(t, settings.StateSuccess, gjson.Get(actual, testhelpers.ExpectURL(tc.isAPI, "flow.state", "state")).String(), "%s", actual)
+				assert.True(t, gjson.Get(actual, testhelpers.ExpectURL(tc.isAPI, "flow.methods.totp.config.fields.#(name==totp_code)", "methods.totp.config.fields.#(name==totp_code)")).Exists(), "%s", actual)
+				assert.False(t, hasTOTP(t, id))
+			})
+		})
+	}
+}
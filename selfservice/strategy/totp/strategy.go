@@ -0,0 +1,120 @@
+package totp
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/jsonx"
+
+	"github.com/zzpu/ums/continuity"
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/errorx"
+	"github.com/zzpu/ums/selfservice/flow/login"
+	"github.com/zzpu/ums/selfservice/flow/settings"
+	"github.com/zzpu/ums/selfservice/strategy/password"
+	"github.com/zzpu/ums/session"
+	"github.com/zzpu/ums/x"
+)
+
+var _ login.Strategy = new(Strategy)
+var _ login.SecondFactorStrategy = new(Strategy)
+var _ settings.Strategy = new(Strategy)
+
+type strategyDependencies interface {
+	x.LoggingProvider
+	x.WriterProvider
+	x.CSRFTokenGeneratorProvider
+	x.CSRFProvider
+
+	continuity.ManagementProvider
+
+	errorx.ManagementProvider
+
+	login.HookExecutorProvider
+	login.FlowPersistenceProvider
+	login.ErrorHandlerProvider
+
+	settings.FlowPersistenceProvider
+	settings.HookExecutorProvider
+	settings.ErrorHandlerProvider
+
+	identity.PrivilegedPoolProvider
+
+	session.ManagementProvider
+
+	password.LoginFailurePersistenceProvider
+}
+
+type Strategy struct {
+	c  configuration.Provider
+	d  strategyDependencies
+	hd *decoderx.HTTP
+}
+
+// Configuration is the configuration of the TOTP method.
+type Configuration struct {
+	// Issuer is shown in the authenticator app next to the account name. Defaults
+	// to the hostname of the public URL.
+	Issuer string `json:"issuer"`
+
+	// MaxAttempts is the number of wrong codes within LockoutDuration after which the second factor of the
+	// identity is locked. Zero disables the lockout.
+	MaxAttempts int `json:"max_attempts"`
+
+	// LockoutDuration is the time window in which wrong codes are counted.
+	LockoutDuration string `json:"lockout_duration"`
+}
+
+func NewStrategy(d strategyDependencies, c configuration.Provider) *Strategy {
+	return &Strategy{
+		c:  c,
+		d:  d,
+		hd: decoderx.NewHTTP(),
+	}
+}
+
+func (s *Strategy) ID() identity.CredentialsType {
+	return identity.CredentialsTypeTOTP
+}
+
+func (s *Strategy) Config() (*Configuration, error) {
+	c := Configuration{MaxAttempts: 5, LockoutDuration: "15m"}
+
+	config := s.c.SelfServiceStrategy(string(s.ID())).Config
+	if err := jsonx.
+		NewStrictDecoder(bytes.NewBuffer(config)).
+		Decode(&c); err != nil {
+		s.d.Logger().WithError(err).WithField("config", config)
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode TOTP configuration: %s", err))
+	}
+
+	if len(c.Issuer) == 0 {
+		c.Issuer = s.c.SelfPublicURL().Hostname()
+	}
+
+	return &c, nil
+}
+
+func (c *Configuration) lockoutDuration() time.Duration {
+	d, err := time.ParseDuration(c.LockoutDuration)
+	if err != nil {
+		return 15 * time.Minute
+	}
+	return d
+}
+
+func (s *Strategy) HasSecondFactor(i *identity.Identity) (bool, error) {
+	var o CredentialsConfig
+	if _, err := i.ParseCredentials(s.ID(), &o); errors.Is(err, herodot.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return len(o.TOTPURL) > 0, nil
+}
@@ -0,0 +1,29 @@
+package totp
+
+import "github.com/zzpu/ums/selfservice/form"
+
+type (
+	// CredentialsConfig is the struct that is being used as part of the identity credentials.
+	CredentialsConfig struct {
+		// TOTPURL is the key URL (otpauth://totp/...) containing the shared secret.
+		TOTPURL string `json:"totp_url"`
+
+		// LastTimeStep is the time step of the last accepted code. Codes of this or an earlier time step are
+		// rejected so that a code can not be used twice.
+		LastTimeStep int64 `json:"last_time_step,omitempty"`
+	}
+
+	// CompleteSelfServiceLoginFlowWithTOTPMethod is used to decode the login form payload.
+	CompleteSelfServiceLoginFlowWithTOTPMethod struct {
+		// The code generated by the authenticator app.
+		TOTPCode string `form:"totp_code" json:"totp_code,omitempty"`
+
+		// Sending the anti-csrf token is only required for browser login flows.
+		CSRFToken string `form:"csrf_token" json:"csrf_token"`
+	}
+)
+
+// FlowMethod contains the configuration for this selfservice strategy.
+type FlowMethod struct {
+	*form.HTMLForm
+}
@@ -0,0 +1,438 @@
+package webauthn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/duo-labs/webauthn/protocol"
+	"github.com/julienschmidt/httprouter"
+	"github.com/markbates/pkger"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/sqlcon"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/schema"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/login"
+	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteLogin = "/self-service/login/methods/webauthn"
+)
+
+func (s *Strategy) RegisterLoginRoutes(r *x.RouterPublic) {
+	s.d.CSRFHandler().ExemptPath(RouteLogin)
+	r.POST(RouteLogin, s.handleLogin)
+}
+
+func (s *Strategy) handleLoginError(w http.ResponseWriter, r *http.Request, f *login.Flow, err error) {
+	if f != nil {
+		method, ok := f.Methods[s.ID()]
+		if !ok {
+			// The method is only available in passwordless mode or once the first factor was completed,
+			// so there is no form to attach the error to.
+			f = nil
+		} else {
+			method.Config.Reset("identifier", "webauthn_login_options")
+			if f.Type == flow.TypeBrowser {
+				method.Config.SetCSRF(s.d.GenerateCSRFToken(r))
+			}
+
+			f.Methods[s.ID()] = method
+		}
+	}
+
+	s.d.LoginFlowErrorHandler().WriteFlowError(w, r, s.ID(), f, err)
+}
+
+// nolint:deadcode,unused
+// swagger:parameters completeSelfServiceLoginFlowWithWebAuthnMethod
+type completeSelfServiceLoginFlowWithWebAuthnMethodParameters struct {
+	// The Flow ID
+	//
+	// required: true
+	// in: query
+	Flow string `json:"flow"`
+
+	// in: body
+	CompleteSelfServiceLoginFlowWithWebAuthnMethod
+}
+
+// swagger:route POST /self-service/login/methods/webauthn public completeSelfServiceLoginFlowWithWebAuthnMethod
+//
+// Complete Login Flow with the WebAuthn Method
+//
+// Use this endpoint to complete a login flow with a security key. When used as a second factor, the
+// `webauthn_login_options` are available once the identity completed the first factor of the same flow. In
+// passwordless mode, send the `identifier` first to receive the `webauthn_login_options`.
+//
+// Pass the options to `navigator.credentials.get()` and send the JSON encoded result as `webauthn_login`.
+// This endpoint behaves differently for API and browser flows.
+//
+// API flows expect `application/json` to be sent in the body and responds with
+//   - HTTP 200 and a application/json body with the session token on success;
+//   - HTTP 200 and the login flow containing the `webauthn_login_options` after sending the `identifier`;
+//   - HTTP 302 redirect to a fresh login flow if the original flow expired with the appropriate error messages set;
+//   - HTTP 400 on form validation errors.
+//
+// Browser flows expect `application/x-www-form-urlencoded` to be sent in the body and responds with
+//   - a HTTP 302 redirect to the post/after login URL or the `return_to` value if it was set and if the login succeeded;
+//   - a HTTP 302 redirect to the login UI URL with the flow ID containing the `webauthn_login_options` after sending the `identifier`;
+//   - a HTTP 302 redirect to the login UI URL with the flow ID containing the validation errors otherwise.
+//
+//     Schemes: http, https
+//
+//     Consumes:
+//     - application/json
+//     - application/x-www-form-urlencoded
+//
+//     Produces:
+//     - application/json
+//
+//     Responses:
+//       200: loginViaApiResponse
+//       302: emptyResponse
+//       400: loginFlow
+//       500: genericError
+func (s *Strategy) handleLogin(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rid := x.ParseUUID(r.URL.Query().Get("flow"))
+	if x.IsZeroUUID(rid) {
+		s.handleLoginError(w, r, nil, errors.WithStack(herodot.ErrBadRequest.WithReasonf("The flow query parameter is missing or invalid.")))
+		return
+	}
+
+	ar, err := s.d.LoginFlowPersister().GetLoginFlow(r.Context(), rid)
+	if err != nil {
+		s.handleLoginError(w, r, nil, err)
+		return
+	}
+
+	var p CompleteSelfServiceLoginFlowWithWebAuthnMethod
+	if err := s.hd.Decode(r, &p, decoderx.MustHTTPRawJSONSchemaCompiler(x.MustPkgerRead(
+		pkger.Open("/selfservice/strategy/webauthn/.schema/login.schema.json")))); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if err := flow.VerifyRequest(r, ar.Type, s.d.GenerateCSRFToken, p.CSRFToken); err != nil {
+		s.handleLoginError(w, r, ar, x.ErrInvalidCSRFToken)
+		return
+	}
+
+	if _, err := s.d.SessionManager().FetchFromRequest(r.Context(), r); err == nil && !ar.Forced && !ar.IsStepUp() {
+		if ar.Type == flow.TypeBrowser {
+			http.Redirect(w, r, s.c.SelfServiceBrowserDefaultReturnTo().String(), http.StatusFound)
+			return
+		}
+
+		s.d.Writer().WriteError(w, r, errors.WithStack(login.ErrAlreadyLoggedIn))
+		return
+	}
+
+	if err := ar.Valid(); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if !ar.RequiresSecondFactor() && !s.IsPasswordless() {
+		s.handleLoginError(w, r, ar, errors.WithStack(login.ErrFirstFactorRequired))
+		return
+	}
+
+	if len(p.Login) == 0 {
+		if ar.RequiresSecondFactor() {
+			s.handleLoginError(w, r, ar, schema.NewRequiredError("#/webauthn_login", "webauthn_login"))
+			return
+		}
+
+		s.beginPasswordlessLogin(w, r, ar, p.Identifier)
+		return
+	}
+
+	i, err := s.verifyLogin(r, ar, p.Login)
+	if err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if err := s.d.LoginHookExecutor().PostLoginHook(w, r, s.ID(), ar, i); err != nil {
+		s.d.SelfServiceErrorManager().Forward(r.Context(), w, r, err)
+		return
+	}
+}
+
+// beginPasswordlessLogin looks up the security keys of the identity and adds the login options to the flow.
+func (s *Strategy) beginPasswordlessLogin(w http.ResponseWriter, r *http.Request, ar *login.Flow, identifier string) {
+	if len(identifier) == 0 {
+		s.handleLoginError(w, r, ar, schema.NewRequiredError("#/identifier", "identifier"))
+		return
+	}
+
+	// The security keys of the identity are not looked up so that the response does not reveal which accounts exist.
+	if err := s.populateLoginOptions(r, ar, nil, identifier); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if err := s.d.LoginFlowPersister().UpdateLoginFlow(r.Context(), ar); err != nil {
+		s.handleLoginError(w, r, ar, err)
+		return
+	}
+
+	if ar.Type == flow.TypeAPI {
+		updatedFlow, err := s.d.LoginFlowPersister().GetLoginFlow(r.Context(), ar.ID)
+		if err != nil {
+			s.handleLoginError(w, r, ar, err)
+			return
+		}
+
+		s.d.Writer().Write(w, r, updatedFlow)
+		return
+	}
+
+	http.Redirect(w, r, ar.AppendTo(s.c.SelfServiceFlowLoginUI()).String(), http.StatusFound)
+}
+
+// verifyLogin validates the assertion against the login options stored in the flow and returns the
+// identity owning the security key.
+func (s *Strategy) verifyLogin(r *http.Request, ar *login.Flow, response string) (*identity.Identity, error) {
+	options := loginOptions(ar)
+	if options == nil {
+		return nil, errors.WithStack(schema.NewWebAuthnVerifierWrongError("#/webauthn_login"))
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(strings.NewReader(response))
+	if err != nil {
+		s.d.Logger().WithRequest(r).WithError(err).Debug("Unable to parse WebAuthn login response.")
+		return nil, errors.WithStack(schema.NewWebAuthnVerifierWrongError("#/webauthn_login"))
+	}
+
+	i, _, err := s.d.PrivilegedIdentityPool().FindByCredentialsIdentifier(r.Context(), s.ID(), CredentialIdentifier(parsed.RawID))
+	if err != nil {
+		return nil, errors.WithStack(schema.NewWebAuthnVerifierWrongError("#/webauthn_login"))
+	}
+
+	if ar.RequiresSecondFactor() && ar.IdentityID.UUID != i.ID {
+		return nil, errors.WithStack(schema.NewWebAuthnVerifierWrongError("#/webauthn_login"))
+	} else if !ar.RequiresSecondFactor() {
+		// In passwordless mode, the login options do not list the security keys of the identity, so the
+		// security key must belong to the identity of the identifier entered before.
+		owner, _, err := s.d.PrivilegedIdentityPool().FindByCredentialsIdentifier(r.Context(), identity.CredentialsTypePassword, loginIdentifier(ar))
+		if err != nil || owner.ID != i.ID {
+			return nil, errors.WithStack(schema.NewWebAuthnVerifierWrongError("#/webauthn_login"))
+		}
+	}
+
+	i, err = s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), i.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var o CredentialsConfig
+	if _, err := i.ParseCredentials(s.ID(), &o); err != nil {
+		return nil, err
+	}
+
+	web, err := s.newWebAuthn()
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := web.ValidateLogin(newUser(i, &o), loginSession(options, i), parsed)
+	if err != nil {
+		s.d.Logger().WithRequest(r).WithError(err).Debug("Unable to validate WebAuthn login response.")
+		return nil, errors.WithStack(schema.NewWebAuthnVerifierWrongError("#/webauthn_login"))
+	}
+
+	if credential.Authenticator.CloneWarning {
+		s.d.Audit().
+			WithRequest(r).
+			WithField("identity_id", i.ID).
+			Info("The sign counter of a security key went backwards which indicates that the security key was cloned.")
+		return nil, errors.WithStack(schema.NewWebAuthnVerifierWrongError("#/webauthn_login"))
+	}
+
+	if err := s.consumeLoginOptions(r.Context(), ar); err != nil {
+		return nil, err
+	}
+
+	for k := range o.Credentials {
+		if CredentialIdentifier(o.Credentials[k].ID) == CredentialIdentifier(credential.ID) {
+			o.Credentials[k].Authenticator.SignCount = credential.Authenticator.SignCount
+		}
+	}
+
+	co, err := json.Marshal(o)
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode WebAuthn credentials to JSON: %s", err))
+	}
+
+	// The update fails if the security keys were changed since they were loaded, for example because a concurrent
+	// request stored a higher sign count.
+	credentials, _ := i.GetCredentials(s.ID())
+	if err := s.d.PrivilegedIdentityPool().UpdateIdentityCredentialsConfig(r.Context(), credentials, co); errors.Is(err, sqlcon.ErrNoRows) {
+		return nil, errors.WithStack(schema.NewWebAuthnVerifierWrongError("#/webauthn_login"))
+	} else if err != nil {
+		return nil, err
+	}
+	i.SetCredentials(s.ID(), *credentials)
+
+	return i, nil
+}
+
+// consumeLoginOptions removes the login options from the flow so that the challenge can only be used once, even
+// by concurrent requests.
+func (s *Strategy) consumeLoginOptions(ctx context.Context, ar *login.Flow) error {
+	method := ar.Methods[s.ID()]
+
+	raw, err := json.Marshal(method.Config)
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode WebAuthn login method to JSON: %s", err))
+	}
+
+	var config login.FlowMethodConfig
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode WebAuthn login method from JSON: %s", err))
+	}
+	config.SetValue("webauthn_login_options", "")
+
+	if err := s.d.LoginFlowPersister().UpdateLoginFlowMethodConfig(ctx, method, &config); errors.Is(err, sqlcon.ErrNoRows) {
+		return errors.WithStack(schema.NewWebAuthnVerifierWrongError("#/webauthn_login"))
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// loginIdentifier returns the identifier stored in the flow by beginPasswordlessLogin.
+func loginIdentifier(ar *login.Flow) string {
+	method, ok := ar.Methods[identity.CredentialsTypeWebAuthn]
+	if !ok || method.Config == nil {
+		return ""
+	}
+
+	return fieldValue(method.Config.FlowMethodConfigurator, "identifier")
+}
+
+// loginOptions returns the login options stored in the flow by populateLoginOptions. The options are
+// read from the stored flow and never from the payload.
+func loginOptions(ar *login.Flow) *protocol.CredentialAssertion {
+	method, ok := ar.Methods[identity.CredentialsTypeWebAuthn]
+	if !ok || method.Config == nil {
+		return nil
+	}
+
+	raw := fieldValue(method.Config.FlowMethodConfigurator, "webauthn_login_options")
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var options protocol.CredentialAssertion
+	if err := json.Unmarshal([]byte(raw), &options); err != nil {
+		return nil
+	}
+
+	return &options
+}
+
+// populateLoginOptions adds a new login challenge for the security keys of the user to the flow. Without a user,
+// the challenge does not list any security keys and the browser offers the discoverable security keys instead.
+func (s *Strategy) populateLoginOptions(r *http.Request, sr *login.Flow, u *user, identifier string) error {
+	web, err := s.newWebAuthn()
+	if err != nil {
+		return err
+	}
+
+	var options *protocol.CredentialAssertion
+	if u != nil {
+		options, _, err = web.BeginLogin(u)
+		if err != nil {
+			return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to initiate WebAuthn login: %s", err))
+		}
+	} else {
+		challenge, err := protocol.CreateChallenge()
+		if err != nil {
+			return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to initiate WebAuthn login: %s", err))
+		}
+
+		options = &protocol.CredentialAssertion{Response: protocol.PublicKeyCredentialRequestOptions{
+			Challenge:        challenge,
+			Timeout:          web.Config.Timeout,
+			RelyingPartyID:   web.Config.RPID,
+			UserVerification: web.Config.AuthenticatorSelection.UserVerification,
+		}}
+	}
+
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode WebAuthn login options to JSON: %s", err))
+	}
+
+	f := &form.HTMLForm{
+		Action: sr.AppendTo(urlx.AppendPaths(s.c.SelfPublicURL(), RouteLogin)).String(),
+		Method: "POST",
+	}
+	if len(identifier) > 0 {
+		f.Fields = append(f.Fields, form.Field{Name: "identifier", Type: "hidden", Value: identifier})
+	}
+	f.Fields = append(f.Fields,
+		form.Field{Name: "webauthn_login_options", Type: "hidden", Value: string(encoded)},
+		form.Field{Name: "webauthn_login", Type: "hidden", Required: true},
+	)
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+
+	sr.Methods[s.ID()] = &login.FlowMethod{
+		Method: s.ID(),
+		Config: &login.FlowMethodConfig{FlowMethodConfigurator: &FlowMethod{HTMLForm: f}}}
+	return nil
+}
+
+// PopulateLoginMethod adds the login challenge once the first factor of the flow was completed. In
+// passwordless mode, the identifier is requested first instead.
+func (s *Strategy) PopulateLoginMethod(r *http.Request, sr *login.Flow) error {
+	if sr.RequiresSecondFactor() {
+		i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), sr.IdentityID.UUID)
+		if err != nil {
+			return err
+		}
+
+		if has, err := s.HasSecondFactor(i); err != nil || !has {
+			return err
+		}
+
+		var o CredentialsConfig
+		if _, err := i.ParseCredentials(s.ID(), &o); err != nil {
+			return err
+		}
+
+		return s.populateLoginOptions(r, sr, newUser(i, &o), "")
+	}
+
+	if !s.IsPasswordless() {
+		return nil
+	}
+
+	f := &form.HTMLForm{
+		Action: sr.AppendTo(urlx.AppendPaths(s.c.SelfPublicURL(), RouteLogin)).String(),
+		Method: "POST",
+		Fields: form.Fields{{
+			Name:     "identifier",
+			Type:     "text",
+			Required: true,
+		}}}
+	f.SetCSRF(s.d.GenerateCSRFToken(r))
+
+	sr.Methods[s.ID()] = &login.FlowMethod{
+		Method: s.ID(),
+		Config: &login.FlowMethodConfig{FlowMethodConfigurator: &FlowMethod{HTMLForm: f}}}
+	return nil
+}
@@ -0,0 +1,280 @@
+package webauthn_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+	"github.com/ory/x/sqlxx"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/httpclient/models"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/strategy/webauthn"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+func TestCompleteLogin(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+	testhelpers.StrategyEnable(identity.CredentialsTypePassword.String(), true)
+	testhelpers.StrategyEnable(identity.CredentialsTypeWebAuthn.String(), true)
+
+	publicTS, _ := testhelpers.NewKratosServer(t, reg)
+	_ = testhelpers.NewErrorTestServer(t, reg)
+	uiTS := testhelpers.NewLoginUIFlowEchoServer(t, reg)
+	redirTS := testhelpers.NewRedirSessionEchoTS(t, reg)
+
+	viper.Set(configuration.ViperKeySelfServiceBrowserDefaultReturnTo, redirTS.URL+"/return-ts")
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/login.schema.json")
+	viper.Set(configuration.ViperKeySecretsDefault, []string{"not-a-secure-session-key"})
+
+	publicURL, err := url.Parse(publicTS.URL)
+	require.NoError(t, err)
+
+	setPasswordless := func(t *testing.T, enabled bool) {
+		viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".webauthn.config", map[string]interface{}{"passwordless": enabled})
+		t.Cleanup(func() {
+			viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".webauthn.config", map[string]interface{}{})
+		})
+	}
+
+	createIdentity := func(t *testing.T, identifier, pw string, withKey bool) *authenticator {
+		p, _ := reg.Hasher().Generate([]byte(pw))
+		i := &identity.Identity{
+			ID:     x.NewUUID(),
+			Traits: identity.Traits(`{}`),
+			Credentials: map[identity.CredentialsType]identity.Credentials{
+				identity.CredentialsTypePassword: {
+					Type:        identity.CredentialsTypePassword,
+					Identifiers: []string{identifier},
+					Config:      sqlxx.JSONRawMessage(`{"hashed_password":"` + string(p) + `"}`),
+				},
+			},
+		}
+
+		key := newAuthenticator(t, publicURL.Hostname(), publicTS.URL)
+		if withKey {
+			config, err := json.Marshal(webauthn.CredentialsConfig{Credentials: []webauthn.Credential{key.credential(t)}})
+			require.NoError(t, err)
+			i.Credentials[identity.CredentialsTypeWebAuthn] = identity.Credentials{
+				Type:        identity.CredentialsTypeWebAuthn,
+				Identifiers: []string{webauthn.CredentialIdentifier(key.id)},
+				Config:      config,
+			}
+		}
+
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+		return key
+	}
+
+	initFlow := func(t *testing.T, isAPI bool, hc *http.Client) *models.LoginFlow {
+		if isAPI {
+			return testhelpers.InitializeLoginFlowViaAPI(t, hc, publicTS, false).Payload
+		}
+		return testhelpers.InitializeLoginFlowViaBrowser(t, hc, publicTS, false).Payload
+	}
+
+	loginWithPassword := func(t *testing.T, isAPI bool, hc *http.Client, identifier, pw string) string {
+		f := initFlow(t, isAPI, hc)
+
+		c := testhelpers.GetLoginFlowMethodConfig(t, f, identity.CredentialsTypePassword.String())
+		body, res := testhelpers.LoginMakeRequest(t, isAPI, c, hc, testhelpers.EncodeFormAsJSON(t, isAPI, url.Values{
+			"csrf_token": {x.FakeCSRFToken}, "identifier": {identifier}, "password": {pw}}))
+		assert.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body)
+		return body
+	}
+
+	submit := func(t *testing.T, isAPI bool, hc *http.Client, action string, values url.Values) (string, *http.Response) {
+		values.Set("csrf_token", x.FakeCSRFToken)
+		return testhelpers.LoginMakeRequest(t, isAPI, &models.LoginFlowMethodConfig{Action: &action}, hc,
+			testhelpers.EncodeFormAsJSON(t, isAPI, values))
+	}
+
+	assertSession := func(t *testing.T, isAPI bool, body string, res *http.Response) {
+		assert.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body)
+		if isAPI {
+			assert.NotEmpty(t, gjson.Get(body, "session_token").String(), "%s", body)
+			assert.NotEmpty(t, gjson.Get(body, "session.identity.id").String(), "%s", body)
+		} else {
+			assert.Contains(t, res.Request.URL.String(), redirTS.URL, "%s", body)
+			assert.NotEmpty(t, gjson.Get(body, "identity.id").String(), "%s", body)
+		}
+	}
+
+	assertVerifierWrong := func(t *testing.T, isAPI bool, body string, res *http.Response) {
+		if isAPI {
+			assert.EqualValues(t, http.StatusBadRequest, res.StatusCode, "%s", body)
+		} else {
+			assert.Contains(t, res.Request.URL.String(), uiTS.URL, "%s", body)
+		}
+		assert.EqualValues(t, text.ErrorValidationWebAuthnVerifierWrong, gjson.Get(body, "methods.webauthn.config.fields.#(name==webauthn_login).messages.0.id").Int(), "%s", body)
+	}
+
+	for _, tc := range []struct {
+		d     string
+		isAPI bool
+	}{
+		{d: "type=api", isAPI: true},
+		{d: "type=browser", isAPI: false},
+	} {
+		t.Run(tc.d, func(t *testing.T) {
+			newClient := func() *http.Client {
+				if tc.isAPI {
+					return testhelpers.NewDebugClient(t)
+				}
+				return testhelpers.NewClientWithCookies(t)
+			}
+
+			t.Run("case=should require the security key after the password was accepted", func(t *testing.T) {
+				identifier := fmt.Sprintf("login-webauthn-%s@ory.sh", x.NewUUID())
+				key := createIdentity(t, identifier, "password", true)
+				hc := newClient()
+
+				f := initFlow(t, tc.isAPI, hc)
+				_, ok := f.Methods[identity.CredentialsTypeWebAuthn.String()]
+				assert.False(t, ok, "the second factor must not be offered before the first factor was completed")
+
+				flow := loginWithPassword(t, tc.isAPI, hc, identifier, "password")
+				assert.Empty(t, gjson.Get(flow, "session").Raw, "%s", flow)
+				assert.EqualValues(t, text.InfoSelfServiceMFASecondFactorRequired, gjson.Get(flow, "messages.0.id").Int(), "%s", flow)
+
+				action := gjson.Get(flow, "methods.webauthn.config.action").String()
+				options := gjson.Get(flow, "methods.webauthn.config.fields.#(name==webauthn_login_options).value").String()
+				require.NotEmpty(t, options, "%s", flow)
+
+				t.Run("case=should fail with an unknown security key", func(t *testing.T) {
+					other := newAuthenticator(t, publicURL.Hostname(), publicTS.URL)
+					body, res := submit(t, tc.isAPI, hc, action, url.Values{"webauthn_login": {other.login(t, options)}})
+					assertVerifierWrong(t, tc.isAPI, body, res)
+				})
+
+				t.Run("case=should issue a session with the security key", func(t *testing.T) {
+					body, res := submit(t, tc.isAPI, hc, action, url.Values{"webauthn_login": {key.login(t, options)}})
+					assertSession(t, tc.isAPI, body, res)
+				})
+			})
+
+			t.Run("case=should not allow the security key without the first factor", func(t *testing.T) {
+				hc := newClient()
+				f := initFlow(t, tc.isAPI, hc)
+
+				body, res := submit(t, tc.isAPI, hc, publicTS.URL+webauthn.RouteLogin+"?flow="+string(f.ID), url.Values{"identifier": {"foo@ory.sh"}})
+				assert.Contains(t, body, "can only be used once the first factor was completed", "%s", body)
+				if tc.isAPI {
+					assert.EqualValues(t, http.StatusBadRequest, res.StatusCode, "%s", body)
+				}
+			})
+
+			t.Run("case=should sign in without a password in passwordless mode", func(t *testing.T) {
+				setPasswordless(t, true)
+				identifier := fmt.Sprintf("login-passwordless-%s@ory.sh", x.NewUUID())
+				key := createIdentity(t, identifier, "password", true)
+				hc := newClient()
+
+				f := initFlow(t, tc.isAPI, hc)
+				c := testhelpers.GetLoginFlowMethodConfig(t, f, identity.CredentialsTypeWebAuthn.String())
+
+				flow, res := submit(t, tc.isAPI, hc, *c.Action, url.Values{"identifier": {identifier}})
+				assert.EqualValues(t, http.StatusOK, res.StatusCode, "%s", flow)
+				options := gjson.Get(flow, "methods.webauthn.config.fields.#(name==webauthn_login_options).value").String()
+				require.NotEmpty(t, options, "%s", flow)
+
+				assert.False(t, gjson.Get(options, "publicKey.allowCredentials").Exists(), "%s", options)
+
+				t.Run("case=should fail with the security key of another identity", func(t *testing.T) {
+					other := createIdentity(t, fmt.Sprintf("login-passwordless-other-%s@ory.sh", x.NewUUID()), "password", true)
+					body, res := submit(t, tc.isAPI, hc, *c.Action, url.Values{"webauthn_login": {other.login(t, options)}})
+					assertVerifierWrong(t, tc.isAPI, body, res)
+				})
+
+				assertion := key.login(t, options)
+				body, res := submit(t, tc.isAPI, hc, *c.Action, url.Values{"webauthn_login": {assertion}})
+				assertSession(t, tc.isAPI, body, res)
+
+				t.Run("case=should not accept the same assertion twice", func(t *testing.T) {
+					if !tc.isAPI {
+						t.Skip("Browsers with a session are redirected before the challenge is checked.")
+					}
+
+					body, res := submit(t, tc.isAPI, hc, *c.Action, url.Values{"webauthn_login": {assertion}})
+					assertVerifierWrong(t, tc.isAPI, body, res)
+				})
+
+				t.Run("case=should have updated the sign counter", func(t *testing.T) {
+					i, _, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeWebAuthn, webauthn.CredentialIdentifier(key.id))
+					require.NoError(t, err)
+					i, err = reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), i.ID)
+					require.NoError(t, err)
+
+					var o webauthn.CredentialsConfig
+					_, err = i.ParseCredentials(identity.CredentialsTypeWebAuthn, &o)
+					require.NoError(t, err)
+					require.Len(t, o.Credentials, 1)
+					assert.EqualValues(t, key.counter, o.Credentials[0].Authenticator.SignCount)
+				})
+			})
+
+			beginPasswordless := func(t *testing.T, hc *http.Client, identifier string) (action, options string) {
+				f := initFlow(t, tc.isAPI, hc)
+				c := testhelpers.GetLoginFlowMethodConfig(t, f, identity.CredentialsTypeWebAuthn.String())
+
+				flow, res := submit(t, tc.isAPI, hc, *c.Action, url.Values{"identifier": {identifier}})
+				assert.EqualValues(t, http.StatusOK, res.StatusCode, "%s", flow)
+				options = gjson.Get(flow, "methods.webauthn.config.fields.#(name==webauthn_login_options).value").String()
+				require.NotEmpty(t, options, "%s", flow)
+				return *c.Action, options
+			}
+
+			t.Run("case=should fail passwordless login if no security key was set up", func(t *testing.T) {
+				setPasswordless(t, true)
+				identifier := fmt.Sprintf("login-passwordless-nokey-%s@ory.sh", x.NewUUID())
+				createIdentity(t, identifier, "password", false)
+				hc := newClient()
+
+				action, options := beginPasswordless(t, hc, identifier)
+				other := newAuthenticator(t, publicURL.Hostname(), publicTS.URL)
+				body, res := submit(t, tc.isAPI, hc, action, url.Values{"webauthn_login": {other.login(t, options)}})
+				assertVerifierWrong(t, tc.isAPI, body, res)
+			})
+
+			t.Run("case=should not reveal whether an account or a security key exists in passwordless mode", func(t *testing.T) {
+				setPasswordless(t, true)
+				withKey := fmt.Sprintf("login-passwordless-exists-%s@ory.sh", x.NewUUID())
+				createIdentity(t, withKey, "password", true)
+				withoutKey := fmt.Sprintf("login-passwordless-exists-nokey-%s@ory.sh", x.NewUUID())
+				createIdentity(t, withoutKey, "password", false)
+				unknown := fmt.Sprintf("login-passwordless-unknown-%s@ory.sh", x.NewUUID())
+
+				keys := func(options string) (keys []string) {
+					gjson.Get(options, "publicKey").ForEach(func(k, _ gjson.Result) bool {
+						keys = append(keys, k.String())
+						return true
+					})
+					return keys
+				}
+
+				_, expected := beginPasswordless(t, newClient(), withKey)
+				for _, identifier := range []string{withKey, withoutKey, unknown} {
+					_, first := beginPasswordless(t, newClient(), identifier)
+					_, second := beginPasswordless(t, newClient(), identifier)
+
+					assert.NotEqual(t, gjson.Get(first, "publicKey.challenge").String(), gjson.Get(second, "publicKey.challenge").String())
+					assert.False(t, gjson.Get(first, "publicKey.allowCredentials").Exists(), "%s", first)
+					assert.False(t, gjson.Get(second, "publicKey.allowCredentials").Exists(), "%s", second)
+					assert.Equal(t, keys(expected), keys(first))
+				}
+			})
+		})
+	}
+}
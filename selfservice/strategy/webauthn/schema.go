@@ -0,0 +1,7 @@
+package webauthn
+
+import (
+	"github.com/markbates/pkger"
+)
+
+var _ = pkger.Dir("/selfservice/strategy/webauthn/.schema")
@@ -0,0 +1,357 @@
+package webauthn
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/duo-labs/webauthn/protocol"
+	"github.com/duo-labs/webauthn/webauthn"
+	"github.com/gofrs/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/markbates/pkger"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/urlx"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/schema"
+	"github.com/zzpu/ums/selfservice/flow"
+	"github.com/zzpu/ums/selfservice/flow/settings"
+	"github.com/zzpu/ums/selfservice/form"
+	"github.com/zzpu/ums/x"
+)
+
+const (
+	RouteSettings = "/self-service/settings/methods/webauthn"
+)
+
+func (s *Strategy) RegisterSettingsRoutes(router *x.RouterPublic) {
+	s.d.CSRFHandler().ExemptPath(RouteSettings)
+	router.POST(RouteSettings, s.submitSettingsFlow)
+	router.GET(RouteSettings, s.submitSettingsFlow)
+}
+
+func (s *Strategy) SettingsStrategyID() string {
+	return s.ID().String()
+}
+
+// nolint:deadcode,unused
+// swagger:parameters completeSelfServiceSettingsFlowWithWebAuthnMethod
+type completeSelfServiceSettingsFlowWithWebAuthnMethod struct {
+	// in: body
+	Body CompleteSelfServiceSettingsFlowWithWebAuthnMethod
+
+	// Flow is flow ID.
+	//
+	// in: query
+	Flow string `json:"flow"`
+}
+
+type CompleteSelfServiceSettingsFlowWithWebAuthnMethod struct {
+	// Register is the JSON encoded result of `navigator.credentials.create()` for the
+	// options found in `webauthn_register_options`.
+	//
+	// type: string
+	Register string `json:"webauthn_register"`
+
+	// RegisterDisplayName is the name of the security key to be registered.
+	//
+	// type: string
+	RegisterDisplayName string `json:"webauthn_register_displayname"`
+
+	// Remove is the ID of the security key to be removed.
+	//
+	// type: string
+	Remove string `json:"webauthn_remove"`
+
+	// CSRFToken is the anti-CSRF token
+	//
+	// type: string
+	CSRFToken string `json:"csrf_token"`
+
+	// Flow is flow ID.
+	//
+	// swagger:ignore
+	Flow string `json:"flow"`
+}
+
+func (p *CompleteSelfServiceSettingsFlowWithWebAuthnMethod) GetFlowID() uuid.UUID {
+	return x.ParseUUID(p.Flow)
+}
+
+func (p *CompleteSelfServiceSettingsFlowWithWebAuthnMethod) SetFlowID(rid uuid.UUID) {
+	p.Flow = rid.String()
+}
+
+// swagger:route POST /self-service/settings/methods/webauthn public completeSelfServiceSettingsFlowWithWebAuthnMethod
+//
+// Complete Settings Flow with the WebAuthn Method
+//
+// Use this endpoint to register a security key by passing the `webauthn_register_options` of the settings flow
+// to `navigator.credentials.create()` and sending the JSON encoded result as `webauthn_register`, or to remove a
+// security key by sending its ID as `webauthn_remove`. This endpoint behaves differently for API and browser flows.
+//
+// API-initiated flows expect `application/json` to be sent in the body and respond with
+//   - HTTP 200 and an application/json body with the session token on success;
+//   - HTTP 302 redirect to a fresh settings flow if the original flow expired with the appropriate error messages set;
+//   - HTTP 400 on form validation errors.
+//   - HTTP 401 when the endpoint is called without a valid session token.
+//   - HTTP 403 when `selfservice.flows.settings.privileged_session_max_age` was reached.
+//     Implies that the user needs to re-authenticate.
+//
+// Browser flows expect `application/x-www-form-urlencoded` to be sent in the body and responds with
+//   - a HTTP 302 redirect to the post/after settings URL or the `return_to` value if it was set and if the flow succeeded;
+//   - a HTTP 302 redirect to the Settings UI URL with the flow ID containing the validation errors otherwise.
+//   - a HTTP 302 redirect to the login endpoint when `selfservice.flows.settings.privileged_session_max_age` was reached.
+//
+//     Consumes:
+//     - application/json
+//     - application/x-www-form-urlencoded
+//
+//     Produces:
+//     - application/json
+//
+//     Security:
+//       sessionToken:
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: settingsViaApiResponse
+//       302: emptyResponse
+//       400: settingsFlow
+//       401: genericError
+//       403: genericError
+//       500: genericError
+func (s *Strategy) submitSettingsFlow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var p CompleteSelfServiceSettingsFlowWithWebAuthnMethod
+	ctxUpdate, err := settings.PrepareUpdate(s.d, w, r, settings.ContinuityKey(s.SettingsStrategyID()), &p)
+	if errors.Is(err, settings.ErrContinuePreviousAction) {
+		s.continueSettingsFlow(w, r, ctxUpdate, &p)
+		return
+	} else if err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, &p, err)
+		return
+	}
+
+	if err := s.decodeSettingsFlow(r, &p); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, &p, err)
+		return
+	}
+
+	// This does not come from the payload!
+	p.Flow = ctxUpdate.Flow.ID.String()
+	s.continueSettingsFlow(w, r, ctxUpdate, &p)
+}
+
+func (s *Strategy) decodeSettingsFlow(r *http.Request, dest interface{}) error {
+	compiler, err := decoderx.HTTPRawJSONSchemaCompiler(x.MustPkgerRead(pkger.Open("/selfservice/strategy/webauthn/.schema/settings.schema.json")))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return decoderx.NewHTTP().Decode(r, dest, compiler,
+		decoderx.HTTPDecoderSetValidatePayloads(false),
+		decoderx.HTTPDecoderJSONFollowsFormFormat(),
+	)
+}
+
+func (s *Strategy) continueSettingsFlow(
+	w http.ResponseWriter, r *http.Request,
+	ctxUpdate *settings.UpdateContext, p *CompleteSelfServiceSettingsFlowWithWebAuthnMethod,
+) {
+	if err := flow.VerifyRequest(r, ctxUpdate.Flow.Type, s.d.GenerateCSRFToken, p.CSRFToken); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	if ctxUpdate.Session.AuthenticatedAt.Add(s.c.SelfServiceFlowSettingsPrivilegedSessionMaxAge()).Before(time.Now()) {
+		s.handleSettingsError(w, r, ctxUpdate, p, errors.WithStack(settings.NewFlowNeedsReAuth()))
+		return
+	}
+
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), ctxUpdate.Session.Identity.ID)
+	if err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	var o CredentialsConfig
+	if _, err := i.ParseCredentials(s.ID(), &o); err != nil && !errors.Is(err, herodot.ErrNotFound) {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	if len(p.Remove) > 0 {
+		if err := s.removeKey(&o, p.Remove); err != nil {
+			s.handleSettingsError(w, r, ctxUpdate, p, err)
+			return
+		}
+	} else if err := s.registerKey(r, ctxUpdate, p, i, &o); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	if err := s.setCredentials(i, &o); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+
+	if err := s.d.SettingsHookExecutor().PostSettingsHook(w, r, s.SettingsStrategyID(), ctxUpdate, i, settings.WithCallback(func(ctxUpdate *settings.UpdateContext) error {
+		return s.PopulateSettingsMethod(r, ctxUpdate.Session.Identity, ctxUpdate.Flow)
+	})); err != nil {
+		s.handleSettingsError(w, r, ctxUpdate, p, err)
+		return
+	}
+}
+
+func (s *Strategy) removeKey(o *CredentialsConfig, id string) error {
+	for k, cred := range o.Credentials {
+		if CredentialIdentifier(cred.ID) == id {
+			o.Credentials = append(o.Credentials[:k], o.Credentials[k+1:]...)
+			return nil
+		}
+	}
+
+	return errors.WithStack(herodot.ErrBadRequest.WithReasonf("The security key you are trying to remove does not exist."))
+}
+
+// registerKey verifies the response against the registration options which were shown in the
+// settings flow and adds the security key to the identity's credentials.
+func (s *Strategy) registerKey(r *http.Request, ctxUpdate *settings.UpdateContext, p *CompleteSelfServiceSettingsFlowWithWebAuthnMethod, i *identity.Identity, o *CredentialsConfig) error {
+	if len(p.Register) == 0 {
+		return schema.NewRequiredError("#/webauthn_register", "webauthn_register")
+	}
+
+	options := registrationOptions(ctxUpdate.Flow)
+	if options == nil {
+		return errors.WithStack(herodot.ErrBadRequest.WithReason("The settings flow does not contain a WebAuthn challenge. Please restart the flow."))
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(strings.NewReader(p.Register))
+	if err != nil {
+		s.d.Logger().WithRequest(r).WithError(err).Debug("Unable to parse WebAuthn registration response.")
+		return errors.WithStack(schema.NewWebAuthnVerifierWrongError("#/webauthn_register"))
+	}
+
+	web, err := s.newWebAuthn()
+	if err != nil {
+		return err
+	}
+
+	credential, err := web.CreateCredential(newUser(i, o), registrationSession(options), parsed)
+	if err != nil {
+		s.d.Logger().WithRequest(r).WithError(err).Debug("Unable to validate WebAuthn registration response.")
+		return errors.WithStack(schema.NewWebAuthnVerifierWrongError("#/webauthn_register"))
+	}
+
+	o.Credentials = append(o.Credentials, newCredential(credential, p.RegisterDisplayName))
+	return nil
+}
+
+// registrationOptions returns the registration options stored in the flow by PopulateSettingsMethod.
+// The options are read from the stored flow and never from the payload.
+func registrationOptions(f *settings.Flow) *protocol.CredentialCreation {
+	method, ok := f.Methods[identity.CredentialsTypeWebAuthn.String()]
+	if !ok || method.Config == nil {
+		return nil
+	}
+
+	raw := fieldValue(method.Config.FlowMethodConfigurator, "webauthn_register_options")
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var options protocol.CredentialCreation
+	if err := json.Unmarshal([]byte(raw), &options); err != nil {
+		return nil
+	}
+
+	return &options
+}
+
+func (s *Strategy) PopulateSettingsMethod(r *http.Request, id *identity.Identity, f *settings.Flow) error {
+	i, err := s.d.PrivilegedIdentityPool().GetIdentityConfidential(r.Context(), id.ID)
+	if err != nil {
+		return err
+	}
+
+	var o CredentialsConfig
+	if _, err := i.ParseCredentials(s.ID(), &o); err != nil && !errors.Is(err, herodot.ErrNotFound) {
+		return err
+	}
+
+	web, err := s.newWebAuthn()
+	if err != nil {
+		return err
+	}
+
+	exclude := make([]protocol.CredentialDescriptor, len(o.Credentials))
+	for k, cred := range o.Credentials {
+		exclude[k] = protocol.CredentialDescriptor{Type: protocol.PublicKeyCredentialType, CredentialID: cred.ID}
+	}
+
+	opts := []webauthn.RegistrationOption{webauthn.WithExclusions(exclude)}
+	if s.IsPasswordless() {
+		// Passwordless logins do not list the security keys of the identity, so the security key has to store the
+		// credential to find it.
+		opts = append(opts, webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			UserVerification:   protocol.VerificationPreferred,
+		}))
+	}
+
+	options, _, err := web.BeginRegistration(newUser(i, &o), opts...)
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to initiate WebAuthn registration: %s", err))
+	}
+
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode WebAuthn registration options to JSON: %s", err))
+	}
+
+	hf := &form.HTMLForm{Action: urlx.CopyWithQuery(urlx.AppendPaths(s.c.SelfPublicURL(), RouteSettings),
+		url.Values{"flow": {f.ID.String()}}).String(), Method: "POST"}
+	for _, cred := range o.Credentials {
+		hf.Fields = append(hf.Fields, form.Field{Name: "webauthn_remove", Type: "submit", Value: CredentialIdentifier(cred.ID)})
+	}
+	hf.Fields = append(hf.Fields,
+		form.Field{Name: "webauthn_register_options", Type: "hidden", Value: string(encoded)},
+		form.Field{Name: "webauthn_register_displayname", Type: "text"},
+		form.Field{Name: "webauthn_register", Type: "hidden"},
+	)
+	hf.SetCSRF(s.d.GenerateCSRFToken(r))
+
+	f.Methods[s.SettingsStrategyID()] = &settings.FlowMethod{
+		Method: s.SettingsStrategyID(),
+		Config: &settings.FlowMethodConfig{FlowMethodConfigurator: &FlowMethod{HTMLForm: hf}},
+	}
+	return nil
+}
+
+func (s *Strategy) handleSettingsError(w http.ResponseWriter, r *http.Request, ctxUpdate *settings.UpdateContext, p *CompleteSelfServiceSettingsFlowWithWebAuthnMethod, err error) {
+	// Do not pause flow if the flow type is an API flow as we can't save cookies in those flows.
+	if e := new(settings.FlowNeedsReAuth); errors.As(err, &e) && ctxUpdate.Flow != nil && ctxUpdate.Flow.Type == flow.TypeBrowser {
+		if err := s.d.ContinuityManager().Pause(r.Context(), w, r,
+			settings.ContinuityKey(s.SettingsStrategyID()), settings.ContinuityOptions(p, ctxUpdate.Session.Identity)...); err != nil {
+			s.d.SettingsFlowErrorHandler().WriteFlowError(w, r, s.SettingsStrategyID(), ctxUpdate.Flow, ctxUpdate.Session.Identity, err)
+			return
+		}
+	}
+
+	var id *identity.Identity
+	if ctxUpdate.Flow != nil {
+		// The challenge must survive the error as the browser might already use it.
+		ctxUpdate.Flow.Methods[s.SettingsStrategyID()].Config.Reset("webauthn_register_options", "webauthn_remove")
+		ctxUpdate.Flow.Methods[s.SettingsStrategyID()].Config.SetCSRF(s.d.GenerateCSRFToken(r))
+		id = ctxUpdate.Session.Identity
+	}
+
+	s.d.SettingsFlowErrorHandler().WriteFlowError(w, r, s.SettingsStrategyID(), ctxUpdate.Flow, id, err)
+}
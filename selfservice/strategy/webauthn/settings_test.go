@@ -0,0 +1,136 @@
+package webauthn_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ory/viper"
+
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/internal"
+	"github.com/zzpu/ums/internal/testhelpers"
+	"github.com/zzpu/ums/selfservice/flow/settings"
+	"github.com/zzpu/ums/selfservice/strategy/webauthn"
+	"github.com/zzpu/ums/text"
+	"github.com/zzpu/ums/x"
+)
+
+func TestSettings(t *testing.T) {
+	conf, reg := internal.NewFastRegistryWithMocks(t)
+	viper.Set(configuration.ViperKeySelfServiceBrowserDefaultReturnTo, "https://www.ory.sh/")
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://./stub/login.schema.json")
+	testhelpers.StrategyEnable(identity.CredentialsTypeWebAuthn.String(), true)
+	testhelpers.StrategyEnable(settings.StrategyProfile, true)
+
+	_ = testhelpers.NewSettingsUIFlowEchoServer(t, reg)
+	_ = testhelpers.NewErrorTestServer(t, reg)
+	_ = testhelpers.NewLoginUIWith401Response(t)
+	viper.Set(configuration.ViperKeySelfServiceSettingsPrivilegedAuthenticationAfter, "5m")
+
+	publicTS, _ := testhelpers.NewKratosServer(t, reg)
+	publicURL, err := url.Parse(publicTS.URL)
+	require.NoError(t, err)
+
+	submit := func(t *testing.T, isAPI bool, hc *http.Client, values func(url.Values), expectedStatusCode int) string {
+		return testhelpers.SubmitSettingsForm(t, isAPI, hc, publicTS, values,
+			identity.CredentialsTypeWebAuthn.String(), expectedStatusCode,
+			testhelpers.ExpectURL(isAPI, publicTS.URL+webauthn.RouteSettings, conf.SelfServiceFlowSettingsUI().String()))
+	}
+
+	credentials := func(t *testing.T, id *identity.Identity) []webauthn.Credential {
+		i, err := reg.PrivilegedIdentityPool().GetIdentityConfidential(context.Background(), id.ID)
+		require.NoError(t, err)
+
+		var o webauthn.CredentialsConfig
+		if _, err := i.ParseCredentials(identity.CredentialsTypeWebAuthn, &o); err != nil {
+			return nil
+		}
+		return o.Credentials
+	}
+
+	for _, tc := range []struct {
+		d     string
+		isAPI bool
+	}{
+		{d: "type=api", isAPI: true},
+		{d: "type=browser", isAPI: false},
+	} {
+		t.Run(tc.d, func(t *testing.T) {
+			id := &identity.Identity{
+				ID:       x.NewUUID(),
+				Traits:   identity.Traits(`{}`),
+				SchemaID: configuration.DefaultIdentityTraitsSchemaID,
+			}
+
+			var hc *http.Client
+			if tc.isAPI {
+				hc = testhelpers.NewHTTPClientWithIdentitySessionToken(t, reg, id)
+			} else {
+				hc = testhelpers.NewHTTPClientWithIdentitySessionCookie(t, reg, id)
+			}
+
+			key := newAuthenticator(t, publicURL.Hostname(), publicTS.URL)
+
+			t.Run("description=should fail if the response is not valid", func(t *testing.T) {
+				wrongOrigin := newAuthenticator(t, publicURL.Hostname(), "https://www.not-ory.sh")
+				actual := submit(t, tc.isAPI, hc, func(v url.Values) {
+					v.Set("webauthn_register", wrongOrigin.register(t, v.Get("webauthn_register_options")))
+				}, testhelpers.ExpectStatusCode(tc.isAPI, http.StatusBadRequest, http.StatusOK))
+
+				assert.EqualValues(t, text.ErrorValidationWebAuthnVerifierWrong, gjson.Get(actual, "methods.webauthn.config.fields.#(name==webauthn_register).messages.0.id").Int(), "%s", actual)
+				assert.NotEmpty(t, gjson.Get(actual, "methods.webauthn.config.fields.#(name==webauthn_register_options).value").String(), "%s", actual)
+				assert.Empty(t, credentials(t, id))
+			})
+
+			t.Run("description=should require a discoverable security key in passwordless mode", func(t *testing.T) {
+				viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".webauthn.config", map[string]interface{}{"passwordless": true})
+				t.Cleanup(func() {
+					viper.Set(configuration.ViperKeySelfServiceStrategyConfig+".webauthn.config", map[string]interface{}{})
+				})
+
+				wrongOrigin := newAuthenticator(t, publicURL.Hostname(), "https://www.not-ory.sh")
+				submit(t, tc.isAPI, hc, func(v url.Values) {
+					assert.True(t, gjson.Get(v.Get("webauthn_register_options"), "publicKey.authenticatorSelection.requireResidentKey").Bool(), "%s", v.Get("webauthn_register_options"))
+					v.Set("webauthn_register", wrongOrigin.register(t, v.Get("webauthn_register_options")))
+				}, testhelpers.ExpectStatusCode(tc.isAPI, http.StatusBadRequest, http.StatusOK))
+				assert.Empty(t, credentials(t, id))
+			})
+
+			t.Run("description=should register the security key", func(t *testing.T) {
+				actual := submit(t, tc.isAPI, hc, func(v url.Values) {
+					v.Set("webauthn_register", key.register(t, v.Get("webauthn_register_options")))
+					v.Set("webauthn_register_displayname", "my key")
+				}, http.StatusOK)
+
+				assert.EqualValues(t, settings.StateSuccess, gjson.Get(actual, testhelpers.ExpectURL(tc.isAPI, "flow.state", "state")).String(), "%s", actual)
+				assert.EqualValues(t, webauthn.CredentialIdentifier(key.id), gjson.Get(actual, testhelpers.ExpectURL(tc.isAPI, "flow.methods.webauthn.config.fields.#(name==webauthn_remove).value", "methods.webauthn.config.fields.#(name==webauthn_remove).value")).String(), "%s", actual)
+
+				creds := credentials(t, id)
+				require.Len(t, creds, 1)
+				assert.EqualValues(t, key.id, creds[0].ID)
+				assert.EqualValues(t, "my key", creds[0].DisplayName)
+
+				found, _, err := reg.PrivilegedIdentityPool().FindByCredentialsIdentifier(context.Background(), identity.CredentialsTypeWebAuthn, webauthn.CredentialIdentifier(key.id))
+				require.NoError(t, err)
+				assert.Equal(t, id.ID, found.ID)
+			})
+
+			t.Run("description=should remove the security key", func(t *testing.T) {
+				actual := submit(t, tc.isAPI, hc, func(v url.Values) {
+					v.Set("webauthn_remove", webauthn.CredentialIdentifier(key.id))
+				}, http.StatusOK)
+
+				assert.EqualValues(t, settings.StateSuccess, gjson.Get(actual, testhelpers.ExpectURL(tc.isAPI, "flow.state", "state")).String(), "%s", actual)
+				assert.False(t, gjson.Get(actual, testhelpers.ExpectURL(tc.isAPI, "flow.methods.webauthn.config.fields.#(name==webauthn_remove)", "methods.webauthn.config.fields.#(name==webauthn_remove)")).Exists(), "%s", actual)
+				assert.Empty(t, credentials(t, id))
+			})
+		})
+	}
+}
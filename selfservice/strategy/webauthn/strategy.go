@@ -0,0 +1,169 @@
+package webauthn
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/duo-labs/webauthn/webauthn"
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+	"github.com/ory/x/decoderx"
+	"github.com/ory/x/jsonx"
+
+	"github.com/zzpu/ums/continuity"
+	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/errorx"
+	"github.com/zzpu/ums/selfservice/flow/login"
+	"github.com/zzpu/ums/selfservice/flow/settings"
+	"github.com/zzpu/ums/session"
+	"github.com/zzpu/ums/x"
+)
+
+var _ login.Strategy = new(Strategy)
+var _ login.PasswordlessStrategy = new(Strategy)
+var _ settings.Strategy = new(Strategy)
+
+type strategyDependencies interface {
+	x.LoggingProvider
+	x.WriterProvider
+	x.CSRFTokenGeneratorProvider
+	x.CSRFProvider
+
+	continuity.ManagementProvider
+
+	errorx.ManagementProvider
+
+	login.HookExecutorProvider
+	login.FlowPersistenceProvider
+	login.ErrorHandlerProvider
+
+	settings.FlowPersistenceProvider
+	settings.HookExecutorProvider
+	settings.ErrorHandlerProvider
+
+	identity.PrivilegedPoolProvider
+
+	session.ManagementProvider
+}
+
+type Strategy struct {
+	c  configuration.Provider
+	d  strategyDependencies
+	hd *decoderx.HTTP
+}
+
+// Configuration is the configuration of the WebAuthn method.
+type Configuration struct {
+	// Passwordless allows security keys to be used without completing another factor.
+	Passwordless bool `json:"passwordless"`
+
+	// RelyingParty configures the relying party the security keys are registered for.
+	RelyingParty struct {
+		// ID defaults to the hostname of the public URL.
+		ID string `json:"id"`
+
+		// DisplayName defaults to the relying party ID.
+		DisplayName string `json:"display_name"`
+
+		// Origin defaults to the origin of the public URL.
+		Origin string `json:"origin"`
+	} `json:"rp"`
+}
+
+func NewStrategy(d strategyDependencies, c configuration.Provider) *Strategy {
+	return &Strategy{
+		c:  c,
+		d:  d,
+		hd: decoderx.NewHTTP(),
+	}
+}
+
+func (s *Strategy) ID() identity.CredentialsType {
+	return identity.CredentialsTypeWebAuthn
+}
+
+func (s *Strategy) Config() (*Configuration, error) {
+	var c Configuration
+
+	config := s.c.SelfServiceStrategy(string(s.ID())).Config
+	if err := jsonx.
+		NewStrictDecoder(bytes.NewBuffer(config)).
+		Decode(&c); err != nil {
+		s.d.Logger().WithError(err).WithField("config", config)
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to decode WebAuthn configuration: %s", err))
+	}
+
+	if len(c.RelyingParty.ID) == 0 {
+		c.RelyingParty.ID = s.c.SelfPublicURL().Hostname()
+	}
+
+	if len(c.RelyingParty.DisplayName) == 0 {
+		c.RelyingParty.DisplayName = c.RelyingParty.ID
+	}
+
+	if len(c.RelyingParty.Origin) == 0 {
+		c.RelyingParty.Origin = s.c.SelfPublicURL().Scheme + "://" + s.c.SelfPublicURL().Host
+	}
+
+	return &c, nil
+}
+
+func (s *Strategy) newWebAuthn() (*webauthn.WebAuthn, error) {
+	conf, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	web, err := webauthn.New(&webauthn.Config{
+		RPDisplayName: conf.RelyingParty.DisplayName,
+		RPID:          conf.RelyingParty.ID,
+		RPOrigin:      conf.RelyingParty.Origin,
+	})
+	if err != nil {
+		return nil, errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to initialize WebAuthn: %s", err))
+	}
+
+	return web, nil
+}
+
+func (s *Strategy) IsPasswordless() bool {
+	conf, err := s.Config()
+	if err != nil {
+		return false
+	}
+	return conf.Passwordless
+}
+
+func (s *Strategy) HasSecondFactor(i *identity.Identity) (bool, error) {
+	var o CredentialsConfig
+	if _, err := i.ParseCredentials(s.ID(), &o); errors.Is(err, herodot.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return len(o.Credentials) > 0, nil
+}
+
+// setCredentials stores the security keys in the identity's credentials. The credentials are
+// removed if no security key is left.
+func (s *Strategy) setCredentials(i *identity.Identity, o *CredentialsConfig) error {
+	if len(o.Credentials) == 0 {
+		delete(i.Credentials, s.ID())
+		return nil
+	}
+
+	co, err := json.Marshal(o)
+	if err != nil {
+		return errors.WithStack(herodot.ErrInternalServerError.WithReasonf("Unable to encode WebAuthn credentials to JSON: %s", err))
+	}
+
+	i.SetCredentials(s.ID(), identity.Credentials{
+		Type:        s.ID(),
+		Identifiers: o.Identifiers(),
+		Config:      co,
+	})
+	return nil
+}
@@ -0,0 +1,141 @@
+package webauthn_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/zzpu/ums/selfservice/strategy/webauthn"
+	"github.com/zzpu/ums/x"
+)
+
+// authenticator is a software security key which creates "none" attestations and ES256 assertions.
+type authenticator struct {
+	id      []byte
+	key     *ecdsa.PrivateKey
+	rpID    string
+	origin  string
+	counter uint32
+}
+
+func newAuthenticator(t *testing.T, rpID, origin string) *authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return &authenticator{id: []byte(x.NewUUID().String()), key: key, rpID: rpID, origin: origin}
+}
+
+func pad(i *big.Int) []byte {
+	b := i.Bytes()
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+func (a *authenticator) publicKey(t *testing.T) []byte {
+	pk, err := cbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: pad(a.key.PublicKey.X),
+		-3: pad(a.key.PublicKey.Y),
+	})
+	require.NoError(t, err)
+	return pk
+}
+
+// credential returns the credential as it would be stored after registration.
+func (a *authenticator) credential(t *testing.T) webauthn.Credential {
+	return webauthn.Credential{ID: a.id, PublicKey: a.publicKey(t), AttestationType: "none", DisplayName: "test key"}
+}
+
+func (a *authenticator) authData(attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	flags := byte(0x01) // user present
+	if len(attested) > 0 {
+		flags |= 0x40 // attested credential data included
+	}
+
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, a.counter)
+
+	data := append(rpIDHash[:], flags)
+	data = append(data, counter...)
+	return append(data, attested...)
+}
+
+// clientData encodes the challenge of the options the same way browsers do.
+func (a *authenticator) clientData(t *testing.T, typ, options string) []byte {
+	challenge, err := base64.StdEncoding.DecodeString(gjson.Get(options, "publicKey.challenge").String())
+	require.NoError(t, err)
+
+	cd, err := json.Marshal(map[string]string{"type": typ, "challenge": base64.RawURLEncoding.EncodeToString(challenge), "origin": a.origin})
+	require.NoError(t, err)
+	return cd
+}
+
+// register creates the response of `navigator.credentials.create()` for the given options.
+func (a *authenticator) register(t *testing.T, options string) string {
+	idLength := make([]byte, 2)
+	binary.BigEndian.PutUint16(idLength, uint16(len(a.id)))
+
+	attested := append(make([]byte, 16), idLength...)
+	attested = append(attested, a.id...)
+	attested = append(attested, a.publicKey(t)...)
+
+	attestation, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(attested),
+	})
+	require.NoError(t, err)
+
+	return a.encode(t, map[string]interface{}{
+		"clientDataJSON":    a.clientData(t, "webauthn.create", options),
+		"attestationObject": attestation,
+	})
+}
+
+// login creates the response of `navigator.credentials.get()` for the given options.
+func (a *authenticator) login(t *testing.T, options string) string {
+	a.counter++
+	authData := a.authData(nil)
+	clientData := a.clientData(t, "webauthn.get", options)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	r, s, err := ecdsa.Sign(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+	signature, err := asn1.Marshal(struct{ R, S *big.Int }{R: r, S: s})
+	require.NoError(t, err)
+
+	return a.encode(t, map[string]interface{}{
+		"clientDataJSON":    clientData,
+		"authenticatorData": authData,
+		"signature":         signature,
+	})
+}
+
+func (a *authenticator) encode(t *testing.T, response map[string]interface{}) string {
+	encoded := map[string]string{}
+	for k, v := range response {
+		encoded[k] = base64.RawURLEncoding.EncodeToString(v.([]byte))
+	}
+
+	out, err := json.Marshal(map[string]interface{}{
+		"id":       base64.RawURLEncoding.EncodeToString(a.id),
+		"rawId":    base64.RawURLEncoding.EncodeToString(a.id),
+		"type":     "public-key",
+		"response": encoded,
+	})
+	require.NoError(t, err)
+	return string(out)
+}
@@ -0,0 +1,197 @@
+package webauthn
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/duo-labs/webauthn/protocol"
+	"github.com/duo-labs/webauthn/webauthn"
+
+	"github.com/zzpu/ums/identity"
+	"github.com/zzpu/ums/selfservice/form"
+)
+
+type (
+	// CredentialsConfig is the struct that is being used as part of the identity credentials.
+	CredentialsConfig struct {
+		// Credentials lists the security keys registered by the identity.
+		Credentials []Credential `json:"credentials"`
+	}
+
+	// Credential is a single security key or platform authenticator.
+	Credential struct {
+		// ID is the credential ID assigned by the authenticator.
+		ID []byte `json:"id"`
+
+		// PublicKey is the COSE encoded public key of the credential.
+		PublicKey []byte `json:"public_key"`
+
+		// AttestationType is the attestation format used when the credential was registered.
+		AttestationType string `json:"attestation_type"`
+
+		// Authenticator contains the AAGUID and sign counter of the authenticator.
+		Authenticator Authenticator `json:"authenticator"`
+
+		// DisplayName is the name chosen by the user for this key.
+		DisplayName string `json:"display_name"`
+
+		// AddedAt is the time the key was registered.
+		AddedAt time.Time `json:"added_at"`
+	}
+
+	Authenticator struct {
+		// AAGUID identifies the authenticator model.
+		AAGUID []byte `json:"aaguid"`
+
+		// SignCount is the last sign counter reported by the authenticator.
+		SignCount uint32 `json:"sign_count"`
+
+		// CloneWarning is set if the sign counter went backwards, which indicates a cloned authenticator.
+		CloneWarning bool `json:"clone_warning"`
+	}
+
+	// CompleteSelfServiceLoginFlowWithWebAuthnMethod is used to decode the login form payload.
+	CompleteSelfServiceLoginFlowWithWebAuthnMethod struct {
+		// Identifier is used to look up the security keys of the identity in passwordless login.
+		Identifier string `form:"identifier" json:"identifier,omitempty"`
+
+		// Login is the JSON encoded result of `navigator.credentials.get()` for the
+		// options found in `webauthn_login_options`.
+		Login string `form:"webauthn_login" json:"webauthn_login,omitempty"`
+
+		// Sending the anti-csrf token is only required for browser login flows.
+		CSRFToken string `form:"csrf_token" json:"csrf_token"`
+	}
+)
+
+// FlowMethod contains the configuration for this selfservice strategy.
+type FlowMethod struct {
+	*form.HTMLForm
+}
+
+// CredentialIdentifier returns the credential identifier of a security key. Credential IDs are
+// unique, which is why they are used to find the identity a security key belongs to.
+func CredentialIdentifier(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+func newCredential(c *webauthn.Credential, displayName string) Credential {
+	return Credential{
+		ID:              c.ID,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		Authenticator: Authenticator{
+			AAGUID:       c.Authenticator.AAGUID,
+			SignCount:    c.Authenticator.SignCount,
+			CloneWarning: c.Authenticator.CloneWarning,
+		},
+		DisplayName: displayName,
+		AddedAt:     time.Now().UTC().Round(time.Second),
+	}
+}
+
+func (c *Credential) toWebAuthn() webauthn.Credential {
+	return webauthn.Credential{
+		ID:              c.ID,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		Authenticator: webauthn.Authenticator{
+			AAGUID:       c.Authenticator.AAGUID,
+			SignCount:    c.Authenticator.SignCount,
+			CloneWarning: c.Authenticator.CloneWarning,
+		},
+	}
+}
+
+// Identifiers returns the credential identifiers of all registered security keys.
+func (c *CredentialsConfig) Identifiers() []string {
+	ids := make([]string, len(c.Credentials))
+	for k, cred := range c.Credentials {
+		ids[k] = CredentialIdentifier(cred.ID)
+	}
+	return ids
+}
+
+// user adapts an identity and its security keys to the WebAuthn library.
+type user struct {
+	id          []byte
+	name        string
+	credentials []webauthn.Credential
+}
+
+var _ webauthn.User = new(user)
+
+func newUser(i *identity.Identity, c *CredentialsConfig) *user {
+	name := i.ID.String()
+	if pc, ok := i.GetCredentials(identity.CredentialsTypePassword); ok && len(pc.Identifiers) > 0 && len(pc.Identifiers[0]) > 0 {
+		name = pc.Identifiers[0]
+	}
+
+	credentials := make([]webauthn.Credential, len(c.Credentials))
+	for k := range c.Credentials {
+		credentials[k] = c.Credentials[k].toWebAuthn()
+	}
+
+	return &user{id: i.ID.Bytes(), name: name, credentials: credentials}
+}
+
+func (u *user) WebAuthnID() []byte {
+	return u.id
+}
+
+func (u *user) WebAuthnName() string {
+	return u.name
+}
+
+func (u *user) WebAuthnDisplayName() string {
+	return u.name
+}
+
+func (u *user) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *user) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// registrationSession recreates the session data of a registration from the options stored in the flow.
+func registrationSession(o *protocol.CredentialCreation) webauthn.SessionData {
+	return webauthn.SessionData{
+		Challenge:        base64.RawURLEncoding.EncodeToString(o.Response.Challenge),
+		UserID:           o.Response.User.ID,
+		UserVerification: o.Response.AuthenticatorSelection.UserVerification,
+	}
+}
+
+// loginSession recreates the session data of a login from the options stored in the flow.
+func loginSession(o *protocol.CredentialAssertion, i *identity.Identity) webauthn.SessionData {
+	return webauthn.SessionData{
+		Challenge:            base64.RawURLEncoding.EncodeToString(o.Response.Challenge),
+		UserID:               i.ID.Bytes(),
+		AllowedCredentialIDs: o.Response.GetAllowedCredentialIDs(),
+		UserVerification:     o.Response.UserVerification,
+	}
+}
+
+// fieldValue returns the value of the named field of a method form stored in a flow.
+func fieldValue(configurator interface{}, name string) string {
+	var hf *form.HTMLForm
+	switch c := configurator.(type) {
+	case *form.HTMLForm:
+		hf = c
+	case *FlowMethod:
+		hf = c.HTMLForm
+	default:
+		return ""
+	}
+
+	for _, field := range hf.Fields {
+		if field.Name == name {
+			v, _ := field.Value.(string)
+			return v
+		}
+	}
+
+	return ""
+}
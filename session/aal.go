@@ -0,0 +1,49 @@
+package session
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/ory/herodot"
+)
+
+// Authenticator Assurance Level (AAL)
+//
+// The authenticator assurance level describes which authentication factors were used to authenticate a session:
+//
+// - `aal1`: The identity authenticated using a single factor (e.g. a password).
+// - `aal2`: The identity additionally completed a second factor (e.g. a TOTP code or a security key).
+//
+// swagger:model authenticatorAssuranceLevel
+type AuthenticatorAssuranceLevel string
+
+const (
+	AuthenticatorAssuranceLevel1 AuthenticatorAssuranceLevel = "aal1"
+	AuthenticatorAssuranceLevel2 AuthenticatorAssuranceLevel = "aal2"
+)
+
+var (
+	// ErrAALNotSatisfied is returned when a session does not satisfy the required authenticator assurance level.
+	ErrAALNotSatisfied = herodot.ErrForbidden.WithError("session does not satisfy the required authenticator assurance level").WithReason("This endpoint requires a session with a higher authenticator assurance level. Please complete a second authentication factor and try again.")
+)
+
+// ParseAuthenticatorAssuranceLevel parses the given value or returns an error if it is not a known level.
+func ParseAuthenticatorAssuranceLevel(value string) (AuthenticatorAssuranceLevel, error) {
+	switch l := AuthenticatorAssuranceLevel(value); l {
+	case AuthenticatorAssuranceLevel1, AuthenticatorAssuranceLevel2:
+		return l, nil
+	}
+	return "", errors.WithStack(herodot.ErrBadRequest.WithReasonf("Authenticator assurance level %q is unknown, expected one of: %s, %s", value, AuthenticatorAssuranceLevel1, AuthenticatorAssuranceLevel2))
+}
+
+func (l AuthenticatorAssuranceLevel) rank() int {
+	if l == AuthenticatorAssuranceLevel2 {
+		return 2
+	}
+	// Sessions issued before assurance levels were introduced used a single factor.
+	return 1
+}
+
+// Satisfies returns true if the level is at least as high as the required level.
+func (l AuthenticatorAssuranceLevel) Satisfies(required AuthenticatorAssuranceLevel) bool {
+	return l.rank() >= required.rank()
+}
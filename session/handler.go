@@ -2,6 +2,7 @@ package session
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/pkg/errors"
@@ -11,8 +12,11 @@ import (
 	"github.com/ory/x/errorsx"
 
 	"github.com/ory/herodot"
+	"github.com/ory/x/urlx"
 
+	"github.com/zzpu/ums/apikey"
 	"github.com/zzpu/ums/driver/configuration"
+	"github.com/zzpu/ums/identity"
 	"github.com/zzpu/ums/x"
 )
 
@@ -23,21 +27,26 @@ type (
 		x.WriterProvider
 		x.LoggingProvider
 		x.CSRFProvider
+		apikey.ManagementProvider
+		identity.PoolProvider
 	}
 	HandlerProvider interface {
 		SessionHandler() *Handler
 	}
 	Handler struct {
 		r  handlerDependencies
+		c  configuration.Provider
 		dx *decoderx.HTTP
 	}
 )
 
 func NewHandler(
 	r handlerDependencies,
+	c configuration.Provider,
 ) *Handler {
 	return &Handler{
 		r:  r,
+		c:  c,
 		dx: decoderx.NewHTTP(),
 	}
 }
@@ -45,7 +54,10 @@ func NewHandler(
 const (
 	RouteWhoami = "/sessions/whoami"
 	RouteRevoke = "/sessions"
-	// SessionsWhoisPath  = "/sessions/whois"
+
+	RouteAdminWhois            = "/sessions/whois"
+	RouteAdminSession          = "/sessions/:id"
+	RouteAdminIdentitySessions = identity.RouteBase + "/:id/sessions"
 )
 
 func (h *Handler) RegisterPublicRoutes(public *x.RouterPublic) {
@@ -60,7 +72,11 @@ func (h *Handler) RegisterPublicRoutes(public *x.RouterPublic) {
 }
 
 func (h *Handler) RegisterAdminRoutes(admin *x.RouterAdmin) {
-	// admin.GET(SessionsWhoisPath, h.fromPath)
+	admin.POST(RouteAdminWhois, h.whois)
+	admin.GET(RouteAdminSession, h.get)
+	admin.DELETE(RouteAdminSession, h.revokeByID)
+	admin.GET(RouteAdminIdentitySessions, h.listByIdentity)
+	admin.DELETE(RouteAdminIdentitySessions, h.revokeByIdentity)
 }
 
 // swagger:parameters revokeSession
@@ -118,6 +134,262 @@ func (h *Handler) revoke(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// A list of sessions.
+// swagger:response sessionList
+// nolint:deadcode,unused
+type sessionListResponse struct {
+	// in: body
+	// required: true
+	// type: array
+	Body []Session
+}
+
+// swagger:parameters listIdentitySessions
+// nolint:deadcode,unused
+type listIdentitySessionsParameters struct {
+	// ID is the identity's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+
+	// Items per Page
+	//
+	// This is the number of items per page.
+	//
+	// required: false
+	// in: query
+	// default: 100
+	// min: 1
+	// max: 500
+	PerPage int `json:"per_page"`
+
+	// Pagination Page
+	//
+	// required: false
+	// in: query
+	// default: 0
+	// min: 0
+	Page int `json:"page"`
+}
+
+// swagger:route GET /identities/{id}/sessions admin listIdentitySessions
+//
+// List an Identity's Sessions
+//
+// Lists all sessions of an identity, including revoked and expired sessions, newest first.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: sessionList
+//       404: genericError
+//       500: genericError
+func (h *Handler) listByIdentity(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	i, err := h.r.IdentityPool().GetIdentity(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	page, itemsPerPage := x.ParsePagination(r)
+	sessions, err := h.r.SessionPersister().ListSessionsByIdentity(r.Context(), i.ID, page, itemsPerPage)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	total, err := h.r.SessionPersister().CountSessionsByIdentity(r.Context(), i.ID)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	for k := range sessions {
+		sessions[k].Identity = sessions[k].Identity.CopyWithoutCredentials()
+	}
+
+	x.PaginationHeader(w, urlx.AppendPaths(h.c.SelfAdminURL(), identity.RouteBase, i.ID.String(), "sessions"), total, page, itemsPerPage)
+	h.r.Writer().Write(w, r, sessions)
+}
+
+// swagger:parameters revokeIdentitySessions
+// nolint:deadcode,unused
+type revokeIdentitySessionsParameters struct {
+	// ID is the identity's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// swagger:route DELETE /identities/{id}/sessions admin revokeIdentitySessions
+//
+// Revoke all Sessions of an Identity
+//
+// Marks all sessions of an identity inactive. This signs the identity out everywhere, for example when an
+// account was compromised. HTTP Cookies are not removed.
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) revokeByIdentity(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	i, err := h.r.IdentityPool().GetIdentity(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := h.r.SessionPersister().RevokeSessionsByIdentity(r.Context(), i.ID); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Audit().
+		WithRequest(r).
+		WithField("identity_id", i.ID).
+		Info("All sessions of the identity were revoked.")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:parameters getSession revokeSessionByID
+// nolint:deadcode,unused
+type sessionParameters struct {
+	// ID is the session's ID.
+	//
+	// required: true
+	// in: path
+	ID string `json:"id"`
+}
+
+// swagger:route GET /sessions/{id} admin getSession
+//
+// Get a Session
+//
+// Returns the session with the given ID, including revoked and expired sessions. The identity's credentials
+// are not included.
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: session
+//       404: genericError
+//       500: genericError
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s, err := h.r.SessionPersister().GetSession(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	s.Identity = s.Identity.CopyWithoutCredentials()
+	h.r.Writer().Write(w, r, s)
+}
+
+// swagger:route DELETE /sessions/{id} admin revokeSessionByID
+//
+// Revoke a Session
+//
+// Marks the session with the given ID inactive. HTTP Cookies are not removed.
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       204: emptyResponse
+//       404: genericError
+//       500: genericError
+func (h *Handler) revokeByID(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s, err := h.r.SessionPersister().GetSession(r.Context(), x.ParseUUID(ps.ByName("id")))
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if err := h.r.SessionPersister().RevokeSession(r.Context(), s.ID); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	h.r.Audit().
+		WithRequest(r).
+		WithField("identity_id", s.IdentityID).
+		WithField("session_id", s.ID).
+		Info("The session was revoked.")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// swagger:parameters whois
+// nolint:deadcode,unused
+type whoisParameters struct {
+	// in: body
+	// required: true
+	Body whoisBody
+}
+
+type whoisBody struct {
+	// The Session Token
+	//
+	// Look up the session of this session token.
+	//
+	// required: true
+	SessionToken string `json:"session_token"`
+}
+
+// swagger:route POST /sessions/whois admin whois
+//
+// Look up a Session by its Token
+//
+// Returns the session which belongs to the session token, including revoked and expired sessions. The token is
+// sent in the body to keep it out of access logs. The identity's credentials are not included.
+//
+//     Consumes:
+//     - application/json
+//
+//     Produces:
+//     - application/json
+//
+//     Schemes: http, https
+//
+//     Responses:
+//       200: session
+//       400: genericError
+//       404: genericError
+//       500: genericError
+func (h *Handler) whois(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var p whoisBody
+	if err := h.dx.Decode(r, &p,
+		decoderx.HTTPJSONDecoder(),
+		decoderx.HTTPDecoderAllowedMethods("POST")); err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	if len(p.SessionToken) == 0 {
+		h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrBadRequest.WithReason("The session token must not be empty.")))
+		return
+	}
+
+	s, err := h.r.SessionPersister().GetSessionByToken(r.Context(), p.SessionToken)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	s.Identity = s.Identity.CopyWithoutCredentials()
+	h.r.Writer().Write(w, r, s)
+}
+
 // nolint:deadcode,unused
 // swagger:parameters whoami
 type whoamiParameters struct {
@@ -126,6 +398,14 @@ type whoamiParameters struct {
 
 	// in: authorization
 	Authorization string `json:"Authorization"`
+
+	// Required Authenticator Assurance Level
+	//
+	// If set to `aal2`, sessions which were authenticated using a single factor are rejected
+	// with a 403 error.
+	//
+	// in: query
+	AAL string `json:"aal"`
 }
 
 // swagger:route GET /sessions/whoami public whoami
@@ -136,6 +416,13 @@ type whoamiParameters struct {
 // Returns a session object in the body or 401 if the credentials are invalid or no credentials were sent.
 // Additionally when the request it successful it adds the user ID to the 'X-Kratos-Authenticated-Identity-Id' header in the response.
 //
+// Instead of a session token, an API key (`ak_...`) can be sent as bearer token. In that case the response contains
+// a session which is derived from the key and additionally sets the 'X-Kratos-API-Key-Id' and 'X-Kratos-API-Key-Scopes'
+// headers. API keys are always of authenticator assurance level `aal1`.
+//
+// If the query parameter `?aal=aal2` is set, the session must have been authenticated using a second factor or a
+// 403 error is returned. The session can be upgraded using the login flow with `?aal=aal2`.
+//
 // This endpoint is useful for reverse proxies and API Gateways.
 //
 //     Produces:
@@ -148,9 +435,15 @@ type whoamiParameters struct {
 //
 //     Responses:
 //       200: session
+//       400: genericError
 //       403: genericError
 //       500: genericError
 func (h *Handler) whoami(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if token, ok := bearerTokenFromRequest(r); ok && apikey.IsToken(token) {
+		h.whoamiAPIKey(w, r, token)
+		return
+	}
+
 	s, err := h.r.SessionManager().FetchFromRequest(r.Context(), r)
 	if err != nil {
 		h.r.Audit().WithRequest(r).WithError(err).Info("No valid session cookie found.")
@@ -159,6 +452,16 @@ func (h *Handler) whoami(w http.ResponseWriter, r *http.Request, ps httprouter.P
 		return
 	}
 
+	if s.CredentialsExpired {
+		h.r.Audit().WithRequest(r).WithField("session_id", s.ID).Info("The session was rejected because its credentials have expired.")
+		h.r.Writer().WriteError(w, r, errors.WithStack(ErrCredentialsExpired))
+		return
+	}
+
+	if !h.satisfiesRequestedAAL(w, r, s) {
+		return
+	}
+
 	// s.Devices = nil
 	s.Identity = s.Identity.CopyWithoutCredentials()
 
@@ -168,6 +471,48 @@ func (h *Handler) whoami(w http.ResponseWriter, r *http.Request, ps httprouter.P
 	h.r.Writer().Write(w, r, s)
 }
 
+func (h *Handler) whoamiAPIKey(w http.ResponseWriter, r *http.Request, token string) {
+	i, key, err := h.r.APIKeyManager().Authenticate(r.Context(), token)
+	if err != nil {
+		h.r.Audit().WithRequest(r).WithError(err).Info("No valid API key found.")
+		h.r.Writer().WriteError(w, r, err)
+		return
+	}
+
+	s := newAPIKeySession(i, key, h.c)
+	if !h.satisfiesRequestedAAL(w, r, s) {
+		return
+	}
+
+	w.Header().Set("X-Kratos-Authenticated-Identity-Id", s.Identity.ID.String())
+	w.Header().Set("X-Kratos-API-Key-Id", key.ID.String())
+	w.Header().Set("X-Kratos-API-Key-Scopes", strings.Join(key.Scopes, " "))
+
+	h.r.Writer().Write(w, r, s)
+}
+
+// satisfiesRequestedAAL checks the session against the `aal` query parameter and writes an error if the session
+// does not satisfy it.
+func (h *Handler) satisfiesRequestedAAL(w http.ResponseWriter, r *http.Request, s *Session) bool {
+	aal := r.URL.Query().Get("aal")
+	if len(aal) == 0 {
+		return true
+	}
+
+	required, err := ParseAuthenticatorAssuranceLevel(aal)
+	if err != nil {
+		h.r.Writer().WriteError(w, r, err)
+		return false
+	}
+
+	if !s.AAL.Satisfies(required) {
+		h.r.Writer().WriteError(w, r, errors.WithStack(ErrAALNotSatisfied))
+		return false
+	}
+
+	return true
+}
+
 func (h *Handler) IsAuthenticated(wrap httprouter.Handle, onUnauthenticated httprouter.Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		if _, err := h.r.SessionManager().FetchFromRequest(r.Context(), r); err != nil {
@@ -184,6 +529,36 @@ func (h *Handler) IsAuthenticated(wrap httprouter.Handle, onUnauthenticated http
 	}
 }
 
+// IsAuthenticatedWithAAL behaves like IsAuthenticated but additionally requires the session to satisfy the
+// given authenticator assurance level. onInsufficientAAL is called if the session is valid but was authenticated
+// with a lower level.
+func (h *Handler) IsAuthenticatedWithAAL(required AuthenticatorAssuranceLevel, wrap, onUnauthenticated, onInsufficientAAL httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		s, err := h.r.SessionManager().FetchFromRequest(r.Context(), r)
+		if err != nil {
+			if onUnauthenticated != nil {
+				onUnauthenticated(w, r, ps)
+				return
+			}
+
+			h.r.Writer().WriteError(w, r, errors.WithStack(herodot.ErrForbidden.WithReason("This endpoint can only be accessed with a valid session. Please log in and try again.").WithDebugf("%+v", err)))
+			return
+		}
+
+		if !s.AAL.Satisfies(required) {
+			if onInsufficientAAL != nil {
+				onInsufficientAAL(w, r, ps)
+				return
+			}
+
+			h.r.Writer().WriteError(w, r, errors.WithStack(ErrAALNotSatisfied))
+			return
+		}
+
+		wrap(w, r, ps)
+	}
+}
+
 func (h *Handler) IsNotAuthenticated(wrap httprouter.Handle, onAuthenticated httprouter.Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		if _, err := h.r.SessionManager().FetchFromRequest(r.Context(), r); err != nil {
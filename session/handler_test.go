@@ -3,14 +3,17 @@ package session_test
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
 
 	"github.com/ory/x/pointerx"
 
@@ -40,7 +43,7 @@ func send(code int) httprouter.Handle {
 
 func TestSessionWhoAmI(t *testing.T) {
 	t.Run("public", func(t *testing.T) {
-		_, reg := internal.NewFastRegistryWithMocks(t)
+		conf, reg := internal.NewFastRegistryWithMocks(t)
 		r := x.NewRouterPublic()
 
 		// set this intermediate because kratos needs some valid url for CRUDE operations
@@ -48,7 +51,7 @@ func TestSessionWhoAmI(t *testing.T) {
 		h, _ := testhelpers.MockSessionCreateHandler(t, reg)
 		r.GET("/set", h)
 
-		NewHandler(reg).RegisterPublicRoutes(r)
+		NewHandler(reg, conf).RegisterPublicRoutes(r)
 		ts := httptest.NewServer(r)
 		defer ts.Close()
 
@@ -81,6 +84,75 @@ func TestSessionWhoAmI(t *testing.T) {
 				assert.NotEmpty(t, res.Header.Get("X-Kratos-Authenticated-Identity-Id"))
 			})
 		}
+
+		t.Run("case=required aal", func(t *testing.T) {
+			for aal, code := range map[string]int{
+				"aal1": http.StatusOK,
+				"aal2": http.StatusForbidden,
+				"aal9": http.StatusBadRequest,
+			} {
+				res, err := client.Get(ts.URL + RouteWhoami + "?aal=" + aal)
+				require.NoError(t, err)
+				assert.EqualValues(t, code, res.StatusCode, aal)
+			}
+		})
+	})
+}
+
+func TestSessionWhoAmIWithAPIKey(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+	publicTS, _ := testhelpers.NewKratosServer(t, reg)
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://stub/identity.schema.json")
+
+	i := &identity.Identity{Traits: identity.Traits(`{}`)}
+	require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+
+	expiresAt := time.Now().Add(time.Minute).UTC()
+	key, err := reg.APIKeyManager().Create(context.Background(), i.ID, "ci", []string{"read", "write"}, &expiresAt)
+	require.NoError(t, err)
+
+	whoami := func(t *testing.T, token, query string) (*http.Response, gjson.Result) {
+		req, err := http.NewRequest("GET", publicTS.URL+RouteWhoami+query, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := publicTS.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, gjson.ParseBytes(body)
+	}
+
+	t.Run("case=valid key", func(t *testing.T) {
+		res, body := whoami(t, key.Token, "")
+		require.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body.Raw)
+		assert.Equal(t, i.ID.String(), res.Header.Get("X-Kratos-Authenticated-Identity-Id"))
+		assert.Equal(t, key.ID.String(), res.Header.Get("X-Kratos-API-Key-Id"))
+		assert.Equal(t, "read write", res.Header.Get("X-Kratos-API-Key-Scopes"))
+		assert.Equal(t, i.ID.String(), body.Get("identity.id").String(), "%s", body.Raw)
+		assert.Equal(t, "aal1", body.Get("aal").String(), "%s", body.Raw)
+		assert.True(t, body.Get("active").Bool(), "%s", body.Raw)
+		assert.False(t, body.Get("identity.credentials").Exists(), "%s", body.Raw)
+
+		actual, err := time.Parse(time.RFC3339Nano, body.Get("expires_at").String())
+		require.NoError(t, err)
+		assert.True(t, actual.Equal(expiresAt), "%s", body.Raw)
+	})
+
+	t.Run("case=key does not satisfy aal2", func(t *testing.T) {
+		res, _ := whoami(t, key.Token, "?aal=aal2")
+		assert.EqualValues(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("case=invalid key", func(t *testing.T) {
+		res, _ := whoami(t, key.Token+"a", "")
+		assert.EqualValues(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("case=revoked key", func(t *testing.T) {
+		require.NoError(t, reg.APIKeyManager().Revoke(context.Background(), i.ID, key.ID))
+		res, _ := whoami(t, key.Token, "")
+		assert.EqualValues(t, http.StatusUnauthorized, res.StatusCode)
 	})
 }
 
@@ -104,6 +176,127 @@ func TestSessionRevoke(t *testing.T) {
 	assert.False(t, actual.IsActive())
 }
 
+func TestSessionAdmin(t *testing.T) {
+	conf, reg := internal.NewFastRegistryWithMocks(t)
+	publicTS, adminTS := testhelpers.NewKratosServer(t, reg)
+	viper.Set(configuration.ViperKeyDefaultIdentitySchemaURL, "file://stub/identity.schema.json")
+
+	createIdentity := func(t *testing.T) (*identity.Identity, []*Session) {
+		i := &identity.Identity{Traits: identity.Traits(`{"baz":"bar"}`)}
+		require.NoError(t, reg.PrivilegedIdentityPool().CreateIdentity(context.Background(), i))
+
+		sessions := make([]*Session, 3)
+		for k := range sessions {
+			sessions[k] = NewActiveSession(i, conf, time.Now())
+			require.NoError(t, reg.SessionPersister().CreateSession(context.Background(), sessions[k]))
+		}
+		return i, sessions
+	}
+
+	request := func(t *testing.T, method, path, body string) (*http.Response, gjson.Result) {
+		req, err := http.NewRequest(method, adminTS.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		res, err := adminTS.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		raw, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, gjson.ParseBytes(raw)
+	}
+
+	isActive := func(t *testing.T, s *Session) bool {
+		req, err := http.NewRequest("GET", publicTS.URL+RouteWhoami, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+		res, err := publicTS.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		return res.StatusCode == http.StatusOK
+	}
+
+	t.Run("case=list sessions of an identity", func(t *testing.T) {
+		i, sessions := createIdentity(t)
+		_, _ = createIdentity(t)
+
+		res, body := request(t, "GET", "/identities/"+i.ID.String()+"/sessions", "")
+		require.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body.Raw)
+		require.Len(t, body.Array(), len(sessions), "%s", body.Raw)
+		for _, s := range body.Array() {
+			assert.Equal(t, i.ID.String(), s.Get("identity.id").String(), "%s", body.Raw)
+			assert.False(t, s.Get("identity.credentials").Exists(), "%s", body.Raw)
+			assert.False(t, s.Get("token").Exists(), "%s", body.Raw)
+		}
+
+		res, body = request(t, "GET", "/identities/"+i.ID.String()+"/sessions?per_page=2", "")
+		require.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body.Raw)
+		assert.Len(t, body.Array(), 2, "%s", body.Raw)
+		assert.NotEmpty(t, res.Header.Get("Link"))
+
+		res, _ = request(t, "GET", "/identities/"+x.NewUUID().String()+"/sessions", "")
+		assert.EqualValues(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("case=get a session", func(t *testing.T) {
+		i, sessions := createIdentity(t)
+
+		res, body := request(t, "GET", "/sessions/"+sessions[0].ID.String(), "")
+		require.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body.Raw)
+		assert.Equal(t, sessions[0].ID.String(), body.Get("id").String(), "%s", body.Raw)
+		assert.Equal(t, i.ID.String(), body.Get("identity.id").String(), "%s", body.Raw)
+		assert.True(t, body.Get("active").Bool(), "%s", body.Raw)
+
+		res, _ = request(t, "GET", "/sessions/"+x.NewUUID().String(), "")
+		assert.EqualValues(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("case=look up a session by its token", func(t *testing.T) {
+		i, sessions := createIdentity(t)
+
+		res, body := request(t, "POST", RouteAdminWhois, `{"session_token":"`+sessions[1].Token+`"}`)
+		require.EqualValues(t, http.StatusOK, res.StatusCode, "%s", body.Raw)
+		assert.Equal(t, sessions[1].ID.String(), body.Get("id").String(), "%s", body.Raw)
+		assert.Equal(t, i.ID.String(), body.Get("identity.id").String(), "%s", body.Raw)
+		assert.False(t, body.Get("identity.credentials").Exists(), "%s", body.Raw)
+
+		res, _ = request(t, "POST", RouteAdminWhois, `{"session_token":"not-a-token"}`)
+		assert.EqualValues(t, http.StatusNotFound, res.StatusCode)
+
+		res, _ = request(t, "POST", RouteAdminWhois, `{}`)
+		assert.EqualValues(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("case=revoke a session", func(t *testing.T) {
+		_, sessions := createIdentity(t)
+		require.True(t, isActive(t, sessions[0]))
+
+		res, body := request(t, "DELETE", "/sessions/"+sessions[0].ID.String(), "")
+		require.EqualValues(t, http.StatusNoContent, res.StatusCode, "%s", body.Raw)
+
+		assert.False(t, isActive(t, sessions[0]))
+		assert.True(t, isActive(t, sessions[1]))
+
+		res, _ = request(t, "DELETE", "/sessions/"+x.NewUUID().String(), "")
+		assert.EqualValues(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("case=revoke all sessions of an identity", func(t *testing.T) {
+		i, sessions := createIdentity(t)
+		_, others := createIdentity(t)
+
+		res, body := request(t, "DELETE", "/identities/"+i.ID.String()+"/sessions", "")
+		require.EqualValues(t, http.StatusNoContent, res.StatusCode, "%s", body.Raw)
+
+		for _, s := range sessions {
+			assert.False(t, isActive(t, s))
+		}
+		assert.True(t, isActive(t, others[0]))
+
+		res, _ = request(t, "DELETE", "/identities/"+x.NewUUID().String()+"/sessions", "")
+		assert.EqualValues(t, http.StatusNotFound, res.StatusCode)
+	})
+}
+
 func TestIsNotAuthenticatedSecurecookie(t *testing.T) {
 	_, reg := internal.NewFastRegistryWithMocks(t)
 	r := x.NewRouterPublic()
@@ -238,3 +431,74 @@ func TestIsAuthenticated(t *testing.T) {
 		})
 	}
 }
+
+func TestIsAuthenticatedWithAAL(t *testing.T) {
+	_, reg := internal.NewFastRegistryWithMocks(t)
+	reg.WithCSRFHandler(new(x.FakeCSRFHandler))
+	r := x.NewRouterPublic()
+	// set this intermediate because kratos needs some valid url for CRUDE operations
+	viper.Set(configuration.ViperKeyPublicBaseURL, "http://example.com")
+
+	aal1, _ := testhelpers.MockSessionCreateHandler(t, reg)
+	aal2, sess := testhelpers.MockSessionCreateHandler(t, reg)
+	sess.AAL = AuthenticatorAssuranceLevel2
+	require.NoError(t, reg.SessionPersister().UpdateSession(context.Background(), sess))
+
+	r.GET("/set/aal1", aal1)
+	r.GET("/set/aal2", aal2)
+	r.GET("/privileged/with-callback", reg.SessionHandler().IsAuthenticatedWithAAL(AuthenticatorAssuranceLevel2, send(http.StatusOK), send(http.StatusBadRequest), send(http.StatusUnauthorized)))
+	r.GET("/privileged/without-callback", reg.SessionHandler().IsAuthenticatedWithAAL(AuthenticatorAssuranceLevel2, send(http.StatusOK), nil, nil))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	viper.Set(configuration.ViperKeyPublicBaseURL, ts.URL)
+
+	aal1Client := testhelpers.NewClientWithCookies(t)
+	testhelpers.MockHydrateCookieClient(t, aal1Client, ts.URL+"/set/aal1")
+	aal2Client := testhelpers.NewClientWithCookies(t)
+	testhelpers.MockHydrateCookieClient(t, aal2Client, ts.URL+"/set/aal2")
+
+	for k, tc := range []struct {
+		c    *http.Client
+		call string
+		code int
+	}{
+		{
+			c:    aal2Client,
+			call: "/privileged/with-callback",
+			code: http.StatusOK,
+		},
+		{
+			c:    aal1Client,
+			call: "/privileged/with-callback",
+			code: http.StatusUnauthorized,
+		},
+		{
+			c:    http.DefaultClient,
+			call: "/privileged/with-callback",
+			code: http.StatusBadRequest,
+		},
+
+		{
+			c:    aal2Client,
+			call: "/privileged/without-callback",
+			code: http.StatusOK,
+		},
+		{
+			c:    aal1Client,
+			call: "/privileged/without-callback",
+			code: http.StatusForbidden,
+		},
+		{
+			c:    http.DefaultClient,
+			call: "/privileged/without-callback",
+			code: http.StatusForbidden,
+		},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			res, err := tc.c.Get(ts.URL + tc.call)
+			require.NoError(t, err)
+
+			assert.EqualValues(t, tc.code, res.StatusCode)
+		})
+	}
+}
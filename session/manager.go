@@ -13,6 +13,9 @@ const DefaultSessionCookieName = "ory_kratos_session"
 var (
 	// ErrNoActiveSessionFound is returned when no active cookie session could be found in the request.
 	ErrNoActiveSessionFound = herodot.ErrUnauthorized.WithError("request does not have a valid authentication session").WithReason("No active session was found in this request.")
+
+	// ErrCredentialsExpired is returned when the credentials used to sign in have expired and were not changed yet.
+	ErrCredentialsExpired = herodot.ErrForbidden.WithError("the credentials of the session have expired").WithReason("The credentials used to sign in have expired. Please change them using the settings flow and try again.")
 )
 
 // Manager handles identity sessions.
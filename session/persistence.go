@@ -27,6 +27,9 @@ type Persister interface {
 	// CreateSession adds a session to the store.
 	CreateSession(ctx context.Context, s *Session) error
 
+	// UpdateSession updates an existing session in the store.
+	UpdateSession(ctx context.Context, s *Session) error
+
 	// DeleteSession removes a session from the store.
 	DeleteSession(ctx context.Context, id uuid.UUID) error
 
@@ -47,6 +50,22 @@ type Persister interface {
 
 	// RevokeSessionByToken marks a session inactive with the given token.
 	RevokeSessionByToken(ctx context.Context, token string) error
+
+	// ListSessionsByIdentity lists the sessions of the given identity, including inactive ones, newest first.
+	ListSessionsByIdentity(ctx context.Context, identity uuid.UUID, page, perPage int) ([]Session, error)
+
+	// CountSessionsByIdentity counts the sessions of the given identity, including inactive ones.
+	CountSessionsByIdentity(ctx context.Context, identity uuid.UUID) (int64, error)
+
+	// RevokeSession marks the session with the given ID inactive.
+	RevokeSession(ctx context.Context, sid uuid.UUID) error
+
+	// RevokeSessionsByIdentity marks all sessions of the given identity inactive.
+	RevokeSessionsByIdentity(ctx context.Context, identity uuid.UUID) error
+
+	// ClearCredentialsExpiredByIdentity marks the credentials of all sessions of the given identity as no longer
+	// expired. It is called once the identity changed its expired credentials.
+	ClearCredentialsExpiredByIdentity(ctx context.Context, identity uuid.UUID) error
 }
 
 func TestPersister(p interface {
@@ -65,6 +84,7 @@ func TestPersister(p interface {
 			var expected Session
 			require.NoError(t, faker.FakeData(&expected))
 			expected.Active = true
+			expected.AAL = AuthenticatorAssuranceLevel1
 			require.NoError(t, p.CreateIdentity(context.Background(), expected.Identity))
 
 			assert.Equal(t, uuid.Nil, expected.ID)
@@ -78,6 +98,7 @@ func TestPersister(p interface {
 				assert.NotEmpty(t, actual.Identity.SchemaID)
 				assert.Equal(t, expected.ID, actual.ID)
 				assert.Equal(t, expected.Active, actual.Active)
+				assert.Equal(t, expected.AAL, actual.AAL)
 				assert.Equal(t, expected.Token, actual.Token)
 				assert.EqualValues(t, expected.ExpiresAt.Unix(), actual.ExpiresAt.Unix())
 				assert.Equal(t, expected.AuthenticatedAt.Unix(), actual.AuthenticatedAt.Unix())
@@ -93,6 +114,24 @@ func TestPersister(p interface {
 			})
 		})
 
+		t.Run("case=update session", func(t *testing.T) {
+			var expected Session
+			require.NoError(t, faker.FakeData(&expected))
+			expected.Active = true
+			expected.AAL = AuthenticatorAssuranceLevel1
+			require.NoError(t, p.CreateIdentity(context.Background(), expected.Identity))
+			require.NoError(t, p.CreateSession(context.Background(), &expected))
+
+			expected.AAL = AuthenticatorAssuranceLevel2
+			require.NoError(t, p.UpdateSession(context.Background(), &expected))
+
+			actual, err := p.GetSession(context.Background(), expected.ID)
+			require.NoError(t, err)
+			assert.Equal(t, AuthenticatorAssuranceLevel2, actual.AAL)
+			assert.Equal(t, expected.Token, actual.Token)
+			assert.Equal(t, expected.Identity.ID, actual.Identity.ID)
+		})
+
 		t.Run("case=delete session", func(t *testing.T) {
 			var expected Session
 			require.NoError(t, faker.FakeData(&expected))
@@ -133,6 +172,102 @@ func TestPersister(p interface {
 			assert.False(t, actual.Active)
 		})
 
+		t.Run("case=clear expired credentials by identity", func(t *testing.T) {
+			var expected, other Session
+			require.NoError(t, faker.FakeData(&expected))
+			expected.CredentialsExpired = true
+			require.NoError(t, p.CreateIdentity(context.Background(), expected.Identity))
+			require.NoError(t, p.CreateSession(context.Background(), &expected))
+
+			require.NoError(t, faker.FakeData(&other))
+			other.CredentialsExpired = true
+			require.NoError(t, p.CreateIdentity(context.Background(), other.Identity))
+			require.NoError(t, p.CreateSession(context.Background(), &other))
+
+			actual, err := p.GetSession(context.Background(), expected.ID)
+			require.NoError(t, err)
+			assert.True(t, actual.CredentialsExpired)
+
+			require.NoError(t, p.ClearCredentialsExpiredByIdentity(context.Background(), expected.Identity.ID))
+
+			actual, err = p.GetSession(context.Background(), expected.ID)
+			require.NoError(t, err)
+			assert.False(t, actual.CredentialsExpired)
+
+			actual, err = p.GetSession(context.Background(), other.ID)
+			require.NoError(t, err)
+			assert.True(t, actual.CredentialsExpired)
+		})
+
+		t.Run("case=list and revoke sessions by identity", func(t *testing.T) {
+			var seed Session
+			require.NoError(t, faker.FakeData(&seed))
+			i := seed.Identity
+			require.NoError(t, p.CreateIdentity(context.Background(), i))
+
+			var other Session
+			require.NoError(t, faker.FakeData(&other))
+			other.Active = true
+			require.NoError(t, p.CreateIdentity(context.Background(), other.Identity))
+			require.NoError(t, p.CreateSession(context.Background(), &other))
+
+			actual, err := p.ListSessionsByIdentity(context.Background(), i.ID, 0, 10)
+			require.NoError(t, err)
+			assert.Len(t, actual, 0)
+
+			expected := make([]Session, 3)
+			for k := range expected {
+				require.NoError(t, faker.FakeData(&expected[k]))
+				expected[k].Active = true
+				expected[k].Identity = i
+				expected[k].IdentityID = i.ID
+				require.NoError(t, p.CreateSession(context.Background(), &expected[k]))
+			}
+
+			count, err := p.CountSessionsByIdentity(context.Background(), i.ID)
+			require.NoError(t, err)
+			assert.EqualValues(t, 3, count)
+
+			actual, err = p.ListSessionsByIdentity(context.Background(), i.ID, 0, 10)
+			require.NoError(t, err)
+			require.Len(t, actual, 3)
+			for k := range actual {
+				assert.Equal(t, i.ID, actual[k].Identity.ID)
+				assert.True(t, actual[k].Active)
+			}
+
+			actual, err = p.ListSessionsByIdentity(context.Background(), i.ID, 2, 2)
+			require.NoError(t, err)
+			assert.Len(t, actual, 1)
+
+			t.Run("method=revoke by id", func(t *testing.T) {
+				require.NoError(t, p.RevokeSession(context.Background(), expected[0].ID))
+
+				actual, err := p.GetSession(context.Background(), expected[0].ID)
+				require.NoError(t, err)
+				assert.False(t, actual.Active)
+
+				actual, err = p.GetSession(context.Background(), expected[1].ID)
+				require.NoError(t, err)
+				assert.True(t, actual.Active)
+			})
+
+			t.Run("method=revoke by identity", func(t *testing.T) {
+				require.NoError(t, p.RevokeSessionsByIdentity(context.Background(), i.ID))
+
+				actual, err := p.ListSessionsByIdentity(context.Background(), i.ID, 0, 10)
+				require.NoError(t, err)
+				require.Len(t, actual, 3)
+				for k := range actual {
+					assert.False(t, actual[k].Active)
+				}
+
+				s, err := p.GetSession(context.Background(), other.ID)
+				require.NoError(t, err)
+				assert.True(t, s.Active)
+			})
+		})
+
 		t.Run("case=delete session for", func(t *testing.T) {
 			var expected1 Session
 			var expected2 Session
@@ -7,6 +7,7 @@ import (
 
 	"github.com/ory/x/randx"
 
+	"github.com/zzpu/ums/apikey"
 	"github.com/zzpu/ums/identity"
 	"github.com/zzpu/ums/x"
 )
@@ -27,6 +28,23 @@ type Session struct {
 	// required: true
 	IssuedAt time.Time `json:"issued_at" db:"issued_at" faker:"time_type"`
 
+	// Authenticator Assurance Level
+	//
+	// The authenticator assurance level of this session. It is `aal2` if a second factor
+	// was used when authenticating the session.
+	//
+	// required: true
+	AAL AuthenticatorAssuranceLevel `json:"aal" db:"aal" faker:"-"`
+
+	// Credentials Expired
+	//
+	// Is true if the identity signed in with credentials which have expired, for example a password which is
+	// older than the configured maximum age. Until the credentials are changed in the settings flow, the session
+	// is rejected by the whoami endpoint.
+	//
+	// required: true
+	CredentialsExpired bool `json:"credentials_expired" db:"credentials_expired" faker:"-"`
+
 	// required: true
 	Identity *identity.Identity `json:"identity" faker:"identity" db:"-" belongs_to:"identities" fk_id:"IdentityID"`
 
@@ -56,6 +74,30 @@ func NewActiveSession(i *identity.Identity, c interface {
 		IdentityID:      i.ID,
 		Token:           randx.MustString(32, randx.AlphaNum),
 		Active:          true,
+		AAL:             AuthenticatorAssuranceLevel1,
+	}
+}
+
+// newAPIKeySession returns a session which is derived from an API key. It is never persisted. The session
+// expires with the key or, if the key does not expire, after the configured session lifespan.
+func newAPIKeySession(i *identity.Identity, k *apikey.Key, c interface {
+	SessionLifespan() time.Duration
+}) *Session {
+	now := time.Now().UTC()
+	expiresAt := now.Add(c.SessionLifespan())
+	if k.ExpiresAt != nil && k.ExpiresAt.Before(expiresAt) {
+		expiresAt = *k.ExpiresAt
+	}
+
+	return &Session{
+		ID:              k.ID,
+		ExpiresAt:       expiresAt,
+		AuthenticatedAt: now,
+		IssuedAt:        k.CreatedAt,
+		Identity:        i.CopyWithoutCredentials(),
+		IdentityID:      i.ID,
+		Active:          true,
+		AAL:             AuthenticatorAssuranceLevel1,
 	}
 }
 
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/zzpu/ums/identity"
 	"github.com/zzpu/ums/internal"
@@ -17,7 +18,34 @@ func TestSession(t *testing.T) {
 
 	s := session.NewActiveSession(new(identity.Identity), conf, authAt)
 	assert.True(t, s.IsActive())
+	assert.Equal(t, session.AuthenticatorAssuranceLevel1, s.AAL)
 
 	assert.False(t, (&session.Session{ExpiresAt: time.Now().Add(time.Hour)}).IsActive())
 	assert.False(t, (&session.Session{Active: true}).IsActive())
 }
+
+func TestAuthenticatorAssuranceLevel(t *testing.T) {
+	for _, tc := range []struct {
+		actual   session.AuthenticatorAssuranceLevel
+		required session.AuthenticatorAssuranceLevel
+		expected bool
+	}{
+		{actual: session.AuthenticatorAssuranceLevel1, required: session.AuthenticatorAssuranceLevel1, expected: true},
+		{actual: session.AuthenticatorAssuranceLevel1, required: session.AuthenticatorAssuranceLevel2, expected: false},
+		{actual: session.AuthenticatorAssuranceLevel2, required: session.AuthenticatorAssuranceLevel1, expected: true},
+		{actual: session.AuthenticatorAssuranceLevel2, required: session.AuthenticatorAssuranceLevel2, expected: true},
+		{actual: "", required: session.AuthenticatorAssuranceLevel1, expected: true},
+		{actual: "", required: session.AuthenticatorAssuranceLevel2, expected: false},
+	} {
+		t.Run("case="+string(tc.actual)+"-"+string(tc.required), func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.actual.Satisfies(tc.required))
+		})
+	}
+
+	l, err := session.ParseAuthenticatorAssuranceLevel("aal2")
+	require.NoError(t, err)
+	assert.Equal(t, session.AuthenticatorAssuranceLevel2, l)
+
+	_, err = session.ParseAuthenticatorAssuranceLevel("aal3")
+	require.Error(t, err)
+}
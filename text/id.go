@@ -7,7 +7,8 @@ const (
 )
 
 const (
-	InfoSelfServiceMFA ID = 1030000 + iota
+	InfoSelfServiceMFA                     ID = 1030000 + iota // 1030000
+	InfoSelfServiceMFASecondFactorRequired                     // 1030001
 )
 
 const (
@@ -8,28 +8,48 @@ import (
 
 func TestIDs(t *testing.T) {
 	assert.Equal(t, 1010000, int(InfoSelfServiceLogin))
+	assert.Equal(t, 1010001, int(InfoSelfServiceLoginEmailSent))
+	assert.Equal(t, 1010002, int(InfoSelfServiceLoginLinkAccount))
 
 	assert.Equal(t, 1020000, int(InfoSelfServiceLogout))
 
 	assert.Equal(t, 1030000, int(InfoSelfServiceMFA))
+	assert.Equal(t, 1030001, int(InfoSelfServiceMFASecondFactorRequired))
 
 	assert.Equal(t, 1040000, int(InfoSelfServiceRegistration))
 
 	assert.Equal(t, 1050000, int(InfoSelfServiceSettings))
 	assert.Equal(t, 1050001, int(InfoSelfServiceSettingsUpdateSuccess))
+	assert.Equal(t, 1050002, int(InfoSelfServiceSettingsBackupCodesGenerated))
+	assert.Equal(t, 1050003, int(InfoSelfServiceSettingsBackupCodesLow))
+	assert.Equal(t, 1050004, int(InfoSelfServiceSettingsPasswordExpired))
 
 	assert.Equal(t, 1060000, int(InfoSelfServiceRecovery))
 	assert.Equal(t, 1060001, int(InfoSelfServiceRecoverySuccessful))
 	assert.Equal(t, 1060002, int(InfoSelfServiceRecoveryEmailSent))
+	assert.Equal(t, 1060003, int(InfoSelfServiceRecoveryAskSecurityQuestions))
+	assert.Equal(t, 1060004, int(InfoSelfServiceRecoverySecurityQuestion))
+	assert.Equal(t, 1060005, int(InfoSelfServiceRecoveryEmailWithCodeSent))
+	assert.Equal(t, 1060006, int(InfoSelfServiceRecoveryPhoneWithCodeSent))
 
 	assert.Equal(t, 1070000, int(InfoSelfServiceVerification))
+	assert.Equal(t, 1070003, int(InfoSelfServiceVerificationEmailWithCodeSent))
+	assert.Equal(t, 1070004, int(InfoSelfServiceVerificationPhoneWithCodeSent))
 
 	assert.Equal(t, 4000000, int(ErrorValidation))
 	assert.Equal(t, 4000001, int(ErrorValidationGeneric))
 	assert.Equal(t, 4000002, int(ErrorValidationRequired))
+	assert.Equal(t, 4000008, int(ErrorValidationTOTPVerifierWrong))
+	assert.Equal(t, 4000009, int(ErrorValidationWebAuthnVerifierWrong))
+	assert.Equal(t, 4000010, int(ErrorValidationCodeInvalidOrAlreadyUsed))
+	assert.Equal(t, 4000011, int(ErrorValidationCodeAttemptsExceeded))
+	assert.Equal(t, 4000012, int(ErrorValidationCodeSendsExceeded))
 
 	assert.Equal(t, 4010000, int(ErrorValidationLogin))
 	assert.Equal(t, 4010001, int(ErrorValidationLoginFlowExpired))
+	assert.Equal(t, 4010002, int(ErrorValidationLoginTokenInvalidOrAlreadyUsed))
+	assert.Equal(t, 4010003, int(ErrorValidationLoginDelayed))
+	assert.Equal(t, 4010004, int(ErrorValidationLoginLocked))
 
 	assert.Equal(t, 4040000, int(ErrorValidationRegistration))
 	assert.Equal(t, 4040001, int(ErrorValidationRegistrationFlowExpired))
@@ -40,6 +60,9 @@ func TestIDs(t *testing.T) {
 	assert.Equal(t, 4060000, int(ErrorValidationRecovery))
 	assert.Equal(t, 4060001, int(ErrorValidationRecoveryRetrySuccess))
 	assert.Equal(t, 4060002, int(ErrorValidationRecoveryStateFailure))
+	assert.Equal(t, 4060006, int(ErrorValidationRecoveryBackupCodeInvalidOrAlreadyUsed))
+	assert.Equal(t, 4060007, int(ErrorValidationRecoverySecurityAnswersInvalid))
+	assert.Equal(t, 4060008, int(ErrorValidationRecoverySecurityQuestionsLocked))
 
 	assert.Equal(t, 4070000, int(ErrorValidationVerification))
 	assert.Equal(t, 4070001, int(ErrorValidationVerificationTokenInvalidOrAlreadyUsed))
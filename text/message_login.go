@@ -2,16 +2,22 @@ package text
 
 import (
 	"fmt"
+	"math"
 	"time"
 )
 
 const (
-	InfoSelfServiceLogin ID = 1010000 + iota
+	InfoSelfServiceLogin            ID = 1010000 + iota // 1010000
+	InfoSelfServiceLoginEmailSent                       // 1010001
+	InfoSelfServiceLoginLinkAccount                     // 1010002
 )
 
 const (
-	ErrorValidationLogin            ID = 4010000 + iota // 4010000
-	ErrorValidationLoginFlowExpired                     // 4010001
+	ErrorValidationLogin                          ID = 4010000 + iota // 4010000
+	ErrorValidationLoginFlowExpired                                   // 4010001
+	ErrorValidationLoginTokenInvalidOrAlreadyUsed                     // 4010002
+	ErrorValidationLoginDelayed                                       // 4010003
+	ErrorValidationLoginLocked                                        // 4010004
 )
 
 func NewErrorValidationLoginFlowExpired(ago time.Duration) *Message {
@@ -24,3 +30,55 @@ func NewErrorValidationLoginFlowExpired(ago time.Duration) *Message {
 		}),
 	}
 }
+
+func NewLoginEmailSent() *Message {
+	return &Message{
+		ID:      InfoSelfServiceLoginEmailSent,
+		Type:    Info,
+		Text:    "An email containing a login link has been sent to the email address you provided.",
+		Context: context(nil),
+	}
+}
+
+func NewErrorValidationLoginTokenInvalidOrAlreadyUsed() *Message {
+	return &Message{
+		ID:      ErrorValidationLoginTokenInvalidOrAlreadyUsed,
+		Text:    "The login link is invalid or has already been used. Please retry the flow.",
+		Type:    Error,
+		Context: context(nil),
+	}
+}
+
+func NewInfoSelfServiceLoginLinkAccount(identifier, provider string) *Message {
+	return &Message{
+		ID:   InfoSelfServiceLoginLinkAccount,
+		Type: Info,
+		Text: fmt.Sprintf("An account with the identifier %s exists already. Please enter its password to link your %s account.", identifier, provider),
+		Context: context(map[string]interface{}{
+			"identifier": identifier,
+			"provider":   provider,
+		}),
+	}
+}
+
+func NewErrorValidationLoginDelayed(retryAt time.Time) *Message {
+	return &Message{
+		ID:   ErrorValidationLoginDelayed,
+		Text: fmt.Sprintf("Too many failed login attempts. Please try again in %.0f seconds.", math.Ceil(time.Until(retryAt).Seconds())),
+		Type: Error,
+		Context: context(map[string]interface{}{
+			"retry_at": retryAt,
+		}),
+	}
+}
+
+func NewErrorValidationLoginLocked(lockedUntil time.Time) *Message {
+	return &Message{
+		ID:   ErrorValidationLoginLocked,
+		Text: fmt.Sprintf("This account is locked because of too many failed login attempts. Please try again in %.2f minutes.", time.Until(lockedUntil).Minutes()),
+		Type: Error,
+		Context: context(map[string]interface{}{
+			"locked_until": lockedUntil,
+		}),
+	}
+}
@@ -0,0 +1,10 @@
+package text
+
+func NewInfoSelfServiceMFASecondFactorRequired() *Message {
+	return &Message{
+		ID:      InfoSelfServiceMFASecondFactorRequired,
+		Text:    "Please complete the second authentication challenge.",
+		Type:    Info,
+		Context: context(nil),
+	}
+}
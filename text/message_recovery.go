@@ -10,18 +10,25 @@ import (
 )
 
 const (
-	InfoSelfServiceRecovery           ID = 1060000 + iota // 1060000
-	InfoSelfServiceRecoverySuccessful                     // 1060001
-	InfoSelfServiceRecoveryEmailSent                      // 1060002
+	InfoSelfServiceRecovery                     ID = 1060000 + iota // 1060000
+	InfoSelfServiceRecoverySuccessful                               // 1060001
+	InfoSelfServiceRecoveryEmailSent                                // 1060002
+	InfoSelfServiceRecoveryAskSecurityQuestions                     // 1060003
+	InfoSelfServiceRecoverySecurityQuestion                         // 1060004
+	InfoSelfServiceRecoveryEmailWithCodeSent                        // 1060005
+	InfoSelfServiceRecoveryPhoneWithCodeSent                        // 1060006
 )
 
 const (
-	ErrorValidationRecovery                          ID = 4060000 + iota // 4060000
-	ErrorValidationRecoveryRetrySuccess                                  // 4060001
-	ErrorValidationRecoveryStateFailure                                  // 4060002
-	ErrorValidationRecoveryMissingRecoveryToken                          // 4060003
-	ErrorValidationRecoveryTokenInvalidOrAlreadyUsed                     // 4060004
-	ErrorValidationRecoveryFlowExpired                                   // 4060005
+	ErrorValidationRecovery                               ID = 4060000 + iota // 4060000
+	ErrorValidationRecoveryRetrySuccess                                       // 4060001
+	ErrorValidationRecoveryStateFailure                                       // 4060002
+	ErrorValidationRecoveryMissingRecoveryToken                               // 4060003
+	ErrorValidationRecoveryTokenInvalidOrAlreadyUsed                          // 4060004
+	ErrorValidationRecoveryFlowExpired                                        // 4060005
+	ErrorValidationRecoveryBackupCodeInvalidOrAlreadyUsed                     // 4060006
+	ErrorValidationRecoverySecurityAnswersInvalid                             // 4060007
+	ErrorValidationRecoverySecurityQuestionsLocked                            // 4060008
 )
 
 func NewErrorValidationRecoveryFlowExpired(ago time.Duration) *Message {
@@ -56,6 +63,24 @@ func NewRecoveryEmailSent() *Message {
 	}
 }
 
+func NewRecoveryEmailWithCodeSent() *Message {
+	return &Message{
+		ID:      InfoSelfServiceRecoveryEmailWithCodeSent,
+		Type:    Info,
+		Text:    "An email containing a recovery code has been sent to the email address you provided.",
+		Context: context(nil),
+	}
+}
+
+func NewRecoveryPhoneWithCodeSent() *Message {
+	return &Message{
+		ID:      InfoSelfServiceRecoveryPhoneWithCodeSent,
+		Type:    Info,
+		Text:    "A text message containing a recovery code has been sent to the phone number you provided.",
+		Context: context(nil),
+	}
+}
+
 func NewErrorValidationRecoveryMissingRecoveryToken() error {
 	return errors.WithStack(herodot.
 		ErrBadRequest.
@@ -89,3 +114,52 @@ func NewErrorValidationRecoveryStateFailure() *Message {
 		Context: context(nil),
 	}
 }
+
+func NewErrorValidationRecoveryBackupCodeInvalidOrAlreadyUsed() *Message {
+	return &Message{
+		ID:      ErrorValidationRecoveryBackupCodeInvalidOrAlreadyUsed,
+		Text:    "The backup code is invalid or has already been used. Please try again.",
+		Type:    Error,
+		Context: context(nil),
+	}
+}
+
+func NewRecoveryAskSecurityQuestions() *Message {
+	return &Message{
+		ID:      InfoSelfServiceRecoveryAskSecurityQuestions,
+		Type:    Info,
+		Text:    "Please answer the following questions to verify it is really you. These are your questions set up during registration or when you updated your profile.",
+		Context: context(nil),
+	}
+}
+
+func NewRecoverySecurityQuestion(id, question string) *Message {
+	return &Message{
+		ID:   InfoSelfServiceRecoverySecurityQuestion,
+		Type: Info,
+		Text: question,
+		Context: context(map[string]interface{}{
+			"question_id": id,
+		}),
+	}
+}
+
+func NewErrorValidationRecoverySecurityAnswersInvalid() *Message {
+	return &Message{
+		ID:      ErrorValidationRecoverySecurityAnswersInvalid,
+		Text:    "The answers to the security questions are incorrect. Please try again.",
+		Type:    Error,
+		Context: context(nil),
+	}
+}
+
+func NewErrorValidationRecoverySecurityQuestionsLocked(lockedUntil time.Time) *Message {
+	return &Message{
+		ID:   ErrorValidationRecoverySecurityQuestionsLocked,
+		Text: fmt.Sprintf("Too many incorrect answers. Please try again in %.2f minutes.", time.Until(lockedUntil).Minutes()),
+		Type: Error,
+		Context: context(map[string]interface{}{
+			"locked_until": lockedUntil,
+		}),
+	}
+}
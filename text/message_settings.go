@@ -8,6 +8,9 @@ import (
 const (
 	InfoSelfServiceSettings ID = 1050000 + iota
 	InfoSelfServiceSettingsUpdateSuccess
+	InfoSelfServiceSettingsBackupCodesGenerated
+	InfoSelfServiceSettingsBackupCodesLow
+	InfoSelfServiceSettingsPasswordExpired
 )
 
 const (
@@ -25,3 +28,32 @@ func NewErrorValidationSettingsFlowExpired(ago time.Duration) *Message {
 		}),
 	}
 }
+
+func NewInfoSelfServiceSettingsBackupCodesGenerated() *Message {
+	return &Message{
+		ID:      InfoSelfServiceSettingsBackupCodesGenerated,
+		Text:    "These are your new backup codes. Please store them in a safe place, they will not be shown again. Each code can only be used once.",
+		Type:    Info,
+		Context: context(nil),
+	}
+}
+
+func NewInfoSelfServiceSettingsBackupCodesLow(remaining int) *Message {
+	return &Message{
+		ID:   InfoSelfServiceSettingsBackupCodesLow,
+		Text: fmt.Sprintf("You have %d backup codes left. Please generate new backup codes.", remaining),
+		Type: Info,
+		Context: context(map[string]interface{}{
+			"remaining": remaining,
+		}),
+	}
+}
+
+func NewInfoSelfServiceSettingsPasswordExpired() *Message {
+	return &Message{
+		ID:      InfoSelfServiceSettingsPasswordExpired,
+		Text:    "Your password has expired. Please choose a new password.",
+		Type:    Info,
+		Context: context(nil),
+	}
+}
@@ -13,6 +13,11 @@ const (
 	ErrorValidationPasswordPolicyViolation
 	ErrorValidationInvalidCredentials
 	ErrorValidationDuplicateCredentials
+	ErrorValidationTOTPVerifierWrong
+	ErrorValidationWebAuthnVerifierWrong
+	ErrorValidationCodeInvalidOrAlreadyUsed
+	ErrorValidationCodeAttemptsExceeded
+	ErrorValidationCodeSendsExceeded
 )
 
 func NewValidationErrorGeneric(reason string) *Message {
@@ -87,3 +92,48 @@ func NewErrorValidationDuplicateCredentials() *Message {
 		Context: context(nil),
 	}
 }
+
+func NewErrorValidationTOTPVerifierWrong() *Message {
+	return &Message{
+		ID:      ErrorValidationTOTPVerifierWrong,
+		Text:    "The provided authentication code is invalid, please try again.",
+		Type:    Error,
+		Context: context(nil),
+	}
+}
+
+func NewErrorValidationWebAuthnVerifierWrong() *Message {
+	return &Message{
+		ID:      ErrorValidationWebAuthnVerifierWrong,
+		Text:    "The security key could not be verified, please try again.",
+		Type:    Error,
+		Context: context(nil),
+	}
+}
+
+func NewErrorValidationCodeInvalidOrAlreadyUsed() *Message {
+	return &Message{
+		ID:      ErrorValidationCodeInvalidOrAlreadyUsed,
+		Text:    "The code is invalid or has already been used, please try again.",
+		Type:    Error,
+		Context: context(nil),
+	}
+}
+
+func NewErrorValidationCodeAttemptsExceeded() *Message {
+	return &Message{
+		ID:      ErrorValidationCodeAttemptsExceeded,
+		Text:    "The code was entered incorrectly too many times, please request a new code.",
+		Type:    Error,
+		Context: context(nil),
+	}
+}
+
+func NewErrorValidationCodeSendsExceeded() *Message {
+	return &Message{
+		ID:      ErrorValidationCodeSendsExceeded,
+		Text:    "Too many codes were requested, please start over.",
+		Type:    Error,
+		Context: context(nil),
+	}
+}
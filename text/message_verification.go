@@ -9,6 +9,8 @@ const (
 	InfoSelfServiceVerification           ID = 1070000 + iota
 	InfoSelfServiceVerificationSuccessful    // 1060001
 	InfoSelfServiceVerificationEmailSent     // 1060002
+	InfoSelfServiceVerificationEmailWithCodeSent
+	InfoSelfServiceVerificationPhoneWithCodeSent
 )
 
 const (
@@ -40,6 +42,24 @@ func NewVerificationEmailSent() *Message {
 	}
 }
 
+func NewVerificationEmailWithCodeSent() *Message {
+	return &Message{
+		ID:      InfoSelfServiceVerificationEmailWithCodeSent,
+		Type:    Info,
+		Text:    "An email containing a verification code has been sent to the email address you provided.",
+		Context: context(nil),
+	}
+}
+
+func NewVerificationPhoneWithCodeSent() *Message {
+	return &Message{
+		ID:      InfoSelfServiceVerificationPhoneWithCodeSent,
+		Type:    Info,
+		Text:    "A text message containing a verification code has been sent to the phone number you provided.",
+		Context: context(nil),
+	}
+}
+
 func NewErrorValidationVerificationTokenInvalidOrAlreadyUsed() *Message {
 	return &Message{
 		ID:      ErrorValidationVerificationTokenInvalidOrAlreadyUsed,
@@ -62,6 +62,9 @@ func NewFakeCSRFHandler(name string) *FakeCSRFHandler {
 func (f *FakeCSRFHandler) ExemptPath(s string) {
 }
 
+func (f *FakeCSRFHandler) ExemptGlob(s string) {
+}
+
 func (f *FakeCSRFHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
@@ -77,6 +80,7 @@ type CSRFHandler interface {
 	http.Handler
 	RegenerateToken(w http.ResponseWriter, r *http.Request) string
 	ExemptPath(string)
+	ExemptGlob(string)
 }
 
 func NewCSRFHandler(router http.Handler, writer herodot.Writer, logger *logrusx.Logger, path string, domain string, secure bool) *nosurf.CSRFHandler {